@@ -6,6 +6,7 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"strconv"
 	"strings"
 
 	"gitlab.com/NebulousLabs/fastrand"
@@ -78,6 +79,20 @@ func ExchangeRate() string {
 	return os.Getenv(siaExchangeRate)
 }
 
+// MDMTrace returns whether the siaMDMTrace environment variable is set to a
+// true value.
+func MDMTrace() bool {
+	trace, _ := strconv.ParseBool(os.Getenv(siaMDMTrace))
+	return trace
+}
+
+// MDMTiming returns whether the siaMDMTiming environment variable is set to a
+// true value.
+func MDMTiming() bool {
+	timing, _ := strconv.ParseBool(os.Getenv(siaMDMTiming))
+	return timing
+}
+
 // apiPasswordFilePath returns the path to the API's password file. The password
 // file is stored in the Sia data directory.
 func apiPasswordFilePath() string {
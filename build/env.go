@@ -20,4 +20,12 @@ var (
 	// siaExchangeRate is the environment variable that can be set to
 	// show amounts (additionally) in a different currency
 	siaExchangeRate = "SIA_EXCHANGE_RATE"
+
+	// siaMDMTrace is the environment variable that can be set to log every
+	// instruction executed by the host's MDM
+	siaMDMTrace = "SIA_MDM_TRACE"
+
+	// siaMDMTiming is the environment variable that can be set to measure the
+	// execution time of the instructions executed by the host's MDM
+	siaMDMTiming = "SIA_MDM_TIMING"
 )
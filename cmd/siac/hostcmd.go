@@ -52,6 +52,10 @@ Available settings:
      netaddress:           string
      windowsize:           blocks
 
+     maxqueuedcontractpayments:    int
+     paybycontractexpirythreshold: blocks
+     maxpaybycontractcollateral:   currency
+
      collateral:       currency
      collateralbudget: currency
      maxcollateral:    currency
@@ -66,15 +70,23 @@ Available settings:
      ephemeralaccountexpiry:     seconds
      maxephemeralaccountbalance: currency
      maxephemeralaccountrisk:    currency
+
+     maxephemeralaccountspending:    currency
+     ephemeralaccountspendingwindow: seconds
+
+     programdatatimeout:     seconds
+     maxgainedsectorsmemory: filesize
+     verifysectorreads:      boolean
 	 
      registrysize:       filesize
      customregistrypath: string
 
 Currency units can be specified, e.g. 10SC; run 'siac help wallet' for details.
 
-Durations (maxduration and windowsize) must be specified in either blocks (b),
-hours (h), days (d), or weeks (w). A block is approximately 10 minutes, so one
-hour is six blocks, a day is 144 blocks, and a week is 1008 blocks.
+Durations (maxduration, windowsize and paybycontractexpirythreshold) must be
+specified in either blocks (b), hours (h), days (d), or weeks (w). A block is
+approximately 10 minutes, so one hour is six blocks, a day is 144 blocks, and a
+week is 1008 blocks.
 
 Timeouts (ephemeralaccountexpiry) must be specified in either seconds (s),
 hours (h), days (d), or weeks (w). One hour is 3600 seconds, a day is 86400
@@ -220,6 +232,10 @@ Host Internal Settings:
 	netaddress:           %v
 	windowsize:           %v Hours
 
+	maxqueuedcontractpayments:    %v
+	paybycontractexpirythreshold: %v Blocks
+	maxpaybycontractcollateral:   %v
+
 	collateral:       %v / TB / Month
 	collateralbudget: %v
 	maxcollateral:    %v Per Contract
@@ -235,6 +251,13 @@ Host Internal Settings:
 	maxephemeralaccountbalance: %v
 	maxephemeralaccountrisk:    %v
 
+	maxephemeralaccountspending:    %v
+	ephemeralaccountspendingwindow: %vs
+
+	programdatatimeout:     %vs
+	maxgainedsectorsmemory: %v
+	verifysectorreads:      %v
+
 	registrysize:       %v
 	customregistrypath: %v
 
@@ -264,6 +287,8 @@ RPC Stats:
 	Revise Calls:       %v
 	Settings Calls:     %v
 	FormContract Calls: %v
+
+	Non-Increasing Payment Revisions: %v
 `,
 			connectabilityString,
 			es.Version,
@@ -275,6 +300,10 @@ RPC Stats:
 			netaddr,
 			is.WindowSize/6,
 
+			is.MaxQueuedContractPayments,
+			is.PayByContractExpiryThreshold,
+			currencyUnits(is.MaxPayByContractCollateral),
+
 			currencyUnits(is.Collateral.Mul(modules.BlockBytesPerMonthTerabyte)),
 			currencyUnits(is.CollateralBudget),
 			currencyUnits(is.MaxCollateral),
@@ -289,6 +318,12 @@ RPC Stats:
 			is.EphemeralAccountExpiry.Seconds(),
 			currencyUnits(is.MaxEphemeralAccountBalance),
 			currencyUnits(is.MaxEphemeralAccountRisk),
+
+			currencyUnits(is.MaxEphemeralAccountSpending),
+			is.EphemeralAccountSpendingWindow.Seconds(),
+			is.ProgramDataTimeout.Seconds(),
+			modules.FilesizeUnits(is.MaxGainedSectorsMemory),
+			yesNo(is.VerifySectorReads),
 			modules.FilesizeUnits(is.RegistrySize),
 			is.CustomRegistryPath,
 
@@ -310,7 +345,9 @@ RPC Stats:
 
 			nm.ErrorCalls, nm.UnrecognizedCalls, nm.DownloadCalls,
 			nm.RenewCalls, nm.ReviseCalls, nm.SettingsCalls,
-			nm.FormContractCalls)
+			nm.FormContractCalls,
+
+			nm.NonIncreasingRevisions)
 	} else {
 		fmt.Printf(`Host info:
 	Connectability Status: %v
@@ -372,7 +409,7 @@ func hostconfigcmd(param, value string) {
 	var err error
 	switch param {
 	// currency (convert to hastings)
-	case "collateralbudget", "maxcollateral", "minbaserpcprice", "mincontractprice", "minsectoraccessprice", "maxephemeralaccountbalance", "maxephemeralaccountrisk":
+	case "collateralbudget", "maxcollateral", "minbaserpcprice", "mincontractprice", "minsectoraccessprice", "maxephemeralaccountbalance", "maxephemeralaccountrisk", "maxephemeralaccountspending", "maxpaybycontractcollateral":
 		value, err = types.ParseCurrency(value)
 		if err != nil {
 			die("Could not parse "+param+":", err)
@@ -399,7 +436,7 @@ func hostconfigcmd(param, value string) {
 		value = c.String()
 
 	// bool (allow "yes" and "no")
-	case "acceptingcontracts":
+	case "acceptingcontracts", "verifysectorreads":
 		switch strings.ToLower(value) {
 		case "yes":
 			value = "true"
@@ -408,21 +445,21 @@ func hostconfigcmd(param, value string) {
 		}
 
 	// duration (convert to blocks)
-	case "maxduration", "windowsize":
+	case "maxduration", "windowsize", "paybycontractexpirythreshold":
 		value, err = parsePeriod(value)
 		if err != nil {
 			die("Could not parse "+param+":", err)
 		}
 
 	// filesize (convert to bytes)
-	case "registrysize":
+	case "registrysize", "maxgainedsectorsmemory":
 		value, err = parseFilesize(value)
 		if err != nil {
 			die("Could not parse "+param+":", err)
 		}
 
 	// timeout (convert to seconds)
-	case "ephemeralaccountexpiry":
+	case "ephemeralaccountexpiry", "ephemeralaccountspendingwindow", "programdatatimeout":
 		value, err = parseTimeout(value)
 		if err != nil {
 			die("Could not parse "+param+":", err)
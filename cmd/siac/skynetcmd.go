@@ -953,7 +953,7 @@ func skynetUploadDirectory(sourcePath, destSiaPath string) {
 		SiaPath:             skyfilePath,
 		Force:               false,
 		Root:                false,
-		BaseChunkRedundancy: renter.SkyfileDefaultBaseChunkRedundancy,
+		BaseChunkRedundancy: renter.DefaultBaseChunkRedundancy(),
 		Reader:              pr,
 		Filename:            skyfilePath.Name(),
 		DefaultPath:         skynetUploadDefaultPath,
@@ -0,0 +1,72 @@
+package fixtures
+
+import (
+	"encoding/json"
+
+	"gitlab.com/NebulousLabs/Sia/crypto"
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/errors"
+)
+
+type (
+	// SkyfileFixture is a small skyfile built by BuildSkyfileFixture. It
+	// holds everything a test needs to serve or verify the skyfile without
+	// uploading it.
+	SkyfileFixture struct {
+		Skylink    modules.Skylink
+		Layout     modules.SkyfileLayout
+		BaseSector []byte
+		Metadata   modules.SkyfileMetadata
+		Content    []byte
+	}
+)
+
+// BuildSkyfileFixture builds the unencrypted base sector and skylink of a
+// skyfile with the given metadata and content. The result is identical to what
+// the renter produces when uploading the data as a small skyfile, so the
+// content and metadata have to fit within a single sector.
+func BuildSkyfileFixture(metadata modules.SkyfileMetadata, content []byte) (SkyfileFixture, error) {
+	err := modules.ValidateSkyfileMetadata(metadata, 0)
+	if err != nil {
+		return SkyfileFixture{}, errors.AddContext(err, "invalid skyfile metadata")
+	}
+	metadataBytes, err := modules.SkyfileMetadataBytes(metadata)
+	if err != nil {
+		return SkyfileFixture{}, err
+	}
+	sl, baseSector, fetchSize, err := modules.BuildSmallSkyfileBaseSector(metadataBytes, content)
+	if err != nil {
+		return SkyfileFixture{}, errors.AddContext(err, "unable to build base sector")
+	}
+	skylink, err := modules.NewSkylinkV1(crypto.MerkleRoot(baseSector), 0, fetchSize)
+	if err != nil {
+		return SkyfileFixture{}, errors.AddContext(err, "unable to build skylink")
+	}
+	return SkyfileFixture{
+		Skylink:    skylink,
+		Layout:     sl,
+		BaseSector: baseSector,
+		Metadata:   metadata,
+		Content:    append([]byte{}, content...),
+	}, nil
+}
+
+// SkylinkFixture returns the download representation of the skyfile as it is
+// loaded by LoadSkylinkFixture.
+func (sf SkyfileFixture) SkylinkFixture() SkylinkFixture {
+	return SkylinkFixture{
+		Metadata: sf.Metadata,
+		Content:  sf.Content,
+	}
+}
+
+// EncodeSkylinkFixtures encodes the given skyfiles in the format expected by
+// LoadSkylinkFixture. The output can be written to the fixtures path of a test
+// to serve the skyfiles through the fixtures.
+func EncodeSkylinkFixtures(skyfiles ...SkyfileFixture) ([]byte, error) {
+	skylinkFixtures := make(map[string]SkylinkFixture, len(skyfiles))
+	for _, sf := range skyfiles {
+		skylinkFixtures[sf.Skylink.String()] = sf.SkylinkFixture()
+	}
+	return json.MarshalIndent(skylinkFixtures, "", "  ")
+}
@@ -0,0 +1,121 @@
+package fixtures
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"gitlab.com/NebulousLabs/Sia/crypto"
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/errors"
+	"gitlab.com/NebulousLabs/fastrand"
+)
+
+// TestBuildSkyfileFixture verifies that the base sector built by
+// BuildSkyfileFixture parses back into the skyfile's layout, metadata and
+// content and that the skylink points at it.
+func TestBuildSkyfileFixture(t *testing.T) {
+	t.Parallel()
+
+	metadata := modules.SkyfileMetadata{
+		Filename: "file.txt",
+		Length:   100,
+		Mode:     modules.DefaultFilePerm,
+	}
+	content := fastrand.Bytes(100)
+	sf, err := BuildSkyfileFixture(metadata, content)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The base sector should parse back into the fixture.
+	layout, fanout, parsedMetadata, payload, err := modules.ParseSkyfileMetadata(sf.BaseSector)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if layout != sf.Layout {
+		t.Fatalf("layout mismatch: %v != %v", layout, sf.Layout)
+	}
+	if layout.Filesize != uint64(len(content)) || layout.CipherType != crypto.TypePlain {
+		t.Fatal("unexpected layout", layout)
+	}
+	if len(fanout) != 0 {
+		t.Fatal("small skyfile shouldn't have a fanout")
+	}
+	if !reflect.DeepEqual(parsedMetadata, metadata) {
+		t.Fatalf("metadata mismatch: %v != %v", parsedMetadata, metadata)
+	}
+	if !bytes.Equal(payload, content) {
+		t.Fatal("content mismatch")
+	}
+
+	// The skylink should point at the base sector and match the skylink
+	// computed by the modules package.
+	if sf.Skylink.MerkleRoot() != crypto.MerkleRoot(sf.BaseSector) {
+		t.Fatal("skylink doesn't point at the base sector")
+	}
+	skylink, err := modules.ComputeSkylink(metadata, content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sf.Skylink != skylink {
+		t.Fatalf("skylink mismatch: %v != %v", sf.Skylink, skylink)
+	}
+
+	// Building the fixture again should produce the same result.
+	sf2, err := BuildSkyfileFixture(metadata, content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(sf, sf2) {
+		t.Fatal("building the same fixture twice should be deterministic")
+	}
+
+	// Invalid metadata and content that doesn't fit in the base sector are
+	// rejected.
+	_, err = BuildSkyfileFixture(modules.SkyfileMetadata{Filename: "/invalid"}, content)
+	if err == nil {
+		t.Fatal("expected invalid metadata to be rejected")
+	}
+	_, err = BuildSkyfileFixture(metadata, fastrand.Bytes(int(modules.SectorSize)))
+	if !errors.Contains(err, modules.ErrSkyfileTooLargeForBaseSector) {
+		t.Fatalf("expected %v but got %v", modules.ErrSkyfileTooLargeForBaseSector, err)
+	}
+}
+
+// TestEncodeSkylinkFixtures verifies that the encoded fixtures decode into the
+// format read by LoadSkylinkFixture.
+func TestEncodeSkylinkFixtures(t *testing.T) {
+	t.Parallel()
+
+	sf1, err := BuildSkyfileFixture(modules.SkyfileMetadata{Filename: "file1", Length: 10}, fastrand.Bytes(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sf2, err := BuildSkyfileFixture(modules.SkyfileMetadata{Filename: "file2", Length: 20}, fastrand.Bytes(20))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := EncodeSkylinkFixtures(sf1, sf2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var skylinkFixtures map[string]SkylinkFixture
+	err = json.Unmarshal(b, &skylinkFixtures)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(skylinkFixtures) != 2 {
+		t.Fatalf("expected 2 fixtures but got %v", len(skylinkFixtures))
+	}
+	for _, sf := range []SkyfileFixture{sf1, sf2} {
+		fixture, exists := skylinkFixtures[sf.Skylink.String()]
+		if !exists {
+			t.Fatal("fixture missing for", sf.Skylink)
+		}
+		if !reflect.DeepEqual(fixture, sf.SkylinkFixture()) {
+			t.Fatalf("fixture mismatch: %v != %v", fixture, sf.SkylinkFixture())
+		}
+	}
+}
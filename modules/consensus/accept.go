@@ -1,7 +1,6 @@
 package consensus
 
 import (
-	"bytes"
 	"encoding/binary"
 	"fmt"
 	"os"
@@ -70,8 +69,7 @@ func (cs *ConsensusSet) validateHeaderAndBlock(tx dbTx, b types.Block, id types.
 
 // checkHeaderTarget returns true if the header's ID meets the given target.
 func checkHeaderTarget(h types.BlockHeader, target types.Target) bool {
-	blockHash := h.ID()
-	return bytes.Compare(target[:], blockHash[:]) >= 0
+	return target.Satisfies(h.ID())
 }
 
 // validateHeader does some early, low computation verification on the header
@@ -1,7 +1,6 @@
 package consensus
 
 import (
-	"bytes"
 	"encoding/binary"
 	"errors"
 
@@ -53,20 +52,12 @@ func NewBlockValidator() stdBlockValidator {
 // checkMinerPayouts compares a block's miner payouts to the block's subsidy and
 // returns true if they are equal.
 func checkMinerPayouts(b types.Block, height types.BlockHeight) bool {
-	// Add up the payouts and check that all values are legal.
-	var payoutSum types.Currency
-	for _, payout := range b.MinerPayouts {
-		if payout.Value.IsZero() {
-			return false
-		}
-		payoutSum = payoutSum.Add(payout.Value)
-	}
-	return b.CalculateSubsidy(height).Equals(payoutSum)
+	return b.ValidMinerPayouts(height)
 }
 
 // checkTarget returns true if the block's ID meets the given target.
 func checkTarget(b types.Block, id types.BlockID, target types.Target) bool {
-	return bytes.Compare(target[:], id[:]) >= 0
+	return target.Satisfies(id)
 }
 
 // ValidateBlock validates a block against a minimum timestamp, a block target,
@@ -21,15 +21,9 @@ var (
 // delayed siacoin output. If no subsidy is due on the given block, no output is
 // added.
 func applyFoundationSubsidy(tx *bolt.Tx, pb *processedBlock) {
-	// NOTE: this conditional is split up to better visualize test coverage
-	if pb.Height < types.FoundationHardforkHeight {
+	value := types.FoundationSubsidy(pb.Height)
+	if value.IsZero() {
 		return
-	} else if (pb.Height-types.FoundationHardforkHeight)%types.FoundationSubsidyFrequency != 0 {
-		return
-	}
-	value := types.FoundationSubsidyPerBlock.Mul64(uint64(types.FoundationSubsidyFrequency))
-	if pb.Height == types.FoundationHardforkHeight {
-		value = types.InitialFoundationSubsidy
 	}
 	// The subsidy is always sent to the primary address.
 	addr, _ := getFoundationUnlockHashes(tx)
@@ -272,6 +272,25 @@ type (
 		NetAddress           NetAddress        `json:"netaddress"`
 		WindowSize           types.BlockHeight `json:"windowsize"`
 
+		// MaxQueuedContractPayments is the maximum number of PayByContract
+		// payments that can be waiting on the lock of a single storage
+		// obligation. Payments beyond that limit fail with ErrContractBusy. A
+		// value of 0 means that the number of queued payments is unbounded.
+		MaxQueuedContractPayments uint64 `json:"maxqueuedcontractpayments"`
+
+		// PayByContractExpiryThreshold is the minimum number of blocks that
+		// need to remain before the proof window of a contract starts for the
+		// host to accept payments from that contract. Payments from contracts
+		// that are closer to expiring fail with ErrContractNearExpiry. A
+		// value of 0 disables the check.
+		PayByContractExpiryThreshold types.BlockHeight `json:"paybycontractexpirythreshold"`
+
+		// MaxPayByContractCollateral is the maximum amount of collateral a
+		// single PayByContract payment is allowed to move from the host to
+		// the void. Payments that move more collateral fail with
+		// ErrExcessiveCollateral.
+		MaxPayByContractCollateral types.Currency `json:"maxpaybycontractcollateral"`
+
 		Collateral       types.Currency `json:"collateral"`
 		CollateralBudget types.Currency `json:"collateralbudget"`
 		MaxCollateral    types.Currency `json:"maxcollateral"`
@@ -287,6 +306,29 @@ type (
 		MaxEphemeralAccountBalance types.Currency `json:"maxephemeralaccountbalance"`
 		MaxEphemeralAccountRisk    types.Currency `json:"maxephemeralaccountrisk"`
 
+		// MaxEphemeralAccountSpending is the maximum amount of money that can
+		// be withdrawn from a single ephemeral account within one
+		// EphemeralAccountSpendingWindow. Withdrawals beyond that limit fail
+		// with ErrAccountSpendingLimitExceeded. A value of 0 means that the
+		// spending of an account is unlimited.
+		MaxEphemeralAccountSpending    types.Currency `json:"maxephemeralaccountspending"`
+		EphemeralAccountSpendingWindow time.Duration  `json:"ephemeralaccountspendingwindow"`
+
+		// ProgramDataTimeout is the maximum amount of time an MDM program
+		// waits for the next packet of its program data before failing. A
+		// value of 0 means that the default timeout is used.
+		ProgramDataTimeout time.Duration `json:"programdatatimeout"`
+
+		// MaxGainedSectorsMemory is the maximum amount of data an MDM program
+		// keeps in memory for the sectors it appends before flushing them to
+		// disk. A value of 0 means that the default ceiling is used.
+		MaxGainedSectorsMemory uint64 `json:"maxgainedsectorsmemory"`
+
+		// VerifySectorReads indicates whether MDM programs recompute the
+		// merkle root of every sector they read from disk and fail if it
+		// doesn't match the requested root.
+		VerifySectorReads bool `json:"verifysectorreads"`
+
 		CustomRegistryPath string `json:"customregistrypath"`
 		RegistrySize       uint64 `json:"registrysize"`
 	}
@@ -301,6 +343,34 @@ type (
 		ReviseCalls       uint64 `json:"revisecalls"`
 		SettingsCalls     uint64 `json:"settingscalls"`
 		UnrecognizedCalls uint64 `json:"unrecognizedcalls"`
+
+		// NonIncreasingRevisions is the number of payment revisions that were
+		// rejected because their revision number didn't increase.
+		NonIncreasingRevisions uint64 `json:"nonincreasingrevisions"`
+
+		// SlowMDMPrograms is the number of MDM programs that took a lot
+		// longer to execute than estimated. It is only counted if the
+		// SIA_MDM_TIMING environment variable is set.
+		SlowMDMPrograms uint64 `json:"slowmdmprograms"`
+
+		// MDMCacheReadBytes and MDMDiskReadBytes are the number of bytes MDM
+		// programs read from sectors they appended themselves and from the
+		// host's storage since the host was started.
+		MDMCacheReadBytes uint64 `json:"mdmcachereadbytes"`
+		MDMDiskReadBytes  uint64 `json:"mdmdiskreadbytes"`
+	}
+
+	// HostPaymentStats contains statistics about the payments a host received
+	// through a single contract or ephemeral account since it was started.
+	HostPaymentStats struct {
+		// Amount is the total amount that was paid and Collateral the total
+		// collateral that was moved by the payments. Payments by ephemeral
+		// account never move collateral.
+		Amount     types.Currency `json:"amount"`
+		Collateral types.Currency `json:"collateral"`
+
+		NumPayments uint64    `json:"numpayments"`
+		LastPayment time.Time `json:"lastpayment"`
 	}
 
 	// StorageObligation contains information about a storage obligation that
@@ -316,7 +386,10 @@ type (
 		PotentialStorageRevenue  types.Currency       `json:"potentialstoragerevenue"`
 		PotentialUploadRevenue   types.Currency       `json:"potentialuploadrevenue"`
 		RiskedCollateral         types.Currency       `json:"riskedcollateral"`
+		CollateralExposure       types.Currency       `json:"collateralexposure"`
 		SectorRootsCount         uint64               `json:"sectorrootscount"`
+		MDMCacheReadBytes        uint64               `json:"mdmcachereadbytes"`
+		MDMDiskReadBytes         uint64               `json:"mdmdiskreadbytes"`
 		TransactionFeesAdded     types.Currency       `json:"transactionfeesadded"`
 		TransactionID            types.TransactionID  `json:"transactionid"`
 
@@ -423,6 +496,11 @@ type (
 		// have been made to the host.
 		NetworkMetrics() HostNetworkMetrics
 
+		// PaymentStats returns the payment statistics of every contract and
+		// ephemeral account that paid the host since it was started. The
+		// statistics of closed contracts and expired accounts are dropped.
+		PaymentStats() (contracts map[types.FileContractID]HostPaymentStats, accounts map[AccountID]HostPaymentStats)
+
 		PaymentProcessor
 
 		// PriceTable returns the host's current price table.
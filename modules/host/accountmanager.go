@@ -27,6 +27,11 @@ var (
 	// completed because the account balance was insufficient.
 	ErrBalanceInsufficient = errors.New("ephemeral account balance was insufficient")
 
+	// ErrAccountSpendingLimitExceeded occurs when a withdrawal would push the
+	// amount withdrawn from an account within the current spending window over
+	// the maximum allowed ephemeral account spending.
+	ErrAccountSpendingLimitExceeded = errors.New("ephemeral account spending limit exceeded")
+
 	// ErrBalanceMaxExceeded occurs when a deposit would push the account's
 	// balance over the maximum allowed ephemeral account balance.
 	ErrBalanceMaxExceeded = errors.New("ephemeral account maximam balance exceeded")
@@ -158,6 +163,18 @@ type (
 		// inactive for too long. The host can configure this expiry using the
 		// ephemeralaccountexpiry setting.
 		lastTxnTime int64
+
+		// spendingWindowStart and spendingWindowTotal keep track of the amount
+		// of money withdrawn from the account since the start of the current
+		// spending window. They are not persisted, which means that a restart
+		// of the host starts a new window.
+		spendingWindowStart time.Time
+		spendingWindowTotal types.Currency
+
+		// spendingBlocked is the amount of the account's blocked withdrawals.
+		// It counts towards the spending limit until the withdrawals are
+		// either committed or fail.
+		spendingBlocked types.Currency
 	}
 
 	// accountBitfield is a bitfield to keep track of account indexes. When an
@@ -386,6 +403,8 @@ func (am *accountManager) callWithdraw(msg *modules.WithdrawalMessage, sig crypt
 	// Gather some variables
 	his := am.h.managedInternalSettings()
 	maxRisk := his.MaxEphemeralAccountRisk
+	maxSpending := his.MaxEphemeralAccountSpending
+	spendingWindow := his.EphemeralAccountSpendingWindow
 
 	// Validate the message's expiry and signature first
 	fingerprint := crypto.HashAll(*msg)
@@ -399,13 +418,58 @@ func (am *accountManager) callWithdraw(msg *modules.WithdrawalMessage, sig crypt
 	commitResultChan := make(chan error, 1)
 
 	// Initiate the withdraw process.
-	err := am.managedWithdraw(msg, fingerprint, priority, maxRisk, bh, commitResultChan)
+	err := am.managedWithdraw(msg, fingerprint, priority, maxRisk, maxSpending, spendingWindow, bh, commitResultChan)
 	if err != nil {
 		return errors.AddContext(err, "Withdraw failed")
 	}
 
-	// Wait for the withdrawal to be committed.
-	return errors.AddContext(am.staticWaitForWithdrawalResult(commitResultChan), "Withdraw failed")
+	// Wait for the withdrawal to be committed. If it times out, make sure it
+	// is not committed after the caller was told it failed.
+	err = am.staticWaitForWithdrawalResult(commitResultChan)
+	if errors.Contains(err, ErrBalanceInsufficient) {
+		err = am.managedCancelBlockedWithdrawal(msg.Account, commitResultChan)
+	}
+	return errors.AddContext(err, "Withdraw failed")
+}
+
+// managedCancelBlockedWithdrawal removes the blocked withdrawal with the given
+// commit result channel from the queues and releases its amount from the
+// account's spending limit. If the withdrawal was processed in the meantime,
+// the result of processing it is returned instead of ErrBalanceInsufficient.
+func (am *accountManager) managedCancelBlockedWithdrawal(id modules.AccountID, commitResultChan chan error) error {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+
+	// Check whether the withdrawal was processed in the meantime.
+	select {
+	case err := <-commitResultChan:
+		return err
+	default:
+	}
+
+	// Remove the withdrawal from the queue it is blocked in.
+	var cancelled *blockedWithdrawal
+	acc, exists := am.accounts[id]
+	if exists {
+		for i, bw := range acc.blockedWithdrawals {
+			if bw.commitResult == commitResultChan {
+				cancelled = bw
+				acc.blockedWithdrawals = append(acc.blockedWithdrawals[:i], acc.blockedWithdrawals[i+1:]...)
+				break
+			}
+		}
+	}
+	for i, bw := range am.blockedWithdrawals {
+		if cancelled == nil && bw.commitResult == commitResultChan {
+			cancelled = bw
+			am.blockedWithdrawals = append(am.blockedWithdrawals[:i], am.blockedWithdrawals[i+1:]...)
+			break
+		}
+	}
+	if exists && cancelled != nil {
+		acc.spendingBlocked = acc.spendingBlocked.Sub(cancelled.withdrawal.Amount)
+	}
+	return ErrBalanceInsufficient
 }
 
 // callConsensusChanged is called by the host whenever it processed a change to
@@ -491,7 +555,7 @@ func (am *accountManager) deposit(id modules.AccountID, amount, maxRisk, maxBala
 
 // managedWithdraw performs a couple of steps in preparation of the
 // withdrawal. If everything checks out it will commit the withdrawal.
-func (am *accountManager) managedWithdraw(msg *modules.WithdrawalMessage, fp crypto.Hash, priority int64, maxRisk types.Currency, blockHeight types.BlockHeight, commitResultChan chan error) (err error) {
+func (am *accountManager) managedWithdraw(msg *modules.WithdrawalMessage, fp crypto.Hash, priority int64, maxRisk, maxSpending types.Currency, spendingWindow time.Duration, blockHeight types.BlockHeight, commitResultChan chan error) (err error) {
 	amount, id, expiry := msg.Amount, msg.Account, msg.Expiry
 
 	am.mu.Lock()
@@ -522,8 +586,17 @@ func (am *accountManager) managedWithdraw(msg *modules.WithdrawalMessage, fp cry
 	if err != nil {
 		return errors.AddContext(err, "failed to open account for withdrawal")
 	}
+
+	// Reject the withdrawal if it exceeds the account's spending limit. The
+	// amount counts towards the limit once the withdrawal is committed. A
+	// blocked withdrawal counts towards the limit while it's pending.
+	if acc.withdrawalExceedsSpendingLimit(amount, maxSpending, spendingWindow, time.Now()) {
+		return ErrAccountSpendingLimitExceeded
+	}
+
 	// If the account balance is insufficient, block the withdrawal.
 	if acc.withdrawalExceedsBalance(amount) {
+		acc.spendingBlocked = acc.spendingBlocked.Add(amount)
 		acc.blockedWithdrawals.Push(blockedWithdrawal{
 			withdrawal:   msg,
 			priority:     priority,
@@ -537,6 +610,7 @@ func (am *accountManager) managedWithdraw(msg *modules.WithdrawalMessage, fp cry
 		if am.h.dependencies.Disrupt("errMaxRiskReached") {
 			return errMaxRiskReached // only for testing purposes
 		}
+		acc.spendingBlocked = acc.spendingBlocked.Add(amount)
 		am.blockedWithdrawals = append(am.blockedWithdrawals, &blockedWithdrawal{
 			withdrawal:   msg,
 			priority:     priority,
@@ -676,6 +750,7 @@ func (am *accountManager) commitDeposit(a *account, amount types.Currency, block
 		bw := a.blockedWithdrawals.Pop().(*blockedWithdrawal)
 		err := bw.withdrawal.ValidateExpiry(blockHeight, blockHeight+bucketBlockRange)
 		if err != nil {
+			a.spendingBlocked = a.spendingBlocked.Sub(bw.withdrawal.Amount)
 			select {
 			case bw.commitResult <- err:
 			default:
@@ -690,6 +765,7 @@ func (am *accountManager) commitDeposit(a *account, amount types.Currency, block
 		}
 
 		// Commit the withdrawal
+		a.spendingBlocked = a.spendingBlocked.Sub(bw.withdrawal.Amount)
 		am.commitWithdrawal(a, bw.withdrawal.Amount, blockHeight, bw.commitResult)
 	}
 	am.schedulePersist(a, pr)
@@ -700,6 +776,7 @@ func (am *accountManager) commitDeposit(a *account, amount types.Currency, block
 func (am *accountManager) commitWithdrawal(a *account, amount types.Currency, blockHeight types.BlockHeight, commitResultChan chan error) {
 	// Update the account details
 	a.balance = a.balance.Sub(amount)
+	a.spendingWindowTotal = a.spendingWindowTotal.Add(amount)
 	a.lastTxnTime = time.Now().Unix()
 	close(commitResultChan)
 
@@ -810,6 +887,7 @@ func (am *accountManager) unblockWithdrawals(allowance types.Currency, bh types.
 		// have been changed since the withdrawal was blocked, potentially
 		// pushing it over its expiry.
 		if err := bw.withdrawal.ValidateExpiry(bh, bh+bucketBlockRange); err != nil {
+			acc.spendingBlocked = acc.spendingBlocked.Sub(amount)
 			select {
 			case bw.commitResult <- err:
 			default:
@@ -829,6 +907,7 @@ func (am *accountManager) unblockWithdrawals(allowance types.Currency, bh types.
 		}
 
 		// Commit the withdrawal
+		acc.spendingBlocked = acc.spendingBlocked.Sub(amount)
 		am.commitWithdrawal(acc, bw.withdrawal.Amount, bh, bw.commitResult)
 		allowance = allowance.Sub(amount)
 	}
@@ -939,6 +1018,7 @@ func (am *accountManager) managedExpireAccounts(threshold int64) []uint32 {
 			}
 			delete(am.accounts, id)
 			deleted = append(deleted, acc.index)
+			am.h.staticPaymentStats.callRemoveAccount(id)
 		}
 	}
 	return deleted
@@ -1080,6 +1160,21 @@ func (a *account) withdrawalExceedsBalance(withdrawal types.Currency) bool {
 	return withdrawal.Cmp(a.balance) > 0
 }
 
+// withdrawalExceedsSpendingLimit returns true if the withdrawal would push the
+// amount withdrawn from the account within the current spending window,
+// together with the amount of its blocked withdrawals, over the given limit.
+// If the current window has passed, a new one is started.
+func (a *account) withdrawalExceedsSpendingLimit(withdrawal, limit types.Currency, window time.Duration, now time.Time) bool {
+	if limit.IsZero() {
+		return false
+	}
+	if now.Sub(a.spendingWindowStart) >= window {
+		a.spendingWindowStart = now
+		a.spendingWindowTotal = types.ZeroCurrency
+	}
+	return a.spendingWindowTotal.Add(a.spendingBlocked).Add(withdrawal).Cmp(limit) > 0
+}
+
 // sendResult will send the given result to the result channels that are waiting
 func (a *account) sendResult(result error, waiting int) {
 	for i := 0; i < waiting; i++ {
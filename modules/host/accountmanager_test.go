@@ -1162,6 +1162,103 @@ func TestAccountWithdrawalsInactive(t *testing.T) {
 	}
 }
 
+// TestAccountSpendingLimit verifies the account manager rejects withdrawals
+// that exceed an account's spending limit and resets the limit after the
+// spending window has passed.
+func TestAccountSpendingLimit(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	// Prepare a host
+	ht, err := blankHostTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := ht.Close()
+		if err != nil {
+			t.Error(err)
+		}
+	}()
+	am := ht.host.staticAccountManager
+
+	// A spending limit without a window is rejected.
+	limit := types.NewCurrency64(10)
+	his := ht.host.InternalSettings()
+	his.MaxEphemeralAccountSpending = limit
+	his.EphemeralAccountSpendingWindow = 0
+	err = ht.host.SetInternalSettings(his)
+	if err == nil {
+		t.Fatal("expected settings to be rejected")
+	}
+
+	// Set a spending limit.
+	window := time.Second
+	his.EphemeralAccountSpendingWindow = window
+	err = ht.host.SetInternalSettings(his)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Prepare an account and fund it with more than the limit.
+	sk, accountID := prepareAccount()
+	err = callDeposit(am, accountID, limit.Mul64(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Withdraw up to the limit.
+	withdraw := func(amount types.Currency) error {
+		msg, sig := prepareWithdrawal(accountID, amount, am.h.BlockHeight(), sk)
+		return callWithdraw(am, msg, sig, am.h.BlockHeight())
+	}
+	start := time.Now()
+	half := limit.Div64(2)
+	for i := 0; i < 2; i++ {
+		err = withdraw(half)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Withdrawing past the limit should fail without touching the balance.
+	err = withdraw(types.NewCurrency64(1))
+	if !errors.Contains(err, ErrAccountSpendingLimitExceeded) {
+		t.Fatal("expected spending limit to be exceeded", err)
+	}
+	if time.Since(start) >= window {
+		t.Fatal("test took too long to verify the limit within the window")
+	}
+	balance := getAccountBalance(am, accountID)
+	if !balance.Equals(limit.Mul64(2)) {
+		t.Fatal("unexpected balance", balance)
+	}
+
+	// After the window has passed the limit applies again.
+	time.Sleep(window)
+	err = withdraw(limit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = withdraw(types.NewCurrency64(1))
+	if !errors.Contains(err, ErrAccountSpendingLimitExceeded) {
+		t.Fatal("expected spending limit to be exceeded", err)
+	}
+
+	// Removing the limit allows withdrawing the remaining balance.
+	his.MaxEphemeralAccountSpending = types.ZeroCurrency
+	err = ht.host.SetInternalSettings(his)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = withdraw(limit)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
 // managedCurrentRisk will return the current risk
 func managedCurrentRisk(am *accountManager) types.Currency {
 	am.mu.Lock()
@@ -1259,3 +1356,68 @@ func randuint64() uint64 {
 	}
 	return uint64(binary.LittleEndian.Uint64(b[:]))
 }
+
+// TestAccountSpendingLimitBlockedWithdrawal verifies that a blocked withdrawal
+// that times out doesn't count towards the account's spending limit and isn't
+// committed once the account is funded.
+func TestAccountSpendingLimitBlockedWithdrawal(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	// Prepare a host
+	ht, err := blankHostTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := ht.Close()
+		if err != nil {
+			t.Error(err)
+		}
+	}()
+	am := ht.host.staticAccountManager
+
+	// Set a spending limit with a window that doesn't pass during the test.
+	limit := types.NewCurrency64(10)
+	his := ht.host.InternalSettings()
+	his.MaxEphemeralAccountSpending = limit
+	his.EphemeralAccountSpendingWindow = time.Hour
+	err = ht.host.SetInternalSettings(his)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Withdraw the limit from an empty account. The withdrawal gets blocked
+	// and times out.
+	sk, accountID := prepareAccount()
+	withdraw := func(amount types.Currency) error {
+		msg, sig := prepareWithdrawal(accountID, amount, am.h.BlockHeight(), sk)
+		return callWithdraw(am, msg, sig, am.h.BlockHeight())
+	}
+	err = withdraw(limit)
+	if !errors.Contains(err, ErrBalanceInsufficient) {
+		t.Fatal("expected the withdrawal to time out", err)
+	}
+
+	// Fund the account. The timed out withdrawal shouldn't be committed.
+	err = callDeposit(am, accountID, limit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	balance := getAccountBalance(am, accountID)
+	if !balance.Equals(limit) {
+		t.Fatal("unexpected balance", balance)
+	}
+
+	// The whole limit should still be available.
+	err = withdraw(limit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = withdraw(types.NewCurrency64(1))
+	if !errors.Contains(err, ErrAccountSpendingLimitExceeded) {
+		t.Fatal("expected spending limit to be exceeded", err)
+	}
+}
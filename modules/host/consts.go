@@ -34,6 +34,11 @@ const (
 	// maxObligationLockTimeout is the maximum amount of time the host will wait
 	// to lock a storage obligation.
 	maxObligationLockTimeout = 10 * time.Minute
+
+	// slowMDMProgramFactor is the factor by which the measured execution time
+	// of an MDM program needs to exceed its estimated time for the program to
+	// be considered slow.
+	slowMDMProgramFactor = 10
 )
 
 var (
@@ -53,6 +58,24 @@ var (
 		Testing:  time.Second * 10,
 	}).(time.Duration)
 
+	// slowMDMProgramMinDuration is the minimum measured execution time of an
+	// MDM program for it to be considered slow. This prevents logging programs
+	// with a tiny estimated time that are slowed down by scheduling noise.
+	slowMDMProgramMinDuration = build.Select(build.Var{
+		Standard: 100 * time.Millisecond,
+		Dev:      100 * time.Millisecond,
+		Testing:  10 * time.Millisecond,
+	}).(time.Duration)
+
+	// defaultMaxGainedSectorsMemory is the default maximum amount of data an
+	// MDM program keeps in memory for the sectors it appends before flushing
+	// them to disk.
+	defaultMaxGainedSectorsMemory = build.Select(build.Var{
+		Standard: uint64(1 << 30), // 1 GiB
+		Dev:      uint64(1 << 28), // 256 MiB
+		Testing:  uint64(1 << 24), // 16 MiB
+	}).(uint64)
+
 	// connectabilityCheckTimeout defines how long a connectability check's dial
 	// will be allowed to block before it times out.
 	connectabilityCheckTimeout = build.Select(build.Var{
@@ -74,6 +97,22 @@ var (
 	// prevent the host from having too much money at risk.
 	defaultMaxEphemeralAccountRisk = types.SiacoinPrecision.Mul64(5)
 
+	// defaultEphemeralAccountSpendingWindow is the default duration of the
+	// window in which the spending of an ephemeral account is limited by the
+	// maxephemeralaccountspending setting.
+	defaultEphemeralAccountSpendingWindow = 24 * time.Hour
+
+	// defaultMaxQueuedContractPayments is the default number of PayByContract
+	// payments that can be waiting on the lock of a single storage obligation
+	// before the host starts rejecting new payments for that obligation.
+	defaultMaxQueuedContractPayments = uint64(10)
+
+	// defaultMaxPayByContractCollateral is the default maximum amount of
+	// collateral a single PayByContract payment is allowed to move. Paying by
+	// contract only transfers money from the renter to the host, so by
+	// default it should never require the host to put up any collateral.
+	defaultMaxPayByContractCollateral = types.ZeroCurrency
+
 	// logAllLimit is the number of errors of each type that the host will log
 	// before switching to probabilistic logging. If there are not many errors,
 	// it is reasonable that all errors get logged. If there are lots of
@@ -160,6 +199,11 @@ var (
 	// bucketStorageObligations contains a set of serialized
 	// 'storageObligations' sorted by their file contract id.
 	bucketStorageObligations = []byte("BucketStorageObligations")
+
+	// bucketSectorHeights maps the roots of the sectors stored by the host to
+	// the block height at which the host started storing them. The height is
+	// used to report the storage age of a sector.
+	bucketSectorHeights = []byte("BucketSectorHeights")
 )
 
 // init runs a series of sanity checks to verify that the constants have sane
@@ -137,6 +137,14 @@ type Host struct {
 	atomicSettingsCalls     uint64
 	atomicUnrecognizedCalls uint64
 
+	// atomicNonIncreasingRevisions counts the payment revisions that were
+	// rejected for having a revision number that didn't increase.
+	atomicNonIncreasingRevisions uint64
+
+	// atomicSlowMDMPrograms counts the MDM programs that took a lot longer to
+	// execute than estimated. Only counted if timing is enabled.
+	atomicSlowMDMPrograms uint64
+
 	// Error management. There are a few different types of errors returned by
 	// the host. These errors intentionally not persistent, so that the logging
 	// limits of each error type will be reset each time the host is reset.
@@ -160,6 +168,7 @@ type Host struct {
 	// Subsystems
 	staticAccountManager        *accountManager
 	staticMDM                   *mdm.MDM
+	staticSectorFlusher         *sectorFlusher
 	staticRegistry              *registry.Registry
 	staticRegistrySubscriptions *registrySubscriptions
 
@@ -194,6 +203,10 @@ type Host struct {
 	// of such conditions are congestion, load, liquidity, etc.
 	staticPriceTables *hostPrices
 
+	// staticPaymentStats keeps track of the payments made by each contract
+	// and ephemeral account. It is covered by its own mutex.
+	staticPaymentStats *paymentStats
+
 	// Fields related to RHP3 bandwidhth.
 	atomicStreamUpload   uint64
 	atomicStreamDownload uint64
@@ -282,6 +295,10 @@ func (hp *hostPrices) managedPruneExpired() {
 type lockedObligation struct {
 	mu siasync.TryMutex
 	n  uint
+
+	// queuedPayments is the number of payments that are currently waiting to
+	// acquire the lock.
+	queuedPayments uint64
 }
 
 // checkUnlockHash will check that the host has an unlock hash. If the host
@@ -455,12 +472,16 @@ func newHost(dependencies modules.Dependencies, smDeps modules.Dependencies, cs
 				heap: make([]*hostRPCPriceTable, 0),
 			},
 		},
+		staticPaymentStats:          newPaymentStats(),
 		staticRegistrySubscriptions: newRegistrySubscriptions(),
 		persistDir:                  persistDir,
 	}
 
-	// Create MDM.
-	h.staticMDM = mdm.New(h)
+	// Create MDM. Sectors appended by programs that exceed the memory ceiling
+	// are flushed to disk. The ceiling is configured once the settings are
+	// loaded.
+	h.staticSectorFlusher = newSectorFlusher(filepath.Join(persistDir, flushedSectorsDir))
+	h.staticMDM = mdm.NewCustomMDM(h, defaultMaxGainedSectorsMemory, h.staticSectorFlusher)
 
 	// Call stop in the event of a partial startup.
 	defer func() {
@@ -491,6 +512,30 @@ func newHost(dependencies modules.Dependencies, smDeps modules.Dependencies, cs
 		}
 	})
 
+	// Clear the sectors flushed by programs before the host was last shut
+	// down and remove the ones flushed from now on when it stops.
+	err = h.staticSectorFlusher.reset()
+	if err != nil {
+		h.log.Println("Could not reset the flushed sectors:", err)
+		return nil, err
+	}
+	h.tg.AfterStop(func() {
+		err := h.staticSectorFlusher.remove()
+		if err != nil {
+			h.log.Println("Could not remove the flushed sectors:", err)
+		}
+	})
+
+	// Log every instruction executed by the MDM if tracing is enabled.
+	if build.MDMTrace() {
+		h.staticMDM.SetInstructionTracer(h.logInstructionTrace)
+	}
+
+	// Measure the execution time of MDM programs if timing is enabled.
+	if build.MDMTiming() {
+		h.staticMDM.SetProgramTimer(h.checkProgramTiming)
+	}
+
 	// Add the storage manager to the host, and set up the stop call that will
 	// close the storage manager.
 	h.StorageManager, err = contractmanager.NewCustomContractManager(smDeps, filepath.Join(persistDir, "contractmanager"))
@@ -511,6 +556,9 @@ func newHost(dependencies modules.Dependencies, smDeps modules.Dependencies, cs
 	if err != nil {
 		return nil, err
 	}
+	h.mu.RLock()
+	h.configureMDM()
+	h.mu.RUnlock()
 	h.tg.AfterStop(func() {
 		err := h.saveSync()
 		if err != nil {
@@ -697,6 +745,11 @@ func (h *Host) SetInternalSettings(settings modules.HostInternalSettings) error
 		}
 	}
 
+	// A spending limit for ephemeral accounts needs a window to reset in.
+	if !settings.MaxEphemeralAccountSpending.IsZero() && settings.EphemeralAccountSpendingWindow <= 0 {
+		return errors.New("internal settings not updated, ephemeralaccountspendingwindow must be positive when maxephemeralaccountspending is set")
+	}
+
 	// Check if the net address for the host has changed. If it has, and it's
 	// not equal to the auto address, then the host is going to need to make
 	// another blockchain announcement.
@@ -730,6 +783,7 @@ func (h *Host) SetInternalSettings(settings modules.HostInternalSettings) error
 
 	h.settings = settings
 	h.revisionNumber++
+	h.configureMDM()
 
 	// The locked storage collateral was altered, we potentially want to
 	// unregister the insufficient collateral budget alert
@@ -742,6 +796,23 @@ func (h *Host) SetInternalSettings(settings modules.HostInternalSettings) error
 	return nil
 }
 
+// configureMDM applies the internal settings that affect the execution of MDM
+// programs to the host's MDM. It needs to be called while holding the lock.
+func (h *Host) configureMDM() {
+	timeout := h.settings.ProgramDataTimeout
+	if timeout <= 0 {
+		timeout = mdm.DefaultProgramDataTimeout
+	}
+	h.staticMDM.SetProgramDataTimeout(timeout)
+
+	maxGainedSectorsMemory := h.settings.MaxGainedSectorsMemory
+	if maxGainedSectorsMemory == 0 {
+		maxGainedSectorsMemory = defaultMaxGainedSectorsMemory
+	}
+	h.staticMDM.SetMaxGainedSectorsMemory(maxGainedSectorsMemory)
+	h.staticMDM.SetVerifySectorReads(h.settings.VerifySectorReads)
+}
+
 // InternalSettings returns the settings of a host.
 func (h *Host) InternalSettings() modules.HostInternalSettings {
 	err := h.tg.Add()
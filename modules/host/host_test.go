@@ -17,6 +17,7 @@ import (
 	"gitlab.com/NebulousLabs/Sia/modules"
 	"gitlab.com/NebulousLabs/Sia/modules/consensus"
 	"gitlab.com/NebulousLabs/Sia/modules/gateway"
+	"gitlab.com/NebulousLabs/Sia/modules/host/mdm"
 	"gitlab.com/NebulousLabs/Sia/modules/miner"
 	"gitlab.com/NebulousLabs/Sia/persist"
 	"gitlab.com/NebulousLabs/errors"
@@ -949,6 +950,102 @@ func (p *renterHostPair) BeginSubscription(budget types.Currency, subscriber typ
 	return p.managedBeginSubscription(budget, p.staticAccountID, subscriber)
 }
 
+// managedHasSector performs a RPCHasSector request to the host.
+func (p *renterHostPair) managedHasSector(payByFC bool, fundAmt types.Currency, root crypto.Hash) (_ modules.RPCHasSectorResponse, err error) {
+	stream := p.managedNewStream()
+	defer func() {
+		err = errors.Compose(err, stream.Close())
+	}()
+
+	// Fetch the price table.
+	pt, err := p.managedFetchPriceTable()
+	if err != nil {
+		return modules.RPCHasSectorResponse{}, err
+	}
+
+	// initiate the RPC
+	err = modules.RPCWrite(stream, modules.RPCHasSector)
+	if err != nil {
+		return modules.RPCHasSectorResponse{}, err
+	}
+
+	// Write the pricetable uid.
+	err = modules.RPCWrite(stream, pt.UID)
+	if err != nil {
+		return modules.RPCHasSectorResponse{}, err
+	}
+
+	// provide payment
+	if payByFC {
+		err = p.managedPayByContract(stream, fundAmt, p.staticAccountID)
+	} else {
+		err = p.managedPayByEphemeralAccount(stream, fundAmt)
+	}
+	if err != nil {
+		return modules.RPCHasSectorResponse{}, err
+	}
+
+	// send the request.
+	err = modules.RPCWrite(stream, modules.RPCHasSectorRequest{
+		Root: root,
+	})
+	if err != nil {
+		return modules.RPCHasSectorResponse{}, err
+	}
+
+	// read the response.
+	var hsr modules.RPCHasSectorResponse
+	err = modules.RPCRead(stream, &hsr)
+	if err != nil {
+		return modules.RPCHasSectorResponse{}, err
+	}
+	return hsr, nil
+}
+
+// managedEstimateProgram performs a RPCEstimateProgram request to the host.
+func (p *renterHostPair) managedEstimateProgram(payByFC bool, fundAmt types.Currency, epr modules.RPCEstimateProgramRequest) (_ modules.RPCEstimateProgramResponse, err error) {
+	stream := p.managedNewStream()
+	defer func() {
+		err = errors.Compose(err, stream.Close())
+	}()
+
+	// initiate the RPC
+	err = modules.RPCWrite(stream, modules.RPCEstimateProgram)
+	if err != nil {
+		return modules.RPCEstimateProgramResponse{}, err
+	}
+
+	// Write the pricetable uid.
+	err = modules.RPCWrite(stream, p.managedPriceTable().UID)
+	if err != nil {
+		return modules.RPCEstimateProgramResponse{}, err
+	}
+
+	// provide payment
+	if payByFC {
+		err = p.managedPayByContract(stream, fundAmt, p.staticAccountID)
+	} else {
+		err = p.managedPayByEphemeralAccount(stream, fundAmt)
+	}
+	if err != nil {
+		return modules.RPCEstimateProgramResponse{}, err
+	}
+
+	// send the request.
+	err = modules.RPCWrite(stream, epr)
+	if err != nil {
+		return modules.RPCEstimateProgramResponse{}, err
+	}
+
+	// read the response.
+	var resp modules.RPCEstimateProgramResponse
+	err = modules.RPCRead(stream, &resp)
+	if err != nil {
+		return modules.RPCEstimateProgramResponse{}, err
+	}
+	return resp, nil
+}
+
 // LatestRevision performs a RPCLatestRevision to get the latest revision for
 // the contract from the host.
 func (p *renterHostPair) LatestRevision(payByFC bool) (types.FileContractRevision, error) {
@@ -1423,6 +1520,181 @@ func TestSetAndGetInternalSettings(t *testing.T) {
 	ht.host = rebootHost
 }
 
+// TestProgramDataTimeoutSetting checks that the host applies the
+// programdatatimeout setting to its MDM on startup and when the settings are
+// updated.
+func TestProgramDataTimeoutSetting(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	ht, err := newHostTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := ht.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	// The MDM should use the default timeout.
+	settings := ht.host.InternalSettings()
+	if settings.ProgramDataTimeout != mdm.DefaultProgramDataTimeout {
+		t.Fatal("settings retrieval did not return default value", settings.ProgramDataTimeout)
+	}
+	if timeout := ht.host.staticMDM.ProgramDataTimeout(); timeout != mdm.DefaultProgramDataTimeout {
+		t.Fatal("unexpected timeout", timeout)
+	}
+
+	// Update the timeout.
+	settings.ProgramDataTimeout = 3 * time.Second
+	err = ht.host.SetInternalSettings(settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if timeout := ht.host.staticMDM.ProgramDataTimeout(); timeout != settings.ProgramDataTimeout {
+		t.Fatal("unexpected timeout", timeout)
+	}
+
+	// The timeout should be applied after a restart.
+	err = ht.host.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rebootHost, err := New(ht.cs, ht.gateway, ht.tpool, ht.wallet, ht.mux, "localhost:0", filepath.Join(ht.persistDir, modules.HostDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ht.host = rebootHost
+	if timeout := ht.host.staticMDM.ProgramDataTimeout(); timeout != settings.ProgramDataTimeout {
+		t.Fatal("unexpected timeout", timeout)
+	}
+
+	// A timeout of 0 falls back to the default.
+	settings.ProgramDataTimeout = 0
+	err = ht.host.SetInternalSettings(settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if timeout := ht.host.staticMDM.ProgramDataTimeout(); timeout != mdm.DefaultProgramDataTimeout {
+		t.Fatal("unexpected timeout", timeout)
+	}
+}
+
+// TestMaxGainedSectorsMemorySetting verifies that the memory ceiling for the
+// sectors appended by MDM programs is configured from the host's internal
+// settings.
+func TestMaxGainedSectorsMemorySetting(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	ht, err := newHostTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := ht.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	// The MDM should use the default ceiling.
+	settings := ht.host.InternalSettings()
+	if settings.MaxGainedSectorsMemory != defaultMaxGainedSectorsMemory {
+		t.Fatal("settings retrieval did not return default value", settings.MaxGainedSectorsMemory)
+	}
+	if max := ht.host.staticMDM.MaxGainedSectorsMemory(); max != defaultMaxGainedSectorsMemory {
+		t.Fatal("unexpected ceiling", max)
+	}
+
+	// Update the ceiling.
+	settings.MaxGainedSectorsMemory = modules.SectorSize
+	err = ht.host.SetInternalSettings(settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if max := ht.host.staticMDM.MaxGainedSectorsMemory(); max != settings.MaxGainedSectorsMemory {
+		t.Fatal("unexpected ceiling", max)
+	}
+
+	// The ceiling should be applied after a restart.
+	err = ht.host.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rebootHost, err := New(ht.cs, ht.gateway, ht.tpool, ht.wallet, ht.mux, "localhost:0", filepath.Join(ht.persistDir, modules.HostDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ht.host = rebootHost
+	if max := ht.host.staticMDM.MaxGainedSectorsMemory(); max != settings.MaxGainedSectorsMemory {
+		t.Fatal("unexpected ceiling", max)
+	}
+
+	// A ceiling of 0 falls back to the default.
+	settings.MaxGainedSectorsMemory = 0
+	err = ht.host.SetInternalSettings(settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if max := ht.host.staticMDM.MaxGainedSectorsMemory(); max != defaultMaxGainedSectorsMemory {
+		t.Fatal("unexpected ceiling", max)
+	}
+}
+
+// TestVerifySectorReadsSetting verifies that the MDM's verification of sector
+// reads is configured from the host's internal settings.
+func TestVerifySectorReadsSetting(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	ht, err := newHostTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := ht.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	// Verification should be disabled by default.
+	settings := ht.host.InternalSettings()
+	if settings.VerifySectorReads || ht.host.staticMDM.VerifySectorReads() {
+		t.Fatal("sector reads shouldn't be verified by default")
+	}
+
+	// Enable it.
+	settings.VerifySectorReads = true
+	err = ht.host.SetInternalSettings(settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ht.host.staticMDM.VerifySectorReads() {
+		t.Fatal("sector reads should be verified")
+	}
+
+	// The setting should be applied after a restart.
+	err = ht.host.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rebootHost, err := New(ht.cs, ht.gateway, ht.tpool, ht.wallet, ht.mux, "localhost:0", filepath.Join(ht.persistDir, modules.HostDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ht.host = rebootHost
+	if !ht.host.staticMDM.VerifySectorReads() {
+		t.Fatal("sector reads should be verified")
+	}
+}
+
 /*
 // TestSetAndGetSettings checks that the functions for interacting with the
 // hosts settings object are working as expected.
@@ -96,6 +96,13 @@ func (tb *testProgramBuilder) AddReadSectorInstruction(length, offset uint64, me
 	tb.staticValues.AddReadSectorInstruction(length)
 }
 
+// AddReadSectorsInstruction adds a readsectors instruction to the builder,
+// keeping track of running values.
+func (tb *testProgramBuilder) AddReadSectorsInstruction(reads []modules.MDMSectorRead, merkleProof bool) {
+	tb.staticPB.AddReadSectorsInstruction(reads, merkleProof)
+	tb.staticValues.AddReadSectorsInstruction(reads)
+}
+
 // AddRevisionInstruction adds a revision instruction to the builder, keeping
 // track of running values.
 func (tb *testProgramBuilder) AddRevisionInstruction() {
@@ -0,0 +1,83 @@
+package mdm
+
+import (
+	"bytes"
+
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/types"
+	"gitlab.com/NebulousLabs/errors"
+)
+
+// ProgramCostEstimate is the estimated cost of executing a program on the MDM.
+type ProgramCostEstimate struct {
+	// ExecutionCost is the total cost of executing the program, including the
+	// cost of initializing it and the memory cost of finalizing it.
+	ExecutionCost types.Currency
+	// AdditionalCollateral is the collateral the host puts up for the program.
+	AdditionalCollateral types.Currency
+	// FailureRefund is refunded if the program is not committed.
+	FailureRefund types.Currency
+	// Memory is the amount of memory used by the program.
+	Memory uint64
+	// Time is the estimated time it takes to execute the program's
+	// instructions.
+	Time uint64
+}
+
+// EstimateProgramCost estimates the cost of executing a program by summing up
+// the cost of its instructions according to the given price table. The
+// program is not executed and the contract is not modified. Refunds issued by
+// instructions during the execution can't be known in advance, which means
+// that the actual cost of the program might be lower than the estimate.
+func (mdm *MDM) EstimateProgramCost(pt *modules.RPCPriceTable, p modules.Program, data modules.ProgramData, duration types.BlockHeight) (_ ProgramCostEstimate, err error) {
+	if len(p) == 0 {
+		return ProgramCostEstimate{}, ErrEmptyProgram
+	}
+	program := &program{
+		staticProgramState: &programState{
+			staticRemainingDuration: duration,
+			host:                    mdm.host,
+			priceTable:              pt,
+		},
+		staticData: openProgramData(bytes.NewReader(data), uint64(len(data)), 0),
+		usedMemory: modules.MDMInitMemory(),
+	}
+	defer func() {
+		err = errors.Compose(err, program.staticData.Close())
+	}()
+	for _, i := range p {
+		instruction, err := decodeInstruction(program, i)
+		if err != nil {
+			return ProgramCostEstimate{}, err
+		}
+		program.instructions = append(program.instructions, instruction)
+	}
+
+	// Walk the instructions the same way executeInstructions does.
+	estimate := ProgramCostEstimate{
+		ExecutionCost: modules.MDMInitCost(pt, program.staticData.Len(), uint64(len(program.instructions))),
+	}
+	for _, i := range program.instructions {
+		estimate.AdditionalCollateral = estimate.AdditionalCollateral.Add(i.Collateral())
+		program.usedMemory += i.Memory()
+		instructionTime, err := i.Time()
+		if err != nil {
+			return ProgramCostEstimate{}, errors.AddContext(err, "failed to estimate instruction time")
+		}
+		instructionCost, failureRefund, err := i.Cost()
+		if err != nil {
+			return ProgramCostEstimate{}, errors.AddContext(err, "failed to estimate instruction cost")
+		}
+		memoryCost := modules.MDMMemoryCost(pt, program.usedMemory, instructionTime)
+		estimate.ExecutionCost = estimate.ExecutionCost.Add(memoryCost).Add(instructionCost)
+		estimate.FailureRefund = estimate.FailureRefund.Add(failureRefund)
+		estimate.Time += instructionTime
+	}
+
+	// Programs that are not readonly are finalized.
+	if !p.ReadOnly() {
+		estimate.ExecutionCost = estimate.ExecutionCost.Add(modules.MDMMemoryCost(pt, program.usedMemory, modules.MDMTimeCommit))
+	}
+	estimate.Memory = program.usedMemory
+	return estimate, nil
+}
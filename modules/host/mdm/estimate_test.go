@@ -0,0 +1,76 @@
+package mdm
+
+import (
+	"testing"
+
+	"gitlab.com/NebulousLabs/Sia/crypto"
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/types"
+	"gitlab.com/NebulousLabs/errors"
+	"gitlab.com/NebulousLabs/fastrand"
+)
+
+// TestEstimateProgramCost tests estimating the cost of a program with multiple
+// instructions.
+func TestEstimateProgramCost(t *testing.T) {
+	host := newTestHost()
+	mdm := New(host)
+	defer mdm.Stop()
+
+	// Build a program that appends a sector, reads it back, checks for it and
+	// drops it again.
+	pt := newTestPriceTable()
+	duration := types.BlockHeight(fastrand.Uint64n(100) + 1)
+	pb := modules.NewProgramBuilder(pt, duration)
+	sectorData := fastrand.Bytes(int(modules.SectorSize))
+	sectorRoot := crypto.MerkleRoot(sectorData)
+	err := pb.AddAppendInstruction(sectorData, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pb.AddReadSectorInstruction(modules.SectorSize, 0, sectorRoot, true)
+	pb.AddHasSectorInstruction(sectorRoot)
+	pb.AddDropSectorsInstruction(1, true)
+	program, data := pb.Program()
+
+	// The estimate should match the cost computed by the builder.
+	estimate, err := mdm.EstimateProgramCost(pt, program, data, duration)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cost, refund, collateral := pb.Cost(true)
+	if !estimate.ExecutionCost.Equals(cost) {
+		t.Fatalf("expected cost %v but got %v", cost, estimate.ExecutionCost)
+	}
+	if !estimate.FailureRefund.Equals(refund) {
+		t.Fatalf("expected refund %v but got %v", refund, estimate.FailureRefund)
+	}
+	if !estimate.AdditionalCollateral.Equals(collateral) {
+		t.Fatalf("expected collateral %v but got %v", collateral, estimate.AdditionalCollateral)
+	}
+	expectedMemory := modules.MDMInitMemory() + modules.MDMAppendMemory() + modules.MDMReadMemory() + modules.MDMHasSectorMemory() + modules.MDMDropSectorsMemory()
+	if estimate.Memory != expectedMemory {
+		t.Fatalf("expected memory %v but got %v", expectedMemory, estimate.Memory)
+	}
+	expectedTime := modules.MDMTimeAppend + modules.MDMTimeReadSector + modules.MDMTimeHasSector + modules.MDMDropSectorsTime(1)
+	if estimate.Time != uint64(expectedTime) {
+		t.Fatalf("expected time %v but got %v", expectedTime, estimate.Time)
+	}
+
+	// Estimating the program shouldn't have stored the sector.
+	if host.HasSector(sectorRoot) {
+		t.Fatal("sector shouldn't have been added")
+	}
+
+	// Program data that is too short results in an error.
+	_, err = mdm.EstimateProgramCost(pt, program, data[:len(data)-1], duration)
+	if err == nil {
+		t.Fatal("expected error for truncated program data")
+	}
+
+	// An empty program can't be estimated.
+	_, err = mdm.EstimateProgramCost(pt, modules.Program{}, nil, duration)
+	if !errors.Contains(err, ErrEmptyProgram) {
+		t.Fatal("expected ErrEmptyProgram", err)
+	}
+}
@@ -68,18 +68,19 @@ func (i *instructionDropSectors) Execute(prevOutput output) (output, types.Curre
 	newNumSectors := oldNumSectors - numSectorsDropped
 	ps := i.staticState
 
-	// Construct the proof, if necessary, before updating the roots.
+	// Drop the sectors and construct the proof, if necessary.
 	//
 	// If no sectors were dropped or all sectors were dropped, the proof should
 	// be empty. In the latter case, we also send the leaf hashes of the dropped
 	// leaves, which is enough to compute and verify the original merkle roof.
 	var proof []crypto.Hash
+	var newMerkleRoot crypto.Hash
 	if i.staticMerkleProof && numSectorsDropped > 0 && newNumSectors > 0 {
 		// Create proof with range covering the dropped sectors.
-		proof = crypto.MerkleSectorRangeProof(ps.sectors.merkleRoots, int(newNumSectors), int(oldNumSectors))
+		newMerkleRoot, proof, _, err = ps.sectors.dropSectorsWithProof(numSectorsDropped)
+	} else {
+		newMerkleRoot, err = ps.sectors.dropSectors(numSectorsDropped)
 	}
-
-	newMerkleRoot, err := ps.sectors.dropSectors(numSectorsDropped)
 	if err != nil {
 		return errOutput(err), types.ZeroCurrency
 	}
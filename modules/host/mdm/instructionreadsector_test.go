@@ -1,11 +1,13 @@
 package mdm
 
 import (
+	"bytes"
 	"testing"
 
 	"gitlab.com/NebulousLabs/Sia/crypto"
 	"gitlab.com/NebulousLabs/Sia/modules"
 	"gitlab.com/NebulousLabs/Sia/types"
+	"gitlab.com/NebulousLabs/errors"
 	"gitlab.com/NebulousLabs/fastrand"
 )
 
@@ -116,3 +118,54 @@ func TestInstructionReadOutsideSector(t *testing.T) {
 	// Check output.
 	outputs[0].assert(0, imr, []crypto.Hash{}, sectorData, nil)
 }
+
+// TestInstructionReadSectorVerify tests that reading a sector for which the
+// host returns data that doesn't match the sector's root fails if the MDM
+// verifies sector reads.
+func TestInstructionReadSectorVerify(t *testing.T) {
+	host := newTestHost()
+	mdm := New(host)
+	defer mdm.Stop()
+	mdm.SetVerifySectorReads(true)
+
+	// Prepare a priceTable and storage obligation.
+	pt := newTestPriceTable()
+	so := host.newTestStorageObligation(true)
+	so.AddRandomSectors(1)
+	duration := types.BlockHeight(fastrand.Uint64n(5))
+	root := so.sectorRoots[0]
+
+	// Corrupt the sector on the host.
+	host.mu.Lock()
+	data := host.sectors[root]
+	host.sectors[root] = fastrand.Bytes(int(modules.SectorSize))
+	host.mu.Unlock()
+
+	// Reading the corrupt sector should fail.
+	tb := newTestProgramBuilder(pt, duration)
+	tb.AddReadSectorInstruction(modules.SectorSize, 0, root, true)
+	outputs, err := mdm.ExecuteProgramWithBuilder(tb, so, duration, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !errors.Contains(outputs[0].Error, ErrSectorRootMismatch) {
+		t.Fatal("expected ErrSectorRootMismatch but got", outputs[0].Error)
+	}
+
+	// Restore the sector, now the read should succeed.
+	host.mu.Lock()
+	host.sectors[root] = data
+	host.mu.Unlock()
+	tb = newTestProgramBuilder(pt, duration)
+	tb.AddReadSectorInstruction(modules.SectorSize, 0, root, true)
+	outputs, err = mdm.ExecuteProgramWithBuilder(tb, so, duration, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if outputs[0].Error != nil {
+		t.Fatal(outputs[0].Error)
+	}
+	if !bytes.Equal(outputs[0].Output, data) {
+		t.Fatal("wrong data")
+	}
+}
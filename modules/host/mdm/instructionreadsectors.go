@@ -0,0 +1,241 @@
+package mdm
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"gitlab.com/NebulousLabs/Sia/crypto"
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/types"
+	"gitlab.com/NebulousLabs/errors"
+)
+
+// ErrReadSectorsPartialProof is returned by a 'ReadSectors' instruction if a
+// proof is requested for a read that doesn't cover a full sector.
+var ErrReadSectorsPartialProof = errors.New("reads need to cover a full sector when requesting a Merkle proof")
+
+// instructionReadSectors is an instruction which reads from multiple sectors
+// specified by their merkle roots.
+type instructionReadSectors struct {
+	commonInstruction
+
+	readsOffset uint64
+	numReads    uint64
+}
+
+// staticDecodeReadSectorsInstruction creates a new 'ReadSectors' instruction
+// from the provided generic instruction.
+func (p *program) staticDecodeReadSectorsInstruction(instruction modules.Instruction) (instruction, error) {
+	// Check specifier.
+	if instruction.Specifier != modules.SpecifierReadSectors {
+		return nil, fmt.Errorf("expected specifier %v but got %v",
+			modules.SpecifierReadSectors, instruction.Specifier)
+	}
+	// Check args.
+	if len(instruction.Args) != modules.RPCIReadSectorsLen {
+		return nil, fmt.Errorf("expected instruction to have len %v but was %v",
+			modules.RPCIReadSectorsLen, len(instruction.Args))
+	}
+	// Read args.
+	readsOffset := binary.LittleEndian.Uint64(instruction.Args[:8])
+	numReads := binary.LittleEndian.Uint64(instruction.Args[8:16])
+
+	// Return instruction.
+	return &instructionReadSectors{
+		commonInstruction: commonInstruction{
+			staticData:        p.staticData,
+			staticMerkleProof: instruction.Args[16] == 1,
+			staticState:       p.staticProgramState,
+		},
+		readsOffset: readsOffset,
+		numReads:    numReads,
+	}, nil
+}
+
+// Batch declares whether or not this instruction can be batched together with
+// the previous instruction.
+func (i instructionReadSectors) Batch() bool {
+	return false
+}
+
+// staticReads fetches the reads of the instruction from the program data and
+// validates their bounds. The reads are parsed one at a time, so a program
+// can't make the host allocate memory for reads it didn't send.
+func (i *instructionReadSectors) staticReads() ([]modules.MDMSectorRead, error) {
+	if i.numReads == 0 {
+		return nil, errors.New("number of reads cannot be zero")
+	}
+	if i.numReads > modules.MDMMaxSectorReads {
+		return nil, fmt.Errorf("number of reads %v exceeds the maximum of %v", i.numReads, modules.MDMMaxSectorReads)
+	}
+	var reads []modules.MDMSectorRead
+	for j := uint64(0); j < i.numReads; j++ {
+		offset := i.readsOffset + j*modules.MDMSectorReadSize
+		root, err := i.staticData.Hash(offset)
+		if err != nil {
+			return nil, err
+		}
+		readOffset, err := i.staticData.Uint64(offset + crypto.HashSize)
+		if err != nil {
+			return nil, err
+		}
+		readLength, err := i.staticData.Uint64(offset + crypto.HashSize + 8)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case readOffset+readLength > modules.SectorSize || readOffset+readLength < readOffset:
+			return nil, fmt.Errorf("request is out of bounds %v + %v > %v", readOffset, readLength, modules.SectorSize)
+		case readLength == 0:
+			return nil, errors.New("length cannot be zero")
+		}
+		reads = append(reads, modules.MDMSectorRead{
+			MerkleRoot: root,
+			Offset:     readOffset,
+			Length:     readLength,
+		})
+	}
+	return reads, nil
+}
+
+// Execute executes the 'ReadSectors' instruction.
+//
+// The output contains the data of all reads in the order they were requested.
+// If a proof was requested, every read needs to cover a full sector of the
+// contract and the reads need to be ordered by the index of their sector
+// within the contract. The proof is then a single diff proof with one range per
+// sector which proves that the roots of the returned sectors are part of the
+// contract. Proofs for partial reads would require a range proof within each
+// sector on top of the diff proof, which isn't supported, so those reads fail
+// with ErrReadSectorsPartialProof.
+func (i *instructionReadSectors) Execute(previousOutput output) (output, types.Currency) {
+	// Fetch the operands.
+	reads, err := i.staticReads()
+	if err != nil {
+		return errOutput(err), types.ZeroCurrency
+	}
+	ps := i.staticState
+
+	// Look up the indices of the read sectors within the contract if a proof
+	// was requested.
+	var indices []uint64
+	if i.staticMerkleProof {
+		indices, err = sectorReadIndices(ps.sectors.merkleRoots, reads)
+		if err != nil {
+			return errOutput(err), types.ZeroCurrency
+		}
+	}
+
+	// Read the data.
+	var data []byte
+	for _, read := range reads {
+		sectorData, err := ps.sectors.readSector(ps.host, read.MerkleRoot)
+		if err != nil {
+			return errOutput(err), types.ZeroCurrency
+		}
+		data = append(data, sectorData[read.Offset:read.Offset+read.Length]...)
+	}
+
+	// Construct the Merkle proof, if requested. Every sector gets its own
+	// range, even if it is adjacent to the previous one, so that the roots of
+	// the sectors can be used as the leaf hashes to verify the proof.
+	var proof []crypto.Hash
+	if i.staticMerkleProof {
+		ranges := make([]crypto.ProofRange, 0, len(indices))
+		for _, idx := range indices {
+			ranges = append(ranges, crypto.ProofRange{
+				Start: idx,
+				End:   idx + 1,
+			})
+		}
+		proof = crypto.MerkleDiffProof(ranges, uint64(len(ps.sectors.merkleRoots)), nil, ps.sectors.merkleRoots)
+	}
+
+	// Return the output.
+	return output{
+		NewSize:       previousOutput.NewSize,       // size stays the same
+		NewMerkleRoot: previousOutput.NewMerkleRoot, // root stays the same
+		Output:        data,
+		Proof:         proof,
+	}, types.ZeroCurrency
+}
+
+// Collateral is zero for the ReadSectors instruction.
+func (i *instructionReadSectors) Collateral() types.Currency {
+	return modules.MDMReadCollateral()
+}
+
+// Cost returns the cost of a ReadSectors instruction.
+func (i *instructionReadSectors) Cost() (executionCost, _ types.Currency, err error) {
+	var reads []modules.MDMSectorRead
+	reads, err = i.staticReads()
+	if err != nil {
+		return
+	}
+	var totalLength uint64
+	for _, read := range reads {
+		totalLength += read.Length
+	}
+	executionCost = modules.MDMReadSectorsCost(i.staticState.priceTable, i.numReads, totalLength)
+	return
+}
+
+// Memory returns the memory allocated by the 'ReadSectors' instruction beyond
+// the lifetime of the instruction. Since the data of all reads is buffered for
+// the output, it scales with the total length of the reads. Invalid reads are
+// rejected by Cost.
+func (i *instructionReadSectors) Memory() uint64 {
+	reads, err := i.staticReads()
+	if err != nil {
+		return modules.MDMReadMemory()
+	}
+	var totalLength uint64
+	for _, read := range reads {
+		totalLength += read.Length
+	}
+	return modules.MDMReadSectorsMemory(totalLength)
+}
+
+// Time returns the execution time of a 'ReadSectors' instruction.
+func (i *instructionReadSectors) Time() (uint64, error) {
+	return modules.MDMReadSectorsTime(i.numReads), nil
+}
+
+// sectorReadIndices returns the indices of the sectors of the reads within the
+// contract. Every read needs to cover a full sector of the contract and the
+// reads need to be ordered by their index.
+func sectorReadIndices(roots []crypto.Hash, reads []modules.MDMSectorRead) ([]uint64, error) {
+	// Map the roots of the reads to their position within the reads.
+	positions := make(map[crypto.Hash]int, len(reads))
+	for j, read := range reads {
+		if read.Offset != 0 || read.Length != modules.SectorSize {
+			return nil, errors.AddContext(ErrReadSectorsPartialProof, fmt.Sprintf("read %v covers [%v, %v)", j, read.Offset, read.Offset+read.Length))
+		}
+		if _, exists := positions[read.MerkleRoot]; exists {
+			return nil, fmt.Errorf("sector %v is read more than once", read.MerkleRoot)
+		}
+		positions[read.MerkleRoot] = j
+	}
+	// Find the first index of each root within the contract.
+	indices := make([]uint64, len(reads))
+	found := 0
+	for idx, root := range roots {
+		j, exists := positions[root]
+		if !exists {
+			continue
+		}
+		delete(positions, root)
+		indices[j] = uint64(idx)
+		found++
+	}
+	if found != len(reads) {
+		return nil, errors.New("sector to read is not part of the contract")
+	}
+	// Make sure the reads are ordered.
+	for j := 1; j < len(indices); j++ {
+		if indices[j] <= indices[j-1] {
+			return nil, errors.New("reads need to be ordered by the index of their sector when requesting a Merkle proof")
+		}
+	}
+	return indices, nil
+}
@@ -0,0 +1,242 @@
+package mdm
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+
+	"gitlab.com/NebulousLabs/Sia/crypto"
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/types"
+	"gitlab.com/NebulousLabs/errors"
+	"gitlab.com/NebulousLabs/fastrand"
+)
+
+// TestInstructionReadSectors tests executing a program with a single
+// ReadSectorsInstruction.
+func TestInstructionReadSectors(t *testing.T) {
+	host := newTestHost()
+	mdm := New(host)
+	defer mdm.Stop()
+
+	// Prepare a priceTable.
+	pt := newTestPriceTable()
+	// Prepare storage obligation.
+	so := host.newTestStorageObligation(true)
+	so.AddRandomSectors(initialContractSectors)
+	duration := types.BlockHeight(fastrand.Uint64n(5))
+	ics := so.ContractSize()
+	imr := so.MerkleRoot()
+
+	// Read three full sectors. The first two are adjacent and the last one
+	// isn't.
+	indices := []uint64{0, 1, initialContractSectors - 1}
+	var reads []modules.MDMSectorRead
+	var expectedData []byte
+	var leafHashes []crypto.Hash
+	for _, idx := range indices {
+		root := so.sectorRoots[idx]
+		sectorData, err := host.ReadSector(root)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reads = append(reads, modules.MDMSectorRead{
+			MerkleRoot: root,
+			Offset:     0,
+			Length:     modules.SectorSize,
+		})
+		expectedData = append(expectedData, sectorData...)
+		leafHashes = append(leafHashes, crypto.MerkleRoot(sectorData))
+	}
+
+	// Use a builder to build the program.
+	tb := newTestProgramBuilder(pt, duration)
+	tb.AddReadSectorsInstruction(reads, true)
+
+	// Execute it.
+	outputs, err := mdm.ExecuteProgramWithBuilder(tb, so, duration, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Assert the output.
+	ranges := []crypto.ProofRange{
+		{Start: 0, End: 1},
+		{Start: 1, End: 2},
+		{Start: initialContractSectors - 1, End: initialContractSectors},
+	}
+	proof := crypto.MerkleDiffProof(ranges, initialContractSectors, nil, so.sectorRoots)
+	err = outputs[0].assert(ics, imr, proof, expectedData, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Verify the combined proof covers all three sectors.
+	ok := crypto.VerifyDiffProof(ranges, initialContractSectors, outputs[0].Proof, leafHashes, imr)
+	if !ok {
+		t.Fatal("failed to verify proof")
+	}
+
+	// Read parts of three sectors in arbitrary order without a proof.
+	indices = []uint64{5, 2, 5}
+	reads = reads[:0]
+	expectedData = expectedData[:0]
+	for _, idx := range indices {
+		root := so.sectorRoots[idx]
+		sectorData, err := host.ReadSector(root)
+		if err != nil {
+			t.Fatal(err)
+		}
+		offset := fastrand.Uint64n(modules.SectorSize)
+		length := fastrand.Uint64n(modules.SectorSize-offset) + 1
+		reads = append(reads, modules.MDMSectorRead{
+			MerkleRoot: root,
+			Offset:     offset,
+			Length:     length,
+		})
+		expectedData = append(expectedData, sectorData[offset:offset+length]...)
+	}
+	tb = newTestProgramBuilder(pt, duration)
+	tb.AddReadSectorsInstruction(reads, false)
+	outputs, err = mdm.ExecuteProgramWithBuilder(tb, so, duration, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = outputs[0].assert(ics, imr, nil, expectedData, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestInstructionReadSectorsProofErrors tests that a ReadSectors instruction
+// fails if a proof is requested for reads that can't be proven with a single
+// diff proof.
+func TestInstructionReadSectorsProofErrors(t *testing.T) {
+	host := newTestHost()
+	mdm := New(host)
+	defer mdm.Stop()
+
+	pt := newTestPriceTable()
+	so := host.newTestStorageObligation(true)
+	so.AddRandomSectors(initialContractSectors)
+	duration := types.BlockHeight(fastrand.Uint64n(5))
+
+	fullSector := func(idx uint64) modules.MDMSectorRead {
+		return modules.MDMSectorRead{
+			MerkleRoot: so.sectorRoots[idx],
+			Offset:     0,
+			Length:     modules.SectorSize,
+		}
+	}
+	partialSector := fullSector(0)
+	partialSector.Length = crypto.SegmentSize
+	outsideSector := fullSector(0)
+	outsideSector.MerkleRoot = randomSectorRoots(1)[0]
+
+	tests := []struct {
+		name  string
+		reads []modules.MDMSectorRead
+	}{
+		{"Unordered", []modules.MDMSectorRead{fullSector(1), fullSector(0)}},
+		{"Duplicate", []modules.MDMSectorRead{fullSector(0), fullSector(0)}},
+		{"Partial", []modules.MDMSectorRead{partialSector}},
+		{"Outside", []modules.MDMSectorRead{outsideSector}},
+	}
+	for _, test := range tests {
+		tb := newTestProgramBuilder(pt, duration)
+		tb.AddReadSectorsInstruction(test.reads, true)
+		outputs, _, err := mdm.ExecuteProgramWithBuilderCustomBudget(tb, so, duration, false)
+		if err != nil {
+			t.Fatal(test.name, err)
+		}
+		if outputs[0].Error == nil {
+			t.Fatal(test.name, "expected instruction to fail")
+		}
+		if len(outputs[0].Output) != 0 {
+			t.Fatal(test.name, "expected no output")
+		}
+	}
+}
+
+// TestInstructionReadSectorsPartialProof tests that a ReadSectors instruction
+// can't provide a proof for a read that only covers part of a sector, even if
+// the other reads cover full sectors.
+func TestInstructionReadSectorsPartialProof(t *testing.T) {
+	host := newTestHost()
+	mdm := New(host)
+	defer mdm.Stop()
+
+	pt := newTestPriceTable()
+	so := host.newTestStorageObligation(true)
+	so.AddRandomSectors(initialContractSectors)
+	duration := types.BlockHeight(fastrand.Uint64n(5))
+
+	reads := []modules.MDMSectorRead{
+		{MerkleRoot: so.sectorRoots[0], Offset: 0, Length: modules.SectorSize},
+		{MerkleRoot: so.sectorRoots[1], Offset: crypto.SegmentSize, Length: modules.SectorSize - crypto.SegmentSize},
+	}
+
+	// Requesting a proof fails.
+	tb := newTestProgramBuilder(pt, duration)
+	tb.AddReadSectorsInstruction(reads, true)
+	outputs, _, err := mdm.ExecuteProgramWithBuilderCustomBudget(tb, so, duration, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !errors.Contains(outputs[0].Error, ErrReadSectorsPartialProof) {
+		t.Fatal("expected ErrReadSectorsPartialProof", outputs[0].Error)
+	}
+	if len(outputs[0].Output) != 0 || len(outputs[0].Proof) != 0 {
+		t.Fatal("expected no output")
+	}
+
+	// The same reads succeed without a proof.
+	tb = newTestProgramBuilder(pt, duration)
+	tb.AddReadSectorsInstruction(reads, false)
+	outputs, err = mdm.ExecuteProgramWithBuilder(tb, so, duration, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if outputs[0].Error != nil {
+		t.Fatal(outputs[0].Error)
+	}
+	if uint64(len(outputs[0].Output)) != 2*modules.SectorSize-crypto.SegmentSize {
+		t.Fatal("wrong output length", len(outputs[0].Output))
+	}
+}
+
+// TestInstructionReadSectorsMaxReads tests that the number of reads of a
+// ReadSectors instruction is capped independently of the declared length of
+// the program data.
+func TestInstructionReadSectorsMaxReads(t *testing.T) {
+	t.Parallel()
+
+	// Declare a huge amount of program data without sending any of it.
+	pd := openProgramData(bytes.NewReader(nil), 1<<62, 0)
+	defer pd.Close()
+
+	newInstruction := func(numReads uint64) *instructionReadSectors {
+		return &instructionReadSectors{
+			commonInstruction: commonInstruction{
+				staticData: pd,
+			},
+			numReads: numReads,
+		}
+	}
+
+	// Too many reads are rejected before any program data is read.
+	for _, numReads := range []uint64{modules.MDMMaxSectorReads + 1, math.MaxUint64} {
+		_, err := newInstruction(numReads).staticReads()
+		if err == nil || !strings.Contains(err.Error(), "exceeds the maximum") {
+			t.Fatal("expected reads to be rejected", numReads, err)
+		}
+	}
+
+	// The maximum number of reads is parsed from the program data, which
+	// fails since it was never sent.
+	_, err := newInstruction(modules.MDMMaxSectorReads).staticReads()
+	if err == nil || strings.Contains(err.Error(), "exceeds the maximum") {
+		t.Fatal("expected reading the program data to fail", err)
+	}
+}
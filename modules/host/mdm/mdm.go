@@ -1,6 +1,11 @@
 package mdm
 
 import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
 	"gitlab.com/NebulousLabs/Sia/crypto"
 	"gitlab.com/NebulousLabs/Sia/modules"
 	"gitlab.com/NebulousLabs/Sia/types"
@@ -9,7 +14,8 @@ import (
 
 // StorageObligation defines an interface the storage obligation must adhere to.
 type StorageObligation interface {
-	// Update updates the storage obligation.
+	// Update updates the storage obligation. Gained sectors with nil data
+	// were flushed using the SectorFlusher and need to be read back from it.
 	Update(sectorRoots []crypto.Hash, sectorsRemoved map[crypto.Hash]struct{}, sectorsGained map[crypto.Hash][]byte) error
 }
 
@@ -48,17 +54,313 @@ type Host interface {
 // batched into atomic sets called 'programs' that are either entirely applied
 // or are not applied at all.
 type MDM struct {
-	host Host
-	tg   threadgroup.ThreadGroup
+	// atomicCacheReadBytes and atomicDiskReadBytes count the sector data read
+	// by all programs. They need to be placed at the top of the struct to
+	// preserve the alignment of 64-bit words on 32-bit systems.
+	atomicCacheReadBytes uint64
+	atomicDiskReadBytes  uint64
+
+	host               Host
+	programDataTimeout time.Duration
+	timer              ProgramTimer
+	tracer             InstructionTracer
+	verifySectorReads  bool
+	mu                 sync.Mutex
+	tg                 threadgroup.ThreadGroup
+
+	// contractReads contains the read metrics of the programs executed on a
+	// contract, indexed by the id of the contract.
+	contractReads map[types.FileContractID]ReadMetrics
+
+	// activePrograms contains the programs that are currently executed,
+	// indexed by a unique id. It is protected by activeProgramsMu instead of
+	// mu to avoid enumerating the programs from stalling the MDM.
+	activePrograms   map[uint64]*program
+	activeProgramsMu sync.Mutex
+	nextProgramID    uint64
+
+	// maxGainedSectorsMemory is the maximum amount of sector data a program
+	// keeps in memory for appended sectors. Once exceeded, the data is
+	// flushed using the staticSectorFlusher. 0 means there is no ceiling.
+	maxGainedSectorsMemory uint64
+	staticSectorFlusher    SectorFlusher
+}
+
+// InstructionTrace contains information about a single instruction that was
+// executed by the MDM.
+type InstructionTrace struct {
+	// ContractID is the id of the contract the program was executed on. It is
+	// empty for programs that are not executed on a contract.
+	ContractID types.FileContractID
+	// Index is the index of the instruction within the program and
+	// NumInstructions the total number of instructions of the program.
+	Index           int
+	NumInstructions int
+	// Specifier is the type of the instruction.
+	Specifier modules.InstructionSpecifier
+	// Cost is the cost of the instruction including the memory cost and
+	// Refund the amount that was refunded right after executing it.
+	Cost   types.Currency
+	Refund types.Currency
+	// NewSize and NewMerkleRoot are the contract's size and merkle root after
+	// executing the instruction.
+	NewSize       uint64
+	NewMerkleRoot crypto.Hash
+	// Err is the error returned by the instruction, if any.
+	Err error
+}
+
+// ReadMetrics contains the amount of sector data read by MDM programs.
+type ReadMetrics struct {
+	// CacheBytes is the number of bytes read from sectors that were gained
+	// by the program itself and DiskBytes the number of bytes read from the
+	// host's storage.
+	CacheBytes uint64
+	DiskBytes  uint64
+}
+
+// ActiveProgram contains information about a program that is currently
+// executed by the MDM.
+type ActiveProgram struct {
+	// ContractID is the id of the contract the program is executed on. It is
+	// empty for programs that are not executed on a contract.
+	ContractID types.FileContractID
+	// Started is the time the execution of the program started.
+	Started time.Time
+	// InstructionIndex is the index of the instruction that is currently
+	// executed and NumInstructions the total number of instructions of the
+	// program.
+	InstructionIndex int
+	NumInstructions  int
+	// ExecutionCost, AdditionalCollateral and UsedMemory are the cost,
+	// collateral and memory accumulated by the program so far.
+	ExecutionCost        types.Currency
+	AdditionalCollateral types.Currency
+	UsedMemory           uint64
+}
+
+// InstructionTracer is a function that is called by the MDM after every
+// executed instruction.
+type InstructionTracer func(InstructionTrace)
+
+// EstimatedTimeUnit is the duration of a single unit of the static time
+// estimates of the instructions, e.g. modules.MDMTimeReadSector, when comparing
+// them to the measured execution time.
+const EstimatedTimeUnit = time.Microsecond
+
+// InstructionTiming contains the measured and the estimated execution time of
+// a single instruction.
+type InstructionTiming struct {
+	Specifier     modules.InstructionSpecifier
+	Duration      time.Duration
+	EstimatedTime uint64
 }
 
+// ProgramTiming contains the measured and estimated execution times of the
+// instructions a program executed.
+type ProgramTiming struct {
+	// ContractID is the id of the contract the program was executed on. It is
+	// empty for programs that are not executed on a contract.
+	ContractID types.FileContractID
+	// Instructions contains the timings of the executed instructions in the
+	// order of execution. Instructions that weren't executed due to an
+	// earlier failure are missing.
+	Instructions []InstructionTiming
+	// Duration and EstimatedTime are the sums of the measured and estimated
+	// times of the executed instructions.
+	Duration      time.Duration
+	EstimatedTime uint64
+}
+
+// EstimatedDuration converts the estimated time of the program to a duration
+// that can be compared to the measured duration.
+func (pt ProgramTiming) EstimatedDuration() time.Duration {
+	return time.Duration(pt.EstimatedTime) * EstimatedTimeUnit
+}
+
+// ProgramTimer is a function that is called by the MDM with the timing of
+// every program once it finished executing.
+type ProgramTimer func(ProgramTiming)
+
 // New creates a new MDM.
 func New(h Host) *MDM {
+	return NewCustomMDM(h, 0, nil)
+}
+
+// NewCustomMDM creates a new MDM which limits the memory used by the data of
+// the sectors a program appends to maxGainedSectorsMemory. Sectors exceeding
+// that ceiling are flushed using the flusher. Without a flusher, appending
+// them fails with ErrGainedSectorsMemoryExceeded.
+func NewCustomMDM(h Host, maxGainedSectorsMemory uint64, flusher SectorFlusher) *MDM {
 	return &MDM{
-		host: h,
+		host:               h,
+		contractReads:      make(map[types.FileContractID]ReadMetrics),
+		activePrograms:     make(map[uint64]*program),
+		programDataTimeout: DefaultProgramDataTimeout,
+
+		maxGainedSectorsMemory: maxGainedSectorsMemory,
+		staticSectorFlusher:    flusher,
 	}
 }
 
+// SetInstructionTracer sets the tracer that is called after every instruction
+// executed by programs that are started afterwards. Passing nil disables
+// tracing which means there is no overhead for executing instructions.
+func (mdm *MDM) SetInstructionTracer(tracer InstructionTracer) {
+	mdm.mu.Lock()
+	defer mdm.mu.Unlock()
+	mdm.tracer = tracer
+}
+
+// SetProgramTimer sets the timer that is called with the measured execution
+// times of programs that are started afterwards. Passing nil disables timing
+// which means there is no overhead for executing instructions.
+func (mdm *MDM) SetProgramTimer(timer ProgramTimer) {
+	mdm.mu.Lock()
+	defer mdm.mu.Unlock()
+	mdm.timer = timer
+}
+
+// SetMaxGainedSectorsMemory sets the maximum amount of sector data programs
+// that are started afterwards keep in memory for appended sectors. Passing 0
+// removes the ceiling.
+func (mdm *MDM) SetMaxGainedSectorsMemory(max uint64) {
+	mdm.mu.Lock()
+	defer mdm.mu.Unlock()
+	mdm.maxGainedSectorsMemory = max
+}
+
+// MaxGainedSectorsMemory returns the maximum amount of sector data programs
+// that are started keep in memory for appended sectors.
+func (mdm *MDM) MaxGainedSectorsMemory() uint64 {
+	mdm.mu.Lock()
+	defer mdm.mu.Unlock()
+	return mdm.maxGainedSectorsMemory
+}
+
+// SetProgramDataTimeout sets the amount of time programs that are started
+// afterwards wait for the next packet of program data before failing with
+// ErrProgramDataTimeout. Passing 0 disables the timeout.
+func (mdm *MDM) SetProgramDataTimeout(timeout time.Duration) {
+	mdm.mu.Lock()
+	defer mdm.mu.Unlock()
+	mdm.programDataTimeout = timeout
+}
+
+// ProgramDataTimeout returns the amount of time programs that are started
+// wait for the next packet of program data.
+func (mdm *MDM) ProgramDataTimeout() time.Duration {
+	mdm.mu.Lock()
+	defer mdm.mu.Unlock()
+	return mdm.programDataTimeout
+}
+
+// SetVerifySectorReads sets whether programs that are started afterwards
+// recompute the merkle root of every sector they read from the host and fail
+// with ErrSectorRootMismatch if it doesn't match the requested root. This
+// catches corrupted host storage before it results in invalid proofs, at the
+// cost of hashing every sector that is read.
+func (mdm *MDM) SetVerifySectorReads(verify bool) {
+	mdm.mu.Lock()
+	defer mdm.mu.Unlock()
+	mdm.verifySectorReads = verify
+}
+
+// VerifySectorReads returns whether programs that are started verify the
+// merkle root of the sectors they read from the host.
+func (mdm *MDM) VerifySectorReads() bool {
+	mdm.mu.Lock()
+	defer mdm.mu.Unlock()
+	return mdm.verifySectorReads
+}
+
+// ReadMetrics returns the amount of sector data read by all programs since the
+// MDM was created.
+func (mdm *MDM) ReadMetrics() ReadMetrics {
+	return ReadMetrics{
+		CacheBytes: atomic.LoadUint64(&mdm.atomicCacheReadBytes),
+		DiskBytes:  atomic.LoadUint64(&mdm.atomicDiskReadBytes),
+	}
+}
+
+// ContractReadMetrics returns the amount of sector data read by the programs
+// executed on the contract with the given id since the MDM was created or the
+// contract's metrics were last removed.
+func (mdm *MDM) ContractReadMetrics(fcid types.FileContractID) ReadMetrics {
+	mdm.mu.Lock()
+	defer mdm.mu.Unlock()
+	return mdm.contractReads[fcid]
+}
+
+// RemoveContractReadMetrics removes the read metrics of the contract with the
+// given id. It should be called once the contract's storage obligation is
+// removed. The totals returned by ReadMetrics are not affected.
+func (mdm *MDM) RemoveContractReadMetrics(fcid types.FileContractID) {
+	mdm.mu.Lock()
+	defer mdm.mu.Unlock()
+	delete(mdm.contractReads, fcid)
+}
+
+// recordReads adds the read metrics of a finished program to the MDM's
+// metrics. Programs that didn't read anything don't need to acquire the lock.
+func (mdm *MDM) recordReads(fcid types.FileContractID, rm ReadMetrics) {
+	if rm.CacheBytes == 0 && rm.DiskBytes == 0 {
+		return
+	}
+	atomic.AddUint64(&mdm.atomicCacheReadBytes, rm.CacheBytes)
+	atomic.AddUint64(&mdm.atomicDiskReadBytes, rm.DiskBytes)
+	if fcid == (types.FileContractID{}) {
+		return // not executed on a contract
+	}
+	mdm.mu.Lock()
+	defer mdm.mu.Unlock()
+	crm := mdm.contractReads[fcid]
+	crm.CacheBytes += rm.CacheBytes
+	crm.DiskBytes += rm.DiskBytes
+	mdm.contractReads[fcid] = crm
+}
+
+// ActivePrograms returns information about the programs that are currently
+// executed by the MDM, ordered by the time their execution started. The
+// programs only hold the lock of their status for a short amount of time after
+// every instruction, which means that enumerating them doesn't stall them.
+func (mdm *MDM) ActivePrograms() []ActiveProgram {
+	mdm.activeProgramsMu.Lock()
+	programs := make([]*program, 0, len(mdm.activePrograms))
+	for _, p := range mdm.activePrograms {
+		programs = append(programs, p)
+	}
+	mdm.activeProgramsMu.Unlock()
+
+	active := make([]ActiveProgram, 0, len(programs))
+	for _, p := range programs {
+		active = append(active, p.managedStatus())
+	}
+	sort.Slice(active, func(i, j int) bool {
+		return active[i].Started.Before(active[j].Started)
+	})
+	return active
+}
+
+// addActiveProgram adds a program to the active programs and returns the id
+// that is used to remove it again once it finished.
+func (mdm *MDM) addActiveProgram(p *program) uint64 {
+	mdm.activeProgramsMu.Lock()
+	defer mdm.activeProgramsMu.Unlock()
+	id := mdm.nextProgramID
+	mdm.nextProgramID++
+	mdm.activePrograms[id] = p
+	return id
+}
+
+// removeActiveProgram removes a program that finished executing from the
+// active programs.
+func (mdm *MDM) removeActiveProgram(id uint64) {
+	mdm.activeProgramsMu.Lock()
+	defer mdm.activeProgramsMu.Unlock()
+	delete(mdm.activePrograms, id)
+}
+
 // Stop will stop the MDM and wait for all of the spawned programs to stop
 // executing while also preventing new programs from being started.
 func (mdm *MDM) Stop() error {
@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"sync"
+	"time"
 
 	"gitlab.com/NebulousLabs/errors"
 	"gitlab.com/NebulousLabs/threadgroup"
@@ -67,6 +69,26 @@ type program struct {
 	outputChan chan Output
 	outputErr  error // contains the error of the first instruction of the program that failed
 
+	// staticTracer is called after every instruction if set and
+	// staticSpecifiers contains the specifiers of the instructions to be able
+	// to trace them.
+	staticTracer     InstructionTracer
+	staticSpecifiers []modules.InstructionSpecifier
+
+	// staticTimer is called with the timing of the program once it finished
+	// if set. The timing is collected in timing while the program executes.
+	staticTimer ProgramTimer
+	timing      ProgramTiming
+
+	// status contains the progress of the program for enumerating the
+	// active programs of the MDM.
+	status   ActiveProgram
+	statusMu sync.Mutex
+
+	// releaseOnce makes sure the sectors flushed by the program are only
+	// released once.
+	releaseOnce sync.Once
+
 	tg *threadgroup.ThreadGroup
 }
 
@@ -95,6 +117,8 @@ func decodeInstruction(p *program, i modules.Instruction) (instruction, error) {
 		return p.staticDecodeHasSectorInstruction(i)
 	case modules.SpecifierReadSector:
 		return p.staticDecodeReadSectorInstruction(i)
+	case modules.SpecifierReadSectors:
+		return p.staticDecodeReadSectorsInstruction(i)
 	case modules.SpecifierReadOffset:
 		return p.staticDecodeReadOffsetInstruction(i)
 	case modules.SpecifierRevision:
@@ -118,6 +142,7 @@ func (mdm *MDM) ExecuteProgram(ctx context.Context, pt *modules.RPCPriceTable, p
 		return nil, nil, ErrEmptyProgram
 	}
 	// Derive a new context to use and close it on error.
+	parentCtx := ctx
 	ctx, cancel := context.WithCancel(ctx)
 	defer func() {
 		if err != nil {
@@ -137,9 +162,17 @@ func (mdm *MDM) ExecuteProgram(ctx context.Context, pt *modules.RPCPriceTable, p
 		staticBudget:           budget,
 		usedMemory:             modules.MDMInitMemory(),
 		staticCollateralBudget: collateralBudget,
-		staticData:             openProgramData(data, programDataLen),
 		tg:                     &mdm.tg,
 	}
+	program.staticProgramState.sectors.flusher = mdm.staticSectorFlusher
+	mdm.mu.Lock()
+	program.staticProgramState.sectors.maxGainedBytes = mdm.maxGainedSectorsMemory
+	program.staticTracer = mdm.tracer
+	program.staticTimer = mdm.timer
+	program.staticProgramState.sectors.verifyReads = mdm.verifySectorReads
+	programDataTimeout := mdm.programDataTimeout
+	mdm.mu.Unlock()
+	program.staticData = openProgramData(data, programDataLen, programDataTimeout)
 	// Convert the instructions.
 	for _, i := range p {
 		instruction, err := decodeInstruction(program, i)
@@ -147,6 +180,9 @@ func (mdm *MDM) ExecuteProgram(ctx context.Context, pt *modules.RPCPriceTable, p
 			return nil, nil, errors.Compose(err, program.staticData.Close())
 		}
 		program.instructions = append(program.instructions, instruction)
+		if program.staticTracer != nil || program.staticTimer != nil {
+			program.staticSpecifiers = append(program.staticSpecifiers, i.Specifier)
+		}
 	}
 	// Increment the execution cost of the program.
 	err = program.addCost(modules.MDMInitCost(pt, program.staticData.Len(), uint64(len(program.instructions))))
@@ -157,8 +193,21 @@ func (mdm *MDM) ExecuteProgram(ctx context.Context, pt *modules.RPCPriceTable, p
 	if err := program.tg.Add(); err != nil {
 		return nil, nil, errors.Compose(err, program.staticData.Close())
 	}
+	program.status = ActiveProgram{
+		ContractID:      program.staticContractID(),
+		Started:         time.Now(),
+		NumInstructions: len(program.instructions),
+		ExecutionCost:   program.executionCost,
+		UsedMemory:      program.usedMemory,
+	}
+	id := mdm.addActiveProgram(program)
 	go func() {
 		defer cancel()
+		defer program.tg.Done()
+		// The program data is closed before the output channel. That way the
+		// caller knows that the program data is no longer read from the reader
+		// once all outputs were received.
+		defer close(program.outputChan)
 		defer func() {
 			err := program.staticData.Close()
 			if err != nil {
@@ -168,9 +217,27 @@ func (mdm *MDM) ExecuteProgram(ctx context.Context, pt *modules.RPCPriceTable, p
 				build.Critical(err)
 			}
 		}()
-		defer program.tg.Done()
-		defer close(program.outputChan)
+		defer mdm.removeActiveProgram(id)
 		program.outputErr = program.executeInstructions(ctx, sos.ContractSize(), sos.MerkleRoot())
+		mdm.recordReads(program.staticContractID(), program.staticProgramState.sectors.reads)
+		if program.staticTimer != nil {
+			program.timing.ContractID = program.staticContractID()
+			program.staticTimer(program.timing)
+		}
+		// Programs that can't be finalized release their flushed sectors
+		// right away. All others release them when they are finalized or once
+		// the caller is done with them without finalizing.
+		if program.outputErr != nil || p.ReadOnly() {
+			program.releaseFlushedSectors()
+		} else if len(program.staticProgramState.sectors.flushed) > 0 {
+			go func() {
+				select {
+				case <-parentCtx.Done():
+				case <-mdm.tg.StopChan():
+				}
+				program.releaseFlushedSectors()
+			}()
+		}
 	}()
 	// If the program is readonly there is no need to finalize it.
 	if p.ReadOnly() {
@@ -242,11 +309,11 @@ func (p *program) executeInstructions(ctx context.Context, fcSize uint64, fcRoot
 		// Add the memory the next instruction is going to allocate to the
 		// total.
 		p.usedMemory += i.Memory()
-		time, err := i.Time()
+		instructionTime, err := i.Time()
 		if err != nil {
 			p.outputChan <- outputFromError(err, p.additionalCollateral, p.executionCost, p.failureRefund)
 		}
-		memoryCost := modules.MDMMemoryCost(p.staticProgramState.priceTable, p.usedMemory, time)
+		memoryCost := modules.MDMMemoryCost(p.staticProgramState.priceTable, p.usedMemory, instructionTime)
 		// Get the instruction cost and storageCost.
 		instructionCost, failureRefund, err := i.Cost()
 		if err != nil {
@@ -262,16 +329,35 @@ func (p *program) executeInstructions(ctx context.Context, fcSize uint64, fcRoot
 		}
 		// Add the instruction's potential refund to the total.
 		p.failureRefund = p.failureRefund.Add(failureRefund)
+		p.managedUpdateStatus(idx)
 		// Figure out whether to recommend the caller to batch this instruction
 		// with the next one. We batch if the instruction is supposed to be
 		// batched and if it's not the last instruction in the program.
 		batch := idx < len(p.instructions)-1 && p.instructions[idx+1].Batch()
-		// Execute next instruction.
-		output, refund = i.Execute(output)
+		// Execute next instruction. The execution is only timed if
+		// necessary.
+		if p.staticTimer != nil {
+			start := time.Now()
+			output, refund = i.Execute(output)
+			p.recordTiming(idx, time.Since(start), instructionTime)
+		} else {
+			output, refund = i.Execute(output)
+		}
+		// In testing builds, make sure the instruction didn't leave the program
+		// cache in an inconsistent state.
+		if build.Release == "testing" {
+			if err := p.staticProgramState.sectors.checkConsistency(); err != nil {
+				build.Critical("sectors diverged after instruction", idx, err)
+			}
+		}
 		// Issue potential refund.
 		if !refund.IsZero() {
 			p.refundCost(refund)
 		}
+		// Trace the instruction if necessary.
+		if p.staticTracer != nil {
+			p.traceInstruction(idx, cost, refund, output)
+		}
 		p.outputChan <- Output{
 			output:               output,
 			Batch:                batch,
@@ -287,9 +373,65 @@ func (p *program) executeInstructions(ctx context.Context, fcSize uint64, fcRoot
 	return nil
 }
 
+// managedStatus returns the current status of the program.
+func (p *program) managedStatus() ActiveProgram {
+	p.statusMu.Lock()
+	defer p.statusMu.Unlock()
+	return p.status
+}
+
+// managedUpdateStatus updates the status of the program before executing the
+// instruction with the given index.
+func (p *program) managedUpdateStatus(idx int) {
+	p.statusMu.Lock()
+	defer p.statusMu.Unlock()
+	p.status.InstructionIndex = idx
+	p.status.ExecutionCost = p.executionCost
+	p.status.AdditionalCollateral = p.additionalCollateral
+	p.status.UsedMemory = p.usedMemory
+}
+
+// recordTiming adds the measured and estimated execution time of an executed
+// instruction to the program's timing.
+func (p *program) recordTiming(idx int, d time.Duration, estimatedTime uint64) {
+	p.timing.Instructions = append(p.timing.Instructions, InstructionTiming{
+		Specifier:     p.staticSpecifiers[idx],
+		Duration:      d,
+		EstimatedTime: estimatedTime,
+	})
+	p.timing.Duration += d
+	p.timing.EstimatedTime += estimatedTime
+}
+
+// traceInstruction passes the information about an executed instruction to the
+// program's tracer.
+func (p *program) traceInstruction(idx int, cost, refund types.Currency, output output) {
+	p.staticTracer(InstructionTrace{
+		ContractID:      p.staticContractID(),
+		Index:           idx,
+		NumInstructions: len(p.instructions),
+		Specifier:       p.staticSpecifiers[idx],
+		Cost:            cost,
+		Refund:          refund,
+		NewSize:         output.NewSize,
+		NewMerkleRoot:   output.NewMerkleRoot,
+		Err:             output.Error,
+	})
+}
+
+// staticContractID returns the id of the contract the program is executed on.
+// It is empty for programs that are not executed on a contract.
+func (p *program) staticContractID() types.FileContractID {
+	if revs := p.staticProgramState.staticRevisionTxn.FileContractRevisions; len(revs) > 0 {
+		return revs[0].ParentID
+	}
+	return types.FileContractID{}
+}
+
 // managedFinalize commits the changes made by the program to disk. It should
 // only be called after the channel returned by Execute is closed.
 func (p *program) managedFinalize(so StorageObligation) error {
+	defer p.releaseFlushedSectors()
 	// Prevent finalizing the program when it was aborted due to a failure.
 	if p.outputErr != nil {
 		return errors.Compose(p.outputErr, errors.New("can't call finalize on program that was aborted due to an error"))
@@ -308,3 +450,13 @@ func (p *program) managedFinalize(so StorageObligation) error {
 	}
 	return nil
 }
+
+// releaseFlushedSectors releases the sectors flushed by the program once the
+// program is done with them.
+func (p *program) releaseFlushedSectors() {
+	p.releaseOnce.Do(func() {
+		// Failing to release the sectors only wastes disk space until the
+		// host restarts so there is nothing useful to do with the error.
+		_ = p.staticProgramState.sectors.releaseFlushedSectors()
+	})
+}
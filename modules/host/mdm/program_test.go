@@ -3,8 +3,11 @@ package mdm
 import (
 	"bytes"
 	"context"
+	"fmt"
 	"testing"
+	"time"
 
+	"gitlab.com/NebulousLabs/Sia/build"
 	"gitlab.com/NebulousLabs/Sia/crypto"
 	"gitlab.com/NebulousLabs/Sia/modules"
 	"gitlab.com/NebulousLabs/Sia/types"
@@ -133,3 +136,369 @@ func TestNewProgramLowCollateralBudget(t *testing.T) {
 		t.Fatal("shouldn't be able to finalize program")
 	}
 }
+
+// TestInstructionTracer makes sure that a tracer set on the MDM is called for
+// every executed instruction.
+func TestInstructionTracer(t *testing.T) {
+	host := newTestHost()
+	mdm := New(host)
+	defer mdm.Stop()
+
+	// Set the tracer.
+	var traces []InstructionTrace
+	mdm.SetInstructionTracer(func(trace InstructionTrace) {
+		traces = append(traces, trace)
+	})
+
+	// Create a program which appends a sector and checks for it afterwards.
+	sectorData := randomSectorData()
+	sectorRoot := crypto.MerkleRoot(sectorData)
+	pt := newTestPriceTable()
+	duration := types.BlockHeight(fastrand.Uint64n(5))
+	tb := newTestProgramBuilder(pt, duration)
+	tb.AddAppendInstruction(sectorData, true)
+	tb.AddHasSectorInstruction(sectorRoot)
+
+	// Execute it.
+	so := host.newTestStorageObligation(true)
+	_, _, outputs, err := mdm.ExecuteProgramWithBuilderManualFinalize(tb, so, duration, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// There should be one trace per output.
+	if len(traces) != len(outputs) || len(traces) != 2 {
+		t.Fatalf("expected %v traces but got %v", len(outputs), len(traces))
+	}
+	var fcid types.FileContractID
+	if revs := so.RevisionTxn().FileContractRevisions; len(revs) > 0 {
+		fcid = revs[0].ParentID
+	}
+	specifiers := []modules.InstructionSpecifier{modules.SpecifierAppend, modules.SpecifierHasSector}
+	for i, trace := range traces {
+		if trace.ContractID != fcid {
+			t.Fatal("wrong contract id", trace.ContractID, fcid)
+		}
+		if trace.Index != i || trace.NumInstructions != 2 {
+			t.Fatal("wrong index", trace.Index, trace.NumInstructions)
+		}
+		if trace.Specifier != specifiers[i] {
+			t.Fatal("wrong specifier", trace.Specifier)
+		}
+		if trace.Cost.IsZero() {
+			t.Fatal("cost shouldn't be zero")
+		}
+		if trace.NewSize != outputs[i].NewSize || trace.NewMerkleRoot != outputs[i].NewMerkleRoot {
+			t.Fatal("trace doesn't match output")
+		}
+		if trace.Err != nil {
+			t.Fatal(trace.Err)
+		}
+	}
+
+	// Disable the tracer again.
+	mdm.SetInstructionTracer(nil)
+	traces = nil
+	tb = newTestProgramBuilder(pt, duration)
+	tb.AddHasSectorInstruction(sectorRoot)
+	_, _, _, err = mdm.ExecuteProgramWithBuilderManualFinalize(tb, so, duration, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(traces) != 0 {
+		t.Fatal("tracer shouldn't be called after being disabled")
+	}
+}
+
+// TestActivePrograms makes sure that the MDM keeps track of the programs that
+// are currently executed.
+func TestActivePrograms(t *testing.T) {
+	host := newTestHost()
+	mdm := New(host)
+	defer mdm.Stop()
+
+	// Use a tracer to block the program after the first instruction.
+	var traced InstructionTrace
+	tracedChan := make(chan struct{})
+	unblock := make(chan struct{})
+	mdm.SetInstructionTracer(func(trace InstructionTrace) {
+		if trace.Index == 0 {
+			traced = trace
+			close(tracedChan)
+			<-unblock
+		}
+	})
+
+	// Create a program which appends a sector and checks for it afterwards.
+	sectorData := randomSectorData()
+	sectorRoot := crypto.MerkleRoot(sectorData)
+	pt := newTestPriceTable()
+	duration := types.BlockHeight(fastrand.Uint64n(5))
+	tb := newTestProgramBuilder(pt, duration)
+	tb.AddAppendInstruction(sectorData, true)
+	tb.AddHasSectorInstruction(sectorRoot)
+
+	// Execute it in the background.
+	so := host.newTestStorageObligation(true)
+	done := make(chan error)
+	go func() {
+		_, _, _, err := mdm.ExecuteProgramWithBuilderManualFinalize(tb, so, duration, true)
+		done <- err
+	}()
+
+	// While blocked, the program should be active.
+	<-tracedChan
+	active := mdm.ActivePrograms()
+	if len(active) != 1 {
+		t.Fatalf("expected %v active programs but got %v", 1, len(active))
+	}
+	ap := active[0]
+	var fcid types.FileContractID
+	if revs := so.RevisionTxn().FileContractRevisions; len(revs) > 0 {
+		fcid = revs[0].ParentID
+	}
+	if ap.ContractID != fcid {
+		t.Fatal("wrong contract id", ap.ContractID, fcid)
+	}
+	if ap.InstructionIndex != 0 || ap.NumInstructions != 2 {
+		t.Fatal("wrong index", ap.InstructionIndex, ap.NumInstructions)
+	}
+	if ap.Started.IsZero() || time.Since(ap.Started) < 0 {
+		t.Fatal("wrong start time", ap.Started)
+	}
+	if ap.ExecutionCost.Cmp(traced.Cost) <= 0 {
+		t.Fatalf("execution cost %v should include the init cost and the instruction cost %v", ap.ExecutionCost, traced.Cost)
+	}
+	if ap.UsedMemory <= modules.MDMInitMemory() {
+		t.Fatal("used memory should include the memory of the instruction", ap.UsedMemory)
+	}
+
+	// Once the program finished, it shouldn't be active anymore.
+	close(unblock)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if active := mdm.ActivePrograms(); len(active) != 0 {
+		t.Fatalf("expected %v active programs but got %v", 0, len(active))
+	}
+}
+
+// TestProgramTimer makes sure that a timer set on the MDM is called with the
+// timing of every executed program.
+func TestProgramTimer(t *testing.T) {
+	host := newTestHost()
+	mdm := New(host)
+	defer mdm.Stop()
+
+	// Set the timer.
+	var timings []ProgramTiming
+	mdm.SetProgramTimer(func(pt ProgramTiming) {
+		timings = append(timings, pt)
+	})
+
+	// Create a program which appends a sector and checks for it afterwards.
+	sectorData := randomSectorData()
+	sectorRoot := crypto.MerkleRoot(sectorData)
+	pt := newTestPriceTable()
+	duration := types.BlockHeight(fastrand.Uint64n(5))
+	tb := newTestProgramBuilder(pt, duration)
+	tb.AddAppendInstruction(sectorData, true)
+	tb.AddHasSectorInstruction(sectorRoot)
+
+	// Execute it.
+	so := host.newTestStorageObligation(true)
+	_, _, _, err := mdm.ExecuteProgramWithBuilderManualFinalize(tb, so, duration, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// There should be one timing with one entry per instruction.
+	if len(timings) != 1 {
+		t.Fatalf("expected %v timings but got %v", 1, len(timings))
+	}
+	timing := timings[0]
+	var fcid types.FileContractID
+	if revs := so.RevisionTxn().FileContractRevisions; len(revs) > 0 {
+		fcid = revs[0].ParentID
+	}
+	if timing.ContractID != fcid {
+		t.Fatal("wrong contract id", timing.ContractID, fcid)
+	}
+	specifiers := []modules.InstructionSpecifier{modules.SpecifierAppend, modules.SpecifierHasSector}
+	estimates := []uint64{modules.MDMTimeAppend, modules.MDMTimeHasSector}
+	if len(timing.Instructions) != len(specifiers) {
+		t.Fatalf("expected %v instruction timings but got %v", len(specifiers), len(timing.Instructions))
+	}
+	var totalDuration time.Duration
+	var totalEstimate uint64
+	for i, it := range timing.Instructions {
+		if it.Specifier != specifiers[i] {
+			t.Fatal("wrong specifier", it.Specifier)
+		}
+		if it.EstimatedTime != estimates[i] {
+			t.Fatal("wrong estimated time", it.EstimatedTime, estimates[i])
+		}
+		totalDuration += it.Duration
+		totalEstimate += it.EstimatedTime
+	}
+	if timing.Duration <= 0 {
+		t.Fatal("duration wasn't measured")
+	}
+	if timing.Duration != totalDuration || timing.EstimatedTime != totalEstimate {
+		t.Fatal("totals don't match the instruction timings", timing.Duration, timing.EstimatedTime)
+	}
+	if timing.EstimatedDuration() != time.Duration(totalEstimate)*EstimatedTimeUnit {
+		t.Fatal("wrong estimated duration", timing.EstimatedDuration())
+	}
+
+	// Disable the timer again.
+	mdm.SetProgramTimer(nil)
+	timings = nil
+	tb = newTestProgramBuilder(pt, duration)
+	tb.AddHasSectorInstruction(sectorRoot)
+	_, _, _, err = mdm.ExecuteProgramWithBuilderManualFinalize(tb, so, duration, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(timings) != 0 {
+		t.Fatal("timer shouldn't be called after being disabled")
+	}
+}
+
+// TestReadMetrics tests that the MDM meters the sector data read by programs
+// and distinguishes between gained sectors and sectors read from disk.
+func TestReadMetrics(t *testing.T) {
+	host := newTestHost()
+	mdm := New(host)
+	defer mdm.Stop()
+
+	// Prepare a storage obligation with a few sectors.
+	so := host.newTestStorageObligation(true)
+	so.AddRandomSectors(3)
+
+	// Create a program which appends a sector, reads it and then reads all of
+	// the sectors already stored by the host.
+	sectorData := randomSectorData()
+	sectorRoot := crypto.MerkleRoot(sectorData)
+	pt := newTestPriceTable()
+	duration := types.BlockHeight(fastrand.Uint64n(5))
+	tb := newTestProgramBuilder(pt, duration)
+	tb.AddAppendInstruction(sectorData, false)
+	tb.AddReadSectorInstruction(modules.SectorSize, 0, sectorRoot, false)
+	for _, root := range so.sectorRoots {
+		tb.AddReadSectorInstruction(modules.SectorSize, 0, root, false)
+	}
+
+	// Execute it.
+	_, _, outputs, err := mdm.ExecuteProgramWithBuilderManualFinalize(tb, so, duration, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, output := range outputs {
+		if output.Error != nil {
+			t.Fatal(output.Error)
+		}
+	}
+
+	// Check the metered bytes.
+	expected := ReadMetrics{
+		CacheBytes: modules.SectorSize,
+		DiskBytes:  3 * modules.SectorSize,
+	}
+	if rm := mdm.ReadMetrics(); rm != expected {
+		t.Fatalf("expected %v but got %v", expected, rm)
+	}
+
+	// Programs that are not executed on a contract are only reflected in the
+	// totals.
+	if rm := mdm.ContractReadMetrics(types.FileContractID{}); rm != (ReadMetrics{}) {
+		t.Fatal("expected no contract metrics", rm)
+	}
+
+	// Record some reads for a contract.
+	var fcid types.FileContractID
+	fastrand.Read(fcid[:])
+	mdm.recordReads(fcid, ReadMetrics{CacheBytes: 1, DiskBytes: 2})
+	mdm.recordReads(fcid, ReadMetrics{CacheBytes: 3, DiskBytes: 4})
+	if rm := mdm.ContractReadMetrics(fcid); rm != (ReadMetrics{CacheBytes: 4, DiskBytes: 6}) {
+		t.Fatal("unexpected contract metrics", rm)
+	}
+	expected.CacheBytes += 4
+	expected.DiskBytes += 6
+	if rm := mdm.ReadMetrics(); rm != expected {
+		t.Fatalf("expected %v but got %v", expected, rm)
+	}
+
+	// Removing the contract's metrics drops its entry but keeps the totals.
+	mdm.RemoveContractReadMetrics(fcid)
+	if _, exists := mdm.contractReads[fcid]; exists {
+		t.Fatal("contract metrics weren't removed")
+	}
+	if rm := mdm.ReadMetrics(); rm != expected {
+		t.Fatalf("expected %v but got %v", expected, rm)
+	}
+}
+
+// TestProgramReleaseFlushedSectors tests that the sectors flushed by a program
+// are released once the program is finalized or its caller is done with it.
+func TestProgramReleaseFlushedSectors(t *testing.T) {
+	host := newTestHost()
+	flusher := &testSectorFlusher{sectors: make(map[crypto.Hash][]byte)}
+	mdm := NewCustomMDM(host, modules.SectorSize, flusher)
+
+	// executeAppends executes a program which appends 3 sectors, 2 of which
+	// exceed the memory ceiling and are flushed.
+	pt := newTestPriceTable()
+	duration := types.BlockHeight(1)
+	executeAppends := func(so *TestStorageObligation) FnFinalize {
+		tb := newTestProgramBuilder(pt, duration)
+		for i := 0; i < 3; i++ {
+			tb.AddAppendInstruction(randomSectorData(), false)
+		}
+		finalize, _, _, err := mdm.ExecuteProgramWithBuilderManualFinalize(tb, so, duration, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := flusher.numFlushed(); n != 2 {
+			t.Fatal("expected 2 flushed sectors but got", n)
+		}
+		return finalize
+	}
+
+	// Finalizing the program releases the flushed sectors.
+	so := host.newTestStorageObligation(true)
+	finalize := executeAppends(so)
+	if err := finalize(so); err != nil {
+		t.Fatal(err)
+	}
+	if n := flusher.numFlushed(); n != 0 {
+		t.Fatal("expected flushed sectors to be released", n)
+	}
+	// The flushed sectors are passed to the storage obligation without their
+	// data.
+	var flushed int
+	for _, data := range so.sectorMap {
+		if data == nil {
+			flushed++
+		}
+	}
+	if len(so.sectorMap) != 3 || flushed != 2 {
+		t.Fatal("unexpected gained sectors", len(so.sectorMap), flushed)
+	}
+
+	// A program that isn't finalized releases its flushed sectors once the
+	// MDM shuts down.
+	executeAppends(host.newTestStorageObligation(true))
+	if err := mdm.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	err := build.Retry(100, 10*time.Millisecond, func() error {
+		if n := flusher.numFlushed(); n != 0 {
+			return fmt.Errorf("%v flushed sectors weren't released", n)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
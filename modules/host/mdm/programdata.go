@@ -7,6 +7,7 @@ import (
 	"io"
 	"sort"
 	"sync"
+	"time"
 
 	"gitlab.com/NebulousLabs/Sia/build"
 	"gitlab.com/NebulousLabs/Sia/crypto"
@@ -15,6 +16,27 @@ import (
 	"gitlab.com/NebulousLabs/encoding"
 )
 
+var (
+	// DefaultProgramDataTimeout is the default amount of time a program waits
+	// for the next packet of program data before giving up.
+	DefaultProgramDataTimeout = build.Select(build.Var{
+		Dev:      time.Minute,
+		Standard: time.Minute,
+		Testing:  10 * time.Second,
+	}).(time.Duration)
+
+	// ErrProgramDataTimeout is returned when reading program data which
+	// didn't arrive because the reader stalled for longer than the program
+	// data timeout.
+	ErrProgramDataTimeout = errors.New("timed out waiting for program data")
+)
+
+// readDeadliner is implemented by readers, like the host's streams, whose
+// blocking reads can be interrupted by setting a read deadline.
+type readDeadliner interface {
+	SetReadDeadline(time.Time) error
+}
+
 // programData is a buffer for the program data. It will read packets from r and
 // append them to data.
 type programData struct {
@@ -26,9 +48,24 @@ type programData struct {
 	// the reader. Less data will be considered an unexpected EOF.
 	staticLength uint64
 
+	// staticTimeout is the maximum amount of time to wait for the next packet
+	// of data. The idleTimer fires if no data was read for that long. A
+	// timeout of 0 disables the timer.
+	staticTimeout time.Duration
+	idleTimer     *time.Timer
+
 	// readErr contains the first error encountered by threadedFetchData.
 	readErr error
 
+	// staticReader is the reader the data is fetched from. fetching is true
+	// while threadedFetchData is running. If the reader supports read
+	// deadlines, every read is limited by the timeout and a blocked read is
+	// interrupted when the timeout fires or the programData is closed. The
+	// programData doesn't own the reader, which means that the owner needs to
+	// reset the read deadline after closing the programData.
+	staticReader io.Reader
+	fetching     bool
+
 	// requests are queued up calls to 'bytes' waiting for the requested data to
 	// arrive.
 	requests []dataRequest
@@ -48,20 +85,50 @@ type dataRequest struct {
 }
 
 // openProgramData creates a new programData object from the specified reader. It
-// will read from the reader until dataLength is reached.
-func openProgramData(r io.Reader, dataLength uint64) *programData {
+// will read from the reader until dataLength is reached. If the reader doesn't
+// provide any data for the given timeout, all pending and future reads of data
+// that hasn't arrived yet fail with ErrProgramDataTimeout. If the reader
+// supports read deadlines, a blocked read is interrupted when the timeout fires
+// or the programData is closed. The caller is responsible for resetting the
+// read deadline once Close returned.
+func openProgramData(r io.Reader, dataLength uint64, timeout time.Duration) *programData {
 	pd := &programData{
-		cancel:       make(chan struct{}),
-		staticLength: dataLength,
+		cancel:        make(chan struct{}),
+		staticLength:  dataLength,
+		staticTimeout: timeout,
+		staticReader:  r,
+		fetching:      true,
+	}
+	if timeout > 0 && dataLength > 0 {
+		pd.idleTimer = time.AfterFunc(timeout, pd.managedTimeout)
 	}
 	pd.wg.Add(1)
 	go func() {
 		defer pd.wg.Done()
+		defer pd.managedStopFetching()
 		pd.threadedFetchData(r)
 	}()
 	return pd
 }
 
+// interruptRead interrupts a read of threadedFetchData that is blocked on the
+// reader. It needs to be called while holding the lock.
+func (pd *programData) interruptRead() {
+	rd, ok := pd.staticReader.(readDeadliner)
+	if !ok || !pd.fetching {
+		return
+	}
+	_ = rd.SetReadDeadline(time.Now())
+}
+
+// managedStopFetching is called when threadedFetchData returns. Afterwards the
+// read deadline of the reader is no longer touched.
+func (pd *programData) managedStopFetching() {
+	pd.mu.Lock()
+	defer pd.mu.Unlock()
+	pd.fetching = false
+}
+
 // threadedFetchData fetches the program's data from the underlying reader of
 // the ProgramData. It will read from the reader until io.EOF is reached or
 // until the maximum number of packets are read.
@@ -71,12 +138,7 @@ func (pd *programData) threadedFetchData(r io.Reader) {
 	quit := func(err error) {
 		pd.mu.Lock()
 		defer pd.mu.Unlock()
-		// Remember the error and close all open requests before stopping
-		// the loop.
-		pd.readErr = err
-		for _, r := range pd.requests {
-			close(r.c)
-		}
+		pd.fail(err)
 	}
 	for remainingData > 0 {
 		pd.mu.Lock()
@@ -87,13 +149,30 @@ func (pd *programData) threadedFetchData(r io.Reader) {
 			return
 		default:
 		}
+		// Stop reading if the reader timed out.
+		if pd.readErr != nil {
+			pd.mu.Unlock()
+			return
+		}
+		// Limit the time the next read may block if the reader supports it.
+		// Not all readers allow for interrupting a read that is already
+		// blocked.
+		rd, limited := r.(readDeadliner)
+		limited = limited && pd.staticTimeout > 0
+		if limited {
+			_ = rd.SetReadDeadline(time.Now().Add(pd.staticTimeout))
+		}
 		pd.mu.Unlock()
 		// Adjust the length of the packet according to the remaining data.
 		d := packet[:]
 		if remainingData <= int64(cap(d)) {
 			d = d[:remainingData]
 		}
+		start := time.Now()
 		n, err := r.Read(d)
+		if err != nil && limited && time.Since(start) >= pd.staticTimeout {
+			err = ErrProgramDataTimeout
+		}
 		if err != nil {
 			quit(err)
 			return
@@ -102,6 +181,16 @@ func (pd *programData) threadedFetchData(r io.Reader) {
 		pd.mu.Lock()
 		pd.data = append(pd.data, packet[:n]...)
 
+		// Reset the idle timer after a successful read and stop it once all
+		// the data was read.
+		if pd.idleTimer != nil && pd.readErr == nil {
+			if remainingData > 0 {
+				pd.idleTimer.Reset(pd.staticTimeout)
+			} else {
+				pd.idleTimer.Stop()
+			}
+		}
+
 		// Sort the request and unlock the ones that are ready to be unlocked.
 		sort.Slice(pd.requests, func(i, j int) bool {
 			return pd.requests[i].requiredLength < pd.requests[j].requiredLength
@@ -118,6 +207,33 @@ func (pd *programData) threadedFetchData(r io.Reader) {
 	}
 }
 
+// fail remembers the first error encountered while reading the program data
+// and closes all open requests. It needs to be called while holding the lock.
+func (pd *programData) fail(err error) {
+	if pd.readErr == nil {
+		pd.readErr = err
+	}
+	for _, r := range pd.requests {
+		close(r.c)
+	}
+	pd.requests = nil
+	if pd.idleTimer != nil {
+		pd.idleTimer.Stop()
+	}
+}
+
+// managedTimeout is called by the idle timer when no data was read within the
+// timeout.
+func (pd *programData) managedTimeout() {
+	pd.mu.Lock()
+	defer pd.mu.Unlock()
+	if uint64(len(pd.data)) >= pd.staticLength {
+		return // all data was read
+	}
+	pd.fail(ErrProgramDataTimeout)
+	pd.interruptRead()
+}
+
 // managedBytes tries to fetch length bytes at offset from the underlying data
 // slice of the programData. If the data is not available yet, a request will be
 // queued up and the method will block for the data to be read.
@@ -223,6 +339,10 @@ func (pd *programData) Len() uint64 {
 func (pd *programData) Close() error {
 	pd.mu.Lock()
 	close(pd.cancel)
+	if pd.idleTimer != nil {
+		pd.idleTimer.Stop()
+	}
+	pd.interruptRead()
 	pd.mu.Unlock()
 	pd.wg.Wait()
 	return nil
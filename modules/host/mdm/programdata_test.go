@@ -2,11 +2,17 @@ package mdm
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
 	"io"
+	"net"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"gitlab.com/NebulousLabs/Sia/crypto"
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/types"
 	"gitlab.com/NebulousLabs/errors"
 	"gitlab.com/NebulousLabs/fastrand"
 )
@@ -14,7 +20,7 @@ import (
 // TestNewProgramData tests starting and stopping a ProgramData object.
 func TestNewProgramData(t *testing.T) {
 	buf := bytes.NewReader(fastrand.Bytes(10))
-	pd := openProgramData(buf, uint64(buf.Len()))
+	pd := openProgramData(buf, uint64(buf.Len()), 0)
 	defer func() {
 		if err := pd.Close(); err != nil {
 			t.Fatal(err)
@@ -27,7 +33,7 @@ func TestNewProgramData(t *testing.T) {
 func TestHash(t *testing.T) {
 	data := fastrand.Bytes(1000)
 	buf := bytes.NewReader(data)
-	pd := openProgramData(buf, uint64(len(data)))
+	pd := openProgramData(buf, uint64(len(data)), 0)
 	for i := 0; i < 1000; i++ {
 		offset := fastrand.Intn(len(data) - crypto.HashSize + 1)
 		h, err := pd.Hash(uint64(offset))
@@ -50,7 +56,7 @@ func TestHash(t *testing.T) {
 func TestUint64(t *testing.T) {
 	data := fastrand.Bytes(1000)
 	buf := bytes.NewReader(data)
-	pd := openProgramData(buf, uint64(len(data)))
+	pd := openProgramData(buf, uint64(len(data)), 0)
 	for i := 0; i < 1000; i++ {
 		offset := fastrand.Intn(len(data) - 8 + 1)
 		n, err := pd.Uint64(uint64(offset))
@@ -71,7 +77,7 @@ func TestUint64(t *testing.T) {
 // TestOutOfBounds tests the out-of-bounds check.
 func TestOutOfBounds(t *testing.T) {
 	buf := bytes.NewReader(fastrand.Bytes(8))
-	pd := openProgramData(buf, 7)
+	pd := openProgramData(buf, 7, 0)
 	_, err := pd.managedBytes(0, 8)
 	if err == nil {
 		t.Fatal("managedBytes should fail")
@@ -87,7 +93,7 @@ func TestOutOfBounds(t *testing.T) {
 // returned.
 func TestEOFWhileReading(t *testing.T) {
 	r := bytes.NewReader(fastrand.Bytes(7))
-	pd := openProgramData(r, 8)
+	pd := openProgramData(r, 8, 0)
 	cont := make(chan struct{})
 	go func() {
 		<-cont
@@ -103,3 +109,200 @@ func TestEOFWhileReading(t *testing.T) {
 	}
 	close(cont)
 }
+
+// TestProgramDataTimeout tests that reads fail with ErrProgramDataTimeout if
+// the reader goes silent before all the program data was read.
+func TestProgramDataTimeout(t *testing.T) {
+	data := fastrand.Bytes(16)
+	r, w := net.Pipe()
+	defer func() {
+		if err := errors.Compose(r.Close(), w.Close()); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	pd := openProgramData(r, uint64(len(data)), 100*time.Millisecond)
+
+	// Write the first half of the data and then go silent.
+	go func() {
+		if _, err := w.Write(data[:8]); err != nil {
+			t.Error(err)
+		}
+	}()
+	if _, err := pd.Uint64(0); err != nil {
+		t.Fatal(err)
+	}
+	// Reading the second half should time out.
+	if _, err := pd.Uint64(8); !errors.Contains(err, ErrProgramDataTimeout) {
+		t.Fatalf("expected %v but got %v", ErrProgramDataTimeout, err)
+	}
+	// Future reads should fail right away.
+	start := time.Now()
+	if _, err := pd.Bytes(8, 8); !errors.Contains(err, ErrProgramDataTimeout) {
+		t.Fatalf("expected %v but got %v", ErrProgramDataTimeout, err)
+	}
+	if time.Since(start) > 50*time.Millisecond {
+		t.Fatal("read after timeout should fail right away")
+	}
+	// Data that already arrived can still be read.
+	if _, err := pd.Uint64(0); err != nil {
+		t.Fatal(err)
+	}
+
+	// Closing the program data shouldn't wait for the silent writer.
+	start = time.Now()
+	if err := pd.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(start) > time.Second {
+		t.Fatal("closing the program data took too long", time.Since(start))
+	}
+
+	// Once the program data is closed, the caller owns the read deadline
+	// again. Resetting it leaves the reader usable.
+	if err := r.SetReadDeadline(time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		if _, err := w.Write(data[8:]); err != nil {
+			t.Error(err)
+		}
+	}()
+	b := make([]byte, 8)
+	if _, err := io.ReadFull(r, b); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, data[8:]) {
+		t.Fatal("data doesn't match")
+	}
+}
+
+// TestProgramDataCloseBlocked tests that closing the program data interrupts a
+// read that is blocked on a silent reader, even without a timeout.
+func TestProgramDataCloseBlocked(t *testing.T) {
+	r, w := net.Pipe()
+	defer func() {
+		if err := errors.Compose(r.Close(), w.Close()); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	pd := openProgramData(r, 8, 0)
+
+	// Give the background thread time to block on the reader.
+	time.Sleep(50 * time.Millisecond)
+
+	done := make(chan error)
+	go func() {
+		done <- pd.Close()
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("closing the program data blocked on the reader")
+	}
+	if _, err := pd.Uint64(0); err == nil {
+		t.Fatal("expected reading the missing data to fail")
+	}
+}
+
+// TestProgramDataTimeoutReset tests that the timeout is reset after every
+// successful read.
+func TestProgramDataTimeoutReset(t *testing.T) {
+	data := fastrand.Bytes(80)
+	r, w := io.Pipe()
+	pd := openProgramData(r, uint64(len(data)), 200*time.Millisecond)
+	defer func() {
+		if err := pd.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	// Slowly write the data. The total time exceeds the timeout but the time
+	// between writes doesn't.
+	go func() {
+		for i := 0; i < len(data); i += 8 {
+			time.Sleep(50 * time.Millisecond)
+			if _, err := w.Write(data[i : i+8]); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	b, err := pd.Bytes(0, uint64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, data) {
+		t.Fatal("data doesn't match")
+	}
+}
+
+// deadlineRecorder is a reader which counts the calls to SetReadDeadline. The
+// calls are delayed to make it observable if one of them happens after the
+// program's outputs were received.
+type deadlineRecorder struct {
+	net.Conn
+	atomicDeadlines uint64
+}
+
+// SetReadDeadline implements the readDeadliner interface.
+func (dr *deadlineRecorder) SetReadDeadline(t time.Time) error {
+	time.Sleep(50 * time.Millisecond)
+	atomic.AddUint64(&dr.atomicDeadlines, 1)
+	return dr.Conn.SetReadDeadline(t)
+}
+
+// TestProgramDataDeadlineAfterOutputs tests that the program data doesn't
+// touch the read deadline of the reader anymore once all outputs of the
+// program were received.
+func TestProgramDataDeadlineAfterOutputs(t *testing.T) {
+	host := newTestHost()
+	mdm := New(host)
+	defer mdm.Stop()
+
+	// Build a program which doesn't need all of its declared program data.
+	pt := newTestPriceTable()
+	so := host.newTestStorageObligation(true)
+	duration := types.BlockHeight(fastrand.Uint64n(5))
+	tb := newTestProgramBuilder(pt, duration)
+	tb.AddHasSectorInstruction(crypto.Hash{})
+	program, programData := tb.Program()
+
+	// Only send the program data the instruction needs, the rest never
+	// arrives.
+	r, w := net.Pipe()
+	defer func() {
+		if err := errors.Compose(r.Close(), w.Close()); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	go func() {
+		if _, err := w.Write(programData); err != nil {
+			t.Error(err)
+		}
+	}()
+	dr := &deadlineRecorder{Conn: r}
+	budget := modules.NewBudget(types.SiacoinPrecision)
+	_, outputs, err := mdm.ExecuteProgram(context.Background(), pt, program, budget, types.ZeroCurrency, so, duration, uint64(len(programData))+8, dr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for output := range outputs {
+		if output.Error != nil {
+			t.Fatal(output.Error)
+		}
+	}
+
+	// The blocked read was interrupted before the outputs were closed, the
+	// deadline isn't touched afterwards.
+	deadlines := atomic.LoadUint64(&dr.atomicDeadlines)
+	if deadlines == 0 {
+		t.Fatal("blocked read wasn't interrupted")
+	}
+	time.Sleep(200 * time.Millisecond)
+	if atomic.LoadUint64(&dr.atomicDeadlines) != deadlines {
+		t.Fatal("read deadline was set after all outputs were received")
+	}
+}
@@ -5,14 +5,64 @@ import (
 
 	"gitlab.com/NebulousLabs/Sia/crypto"
 	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/errors"
 )
 
+// ErrGainedSectorsMemoryExceeded is returned when the data of the sectors
+// gained by a program exceeds the memory ceiling and there is no
+// SectorFlusher to move it out of memory.
+var ErrGainedSectorsMemoryExceeded = errors.New("memory of gained sectors exceeds the ceiling")
+
+// ErrSectorRootMismatch is returned when the data the host returned for a
+// sector doesn't match the sector's merkle root.
+var ErrSectorRootMismatch = errors.New("sector data read from the host doesn't match its root")
+
+// errSectorsDiverged is returned when the gained or removed sectors of the
+// program cache don't match the list of sector roots.
+var errSectorsDiverged = errors.New("program cache diverged from the sector roots")
+
+// SectorFlusher is used by the program cache to move the data of gained sectors
+// out of memory once the gained sectors exceed their memory ceiling.
+type SectorFlusher interface {
+	// FlushSector stores the data of a sector outside of memory.
+	FlushSector(root crypto.Hash, data []byte) error
+	// ReadFlushedSector reads the data of a previously flushed sector.
+	ReadFlushedSector(root crypto.Hash) ([]byte, error)
+	// RemoveFlushedSector releases a previous flush of a sector. Its data may
+	// be deleted once every flush of the sector was released.
+	RemoveFlushedSector(root crypto.Hash) error
+}
+
 // sectors contains the program cache, including gained and removed sectors as
 // well as the list of sector roots.
 type sectors struct {
 	sectorsRemoved map[crypto.Hash]struct{}
 	sectorsGained  map[crypto.Hash][]byte
 	merkleRoots    []crypto.Hash
+
+	// sharedMaps indicates that sectorsRemoved and sectorsGained might be
+	// referenced by a clone and need to be copied before being modified.
+	sharedMaps bool
+
+	// gainedBytes is the amount of sector data held in memory by
+	// sectorsGained. If maxGainedBytes is not 0 and appending a sector would
+	// exceed it, the sector's data is flushed using the flusher instead and
+	// sectorsGained contains a nil entry for the sector.
+	gainedBytes    uint64
+	maxGainedBytes uint64
+	flusher        SectorFlusher
+
+	// flushed contains the roots of all sectors flushed by the program. It is
+	// shared between clones since they belong to the same program and the
+	// flushes are only released once the program is done.
+	flushed map[crypto.Hash]struct{}
+
+	// verifyReads indicates whether the merkle root of the sector data read
+	// from the host is recomputed and compared to the requested root.
+	verifyReads bool
+
+	// reads meters the sector data read by the program.
+	reads ReadMetrics
 }
 
 // newSectors creates a program cache given an initial list of sector roots.
@@ -21,9 +71,48 @@ func newSectors(roots []crypto.Hash) sectors {
 		sectorsRemoved: make(map[crypto.Hash]struct{}),
 		sectorsGained:  make(map[crypto.Hash][]byte),
 		merkleRoots:    roots,
+		flushed:        make(map[crypto.Hash]struct{}),
 	}
 }
 
+// Clone returns a copy of the program cache which can be modified without
+// affecting the original and vice versa. The merkle roots are copied right
+// away while the maps of gained and removed sectors are only copied once
+// either of the caches modifies them.
+func (s *sectors) Clone() sectors {
+	s.sharedMaps = true
+	return sectors{
+		sectorsRemoved: s.sectorsRemoved,
+		sectorsGained:  s.sectorsGained,
+		merkleRoots:    append([]crypto.Hash(nil), s.merkleRoots...),
+		sharedMaps:     true,
+		gainedBytes:    s.gainedBytes,
+		maxGainedBytes: s.maxGainedBytes,
+		flusher:        s.flusher,
+		flushed:        s.flushed,
+		verifyReads:    s.verifyReads,
+	}
+}
+
+// unshareMaps copies the maps of gained and removed sectors if they might be
+// shared with a clone. It needs to be called before modifying them.
+func (s *sectors) unshareMaps() {
+	if !s.sharedMaps {
+		return
+	}
+	sectorsRemoved := make(map[crypto.Hash]struct{}, len(s.sectorsRemoved))
+	for root := range s.sectorsRemoved {
+		sectorsRemoved[root] = struct{}{}
+	}
+	sectorsGained := make(map[crypto.Hash][]byte, len(s.sectorsGained))
+	for root, data := range s.sectorsGained {
+		sectorsGained[root] = data
+	}
+	s.sectorsRemoved = sectorsRemoved
+	s.sectorsGained = sectorsGained
+	s.sharedMaps = false
+}
+
 // appendSector adds the data to the program cache and returns the new merkle
 // root.
 func (s *sectors) appendSector(sectorData []byte) (crypto.Hash, error) {
@@ -33,13 +122,29 @@ func (s *sectors) appendSector(sectorData []byte) (crypto.Hash, error) {
 	newRoot := crypto.MerkleRoot(sectorData)
 
 	// Update the program cache.
+	s.unshareMaps()
 	_, removed := s.sectorsRemoved[newRoot]
+	_, gained := s.sectorsGained[newRoot]
 	if removed {
 		// If the sector has been marked as removed, unmark it.
 		delete(s.sectorsRemoved, newRoot)
-	} else {
-		// Add the sector to the cache.
+	} else if !gained {
+		// Add the sector to the cache. If that exceeds the memory ceiling,
+		// flush the data instead.
+		if s.maxGainedBytes > 0 && s.gainedBytes+uint64(len(sectorData)) > s.maxGainedBytes {
+			if s.flusher == nil {
+				return crypto.Hash{}, ErrGainedSectorsMemoryExceeded
+			}
+			if _, flushed := s.flushed[newRoot]; !flushed {
+				if err := s.flusher.FlushSector(newRoot, sectorData); err != nil {
+					return crypto.Hash{}, errors.AddContext(err, "failed to flush gained sector")
+				}
+				s.flushed[newRoot] = struct{}{}
+			}
+			sectorData = nil
+		}
 		s.sectorsGained[newRoot] = sectorData
+		s.gainedBytes += uint64(len(sectorData))
 	}
 
 	// Update the roots.
@@ -63,11 +168,13 @@ func (s *sectors) dropSectors(numSectorsDropped uint64) (crypto.Hash, error) {
 	s.merkleRoots = s.merkleRoots[:newNumSectors]
 
 	// Update the program cache.
+	s.unshareMaps()
 	for _, droppedRoot := range droppedRoots {
-		_, gained := s.sectorsGained[droppedRoot]
+		data, gained := s.sectorsGained[droppedRoot]
 		if gained {
 			// Remove the sectors from the cache.
 			delete(s.sectorsGained, droppedRoot)
+			s.gainedBytes -= uint64(len(data))
 		} else {
 			// Mark the sectors as removed in the cache.
 			s.sectorsRemoved[droppedRoot] = struct{}{}
@@ -78,6 +185,41 @@ func (s *sectors) dropSectors(numSectorsDropped uint64) (crypto.Hash, error) {
 	return cachedMerkleRoot(s.merkleRoots), nil
 }
 
+// dropSectorsWithProof drops the specified number of sectors like dropSectors
+// but also returns a diff proof over the dropped tail [newNumSectors,
+// oldNumSectors) of the sector roots as well as the dropped roots. The proof
+// together with the dropped roots verifies the merkle root before the drop
+// while the proof on its own verifies the new merkle root.
+func (s *sectors) dropSectorsWithProof(numSectorsDropped uint64) (crypto.Hash, []crypto.Hash, []crypto.Hash, error) {
+	oldNumSectors := uint64(len(s.merkleRoots))
+	if numSectorsDropped > oldNumSectors {
+		return crypto.Hash{}, nil, nil, fmt.Errorf("trying to drop %v sectors which is more than the amount of sectors (%v)", numSectorsDropped, oldNumSectors)
+	}
+	newNumSectors := oldNumSectors - numSectorsDropped
+
+	// Construct the proof before updating the roots.
+	ranges := dropSectorsProofRanges(newNumSectors, oldNumSectors)
+	proof := crypto.MerkleDiffProof(ranges, oldNumSectors, nil, s.merkleRoots)
+	droppedRoots := append([]crypto.Hash(nil), s.merkleRoots[newNumSectors:]...)
+
+	newRoot, err := s.dropSectors(numSectorsDropped)
+	if err != nil {
+		return crypto.Hash{}, nil, nil, err
+	}
+	return newRoot, proof, droppedRoots, nil
+}
+
+// dropSectorsProofRanges returns the proof ranges of a diff proof for dropping
+// the sectors [newNumSectors, oldNumSectors). Every dropped sector gets its
+// own range since the dropped roots are used as the leaf hashes of the proof.
+func dropSectorsProofRanges(newNumSectors, oldNumSectors uint64) []crypto.ProofRange {
+	ranges := make([]crypto.ProofRange, 0, oldNumSectors-newNumSectors)
+	for i := newNumSectors; i < oldNumSectors; i++ {
+		ranges = append(ranges, crypto.ProofRange{Start: i, End: i + 1})
+	}
+	return ranges
+}
+
 // hasSector checks if the given root exists, first checking the program cache
 // and then querying the host.
 func (s *sectors) hasSector(sectorRoot crypto.Hash) bool {
@@ -118,10 +260,64 @@ func (s *sectors) translateOffset(offset uint64) (uint64, uint64, error) {
 // readSector reads data from the given root, returning the entire sector.
 func (s *sectors) readSector(host Host, sectorRoot crypto.Hash) ([]byte, error) {
 	// The root exists. First check the gained sectors.
-	if data, exists := s.sectorsGained[sectorRoot]; exists {
+	if data, exists := s.sectorsGained[sectorRoot]; exists && data != nil {
+		s.reads.CacheBytes += uint64(len(data))
 		return data, nil
+	} else if exists {
+		data, err := s.flusher.ReadFlushedSector(sectorRoot)
+		s.reads.CacheBytes += uint64(len(data))
+		return data, err
 	}
 
 	// Check the host.
-	return host.ReadSector(sectorRoot)
+	data, err := host.ReadSector(sectorRoot)
+	s.reads.DiskBytes += uint64(len(data))
+	if err != nil {
+		return nil, err
+	}
+	if s.verifyReads {
+		if root := crypto.MerkleRoot(data); root != sectorRoot {
+			return nil, errors.AddContext(ErrSectorRootMismatch, fmt.Sprintf("host returned data with root %v for sector %v", root, sectorRoot))
+		}
+	}
+	return data, nil
+}
+
+// checkConsistency checks that the program cache matches the sector roots.
+// Every gained sector needs to be part of the roots, since dropping a gained
+// sector removes it from the cache. Removed sectors aren't checked since a
+// contract can contain the same root more than once and dropping one copy
+// marks the root as removed while the other copies remain. It also checks that
+// gainedBytes matches the data held in memory. The check is linear in the
+// number of roots which is why it is only run after every instruction in
+// testing builds.
+func (s *sectors) checkConsistency() error {
+	roots := make(map[crypto.Hash]struct{}, len(s.merkleRoots))
+	for _, root := range s.merkleRoots {
+		roots[root] = struct{}{}
+	}
+	var gainedBytes uint64
+	for root, data := range s.sectorsGained {
+		if _, exists := roots[root]; !exists {
+			return errors.AddContext(errSectorsDiverged, fmt.Sprintf("gained sector %v is not part of the roots", root))
+		}
+		gainedBytes += uint64(len(data))
+	}
+	if gainedBytes != s.gainedBytes {
+		return errors.AddContext(errSectorsDiverged, fmt.Sprintf("gained sectors hold %v bytes but %v were expected", gainedBytes, s.gainedBytes))
+	}
+	return nil
+}
+
+// releaseFlushedSectors releases all sectors flushed by the program. It needs
+// to be called once the program is finalized or aborted.
+func (s *sectors) releaseFlushedSectors() error {
+	var errs []error
+	for root := range s.flushed {
+		if err := s.flusher.RemoveFlushedSector(root); err != nil {
+			errs = append(errs, errors.AddContext(err, fmt.Sprintf("failed to release flushed sector %v", root)))
+		}
+		delete(s.flushed, root)
+	}
+	return errors.Compose(errs...)
 }
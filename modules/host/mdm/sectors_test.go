@@ -3,10 +3,12 @@ package mdm
 import (
 	"bytes"
 	"reflect"
+	"sync"
 	"testing"
 
 	"gitlab.com/NebulousLabs/Sia/crypto"
 	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/errors"
 	"gitlab.com/NebulousLabs/fastrand"
 )
 
@@ -244,6 +246,57 @@ func TestDropSectors(t *testing.T) {
 	}
 }
 
+// TestDropSectorsWithProof tests that the proof returned when dropping sectors
+// covers exactly the dropped tail of the sector roots.
+func TestDropSectorsWithProof(t *testing.T) {
+	for _, numDropped := range []uint64{1, 3, initialContractSectors - 1} {
+		// Initialize the sectors.
+		sectorRoots := randomSectorRoots(initialContractSectors)
+		oldRoot := cachedMerkleRoot(sectorRoots)
+		s := newSectors(append([]crypto.Hash(nil), sectorRoots...))
+
+		// Drop the sectors.
+		newRoot, proof, droppedRoots, err := s.dropSectorsWithProof(numDropped)
+		if err != nil {
+			t.Fatal(err)
+		}
+		newNumSectors := uint64(initialContractSectors) - numDropped
+		if newRoot != cachedMerkleRoot(sectorRoots[:newNumSectors]) {
+			t.Fatal("unexpected merkle root")
+		}
+		if !reflect.DeepEqual(droppedRoots, sectorRoots[newNumSectors:]) {
+			t.Fatal("unexpected dropped roots")
+		}
+
+		// The proof should be the same as the one the renter expects.
+		expectedProof := crypto.MerkleSectorRangeProof(sectorRoots, int(newNumSectors), initialContractSectors)
+		if !reflect.DeepEqual(proof, expectedProof) {
+			t.Fatal("unexpected proof")
+		}
+
+		// The proof and the dropped roots should verify the old root.
+		ranges := dropSectorsProofRanges(newNumSectors, initialContractSectors)
+		if !crypto.VerifyDiffProof(ranges, initialContractSectors, proof, droppedRoots, oldRoot) {
+			t.Fatal("failed to verify old root")
+		}
+		// The proof alone should verify the new root.
+		if !crypto.VerifyDiffProof(nil, newNumSectors, proof, nil, newRoot) {
+			t.Fatal("failed to verify new root")
+		}
+		// Modifying a dropped root shouldn't verify.
+		droppedRoots[0] = randomSector()
+		if crypto.VerifyDiffProof(ranges, initialContractSectors, proof, droppedRoots, oldRoot) {
+			t.Fatal("proof verified with wrong dropped root")
+		}
+	}
+
+	// Dropping too many sectors should fail.
+	s := newSectors(randomSectorRoots(initialContractSectors))
+	if _, _, _, err := s.dropSectorsWithProof(initialContractSectors + 1); err == nil {
+		t.Fatal("expected error when dropping too many sectors")
+	}
+}
+
 // TestHasSector tests checking if a sector exists in the cache or host.
 func TestHasSector(t *testing.T) {
 	// Initialize the sectors.
@@ -306,3 +359,314 @@ func TestReadSector(t *testing.T) {
 		}
 	}
 }
+
+// TestReadSectorVerify tests that reading a sector from a host which returns
+// data that doesn't match the sector's root fails if the reads are verified.
+func TestReadSectorVerify(t *testing.T) {
+	// Initialize a host which returns the wrong data for one of its sectors.
+	data := fastrand.Bytes(int(modules.SectorSize))
+	root := crypto.MerkleRoot(data)
+	corruptRoot := randomSector()
+	host := newCustomTestHost(false)
+	host.sectors = map[crypto.Hash][]byte{
+		root:        data,
+		corruptRoot: data,
+	}
+	s := newSectors([]crypto.Hash{root, corruptRoot})
+
+	// Without verification the corrupt sector is returned.
+	if _, err := s.readSector(host, corruptRoot); err != nil {
+		t.Fatal(err)
+	}
+
+	// With verification only the valid sector can be read.
+	s.verifyReads = true
+	readData, err := s.readSector(host, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(readData, data) {
+		t.Fatal("wrong data")
+	}
+	_, err = s.readSector(host, corruptRoot)
+	if !errors.Contains(err, ErrSectorRootMismatch) {
+		t.Fatal("expected ErrSectorRootMismatch but got", err)
+	}
+
+	// The setting should be preserved by clones.
+	clone := s.Clone()
+	_, err = clone.readSector(host, corruptRoot)
+	if !errors.Contains(err, ErrSectorRootMismatch) {
+		t.Fatal("expected ErrSectorRootMismatch but got", err)
+	}
+}
+
+// testSectorFlusher is a SectorFlusher which keeps the flushed sectors in a
+// map.
+type testSectorFlusher struct {
+	sectors map[crypto.Hash][]byte
+	mu      sync.Mutex
+}
+
+// FlushSector implements the SectorFlusher interface.
+func (f *testSectorFlusher) FlushSector(root crypto.Hash, data []byte) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sectors[root] = data
+	return nil
+}
+
+// RemoveFlushedSector implements the SectorFlusher interface.
+func (f *testSectorFlusher) RemoveFlushedSector(root crypto.Hash) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, exists := f.sectors[root]; !exists {
+		return errors.New("sector wasn't flushed")
+	}
+	delete(f.sectors, root)
+	return nil
+}
+
+// ReadFlushedSector implements the SectorFlusher interface.
+func (f *testSectorFlusher) ReadFlushedSector(root crypto.Hash) ([]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	data, exists := f.sectors[root]
+	if !exists {
+		return nil, errors.New("sector wasn't flushed")
+	}
+	return data, nil
+}
+
+// numFlushed returns the number of sectors held by the flusher.
+func (f *testSectorFlusher) numFlushed() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.sectors)
+}
+
+// TestAppendSectorMemoryCeiling tests appending more sectors to the program
+// cache than fit within the memory ceiling for gained sectors.
+func TestAppendSectorMemoryCeiling(t *testing.T) {
+	// Without a flusher, appending past the ceiling fails.
+	s := newSectors(randomSectorRoots(initialContractSectors))
+	s.maxGainedBytes = 2 * modules.SectorSize
+	for i := 0; i < 2; i++ {
+		if _, err := s.appendSector(randomSectorData()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err := s.appendSector(randomSectorData())
+	if !errors.Contains(err, ErrGainedSectorsMemoryExceeded) {
+		t.Fatal("expected ErrGainedSectorsMemoryExceeded but got", err)
+	}
+
+	// With a flusher, sectors past the ceiling are flushed.
+	flusher := &testSectorFlusher{sectors: make(map[crypto.Hash][]byte)}
+	s = newSectors(randomSectorRoots(initialContractSectors))
+	s.maxGainedBytes = 2 * modules.SectorSize
+	s.flusher = flusher
+	appended := make(map[crypto.Hash][]byte)
+	for i := 0; i < 4; i++ {
+		data := randomSectorData()
+		if _, err := s.appendSector(data); err != nil {
+			t.Fatal(err)
+		}
+		appended[crypto.MerkleRoot(data)] = data
+	}
+	if s.gainedBytes != s.maxGainedBytes {
+		t.Fatalf("expected %v gained bytes but got %v", s.maxGainedBytes, s.gainedBytes)
+	}
+	if len(flusher.sectors) != 2 || len(s.sectorsGained) != 4 {
+		t.Fatal("unexpected number of flushed and gained sectors", len(flusher.sectors), len(s.sectorsGained))
+	}
+
+	// All of the sectors should be readable.
+	for root, data := range appended {
+		readData, err := s.readSector(newTestHost(), root)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(readData, data) {
+			t.Fatal("wrong data")
+		}
+	}
+	// The flushed sectors are gained without their data.
+	for root, data := range s.sectorsGained {
+		if _, flushed := flusher.sectors[root]; flushed != (data == nil) {
+			t.Fatal("flushed sectors shouldn't hold data in memory")
+		}
+	}
+
+	// Dropping the sectors frees up their memory.
+	if _, err := s.dropSectors(4); err != nil {
+		t.Fatal(err)
+	}
+	if s.gainedBytes != 0 {
+		t.Fatal("expected all memory to be freed", s.gainedBytes)
+	}
+
+	// Appending a dropped sector again after filling up the memory shouldn't
+	// flush it twice.
+	for i := 0; i < 2; i++ {
+		if _, err := s.appendSector(randomSectorData()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for root, data := range appended {
+		if _, flushed := flusher.sectors[root]; !flushed {
+			continue
+		}
+		if _, err := s.appendSector(data); err != nil {
+			t.Fatal(err)
+		}
+		break
+	}
+	if len(s.flushed) != 2 || len(flusher.sectors) != 2 {
+		t.Fatal("expected 2 flushed sectors", len(s.flushed))
+	}
+
+	// Releasing the flushed sectors removes them from the flusher.
+	if err := s.releaseFlushedSectors(); err != nil {
+		t.Fatal(err)
+	}
+	if len(flusher.sectors) != 0 || len(s.flushed) != 0 {
+		t.Fatal("expected flushed sectors to be released", len(flusher.sectors), len(s.flushed))
+	}
+}
+
+// TestSectorsClone tests that modifying a clone of the program cache doesn't
+// affect the original and vice versa.
+func TestSectorsClone(t *testing.T) {
+	// Initialize the sectors and gain some.
+	s := newSectors(randomSectorRoots(initialContractSectors))
+	for i := 0; i < 2; i++ {
+		if _, err := s.appendSector(randomSectorData()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// snapshot creates a deep copy of a program cache to compare against.
+	snapshot := func(s sectors) sectors {
+		c := newSectors(append([]crypto.Hash(nil), s.merkleRoots...))
+		for root := range s.sectorsRemoved {
+			c.sectorsRemoved[root] = struct{}{}
+		}
+		for root, data := range s.sectorsGained {
+			c.sectorsGained[root] = data
+		}
+		return c
+	}
+	// equal compares two program caches.
+	equal := func(s1, s2 sectors) bool {
+		return reflect.DeepEqual(s1.merkleRoots, s2.merkleRoots) &&
+			reflect.DeepEqual(s1.sectorsRemoved, s2.sectorsRemoved) &&
+			reflect.DeepEqual(s1.sectorsGained, s2.sectorsGained)
+	}
+
+	// Clone the sectors and make sure the clone is equal to the original.
+	clone := s.Clone()
+	if !equal(s, clone) {
+		t.Fatal("clone doesn't match original")
+	}
+
+	// Modify the clone. The original shouldn't change.
+	before := snapshot(s)
+	if _, err := clone.appendSector(randomSectorData()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := clone.swapSectors(0, 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := clone.dropSectors(4); err != nil {
+		t.Fatal(err)
+	}
+	if !equal(s, before) {
+		t.Fatal("modifying the clone changed the original")
+	}
+	if equal(s, clone) {
+		t.Fatal("clone wasn't modified")
+	}
+
+	// Modify the original. The clone shouldn't change.
+	before = snapshot(clone)
+	if _, err := s.appendSector(randomSectorData()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.swapSectors(2, 3); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.dropSectors(5); err != nil {
+		t.Fatal(err)
+	}
+	if !equal(clone, before) {
+		t.Fatal("modifying the original changed the clone")
+	}
+}
+
+// TestSectorsCheckConsistency tests that checkConsistency detects a program
+// cache which diverged from the sector roots.
+func TestSectorsCheckConsistency(t *testing.T) {
+	// Initialize the sectors and modify them. They should stay consistent.
+	s := newSectors(randomSectorRoots(initialContractSectors))
+	for i := 0; i < 3; i++ {
+		if _, err := s.appendSector(randomSectorData()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := s.swapSectors(0, initialContractSectors); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.dropSectors(2); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.checkConsistency(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A contract can contain the same root more than once. Dropping a copy of
+	// a duplicate root marks it as removed while the other copy remains,
+	// which is still consistent.
+	dup := newSectors(randomSectorRoots(initialContractSectors))
+	dup.merkleRoots = append(dup.merkleRoots, dup.merkleRoots[0])
+	if _, err := dup.dropSectors(1); err != nil {
+		t.Fatal(err)
+	}
+	if _, removed := dup.sectorsRemoved[dup.merkleRoots[0]]; !removed {
+		t.Fatal("dropped root should be marked as removed")
+	}
+	if err := dup.checkConsistency(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Add a gained sector without adding its root, as if an append was only
+	// partially applied.
+	diverged := s.Clone()
+	diverged.unshareMaps()
+	data := randomSectorData()
+	diverged.sectorsGained[crypto.MerkleRoot(data)] = data
+	diverged.gainedBytes += uint64(len(data))
+	if err := diverged.checkConsistency(); !errors.Contains(err, errSectorsDiverged) {
+		t.Fatal("expected gained sector to be detected", err)
+	}
+
+	// Drop a gained root without removing it from the cache. The first
+	// appended sector was swapped to the front.
+	diverged = s.Clone()
+	diverged.merkleRoots = diverged.merkleRoots[1:]
+	if err := diverged.checkConsistency(); !errors.Contains(err, errSectorsDiverged) {
+		t.Fatal("expected dropped gained sector to be detected", err)
+	}
+
+	// Change the gained bytes.
+	diverged = s.Clone()
+	diverged.gainedBytes++
+	if err := diverged.checkConsistency(); !errors.Contains(err, errSectorsDiverged) {
+		t.Fatal("expected gained bytes mismatch to be detected", err)
+	}
+
+	// The original is still consistent.
+	if err := s.checkConsistency(); err != nil {
+		t.Fatal(err)
+	}
+}
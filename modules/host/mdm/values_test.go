@@ -113,6 +113,24 @@ func (v *TestValues) AddReadSectorInstruction(length uint64) {
 	v.addInstruction(collateral, cost, types.ZeroCurrency, types.ZeroCurrency, memory, time, newData, readonly, batch)
 }
 
+// AddReadSectorsInstruction adds a readsectors instruction to the builder,
+// keeping track of running values.
+func (v *TestValues) AddReadSectorsInstruction(reads []modules.MDMSectorRead) {
+	var totalLength uint64
+	for _, read := range reads {
+		totalLength += read.Length
+	}
+	numReads := uint64(len(reads))
+	collateral := modules.MDMReadCollateral()
+	cost := modules.MDMReadSectorsCost(v.staticPT, numReads, totalLength)
+	memory := modules.MDMReadSectorsMemory(totalLength)
+	time := modules.MDMReadSectorsTime(numReads)
+	newData := len(reads) * modules.MDMSectorReadSize
+	readonly := true
+	batch := false
+	v.addInstruction(collateral, cost, types.ZeroCurrency, types.ZeroCurrency, memory, time, newData, readonly, batch)
+}
+
 // AddRevisionInstruction adds a revision instruction to the builder, keeping
 // track of running values.
 func (v *TestValues) AddRevisionInstruction() {
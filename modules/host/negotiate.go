@@ -45,6 +45,12 @@ var (
 	// contract revision.
 	ErrBadRevisionNumber = ErrorCommunication("rejected for bad revision number")
 
+	// ErrNonIncreasingRevision is returned if the renter provides a payment
+	// revision with a revision number that is not higher than the revision
+	// number of the most recent revision. This might indicate a renter that
+	// tries to replay a stale revision.
+	ErrNonIncreasingRevision = ErrorCommunication("rejected for a revision number that didn't increase")
+
 	// ErrBadSectorSize is returned if the renter provides a sector to be
 	// inserted that is the wrong size.
 	ErrBadSectorSize = ErrorCommunication("renter has provided an incorrectly sized sector")
@@ -66,6 +72,11 @@ var (
 	// window start during a file contract revision.
 	ErrBadWindowStart = ErrorCommunication("rejected for bad new window start")
 
+	// ErrContractNearExpiry is returned if a payment is made from a contract
+	// whose proof window starts within the host's
+	// PayByContractExpiryThreshold.
+	ErrContractNearExpiry = ErrorCommunication("rejected for a contract that is too close to its proof window to be used for payments")
+
 	// ErrEarlyWindow is returned if the file contract provided by the renter
 	// has a storage proof window that is starting too near in the future.
 	ErrEarlyWindow = ErrorCommunication("rejected for a window that starts too soon")
@@ -74,6 +85,10 @@ var (
 	// unexpectedly.
 	ErrEmptyObject = ErrorCommunication("renter has unexpectedly send an empty/nil object")
 
+	// ErrExcessiveCollateral is returned if a payment revision would force the
+	// host to move more collateral than it allows for a single payment.
+	ErrExcessiveCollateral = ErrorCommunication("rejected for moving too much host collateral")
+
 	// ErrHighRenterMissedOutput is returned if the renter incorrectly download
 	// and deducts an insufficient amount from the renter missed outputs during
 	// a file contract revision.
@@ -167,6 +182,12 @@ var (
 	// ErrVoidPayoutChanged is returned if the void payout changed even though
 	// it wasn't expected to.
 	ErrVoidPayoutChanged = ErrorCommunication("void payout shouldn't change")
+
+	// ErrZeroValuePayment is returned if a payment revision doesn't transfer
+	// any money to the host. None of the RPCs that accept payments by
+	// contract are free, so such a revision would only make the host sign a
+	// revision for nothing.
+	ErrZeroValuePayment = ErrorCommunication("rejected for not transferring any money to the host")
 )
 
 // finalizeContractArgs are the arguments passed into managedFinalizeContract.
@@ -95,6 +95,8 @@ func (h *Host) externalSettings(maxFeeEstimation types.Currency) modules.HostExt
 		EphemeralAccountExpiry:     h.settings.EphemeralAccountExpiry,
 		MaxEphemeralAccountBalance: h.settings.MaxEphemeralAccountBalance,
 
+		PayByContractExpiryThreshold: h.settings.PayByContractExpiryThreshold,
+
 		RevisionNumber: h.revisionNumber,
 		Version:        build.Version,
 
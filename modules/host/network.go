@@ -414,10 +414,14 @@ func (h *Host) threadedHandleStream(stream siamux.Stream) {
 		err = h.managedRPCAccountBalance(stream)
 	case modules.RPCExecuteProgram:
 		err = h.managedRPCExecuteProgram(stream)
+	case modules.RPCEstimateProgram:
+		err = h.managedRPCEstimateProgram(stream)
 	case modules.RPCUpdatePriceTable:
 		err = h.managedRPCUpdatePriceTable(stream)
 	case modules.RPCFundAccount:
 		err = h.managedRPCFundEphemeralAccount(stream)
+	case modules.RPCHasSector:
+		err = h.managedRPCHasSector(stream)
 	case modules.RPCLatestRevision:
 		err = h.managedRPCLatestRevision(stream)
 	case modules.RPCRegistrySubscription:
@@ -476,6 +480,7 @@ func (h *Host) NetAddress() modules.NetAddress {
 // NetworkMetrics returns information about the types of rpc calls that have
 // been made to the host.
 func (h *Host) NetworkMetrics() modules.HostNetworkMetrics {
+	rm := h.staticMDM.ReadMetrics()
 	h.mu.RLock()
 	defer h.mu.RUnlock()
 	return modules.HostNetworkMetrics{
@@ -486,5 +491,11 @@ func (h *Host) NetworkMetrics() modules.HostNetworkMetrics {
 		ReviseCalls:       atomic.LoadUint64(&h.atomicReviseCalls),
 		SettingsCalls:     atomic.LoadUint64(&h.atomicSettingsCalls),
 		UnrecognizedCalls: atomic.LoadUint64(&h.atomicUnrecognizedCalls),
+
+		NonIncreasingRevisions: atomic.LoadUint64(&h.atomicNonIncreasingRevisions),
+		SlowMDMPrograms:        atomic.LoadUint64(&h.atomicSlowMDMPrograms),
+
+		MDMCacheReadBytes: rm.CacheBytes,
+		MDMDiskReadBytes:  rm.DiskBytes,
 	}
 }
@@ -2,6 +2,7 @@ package host
 
 import (
 	"fmt"
+	"sync/atomic"
 
 	"gitlab.com/NebulousLabs/Sia/crypto"
 	"gitlab.com/NebulousLabs/Sia/modules"
@@ -10,6 +11,13 @@ import (
 	"gitlab.com/NebulousLabs/siamux"
 )
 
+var (
+	// errUnexpectedUnlockConditions is returned if the unlock conditions of a
+	// contract don't contain the renter's key at index 0 and the host's key
+	// at index 1, which is the layout expected for the renter's signature.
+	errUnexpectedUnlockConditions = errors.New("contract has unexpected unlock conditions")
+)
+
 // ProcessPayment reads a payment request from the stream. Depending on the type
 // of payment it will either update the file contract or call upon the ephemeral
 // account manager to process the payment. It will return the account id, the
@@ -49,6 +57,7 @@ func (h *Host) staticPayByEphemeralAccount(stream siamux.Stream, bh types.BlockH
 	}
 
 	// Payment done through EAs don't move collateral
+	h.staticPaymentStats.callTrackAccountPayment(req.Message.Account, req.Message.Amount)
 	return newPaymentDetails(req.Message.Account, req.Message.Amount), nil
 }
 
@@ -69,7 +78,14 @@ func (h *Host) managedPayByContract(stream siamux.Stream, bh types.BlockHeight)
 	}
 
 	// lock the storage obligation
-	h.managedLockStorageObligation(fcid)
+	h.mu.RLock()
+	maxQueued := h.settings.MaxQueuedContractPayments
+	expiryThreshold := h.settings.PayByContractExpiryThreshold
+	maxCollateral := h.settings.MaxPayByContractCollateral
+	h.mu.RUnlock()
+	if err := h.managedLockStorageObligationForPayment(fcid, maxQueued); err != nil {
+		return nil, errors.AddContext(err, "Could not lock storage obligation")
+	}
 	defer h.managedUnlockStorageObligation(fcid)
 
 	// simulate a missing obligation.
@@ -86,6 +102,7 @@ func (h *Host) managedPayByContract(stream siamux.Stream, bh types.BlockHeight)
 	// get the current blockheight
 	h.mu.RLock()
 	sk := h.secretKey
+	pk := h.publicKey
 	h.mu.RUnlock()
 
 	// extract the proposed revision
@@ -95,14 +112,23 @@ func (h *Host) managedPayByContract(stream siamux.Stream, bh types.BlockHeight)
 	}
 	paymentRevision := revisionFromRequest(currentRevision, pbcr)
 
+	// make sure the contract isn't about to expire
+	if err := checkContractNearExpiry(currentRevision.NewWindowStart, bh, expiryThreshold); err != nil {
+		return nil, err
+	}
+
 	// verify the payment revision
-	amount, err := verifyPayByContractRevision(currentRevision, paymentRevision, bh)
+	amount, err := verifyPayByContractRevision(currentRevision, paymentRevision, bh, maxCollateral)
 	if err != nil {
+		h.managedTrackPaymentRevisionError(fcid, err)
 		return nil, errors.AddContext(err, "Invalid payment revision")
 	}
 
 	// sign the revision
-	renterSignature := signatureFromRequest(currentRevision, pbcr)
+	renterSignature, err := signatureFromRequest(currentRevision, pbcr, pk)
+	if err != nil {
+		return nil, errors.AddContext(err, "Invalid renter signature")
+	}
 	txn, err := createRevisionSignature(paymentRevision, renterSignature, sk, bh)
 	if err != nil {
 		return nil, errors.AddContext(err, "Could not create revision signature")
@@ -120,6 +146,7 @@ func (h *Host) managedPayByContract(stream siamux.Stream, bh types.BlockHeight)
 	if err != nil {
 		return nil, errors.AddContext(err, "Could not modify storage obligation")
 	}
+	h.staticPaymentStats.callTrackContractPayment(fcid, amount, paymentCollateral(currentRevision, paymentRevision))
 
 	// send the response
 	var sig crypto.Signature
@@ -153,7 +180,14 @@ func (h *Host) managedFundAccount(stream siamux.Stream, request modules.FundAcco
 	}
 
 	// lock the storage obligation
-	h.managedLockStorageObligation(fcid)
+	h.mu.RLock()
+	maxQueued := h.settings.MaxQueuedContractPayments
+	expiryThreshold := h.settings.PayByContractExpiryThreshold
+	maxCollateral := h.settings.MaxPayByContractCollateral
+	h.mu.RUnlock()
+	if err := h.managedLockStorageObligationForPayment(fcid, maxQueued); err != nil {
+		return types.ZeroCurrency, errors.AddContext(err, "Could not lock storage obligation")
+	}
 	defer h.managedUnlockStorageObligation(fcid)
 
 	// get the storage obligation
@@ -172,14 +206,23 @@ func (h *Host) managedFundAccount(stream siamux.Stream, request modules.FundAcco
 	}
 	paymentRevision := revisionFromRequest(currentRevision, pbcr)
 
+	// make sure the contract isn't about to expire
+	if err := checkContractNearExpiry(currentRevision.NewWindowStart, bh, expiryThreshold); err != nil {
+		return types.ZeroCurrency, err
+	}
+
 	// verify the payment revision
-	amount, err := verifyPayByContractRevision(currentRevision, paymentRevision, bh)
+	amount, err := verifyPayByContractRevision(currentRevision, paymentRevision, bh, maxCollateral)
 	if err != nil {
+		h.managedTrackPaymentRevisionError(fcid, err)
 		return types.ZeroCurrency, errors.AddContext(err, "Invalid payment revision")
 	}
 
 	// sign the revision
-	renterSignature := signatureFromRequest(currentRevision, pbcr)
+	renterSignature, err := signatureFromRequest(currentRevision, pbcr, h.publicKey)
+	if err != nil {
+		return types.ZeroCurrency, errors.AddContext(err, "Invalid renter signature")
+	}
 	txn, err := createRevisionSignature(paymentRevision, renterSignature, h.secretKey, bh)
 	if err != nil {
 		return types.ZeroCurrency, errors.AddContext(err, "Could not create revision signature")
@@ -222,6 +265,7 @@ func (h *Host) managedFundAccount(stream siamux.Stream, request modules.FundAcco
 		return types.ZeroCurrency, errors.AddContext(err, "Could not modify storage obligation")
 	}
 	close(syncChan) // signal FC fsync by closing the sync channel
+	h.staticPaymentStats.callTrackContractPayment(fcid, amount, paymentCollateral(currentRevision, paymentRevision))
 
 	// send the response
 	err = modules.RPCWrite(stream, modules.PayByContractResponse{
@@ -266,16 +310,55 @@ func revisionFromRequest(recent types.FileContractRevision, pbcr modules.PayByCo
 	return rev
 }
 
+// managedTrackPaymentRevisionError keeps track of payment revisions that were
+// rejected for having a revision number that didn't increase. A large number
+// of those might indicate a renter that is probing the host with stale
+// revisions.
+func (h *Host) managedTrackPaymentRevisionError(fcid types.FileContractID, err error) {
+	if !errors.Contains(err, ErrNonIncreasingRevision) {
+		return
+	}
+	atomic.AddUint64(&h.atomicNonIncreasingRevisions, 1)
+	h.log.Debugf("rejected payment revision with non-increasing revision number for contract %v: %v", fcid, err)
+}
+
 // signatureFromRequest is a helper function that creates a copy of the recent
 // revision and decorates it with the signature provided through the
-// PayByContractRequest object.
-func signatureFromRequest(recent types.FileContractRevision, pbcr modules.PayByContractRequest) types.TransactionSignature {
+// PayByContractRequest object. The signature is assumed to belong to the
+// renter's key at index 0 of the contract's unlock conditions, so the unlock
+// conditions are checked to contain the renter's key at index 0 and the host's
+// key at index 1.
+func signatureFromRequest(recent types.FileContractRevision, pbcr modules.PayByContractRequest, hostPK types.SiaPublicKey) (types.TransactionSignature, error) {
+	uc := recent.UnlockConditions
+	if len(uc.PublicKeys) != 2 {
+		return types.TransactionSignature{}, errors.AddContext(errUnexpectedUnlockConditions, fmt.Sprintf("expected 2 public keys but got %v", len(uc.PublicKeys)))
+	}
+	if uc.PublicKeys[0].Algorithm != types.SignatureEd25519 {
+		return types.TransactionSignature{}, errors.AddContext(errUnexpectedUnlockConditions, fmt.Sprintf("expected renter key at index 0 to use %v but got %v", types.SignatureEd25519, uc.PublicKeys[0].Algorithm))
+	}
+	if !uc.PublicKeys[1].Equals(hostPK) {
+		return types.TransactionSignature{}, errors.AddContext(errUnexpectedUnlockConditions, "expected host key at index 1")
+	}
 	return types.TransactionSignature{
 		ParentID:       crypto.Hash(recent.ParentID),
 		CoveredFields:  types.CoveredFields{FileContractRevisions: []uint64{0}},
 		PublicKeyIndex: 0,
 		Signature:      pbcr.Signature,
+	}, nil
+}
+
+// checkContractNearExpiry returns ErrContractNearExpiry if fewer than threshold
+// blocks remain before the proof window of a contract starts. A threshold of 0
+// disables the check.
+func checkContractNearExpiry(windowStart, blockHeight, threshold types.BlockHeight) error {
+	if threshold == 0 || blockHeight+threshold <= windowStart {
+		return nil
+	}
+	var remaining types.BlockHeight
+	if windowStart > blockHeight {
+		remaining = windowStart - blockHeight
 	}
+	return errors.AddContext(ErrContractNearExpiry, fmt.Sprintf("%v blocks remain before the proof window, the host requires at least %v", remaining, threshold))
 }
 
 // verifyEAFundRevision verifies that the revision being provided to pay for
@@ -284,7 +367,7 @@ func signatureFromRequest(recent types.FileContractRevision, pbcr modules.PayByC
 func verifyEAFundRevision(existingRevision, paymentRevision types.FileContractRevision, blockHeight types.BlockHeight, expectedTransfer types.Currency) error {
 	// Check that the revision count has increased.
 	if paymentRevision.NewRevisionNumber <= existingRevision.NewRevisionNumber {
-		return errors.AddContext(ErrBadRevisionNumber, fmt.Sprintf("%v <= %v", paymentRevision.NewRevisionNumber, existingRevision.NewRevisionNumber))
+		return errors.AddContext(errors.Compose(ErrBadRevisionNumber, ErrNonIncreasingRevision), fmt.Sprintf("%v <= %v", paymentRevision.NewRevisionNumber, existingRevision.NewRevisionNumber))
 	}
 
 	// Check that the revision is well-formed.
@@ -384,18 +467,110 @@ func verifyEAFundRevision(existingRevision, paymentRevision types.FileContractRe
 }
 
 // verifyPayByContractRevision verifies the given payment revision and returns
-// the amount that was transferred, the collateral that was moved and a
-// potential error.
-func verifyPayByContractRevision(current, payment types.FileContractRevision, blockHeight types.BlockHeight) (amount types.Currency, err error) {
+// the amount that was transferred and a potential error. Revisions that don't
+// transfer any money or that move more than maxCollateral from the host are
+// rejected.
+func verifyPayByContractRevision(current, payment types.FileContractRevision, blockHeight types.BlockHeight, maxCollateral types.Currency) (amount types.Currency, err error) {
+	// Check that the revision is well-formed before looking at its outputs.
+	if len(payment.NewValidProofOutputs) != 2 || len(payment.NewMissedProofOutputs) != 3 {
+		err = ErrBadContractOutputCounts
+		return
+	}
 	if err = verifyEAFundRevision(current, payment, blockHeight, types.ZeroCurrency); err != nil {
 		return
 	}
+	// A payment only moves money between the outputs, it never creates or
+	// destroys any.
+	if err = verifyPayoutSums(current, payment); err != nil {
+		err = errors.Compose(ErrInvalidPayoutSums, err)
+		return
+	}
+	if err = verifyPaymentCollateral(current, payment, maxCollateral); err != nil {
+		return
+	}
 
 	// Note that we can safely subtract the values of the outputs seeing as verifyPaymentRevision will have checked for potential underflows
 	amount = payment.ValidHostPayout().Sub(current.ValidHostPayout())
+	if amount.IsZero() {
+		err = ErrZeroValuePayment
+	}
 	return
 }
 
+// verifyPaymentCollateral verifies that the collateral moved by the given
+// payment revision doesn't exceed maxCollateral. The host moves collateral if
+// its missed output doesn't increase by the same amount as its valid output.
+func verifyPaymentCollateral(current, payment types.FileContractRevision, maxCollateral types.Currency) error {
+	collateral := paymentCollateral(current, payment)
+	if collateral.Cmp(maxCollateral) > 0 {
+		return errors.AddContext(ErrExcessiveCollateral, fmt.Sprintf("payment moves %v of collateral but at most %v is allowed", collateral, maxCollateral))
+	}
+	return nil
+}
+
+// paymentCollateral returns the collateral moved from the host to the void by
+// the given payment revision.
+func paymentCollateral(current, payment types.FileContractRevision) types.Currency {
+	// A decreased valid host output is rejected by verifyEAFundRevision.
+	if payment.ValidHostPayout().Cmp(current.ValidHostPayout()) < 0 {
+		return types.ZeroCurrency
+	}
+	toHost := payment.ValidHostPayout().Sub(current.ValidHostPayout())
+	expectedMissed := current.MissedHostPayout().Add(toHost)
+	if payment.MissedHostPayout().Cmp(expectedMissed) >= 0 {
+		return types.ZeroCurrency
+	}
+	return expectedMissed.Sub(payment.MissedHostPayout())
+}
+
+// collateralExposure describes the host's collateral exposure in a storage
+// obligation and how a payment revision changes it.
+type collateralExposure struct {
+	// Locked is the collateral the host locked in the contract.
+	Locked types.Currency
+
+	// Risked is the amount of money the host loses if it misses the storage
+	// proof of the obligation's most recent revision.
+	Risked types.Currency
+
+	// Moved is the collateral that the payment revision moves from the host
+	// to the void.
+	Moved types.Currency
+
+	// RiskedAfterPayment is the amount of money the host loses if it misses
+	// the storage proof after accepting the payment revision.
+	RiskedAfterPayment types.Currency
+}
+
+// collateralExposure returns the host's collateral exposure in the storage
+// obligation before and after accepting the given payment revision. The
+// storage obligation should be read under the obligation lock.
+func (so storageObligation) collateralExposure(payment types.FileContractRevision) (collateralExposure, error) {
+	// Check that the revision is well-formed before looking at its outputs.
+	if len(payment.NewValidProofOutputs) != 2 || len(payment.NewMissedProofOutputs) != 3 {
+		return collateralExposure{}, ErrBadContractOutputCounts
+	}
+	current, err := so.recentRevision()
+	if err != nil {
+		return collateralExposure{}, err
+	}
+	return collateralExposure{
+		Locked:             so.LockedCollateral,
+		Risked:             payoutAtRisk(current.ValidHostPayout(), current.MissedHostPayout()),
+		Moved:              paymentCollateral(current, payment),
+		RiskedAfterPayment: payoutAtRisk(payment.ValidHostPayout(), payment.MissedHostPayout()),
+	}, nil
+}
+
+// payoutAtRisk returns the amount of money the host loses if it misses the
+// storage proof given its valid and missed payouts.
+func payoutAtRisk(validHostPayout, missedHostPayout types.Currency) types.Currency {
+	if missedHostPayout.Cmp(validHostPayout) >= 0 {
+		return types.ZeroCurrency
+	}
+	return validHostPayout.Sub(missedHostPayout)
+}
+
 // payment details is a helper struct that implements the PaymentDetails
 // interface.
 type paymentDetails struct {
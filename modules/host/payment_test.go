@@ -1,6 +1,7 @@
 package host
 
 import (
+	"bytes"
 	"fmt"
 	"net"
 	"strings"
@@ -174,6 +175,20 @@ func TestVerifyEAFundRevision(t *testing.T) {
 		t.Fatalf("Expected ErrBadRevisionNumber but received '%v'", err)
 	}
 
+	// expect ErrNonIncreasingRevision for an equal and a lower revision number
+	badPayment = deepCopy(payment)
+	badPayment.NewRevisionNumber = curr.NewRevisionNumber
+	err = verifyEAFundRevision(curr, badPayment, height, amount)
+	if !errors.Contains(err, ErrNonIncreasingRevision) {
+		t.Fatalf("Expected ErrNonIncreasingRevision but received '%v'", err)
+	}
+	newerCurr := deepCopy(curr)
+	newerCurr.NewRevisionNumber = payment.NewRevisionNumber + 1
+	err = verifyEAFundRevision(newerCurr, payment, height, amount)
+	if !errors.Contains(err, ErrNonIncreasingRevision) {
+		t.Fatalf("Expected ErrNonIncreasingRevision but received '%v'", err)
+	}
+
 	// expect ErrBadParentID
 	badPayment = deepCopy(payment)
 	badPayment.ParentID = types.FileContractID(hash)
@@ -245,6 +260,323 @@ func TestVerifyEAFundRevision(t *testing.T) {
 	// payout check redundant, but it's skill kept to be 100% sure.
 }
 
+// TestVerifyPaymentCollateral is a unit test covering verifyPaymentCollateral.
+func TestVerifyPaymentCollateral(t *testing.T) {
+	t.Parallel()
+
+	// create a current revision and a payment revision
+	amount := types.NewCurrency64(1)
+	curr := types.FileContractRevision{
+		NewValidProofOutputs: []types.SiacoinOutput{
+			{Value: types.NewCurrency64(10)},
+			{Value: types.NewCurrency64(10)},
+		},
+		NewMissedProofOutputs: []types.SiacoinOutput{
+			{Value: types.NewCurrency64(10)},
+			{Value: types.NewCurrency64(10)},
+			{Value: types.ZeroCurrency},
+		},
+	}
+	payment, err := curr.EAFundRevision(amount)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a regular payment doesn't move any collateral
+	err = verifyPaymentCollateral(curr, payment, types.ZeroCurrency)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// move 2H of collateral from the host's missed output
+	collateral := types.NewCurrency64(2)
+	payment.SetMissedHostPayout(payment.MissedHostPayout().Sub(collateral))
+
+	// just under the ceiling
+	err = verifyPaymentCollateral(curr, payment, collateral.Add(types.NewCurrency64(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// at the ceiling
+	err = verifyPaymentCollateral(curr, payment, collateral)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// just over the ceiling
+	err = verifyPaymentCollateral(curr, payment, collateral.Sub(types.NewCurrency64(1)))
+	if !errors.Contains(err, ErrExcessiveCollateral) {
+		t.Fatalf("expected %v but got %v", ErrExcessiveCollateral, err)
+	}
+
+	// the ceiling is only a guard, a payment moving collateral still has to
+	// pass the regular revision checks
+	_, err = verifyPayByContractRevision(curr, payment, 0, collateral)
+	if !errors.Contains(err, ErrLowHostMissedOutput) {
+		t.Fatalf("expected %v but got %v", ErrLowHostMissedOutput, err)
+	}
+
+	// a revision with too few outputs is rejected without looking at them
+	badPayment := payment
+	badPayment.NewValidProofOutputs = payment.NewValidProofOutputs[:1]
+	_, err = verifyPayByContractRevision(curr, badPayment, 0, collateral)
+	if !errors.Contains(err, ErrBadContractOutputCounts) {
+		t.Fatalf("expected %v but got %v", ErrBadContractOutputCounts, err)
+	}
+	badPayment = payment
+	badPayment.NewMissedProofOutputs = payment.NewMissedProofOutputs[:1]
+	_, err = verifyPayByContractRevision(curr, badPayment, 0, collateral)
+	if !errors.Contains(err, ErrBadContractOutputCounts) {
+		t.Fatalf("expected %v but got %v", ErrBadContractOutputCounts, err)
+	}
+}
+
+// TestVerifyPayByContractRevisionZeroValue verifies that a payment revision
+// that doesn't transfer any money is rejected.
+func TestVerifyPayByContractRevisionZeroValue(t *testing.T) {
+	t.Parallel()
+
+	curr := types.FileContractRevision{
+		NewValidProofOutputs: []types.SiacoinOutput{
+			{Value: types.NewCurrency64(10)},
+			{Value: types.NewCurrency64(10)},
+		},
+		NewMissedProofOutputs: []types.SiacoinOutput{
+			{Value: types.NewCurrency64(10)},
+			{Value: types.NewCurrency64(10)},
+			{Value: types.ZeroCurrency},
+		},
+	}
+
+	// a zero value payment is rejected
+	payment, err := curr.EAFundRevision(types.ZeroCurrency)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = verifyPayByContractRevision(curr, payment, 0, types.ZeroCurrency)
+	if !errors.Contains(err, ErrZeroValuePayment) {
+		t.Fatalf("expected %v but got %v", ErrZeroValuePayment, err)
+	}
+
+	// the smallest possible payment is accepted
+	payment, err = curr.EAFundRevision(types.NewCurrency64(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	amount, err := verifyPayByContractRevision(curr, payment, 0, types.ZeroCurrency)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !amount.Equals(types.NewCurrency64(1)) {
+		t.Fatalf("expected amount 1H but got %v", amount)
+	}
+}
+
+// TestVerifyPayByContractRevisionOutputSums verifies that a payment revision
+// that inflates or deflates the total of its outputs is rejected.
+func TestVerifyPayByContractRevisionOutputSums(t *testing.T) {
+	t.Parallel()
+
+	// The renter's missed output exceeds its valid output to be able to
+	// deflate it without giving the renter an incentive to see the host fail.
+	curr := types.FileContractRevision{
+		NewValidProofOutputs: []types.SiacoinOutput{
+			{Value: types.NewCurrency64(10)},
+			{Value: types.NewCurrency64(10)},
+		},
+		NewMissedProofOutputs: []types.SiacoinOutput{
+			{Value: types.NewCurrency64(11)},
+			{Value: types.NewCurrency64(9)},
+			{Value: types.ZeroCurrency},
+		},
+	}
+	newPayment := func() types.FileContractRevision {
+		payment, err := curr.EAFundRevision(types.NewCurrency64(1))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return payment
+	}
+	one := types.NewCurrency64(1)
+
+	// a regular payment preserves the totals
+	_, err := verifyPayByContractRevision(curr, newPayment(), 0, types.ZeroCurrency)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// inflated missed outputs
+	payment := newPayment()
+	payment.SetMissedRenterPayout(payment.MissedRenterOutput().Value.Add(one))
+	_, err = verifyPayByContractRevision(curr, payment, 0, types.ZeroCurrency)
+	if !errors.Contains(err, ErrInvalidPayoutSums) {
+		t.Fatalf("expected %v but got %v", ErrInvalidPayoutSums, err)
+	}
+
+	// deflated missed outputs
+	payment = newPayment()
+	payment.SetMissedRenterPayout(payment.MissedRenterOutput().Value.Sub(one))
+	_, err = verifyPayByContractRevision(curr, payment, 0, types.ZeroCurrency)
+	if !errors.Contains(err, ErrInvalidPayoutSums) {
+		t.Fatalf("expected %v but got %v", ErrInvalidPayoutSums, err)
+	}
+
+	// inflated and deflated valid outputs are rejected as well, the host's
+	// valid output needs to increase by exactly what the renter's decreases
+	payment = newPayment()
+	payment.SetValidRenterPayout(payment.ValidRenterPayout().Add(one))
+	_, err = verifyPayByContractRevision(curr, payment, 0, types.ZeroCurrency)
+	if !errors.Contains(err, ErrLowHostValidOutput) {
+		t.Fatalf("expected %v but got %v", ErrLowHostValidOutput, err)
+	}
+	payment = newPayment()
+	payment.SetValidRenterPayout(payment.ValidRenterPayout().Sub(one))
+	_, err = verifyPayByContractRevision(curr, payment, 0, types.ZeroCurrency)
+	if !errors.Contains(err, ErrLowHostValidOutput) {
+		t.Fatalf("expected %v but got %v", ErrLowHostValidOutput, err)
+	}
+}
+
+// TestCollateralExposure is a unit test covering the collateral exposure of a
+// storage obligation before and after a payment.
+func TestCollateralExposure(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	pair, err := newRenterHostPair(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := pair.Close(); err != nil {
+			t.Error(err)
+		}
+	}()
+	host := pair.staticHT.host
+
+	so, err := pair.managedStorageObligation()
+	if err != nil {
+		t.Fatal(err)
+	}
+	curr, err := so.recentRevision()
+	if err != nil {
+		t.Fatal(err)
+	}
+	risked := curr.ValidHostPayout().Sub(curr.MissedHostPayout())
+
+	// exposureOf is a helper that reads the exposure under the obligation lock.
+	exposureOf := func(payment types.FileContractRevision) (collateralExposure, error) {
+		host.managedLockStorageObligation(pair.staticFCID)
+		defer host.managedUnlockStorageObligation(pair.staticFCID)
+		so, err := pair.managedStorageObligation()
+		if err != nil {
+			return collateralExposure{}, err
+		}
+		return so.collateralExposure(payment)
+	}
+
+	// a regular payment doesn't change the exposure
+	payment, _, err := pair.managedEAFundRevision(types.SiacoinPrecision)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exposure, err := exposureOf(payment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !exposure.Locked.Equals(so.LockedCollateral) {
+		t.Fatalf("expected locked collateral %v but got %v", so.LockedCollateral, exposure.Locked)
+	}
+	if !exposure.Risked.Equals(risked) || !exposure.RiskedAfterPayment.Equals(risked) {
+		t.Fatalf("expected %v to be risked before and after payment but got %v and %v", risked, exposure.Risked, exposure.RiskedAfterPayment)
+	}
+	if !exposure.Moved.IsZero() {
+		t.Fatal("payment shouldn't move collateral", exposure.Moved)
+	}
+
+	// a payment moving collateral increases the exposure
+	collateral := types.NewCurrency64(2)
+	payment.SetMissedHostPayout(payment.MissedHostPayout().Sub(collateral))
+	exposure, err = exposureOf(payment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !exposure.Moved.Equals(collateral) {
+		t.Fatalf("expected %v to be moved but got %v", collateral, exposure.Moved)
+	}
+	if !exposure.RiskedAfterPayment.Equals(risked.Add(collateral)) {
+		t.Fatalf("expected %v to be risked after payment but got %v", risked.Add(collateral), exposure.RiskedAfterPayment)
+	}
+
+	// a payment with missing outputs is rejected instead of panicking
+	badPayment := payment
+	badPayment.NewValidProofOutputs = badPayment.NewValidProofOutputs[:1]
+	_, err = exposureOf(badPayment)
+	if !errors.Contains(err, ErrBadContractOutputCounts) {
+		t.Fatalf("expected %v but got %v", ErrBadContractOutputCounts, err)
+	}
+
+	// after the payment the exposure reflects the new revision
+	rev, sig, err := pair.managedEAFundRevision(types.SiacoinPrecision)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rStream, hStream, err := NewTestStreams()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := errors.Compose(rStream.Close(), hStream.Close()); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	_, refundAccount := prepareAccount()
+	var hostErr error
+	renterFunc := func() error {
+		pRequest := modules.PaymentRequest{Type: modules.PayByContract}
+		pbcRequest := newPayByContractRequest(rev, sig, refundAccount)
+		err := modules.RPCWriteAll(rStream, pRequest, pbcRequest)
+		if err != nil {
+			return err
+		}
+		var payByResponse modules.PayByContractResponse
+		return modules.RPCRead(rStream, &payByResponse)
+	}
+	hostFunc := func() error {
+		_, hostErr = host.ProcessPayment(hStream, host.BlockHeight())
+		if hostErr != nil {
+			modules.RPCWriteError(hStream, hostErr)
+		}
+		return nil
+	}
+	if err := errors.Compose(run(renterFunc, hostFunc), hostErr); err != nil {
+		t.Fatal(err)
+	}
+	exposure, err = exposureOf(payment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !exposure.Risked.Equals(risked) {
+		t.Fatalf("expected %v to be risked but got %v", risked, exposure.Risked)
+	}
+
+	// the exposure is reported with the host's storage obligations
+	var found bool
+	for _, mso := range host.StorageObligations() {
+		if mso.ObligationId != pair.staticFCID {
+			continue
+		}
+		found = true
+		if !mso.CollateralExposure.Equals(risked) {
+			t.Fatalf("expected exposure %v but got %v", risked, mso.CollateralExposure)
+		}
+	}
+	if !found {
+		t.Fatal("storage obligation not found")
+	}
+}
+
 // TestProcessPayment verifies the host's ProcessPayment method. It covers both
 // the PayByContract and PayByEphemeralAccount payment methods.
 func TestProcessPayment(t *testing.T) {
@@ -406,6 +738,30 @@ func testPayByContract(t *testing.T, pair *renterHostPair) {
 		t.Fatal(err)
 	}
 
+	// Replay the same revision. This should fail since the revision number
+	// didn't increase.
+	err = run(renterFunc, hostFunc)
+	if err == nil || !strings.Contains(err.Error(), ErrNonIncreasingRevision.Error()) {
+		t.Fatalf("Expected error '%v', instead error was '%v'", ErrNonIncreasingRevision, err)
+	}
+
+	// Submit a revision with a lower revision number. This should fail too.
+	rev, _, err = pair.managedEAFundRevision(amount)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rev.NewRevisionNumber -= 2
+	sig = pair.managedSign(rev)
+	err = run(renterFunc, hostFunc)
+	if err == nil || !strings.Contains(err.Error(), ErrNonIncreasingRevision.Error()) {
+		t.Fatalf("Expected error '%v', instead error was '%v'", ErrNonIncreasingRevision, err)
+	}
+
+	// Both attempts should have been metered.
+	if nir := host.NetworkMetrics().NonIncreasingRevisions; nir != 2 {
+		t.Fatalf("Expected 2 non-increasing revisions to be metered but got %v", nir)
+	}
+
 	//  Run the code again. This time it should fail due to no refund account
 	//  being provided.
 	refundAccount = modules.ZeroAccountID
@@ -851,3 +1207,256 @@ func TestRevisionFromRequest(t *testing.T) {
 	}
 	_ = revisionFromRequest(recent, pbcr)
 }
+
+// TestSignatureFromRequest tests that signatureFromRequest checks the layout of
+// the contract's unlock conditions before creating the renter's signature.
+func TestSignatureFromRequest(t *testing.T) {
+	renterPK := types.SiaPublicKey{
+		Algorithm: types.SignatureEd25519,
+		Key:       fastrand.Bytes(crypto.PublicKeySize),
+	}
+	hostPK := types.SiaPublicKey{
+		Algorithm: types.SignatureEd25519,
+		Key:       fastrand.Bytes(crypto.PublicKeySize),
+	}
+	recent := types.FileContractRevision{
+		ParentID: types.FileContractID{1},
+		UnlockConditions: types.UnlockConditions{
+			PublicKeys:         []types.SiaPublicKey{renterPK, hostPK},
+			SignaturesRequired: 2,
+		},
+	}
+	pbcr := modules.PayByContractRequest{
+		Signature: fastrand.Bytes(crypto.SignatureSize),
+	}
+
+	// valid case
+	sig, err := signatureFromRequest(recent, pbcr, hostPK)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sig.PublicKeyIndex != 0 || sig.ParentID != crypto.Hash(recent.ParentID) || !bytes.Equal(sig.Signature, pbcr.Signature) {
+		t.Fatal("unexpected signature", sig)
+	}
+
+	// wrong number of keys
+	badRecent := recent
+	badRecent.UnlockConditions.PublicKeys = []types.SiaPublicKey{renterPK}
+	_, err = signatureFromRequest(badRecent, pbcr, hostPK)
+	if !errors.Contains(err, errUnexpectedUnlockConditions) {
+		t.Fatal("unexpected error", err)
+	}
+
+	// keys swapped
+	badRecent.UnlockConditions.PublicKeys = []types.SiaPublicKey{hostPK, renterPK}
+	_, err = signatureFromRequest(badRecent, pbcr, hostPK)
+	if !errors.Contains(err, errUnexpectedUnlockConditions) {
+		t.Fatal("unexpected error", err)
+	}
+
+	// renter key with unexpected algorithm
+	badRenterPK := renterPK
+	badRenterPK.Algorithm = types.SignatureEntropy
+	badRecent.UnlockConditions.PublicKeys = []types.SiaPublicKey{badRenterPK, hostPK}
+	_, err = signatureFromRequest(badRecent, pbcr, hostPK)
+	if !errors.Contains(err, errUnexpectedUnlockConditions) {
+		t.Fatal("unexpected error", err)
+	}
+}
+
+// TestCheckContractNearExpiry is a unit test for checkContractNearExpiry.
+func TestCheckContractNearExpiry(t *testing.T) {
+	t.Parallel()
+
+	windowStart := types.BlockHeight(100)
+	tests := []struct {
+		bh        types.BlockHeight
+		threshold types.BlockHeight
+		err       error
+	}{
+		{0, 0, nil},
+		{100, 0, nil},
+		{89, 10, nil},
+		{90, 10, nil},
+		{91, 10, ErrContractNearExpiry},
+		{100, 10, ErrContractNearExpiry},
+		{150, 10, ErrContractNearExpiry},
+	}
+	for _, test := range tests {
+		err := checkContractNearExpiry(windowStart, test.bh, test.threshold)
+		if test.err == nil && err != nil {
+			t.Fatal("unexpected error", test.bh, test.threshold, err)
+		}
+		if test.err != nil && !errors.Contains(err, test.err) {
+			t.Fatal("expected error", test.bh, test.threshold, err)
+		}
+	}
+}
+
+// TestPayByContractNearExpiry verifies that the host rejects payments from a
+// contract whose proof window starts within the configured threshold.
+func TestPayByContractNearExpiry(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	pair, err := newRenterHostPair(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := pair.Close()
+		if err != nil {
+			t.Error(err)
+		}
+	}()
+	host := pair.staticHT.host
+
+	// configure a threshold that exceeds the revision submission buffer
+	threshold := revisionSubmissionBuffer + 2
+	is := host.InternalSettings()
+	is.PayByContractExpiryThreshold = threshold
+	err = host.SetInternalSettings(is)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if host.ExternalSettings().PayByContractExpiryThreshold != threshold {
+		t.Fatal("threshold not reflected in external settings")
+	}
+
+	// pay is a helper that pays the host at the given height.
+	_, refundAccount := prepareAccount()
+	pay := func(bh types.BlockHeight) error {
+		rev, sig, err := pair.managedEAFundRevision(types.SiacoinPrecision)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rStream, hStream, err := NewTestStreams()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() {
+			if err := errors.Compose(rStream.Close(), hStream.Close()); err != nil {
+				t.Fatal(err)
+			}
+		}()
+
+		var hostErr error
+		renterFunc := func() error {
+			pRequest := modules.PaymentRequest{Type: modules.PayByContract}
+			pbcRequest := newPayByContractRequest(rev, sig, refundAccount)
+			err := modules.RPCWriteAll(rStream, pRequest, pbcRequest)
+			if err != nil {
+				return err
+			}
+			var payByResponse modules.PayByContractResponse
+			return modules.RPCRead(rStream, &payByResponse)
+		}
+		hostFunc := func() error {
+			_, hostErr = host.ProcessPayment(hStream, bh)
+			if hostErr != nil {
+				modules.RPCWriteError(hStream, hostErr)
+			}
+			return nil
+		}
+		err = run(renterFunc, hostFunc)
+		return errors.Compose(err, hostErr)
+	}
+
+	so, err := pair.managedStorageObligation()
+	if err != nil {
+		t.Fatal(err)
+	}
+	windowStart := so.expiration()
+
+	// just inside the threshold the payment is rejected
+	err = pay(windowStart - threshold + 1)
+	if !errors.Contains(err, ErrContractNearExpiry) {
+		t.Fatal("expected payment to be rejected", err)
+	}
+
+	// just outside the threshold the payment is accepted
+	err = pay(windowStart - threshold)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestPayByContractZeroValue verifies that the host rejects a payment revision
+// that doesn't transfer any money without signing it.
+func TestPayByContractZeroValue(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	pair, err := newRenterHostPair(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := pair.Close()
+		if err != nil {
+			t.Error(err)
+		}
+	}()
+	host := pair.staticHT.host
+
+	before, err := pair.managedRecentHostRevision()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// create a zero value payment revision
+	rev, sig, err := pair.managedEAFundRevision(types.ZeroCurrency)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rStream, hStream, err := NewTestStreams()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := errors.Compose(rStream.Close(), hStream.Close()); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	// submit it
+	_, refundAccount := prepareAccount()
+	var hostErr error
+	renterFunc := func() error {
+		pRequest := modules.PaymentRequest{Type: modules.PayByContract}
+		pbcRequest := newPayByContractRequest(rev, sig, refundAccount)
+		err := modules.RPCWriteAll(rStream, pRequest, pbcRequest)
+		if err != nil {
+			return err
+		}
+		var payByResponse modules.PayByContractResponse
+		return modules.RPCRead(rStream, &payByResponse)
+	}
+	hostFunc := func() error {
+		_, hostErr = host.ProcessPayment(hStream, pair.managedPriceTable().HostBlockHeight)
+		if hostErr != nil {
+			modules.RPCWriteError(hStream, hostErr)
+		}
+		return nil
+	}
+	err = run(renterFunc, hostFunc)
+	if !errors.Contains(hostErr, ErrZeroValuePayment) {
+		t.Fatalf("expected %v but got %v", ErrZeroValuePayment, hostErr)
+	}
+	if err == nil || !strings.Contains(err.Error(), ErrZeroValuePayment.Error()) {
+		t.Fatal("expected renter to receive the error", err)
+	}
+
+	// the host shouldn't have stored a new revision
+	after, err := pair.managedRecentHostRevision()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.NewRevisionNumber != before.NewRevisionNumber {
+		t.Fatalf("expected revision number %v but got %v", before.NewRevisionNumber, after.NewRevisionNumber)
+	}
+}
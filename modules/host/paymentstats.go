@@ -0,0 +1,89 @@
+package host
+
+import (
+	"sync"
+	"time"
+
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/types"
+)
+
+// paymentStats keeps track of the payments the host received through each
+// contract and ephemeral account. It is covered by its own mutex to avoid
+// contention on the host's lock in the payment path. To keep the memory usage
+// bounded, the stats of a contract are removed together with its storage
+// obligation and the stats of an account when it expires.
+type paymentStats struct {
+	contracts map[types.FileContractID]modules.HostPaymentStats
+	accounts  map[modules.AccountID]modules.HostPaymentStats
+	mu        sync.Mutex
+}
+
+// newPaymentStats returns an empty paymentStats object.
+func newPaymentStats() *paymentStats {
+	return &paymentStats{
+		contracts: make(map[types.FileContractID]modules.HostPaymentStats),
+		accounts:  make(map[modules.AccountID]modules.HostPaymentStats),
+	}
+}
+
+// addPayment returns the given stats updated with a payment of the given
+// amount and collateral.
+func addPayment(stats modules.HostPaymentStats, amount, collateral types.Currency) modules.HostPaymentStats {
+	stats.Amount = stats.Amount.Add(amount)
+	stats.Collateral = stats.Collateral.Add(collateral)
+	stats.NumPayments++
+	stats.LastPayment = time.Now()
+	return stats
+}
+
+// callTrackContractPayment adds a payment by the contract with the given id to
+// the stats.
+func (ps *paymentStats) callTrackContractPayment(fcid types.FileContractID, amount, collateral types.Currency) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	ps.contracts[fcid] = addPayment(ps.contracts[fcid], amount, collateral)
+}
+
+// callTrackAccountPayment adds a payment by the account with the given id to
+// the stats.
+func (ps *paymentStats) callTrackAccountPayment(id modules.AccountID, amount types.Currency) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	ps.accounts[id] = addPayment(ps.accounts[id], amount, types.ZeroCurrency)
+}
+
+// callRemoveContract removes the stats of the contract with the given id.
+func (ps *paymentStats) callRemoveContract(fcid types.FileContractID) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	delete(ps.contracts, fcid)
+}
+
+// callRemoveAccount removes the stats of the account with the given id.
+func (ps *paymentStats) callRemoveAccount(id modules.AccountID) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	delete(ps.accounts, id)
+}
+
+// callStats returns a copy of the stats of all contracts and accounts.
+func (ps *paymentStats) callStats() (map[types.FileContractID]modules.HostPaymentStats, map[modules.AccountID]modules.HostPaymentStats) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	contracts := make(map[types.FileContractID]modules.HostPaymentStats, len(ps.contracts))
+	for fcid, stats := range ps.contracts {
+		contracts[fcid] = stats
+	}
+	accounts := make(map[modules.AccountID]modules.HostPaymentStats, len(ps.accounts))
+	for id, stats := range ps.accounts {
+		accounts[id] = stats
+	}
+	return contracts, accounts
+}
+
+// PaymentStats returns the payment statistics of every contract and ephemeral
+// account that paid the host since it was started.
+func (h *Host) PaymentStats() (map[types.FileContractID]modules.HostPaymentStats, map[modules.AccountID]modules.HostPaymentStats) {
+	return h.staticPaymentStats.callStats()
+}
@@ -0,0 +1,163 @@
+package host
+
+import (
+	"testing"
+
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/types"
+)
+
+// TestPaymentStats verifies that the host keeps track of the payments made by
+// each contract and ephemeral account.
+func TestPaymentStats(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	// setup a host and renter pair with an emulated file contract between them
+	pair, err := newRenterHostPair(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := pair.Close()
+		if err != nil {
+			t.Error(err)
+		}
+	}()
+	host := pair.staticHT.host
+
+	// pay is a helper that processes a single payment request. Payments by
+	// contract receive a response.
+	pay := func(pr modules.PaymentRequest, request interface{}) error {
+		rStream, hStream, err := NewTestStreams()
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = rStream.Close()
+			_ = hStream.Close()
+		}()
+		renterFunc := func() error {
+			err := modules.RPCWriteAll(rStream, pr, request)
+			if err != nil || pr.Type != modules.PayByContract {
+				return err
+			}
+			var pbcr modules.PayByContractResponse
+			return modules.RPCRead(rStream, &pbcr)
+		}
+		hostFunc := func() error {
+			_, err := host.ProcessPayment(hStream, host.BlockHeight())
+			if err != nil {
+				modules.RPCWriteError(hStream, err)
+			}
+			return nil
+		}
+		return run(renterFunc, hostFunc)
+	}
+
+	// Setting up the pair might have involved payments by contract already.
+	contracts, _ := host.PaymentStats()
+	before := contracts[pair.staticFCID]
+
+	// Pay a few times by contract.
+	_, refundAccount := prepareAccount()
+	amounts := []types.Currency{
+		types.SiacoinPrecision,
+		types.SiacoinPrecision.Div64(2),
+		types.SiacoinPrecision.Mul64(3),
+	}
+	var total types.Currency
+	for _, amount := range amounts {
+		rev, sig, err := pair.managedEAFundRevision(amount)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pRequest := modules.PaymentRequest{Type: modules.PayByContract}
+		err = pay(pRequest, newPayByContractRequest(rev, sig, refundAccount))
+		if err != nil {
+			t.Fatal(err)
+		}
+		total = total.Add(amount)
+	}
+
+	// Replaying the last revision fails and isn't counted.
+	rev, sig, err := pair.managedEAFundRevision(amounts[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	rev.NewRevisionNumber -= 2
+	sig = pair.managedSign(rev)
+	err = pay(modules.PaymentRequest{Type: modules.PayByContract}, newPayByContractRequest(rev, sig, refundAccount))
+	if err == nil {
+		t.Fatal("expected replayed revision to fail")
+	}
+
+	// Pay twice by ephemeral account.
+	sk, accountID := prepareAccount()
+	err = callDeposit(host.staticAccountManager, accountID, types.NewCurrency64(100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, amount := range []uint64{10, 20} {
+		pRequest := modules.PaymentRequest{Type: modules.PayByEphemeralAccount}
+		err = pay(pRequest, newPayByEphemeralAccountRequest(accountID, host.BlockHeight()+6, types.NewCurrency64(amount), sk))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Check the stats.
+	contracts, accounts := host.PaymentStats()
+	cs, exists := contracts[pair.staticFCID]
+	if !exists {
+		t.Fatal("no stats for contract")
+	}
+	if !cs.Amount.Equals(before.Amount.Add(total)) || !cs.Collateral.IsZero() || cs.NumPayments != before.NumPayments+uint64(len(amounts)) || !cs.LastPayment.After(before.LastPayment) {
+		t.Fatal("unexpected contract stats", cs)
+	}
+	as, exists := accounts[accountID]
+	if !exists {
+		t.Fatal("no stats for account")
+	}
+	if !as.Amount.Equals64(30) || !as.Collateral.IsZero() || as.NumPayments != 2 {
+		t.Fatal("unexpected account stats", as)
+	}
+	if _, exists := accounts[refundAccount]; exists {
+		t.Fatal("refund account shouldn't have stats")
+	}
+}
+
+// TestPaymentStatsRemove is a unit test for removing payment stats.
+func TestPaymentStatsRemove(t *testing.T) {
+	t.Parallel()
+
+	ps := newPaymentStats()
+	fcid := types.FileContractID{1}
+	_, accountID := prepareAccount()
+	ps.callTrackContractPayment(fcid, types.NewCurrency64(2), types.NewCurrency64(1))
+	ps.callTrackContractPayment(fcid, types.NewCurrency64(3), types.NewCurrency64(1))
+	ps.callTrackAccountPayment(accountID, types.NewCurrency64(4))
+
+	// The returned stats are a copy.
+	contracts, accounts := ps.callStats()
+	if cs := contracts[fcid]; !cs.Amount.Equals64(5) || !cs.Collateral.Equals64(2) || cs.NumPayments != 2 {
+		t.Fatal("unexpected contract stats", cs)
+	}
+	delete(contracts, fcid)
+	delete(accounts, accountID)
+
+	contracts, accounts = ps.callStats()
+	if len(contracts) != 1 || len(accounts) != 1 {
+		t.Fatal("stats were modified through the copy")
+	}
+
+	// Remove the stats.
+	ps.callRemoveContract(fcid)
+	ps.callRemoveAccount(accountID)
+	contracts, accounts = ps.callStats()
+	if len(contracts) != 0 || len(accounts) != 0 {
+		t.Fatal("stats weren't removed", contracts, accounts)
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"gitlab.com/NebulousLabs/Sia/build"
 	"gitlab.com/NebulousLabs/Sia/crypto"
 	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/modules/host/mdm"
 	"gitlab.com/NebulousLabs/Sia/persist"
 	"gitlab.com/NebulousLabs/Sia/types"
 )
@@ -61,6 +62,9 @@ func (h *Host) establishDefaults() error {
 		MaxReviseBatchSize:   uint64(modules.DefaultMaxReviseBatchSize),
 		WindowSize:           modules.DefaultWindowSize,
 
+		MaxQueuedContractPayments:  defaultMaxQueuedContractPayments,
+		MaxPayByContractCollateral: defaultMaxPayByContractCollateral,
+
 		Collateral:       modules.DefaultCollateral,
 		CollateralBudget: defaultCollateralBudget,
 		MaxCollateral:    modules.DefaultMaxCollateral,
@@ -75,6 +79,11 @@ func (h *Host) establishDefaults() error {
 		EphemeralAccountExpiry:     modules.DefaultEphemeralAccountExpiry,
 		MaxEphemeralAccountBalance: modules.DefaultMaxEphemeralAccountBalance,
 		MaxEphemeralAccountRisk:    defaultMaxEphemeralAccountRisk,
+
+		EphemeralAccountSpendingWindow: defaultEphemeralAccountSpendingWindow,
+
+		ProgramDataTimeout:     mdm.DefaultProgramDataTimeout,
+		MaxGainedSectorsMemory: defaultMaxGainedSectorsMemory,
 	}
 
 	// Load the host's key pair, use the same keys as the SiaMux.
@@ -144,6 +153,7 @@ func (h *Host) initDB() (err error) {
 		buckets := [][]byte{
 			bucketActionItems,
 			bucketStorageObligations,
+			bucketSectorHeights,
 		}
 		for _, bucket := range buckets {
 			_, err := tx.CreateBucketIfNotExists(bucket)
@@ -3,8 +3,6 @@ package host
 import (
 	"strings"
 	"testing"
-
-	"gitlab.com/NebulousLabs/Sia/modules"
 )
 
 // TestAccountBalance verifies the AccountBalance RPC.
@@ -130,9 +128,10 @@ func testAccountBalanceRefund(t *testing.T, rhp *renterHostPair) {
 func testAccountBalanceErrInsufficientBudget(t *testing.T, rhp *renterHostPair) {
 	// fundingAmt is insufficient by 1H.
 	fundingAmt := rhp.pt.AccountBalanceCost.Sub64(1)
-	// fetch the balance and pay for it by contract.
+	// fetch the balance and pay for it by contract. Since the RPC costs 1H,
+	// the payment doesn't transfer any money and is rejected as such.
 	_, err := rhp.managedAccountBalance(true, fundingAmt, rhp.staticAccountID, rhp.staticAccountID)
-	if err == nil || !strings.Contains(err.Error(), modules.ErrInsufficientPaymentForRPC.Error()) {
-		t.Fatal("expected ErrInsufficientPaymentForRPC but got: ", err)
+	if err == nil || !strings.Contains(err.Error(), ErrZeroValuePayment.Error()) {
+		t.Fatal("expected ErrZeroValuePayment but got: ", err)
 	}
 }
@@ -0,0 +1,104 @@
+package host
+
+import (
+	"fmt"
+
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/types"
+	"gitlab.com/NebulousLabs/errors"
+	"gitlab.com/NebulousLabs/siamux"
+)
+
+// errProofDeadlinePassed is returned when estimating a program for a contract
+// whose proof deadline has already passed.
+var errProofDeadlinePassed = errors.New("proof deadline of the contract has passed")
+
+// estimateProgramRequestMaxLen is the maximum length of an
+// RPCEstimateProgramRequest. Since the request contains the program data, it
+// allows for estimating programs that append a few sectors.
+var estimateProgramRequestMaxLen = 4*modules.SectorSize + modules.RPCMinLen
+
+// managedRPCEstimateProgram handles the RPC that estimates the cost of
+// executing a program. The program is decoded and the cost of its
+// instructions is computed using the renter's price table, but the program is
+// not executed. This allows the renter to confirm the cost of a program before
+// funding it. The renter pays for the bandwidth of the RPC and the cost of
+// initializing the program, the remaining payment is refunded.
+func (h *Host) managedRPCEstimateProgram(stream siamux.Stream) (err error) {
+	// read the price table
+	pt, err := h.staticReadPriceTableID(stream)
+	if err != nil {
+		return errors.AddContext(err, "failed to read price table")
+	}
+
+	// Process payment.
+	pd, err := h.ProcessPayment(stream, pt.HostBlockHeight)
+	if err != nil {
+		return errors.AddContext(err, "failed to process payment")
+	}
+
+	// Add limit to the stream. The readCost is the UploadBandwidthCost since
+	// reading from the stream means uploading from the host's perspective. That
+	// makes the writeCost the DownloadBandwidthCost.
+	budget := modules.NewBudget(pd.Amount())
+	bandwidthLimit := modules.NewBudgetLimit(budget, pt.UploadBandwidthCost, pt.DownloadBandwidthCost)
+	err = stream.SetLimit(bandwidthLimit)
+	if err != nil {
+		return errors.AddContext(err, "failed to set budget limit on stream")
+	}
+
+	// Refund the remaining budget at the end of the RPC.
+	defer func() {
+		refundErr := h.staticAccountManager.callRefund(pd.AccountID(), budget.Remaining())
+		err = errors.Compose(err, errors.AddContext(refundErr, "failed to refund client"))
+	}()
+
+	// Read request
+	var epr modules.RPCEstimateProgramRequest
+	err = modules.RPCReadMaxLen(stream, &epr, estimateProgramRequestMaxLen)
+	if err != nil {
+		return errors.AddContext(err, "failed to read RPCEstimateProgramRequest")
+	}
+	program := modules.Program(epr.Program)
+
+	// Charge for decoding the program before looking at it.
+	initCost := modules.MDMInitCost(pt, uint64(len(epr.ProgramData)), uint64(len(program)))
+	if !budget.Withdraw(initCost) {
+		return modules.ErrInsufficientPaymentForRPC
+	}
+
+	// The cost of some instructions depends on the remaining duration of the
+	// contract.
+	var duration types.BlockHeight
+	if program.RequiresSnapshot() {
+		sos, err := h.managedGetStorageObligationSnapshot(epr.FileContractID)
+		if err != nil {
+			return errors.AddContext(err, fmt.Sprintf("failed to get storage obligation snapshot for contract %v", epr.FileContractID))
+		}
+		// Use the height of the price table to be consistent with the
+		// prices the program is estimated with.
+		if sos.ProofDeadline() <= pt.HostBlockHeight {
+			return errors.AddContext(errProofDeadlinePassed, fmt.Sprintf("proof deadline %v of contract %v has passed at height %v", sos.ProofDeadline(), epr.FileContractID, pt.HostBlockHeight))
+		}
+		duration = sos.ProofDeadline() - pt.HostBlockHeight
+	}
+
+	// Estimate the program.
+	estimate, err := h.staticMDM.EstimateProgramCost(pt, program, epr.ProgramData, duration)
+	if err != nil {
+		return errors.AddContext(err, "failed to estimate program cost")
+	}
+
+	// Send response.
+	err = modules.RPCWrite(stream, modules.RPCEstimateProgramResponse{
+		AdditionalCollateral: estimate.AdditionalCollateral,
+		ExecutionCost:        estimate.ExecutionCost,
+		FailureRefund:        estimate.FailureRefund,
+		Memory:               estimate.Memory,
+		Time:                 estimate.Time,
+	})
+	if err != nil {
+		return errors.AddContext(err, "failed to send RPCEstimateProgramResponse")
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package host
+
+import (
+	"testing"
+
+	"gitlab.com/NebulousLabs/Sia/crypto"
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/types"
+	"gitlab.com/NebulousLabs/fastrand"
+)
+
+// TestEstimateProgram tests estimating the cost of a program with multiple
+// instructions using RPCEstimateProgram.
+func TestEstimateProgram(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	// create a testing pair.
+	rhp, err := newRenterHostPair(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := rhp.Close()
+		if err != nil {
+			t.Error(err)
+		}
+	}()
+	host := rhp.staticHT.host
+
+	// Get the remaining contract duration.
+	so, err := host.managedGetStorageObligation(rhp.staticFCID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	duration := so.proofDeadline() - host.BlockHeight()
+
+	// Create a program that appends a sector, checks for it and reads it.
+	sectorData := fastrand.Bytes(int(modules.SectorSize))
+	sectorRoot := crypto.MerkleRoot(sectorData)
+	pb := modules.NewProgramBuilder(rhp.managedPriceTable(), duration)
+	err = pb.AddAppendInstruction(sectorData, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pb.AddHasSectorInstruction(sectorRoot)
+	pb.AddReadSectorInstruction(modules.SectorSize, 0, sectorRoot, true)
+	program, data := pb.Program()
+	cost, refund, collateral := pb.Cost(true)
+
+	epr := modules.RPCEstimateProgramRequest{
+		FileContractID: rhp.staticFCID,
+		Program:        program,
+		ProgramData:    data,
+	}
+
+	// Fund an account to pay for the estimates.
+	pt := rhp.managedPriceTable()
+	funding := host.managedInternalSettings().MaxEphemeralAccountBalance
+	_, err = rhp.managedFundEphemeralAccount(funding.Add(pt.FundAccountCost), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payment := funding.Div64(4)
+
+	// Estimating the program without paying fails.
+	_, err = rhp.managedEstimateProgram(false, types.ZeroCurrency, epr)
+	if err == nil {
+		t.Fatal("expected estimating the program without payment to fail")
+	}
+
+	// Estimate the program. The host should only keep the cost of the
+	// estimate and refund the rest of the payment.
+	resp, err := rhp.managedEstimateProgram(false, payment, epr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	balance, err := rhp.managedAccountBalance(false, pt.AccountBalanceCost, rhp.staticAccountID, rhp.staticAccountID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	initCost := modules.MDMInitCost(pt, uint64(len(data)), uint64(len(program)))
+	spent := funding.Sub(balance).Sub(pt.AccountBalanceCost)
+	if spent.Cmp(initCost) < 0 || spent.Cmp(payment) >= 0 {
+		t.Fatalf("expected the unused payment to be refunded, spent %v of %v", spent, payment)
+	}
+	if !resp.ExecutionCost.Equals(cost) {
+		t.Fatalf("expected cost %v but got %v", cost, resp.ExecutionCost)
+	}
+	if !resp.FailureRefund.Equals(refund) {
+		t.Fatalf("expected refund %v but got %v", refund, resp.FailureRefund)
+	}
+	if !resp.AdditionalCollateral.Equals(collateral) {
+		t.Fatalf("expected collateral %v but got %v", collateral, resp.AdditionalCollateral)
+	}
+	if resp.Memory == 0 || resp.Time == 0 {
+		t.Fatal("expected memory and time to be set", resp.Memory, resp.Time)
+	}
+
+	// The program shouldn't have been executed.
+	if host.HasSector(sectorRoot) {
+		t.Fatal("estimating the program shouldn't store the sector")
+	}
+	recent, err := rhp.managedRecentHostRevision()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recent.NewFileSize != 0 {
+		t.Fatal("estimating the program shouldn't modify the contract")
+	}
+
+	// Estimating a program without instructions fails.
+	_, err = rhp.managedEstimateProgram(false, payment, modules.RPCEstimateProgramRequest{})
+	if err == nil {
+		t.Fatal("expected estimating an empty program to fail")
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"gitlab.com/NebulousLabs/Sia/build"
@@ -233,7 +235,9 @@ func (h *Host) managedRPCExecuteProgram(stream siamux.Stream) error {
 		return err
 	}
 
-	// Reset the deadline (set both read and write)
+	// Reset the deadline (set both read and write). The program data is no
+	// longer read from the stream at this point, so the read deadline it
+	// might have set is overwritten.
 	err = stream.SetDeadline(time.Now().Add(defaultConnectionDeadline))
 	if err != nil {
 		return errors.AddContext(err, "failed to set deadline on stream")
@@ -263,6 +267,34 @@ func (h *Host) managedRPCExecuteProgram(stream siamux.Stream) error {
 	return nil
 }
 
+// ActivePrograms returns information about the MDM programs the host is
+// currently executing.
+func (h *Host) ActivePrograms() []mdm.ActiveProgram {
+	return h.staticMDM.ActivePrograms()
+}
+
+// logInstructionTrace logs an instruction that was executed by the MDM.
+func (h *Host) logInstructionTrace(t mdm.InstructionTrace) {
+	h.log.Printf("MDM trace: contract %v, instruction %v/%v (%v), cost %v, refund %v, size %v, root %v, err %v",
+		t.ContractID, t.Index+1, t.NumInstructions, types.Specifier(t.Specifier), t.Cost.HumanString(), t.Refund.HumanString(), t.NewSize, t.NewMerkleRoot, t.Err)
+}
+
+// checkProgramTiming compares the measured execution time of an MDM
+// program to the time estimated by the instructions and logs the program if
+// it was a lot slower than estimated.
+func (h *Host) checkProgramTiming(pt mdm.ProgramTiming) {
+	estimated := pt.EstimatedDuration()
+	if pt.Duration < slowMDMProgramMinDuration || pt.Duration <= estimated*slowMDMProgramFactor {
+		return
+	}
+	atomic.AddUint64(&h.atomicSlowMDMPrograms, 1)
+	var instructions []string
+	for _, it := range pt.Instructions {
+		instructions = append(instructions, fmt.Sprintf("%v %v/%v", types.Specifier(it.Specifier), it.Duration, time.Duration(it.EstimatedTime)*mdm.EstimatedTimeUnit))
+	}
+	h.log.Printf("WARN: MDM program on contract %v took %v but was estimated to take %v: %v", pt.ContractID, pt.Duration, estimated, strings.Join(instructions, ", "))
+}
+
 // managedFinalizeWriteProgram conducts the additional steps required to
 // finalize a write program. The blockheight is passed in to make sure we are
 // using the same as when we ran the MDMD.
@@ -15,7 +15,9 @@ import (
 	"gitlab.com/NebulousLabs/Sia/build"
 	"gitlab.com/NebulousLabs/Sia/crypto"
 	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/modules/host/mdm"
 	"gitlab.com/NebulousLabs/Sia/modules/host/registry"
+	"gitlab.com/NebulousLabs/Sia/persist"
 	"gitlab.com/NebulousLabs/Sia/siatest/dependencies"
 	"gitlab.com/NebulousLabs/Sia/types"
 	"gitlab.com/NebulousLabs/encoding"
@@ -1612,3 +1614,46 @@ func TestExecuteReadRegistryProgram(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+// TestCheckProgramTiming verifies that only MDM programs which are a lot
+// slower than estimated are logged and counted.
+func TestCheckProgramTiming(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	logger, err := persist.NewLogger(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := &Host{log: logger}
+
+	// checkTiming runs the check on a program with a single instruction and
+	// returns whether it was considered slow.
+	checkTiming := func(d time.Duration, estimatedTime uint64) bool {
+		before := atomic.LoadUint64(&h.atomicSlowMDMPrograms)
+		h.checkProgramTiming(mdm.ProgramTiming{
+			Instructions: []mdm.InstructionTiming{{
+				Specifier:     modules.SpecifierReadSector,
+				Duration:      d,
+				EstimatedTime: estimatedTime,
+			}},
+			Duration:      d,
+			EstimatedTime: estimatedTime,
+		})
+		return atomic.LoadUint64(&h.atomicSlowMDMPrograms) != before
+	}
+
+	estimate := uint64(slowMDMProgramMinDuration / mdm.EstimatedTimeUnit)
+	if checkTiming(slowMDMProgramMinDuration, estimate) {
+		t.Fatal("program that took as long as estimated is slow")
+	}
+	if checkTiming(slowMDMProgramMinDuration/2, 0) {
+		t.Fatal("program below the minimum duration is slow")
+	}
+	if !checkTiming(slowMDMProgramMinDuration*(slowMDMProgramFactor+1), estimate) {
+		t.Fatal("program that took a lot longer than estimated isn't slow")
+	}
+	if !strings.Contains(buf.String(), "WARN: MDM program") {
+		t.Fatal("slow program wasn't logged", buf.String())
+	}
+}
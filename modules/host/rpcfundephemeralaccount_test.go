@@ -184,15 +184,14 @@ func TestFundEphemeralAccountRPC(t *testing.T) {
 		t.Fatalf("Expected error indicating the invalid revision, instead error was: '%v'", err)
 	}
 
-	// expect error when the funds we move are not enough to cover the cost
-	rev, sig, err = pair.managedEAFundRevision(pt.FundAccountCost.Sub64(1))
+	// expect error when the revision doesn't move any funds
+	rev, sig, err = pair.managedEAFundRevision(types.ZeroCurrency)
 	if err != nil {
 		t.Fatal(err)
 	}
 	_, _, err = runWithRequest(newPayByContractRequest(rev, sig, refundAccount))
-
-	if err == nil || !strings.Contains(err.Error(), "amount that was deposited did not cover the cost of the RPC") {
-		t.Fatalf("Expected error indicating the lack of funds, instead error was: '%v'", err)
+	if err == nil || !strings.Contains(err.Error(), ErrZeroValuePayment.Error()) {
+		t.Fatalf("Expected error '%v', instead error was '%v'", ErrZeroValuePayment, err)
 	}
 
 	// expect error when the funds exceed the host's max ephemeral account
@@ -0,0 +1,123 @@
+package host
+
+import (
+	"gitlab.com/NebulousLabs/Sia/crypto"
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/types"
+	"gitlab.com/NebulousLabs/bolt"
+	"gitlab.com/NebulousLabs/encoding"
+	"gitlab.com/NebulousLabs/errors"
+	"gitlab.com/NebulousLabs/siamux"
+)
+
+// managedRPCHasSector handles the RPC that asks the host whether it stores a
+// sector with a given root. The host only looks up the sector's location
+// without reading its data.
+func (h *Host) managedRPCHasSector(stream siamux.Stream) (err error) {
+	// read the price table
+	pt, err := h.staticReadPriceTableID(stream)
+	if err != nil {
+		return errors.AddContext(err, "failed to read price table")
+	}
+
+	// Process payment.
+	pd, err := h.ProcessPayment(stream, pt.HostBlockHeight)
+	if err != nil {
+		return errors.AddContext(err, "failed to process payment")
+	}
+
+	// Check payment.
+	cost := modules.MDMHasSectorCost(pt)
+	if pd.Amount().Cmp(cost) < 0 {
+		return modules.ErrInsufficientPaymentForRPC
+	}
+
+	// Refund excessive payment.
+	refund := pd.Amount().Sub(cost)
+	if !refund.IsZero() {
+		err = h.staticAccountManager.callRefund(pd.AccountID(), refund)
+		if err != nil {
+			return errors.AddContext(err, "failed to refund excessive payment")
+		}
+	}
+
+	// Read request
+	var hsr modules.RPCHasSectorRequest
+	err = modules.RPCRead(stream, &hsr)
+	if err != nil {
+		return errors.AddContext(err, "failed to read HasSectorRequest")
+	}
+
+	// Look up the sector.
+	resp := modules.RPCHasSectorResponse{
+		HasSector: h.HasSector(hsr.Root),
+	}
+	if resp.HasSector {
+		resp.StorageAge, resp.StorageAgeKnown, err = h.managedSectorStorageAge(hsr.Root)
+		if err != nil {
+			return errors.AddContext(err, "failed to look up the storage age of the sector")
+		}
+	}
+
+	// Send response.
+	err = modules.RPCWrite(stream, resp)
+	if err != nil {
+		return errors.AddContext(err, "failed to send HasSectorResponse")
+	}
+	return nil
+}
+
+// managedSectorStorageAge returns the number of blocks since the host started
+// storing the sector with the given root. The age isn't known for sectors the
+// host stored before it began tracking their heights.
+func (h *Host) managedSectorStorageAge(root crypto.Hash) (age types.BlockHeight, known bool, err error) {
+	h.mu.RLock()
+	blockHeight := h.blockHeight
+	h.mu.RUnlock()
+
+	var height types.BlockHeight
+	err = h.db.View(func(tx *bolt.Tx) error {
+		heightBytes := tx.Bucket(bucketSectorHeights).Get(root[:])
+		if heightBytes == nil {
+			return nil
+		}
+		known = true
+		return encoding.Unmarshal(heightBytes, &height)
+	})
+	if err != nil || !known {
+		return 0, false, err
+	}
+	if height > blockHeight {
+		return 0, true, nil
+	}
+	return blockHeight - height, true, nil
+}
+
+// putSectorHeights records the given height as the height at which the host
+// started storing the sectors with the given roots.
+func putSectorHeights(tx *bolt.Tx, roots []crypto.Hash, height types.BlockHeight) error {
+	b := tx.Bucket(bucketSectorHeights)
+	for _, root := range roots {
+		err := b.Put(root[:], encoding.Marshal(height))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteSectorHeights removes the heights of the sectors with the given roots
+// that the host no longer stores.
+func (h *Host) deleteSectorHeights(tx *bolt.Tx, roots []crypto.Hash) error {
+	b := tx.Bucket(bucketSectorHeights)
+	for _, root := range roots {
+		if h.HasSector(root) {
+			continue
+		}
+		err := b.Delete(root[:])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package host
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"gitlab.com/NebulousLabs/Sia/build"
+	"gitlab.com/NebulousLabs/Sia/crypto"
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/types"
+	"gitlab.com/NebulousLabs/fastrand"
+)
+
+// TestHasSector tests asking the host whether it stores a sector using
+// RPCHasSector.
+func TestHasSector(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	// create a blank host tester
+	rhp, err := newRenterHostPair(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := rhp.Close()
+		if err != nil {
+			t.Error(err)
+		}
+	}()
+	host := rhp.staticHT.host
+	cost := modules.MDMHasSectorCost(rhp.pt)
+
+	// The host shouldn't have a random sector.
+	sectorData := fastrand.Bytes(int(modules.SectorSize))
+	root := crypto.MerkleRoot(sectorData)
+	resp, err := rhp.managedHasSector(true, cost, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.HasSector || resp.StorageAgeKnown {
+		t.Fatal("host shouldn't have the sector", resp)
+	}
+
+	// Add the sector. Now the host should have it. Since it wasn't added to
+	// a contract, its storage age is unknown.
+	err = host.AddSector(root, sectorData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err = rhp.managedHasSector(true, cost, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resp.HasSector {
+		t.Fatal("host should have the sector")
+	}
+	if resp.StorageAgeKnown {
+		t.Fatal("storage age of the sector shouldn't be known", resp.StorageAge)
+	}
+
+	// Add a sector to the contract. Its storage age should be known.
+	sectorData = fastrand.Bytes(int(modules.SectorSize))
+	root = crypto.MerkleRoot(sectorData)
+	host.managedLockStorageObligation(rhp.staticFCID)
+	so, err := host.managedGetStorageObligation(rhp.staticFCID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	so.SectorRoots = append(so.SectorRoots, root)
+	err = host.managedModifyStorageObligation(so, nil, map[crypto.Hash][]byte{root: sectorData})
+	host.managedUnlockStorageObligation(rhp.staticFCID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err = rhp.managedHasSector(true, cost, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resp.HasSector || !resp.StorageAgeKnown || resp.StorageAge != 0 {
+		t.Fatal("unexpected response for a new sector", resp)
+	}
+
+	// The storage age should increase with the block height.
+	_, err = rhp.staticHT.miner.AddBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = build.Retry(100, 100*time.Millisecond, func() error {
+		resp, err = rhp.managedHasSector(true, cost, root)
+		if err != nil {
+			return err
+		}
+		if !resp.StorageAgeKnown || resp.StorageAge != 1 {
+			return fmt.Errorf("expected a storage age of 1 but got %v", resp.StorageAge)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Once the sector is removed from the contract, the host no longer has
+	// it and forgets its storage age.
+	host.managedLockStorageObligation(rhp.staticFCID)
+	so, err = host.managedGetStorageObligation(rhp.staticFCID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	so.SectorRoots = so.SectorRoots[:len(so.SectorRoots)-1]
+	err = host.managedModifyStorageObligation(so, []crypto.Hash{root}, nil)
+	host.managedUnlockStorageObligation(rhp.staticFCID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, known, err := host.managedSectorStorageAge(root); err != nil || known {
+		t.Fatal("storage age of a removed sector should be unknown", known, err)
+	}
+
+	// A payment that doesn't transfer any money should be rejected.
+	_, err = rhp.managedHasSector(true, types.ZeroCurrency, root)
+	if err == nil || !strings.Contains(err.Error(), ErrZeroValuePayment.Error()) {
+		t.Fatalf("expected %v but got: %v", ErrZeroValuePayment, err)
+	}
+}
@@ -325,7 +325,8 @@ func testUpdatePriceTableAfterSettingsUpdate(t *testing.T, rhp *renterHostPair)
 // testUpdatePriceTableInsufficientPayment verifies the RPC fails if payment
 // supplied through the payment revision did not cover the RPC cost
 func testUpdatePriceTableInsufficientPayment(t *testing.T, rhp *renterHostPair) {
-	// create a payment revision
+	// create a payment revision, since the RPC costs 1H the only insufficient
+	// payment is a zero value payment which is rejected as such.
 	rev, sig, err := rhp.managedEAFundRevision(types.ZeroCurrency)
 	if err != nil {
 		t.Fatal(err)
@@ -334,8 +335,8 @@ func testUpdatePriceTableInsufficientPayment(t *testing.T, rhp *renterHostPair)
 	// execute the RPC request
 	request := newPayByContractRequest(rev, sig, rhp.staticAccountID)
 	_, err = runUpdatePriceTableRPCWithRequest(rhp, request)
-	if err == nil || !strings.Contains(err.Error(), modules.ErrInsufficientPaymentForRPC.Error()) {
-		t.Fatalf("Expected error '%v', instead error was '%v'", modules.ErrInsufficientPaymentForRPC, err)
+	if err == nil || !strings.Contains(err.Error(), ErrZeroValuePayment.Error()) {
+		t.Fatalf("Expected error '%v', instead error was '%v'", ErrZeroValuePayment, err)
 	}
 }
 
@@ -0,0 +1,117 @@
+package host
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"gitlab.com/NebulousLabs/Sia/crypto"
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/errors"
+)
+
+// flushedSectorsDir is the name of the directory within the host's persist
+// directory that holds the data of the sectors MDM programs flushed out of
+// memory.
+const flushedSectorsDir = "flushedsectors"
+
+// sectorFlusher implements the mdm.SectorFlusher interface by writing the data
+// of flushed sectors to files named after their merkle roots. Since the files
+// are content addressed, programs flushing the same sector share its file. The
+// flushes of every sector are counted and its file is removed once all of them
+// were removed again. The directory is also cleared whenever the host starts or
+// stops in case the host didn't shut down cleanly.
+type sectorFlusher struct {
+	staticDir string
+	refs      map[crypto.Hash]uint64
+	mu        sync.Mutex
+}
+
+// newSectorFlusher creates a flusher that stores sectors within dir.
+func newSectorFlusher(dir string) *sectorFlusher {
+	return &sectorFlusher{
+		staticDir: dir,
+		refs:      make(map[crypto.Hash]uint64),
+	}
+}
+
+// FlushSector implements the mdm.SectorFlusher interface. The data is written
+// to a temporary file first and then renamed to avoid concurrent flushes of the
+// same sector from exposing partially written files.
+func (sf *sectorFlusher) FlushSector(root crypto.Hash, data []byte) (err error) {
+	f, err := ioutil.TempFile(sf.staticDir, root.String()+"-*.tmp")
+	if err != nil {
+		return errors.AddContext(err, "failed to create temporary sector file")
+	}
+	defer func() {
+		if err != nil {
+			err = errors.Compose(err, os.Remove(f.Name()))
+		}
+	}()
+	_, err = f.Write(data)
+	err = errors.Compose(err, f.Close())
+	if err != nil {
+		return errors.AddContext(err, "failed to write sector file")
+	}
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	err = os.Rename(f.Name(), sf.sectorPath(root))
+	if err != nil {
+		return errors.AddContext(err, "failed to rename sector file")
+	}
+	sf.refs[root]++
+	return nil
+}
+
+// RemoveFlushedSector implements the mdm.SectorFlusher interface. The file of
+// the sector is only removed once every flush of the sector was removed.
+func (sf *sectorFlusher) RemoveFlushedSector(root crypto.Hash) error {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	refs, exists := sf.refs[root]
+	if !exists {
+		return fmt.Errorf("sector %v wasn't flushed", root)
+	}
+	if refs > 1 {
+		sf.refs[root] = refs - 1
+		return nil
+	}
+	delete(sf.refs, root)
+	return errors.AddContext(os.Remove(sf.sectorPath(root)), "failed to remove sector file")
+}
+
+// ReadFlushedSector implements the mdm.SectorFlusher interface.
+func (sf *sectorFlusher) ReadFlushedSector(root crypto.Hash) ([]byte, error) {
+	data, err := ioutil.ReadFile(sf.sectorPath(root))
+	if err != nil {
+		return nil, errors.AddContext(err, "failed to read sector file")
+	}
+	if uint64(len(data)) != modules.SectorSize {
+		return nil, fmt.Errorf("flushed sector %v has length %v", root, len(data))
+	}
+	return data, nil
+}
+
+// reset removes all previously flushed sectors and recreates the directory.
+func (sf *sectorFlusher) reset() error {
+	sf.mu.Lock()
+	sf.refs = make(map[crypto.Hash]uint64)
+	sf.mu.Unlock()
+	if err := sf.remove(); err != nil {
+		return err
+	}
+	return os.MkdirAll(sf.staticDir, 0700)
+}
+
+// remove removes the flusher's directory including all flushed sectors.
+func (sf *sectorFlusher) remove() error {
+	return errors.AddContext(os.RemoveAll(sf.staticDir), "failed to remove flushed sectors")
+}
+
+// sectorPath returns the path of the file holding the data of the sector with
+// the given root.
+func (sf *sectorFlusher) sectorPath(root crypto.Hash) string {
+	return filepath.Join(sf.staticDir, root.String())
+}
@@ -0,0 +1,93 @@
+package host
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gitlab.com/NebulousLabs/Sia/build"
+	"gitlab.com/NebulousLabs/Sia/crypto"
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/fastrand"
+)
+
+// TestSectorFlusher tests flushing sectors to disk and reading them back.
+func TestSectorFlusher(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	dir := filepath.Join(build.TempDir(modules.HostDir, t.Name()), flushedSectorsDir)
+	sf := newSectorFlusher(dir)
+	if err := sf.reset(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Flush a sector and read it back.
+	data := fastrand.Bytes(int(modules.SectorSize))
+	root := crypto.MerkleRoot(data)
+	if err := sf.FlushSector(root, data); err != nil {
+		t.Fatal(err)
+	}
+	readData, err := sf.ReadFlushedSector(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(readData, data) {
+		t.Fatal("flushed data doesn't match")
+	}
+
+	// Flushing the same sector again should be possible.
+	if err := sf.FlushSector(root, data); err != nil {
+		t.Fatal(err)
+	}
+
+	// Reading a sector that wasn't flushed should fail.
+	if _, err := sf.ReadFlushedSector(crypto.Hash{1}); err == nil {
+		t.Fatal("expected error")
+	}
+
+	// The sector was flushed twice so removing it once should keep its data.
+	if err := sf.RemoveFlushedSector(root); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sf.ReadFlushedSector(root); err != nil {
+		t.Fatal(err)
+	}
+	// Removing it again should delete the file.
+	if err := sf.RemoveFlushedSector(root); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(sf.sectorPath(root)); !os.IsNotExist(err) {
+		t.Fatal("expected sector file to be removed", err)
+	}
+	// Removing a sector that isn't flushed should fail.
+	if err := sf.RemoveFlushedSector(root); err == nil {
+		t.Fatal("expected error")
+	}
+	if err := sf.FlushSector(root, data); err != nil {
+		t.Fatal(err)
+	}
+
+	// Resetting the flusher should remove the flushed sectors but keep the
+	// directory.
+	if err := sf.reset(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sf.ReadFlushedSector(root); err == nil {
+		t.Fatal("expected error")
+	}
+	if err := sf.FlushSector(root, data); err != nil {
+		t.Fatal(err)
+	}
+
+	// Removing the flusher should remove the directory.
+	if err := sf.remove(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Fatal("expected directory to be removed", err)
+	}
+}
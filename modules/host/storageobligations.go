@@ -803,11 +803,12 @@ func (h *Host) updateFinancialMetricsUpdateSO(oldSO, newSO storageObligation) {
 // Virtual sectors will be removed the number of times that they are listed, to
 // remove multiple instances of the same virtual sector, the virtual sector
 // will need to appear in 'sectorsRemoved' multiple times. Same with
-// 'sectorsGained'.
+// 'sectorsGained'. Sectors gained with nil data were flushed to disk by an MDM
+// program and are read back one at a time while being added.
 func (h *Host) managedModifyStorageObligation(so storageObligation, sectorsRemoved []crypto.Hash, sectorsGained map[crypto.Hash][]byte) error {
 	// Sanity check - all of the sector data should be modules.SectorSize
 	for _, data := range sectorsGained {
-		if uint64(len(data)) != modules.SectorSize {
+		if data != nil && uint64(len(data)) != modules.SectorSize {
 			h.log.Critical("modifying a revision with garbage sector sizes", len(data))
 			return errInsaneStorageObligationRevision
 		}
@@ -845,9 +846,26 @@ func (h *Host) managedModifyStorageObligation(so storageObligation, sectorsRemov
 	// and left to consistency checks and user actions to fix (will reduce host
 	// capacity, but will not inhibit the host's ability to submit storage
 	// proofs)
-	var added []crypto.Hash
+	var added, stored []crypto.Hash
 	var err error
 	for sectorRoot, data := range sectorsGained {
+		if data == nil {
+			data, err = h.staticSectorFlusher.ReadFlushedSector(sectorRoot)
+			if err != nil {
+				err = errors.AddContext(err, "failed to read flushed sector")
+				break
+			}
+			if uint64(len(data)) != modules.SectorSize {
+				h.log.Critical("modifying a revision with garbage flushed sector sizes", len(data))
+				err = errInsaneStorageObligationRevision
+				break
+			}
+		}
+		// Remember the sectors the host didn't store before to record when
+		// it started storing them.
+		if !h.HasSector(sectorRoot) {
+			stored = append(stored, sectorRoot)
+		}
 		err = h.AddSector(sectorRoot, data)
 		if err != nil {
 			break
@@ -879,6 +897,13 @@ func (h *Host) managedModifyStorageObligation(so storageObligation, sectorsRemov
 			return err
 		}
 
+		// Record the height at which the host started storing the new
+		// sectors.
+		err = putSectorHeights(tx, stored, hostHeight)
+		if err != nil {
+			return err
+		}
+
 		// Store the new storage obligation to replace the old one.
 		return putStorageObligation(tx, so)
 	})
@@ -899,6 +924,14 @@ func (h *Host) managedModifyStorageObligation(so storageObligation, sectorsRemov
 		// place to be, especially if the host can run consistency checks.
 		_ = h.RemoveSector(sectorsRemoved[k])
 	}
+	if len(sectorsRemoved) > 0 {
+		err = h.db.Update(func(tx *bolt.Tx) error {
+			return h.deleteSectorHeights(tx, sectorsRemoved)
+		})
+		if err != nil {
+			h.log.Println("Failed to delete the heights of removed sectors:", err)
+		}
+	}
 
 	// Update the financial information for the storage obligation
 	h.updateFinancialMetricsUpdateSO(oldSO, so)
@@ -945,6 +978,10 @@ func (h *Host) removeStorageObligation(so storageObligation, sos storageObligati
 	// there are problems - disk health information will be updated.
 	_ = h.RemoveSectorBatch(so.SectorRoots)
 
+	// Drop the payment stats and read metrics of the contract.
+	h.staticPaymentStats.callRemoveContract(so.id())
+	h.staticMDM.RemoveContractReadMetrics(so.id())
+
 	// Update the host revenue metrics based on the status of the obligation.
 	if sos == obligationUnresolved {
 		h.log.Critical("storage obligation 'unresolved' during call to removeStorageObligation, id", so.id())
@@ -1024,9 +1061,14 @@ func (h *Host) removeStorageObligation(so storageObligation, sos storageObligati
 	// ended up, and the sector roots are removed because they are large
 	// objects with little purpose once storage proofs are no longer needed.
 	h.financialMetrics.ContractCount--
+	sectorRoots := so.SectorRoots
 	so.ObligationStatus = sos
 	so.SectorRoots = nil
 	return h.db.Update(func(tx *bolt.Tx) error {
+		err := h.deleteSectorHeights(tx, sectorRoots)
+		if err != nil {
+			return err
+		}
 		return putStorageObligation(tx, so)
 	})
 }
@@ -1415,6 +1457,7 @@ func (h *Host) StorageObligations() (sos []modules.StorageObligation) {
 			}
 
 			valid, missed := so.payouts()
+			rm := h.staticMDM.ContractReadMetrics(so.id())
 			mso := modules.StorageObligation{
 				ContractCost:             so.ContractCost,
 				DataSize:                 so.fileSize(),
@@ -1426,7 +1469,10 @@ func (h *Host) StorageObligations() (sos []modules.StorageObligation) {
 				PotentialStorageRevenue:  so.PotentialStorageRevenue,
 				PotentialUploadRevenue:   so.PotentialUploadRevenue,
 				RiskedCollateral:         so.RiskedCollateral,
+				CollateralExposure:       payoutAtRisk(valid[1].Value, missed[1].Value),
 				SectorRootsCount:         uint64(len(so.SectorRoots)),
+				MDMCacheReadBytes:        rm.CacheBytes,
+				MDMDiskReadBytes:         rm.DiskBytes,
 				TransactionFeesAdded:     so.TransactionFeesAdded,
 				TransactionID:            so.transactionID(),
 
@@ -13,6 +13,10 @@ var (
 	// being submitted, if there is another renter altering the contract, or if
 	// there have been network connections with have not resolved yet.
 	ErrObligationLocked = errors.New("the requested file contract is currently locked")
+
+	// ErrContractBusy is returned if too many payments are already waiting to
+	// acquire the lock of the file contract being requested.
+	ErrContractBusy = errors.New("too many payments are queued on the requested file contract")
 )
 
 // managedLockStorageObligation puts a storage obligation under lock in the
@@ -33,6 +37,34 @@ func (h *Host) managedLockStorageObligation(soid types.FileContractID) {
 	lo.mu.Lock()
 }
 
+// managedLockStorageObligationForPayment puts a storage obligation under lock
+// for a payment. If maxQueued payments are already waiting for the lock,
+// ErrContractBusy is returned without waiting. A maxQueued of 0 means that
+// there is no limit to the number of waiting payments.
+func (h *Host) managedLockStorageObligationForPayment(soid types.FileContractID, maxQueued uint64) error {
+	h.mu.Lock()
+	lo, exists := h.lockedStorageObligations[soid]
+	if !exists {
+		lo = &lockedObligation{}
+		h.lockedStorageObligations[soid] = lo
+	}
+	if maxQueued > 0 && lo.queuedPayments >= maxQueued {
+		h.mu.Unlock()
+		return ErrContractBusy
+	}
+	lo.n++
+	lo.queuedPayments++
+	h.mu.Unlock()
+
+	lo.mu.Lock()
+
+	// The payment is no longer waiting.
+	h.mu.Lock()
+	lo.queuedPayments--
+	h.mu.Unlock()
+	return nil
+}
+
 // managedTryLockStorageObligation attempts to put a storage obligation under
 // lock, returning an error if the lock cannot be obtained.
 func (h *Host) managedTryLockStorageObligation(soid types.FileContractID, timeout time.Duration) error {
@@ -1,6 +1,9 @@
 package host
 
 import (
+	"fmt"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -113,3 +116,103 @@ func TestObligationLocks(t *testing.T) {
 	}
 	ht.host.managedUnlockStorageObligation(ob1)
 }
+
+// TestObligationLockForPaymentQueue checks that the number of payments waiting
+// on the lock of a single storage obligation is bounded and that payments
+// beyond that bound fail fast with ErrContractBusy.
+func TestObligationLockForPaymentQueue(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+	ht, err := blankHostTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := ht.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	h := ht.host
+
+	// Check the default setting.
+	if h.InternalSettings().MaxQueuedContractPayments != defaultMaxQueuedContractPayments {
+		t.Fatal("unexpected default", h.InternalSettings().MaxQueuedContractPayments)
+	}
+
+	// Hold the lock of the obligation.
+	fcid := types.FileContractID{1}
+	h.managedLockStorageObligation(fcid)
+
+	// Queue up the max number of payments.
+	maxQueued := uint64(3)
+	var wg sync.WaitGroup
+	var acquired uint64
+	for i := uint64(0); i < maxQueued; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := h.managedLockStorageObligationForPayment(fcid, maxQueued)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			atomic.AddUint64(&acquired, 1)
+			h.managedUnlockStorageObligation(fcid)
+		}()
+	}
+
+	// Wait for all payments to be queued.
+	err = build.Retry(100, 10*time.Millisecond, func() error {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		if queued := h.lockedStorageObligations[fcid].queuedPayments; queued != maxQueued {
+			return fmt.Errorf("expected %v queued payments but got %v", maxQueued, queued)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Another payment should fail right away instead of waiting.
+	start := time.Now()
+	err = h.managedLockStorageObligationForPayment(fcid, maxQueued)
+	if !errors.Contains(err, ErrContractBusy) {
+		t.Fatalf("expected %v but got %v", ErrContractBusy, err)
+	}
+	if time.Since(start) > time.Second {
+		t.Fatal("payment waited for the lock", time.Since(start))
+	}
+
+	// Without a limit the payment is queued.
+	done := make(chan error)
+	go func() {
+		done <- h.managedLockStorageObligationForPayment(fcid, 0)
+	}()
+	select {
+	case <-done:
+		t.Fatal("payment acquired a lock that is held")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// Release the lock. All payments should succeed.
+	h.managedUnlockStorageObligation(fcid)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	h.managedUnlockStorageObligation(fcid)
+	wg.Wait()
+	if atomic.LoadUint64(&acquired) != maxQueued {
+		t.Fatalf("expected %v payments to acquire the lock but got %v", maxQueued, acquired)
+	}
+
+	// The obligation shouldn't be locked anymore.
+	h.mu.Lock()
+	_, locked := h.lockedStorageObligations[fcid]
+	h.mu.Unlock()
+	if locked {
+		t.Fatal("obligation should be unlocked")
+	}
+}
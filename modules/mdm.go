@@ -38,6 +38,10 @@ const (
 	// MDMCancellationTokenLen is the length of a program's cancellation token
 	// in bytes.
 	MDMCancellationTokenLen = 16
+
+	// MDMMaxSectorReads is the maximum number of reads a single 'ReadSectors'
+	// instruction may contain.
+	MDMMaxSectorReads = 64
 )
 
 const (
@@ -105,6 +109,10 @@ const (
 	// instruction.
 	RPCIReadSectorLen = 25
 
+	// RPCIReadSectorsLen is the expected length of the 'Args' of a
+	// ReadSectors instruction.
+	RPCIReadSectorsLen = 17 // reads offset + number of reads + merkle proof flag
+
 	// RPCIReadOffsetLen is the expected length of the 'Args' of a ReadOffset
 	// instruction.
 	RPCIReadOffsetLen = 17
@@ -155,6 +163,9 @@ var (
 	// SpecifierReadSector is the specifier for the ReadSector instruction.
 	SpecifierReadSector = InstructionSpecifier{'R', 'e', 'a', 'd', 'S', 'e', 'c', 't', 'o', 'r'}
 
+	// SpecifierReadSectors is the specifier for the ReadSectors instruction.
+	SpecifierReadSectors = InstructionSpecifier{'R', 'e', 'a', 'd', 'S', 'e', 'c', 't', 'o', 'r', 's'}
+
 	// SpecifierRevision is the specifier for the Revision instruction.
 	SpecifierRevision = InstructionSpecifier{'R', 'e', 'v', 'i', 's', 'i', 'o', 'n'}
 
@@ -190,6 +201,17 @@ type (
 		RevisionTxn types.Transaction
 	}
 
+	// MDMSectorRead describes a range of a sector that is read by a
+	// 'ReadSectors' instruction. If the instruction is asked for a Merkle
+	// proof, every read has to cover a full sector since the proof only
+	// proves the roots of the read sectors and contains no range proofs
+	// within them.
+	MDMSectorRead struct {
+		MerkleRoot crypto.Hash
+		Offset     uint64
+		Length     uint64
+	}
+
 	// SubscriptionID is a hash derived from the public key and tweak that a
 	// renter would like to subscribe to.
 	SubscriptionID crypto.Hash
@@ -226,6 +248,10 @@ func RPCIReadSector(rootOff, offsetOff, lengthOff uint64, merkleProof bool) Inst
 	}
 }
 
+// MDMSectorReadSize is the size of a single MDMSectorRead within the program
+// data of a 'ReadSectors' instruction.
+const MDMSectorReadSize = crypto.HashSize + 8 + 8
+
 // MDMAppendCost is the cost of executing an 'Append' instruction.
 func MDMAppendCost(pt *RPCPriceTable, duration types.BlockHeight) (types.Currency, types.Currency) {
 	// Cost for writing the Data.
@@ -266,6 +292,13 @@ func MDMReadCost(pt *RPCPriceTable, readLength uint64) types.Currency {
 	return cost
 }
 
+// MDMReadSectorsCost is the cost of executing a 'ReadSectors' instruction. It
+// is the cost of executing a 'Read' instruction for each of the reads.
+func MDMReadSectorsCost(pt *RPCPriceTable, numReads, totalLength uint64) types.Currency {
+	cost := pt.ReadLengthCost.Mul64(totalLength).Add(pt.ReadBaseCost.Mul64(numReads))
+	return cost
+}
+
 // MDMRevisionCost is the cost of executing a 'Revision' instruction.
 func MDMRevisionCost(pt *RPCPriceTable) types.Currency {
 	cost := pt.RevisionBaseCost
@@ -385,6 +418,12 @@ func MDMReadMemory() uint64 {
 	return 0 // 'Read' doesn't hold on to any memory beyond the lifetime of the instruction.
 }
 
+// MDMReadSectorsMemory returns the additional memory consumption of a
+// 'ReadSectors' instruction given the total length of its reads.
+func MDMReadSectorsMemory(totalLength uint64) uint64 {
+	return totalLength // The data of all reads is buffered for the output of the instruction.
+}
+
 // MDMRevisionMemory returns the additional memory consumption of a 'Revision'
 // instruction.
 func MDMRevisionMemory() uint64 {
@@ -428,6 +467,12 @@ func MDMDropSectorsTime(numSectorsDropped uint64) uint64 {
 	return MDMTimeDropSectorsBase + MDMTimeDropSingleSector*numSectorsDropped
 }
 
+// MDMReadSectorsTime returns the time for a 'ReadSectors' instruction given
+// `numReads`.
+func MDMReadSectorsTime(numReads uint64) uint64 {
+	return MDMTimeReadSector * numReads
+}
+
 // MDMAppendCollateral returns the additional collateral a 'Append' instruction
 // requires the host to put up.
 func MDMAppendCollateral(pt *RPCPriceTable) types.Currency {
@@ -487,6 +532,7 @@ func (p Program) ReadOnly() bool {
 		case SpecifierHasSector:
 		case SpecifierReadOffset:
 		case SpecifierReadSector:
+		case SpecifierReadSectors:
 		case SpecifierRevision:
 		case SpecifierSwapSector:
 			return false
@@ -515,6 +561,8 @@ func (p Program) RequiresSnapshot() bool {
 		case SpecifierReadOffset:
 			return true
 		case SpecifierReadSector:
+		case SpecifierReadSectors:
+			return true
 		case SpecifierRevision:
 			return true
 		case SpecifierSwapSector:
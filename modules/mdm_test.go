@@ -216,6 +216,11 @@ func TestRequiresReadonlyAndSnapshot(t *testing.T) {
 			true,
 			false,
 		},
+		{
+			SpecifierReadSectors,
+			true,
+			true,
+		},
 		{
 			SpecifierRevision,
 			true,
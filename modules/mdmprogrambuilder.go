@@ -144,6 +144,31 @@ func (pb *ProgramBuilder) AddReadSectorInstruction(length, offset uint64, merkle
 	pb.addInstruction(collateral, cost, types.ZeroCurrency, memory, time)
 }
 
+// AddReadSectorsInstruction adds a ReadSectors instruction to the program.
+func (pb *ProgramBuilder) AddReadSectorsInstruction(reads []MDMSectorRead, merkleProof bool) {
+	// Compute the argument offsets.
+	readsOffset := uint64(pb.programData.Len())
+	// Extend the programData.
+	var totalLength uint64
+	for _, read := range reads {
+		binary.Write(pb.programData, binary.LittleEndian, read.MerkleRoot[:])
+		binary.Write(pb.programData, binary.LittleEndian, read.Offset)
+		binary.Write(pb.programData, binary.LittleEndian, read.Length)
+		totalLength += read.Length
+	}
+	// Create the instruction.
+	numReads := uint64(len(reads))
+	i := NewReadSectorsInstruction(readsOffset, numReads, merkleProof)
+	// Append instruction
+	pb.program = append(pb.program, i)
+	// Update cost, collateral and memory usage.
+	collateral := MDMReadCollateral()
+	cost := MDMReadSectorsCost(pb.staticPT, numReads, totalLength)
+	memory := MDMReadSectorsMemory(totalLength)
+	time := MDMReadSectorsTime(numReads)
+	pb.addInstruction(collateral, cost, types.ZeroCurrency, memory, time)
+}
+
 // AddRevisionInstruction adds a Revision instruction to the program.
 func (pb *ProgramBuilder) AddRevisionInstruction() {
 	// Compute the argument offsets.
@@ -434,6 +459,20 @@ func NewReadSectorInstruction(lengthOffset, offsetOffset, merkleRootOffset uint6
 	return i
 }
 
+// NewReadSectorsInstruction creates a modules.Instruction from arguments.
+func NewReadSectorsInstruction(readsOffset, numReads uint64, merkleProof bool) Instruction {
+	i := Instruction{
+		Specifier: SpecifierReadSectors,
+		Args:      make([]byte, RPCIReadSectorsLen),
+	}
+	binary.LittleEndian.PutUint64(i.Args[:8], readsOffset)
+	binary.LittleEndian.PutUint64(i.Args[8:16], numReads)
+	if merkleProof {
+		i.Args[16] = 1
+	}
+	return i
+}
+
 // NewSwapSectorInstruction creates a modules.Instruction from arguments.
 func NewSwapSectorInstruction(sector1Offset, sector2Offset uint64, merkleProof bool) Instruction {
 	i := Instruction{
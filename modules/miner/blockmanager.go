@@ -165,7 +165,17 @@ func (m *Miner) HeaderForWork() (types.BlockHeader, types.Target, error) {
 
 // managedSubmitBlock takes a solved block and submits it to the blockchain.
 func (m *Miner) managedSubmitBlock(b types.Block) error {
-	// Give the block to the consensus set.
+	// Reject blocks with invalid timestamps before handing them to the
+	// consensus set. If the parent is unknown, consensus will deal with it.
+	if minTimestamp, exists := m.cs.MinimumValidChildTimestamp(b.ParentID); exists {
+		if err := types.ValidTimestamp(b.Timestamp, minTimestamp, types.CurrentTimestamp()); err != nil {
+			return errors.AddContext(err, "invalid block timestamp")
+		}
+	}
+
+	// Give the block to the consensus set. Blocks beyond the FutureThreshold
+	// are held by consensus until they are no longer in the future.
+	future := b.Timestamp > types.CurrentTimestamp()+types.FutureThreshold
 	err := m.cs.AcceptBlock(b)
 	// Add the miner to the blocks list if the only problem is that it's stale.
 	if errors.Contains(err, modules.ErrNonExtendingBlock) {
@@ -179,6 +189,10 @@ func (m *Miner) managedSubmitBlock(b types.Block) error {
 		m.log.Println("Mined an unsolved block - header submission appears to be incorrect")
 		return err
 	}
+	if err != nil && future {
+		m.log.Println("Mined a block with a future timestamp - consensus will accept it once it is no longer in the future:", err)
+		return err
+	}
 	if err != nil {
 		m.tpool.PurgeTransactionPool()
 		m.log.Critical("ERROR: an invalid block was submitted:", err)
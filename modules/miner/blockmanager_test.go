@@ -3,11 +3,13 @@ package miner
 import (
 	"bytes"
 	"testing"
+	"time"
 	"unsafe"
 
 	"gitlab.com/NebulousLabs/errors"
 	"gitlab.com/NebulousLabs/fastrand"
 
+	"gitlab.com/NebulousLabs/Sia/build"
 	"gitlab.com/NebulousLabs/Sia/crypto"
 	"gitlab.com/NebulousLabs/Sia/modules"
 	"gitlab.com/NebulousLabs/Sia/types"
@@ -222,3 +224,77 @@ func TestIntegrationHeaderRequestOverflow(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+// TestSubmitBlockTimestamp checks that blocks with timestamps outside of the
+// allowed window are rejected before they are passed to consensus.
+func TestSubmitBlockTimestamp(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	mt, err := createMinerTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Get a block for work.
+	b, target, err := mt.miner.BlockForWork()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A block too far in the future should be rejected.
+	futureBlock := b
+	futureBlock.Timestamp = types.CurrentTimestamp() + types.ExtremeFutureThreshold + 60
+	err = mt.miner.SubmitBlock(futureBlock)
+	if !errors.Contains(err, types.ErrTimestampTooFarInFuture) {
+		t.Fatal("expected ErrTimestampTooFarInFuture but got", err)
+	}
+
+	// A block with a timestamp before the minimum should be rejected.
+	minTimestamp, exists := mt.cs.MinimumValidChildTimestamp(b.ParentID)
+	if !exists {
+		t.Fatal("parent block doesn't exist")
+	}
+	earlyBlock := b
+	earlyBlock.Timestamp = minTimestamp - 1
+	err = mt.miner.SubmitBlock(earlyBlock)
+	if !errors.Contains(err, types.ErrTimestampTooEarly) {
+		t.Fatal("expected ErrTimestampTooEarly but got", err)
+	}
+
+	// The block with the original timestamp should be accepted.
+	solvedBlock, solved := solveBlock(b, target)
+	if !solved {
+		t.Fatal("failed to solve block")
+	}
+	err = mt.miner.SubmitBlock(solvedBlock)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A block beyond the FutureThreshold but within the
+	// ExtremeFutureThreshold should be passed to consensus which accepts it
+	// once it is no longer in the future.
+	b, target, err = mt.miner.BlockForWork()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Timestamp = types.CurrentTimestamp() + types.FutureThreshold + 2
+	solvedBlock, solved = solveBlock(b, target)
+	if !solved {
+		t.Fatal("failed to solve block")
+	}
+	err = mt.miner.SubmitBlock(solvedBlock)
+	if err == nil || errors.Contains(err, types.ErrTimestampTooFarInFuture) {
+		t.Fatal("expected consensus to hold on to the block but got", err)
+	}
+	err = build.Retry(100, 100*time.Millisecond, func() error {
+		if mt.cs.CurrentBlock().ID() != solvedBlock.ID() {
+			return errors.New("block wasn't accepted")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -4,7 +4,6 @@ package miner
 // integration testing.
 
 import (
-	"bytes"
 	"encoding/binary"
 	"errors"
 	"unsafe"
@@ -34,7 +33,7 @@ func solveBlock(b types.Block, target types.Target) (types.Block, bool) {
 	var nonce uint64
 	for i := 0; i < solveAttempts; i++ {
 		id := crypto.HashBytes(header)
-		if bytes.Compare(target[:], id[:]) >= 0 {
+		if target.Satisfies(types.BlockID(id)) {
 			copy(b.Nonce[:], header[32:40])
 			return b, true
 		}
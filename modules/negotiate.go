@@ -334,6 +334,11 @@ type (
 		EphemeralAccountExpiry     time.Duration  `json:"ephemeralaccountexpiry"`
 		MaxEphemeralAccountBalance types.Currency `json:"maxephemeralaccountbalance"`
 
+		// PayByContractExpiryThreshold is the minimum number of blocks that
+		// need to remain before the proof window of a contract starts for the
+		// host to accept payments from that contract.
+		PayByContractExpiryThreshold types.BlockHeight `json:"paybycontractexpirythreshold"`
+
 		// Because the host has a public key, and settings are signed, and
 		// because settings may be MITM'd, settings need a revision number so
 		// that a renter can compare multiple sets of settings and determine
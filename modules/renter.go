@@ -445,6 +445,50 @@ type DownloadInfo struct {
 	TotalDataTransferred uint64    `json:"totaldatatransferred"` // Total amount of data transferred, including negotiation, etc.
 }
 
+// DownloadByRootResult is the result of downloading the data of a single
+// merkle root using DownloadByRoots.
+type DownloadByRootResult struct {
+	Root crypto.Hash
+	Data []byte
+	Err  error
+}
+
+// DownloadByRootStats contains information about the hosts that were queried
+// while downloading the data of a single merkle root. Callers can use it to
+// tune the pricePerMS they pass to DownloadByRootWithStats.
+type DownloadByRootStats struct {
+	// Duration is the time it took to complete the download.
+	Duration time.Duration
+
+	// TotalCost is the sum of the estimated costs of all the read jobs that
+	// were launched, including the ones that failed or didn't finish in time.
+	TotalCost types.Currency
+
+	// Hosts contains an entry for every read job that was launched.
+	Hosts []DownloadByRootHostStats
+}
+
+// DownloadByRootHostStats contains information about a single read job that
+// was launched on a host while downloading the data of a merkle root.
+type DownloadByRootHostStats struct {
+	HostKey types.SiaPublicKey
+
+	// Cost is the estimated cost of the read job.
+	Cost types.Currency
+
+	// Completed indicates whether the host responded before the download
+	// finished. If it did, Err contains the error the job failed with, if
+	// any.
+	Completed bool
+	Err       error
+
+	// Duration is the time it took the host to respond, or the time the job
+	// was running for if the host didn't respond. ExpectedDuration is the
+	// estimate that was used when selecting the host.
+	Duration         time.Duration
+	ExpectedDuration time.Duration
+}
+
 // FileUploadParams contains the information used by the Renter to upload a
 // file.
 type FileUploadParams struct {
@@ -463,6 +507,20 @@ type FileUploadParams struct {
 	// to create a CipherKey with the given CipherType. This value override
 	// CipherType if it is set.
 	CipherKey crypto.CipherKey
+
+	// MaxConcurrentChunks limits the number of chunks of a streaming upload
+	// that are uploaded at the same time. A new chunk is only started once an
+	// earlier one has become available. If it is 0 there is no limit.
+	MaxConcurrentChunks uint64
+
+	// LowPriority schedules the chunks of a streaming upload behind those of
+	// regular streaming uploads.
+	LowPriority bool
+
+	// PreferredHosts optionally restricts the hosts that the pieces of a
+	// streaming upload are uploaded to. If fewer of them are available than
+	// the upload has pieces, the upload falls back to using all hosts.
+	PreferredHosts []types.SiaPublicKey
 }
 
 // FileInfo provides information about a file.
@@ -646,6 +704,30 @@ type RenterSettings struct {
 	MaxUploadSpeed   int64         `json:"maxuploadspeed"`
 	MaxDownloadSpeed int64         `json:"maxdownloadspeed"`
 	UploadsStatus    UploadsStatus `json:"uploadsstatus"`
+
+	// DefaultSkyfileContentType is the content type reported for downloaded
+	// skyfiles and their subfiles whose metadata doesn't declare one. It is
+	// applied on read and doesn't affect skylinks.
+	DefaultSkyfileContentType string `json:"defaultskyfilecontenttype"`
+
+	// SkyfileIdempotencyKeyExpiry is the amount of time the renter remembers
+	// the skylink of an upload that was made with an idempotency key. A value
+	// of 0 means that the default expiry is used.
+	SkyfileIdempotencyKeyExpiry time.Duration `json:"skyfileidempotencykeyexpiry"`
+
+	// SkyfileMaxSubfiles is the maximum number of subfiles a skyfile
+	// uploaded by the renter can contain. A value of 0 means that the
+	// default maximum is used.
+	SkyfileMaxSubfiles int `json:"skyfilemaxsubfiles"`
+
+	// SkyfileMetadataAllowedFields are the top level fields the metadata of
+	// skyfiles that are uploaded, restored or downloaded by the renter may
+	// contain. If it is empty, any field is allowed.
+	SkyfileMetadataAllowedFields []string `json:"skyfilemetadataallowedfields"`
+
+	// MaxSkylinkDownloadSpeed is the aggregate rate limit in bytes per second
+	// shared by the streams of all skylink downloads. 0 means unlimited.
+	MaxSkylinkDownloadSpeed int64 `json:"maxskylinkdownloadspeed"`
 }
 
 // UploadsStatus contains information about the Renter's Uploads
@@ -1212,6 +1294,11 @@ type Renter interface {
 	// separately as well.
 	CreateSkylinkFromSiafile(SkyfileUploadParameters, SiaPath) (Skylink, error)
 
+	// RepairSkyfileBaseSector rebuilds the base sector of a skyfile from its
+	// original metadata and the siafile of its fanout and re-uploads it. The
+	// rebuilt base sector needs to result in the given skylink.
+	RepairSkyfileBaseSector(sup SkyfileUploadParameters, link Skylink, metadata SkyfileMetadata, fanoutSiaPath SiaPath) error
+
 	// DownloadByRoot will fetch data using the merkle root of that data. The
 	// given timeout will make sure this call won't block for a time that
 	// exceeds the given timeout value. Passing a timeout of 0 is considered as
@@ -1219,6 +1306,26 @@ type Renter interface {
 	// potentially more expensive, hosts.
 	DownloadByRoot(root crypto.Hash, offset, length uint64, timeout time.Duration, pricePerMS types.Currency) ([]byte, error)
 
+	// DownloadByRootWithStats works like DownloadByRoot but also returns
+	// information about the hosts that were queried, the time they took and
+	// what the download cost.
+	DownloadByRootWithStats(root crypto.Hash, offset, length uint64, timeout time.Duration, pricePerMS types.Currency) ([]byte, DownloadByRootStats, error)
+
+	// DownloadByRoots will fetch data for multiple merkle roots concurrently.
+	// The timeout applies to the call as a whole while the pricePerMS is the
+	// budget for every individual root. A result is returned for every root,
+	// in the same order as the given roots.
+	DownloadByRoots(roots []crypto.Hash, offset, length uint64, timeout time.Duration, pricePerMS types.Currency) ([]DownloadByRootResult, error)
+
+	// SkyfileMaxSubfiles returns the maximum number of subfiles of skyfiles
+	// uploaded by the renter.
+	SkyfileMaxSubfiles() int
+
+	// DefaultSkyfileContentType returns the content type to report for
+	// downloaded skyfiles that don't declare one. It is empty if no default
+	// is configured.
+	DefaultSkyfileContentType() string
+
 	// DownloadSkylink will fetch a file from the Sia network using the given
 	// skylink. The given timeout will make sure this call won't block for a
 	// time that exceeds the given timeout value. Passing a timeout of 0 is
@@ -1226,13 +1333,95 @@ type Renter interface {
 	// faster, and thus potentially more expensive, hosts.
 	DownloadSkylink(link Skylink, timeout time.Duration, pricePerMS types.Currency) (SkyfileLayout, SkyfileMetadata, Streamer, error)
 
+	// DownloadSkylinkFromOffset works like DownloadSkylink but the returned
+	// streamer starts at the given byte offset into the file. Only the data
+	// from that offset onwards is fetched which allows for resuming an
+	// interrupted download.
+	DownloadSkylinkFromOffset(link Skylink, offset uint64, timeout time.Duration, pricePerMS types.Currency) (SkyfileLayout, SkyfileMetadata, Streamer, error)
+
+	// DownloadSkylinkWithReadAhead works like DownloadSkylink but the
+	// returned streamer fetches up to readAhead bytes ahead of the current
+	// read position. A larger read-ahead smooths out sequential reads while a
+	// smaller one avoids wasted fetches for random access. A readAhead of 0
+	// uses the default and the read-ahead is capped to bound memory usage.
+	DownloadSkylinkWithReadAhead(link Skylink, readAhead uint64, timeout time.Duration, pricePerMS types.Currency) (SkyfileLayout, SkyfileMetadata, Streamer, error)
+
+	// DownloadSkylinkWithBaseSector works like DownloadSkylink but also
+	// returns the raw, still encrypted if applicable, base sector that was
+	// fetched for the download.
+	DownloadSkylinkWithBaseSector(link Skylink, timeout time.Duration, pricePerMS types.Currency) (SkyfileLayout, SkyfileMetadata, Streamer, []byte, error)
+
+	// DownloadSkylinkWithPreflight works like DownloadSkylinkWithReadAhead but
+	// verifies that the first fanout chunk, and a randomly sampled other chunk
+	// if sampleChunk is set, can be recovered before returning the streamer.
+	DownloadSkylinkWithPreflight(link Skylink, readAhead uint64, timeout time.Duration, pricePerMS types.Currency, sampleChunk bool) (SkyfileLayout, SkyfileMetadata, Streamer, error)
+
+	// DownloadSkylinkWithRateLimit works like DownloadSkylinkWithReadAhead but
+	// limits the reads from the returned streamer to readBPS bytes per second.
+	DownloadSkylinkWithRateLimit(link Skylink, readAhead uint64, readBPS int64, timeout time.Duration, pricePerMS types.Currency) (SkyfileLayout, SkyfileMetadata, Streamer, error)
+
+	// SetSkylinkDownloadRateLimit sets and persists the aggregate rate limit
+	// in bytes per second shared by all skylink downloads. 0 means no limit.
+	SetSkylinkDownloadRateLimit(readBPS int64) error
+
+	// SkylinkDownloadRateLimit returns the aggregate rate limit of skylink
+	// downloads.
+	SkylinkDownloadRateLimit() int64
+
+	// DownloadSkylinkSkipUnrecoverable works like DownloadSkylinkFromOffset
+	// but ranges of the file that can't be recovered because a fanout chunk
+	// lacks enough pieces are zero-filled instead of failing the stream. The
+	// returned function reports the ranges that were zero-filled so far.
+	DownloadSkylinkSkipUnrecoverable(link Skylink, offset uint64, timeout time.Duration, pricePerMS types.Currency) (SkyfileLayout, SkyfileMetadata, Streamer, func() []SkyfileByteRange, error)
+
+	// DownloadSkylinkTo streams the file behind the given skylink into the
+	// provided writer. Data is only fetched as fast as the writer consumes it
+	// which keeps the memory used by the download bounded. It returns the
+	// metadata of the file and the number of bytes written.
+	DownloadSkylinkTo(link Skylink, w io.Writer, timeout time.Duration, pricePerMS types.Currency) (SkyfileMetadata, uint64, error)
+
 	// DownloadSkylinkBaseSector will take a link and turn it into the data of a
 	// download without any decoding of the metadata, fanout, or decryption. The
 	// given timeout will make sure this call won't block for a time that
 	// exceeds the given timeout value. Passing a timeout of 0 is considered as
-	// no timeout. The pricePerMS acts as a budget to spend on faster, and thus
-	// potentially more expensive, hosts.
-	DownloadSkylinkBaseSector(link Skylink, timeout time.Duration, pricePerMS types.Currency) (Streamer, error)
+	// no timeout. The baseSectorTimeout can be used to fail faster and defaults
+	// to a fraction of the timeout if 0. The pricePerMS acts as a budget to
+	// spend on faster, and thus potentially more expensive, hosts.
+	DownloadSkylinkBaseSector(link Skylink, timeout, baseSectorTimeout time.Duration, pricePerMS types.Currency) (Streamer, error)
+
+	// IsSkylinkEncrypted returns whether the skyfile behind the given skylink
+	// is encrypted and, if so, whether the renter holds a skykey that is able
+	// to decrypt it. Only the layout of the skyfile is fetched to determine
+	// this. The given timeout will make sure this call won't block for a time
+	// that exceeds the given timeout value. Passing a timeout of 0 is
+	// considered as no timeout.
+	IsSkylinkEncrypted(link Skylink, timeout time.Duration, pricePerMS types.Currency) (encrypted bool, hasKey bool, err error)
+
+	// SkykeyForSkylink returns the skykey that is able to decrypt the skyfile
+	// behind the given skylink. Only the layout of the skyfile is fetched to
+	// find it. An error is returned if the skyfile is not encrypted or if the
+	// renter doesn't hold a matching skykey.
+	SkykeyForSkylink(link Skylink, timeout time.Duration, pricePerMS types.Currency) (skykey.Skykey, error)
+
+	// SkylinkFanout fetches the base sector of the given skylink and returns
+	// the decoded fanout of the skyfile. The fanout is empty for small
+	// skyfiles that don't have one. Encrypted skyfiles can only be decoded if
+	// the renter holds a matching skykey.
+	SkylinkFanout(link Skylink, timeout time.Duration, pricePerMS types.Currency) (SkyfileFanout, error)
+
+	// EstimateSkyfileCost estimates the cost of uploading a skyfile of the
+	// given size with the given parameters and storing it for the current
+	// allowance period. The subfiles of a multipart upload count towards the
+	// size of the metadata. Only the cached price tables of the hosts are
+	// used.
+	EstimateSkyfileCost(sup SkyfileUploadParameters, subfiles SkyfileSubfiles, fileSize uint64) (SkyfileCostEstimate, error)
+
+	// SkylinkRedundancy queries the hosts for the base sector of the given
+	// skylink and for up to numChunks evenly spaced chunks of its fanout and
+	// returns how many hosts hold each of the sectors. No skyfile data is
+	// downloaded, but the base sector is fetched to learn the fanout if
+	// numChunks is not 0.
+	SkylinkRedundancy(link Skylink, numChunks uint64, timeout time.Duration, pricePerMS types.Currency) (SkylinkRedundancy, error)
 
 	// UploadSkyfile will upload data to the Sia network from a reader and
 	// create a skyfile, returning the skylink that can be used to access the
@@ -1244,19 +1433,52 @@ type Renter interface {
 	// file.
 	UploadSkyfile(SkyfileUploadParameters, SkyfileUploadReader) (Skylink, error)
 
+	// UploadSkyfileAsync uploads a skyfile like UploadSkyfile but returns the
+	// skylink as soon as it is known while the upload continues in the
+	// background. The returned channel receives the result of the upload and
+	// is closed afterwards.
+	UploadSkyfileAsync(SkyfileUploadParameters, SkyfileUploadReader) (Skylink, <-chan error, error)
+
+	// UploadSkyfileV2 uploads a skyfile like UploadSkyfile. If the
+	// parameters request a v2 skylink, a registry entry pointing at the v1
+	// skylink of the upload is registered as well and both skylinks are
+	// returned.
+	UploadSkyfileV2(SkyfileUploadParameters, SkyfileUploadReader) (SkyfileUploadResult, error)
+
 	// Blocklist returns the merkleroots that are blocked
 	Blocklist() ([]crypto.Hash, error)
 
 	// PinSkylink re-uploads the data stored at the file under that skylink with
-	// the given parameters. Alongside the parameters we can pass a timeout and
-	// a price per millisecond. The timeout ensures fetching the base sector
-	// does not surpass it, the price per millisecond is the budget we are
-	// allowed to spend on faster hosts.
-	PinSkylink(link Skylink, sup SkyfileUploadParameters, timeout time.Duration, pricePerMS types.Currency) error
+	// the given parameters. Alongside the parameters we can pass a timeout, a
+	// base sector timeout and a price per millisecond. The timeout covers the
+	// whole operation while the base sector timeout only covers fetching the
+	// base sector and defaults to a fraction of the timeout if 0. The price
+	// per millisecond is the budget we are allowed to spend on faster hosts.
+	// If the node already pins the skylink and Force isn't set, nothing is
+	// uploaded and an error is returned. Canceling the context aborts the
+	// upload of the fanout and deletes the partially pinned skyfile.
+	PinSkylink(ctx context.Context, link Skylink, sup SkyfileUploadParameters, timeout, baseSectorTimeout time.Duration, pricePerMS types.Currency) error
+
+	// PinBaseSector re-uploads only the base sector of the file under that
+	// skylink. The fanout is not re-uploaded, which keeps the metadata and
+	// small files available while the bulk data of large files remains on the
+	// hosts of the original uploader.
+	PinBaseSector(link Skylink, sup SkyfileUploadParameters, timeout time.Duration, pricePerMS types.Currency) error
+
+	// PinnedSkylinks returns the skylinks pinned by the skyfiles of the node,
+	// within and outside of the Skynet folder, together with their siapaths.
+	// The offset and limit allow for paginating through the skylinks, a limit
+	// of 0 returns all of them.
+	PinnedSkylinks(offset, limit uint64) ([]PinnedSkylink, error)
 
 	// Portals returns the list of known skynet portals.
 	Portals() ([]SkynetPortal, error)
 
+	// MigrateThreefishSkyfile re-uploads a skyfile that was converted from a
+	// TypeThreefish siafile with the cipher type of regular skyfile uploads
+	// and returns the new skylink. The old skylink remains resolvable.
+	MigrateThreefishSkyfile(link Skylink, sup SkyfileUploadParameters, timeout time.Duration, pricePerMS types.Currency) (Skylink, error)
+
 	// RestoreSkyfile restores a skyfile such that the skylink is preserved.
 	RestoreSkyfile(reader io.Reader) (Skylink, error)
 
@@ -1267,6 +1489,11 @@ type Renter interface {
 	// UpdateSkynetPortals updates the list of known skynet portals.
 	UpdateSkynetPortals(additions []SkynetPortal, removals []NetAddress) error
 
+	// UpdateSkynetPortalsPartial updates the list of known skynet portals,
+	// applying the valid additions and removals and reporting the invalid
+	// ones instead of failing the whole update.
+	UpdateSkynetPortalsPartial(additions []SkynetPortal, removals []NetAddress) (SkynetPortalsUpdateResult, error)
+
 	// WorkerPoolStatus returns the current status of the Renter's worker pool
 	WorkerPoolStatus() (WorkerPoolStatus, error)
 
@@ -112,6 +112,15 @@ var (
 	// triggers a garbage collection.
 	gcMemoryThreshold = uint64(1 << 28) // 256 MiB
 
+	// baseSectorUploadRetryInterval is the amount of time the renter waits
+	// before retrying the upload of a skyfile's base sector after a transient
+	// error.
+	baseSectorUploadRetryInterval = build.Select(build.Var{
+		Dev:      time.Second,
+		Standard: 3 * time.Second,
+		Testing:  100 * time.Millisecond,
+	}).(time.Duration)
+
 	// initialStreamerCacheSize defines the cache size that each streamer will
 	// start using when it is created. A lower initial cache size will mean that
 	// it will take more requests / round trips for the cache to grow, however
@@ -155,6 +164,33 @@ const (
 	DefaultMaxUploadSpeed = 0
 )
 
+const (
+	// maxErasureCodingShards is the maximum number of data and parity pieces
+	// supported by the Reed-Solomon erasure coder.
+	maxErasureCodingShards = 256
+)
+
+// Default skynet download parameters.
+const (
+	// skylinkBaseSectorTimeoutDivisor determines the default timeout for
+	// fetching the base sector of a skylink as a fraction of the overall
+	// timeout of the operation. That way a slow lookup of the base sector
+	// can't use up all of the time that is needed to download the fanout.
+	skylinkBaseSectorTimeoutDivisor = 2
+
+	// downloadByRootsMaxConcurrency is the maximum number of roots that are
+	// downloaded in parallel by DownloadByRoots.
+	downloadByRootsMaxConcurrency = 16
+)
+
+// Default skynet upload parameters.
+const (
+	// baseSectorUploadMaxAttempts is the number of times the renter tries to
+	// upload the base sector of a skyfile before giving up. Only transient
+	// errors are retried.
+	baseSectorUploadMaxAttempts = 3
+)
+
 // Naming conventions for code readability.
 const (
 	// destinationTypeSeekStream is the destination type used for downloads
@@ -194,10 +194,18 @@ func (sf *SiaFile) AccessTime() time.Time {
 	return sf.staticMetadata.AccessTime
 }
 
-// AddSkylink will add a skylink to the SiaFile.
+// AddSkylink will add a skylink to the SiaFile. Skylinks that are already
+// part of the file's metadata are ignored.
 func (sf *SiaFile) AddSkylink(s modules.Skylink) (err error) {
 	sf.mu.Lock()
 	defer sf.mu.Unlock()
+	// Nothing to do if the skylink was already added.
+	str := s.String()
+	for _, skylink := range sf.staticMetadata.Skylinks {
+		if skylink == str {
+			return nil
+		}
+	}
 	// backup the changed metadata before changing it. Revert the change on
 	// error.
 	defer func(backup Metadata) {
@@ -205,7 +213,7 @@ func (sf *SiaFile) AddSkylink(s modules.Skylink) (err error) {
 			sf.staticMetadata.restore(backup)
 		}
 	}(sf.staticMetadata.backup())
-	sf.staticMetadata.Skylinks = append(sf.staticMetadata.Skylinks, s.String())
+	sf.staticMetadata.Skylinks = append(sf.staticMetadata.Skylinks, str)
 
 	// Save changes to metadata to disk.
 	updates, err := sf.saveMetadataUpdates()
@@ -155,3 +155,52 @@ func TestBackupRestoreMetadata(t *testing.T) {
 		t.Fatalf("metadata wasn't restored successfully %v %v", mdBefore, sf.staticMetadata)
 	}
 }
+
+// TestAddSkylinkDuplicate verifies that adding the same skylink to a SiaFile
+// multiple times only results in a single entry in its metadata.
+func TestAddSkylinkDuplicate(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	sf := newBlankTestFile()
+
+	// Add the same skylink twice.
+	var link modules.Skylink
+	err := link.LoadString("AABEKWZ_wc2R9qlhYkzbG8mImFVi08kBu1nsvvwPLBtpEg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := sf.AddSkylink(link); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(sf.Metadata().Skylinks) != 1 {
+		t.Fatalf("expected 1 skylink but got %v", len(sf.Metadata().Skylinks))
+	}
+
+	// The deduplication should also persist across reloads.
+	sf2, err := LoadSiaFile(sf.siaFilePath, sf.wal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	skylinks := sf2.Metadata().Skylinks
+	if len(skylinks) != 1 || skylinks[0] != link.String() {
+		t.Fatal("unexpected skylinks", skylinks)
+	}
+
+	// A different skylink should still be added.
+	var link2 modules.Skylink
+	err = link2.LoadString("_B19BtlWtjjR7AD0DDzxYanvIhZ7cxXrva5tNNxDht1kaA")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sf.AddSkylink(link2); err != nil {
+		t.Fatal(err)
+	}
+	if len(sf.Metadata().Skylinks) != 2 {
+		t.Fatalf("expected 2 skylinks but got %v", len(sf.Metadata().Skylinks))
+	}
+}
@@ -3,6 +3,7 @@ package renter
 import (
 	"os"
 	"path/filepath"
+	"time"
 
 	"gitlab.com/NebulousLabs/errors"
 	"gitlab.com/NebulousLabs/writeaheadlog"
@@ -61,6 +62,31 @@ type (
 		MaxUploadSpeed   int64
 		UploadedBackups  []modules.UploadedBackup
 		SyncedContracts  []types.FileContractID
+
+		// SkyfileExpirations contains the skyfiles that were uploaded with
+		// a TTL and are deleted once they expire.
+		SkyfileExpirations []skyfileExpiration
+
+		// DefaultSkyfileContentType is applied to downloaded skyfiles and
+		// subfiles without a content type.
+		DefaultSkyfileContentType string
+
+		// SkyfileIdempotencyKeyExpiry is the amount of time the skylinks of
+		// uploads with an idempotency key are remembered. 0 means that the
+		// default is used.
+		SkyfileIdempotencyKeyExpiry time.Duration
+
+		// SkyfileMaxSubfiles is the maximum number of subfiles of uploaded
+		// skyfiles. 0 means that the default is used.
+		SkyfileMaxSubfiles int
+
+		// SkyfileMetadataAllowedFields are the top level fields the metadata
+		// of skyfiles may contain. If it is empty, any field is allowed.
+		SkyfileMetadataAllowedFields []string
+
+		// MaxSkylinkDownloadSpeed is the aggregate rate limit of skylink
+		// downloads in bytes per second. 0 means unlimited.
+		MaxSkylinkDownloadSpeed int64
 	}
 )
 
@@ -109,6 +135,11 @@ func (r *Renter) managedLoadSettings() error {
 		return err
 	}
 
+	// Set the aggregate rate limit of skylink downloads.
+	if r.persist.MaxSkylinkDownloadSpeed > 0 {
+		r.setSkylinkDownloadRateLimit(r.persist.MaxSkylinkDownloadSpeed)
+	}
+
 	// Set the bandwidth limits on the contractor, which was already initialized
 	// without bandwidth limits.
 	return r.setBandwidthLimits(r.persist.MaxDownloadSpeed, r.persist.MaxUploadSpeed)
@@ -23,6 +23,11 @@ var (
 	// ErrProjectTimedOut is returned when the project timed out
 	ErrProjectTimedOut = errors.New("project timed out")
 
+	// ErrInsufficientRedundancy is returned if all workers finished looking up
+	// the pieces of a chunk and fewer pieces than are required to recover the
+	// chunk are reachable.
+	ErrInsufficientRedundancy = errors.New("insufficient redundancy - not enough pieces of the chunk are reachable")
+
 	// pcwsWorkerStateResetTime defines the amount of time that the pcws will
 	// wait before resetting / refreshing the worker state, meaning that all of
 	// the workers will do another round of HasSector queries on the network.
@@ -175,6 +180,7 @@ type projectChunkWorkerSet struct {
 // implements this interface.
 type chunkFetcher interface {
 	Download(ctx context.Context, pricePerMS types.Currency, offset, length uint64) (chan *downloadResponse, error)
+	CheckReachable(ctx context.Context) error
 }
 
 // Download will download a range from a chunk.
@@ -182,6 +188,13 @@ func (pcws *projectChunkWorkerSet) Download(ctx context.Context, pricePerMS type
 	return pcws.managedDownload(ctx, pricePerMS, offset, length)
 }
 
+// CheckReachable blocks until enough pieces of the chunk are known to be
+// reachable to recover it. If all workers have responded and there are not
+// enough pieces, ErrInsufficientRedundancy is returned.
+func (pcws *projectChunkWorkerSet) CheckReachable(ctx context.Context) error {
+	return pcws.managedCheckReachable(ctx)
+}
+
 // checkPCWSGouging verifies the cost of grabbing the HasSector information from
 // a host is reasonble. The cost of completing the download is not checked.
 //
@@ -429,6 +442,50 @@ func (pcws *projectChunkWorkerSet) threadedFindWorkers(allWorkersLaunchedChan ch
 	}
 }
 
+// managedCheckReachable blocks until the resolved workers of the current worker
+// state can serve enough unique pieces to recover the chunk, or until all of
+// the workers are resolved.
+func (pcws *projectChunkWorkerSet) managedCheckReachable(ctx context.Context) error {
+	// Refresh the pcws. This will only cause a refresh if one is necessary.
+	err := pcws.managedTryUpdateWorkerState()
+	if err != nil {
+		return errors.AddContext(err, "unable to check reachable pieces")
+	}
+	ws := pcws.managedWorkerState()
+	minPieces := pcws.staticErasureCoder.MinPieces()
+
+	for {
+		// Count the unique pieces the resolved workers have and register for
+		// an update in case there aren't enough of them yet.
+		ws.mu.Lock()
+		pieces := make(map[uint64]struct{})
+		for _, rw := range ws.resolvedWorkers {
+			for _, pieceIndex := range rw.pieceIndices {
+				pieces[pieceIndex] = struct{}{}
+			}
+		}
+		var updateChan <-chan struct{}
+		if len(pieces) < minPieces {
+			updateChan = ws.registerForWorkerUpdate()
+		}
+		ws.mu.Unlock()
+
+		if len(pieces) >= minPieces {
+			return nil
+		}
+		if updateChan == nil {
+			return errors.AddContext(ErrInsufficientRedundancy, fmt.Sprintf("%v of %v required pieces are reachable", len(pieces), minPieces))
+		}
+		select {
+		case <-updateChan:
+		case <-ctx.Done():
+			return errors.Compose(ErrProjectTimedOut, ctx.Err())
+		case <-pcws.staticCtx.Done():
+			return errors.New("chunk worker set closed")
+		}
+	}
+}
+
 // managedWorkerState returns a pointer to the current worker state object
 func (pcws *projectChunkWorkerSet) managedWorkerState() *pcwsWorkerState {
 	pcws.mu.Lock()
@@ -553,3 +553,86 @@ func TestProjectChunkWorsetSet_managedLaunchWorker(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+// TestProjectChunkWorkerSet_managedCheckReachable probes the
+// 'managedCheckReachable' function on the PCWS.
+func TestProjectChunkWorkerSet_managedCheckReachable(t *testing.T) {
+	t.Parallel()
+
+	// create EC with 2 data pieces
+	ec, err := modules.NewRSCode(2, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// newPCWS creates a PCWS with a recent worker state that is still waiting
+	// on the given number of workers.
+	newPCWS := func(numUnresolved int) (*projectChunkWorkerSet, *pcwsWorkerState) {
+		renter := new(Renter)
+		ws := &pcwsWorkerState{
+			unresolvedWorkers: make(map[string]*pcwsUnresolvedWorker),
+			staticRenter:      renter,
+		}
+		for i := 0; i < numUnresolved; i++ {
+			ws.unresolvedWorkers[fmt.Sprint(i)] = &pcwsUnresolvedWorker{}
+		}
+		updateFinishedChan := make(chan struct{})
+		close(updateFinishedChan)
+		pcws := &projectChunkWorkerSet{
+			workerState:           ws,
+			workerStateLaunchTime: time.Now(),
+			updateFinishedChan:    updateFinishedChan,
+
+			staticErasureCoder: ec,
+			staticCtx:          context.Background(),
+			staticRenter:       renter,
+		}
+		return pcws, ws
+	}
+
+	// newResponse creates a HasSector response of the worker with the given
+	// name that has the pieces at the given indices.
+	newResponse := func(name string, indices ...int) *jobHasSectorResponse {
+		w := new(worker)
+		w.staticHostPubKeyStr = name
+		availables := make([]bool, ec.NumPieces())
+		for _, i := range indices {
+			availables[i] = true
+		}
+		return &jobHasSectorResponse{
+			staticAvailables: availables,
+			staticWorker:     w,
+		}
+	}
+
+	// All workers resolved but only one unique piece is reachable.
+	pcws, ws := newPCWS(2)
+	ws.managedHandleResponse(newResponse("0", 0))
+	ws.managedHandleResponse(newResponse("1", 0))
+	err = pcws.managedCheckReachable(context.Background())
+	if !errors.Contains(err, ErrInsufficientRedundancy) {
+		t.Fatal("expected ErrInsufficientRedundancy", err)
+	}
+
+	// The check should wait for unresolved workers and pass once enough unique
+	// pieces are reachable.
+	pcws, ws = newPCWS(2)
+	ws.managedHandleResponse(newResponse("0", 0))
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		ws.managedHandleResponse(newResponse("1", 1))
+	}()
+	err = pcws.managedCheckReachable(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The check should time out if the unresolved workers don't respond.
+	pcws, _ = newPCWS(1)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	err = pcws.managedCheckReachable(ctx)
+	if !errors.Contains(err, ErrProjectTimedOut) {
+		t.Fatal("expected ErrProjectTimedOut", err)
+	}
+}
@@ -129,6 +129,9 @@ type (
 		// complete the download.
 		expectedDuration time.Duration
 
+		// 'jobErr' is the error the job failed with, if any.
+		jobErr error
+
 		pdc    *projectDownloadChunk
 		worker *worker
 	}
@@ -157,6 +160,23 @@ func (lwi *launchedWorkerInfo) String() string {
 	return fmt.Sprintf("%v | worker %v was estimated to complete after %v ms but has not yet responded after %vms", hex.EncodeToString(lwi.pdc.uid[:]), lwi.worker.staticHostPubKey.ShortString(), lwi.expectedDuration.Milliseconds(), time.Since(lwi.launchTime).Milliseconds())
 }
 
+// stats returns the stats of the launched worker. It should only be called
+// once the download the worker was launched for is done.
+func (lwi *launchedWorkerInfo) stats() modules.DownloadByRootHostStats {
+	stats := modules.DownloadByRootHostStats{
+		HostKey:          lwi.worker.staticHostPubKey,
+		Cost:             lwi.worker.staticJobReadQueue.callExpectedJobCost(lwi.pdc.pieceLength),
+		Completed:        !lwi.completeTime.IsZero(),
+		Err:              lwi.jobErr,
+		Duration:         lwi.totalDuration,
+		ExpectedDuration: lwi.expectedDuration,
+	}
+	if !stats.Completed {
+		stats.Duration = time.Since(lwi.launchTime)
+	}
+	return stats
+}
+
 // successful is a small helper method that returns whether the piece was
 // successfully downloaded, this is the case when it completed without error.
 func (pd *pieceDownload) successful() bool {
@@ -218,6 +238,7 @@ func (pdc *projectDownloadChunk) handleJobReadResponse(jrr *jobReadResponse) {
 	launchedWorker.completeTime = time.Now()
 	launchedWorker.jobDuration = jrr.staticJobTime
 	launchedWorker.totalDuration = time.Since(launchedWorker.launchTime)
+	launchedWorker.jobErr = jrr.staticErr
 
 	// Check whether the job failed.
 	if jrr.staticErr != nil {
@@ -25,6 +25,7 @@ package renter
 
 import (
 	"fmt"
+	"mime"
 	"net"
 	"os"
 	"path/filepath"
@@ -263,6 +264,8 @@ type Renter struct {
 	staticAlerter                      *modules.GenericAlerter
 	staticFileSystem                   *filesystem.FileSystem
 	staticFuseManager                  renterFuseManager
+	staticSkyfileIdempotencyCache      *skyfileIdempotencyCache
+	staticSkylinkDownloadRateLimit     *ratelimit.RateLimit
 	staticSkykeyManager                *skykey.SkykeyManager
 	staticStreamBufferSet              *streamBufferSet
 	tg                                 threadgroup.ThreadGroup
@@ -611,6 +614,25 @@ func (r *Renter) SetSettings(s modules.RenterSettings) error {
 	if s.MaxDownloadSpeed < 0 || s.MaxUploadSpeed < 0 {
 		return errors.New("bandwidth limits cannot be negative")
 	}
+	if s.DefaultSkyfileContentType != "" {
+		if _, _, err := mime.ParseMediaType(s.DefaultSkyfileContentType); err != nil {
+			return errors.AddContext(err, "invalid default skyfile content type")
+		}
+	}
+	if s.SkyfileIdempotencyKeyExpiry < 0 {
+		return errors.New("skyfile idempotency key expiry cannot be negative")
+	}
+	if s.SkyfileMaxSubfiles < 0 {
+		return errors.New("skyfile max subfiles cannot be negative")
+	}
+	for _, field := range s.SkyfileMetadataAllowedFields {
+		if field == "" {
+			return errors.New("allowed skyfile metadata fields cannot be empty")
+		}
+	}
+	if s.MaxSkylinkDownloadSpeed < 0 {
+		return errNegativeSkylinkDownloadRateLimit
+	}
 
 	// Set allowance.
 	err := r.hostContractor.SetAllowance(s.Allowance)
@@ -626,10 +648,16 @@ func (r *Renter) SetSettings(s modules.RenterSettings) error {
 	if err != nil {
 		return err
 	}
+	r.setSkylinkDownloadRateLimit(s.MaxSkylinkDownloadSpeed)
 	// Save the changes.
 	id := r.mu.Lock()
 	r.persist.MaxDownloadSpeed = s.MaxDownloadSpeed
 	r.persist.MaxUploadSpeed = s.MaxUploadSpeed
+	r.persist.DefaultSkyfileContentType = s.DefaultSkyfileContentType
+	r.persist.SkyfileIdempotencyKeyExpiry = s.SkyfileIdempotencyKeyExpiry
+	r.persist.SkyfileMaxSubfiles = s.SkyfileMaxSubfiles
+	r.persist.SkyfileMetadataAllowedFields = append([]string(nil), s.SkyfileMetadataAllowedFields...)
+	r.persist.MaxSkylinkDownloadSpeed = s.MaxSkylinkDownloadSpeed
 	err = r.saveSync()
 	r.mu.Unlock(id)
 	if err != nil {
@@ -823,6 +851,10 @@ func (r *Renter) Settings() (modules.RenterSettings, error) {
 		return modules.RenterSettings{}, errors.AddContext(err, "error getting IPViolationsCheck:")
 	}
 	paused, endTime := r.uploadHeap.managedPauseStatus()
+	id := r.mu.RLock()
+	idempotencyKeyExpiry := r.persist.SkyfileIdempotencyKeyExpiry
+	maxSubfiles := r.persist.SkyfileMaxSubfiles
+	r.mu.RUnlock(id)
 	return modules.RenterSettings{
 		Allowance:        r.hostContractor.Allowance(),
 		IPViolationCheck: enabled,
@@ -832,6 +864,12 @@ func (r *Renter) Settings() (modules.RenterSettings, error) {
 			Paused:       paused,
 			PauseEndTime: endTime,
 		},
+		DefaultSkyfileContentType:   r.managedDefaultSkyfileContentType(),
+		SkyfileIdempotencyKeyExpiry: idempotencyKeyExpiry,
+		SkyfileMaxSubfiles:          maxSubfiles,
+		MaxSkylinkDownloadSpeed:     r.SkylinkDownloadRateLimit(),
+
+		SkyfileMetadataAllowedFields: r.managedSkyfileMetadataAllowedFields(),
 	}, nil
 }
 
@@ -1011,6 +1049,8 @@ func renterBlockingStartup(g modules.Gateway, cs modules.ConsensusSet, tpool mod
 		mu:             siasync.New(modules.SafeMutexDelay, 1),
 		tpool:          tpool,
 	}
+	r.staticSkyfileIdempotencyCache = newSkyfileIdempotencyCache()
+	r.staticSkylinkDownloadRateLimit = ratelimit.NewRateLimit(0, 0, skylinkDownloadRateLimitPacketSize)
 	r.staticStreamBufferSet = newStreamBufferSet(&r.tg)
 	r.staticUploadChunkDistributionQueue = newUploadChunkDistributionQueue(r)
 	close(r.uploadHeap.pauseChan)
@@ -1094,6 +1134,10 @@ func renterBlockingStartup(g modules.Gateway, cs modules.ConsensusSet, tpool mod
 	r.managedUpdateRenterContractsAndUtilities()
 	go r.threadedUpdateRenterContractsAndUtilities()
 
+	// Spin up the thread that deletes skyfiles which were uploaded with a TTL
+	// once they expire.
+	go r.threadedPruneExpiredSkyfiles()
+
 	// Spin up background threads which are not depending on the renter being
 	// up-to-date with consensus.
 	if !r.deps.Disrupt("DisableRepairAndHealthLoops") {
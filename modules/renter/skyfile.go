@@ -34,6 +34,8 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"strings"
+	"sync"
 	"time"
 
 	"gitlab.com/NebulousLabs/Sia/build"
@@ -57,7 +59,36 @@ var (
 	}).(uint8)
 )
 
+// skylinkPreflight describes which fanout chunks of a skyfile are verified to
+// be recoverable before a download of the skyfile starts streaming.
+type skylinkPreflight int
+
+const (
+	// skylinkPreflightNone skips the preflight check.
+	skylinkPreflightNone skylinkPreflight = iota
+
+	// skylinkPreflightFirstChunk verifies the first fanout chunk.
+	skylinkPreflightFirstChunk
+
+	// skylinkPreflightSampled verifies the first fanout chunk and a randomly
+	// sampled other fanout chunk.
+	skylinkPreflightSampled
+)
+
 var (
+	// ErrAlreadyPinned is the error returned when a skylink is pinned without
+	// Force while the node already pins it at the requested siapath.
+	ErrAlreadyPinned = errors.New("skylink is already pinned")
+
+	// ErrSkylinkPinnedElsewhere is the error returned when a skylink is pinned
+	// without Force while the node already pins it at a different siapath.
+	ErrSkylinkPinnedElsewhere = errors.New("skylink is already pinned at a different siapath")
+
+	// ErrSkylinkPartiallyPinned is the error returned when only the base
+	// sector of an encrypted skyfile was pinned because the node doesn't hold
+	// the skykey to locate its fanout.
+	ErrSkylinkPartiallyPinned = errors.New("only the base sector of the encrypted skyfile was pinned, its fanout can't be located without the skykey")
+
 	// ErrEncryptionNotSupported is the error returned when Skykey encryption is
 	// not supported for a Skynet action.
 	ErrEncryptionNotSupported = errors.New("skykey encryption not supported")
@@ -69,10 +100,57 @@ var (
 	// sectorsize.
 	ErrMetadataTooBig = errors.New("metadata exceeds sectorsize")
 
+	// ErrNoMatchingSkykey is the error returned when none of the renter's
+	// skykeys is able to decrypt a skyfile.
+	ErrNoMatchingSkykey = errors.New("no skykey matches the encrypted skyfile")
+
+	// ErrSkyfileExtendedPathExists is the error returned when the extended
+	// siafile of a large skyfile can't be created because a siafile already
+	// exists at its siapath and the upload isn't forced.
+	ErrSkyfileExtendedPathExists = errors.New("extended siapath of skyfile already exists")
+
 	// ErrSkylinkBlocked is the error returned when a skylink is blocked
 	ErrSkylinkBlocked = errors.New("skylink is blocked")
+
+	// ErrSkylinkV2KeyMismatch is the error returned when the public key of
+	// the v2 skylink parameters doesn't match the secret key.
+	ErrSkylinkV2KeyMismatch = errors.New("public key of v2 skylink doesn't match secret key")
+
+	// ErrSkyfileNotThreefish is the error returned when a skyfile is migrated
+	// that wasn't converted from a TypeThreefish siafile.
+	ErrSkyfileNotThreefish = errors.New("skyfile is not a converted TypeThreefish siafile")
+
+	// ErrSkylinkNotEncrypted is the error returned when a skyfile was expected
+	// to be encrypted but isn't.
+	ErrSkylinkNotEncrypted = errors.New("skyfile is not encrypted")
+
+	// errInvalidErasureParams is the error returned when the erasure coding
+	// parameters of a skyfile can't be used to construct an erasure coder.
+	errInvalidErasureParams = errors.New("invalid erasure coding parameters")
+
+	// errNegativeSkyfileTTL is the error returned when a skyfile is uploaded
+	// with a negative TTL.
+	errNegativeSkyfileTTL = errors.New("skyfile TTL can't be negative")
+
+	// errOffsetExceedsFilesize is the error returned when a skylink download is
+	// requested to start at an offset beyond the end of the file.
+	errOffsetExceedsFilesize = errors.New("offset exceeds the filesize")
+
+	// errPartialChunksForSkyfile is the error returned when partial chunks are
+	// requested for an upload that feeds into a skylink.
+	errPartialChunksForSkyfile = errors.New("partial chunks are not allowed for skyfiles")
+
+	// errSkylinkMismatch is the error returned when a rebuilt base sector
+	// doesn't result in the skylink it was rebuilt for.
+	errSkylinkMismatch = errors.New("rebuilt base sector doesn't match skylink")
 )
 
+// DefaultBaseChunkRedundancy returns the default redundancy for the base chunk
+// of a skyfile.
+func DefaultBaseChunkRedundancy() uint8 {
+	return SkyfileDefaultBaseChunkRedundancy
+}
+
 // skyfileEstablishDefaults will set any zero values in the lup to be equal to
 // the desired defaults.
 func skyfileEstablishDefaults(lup *modules.SkyfileUploadParameters) {
@@ -81,9 +159,76 @@ func skyfileEstablishDefaults(lup *modules.SkyfileUploadParameters) {
 	}
 }
 
-// fileUploadParams will create an erasure coder and return the FileUploadParams
-// to use when uploading using the provided parameters.
-func fileUploadParams(siaPath modules.SiaPath, dataPieces, parityPieces int, force bool, ct crypto.CipherType) (modules.FileUploadParams, error) {
+// skyfileFanoutErasureParams returns the erasure coding parameters to use for
+// the fanout of a large skyfile, which are the renter defaults unless they are
+// overridden by the upload parameters.
+func skyfileFanoutErasureParams(sup modules.SkyfileUploadParameters) (dataPieces, parityPieces int, err error) {
+	if sup.FanoutDataPieces == 0 && sup.FanoutParityPieces == 0 {
+		return modules.RenterDefaultDataPieces, modules.RenterDefaultParityPieces, nil
+	}
+	if sup.FanoutDataPieces == 0 || sup.FanoutParityPieces == 0 {
+		return 0, 0, errors.AddContext(errInvalidErasureParams, "fanout data pieces and parity pieces need to be set together")
+	}
+	dataPieces, parityPieces = int(sup.FanoutDataPieces), int(sup.FanoutParityPieces)
+	if err := validateErasureParams(dataPieces, parityPieces); err != nil {
+		return 0, 0, err
+	}
+	return dataPieces, parityPieces, nil
+}
+
+// managedCheckSkyfileExtendedPath returns ErrSkyfileExtendedPathExists if a
+// siafile already exists at the given extended siapath of a skyfile and force
+// isn't set. This allows failing an upload before any data is uploaded.
+func (r *Renter) managedCheckSkyfileExtendedPath(extendedPath modules.SiaPath, force bool) error {
+	if force {
+		return nil
+	}
+	exists, err := r.staticFileSystem.FileExists(extendedPath)
+	if err != nil {
+		return errors.AddContext(err, "unable to check whether the extended siapath exists")
+	}
+	if exists {
+		return errors.AddContext(ErrSkyfileExtendedPathExists, fmt.Sprintf("siafile at '%v' would be overwritten, use force to overwrite it", extendedPath))
+	}
+	return nil
+}
+
+// validateErasureParams checks whether the given erasure coding parameters can
+// be used to construct an erasure coder. This allows catching malformed
+// parameters, e.g. from a corrupt layout, before allocating any buffers or
+// contacting any hosts.
+func validateErasureParams(dataPieces, parityPieces int) error {
+	if dataPieces < 1 {
+		return errors.AddContext(errInvalidErasureParams, fmt.Sprintf("data pieces must be at least 1, got %v", dataPieces))
+	}
+	if parityPieces < 0 {
+		return errors.AddContext(errInvalidErasureParams, fmt.Sprintf("parity pieces must not be negative, got %v", parityPieces))
+	}
+	if dataPieces+parityPieces > maxErasureCodingShards {
+		return errors.AddContext(errInvalidErasureParams, fmt.Sprintf("total number of pieces %v exceeds the maximum of %v", dataPieces+parityPieces, maxErasureCodingShards))
+	}
+	return nil
+}
+
+// managedFileUploadParams will create an erasure coder and return the
+// FileUploadParams to use when uploading using the provided parameters.
+//
+// Skyfiles are content addressed and must never change after the skylink was
+// created. Partial chunks can change when they are combined, which is why
+// disablePartialChunk must always be true for any upload that feeds into a
+// skylink. Enabling partial chunks for the siapath of a skyfile, as determined
+// by managedIsSkyfileSiaPath, is refused.
+func (r *Renter) managedFileUploadParams(siaPath modules.SiaPath, dataPieces, parityPieces int, force bool, ct crypto.CipherType, disablePartialChunk bool) (modules.FileUploadParams, error) {
+	if !disablePartialChunk {
+		isSkyfile, err := r.managedIsSkyfileSiaPath(siaPath)
+		if err != nil {
+			return modules.FileUploadParams{}, errors.AddContext(err, "unable to check whether the siapath belongs to a skyfile")
+		}
+		if isSkyfile {
+			return modules.FileUploadParams{}, errors.AddContext(errPartialChunksForSkyfile, siaPath.String())
+		}
+	}
+
 	// Create the erasure coder
 	ec, err := modules.NewRSSubCode(dataPieces, parityPieces, crypto.SegmentSize)
 	if err != nil {
@@ -95,16 +240,51 @@ func fileUploadParams(siaPath modules.SiaPath, dataPieces, parityPieces int, for
 		SiaPath:             siaPath,
 		ErasureCode:         ec,
 		Force:               force,
-		DisablePartialChunk: true,  // must be set to true - partial chunks change, content addressed files must not change.
+		DisablePartialChunk: disablePartialChunk,
 		Repair:              false, // indicates whether this is a repair operation
 		CipherType:          ct,
 	}, nil
 }
 
-// baseSectorUploadParamsFromSUP will derive the FileUploadParams to use when
-// uploading the base chunk siafile of a skyfile using the skyfile's upload
+// managedIsSkyfileSiaPath returns true if the siapath belongs to a skyfile.
+// That is the case for any siapath within the Skynet folder and for the
+// extended siafile of a skyfile, even if the skyfile doesn't exist yet. Skyfiles
+// uploaded outside of the Skynet folder, e.g. using Root, are recognized by the
+// skylinks of their base or extended siafile.
+func (r *Renter) managedIsSkyfileSiaPath(siaPath modules.SiaPath) (bool, error) {
+	if strings.HasSuffix(siaPath.String(), modules.ExtendedSuffix) {
+		return true, nil
+	}
+	if strings.HasPrefix(siaPath.String(), modules.SkynetFolder.String()+"/") {
+		return true, nil
+	}
+	extendedPath, err := modules.ExtendedSiaPath(siaPath)
+	if err != nil {
+		return false, err
+	}
+	for _, sp := range []modules.SiaPath{siaPath, extendedPath} {
+		fileNode, err := r.staticFileSystem.OpenSiaFile(sp)
+		if errors.Contains(err, filesystem.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return false, errors.AddContext(err, "unable to open siafile")
+		}
+		numSkylinks := len(fileNode.Metadata().Skylinks)
+		if err := fileNode.Close(); err != nil {
+			return false, errors.AddContext(err, "unable to close siafile")
+		}
+		if numSkylinks > 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// managedBaseSectorUploadParamsFromSUP will derive the FileUploadParams to use
+// when uploading the base chunk siafile of a skyfile using the skyfile's upload
 // parameters.
-func baseSectorUploadParamsFromSUP(sup modules.SkyfileUploadParameters) (modules.FileUploadParams, error) {
+func (r *Renter) managedBaseSectorUploadParamsFromSUP(sup modules.SkyfileUploadParameters) (modules.FileUploadParams, error) {
 	// Establish defaults
 	skyfileEstablishDefaults(&sup)
 
@@ -112,7 +292,7 @@ func baseSectorUploadParamsFromSUP(sup modules.SkyfileUploadParameters) (modules
 	// encryption. This should cause all of the pieces to have the same Merkle
 	// root, which is critical to making the file discoverable to viewnodes and
 	// also resilient to host failures.
-	return fileUploadParams(sup.SiaPath, 1, int(sup.BaseChunkRedundancy)-1, sup.Force, crypto.TypePlain)
+	return r.managedFileUploadParams(sup.SiaPath, 1, int(sup.BaseChunkRedundancy)-1, sup.Force, crypto.TypePlain, true)
 }
 
 // streamerFromReader wraps a bytes.Reader to give it a Close() method, which
@@ -166,22 +346,104 @@ func (r *Renter) CreateSkylinkFromSiafile(sup modules.SkyfileUploadParameters, s
 	return r.managedCreateSkylinkFromFileNode(sup, metadata, fileNode, nil)
 }
 
+// RepairSkyfileBaseSector rebuilds the base sector of a skyfile whose base
+// sector became unavailable while its fanout is still around. The base sector
+// is deterministically rebuilt from the original metadata and the siafile of
+// the fanout and uploaded to sup.SiaPath, or the skylink's default siapath if
+// none is given. The repair fails without uploading anything if the rebuilt
+// base sector doesn't result in the given skylink.
+func (r *Renter) RepairSkyfileBaseSector(sup modules.SkyfileUploadParameters, link modules.Skylink, metadata modules.SkyfileMetadata, fanoutSiaPath modules.SiaPath) (err error) {
+	if err := r.tg.Add(); err != nil {
+		return err
+	}
+	defer r.tg.Done()
+
+	// Encryption is not supported for repairs.
+	if encryptionEnabled(&sup) {
+		return errors.AddContext(ErrEncryptionNotSupported, "unable to repair base sector")
+	}
+	if !link.IsSkylinkV1() {
+		return errors.New("only the base sector of v1 skylinks can be repaired")
+	}
+	if r.staticSkynetBlocklist.IsBlocked(link) {
+		return ErrSkylinkBlocked
+	}
+
+	// Set reasonable default values for any sup fields that are blank.
+	if sup.SiaPath.IsEmpty() {
+		sup.SiaPath, _, err = modules.SkylinkSiaPath(link)
+		if err != nil {
+			return errors.AddContext(err, "unable to create siapath for skylink")
+		}
+	}
+	skyfileEstablishDefaults(&sup)
+
+	// Grab the filenode of the fanout.
+	fileNode, err := r.staticFileSystem.OpenSiaFile(fanoutSiaPath)
+	if err != nil {
+		return errors.AddContext(err, "unable to open fanout siafile")
+	}
+	defer func() {
+		err = errors.Compose(err, fileNode.Close())
+	}()
+
+	// Rebuild the base sector and make sure it matches the skylink.
+	baseSector, skylink, err := r.managedBuildSkyfileBaseSector(sup, metadata, fileNode, nil, false)
+	if err != nil {
+		return errors.AddContext(err, "unable to rebuild base sector")
+	}
+	if skylink != link {
+		return errors.AddContext(errSkylinkMismatch, fmt.Sprintf("rebuilt base sector results in skylink %v", skylink))
+	}
+
+	// Upload the base sector.
+	err = r.managedUploadBaseSector(sup, baseSector, skylink)
+	if err != nil {
+		return errors.AddContext(err, "unable to upload rebuilt base sector")
+	}
+
+	// Make sure the fanout tracks the skylink as well.
+	return errors.AddContext(fileNode.AddSkylink(skylink), "unable to add skylink to fanout siafile")
+}
+
 // managedCreateSkylinkFromFileNode creates a skylink from a file node.
 //
 // The name needs to be passed in explicitly because a file node does not track
 // its own name, which allows the file to be renamed concurrently without
 // causing any race conditions.
 func (r *Renter) managedCreateSkylinkFromFileNode(sup modules.SkyfileUploadParameters, skyfileMetadata modules.SkyfileMetadata, fileNode *filesystem.FileNode, fanoutReader io.Reader) (modules.Skylink, error) {
+	baseSector, skylink, err := r.managedBuildSkyfileBaseSector(sup, skyfileMetadata, fileNode, fanoutReader, false)
+	if err != nil {
+		return modules.Skylink{}, err
+	}
+	if r.deps.Disrupt("SkyfileUploadFailAfterSkylink") {
+		return modules.Skylink{}, errors.New("SkyfileUploadFailAfterSkylink")
+	}
+	if sup.DryRun {
+		return skylink, nil
+	}
+	err = r.managedFinalizeSkyfile(sup, fileNode, baseSector, skylink)
+	if err != nil {
+		return modules.Skylink{}, err
+	}
+	return skylink, nil
+}
+
+// managedBuildSkyfileBaseSector builds the base sector for a file node and
+// returns it together with the resulting skylink. If beforeUpload is true, the
+// pieces of the file node might not have been uploaded yet and the fanout is
+// derived from the fanoutReader.
+func (r *Renter) managedBuildSkyfileBaseSector(sup modules.SkyfileUploadParameters, skyfileMetadata modules.SkyfileMetadata, fileNode *filesystem.FileNode, fanoutReader io.Reader, beforeUpload bool) ([]byte, modules.Skylink, error) {
 	// Check if the given metadata is valid
-	err := modules.ValidateSkyfileMetadata(skyfileMetadata)
+	err := modules.ValidateSkyfileMetadata(skyfileMetadata, r.managedSkyfileMaxSubfiles())
 	if err != nil {
-		return modules.Skylink{}, errors.Compose(ErrInvalidMetadata, err)
+		return nil, modules.Skylink{}, errors.Compose(ErrInvalidMetadata, err)
 	}
 
 	// Check if any of the skylinks associated with the siafile are blocked
 	if r.isFileNodeBlocked(fileNode) {
 		// Skylink is blocked, return error and try and delete file
-		return modules.Skylink{}, errors.Compose(ErrSkylinkBlocked, r.DeleteFile(sup.SiaPath))
+		return nil, modules.Skylink{}, errors.Compose(ErrSkylinkBlocked, r.DeleteFile(sup.SiaPath))
 	}
 
 	// Check that the encryption key and erasure code is compatible with the
@@ -189,28 +451,58 @@ func (r *Renter) managedCreateSkylinkFromFileNode(sup modules.SkyfileUploadParam
 	// to catch errors early on.
 	var sl modules.SkyfileLayout
 	masterKey := fileNode.MasterKey()
+	if err := validateSkyfileCipherType(masterKey.Type()); err != nil {
+		return nil, modules.Skylink{}, err
+	}
 	if len(masterKey.Key()) > len(sl.KeyData) {
-		return modules.Skylink{}, errors.New("cipher key is not supported by the skyfile format")
+		return nil, modules.Skylink{}, errors.New("cipher key is not supported by the skyfile format")
 	}
 	ec := fileNode.ErasureCode()
 	if ec.Type() != modules.ECReedSolomonSubShards64 {
-		return modules.Skylink{}, errors.New("siafile has unsupported erasure code type")
+		return nil, modules.Skylink{}, errors.New("siafile has unsupported erasure code type")
 	}
 
 	// Marshal the metadata.
 	metadataBytes, err := modules.SkyfileMetadataBytes(skyfileMetadata)
 	if err != nil {
-		return modules.Skylink{}, errors.AddContext(err, "error retrieving skyfile metadata bytes")
+		return nil, modules.Skylink{}, errors.AddContext(err, "error retrieving skyfile metadata bytes")
+	}
+	err = r.managedValidateSkyfileMetadataBytes(metadataBytes)
+	if err != nil {
+		return nil, modules.Skylink{}, err
 	}
 
-	// Create the fanout for the siafile.
-	fanoutBytes, err := skyfileEncodeFanout(fileNode, fanoutReader)
+	// Create the fanout for the siafile. If a precomputed fanout was supplied
+	// it is used instead once it was validated against the file's pieces. If
+	// the pieces of the file haven't been uploaded yet, the fanout needs to be
+	// derived from the reader.
+	var fanoutBytes []byte
+	if len(sup.Fanout) > 0 {
+		if beforeUpload {
+			return nil, modules.Skylink{}, errors.New("a precomputed fanout can't be validated before the file is uploaded")
+		}
+		err = skyfileValidatePrecomputedFanout(fileNode, sup.Fanout)
+		if err != nil {
+			return nil, modules.Skylink{}, errors.AddContext(err, "invalid precomputed fanout")
+		}
+		fanoutBytes = sup.Fanout
+	} else if beforeUpload {
+		fanoutBytes, err = skyfileEncodeFanoutBeforeUpload(fileNode, fanoutReader)
+	} else {
+		fanoutBytes, err = skyfileEncodeFanout(fileNode, fanoutReader)
+	}
 	if err != nil {
-		return modules.Skylink{}, errors.AddContext(err, "unable to encode the fanout of the siafile")
+		return nil, modules.Skylink{}, errors.AddContext(err, "unable to encode the fanout of the siafile")
+	}
+	if skyfileVerifyFanoutEnabled {
+		err = skyfileVerifyFanout(fileNode, fanoutBytes)
+		if err != nil {
+			return nil, modules.Skylink{}, errors.AddContext(err, "encoded fanout failed verification")
+		}
 	}
 	headerSize := uint64(modules.SkyfileLayoutSize + len(metadataBytes) + len(fanoutBytes))
 	if headerSize > modules.SectorSize {
-		return modules.Skylink{}, errors.AddContext(ErrMetadataTooBig, fmt.Sprintf("skyfile does not fit in leading chunk - metadata size plus fanout size must be less than %v bytes, metadata size is %v bytes and fanout size is %v bytes", modules.SectorSize-modules.SkyfileLayoutSize, len(metadataBytes), len(fanoutBytes)))
+		return nil, modules.Skylink{}, errors.AddContext(ErrMetadataTooBig, fmt.Sprintf("skyfile does not fit in leading chunk - metadata size plus fanout size must be less than %v bytes, metadata size is %v bytes and fanout size is %v bytes", modules.SectorSize-modules.SkyfileLayoutSize, len(metadataBytes), len(fanoutBytes)))
 	}
 
 	// Assemble the first chunk of the skyfile.
@@ -223,6 +515,10 @@ func (r *Renter) managedCreateSkylinkFromFileNode(sup modules.SkyfileUploadParam
 		FanoutParityPieces: uint8(ec.NumPieces() - ec.MinPieces()),
 		CipherType:         masterKey.Type(),
 	}
+	err = modules.ValidateSkyfileLayout(sl, fanoutBytes, skyfileMetadata)
+	if err != nil {
+		return nil, modules.Skylink{}, errors.Compose(ErrInvalidMetadata, err)
+	}
 	// If we're uploading in plaintext, we put the key in the baseSector
 	if !encryptionEnabled(&sup) {
 		copy(sl.KeyData[:], masterKey.Key())
@@ -235,7 +531,7 @@ func (r *Renter) managedCreateSkylinkFromFileNode(sup modules.SkyfileUploadParam
 	if encryptionEnabled(&sup) {
 		err = encryptBaseSectorWithSkykey(baseSector, sl, sup.FileSpecificSkykey)
 		if err != nil {
-			return modules.Skylink{}, errors.AddContext(err, "Failed to encrypt base sector for upload")
+			return nil, modules.Skylink{}, errors.AddContext(err, "Failed to encrypt base sector for upload")
 		}
 	}
 
@@ -243,31 +539,32 @@ func (r *Renter) managedCreateSkylinkFromFileNode(sup modules.SkyfileUploadParam
 	baseSectorRoot := crypto.MerkleRoot(baseSector)
 	skylink, err := modules.NewSkylinkV1(baseSectorRoot, 0, fetchSize)
 	if err != nil {
-		return modules.Skylink{}, errors.AddContext(err, "unable to build skylink")
-	}
-	if sup.DryRun {
-		return skylink, nil
+		return nil, modules.Skylink{}, errors.AddContext(err, "unable to build skylink")
 	}
+	return baseSector, skylink, nil
+}
 
+// managedFinalizeSkyfile adds the skylink to the file node and uploads the
+// base sector of the skyfile.
+func (r *Renter) managedFinalizeSkyfile(sup modules.SkyfileUploadParameters, fileNode *filesystem.FileNode, baseSector []byte, skylink modules.Skylink) error {
 	// Check if the new skylink is blocked
 	if r.staticSkynetBlocklist.IsBlocked(skylink) {
 		// Skylink is blocked, return error and try and delete file
-		return modules.Skylink{}, errors.Compose(ErrSkylinkBlocked, r.DeleteFile(sup.SiaPath))
+		return errors.Compose(ErrSkylinkBlocked, r.DeleteFile(sup.SiaPath))
 	}
 
 	// Add the skylink to the siafiles.
-	err = fileNode.AddSkylink(skylink)
+	err := fileNode.AddSkylink(skylink)
 	if err != nil {
-		return skylink, errors.AddContext(err, "unable to add skylink to the sianodes")
+		return errors.AddContext(err, "unable to add skylink to the sianodes")
 	}
 
 	// Upload the base sector.
 	err = r.managedUploadBaseSector(sup, baseSector, skylink)
 	if err != nil {
-		return modules.Skylink{}, errors.AddContext(err, "Unable to upload base sector for file node. ")
+		return errors.AddContext(err, "Unable to upload base sector for file node. ")
 	}
-
-	return skylink, errors.AddContext(err, "unable to add skylink to the sianodes")
+	return nil
 }
 
 // managedCreateFileNodeFromReader takes the file upload parameters and a reader
@@ -375,22 +672,54 @@ func (r *Renter) UpdateSkynetPortals(additions []modules.SkynetPortal, removals
 	return r.staticSkynetPortals.UpdatePortals(additions, removals)
 }
 
+// UpdateSkynetPortalsPartial updates the list of known Skynet portals,
+// applying the valid changes and reporting the invalid ones.
+func (r *Renter) UpdateSkynetPortalsPartial(additions []modules.SkynetPortal, removals []modules.NetAddress) (modules.SkynetPortalsUpdateResult, error) {
+	err := r.tg.Add()
+	if err != nil {
+		return modules.SkynetPortalsUpdateResult{}, err
+	}
+	defer r.tg.Done()
+	return r.staticSkynetPortals.UpdatePortalsPartial(additions, removals)
+}
+
 // managedUploadBaseSector will take the raw baseSector bytes and upload them,
 // returning the resulting merkle root, and the fileNode of the siafile that is
 // tracking the base sector.
 func (r *Renter) managedUploadBaseSector(sup modules.SkyfileUploadParameters, baseSector []byte, skylink modules.Skylink) (err error) {
-	uploadParams, err := baseSectorUploadParamsFromSUP(sup)
+	uploadParams, err := r.managedBaseSectorUploadParamsFromSUP(sup)
 	if err != nil {
 		return errors.AddContext(err, "failed to create siafile upload parameters")
 	}
+	if sup.ConsistentBaseSectorHosts {
+		numPieces := uploadParams.ErasureCode.NumPieces()
+		uploadParams.PreferredHosts = r.managedBaseSectorHosts(skylink.MerkleRoot(), numPieces)
+	}
 
-	// Turn the base sector into a reader
-	reader := bytes.NewReader(baseSector)
+	// Perform the actual upload. The base sector is small and in memory, so
+	// transient failures are retried with a fresh reader.
+	var fileNode *filesystem.FileNode
+	for attempt := 1; ; attempt++ {
+		fileNode, err = r.callUploadStreamFromReader(uploadParams, bytes.NewReader(baseSector))
+		if err == nil {
+			break
+		}
+		if attempt >= baseSectorUploadMaxAttempts || !isTransientUploadStreamError(err) {
+			return errors.AddContext(err, "failed to stream upload small skyfile")
+		}
+		r.log.Debugf("retrying base sector upload of %v after transient error: %v", uploadParams.SiaPath, err)
 
-	// Perform the actual upload.
-	fileNode, err := r.callUploadStreamFromReader(uploadParams, reader)
-	if err != nil {
-		return errors.AddContext(err, "failed to stream upload small skyfile")
+		// The failed attempt created the siafile, which needs to be removed
+		// before the next attempt can create it again.
+		err = r.managedDeleteSiafileIfExists(uploadParams.SiaPath)
+		if err != nil {
+			return errors.AddContext(err, "failed to clean up after failed base sector upload")
+		}
+		select {
+		case <-r.tg.StopChan():
+			return errors.New("base sector upload interrupted by shutdown")
+		case <-time.After(baseSectorUploadRetryInterval):
+		}
 	}
 	defer func() {
 		err = errors.Compose(err, fileNode.Close())
@@ -398,16 +727,101 @@ func (r *Renter) managedUploadBaseSector(sup modules.SkyfileUploadParameters, ba
 
 	// Add the skylink to the Siafile.
 	err = fileNode.AddSkylink(skylink)
-	return errors.AddContext(err, "unable to add skylink to siafile")
+	if err != nil {
+		return errors.AddContext(err, "unable to add skylink to siafile")
+	}
+	if r.deps.Disrupt("SkyfileUploadFailAfterBaseSector") {
+		return errors.New("SkyfileUploadFailAfterBaseSector")
+	}
+	return nil
+}
+
+// isTransientUploadStreamError returns whether an error returned by the upload
+// streamer is transient, meaning that retrying the upload might succeed.
+func isTransientUploadStreamError(err error) bool {
+	return errors.Contains(err, errNotEnoughUploadWorkers) || errors.Contains(err, errStreamChunkUnavailable)
+}
+
+// managedUploadBaseSectorAndFanout uploads the base sector and the fanout of a
+// skyfile concurrently. Once the layout is known the base sector no longer
+// depends on the fanout data, so there is no need to wait for one upload to
+// finish before starting the other. If either of the uploads fails, the siafiles
+// created by both uploads are deleted again. Canceling the context aborts the
+// fanout upload. On success the fileNode of the fanout siafile is returned and
+// the caller is responsible for closing it.
+func (r *Renter) managedUploadBaseSectorAndFanout(ctx context.Context, sup modules.SkyfileUploadParameters, baseSector []byte, skylink modules.Skylink, fup modules.FileUploadParams, fanoutReader io.Reader) (*filesystem.FileNode, error) {
+	// Upload the base sector in a separate thread.
+	baseSectorErrChan := make(chan error, 1)
+	err := r.tg.Launch(func() {
+		r.deps.Disrupt("SkyfileBaseSectorUploadStarted")
+		baseSectorErrChan <- r.managedUploadBaseSector(sup, baseSector, skylink)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Upload the fanout.
+	r.deps.Disrupt("SkyfileFanoutUploadStarted")
+	fileNode, fanoutErr := r.callUploadStreamFromReaderWithContext(ctx, fup, fanoutReader)
+	if fanoutErr != nil {
+		fanoutErr = errors.AddContext(fanoutErr, "unable to upload large skyfile")
+	}
+
+	// Wait for the base sector upload to finish.
+	baseSectorErr := <-baseSectorErrChan
+	if baseSectorErr != nil {
+		baseSectorErr = errors.AddContext(baseSectorErr, "failed to upload base sector")
+	}
+	if baseSectorErr == nil && fanoutErr == nil {
+		return fileNode, nil
+	}
+
+	// At least one of the uploads failed, clean up. A siafile is not deleted
+	// if the upload failed because it already existed, since in that case the
+	// siafile wasn't created by this upload. The base sector is also kept if
+	// the fanout upload was canceled and the caller asked to keep it.
+	err = errors.Compose(baseSectorErr, fanoutErr)
+	if fileNode != nil {
+		err = errors.Compose(err, fileNode.Close())
+	}
+	keepBaseSector := baseSectorErr == nil && ctx.Err() != nil && sup.PinKeepBaseSectorOnCancel
+	if !keepBaseSector && !errors.Contains(baseSectorErr, filesystem.ErrExists) {
+		err = errors.Compose(err, r.managedDeleteSiafileIfExists(sup.SiaPath))
+	}
+	if !errors.Contains(fanoutErr, filesystem.ErrExists) {
+		err = errors.Compose(err, r.managedDeleteSiafileIfExists(fup.SiaPath))
+	}
+	return nil, err
+}
+
+// managedDeleteSiafileIfExists deletes the siafile at the given siapath,
+// ignoring the error returned if there is no such file.
+func (r *Renter) managedDeleteSiafileIfExists(siaPath modules.SiaPath) error {
+	err := r.DeleteFile(siaPath)
+	if err != nil && !errors.Contains(err, filesystem.ErrNotExist) {
+		return errors.AddContext(err, fmt.Sprintf("unable to delete siafile '%v'", siaPath))
+	}
+	return nil
 }
 
 // managedUploadSkyfile uploads a file and returns the skylink and whether or
-// not it was a large file.
-func (r *Renter) managedUploadSkyfile(sup modules.SkyfileUploadParameters, reader modules.SkyfileUploadReader) (modules.Skylink, error) {
+// not it was a large file. If skylinkChan is set, the skylink of a large file
+// is sent on it as soon as it is known, which might be before the upload of
+// the file's data has completed.
+func (r *Renter) managedUploadSkyfile(sup modules.SkyfileUploadParameters, reader modules.SkyfileUploadReader, skylinkChan chan<- modules.Skylink) (modules.Skylink, error) {
 	// see if we can fit the entire upload in a single chunk
+	//
+	// NOTE: io.ReadFull returns an io.ErrUnexpectedEOF if the reader reached
+	// its end before the buffer was filled. This is expected for small files.
+	// The skyfile readers make sure that an io.ErrUnexpectedEOF returned by
+	// the data source itself, which indicates truncated data, surfaces as
+	// modules.ErrSkyfileUploadTruncated instead.
 	buf := make([]byte, modules.SectorSize)
 	numBytes, err := io.ReadFull(reader, buf)
 	buf = buf[:numBytes] // truncate the buffer
+	if err != nil && !errors.Contains(err, io.EOF) && !errors.Contains(err, io.ErrUnexpectedEOF) {
+		return modules.Skylink{}, errors.AddContext(err, "unable to read skyfile data")
+	}
 
 	// if we've reached EOF, we can safely fetch the metadata and calculate the
 	// actual header size, if that fits in a single sector we can upload the
@@ -420,7 +834,7 @@ func (r *Renter) managedUploadSkyfile(sup modules.SkyfileUploadParameters, reade
 		}
 
 		// check whether it's valid
-		err = modules.ValidateSkyfileMetadata(metadata)
+		err = modules.ValidateSkyfileMetadata(metadata, r.managedSkyfileMaxSubfiles())
 		if err != nil {
 			return modules.Skylink{}, errors.Compose(ErrInvalidMetadata, err)
 		}
@@ -429,10 +843,26 @@ func (r *Renter) managedUploadSkyfile(sup modules.SkyfileUploadParameters, reade
 		if err != nil {
 			return modules.Skylink{}, errors.AddContext(err, "unable to get skyfile metadata bytes")
 		}
+		err = r.managedValidateSkyfileMetadataBytes(metadataBytes)
+		if err != nil {
+			return modules.Skylink{}, err
+		}
 
-		// verify if it fits in a single chunk
+		// if the metadata on its own doesn't fit in the base sector, a large
+		// file upload is bound to fail as well, so we can fail early instead
+		// of uploading all of the data first
 		headerSize := uint64(modules.SkyfileLayoutSize + len(metadataBytes))
+		if headerSize > modules.SectorSize {
+			return modules.Skylink{}, errors.AddContext(ErrMetadataTooBig, fmt.Sprintf("skyfile metadata must be less than %v bytes, metadata size is %v bytes", modules.SectorSize-modules.SkyfileLayoutSize, len(metadataBytes)))
+		}
+
+		// verify if it fits in a single chunk
 		if uint64(numBytes)+headerSize <= modules.SectorSize {
+			// the subfiles need to cover the file back to back
+			err = modules.ValidateSkyfileLayout(modules.SkyfileLayout{Filesize: uint64(numBytes)}, nil, metadata)
+			if err != nil {
+				return modules.Skylink{}, errors.Compose(ErrInvalidMetadata, err)
+			}
 			return r.managedUploadSkyfileSmallFile(sup, metadataBytes, buf)
 		}
 	}
@@ -441,26 +871,22 @@ func (r *Renter) managedUploadSkyfile(sup modules.SkyfileUploadParameters, reade
 	// data combined with the header exceeds a single sector, we add the data we
 	// already read and upload as a large file
 	reader.AddReadBuffer(buf)
-	return r.managedUploadSkyfileLargeFile(sup, reader)
+	return r.managedUploadSkyfileLargeFile(sup, reader, skylinkChan)
 }
 
 // managedUploadSkyfileSmallFile uploads a file that fits entirely in the
 // leading chunk of a skyfile to the Sia network and returns the skylink that
 // can be used to access the file.
 func (r *Renter) managedUploadSkyfileSmallFile(sup modules.SkyfileUploadParameters, metadataBytes, fileBytes []byte) (modules.Skylink, error) {
-	sl := modules.SkyfileLayout{
-		Version:      modules.SkyfileVersion,
-		Filesize:     uint64(len(fileBytes)),
-		MetadataSize: uint64(len(metadataBytes)),
-		// No fanout is set yet.
-		// If encryption is set in the upload params, this will be overwritten.
-		CipherType: crypto.TypePlain,
-	}
-
 	// Create the base sector. This is done as late as possible so that any
 	// errors are caught before a large block of memory is allocated.
-	baseSector, fetchSize := modules.BuildBaseSector(sl.Encode(), nil, metadataBytes, fileBytes) // 'nil' because there is no fanout
+	sl, baseSector, fetchSize, err := modules.BuildSmallSkyfileBaseSector(metadataBytes, fileBytes)
+	if err != nil {
+		return modules.Skylink{}, errors.AddContext(err, "failed to build base sector")
+	}
 
+	// If encryption is set in the upload params, the plaintext base sector
+	// is encrypted in place, including the cipher type of its layout.
 	if encryptionEnabled(&sup) {
 		err := encryptBaseSectorWithSkykey(baseSector, sl, sup.FileSpecificSkykey)
 		if err != nil {
@@ -474,6 +900,9 @@ func (r *Renter) managedUploadSkyfileSmallFile(sup modules.SkyfileUploadParamete
 	if err != nil {
 		return modules.Skylink{}, errors.AddContext(err, "failed to build the skylink")
 	}
+	if r.deps.Disrupt("SkyfileUploadFailAfterSkylink") {
+		return modules.Skylink{}, errors.New("SkyfileUploadFailAfterSkylink")
+	}
 
 	// If this is a dry-run, we do not need to upload the base sector
 	if sup.DryRun {
@@ -492,16 +921,35 @@ func (r *Renter) managedUploadSkyfileSmallFile(sup modules.SkyfileUploadParamete
 // data to a large siafile and upload it to the Sia network using
 // 'callUploadStreamFromReader'. The final skylink is created by calling
 // 'CreateSkylinkFromSiafile' on the resulting siafile.
-func (r *Renter) managedUploadSkyfileLargeFile(sup modules.SkyfileUploadParameters, fileReader modules.SkyfileUploadReader) (modules.Skylink, error) {
+//
+// If skylinkChan is set, the skylink is computed as soon as all of the data
+// has been read from the fileReader and sent on the channel while the data
+// continues to be uploaded.
+func (r *Renter) managedUploadSkyfileLargeFile(sup modules.SkyfileUploadParameters, fileReader modules.SkyfileUploadReader, skylinkChan chan<- modules.Skylink) (modules.Skylink, error) {
 	// Create the siapath for the skyfile extra data. This is going to be the
 	// same as the skyfile upload siapath, except with a suffix.
-	siaPath, err := modules.NewSiaPath(sup.SiaPath.String() + modules.ExtendedSuffix)
+	siaPath, err := modules.ExtendedSiaPath(sup.SiaPath)
 	if err != nil {
 		return modules.Skylink{}, errors.AddContext(err, "unable to create SiaPath for large skyfile extended data")
 	}
 
+	// Make sure the extended siafile can be created. A dry run doesn't create
+	// any siafiles.
+	if !sup.DryRun {
+		err = r.managedCheckSkyfileExtendedPath(siaPath, sup.Force)
+		if err != nil {
+			return modules.Skylink{}, errors.AddContext(err, "unable to upload large skyfile")
+		}
+	}
+
+	// Validate the erasure coding parameters before doing any work.
+	dataPieces, parityPieces, err := skyfileFanoutErasureParams(sup)
+	if err != nil {
+		return modules.Skylink{}, errors.AddContext(err, "unable to upload large skyfile")
+	}
+
 	// Create the FileUploadParams
-	fup, err := fileUploadParams(siaPath, modules.RenterDefaultDataPieces, modules.RenterDefaultParityPieces, sup.Force, crypto.TypePlain)
+	fup, err := r.managedFileUploadParams(siaPath, dataPieces, parityPieces, sup.Force, crypto.TypePlain, true)
 	if err != nil {
 		return modules.Skylink{}, errors.AddContext(err, "unable to create FileUploadParams for large file")
 	}
@@ -521,6 +969,49 @@ func (r *Renter) managedUploadSkyfileLargeFile(sup modules.SkyfileUploadParamete
 		if err != nil {
 			return modules.Skylink{}, errors.AddContext(err, "unable to upload large skyfile")
 		}
+	} else if skylinkChan != nil {
+		// Upload the file using a streamer and build the base sector as soon
+		// as all of the data has been read.
+		var baseSector []byte
+		var skylink modules.Skylink
+		readDone := func(fn *filesystem.FileNode) error {
+			metadata, err := fileReader.SkyfileMetadata(r.tg.StopCtx())
+			if err != nil {
+				return errors.AddContext(err, "unable to get skyfile metadata")
+			}
+			baseSector, skylink, err = r.managedBuildSkyfileBaseSector(sup, metadata, fn, fileReader.FanoutReader(), true)
+			if err != nil {
+				return errors.AddContext(err, "unable to create skylink from filenode")
+			}
+			if r.staticSkynetBlocklist.IsBlocked(skylink) {
+				return ErrSkylinkBlocked
+			}
+			if r.deps.Disrupt("SkyfileUploadFailAfterSkylink") {
+				return errors.New("SkyfileUploadFailAfterSkylink")
+			}
+			skylinkChan <- skylink
+			return nil
+		}
+		fileNode, err = r.callUploadStreamFromReaderWithCallback(context.Background(), fup, fileReader, readDone)
+		if err != nil {
+			return modules.Skylink{}, errors.AddContext(err, "unable to upload large skyfile")
+		}
+		defer func() {
+			err := fileNode.Close()
+			if err != nil {
+				r.log.Printf("Could not close node, err: %s\n", err.Error())
+			}
+		}()
+		if r.deps.Disrupt("SkyfileUploadFailAfterFanout") {
+			return modules.Skylink{}, errors.New("SkyfileUploadFailAfterFanout")
+		}
+
+		// Finish the skyfile now that the data is available.
+		err = r.managedFinalizeSkyfile(sup, fileNode, baseSector, skylink)
+		if err != nil {
+			return modules.Skylink{}, errors.AddContext(err, "unable to create skylink from filenode")
+		}
+		return skylink, nil
 	} else {
 		// Upload the file using a streamer.
 		fileNode, err = r.callUploadStreamFromReader(fup, fileReader)
@@ -536,6 +1027,9 @@ func (r *Renter) managedUploadSkyfileLargeFile(sup modules.SkyfileUploadParamete
 			r.log.Printf("Could not close node, err: %s\n", err.Error())
 		}
 	}()
+	if !sup.DryRun && r.deps.Disrupt("SkyfileUploadFailAfterFanout") {
+		return modules.Skylink{}, errors.New("SkyfileUploadFailAfterFanout")
+	}
 
 	// Get the SkyfileMetadata from the reader object.
 	metadata, err := fileReader.SkyfileMetadata(r.tg.StopCtx())
@@ -555,14 +1049,22 @@ func (r *Renter) managedUploadSkyfileLargeFile(sup modules.SkyfileUploadParamete
 // DownloadByRoot will fetch data using the merkle root of that data. This uses
 // all of the async worker primitives to improve speed and throughput.
 func (r *Renter) DownloadByRoot(root crypto.Hash, offset, length uint64, timeout time.Duration, pricePerMS types.Currency) ([]byte, error) {
+	data, _, err := r.DownloadByRootWithStats(root, offset, length, timeout, pricePerMS)
+	return data, err
+}
+
+// DownloadByRootWithStats works like DownloadByRoot but also returns which
+// hosts were queried, how long they took and what the download cost. This
+// allows callers to tune the pricePerMS they use.
+func (r *Renter) DownloadByRootWithStats(root crypto.Hash, offset, length uint64, timeout time.Duration, pricePerMS types.Currency) ([]byte, modules.DownloadByRootStats, error) {
 	if err := r.tg.Add(); err != nil {
-		return nil, err
+		return nil, modules.DownloadByRootStats{}, err
 	}
 	defer r.tg.Done()
 
 	// Check if the merkleroot is blocked
 	if r.staticSkynetBlocklist.IsHashBlocked(crypto.HashObject(root)) {
-		return nil, ErrSkylinkBlocked
+		return nil, modules.DownloadByRootStats{}, ErrSkylinkBlocked
 	}
 
 	// Create the context
@@ -574,47 +1076,24 @@ func (r *Renter) DownloadByRoot(root crypto.Hash, offset, length uint64, timeout
 	}
 
 	// Fetch the data
-	data, err := r.managedDownloadByRoot(ctx, root, offset, length, pricePerMS)
-	if errors.Contains(err, ErrProjectTimedOut) {
-		err = errors.AddContext(err, fmt.Sprintf("timed out after %vs", timeout.Seconds()))
-	}
-	return data, err
-}
-
-// DownloadSkylink will take a link and turn it into the metadata and data of a
-// download.
-func (r *Renter) DownloadSkylink(link modules.Skylink, timeout time.Duration, pricePerMS types.Currency) (modules.SkyfileLayout, modules.SkyfileMetadata, modules.Streamer, error) {
-	if err := r.tg.Add(); err != nil {
-		return modules.SkyfileLayout{}, modules.SkyfileMetadata{}, nil, err
-	}
-	defer r.tg.Done()
-
-	// Check if link is blocked
-	if r.staticSkynetBlocklist.IsBlocked(link) {
-		return modules.SkyfileLayout{}, modules.SkyfileMetadata{}, nil, ErrSkylinkBlocked
-	}
-
-	// Download the data
-	layout, metadata, streamer, err := r.managedDownloadSkylink(link, timeout, pricePerMS)
+	data, stats, err := r.managedDownloadByRootWithStats(ctx, root, offset, length, pricePerMS)
 	if errors.Contains(err, ErrProjectTimedOut) {
 		err = errors.AddContext(err, fmt.Sprintf("timed out after %vs", timeout.Seconds()))
 	}
-	return layout, metadata, streamer, err
+	return data, stats, err
 }
 
-// DownloadSkylinkBaseSector will take a link and turn it into the data of
-// a basesector without any decoding of the metadata, fanout, or decryption.
-func (r *Renter) DownloadSkylinkBaseSector(link modules.Skylink, timeout time.Duration, pricePerMS types.Currency) (modules.Streamer, error) {
+// DownloadByRoots will fetch data for all of the given merkle roots
+// concurrently, using the same offset and length for every root. The timeout
+// applies to the call as a whole while the pricePerMS is the budget for every
+// individual root. A result is returned for every root, in the same order as
+// the roots.
+func (r *Renter) DownloadByRoots(roots []crypto.Hash, offset, length uint64, timeout time.Duration, pricePerMS types.Currency) ([]modules.DownloadByRootResult, error) {
 	if err := r.tg.Add(); err != nil {
 		return nil, err
 	}
 	defer r.tg.Done()
 
-	// Check if link is blocked
-	if r.staticSkynetBlocklist.IsBlocked(link) {
-		return nil, ErrSkylinkBlocked
-	}
-
 	// Create the context
 	ctx := r.tg.StopCtx()
 	if timeout > 0 {
@@ -623,56 +1102,619 @@ func (r *Renter) DownloadSkylinkBaseSector(link modules.Skylink, timeout time.Du
 		defer cancel()
 	}
 
-	// Find the fetch size.
-	offset, fetchSize, err := link.OffsetAndFetchSize()
-	if err != nil {
-		return nil, errors.AddContext(err, "unable to get offset and fetch size")
+	// Spin up a bounded number of threads that download the roots. All of
+	// them share the same worker pool.
+	results := make([]modules.DownloadByRootResult, len(roots))
+	indexChan := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < downloadByRootsMaxConcurrency && i < len(roots); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range indexChan {
+				data, err := r.managedDownloadByRoot(ctx, roots[index], offset, length, pricePerMS)
+				if errors.Contains(err, ErrProjectTimedOut) {
+					err = errors.AddContext(err, fmt.Sprintf("timed out after %vs", timeout.Seconds()))
+				}
+				results[index].Data = data
+				results[index].Err = err
+			}
+		}()
 	}
 
-	// Download the base sector
-	baseSector, err := r.managedDownloadByRoot(ctx, link.MerkleRoot(), offset, fetchSize, pricePerMS)
-	return StreamerFromSlice(baseSector), err
+	// Queue the roots, skipping the ones that are blocked.
+	for i, root := range roots {
+		results[i].Root = root
+		if r.staticSkynetBlocklist.IsHashBlocked(crypto.HashObject(root)) {
+			results[i].Err = ErrSkylinkBlocked
+			continue
+		}
+		indexChan <- i
+	}
+	close(indexChan)
+	wg.Wait()
+	return results, nil
+}
+
+// DownloadSkylink will take a link and turn it into the metadata and data of a
+// download.
+func (r *Renter) DownloadSkylink(link modules.Skylink, timeout time.Duration, pricePerMS types.Currency) (modules.SkyfileLayout, modules.SkyfileMetadata, modules.Streamer, error) {
+	return r.DownloadSkylinkFromOffset(link, 0, timeout, pricePerMS)
+}
+
+// DownloadSkylinkFromOffset will take a link and turn it into the metadata and
+// data of a download. The returned streamer starts at the given offset, only
+// the data from that offset onwards is fetched.
+func (r *Renter) DownloadSkylinkFromOffset(link modules.Skylink, offset uint64, timeout time.Duration, pricePerMS types.Currency) (modules.SkyfileLayout, modules.SkyfileMetadata, modules.Streamer, error) {
+	return r.callDownloadSkylink(link, offset, 0, timeout, pricePerMS, skylinkPreflightNone)
+}
+
+// DownloadSkylinkWithReadAhead will take a link and turn it into the metadata
+// and data of a download. The returned streamer fetches up to readAhead bytes
+// ahead of the current read position. A readAhead of 0 uses the default
+// lookahead of the stream buffer.
+func (r *Renter) DownloadSkylinkWithReadAhead(link modules.Skylink, readAhead uint64, timeout time.Duration, pricePerMS types.Currency) (modules.SkyfileLayout, modules.SkyfileMetadata, modules.Streamer, error) {
+	return r.callDownloadSkylink(link, 0, readAhead, timeout, pricePerMS, skylinkPreflightNone)
+}
+
+// DownloadSkylinkWithBaseSector will take a link and turn it into the metadata
+// and data of a download like DownloadSkylink. Additionally it returns the raw
+// base sector of the skyfile that was fetched to create the streamer, which
+// avoids a second round trip through DownloadSkylinkBaseSector. The raw base
+// sector is the base sector as it was downloaded from the network, which means
+// that the base sector of an encrypted skyfile is returned encrypted.
+func (r *Renter) DownloadSkylinkWithBaseSector(link modules.Skylink, timeout time.Duration, pricePerMS types.Currency) (modules.SkyfileLayout, modules.SkyfileMetadata, modules.Streamer, []byte, error) {
+	if err := r.tg.Add(); err != nil {
+		return modules.SkyfileLayout{}, modules.SkyfileMetadata{}, nil, nil, err
+	}
+	defer r.tg.Done()
+
+	// Check if link is blocked
+	if r.staticSkynetBlocklist.IsBlocked(link) {
+		return modules.SkyfileLayout{}, modules.SkyfileMetadata{}, nil, nil, ErrSkylinkBlocked
+	}
+
+	// Fetch the base sector. The cached data sources don't hold on to the raw
+	// base sector, so it is always fetched.
+	baseSector, err := r.managedFetchSkylinkBaseSector(link, timeout, pricePerMS)
+	if errors.Contains(err, ErrProjectTimedOut) {
+		err = errors.AddContext(err, fmt.Sprintf("timed out after %vs", timeout.Seconds()))
+	}
+	if err != nil {
+		return modules.SkyfileLayout{}, modules.SkyfileMetadata{}, nil, nil, err
+	}
+	rawBaseSector := append([]byte{}, baseSector...)
+
+	// Use the data source in the stream buffer set if it exists, otherwise
+	// create it from the fetched base sector.
+	streamer, exists := r.staticStreamBufferSet.callNewStreamFromID(link.DataSourceID(), 0, timeout, 0)
+	if !exists {
+		dataSource, err := r.newSkylinkDataSource(link, baseSector, false)
+		if err != nil {
+			return modules.SkyfileLayout{}, modules.SkyfileMetadata{}, nil, nil, errors.AddContext(err, "unable to create data source for skylink")
+		}
+		streamer = r.staticStreamBufferSet.callNewStream(dataSource, 0, timeout, pricePerMS, 0)
+	} else if err := r.managedValidateStreamMetadata(streamer); err != nil {
+		streamer.Close()
+		return modules.SkyfileLayout{}, modules.SkyfileMetadata{}, nil, nil, err
+	}
+	return streamer.Layout(), r.managedApplyDefaultContentType(streamer.Metadata()), r.managedApplySkylinkDownloadRateLimit(streamer), rawBaseSector, nil
+}
+
+// DownloadSkylinkWithPreflight will take a link and turn it into the metadata
+// and data of a download like DownloadSkylinkWithReadAhead. Before the stream
+// is returned, it verifies that enough pieces of the first fanout chunk are
+// reachable to recover it. If sampleChunk is set, a random other chunk of the
+// fanout is verified as well. If not enough pieces are reachable, an error
+// containing ErrInsufficientRedundancy is returned instead of a stream that
+// would fail partway through.
+func (r *Renter) DownloadSkylinkWithPreflight(link modules.Skylink, readAhead uint64, timeout time.Duration, pricePerMS types.Currency, sampleChunk bool) (modules.SkyfileLayout, modules.SkyfileMetadata, modules.Streamer, error) {
+	preflight := skylinkPreflightFirstChunk
+	if sampleChunk {
+		preflight = skylinkPreflightSampled
+	}
+	return r.callDownloadSkylink(link, 0, readAhead, timeout, pricePerMS, preflight)
+}
+
+// callDownloadSkylink will take a link and turn it into the metadata and data
+// of a download after making sure the link isn't blocked.
+func (r *Renter) callDownloadSkylink(link modules.Skylink, offset, readAhead uint64, timeout time.Duration, pricePerMS types.Currency, preflight skylinkPreflight) (modules.SkyfileLayout, modules.SkyfileMetadata, modules.Streamer, error) {
+	if err := r.tg.Add(); err != nil {
+		return modules.SkyfileLayout{}, modules.SkyfileMetadata{}, nil, err
+	}
+	defer r.tg.Done()
+
+	// Check if link is blocked
+	if r.staticSkynetBlocklist.IsBlocked(link) {
+		return modules.SkyfileLayout{}, modules.SkyfileMetadata{}, nil, ErrSkylinkBlocked
+	}
+
+	// Download the data
+	layout, metadata, streamer, err := r.managedDownloadSkylink(link, offset, readAhead, timeout, pricePerMS, false, preflight)
+	if errors.Contains(err, ErrProjectTimedOut) {
+		err = errors.AddContext(err, fmt.Sprintf("timed out after %vs", timeout.Seconds()))
+	}
+	if err != nil {
+		return modules.SkyfileLayout{}, modules.SkyfileMetadata{}, nil, err
+	}
+	return layout, metadata, r.managedApplySkylinkDownloadRateLimit(streamer), nil
+}
+
+// DownloadSkylinkSkipUnrecoverable will take a link and turn it into the
+// metadata and data of a download. Ranges of the file that belong to fanout
+// chunks that can't be recovered are zero-filled rather than failing the
+// stream. The returned function reports the zero-filled ranges so that the
+// caller can serve partial content and tell which parts of it are missing.
+func (r *Renter) DownloadSkylinkSkipUnrecoverable(link modules.Skylink, offset uint64, timeout time.Duration, pricePerMS types.Currency) (modules.SkyfileLayout, modules.SkyfileMetadata, modules.Streamer, func() []modules.SkyfileByteRange, error) {
+	if err := r.tg.Add(); err != nil {
+		return modules.SkyfileLayout{}, modules.SkyfileMetadata{}, nil, nil, err
+	}
+	defer r.tg.Done()
+
+	// Check if link is blocked
+	if r.staticSkynetBlocklist.IsBlocked(link) {
+		return modules.SkyfileLayout{}, modules.SkyfileMetadata{}, nil, nil, ErrSkylinkBlocked
+	}
+
+	// Download the data
+	layout, metadata, streamer, err := r.managedDownloadSkylink(link, offset, 0, timeout, pricePerMS, true, skylinkPreflightNone)
+	if errors.Contains(err, ErrProjectTimedOut) {
+		err = errors.AddContext(err, fmt.Sprintf("timed out after %vs", timeout.Seconds()))
+	}
+	if err != nil {
+		return modules.SkyfileLayout{}, modules.SkyfileMetadata{}, nil, nil, err
+	}
+
+	// Only skylink data sources can have unrecoverable ranges.
+	unrecoverableRanges := func() []modules.SkyfileByteRange { return nil }
+	if s, ok := streamer.(*stream); ok {
+		if sds, ok := s.staticStreamBuffer.staticDataSource.(*skylinkDataSource); ok {
+			unrecoverableRanges = sds.UnrecoverableRanges
+		}
+	}
+	return layout, metadata, r.managedApplySkylinkDownloadRateLimit(streamer), unrecoverableRanges, nil
+}
+
+// DownloadSkylinkTo streams the file behind the given skylink into w. The data
+// is read from the stream buffer only when the writer is ready to accept more,
+// so the amount of data fetched ahead of the writer is bounded by the stream's
+// lookahead rather than by the size of the file.
+func (r *Renter) DownloadSkylinkTo(link modules.Skylink, w io.Writer, timeout time.Duration, pricePerMS types.Currency) (_ modules.SkyfileMetadata, _ uint64, err error) {
+	if err := r.tg.Add(); err != nil {
+		return modules.SkyfileMetadata{}, 0, err
+	}
+	defer r.tg.Done()
+
+	// Check if link is blocked
+	if r.staticSkynetBlocklist.IsBlocked(link) {
+		return modules.SkyfileMetadata{}, 0, ErrSkylinkBlocked
+	}
+
+	// Open the stream.
+	_, metadata, streamer, err := r.managedDownloadSkylink(link, 0, 0, timeout, pricePerMS, false, skylinkPreflightNone)
+	if errors.Contains(err, ErrProjectTimedOut) {
+		err = errors.AddContext(err, fmt.Sprintf("timed out after %vs", timeout.Seconds()))
+	}
+	if err != nil {
+		return modules.SkyfileMetadata{}, 0, err
+	}
+	streamer = r.managedApplySkylinkDownloadRateLimit(streamer)
+	defer func() {
+		err = errors.Compose(err, streamer.Close())
+	}()
+
+	// Copy the data into the writer. The stream only fetches data ahead of
+	// the current read offset so every blocking write pauses the download.
+	n, err := io.Copy(w, streamer)
+	if errors.Contains(err, ErrProjectTimedOut) {
+		err = errors.AddContext(err, fmt.Sprintf("timed out after %vs", timeout.Seconds()))
+	}
+	if err != nil {
+		return metadata, uint64(n), errors.AddContext(err, "failed to write skyfile to writer")
+	}
+	return metadata, uint64(n), nil
+}
+
+// DownloadSkylinkBaseSector will take a link and turn it into the data of
+// a basesector without any decoding of the metadata, fanout, or decryption.
+// Since only the base sector is fetched, the overall timeout applies unless a
+// baseSectorTimeout is provided, which is then capped by the overall timeout.
+func (r *Renter) DownloadSkylinkBaseSector(link modules.Skylink, timeout, baseSectorTimeout time.Duration, pricePerMS types.Currency) (modules.Streamer, error) {
+	if err := r.tg.Add(); err != nil {
+		return nil, err
+	}
+	defer r.tg.Done()
+
+	// Check if link is blocked
+	if r.staticSkynetBlocklist.IsBlocked(link) {
+		return nil, ErrSkylinkBlocked
+	}
+
+	// Create the context
+	ctx := r.tg.StopCtx()
+	if baseSectorTimeout > 0 {
+		timeout = skylinkBaseSectorTimeout(timeout, baseSectorTimeout)
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(r.tg.StopCtx(), timeout)
+		defer cancel()
+	}
+
+	// Find the fetch size.
+	offset, fetchSize, err := link.OffsetAndFetchSize()
+	if err != nil {
+		return nil, errors.AddContext(err, "unable to get offset and fetch size")
+	}
+
+	// Download the base sector
+	baseSector, err := r.managedDownloadByRoot(ctx, link.MerkleRoot(), offset, fetchSize, pricePerMS)
+	if errors.Contains(err, ErrProjectTimedOut) {
+		err = errors.AddContext(err, fmt.Sprintf("base sector timed out after %vs", timeout.Seconds()))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Make sure the fetch size of the skylink matches the layout. The sizes
+	// in the layout of an encrypted base sector are only visible after
+	// decrypting it, which is up to the caller.
+	if !modules.IsEncryptedBaseSector(baseSector) {
+		var layout modules.SkyfileLayout
+		layout.Decode(baseSector)
+		err = modules.ValidateSkylinkFetchSize(link, layout)
+		if err != nil {
+			return nil, errors.AddContext(err, "invalid skylink")
+		}
+	}
+	return StreamerFromSlice(baseSector), nil
+}
+
+// IsSkylinkEncrypted fetches only the layout at the start of the base sector of
+// the given skylink to determine whether the skyfile is encrypted. If it is, the
+// second return value indicates whether the renter holds a skykey that is able
+// to decrypt it. The timeout is applied to fetching the layout.
+func (r *Renter) IsSkylinkEncrypted(link modules.Skylink, timeout time.Duration, pricePerMS types.Currency) (encrypted bool, hasKey bool, err error) {
+	if err := r.tg.Add(); err != nil {
+		return false, false, err
+	}
+	defer r.tg.Done()
+
+	sl, err := r.managedDownloadSkylinkLayout(link, timeout, pricePerMS)
+	if err != nil {
+		return false, false, err
+	}
+	if !modules.IsEncryptedLayout(sl) {
+		return false, false, nil
+	}
+
+	// Check whether we have the skykey to decrypt the skyfile.
+	_, _, err = r.skykeyForLayout(sl)
+	return true, err == nil, nil
+}
+
+// SkykeyForSkylink returns the skykey that is able to decrypt the skyfile
+// behind the given skylink. Only the layout at the start of the base sector is
+// fetched, the skykey is found using the visible-by-default fields of the
+// layout without trial-decrypting the base sector. ErrSkylinkNotEncrypted is
+// returned if the skyfile is not encrypted and ErrNoMatchingSkykey if the
+// renter doesn't hold a matching skykey.
+func (r *Renter) SkykeyForSkylink(link modules.Skylink, timeout time.Duration, pricePerMS types.Currency) (skykey.Skykey, error) {
+	if err := r.tg.Add(); err != nil {
+		return skykey.Skykey{}, err
+	}
+	defer r.tg.Done()
+
+	sl, err := r.managedDownloadSkylinkLayout(link, timeout, pricePerMS)
+	if err != nil {
+		return skykey.Skykey{}, err
+	}
+	if !modules.IsEncryptedLayout(sl) {
+		return skykey.Skykey{}, ErrSkylinkNotEncrypted
+	}
+	sk, _, err := r.skykeyForLayout(sl)
+	if errors.Contains(err, errNoSkykeyMatchesSkyfileEncryptionID) {
+		return skykey.Skykey{}, ErrNoMatchingSkykey
+	}
+	if err != nil {
+		return skykey.Skykey{}, err
+	}
+	return sk, nil
+}
+
+// SkylinkFanout fetches the base sector of the given skylink, decrypting it if
+// necessary, and returns the decoded fanout together with the erasure coding
+// parameters of the skyfile. The timeout is applied to fetching the base
+// sector.
+func (r *Renter) SkylinkFanout(link modules.Skylink, timeout time.Duration, pricePerMS types.Currency) (modules.SkyfileFanout, error) {
+	if err := r.tg.Add(); err != nil {
+		return modules.SkyfileFanout{}, err
+	}
+	defer r.tg.Done()
+
+	// Check if link is blocked
+	if r.staticSkynetBlocklist.IsBlocked(link) {
+		return modules.SkyfileFanout{}, ErrSkylinkBlocked
+	}
+
+	// Create the context
+	ctx := r.tg.StopCtx()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(r.tg.StopCtx(), timeout)
+		defer cancel()
+	}
+	return r.managedSkylinkFanout(ctx, link, pricePerMS)
+}
+
+// managedSkylinkFanout fetches the base sector of the given skylink using the
+// provided context and returns its decoded fanout.
+func (r *Renter) managedSkylinkFanout(ctx context.Context, link modules.Skylink, pricePerMS types.Currency) (modules.SkyfileFanout, error) {
+	// Download the base sector.
+	offset, fetchSize, err := link.OffsetAndFetchSize()
+	if err != nil {
+		return modules.SkyfileFanout{}, errors.AddContext(err, "unable to parse skylink")
+	}
+	baseSector, err := r.managedDownloadByRoot(ctx, link.MerkleRoot(), offset, fetchSize, pricePerMS)
+	if err != nil {
+		return modules.SkyfileFanout{}, errors.AddContext(err, "unable to download base sector")
+	}
+	err = modules.ValidateSkyfileVersion(baseSector)
+	if err != nil {
+		return modules.SkyfileFanout{}, errors.AddContext(err, "unable to parse base sector")
+	}
+
+	// The fanout is encrypted together with the rest of the base sector.
+	if modules.IsEncryptedBaseSector(baseSector) {
+		_, err = r.decryptBaseSector(baseSector)
+		if err != nil {
+			return modules.SkyfileFanout{}, errors.AddContext(err, "unable to decrypt skyfile base sector")
+		}
+	}
+
+	// Decode the fanout.
+	layout, fanoutBytes, _, _, err := modules.ParseSkyfileMetadata(baseSector)
+	if err != nil {
+		return modules.SkyfileFanout{}, errors.AddContext(err, "error parsing skyfile metadata")
+	}
+	err = modules.ValidateSkylinkFetchSize(link, layout)
+	if err != nil {
+		return modules.SkyfileFanout{}, errors.AddContext(err, "invalid skylink")
+	}
+	fanout, err := modules.DecodeSkyfileFanout(fanoutBytes, layout)
+	if err != nil {
+		return modules.SkyfileFanout{}, errors.AddContext(err, "error parsing skyfile fanout")
+	}
+	return fanout, nil
+}
+
+// managedDownloadSkylinkLayout fetches only the layout at the start of the base
+// sector of the given skylink. The timeout is applied to fetching the layout.
+func (r *Renter) managedDownloadSkylinkLayout(link modules.Skylink, timeout time.Duration, pricePerMS types.Currency) (modules.SkyfileLayout, error) {
+	// Check if link is blocked
+	if r.staticSkynetBlocklist.IsBlocked(link) {
+		return modules.SkyfileLayout{}, ErrSkylinkBlocked
+	}
+
+	// Create the context
+	ctx := r.tg.StopCtx()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(r.tg.StopCtx(), timeout)
+		defer cancel()
+	}
+
+	// Only download the layout, it contains all the information we need.
+	offset, _, err := link.OffsetAndFetchSize()
+	if err != nil {
+		return modules.SkyfileLayout{}, errors.AddContext(err, "unable to get offset and fetch size")
+	}
+	layoutBytes, err := r.managedDownloadByRoot(ctx, link.MerkleRoot(), offset, modules.SkyfileLayoutSize, pricePerMS)
+	if errors.Contains(err, ErrProjectTimedOut) {
+		err = errors.AddContext(err, fmt.Sprintf("timed out after %vs", timeout.Seconds()))
+	}
+	if err != nil {
+		return modules.SkyfileLayout{}, errors.AddContext(err, "unable to fetch skyfile layout")
+	}
+	err = modules.ValidateSkyfileVersion(layoutBytes)
+	if err != nil {
+		return modules.SkyfileLayout{}, err
+	}
+	var sl modules.SkyfileLayout
+	sl.Decode(layoutBytes)
+	return sl, nil
 }
 
 // managedDownloadSkylink will take a link and turn it into the metadata and
-// data of a download.
-func (r *Renter) managedDownloadSkylink(link modules.Skylink, timeout time.Duration, pricePerMS types.Currency) (modules.SkyfileLayout, modules.SkyfileMetadata, modules.Streamer, error) {
+// data of a download. The returned streamer starts at the given offset and
+// fetches up to readAhead bytes ahead of its read position. If
+// zeroFillUnrecoverable is set, unrecoverable ranges of the fanout are
+// zero-filled instead of failing the stream. The preflight determines which
+// fanout chunks are verified to be recoverable before the data is streamed.
+// This includes data sources which are already in the stream buffer set since
+// the hosts might have lost the data after it was cached.
+func (r *Renter) managedDownloadSkylink(link modules.Skylink, offset, readAhead uint64, timeout time.Duration, pricePerMS types.Currency, zeroFillUnrecoverable bool, preflight skylinkPreflight) (modules.SkyfileLayout, modules.SkyfileMetadata, modules.Streamer, error) {
 	if r.deps.Disrupt("resolveSkylinkToFixture") {
 		sf, err := fixtures.LoadSkylinkFixture(link)
 		if err != nil {
 			return modules.SkyfileLayout{}, modules.SkyfileMetadata{}, nil, errors.AddContext(err, "failed to fetch fixture")
 		}
-		return modules.SkyfileLayout{}, sf.Metadata, StreamerFromSlice(sf.Content), nil
+		if offset > uint64(len(sf.Content)) {
+			return modules.SkyfileLayout{}, modules.SkyfileMetadata{}, nil, errOffsetExceedsFilesize
+		}
+		streamer := StreamerFromSlice(sf.Content)
+		_, err = streamer.Seek(int64(offset), io.SeekStart)
+		if err != nil {
+			return modules.SkyfileLayout{}, modules.SkyfileMetadata{}, nil, errors.AddContext(err, "failed to seek to offset")
+		}
+		return modules.SkyfileLayout{}, sf.Metadata, streamer, nil
 	}
 
 	// Check if this skylink is already in the stream buffer set. If so, we can
 	// skip the lookup procedure and use any data that other threads have
 	// cached.
 	id := link.DataSourceID()
-	streamer, exists := r.staticStreamBufferSet.callNewStreamFromID(id, 0, timeout)
+	if zeroFillUnrecoverable {
+		id = zeroFillDataSourceID(link)
+	}
+	streamer, exists := r.staticStreamBufferSet.callNewStreamFromID(id, offset, timeout, readAhead)
 	if exists {
-		return streamer.Layout(), streamer.Metadata(), streamer, nil
+		// Sanity check that the cached stream belongs to the requested
+		// skylink. Serving the data of another skylink would be a severe bug.
+		if streamID := streamer.staticStreamBuffer.staticDataSource.ID(); streamID != id {
+			err := fmt.Errorf("stream buffer set returned stream for data source %v when data source %v of skylink %v was requested", streamID, id, link)
+			r.log.Critical(err)
+			streamer.Close()
+			return modules.SkyfileLayout{}, modules.SkyfileMetadata{}, nil, err
+		}
+		if offset > streamer.staticStreamBuffer.staticDataSize {
+			streamer.Close()
+			return modules.SkyfileLayout{}, modules.SkyfileMetadata{}, nil, errOffsetExceedsFilesize
+		}
+		if err := r.managedValidateStreamMetadata(streamer); err != nil {
+			streamer.Close()
+			return modules.SkyfileLayout{}, modules.SkyfileMetadata{}, nil, err
+		}
+		if sds, ok := streamer.staticStreamBuffer.staticDataSource.(*skylinkDataSource); ok && preflight != skylinkPreflightNone {
+			err := r.managedPreflightSkylinkDataSource(sds, timeout, preflight)
+			if err != nil {
+				streamer.Close()
+				return modules.SkyfileLayout{}, modules.SkyfileMetadata{}, nil, errors.AddContext(err, "skylink failed preflight check")
+			}
+		}
+		return streamer.Layout(), r.managedApplyDefaultContentType(streamer.Metadata()), streamer, nil
 	}
 
 	// Create the data source and add it to the stream buffer set.
-	dataSource, err := r.skylinkDataSource(link, timeout, pricePerMS)
+	dataSource, err := r.skylinkDataSource(link, timeout, pricePerMS, zeroFillUnrecoverable)
 	if err != nil {
 		return modules.SkyfileLayout{}, modules.SkyfileMetadata{}, nil, errors.AddContext(err, "unable to create data source for skylink")
 	}
-	stream := r.staticStreamBufferSet.callNewStream(dataSource, 0, timeout, pricePerMS)
-	return dataSource.Layout(), dataSource.Metadata(), stream, nil
+	if offset > dataSource.DataSize() {
+		dataSource.SilentClose()
+		return modules.SkyfileLayout{}, modules.SkyfileMetadata{}, nil, errOffsetExceedsFilesize
+	}
+	if preflight != skylinkPreflightNone {
+		err = r.managedPreflightSkylinkDataSource(dataSource, timeout, preflight)
+		if err != nil {
+			dataSource.SilentClose()
+			return modules.SkyfileLayout{}, modules.SkyfileMetadata{}, nil, errors.AddContext(err, "skylink failed preflight check")
+		}
+	}
+	stream := r.staticStreamBufferSet.callNewStream(dataSource, offset, timeout, pricePerMS, readAhead)
+	return dataSource.Layout(), r.managedApplyDefaultContentType(dataSource.Metadata()), stream, nil
+}
+
+// managedPreflightSkylinkDataSource verifies that the fanout chunks selected by
+// the preflight are recoverable. The check is bounded by the timeout of the
+// download and by the time it takes the workers to look up the pieces.
+func (r *Renter) managedPreflightSkylinkDataSource(sds *skylinkDataSource, timeout time.Duration, preflight skylinkPreflight) error {
+	preflightTimeout := pcwsHasSectorTimeout
+	if timeout > 0 && timeout < preflightTimeout {
+		preflightTimeout = timeout
+	}
+	ctx, cancel := context.WithTimeout(r.tg.StopCtx(), preflightTimeout)
+	defer cancel()
+	return sds.managedCheckRedundancy(ctx, preflight == skylinkPreflightSampled)
+}
+
+// managedApplyDefaultContentType applies the renter's default skyfile content
+// type to the subfiles of the metadata which don't declare one.
+func (r *Renter) managedApplyDefaultContentType(sm modules.SkyfileMetadata) modules.SkyfileMetadata {
+	return sm.WithDefaultContentType(r.managedDefaultSkyfileContentType())
+}
+
+// DefaultSkyfileContentType returns the content type to report for downloaded
+// skyfiles that don't declare one.
+func (r *Renter) DefaultSkyfileContentType() string {
+	return r.managedDefaultSkyfileContentType()
+}
+
+// managedDefaultSkyfileContentType returns the renter's default skyfile
+// content type.
+func (r *Renter) managedDefaultSkyfileContentType() string {
+	id := r.mu.RLock()
+	defer r.mu.RUnlock(id)
+	return r.persist.DefaultSkyfileContentType
+}
+
+// managedSkyfileMetadataAllowedFields returns the top level fields the metadata
+// of skyfiles may contain. If it is nil, any field is allowed.
+func (r *Renter) managedSkyfileMetadataAllowedFields() []string {
+	id := r.mu.RLock()
+	defer r.mu.RUnlock(id)
+	if len(r.persist.SkyfileMetadataAllowedFields) == 0 {
+		return nil
+	}
+	return append([]string(nil), r.persist.SkyfileMetadataAllowedFields...)
+}
+
+// managedValidateSkyfileMetadataBytes validates the marshaled metadata of a
+// skyfile against the renter's allowed metadata fields. Without allowed fields
+// any metadata is accepted.
+func (r *Renter) managedValidateSkyfileMetadataBytes(metadataBytes []byte) error {
+	allowedFields := r.managedSkyfileMetadataAllowedFields()
+	if allowedFields == nil {
+		return nil
+	}
+	_, err := modules.ValidateSkyfileMetadataBytes(metadataBytes, allowedFields, r.managedSkyfileMaxSubfiles())
+	if err != nil {
+		return errors.Compose(ErrInvalidMetadata, err)
+	}
+	return nil
+}
+
+// managedValidateStreamMetadata validates the metadata of a stream that reuses
+// a cached skylink data source. The allowed metadata fields might have changed
+// since the data source was created.
+func (r *Renter) managedValidateStreamMetadata(streamer *stream) error {
+	sds, ok := streamer.staticStreamBuffer.staticDataSource.(*skylinkDataSource)
+	if !ok {
+		return nil
+	}
+	return r.managedValidateSkyfileMetadataBytes(sds.staticMetadataBytes)
+}
+
+// skyfileMetadataBytes returns the marshaled metadata of the base sector with
+// the given layout. The base sector needs to be parsed successfully before.
+func skyfileMetadataBytes(baseSector []byte, sl modules.SkyfileLayout) []byte {
+	offset := modules.SkyfileLayoutSize + sl.FanoutSize
+	return baseSector[offset : offset+sl.MetadataSize]
+}
+
+// managedSkyfileMaxSubfiles returns the maximum number of subfiles of skyfiles
+// uploaded by the renter.
+func (r *Renter) managedSkyfileMaxSubfiles() int {
+	id := r.mu.RLock()
+	defer r.mu.RUnlock(id)
+	if r.persist.SkyfileMaxSubfiles <= 0 {
+		return modules.DefaultSkyfileMaxSubfiles
+	}
+	return r.persist.SkyfileMaxSubfiles
+}
+
+// SkyfileMaxSubfiles returns the maximum number of subfiles of skyfiles
+// uploaded by the renter.
+func (r *Renter) SkyfileMaxSubfiles() int {
+	return r.managedSkyfileMaxSubfiles()
 }
 
 // PinSkylink will fetch the file associated with the Skylink, and then pin all
-// necessary content to maintain that Skylink.
-func (r *Renter) PinSkylink(skylink modules.Skylink, lup modules.SkyfileUploadParameters, timeout time.Duration, pricePerMS types.Currency) error {
+// necessary content to maintain that Skylink. Fetching the base sector is
+// limited by the baseSectorTimeout so that a slow lookup of the base sector
+// fails fast instead of using up the time needed to fetch the fanout. Canceling
+// the context aborts the pin and deletes the partially uploaded fanout. If only
+// the base sector of an encrypted skyfile could be pinned,
+// ErrSkylinkPartiallyPinned is returned.
+func (r *Renter) PinSkylink(ctx context.Context, skylink modules.Skylink, lup modules.SkyfileUploadParameters, timeout, baseSectorTimeout time.Duration, pricePerMS types.Currency) error {
 	// Check if link is blocked
 	if r.staticSkynetBlocklist.IsBlocked(skylink) {
 		return ErrSkylinkBlocked
 	}
 
 	// Fetch the leading chunk.
-	baseSector, err := r.DownloadByRoot(skylink.MerkleRoot(), 0, modules.SectorSize, timeout, pricePerMS)
+	baseSectorTimeout = skylinkBaseSectorTimeout(timeout, baseSectorTimeout)
+	baseSector, err := r.DownloadByRoot(skylink.MerkleRoot(), 0, modules.SectorSize, baseSectorTimeout, pricePerMS)
 	if err != nil {
 		return errors.AddContext(err, "unable to fetch base sector of skylink")
 	}
@@ -680,21 +1722,57 @@ func (r *Renter) PinSkylink(skylink modules.Skylink, lup modules.SkyfileUploadPa
 		return errors.New("download did not fetch enough data, file cannot be re-pinned")
 	}
 
-	// Check if the base sector is encrypted, and attempt to decrypt it.
+	// Make sure the layout version is supported before doing any more work.
+	err = modules.ValidateSkyfileVersion(baseSector)
+	if err != nil {
+		return errors.AddContext(err, "unable to pin skylink")
+	}
+
+	// Check if the base sector is encrypted, and attempt to decrypt it. If we
+	// don't have the skykey, we might still be able to pin the encrypted base
+	// sector as-is. Since the layout is encrypted as well, we can't tell
+	// whether the skyfile has a fanout which is why the caller is told that
+	// the pin might be incomplete.
 	var fileSpecificSkykey skykey.Skykey
 	encrypted := modules.IsEncryptedBaseSector(baseSector)
 	if encrypted {
 		fileSpecificSkykey, err = r.decryptBaseSector(baseSector)
+		if errors.Contains(err, errNoSkykeyMatchesSkyfileEncryptionID) && lup.PinEncryptedWithoutKey {
+			err = r.managedPinBaseSector(lup, baseSector, skylink)
+			if err != nil {
+				return errors.AddContext(err, "unable to pin encrypted base sector")
+			}
+			return ErrSkylinkPartiallyPinned
+		}
 		if err != nil {
 			return errors.AddContext(err, "Unable to decrypt skyfile base sector")
 		}
 	}
 
 	// Parse out the metadata of the skyfile.
-	layout, _, _, _, err := modules.ParseSkyfileMetadata(baseSector)
+	layout, fanoutBytes, metadata, _, err := modules.ParseSkyfileMetadata(baseSector)
 	if err != nil {
 		return errors.AddContext(err, "error parsing skyfile metadata")
 	}
+	err = modules.ValidateSkyfileLayout(layout, fanoutBytes, metadata)
+	if err != nil {
+		return errors.AddContext(err, "invalid skyfile layout")
+	}
+	err = modules.ValidateSkylinkFetchSize(skylink, layout)
+	if err != nil {
+		return errors.AddContext(err, "invalid skylink")
+	}
+
+	// Don't upload the skyfile again if it is already pinned.
+	if !lup.Force {
+		pinnedPath, pinned, err := r.managedSkylinkPinned(skylink, lup.SiaPath, layout.FanoutSize > 0)
+		if err != nil {
+			return errors.AddContext(err, "unable to check whether skylink is pinned")
+		}
+		if pinned {
+			return skylinkPinnedError(lup.SiaPath, pinnedPath)
+		}
+	}
 
 	// Set sane defaults for unspecified values.
 	skyfileEstablishDefaults(&lup)
@@ -705,6 +1783,8 @@ func (r *Renter) PinSkylink(skylink modules.Skylink, lup modules.SkyfileUploadPa
 		DisablePartialChunk: true,  // must be set to true - partial chunks change, content addressed files must not change.
 		Repair:              false, // indicates whether this is a repair operation
 		CipherType:          crypto.TypePlain,
+		MaxConcurrentChunks: lup.PinMaxConcurrentChunks,
+		LowPriority:         lup.PinLowPriority,
 	}
 
 	// Re-encrypt the baseSector for upload and add the fanout key to the fup.
@@ -731,40 +1811,53 @@ func (r *Renter) PinSkylink(skylink modules.Skylink, lup modules.SkyfileUploadPa
 		lup.FileSpecificSkykey = fileSpecificSkykey
 	}
 
-	// Re-upload the baseSector.
-	err = r.managedUploadBaseSector(lup, baseSector, skylink)
-	if err != nil {
-		return errors.AddContext(err, "unable to upload base sector")
-	}
-
-	// If there is no fanout, nothing more to do, the pin is complete.
+	// If there is no fanout, re-uploading the baseSector is all that is left
+	// to do to complete the pin.
 	if layout.FanoutSize == 0 {
+		err = r.managedUploadBaseSector(lup, baseSector, skylink)
+		if err != nil {
+			return errors.AddContext(err, "unable to upload base sector")
+		}
 		return nil
 	}
 	// Create the erasure coder to use when uploading the file bulk.
+	err = validateErasureParams(int(layout.FanoutDataPieces), int(layout.FanoutParityPieces))
+	if err != nil {
+		return errors.AddContext(err, "skyfile layout contains invalid erasure coding parameters")
+	}
 	fup.ErasureCode, err = modules.NewRSSubCode(int(layout.FanoutDataPieces), int(layout.FanoutParityPieces), crypto.SegmentSize)
 	if err != nil {
 		return errors.AddContext(err, "unable to create erasure coder for large file")
 	}
 	// Create the siapath for the skyfile extra data. This is going to be the
 	// same as the skyfile upload siapath, except with a suffix.
-	fup.SiaPath, err = modules.NewSiaPath(lup.SiaPath.String() + modules.ExtendedSuffix)
+	fup.SiaPath, err = modules.ExtendedSiaPath(lup.SiaPath)
 	if err != nil {
 		return errors.AddContext(err, "unable to create SiaPath for large skyfile extended data")
 	}
 
 	// Create the data source and add it to the stream buffer set.
-	dataSource, err := r.skylinkDataSource(skylink, timeout, pricePerMS)
+	dataSource, err := r.skylinkDataSource(skylink, timeout, pricePerMS, false)
 	if err != nil {
 		return errors.AddContext(err, "unable to create data source for skylink")
 	}
-	stream := r.staticStreamBufferSet.callNewStream(dataSource, 0, timeout, pricePerMS)
+	stream := r.staticStreamBufferSet.callNewStream(dataSource, 0, timeout, pricePerMS, 0)
+
+	// Don't start the upload if the pin was canceled in the meantime.
+	if err := ctx.Err(); err != nil {
+		return errors.AddContext(err, "pin canceled")
+	}
 
-	// Upload directly from the stream.
-	fileNode, err := r.callUploadStreamFromReader(fup, stream)
+	// Re-upload the baseSector and upload the fanout directly from the stream.
+	fileNode, err := r.managedUploadBaseSectorAndFanout(ctx, lup, baseSector, skylink, fup, stream)
 	if err != nil {
-		return errors.AddContext(err, "unable to upload large skyfile")
+		return errors.AddContext(err, "unable to pin skyfile")
 	}
+	defer func() {
+		if err := fileNode.Close(); err != nil {
+			r.log.Printf("Could not close node, err: %s\n", err.Error())
+		}
+	}()
 	err = fileNode.AddSkylink(skylink)
 	if err != nil {
 		return errors.AddContext(err, "unable to upload skyfile fanout")
@@ -772,6 +1865,73 @@ func (r *Renter) PinSkylink(skylink modules.Skylink, lup modules.SkyfileUploadPa
 	return nil
 }
 
+// PinBaseSector will fetch the base sector of the skyfile associated with the
+// Skylink and pin only the base sector. Unlike PinSkylink the fanout is not
+// re-uploaded, which makes this a lightweight way of keeping the metadata of a
+// skyfile available. For skyfiles that fit within the base sector this pins
+// the entire file.
+func (r *Renter) PinBaseSector(skylink modules.Skylink, lup modules.SkyfileUploadParameters, timeout time.Duration, pricePerMS types.Currency) error {
+	// Check if link is blocked
+	if r.staticSkynetBlocklist.IsBlocked(skylink) {
+		return ErrSkylinkBlocked
+	}
+
+	// Fetch the base sector.
+	baseSector, err := r.DownloadByRoot(skylink.MerkleRoot(), 0, modules.SectorSize, timeout, pricePerMS)
+	if err != nil {
+		return errors.AddContext(err, "unable to fetch base sector of skylink")
+	}
+	if uint64(len(baseSector)) != modules.SectorSize {
+		return errors.New("download did not fetch enough data, base sector cannot be re-pinned")
+	}
+
+	// Make sure the layout version is supported before doing any more work.
+	err = modules.ValidateSkyfileVersion(baseSector)
+	if err != nil {
+		return errors.AddContext(err, "unable to pin base sector")
+	}
+
+	// The base sector is pinned verbatim, which means that encrypted base
+	// sectors don't need to be decrypted. Unencrypted base sectors are parsed
+	// to make sure that the metadata is valid.
+	if !modules.IsEncryptedBaseSector(baseSector) {
+		_, _, _, _, err = modules.ParseSkyfileMetadata(baseSector)
+		if err != nil {
+			return errors.AddContext(err, "error parsing skyfile metadata")
+		}
+	}
+	return r.managedPinBaseSector(lup, baseSector, skylink)
+}
+
+// managedPinBaseSector pins the base sector of a skyfile without its fanout.
+// The base sector is re-uploaded verbatim, which preserves the skylink without
+// the need to decrypt and re-encrypt it.
+//
+// NOTE: this is used for pinning the base sector of encrypted skyfiles for
+// which the renter doesn't hold the skykey. Re-uploading the fanout would only
+// require the ciphered fanout data, which is available without the skykey.
+// However, the merkle roots of the fanout, as well as the layout fields
+// describing it, are stored in the encrypted part of the base sector. Without
+// the skykey there is no way to locate the fanout, so only the base sector is
+// pinned.
+func (r *Renter) managedPinBaseSector(lup modules.SkyfileUploadParameters, baseSector []byte, skylink modules.Skylink) error {
+	if !lup.Force {
+		pinnedPath, pinned, err := r.managedSkylinkPinned(skylink, lup.SiaPath, false)
+		if err != nil {
+			return errors.AddContext(err, "unable to check whether skylink is pinned")
+		}
+		if pinned {
+			return skylinkPinnedError(lup.SiaPath, pinnedPath)
+		}
+	}
+	skyfileEstablishDefaults(&lup)
+	err := r.managedUploadBaseSector(lup, baseSector, skylink)
+	if err != nil {
+		return errors.AddContext(err, "unable to upload base sector")
+	}
+	return nil
+}
+
 // RestoreSkyfile restores a skyfile from disk such that the skylink is
 // preserved.
 func (r *Renter) RestoreSkyfile(reader io.Reader) (modules.Skylink, error) {
@@ -793,6 +1953,12 @@ func (r *Renter) RestoreSkyfile(reader io.Reader) (modules.Skylink, error) {
 		return modules.Skylink{}, ErrSkylinkBlocked
 	}
 
+	// Make sure the layout version is supported before doing any more work.
+	err = modules.ValidateSkyfileVersion(baseSector)
+	if err != nil {
+		return modules.Skylink{}, errors.AddContext(err, "unable to restore skyfile")
+	}
+
 	// Check if the base sector is encrypted, and attempt to decrypt it.
 	// This will fail if we don't have the decryption key.
 	var fileSpecificSkykey skykey.Skykey
@@ -805,15 +1971,61 @@ func (r *Renter) RestoreSkyfile(reader io.Reader) (modules.Skylink, error) {
 	}
 
 	// Parse the baseSector.
-	sl, _, sm, _, err := modules.ParseSkyfileMetadata(baseSector)
+	sl, fanoutBytes, sm, _, err := modules.ParseSkyfileMetadata(baseSector)
 	if err != nil {
 		return modules.Skylink{}, errors.AddContext(err, "error parsing the baseSector")
 	}
+	err = modules.ValidateSkylinkFetchSize(skylink, sl)
+	if err != nil {
+		return modules.Skylink{}, errors.AddContext(err, "invalid skylink")
+	}
+	err = r.managedValidateSkyfileMetadataBytes(skyfileMetadataBytes(baseSector, sl))
+	if err != nil {
+		return modules.Skylink{}, err
+	}
+
+	// Make sure the cipher type of the fanout is supported.
+	err = validateSkyfileCipherType(sl.CipherType)
+	if err != nil {
+		return modules.Skylink{}, errors.AddContext(err, "unable to restore skyfile")
+	}
+
+	// Validate the erasure coding parameters of the fanout before allocating
+	// any buffers or contacting any hosts.
+	if sl.FanoutSize > 0 {
+		err = validateErasureParams(int(sl.FanoutDataPieces), int(sl.FanoutParityPieces))
+		if err != nil {
+			return modules.Skylink{}, errors.AddContext(err, "skyfile layout contains invalid erasure coding parameters")
+		}
+	}
+
+	// Cross-check the filesize against the subfiles and the fanout. The
+	// subfiles need to cover the data back to back, otherwise they would be
+	// sliced from the wrong parts of the restored skyfile. This happens after
+	// the erasure coding parameters were validated to make sure invalid
+	// parameters are reported as such.
+	err = modules.ValidateSkyfileLayout(sl, fanoutBytes, sm)
+	if err != nil {
+		return modules.Skylink{}, errors.AddContext(err, "invalid skyfile layout")
+	}
+
+	// Make sure the default path of the skyfile is valid, otherwise the
+	// restored skyfile might not be able to serve its content.
+	err = modules.ValidateSkyfileDefaultPath(sm)
+	if err != nil {
+		return modules.Skylink{}, errors.AddContext(err, "skyfile metadata contains an invalid default path")
+	}
 
 	// Create the upload parameters
-	siaPath, err := modules.SkynetFolder.Join(skylinkStr)
+	siaPath, extendedPath, err := modules.SkylinkSiaPath(skylink)
 	if err != nil {
-		return modules.Skylink{}, errors.AddContext(err, "unable to create siapath")
+		return modules.Skylink{}, errors.AddContext(err, "unable to create siapaths for skylink")
+	}
+	if sl.FanoutSize > 0 {
+		err = r.managedCheckSkyfileExtendedPath(extendedPath, false)
+		if err != nil {
+			return modules.Skylink{}, errors.AddContext(err, "unable to restore skyfile")
+		}
 	}
 	sup := modules.SkyfileUploadParameters{
 		BaseChunkRedundancy: sl.FanoutDataPieces + sl.FanoutParityPieces,
@@ -826,6 +2038,10 @@ func (r *Renter) RestoreSkyfile(reader io.Reader) (modules.Skylink, error) {
 		// Set the default path params
 		DefaultPath:        sm.DefaultPath,
 		DisableDefaultPath: sm.DisableDefaultPath,
+
+		// Set the http header hints and creation time
+		HTTPHeaders: sm.HTTPHeaders,
+		CreatedAt:   sm.CreatedAt,
 	}
 	skyfileEstablishDefaults(&sup)
 
@@ -841,48 +2057,18 @@ func (r *Renter) RestoreSkyfile(reader io.Reader) (modules.Skylink, error) {
 		sup.FileSpecificSkykey = fileSpecificSkykey
 	}
 
-	// Create the SkyfileUploadReader for the restoration
-	var restoreReader modules.SkyfileUploadReader
-	var buf bytes.Buffer
-	// Define a TeeReader for the underlying io.Reader. This allows the fanout
-	// bytes to be generated before the upload has completed by reading the data
-	// from the buffer rather than the chunks.
-	tee := io.TeeReader(reader, &buf)
-	if len(sm.Subfiles) == 0 {
-		restoreReader = modules.NewSkyfileReader(tee, sup)
-	} else {
-		// Create multipart reader from the subfiles
-		multiReader, err := modules.NewMultipartReader(tee, sm.Subfiles)
-		if err != nil {
-			return modules.Skylink{}, errors.AddContext(err, "unable to create multireader")
-		}
-		// Create the multipart reader for the fanout using the TeeReader's buffer.
-		multiReaderFanout, err := modules.NewMultipartReader(&buf, sm.Subfiles)
+	// If there was no fanout then uploading the base sector is all there is
+	// to do.
+	if sl.FanoutSize == 0 {
+		err = r.managedUploadBaseSector(sup, baseSector, skylink)
 		if err != nil {
-			return modules.Skylink{}, errors.AddContext(err, "unable to create multireader")
+			return modules.Skylink{}, errors.AddContext(err, "failed to upload base sector")
 		}
-		restoreReader = modules.NewSkyfileMultipartReader(multiReader, multiReaderFanout, sup)
-	}
-
-	// Upload the Base Sector of the skyfile
-	err = r.managedUploadBaseSector(sup, baseSector, skylink)
-	if err != nil {
-		return modules.Skylink{}, errors.AddContext(err, "failed to upload base sector")
-	}
-
-	// If there was no fanout then we are done.
-	if sl.FanoutSize == 0 {
 		return skylink, nil
 	}
 
-	// Create erasure coder and FileUploadParams
-	extendedPath, err := modules.NewSiaPath(sup.SiaPath.String() + modules.ExtendedSuffix)
-	if err != nil {
-		return modules.Skylink{}, errors.AddContext(err, "unable to create extended siapath")
-	}
-
 	// Create the FileUploadParams
-	fup, err := fileUploadParams(extendedPath, int(sl.FanoutDataPieces), int(sl.FanoutParityPieces), sup.Force, sl.CipherType)
+	fup, err := r.managedFileUploadParams(extendedPath, int(sl.FanoutDataPieces), int(sl.FanoutParityPieces), sup.Force, sl.CipherType, true)
 	if err != nil {
 		return modules.Skylink{}, errors.AddContext(err, "unable to create FileUploadParams for large file")
 	}
@@ -907,10 +2093,14 @@ func (r *Renter) RestoreSkyfile(reader io.Reader) (modules.Skylink, error) {
 		}
 	}
 
-	// Upload the file
-	fileNode, err := r.callUploadStreamFromReader(fup, restoreReader)
+	// Upload the base sector and the file. The fanout is already part of the
+	// restored base sector, so the data can be streamed from the reader as is
+	// without holding it in memory to derive the fanout. The subfiles of a
+	// skyfile are stored back to back in order of their offsets, which means
+	// the data of a multipart skyfile can be streamed in the same way.
+	fileNode, err := r.managedUploadBaseSectorAndFanout(context.Background(), sup, baseSector, skylink, fup, reader)
 	if err != nil {
-		return modules.Skylink{}, errors.AddContext(err, "unable to upload large skyfile")
+		return modules.Skylink{}, errors.AddContext(err, "unable to restore skyfile")
 	}
 
 	// Defer closing the file
@@ -936,13 +2126,149 @@ func (r *Renter) RestoreSkyfile(reader io.Reader) (modules.Skylink, error) {
 	return skylink, nil
 }
 
+// MigrateThreefishSkyfile migrates a skyfile that was converted from a
+// TypeThreefish siafile to the cipher type of regular skyfile uploads. The
+// skyfile is downloaded, decrypted with the key from its layout, and uploaded
+// again to sup.SiaPath using the given upload parameters, which results in a
+// new skylink. The original skyfile is left untouched, so the old skylink
+// remains resolvable until the operator deletes its siafile.
+//
+// NOTE: TypeDefaultRenter is an alias of TypeThreefish which is why the
+// migrated skyfile uses the cipher type of regular skyfile uploads instead,
+// which is TypePlain unless a skykey is specified in the upload parameters.
+func (r *Renter) MigrateThreefishSkyfile(link modules.Skylink, sup modules.SkyfileUploadParameters, timeout time.Duration, pricePerMS types.Currency) (_ modules.Skylink, err error) {
+	if err := r.tg.Add(); err != nil {
+		return modules.Skylink{}, err
+	}
+	defer r.tg.Done()
+
+	// Check if link is blocked
+	if r.staticSkynetBlocklist.IsBlocked(link) {
+		return modules.Skylink{}, ErrSkylinkBlocked
+	}
+	if sup.SiaPath.IsEmpty() {
+		return modules.Skylink{}, errors.New("unable to migrate skyfile without a siapath for the migrated skyfile")
+	}
+
+	// Fetch the skyfile. The data source derives the fanout key from the
+	// layout's key data, which means the streamer returns the plaintext.
+	layout, metadata, streamer, err := r.managedDownloadSkylink(link, 0, 0, timeout, pricePerMS, false, skylinkPreflightNone)
+	if err != nil {
+		return modules.Skylink{}, errors.AddContext(err, "unable to download skyfile")
+	}
+	defer func() {
+		err = errors.Compose(err, streamer.Close())
+	}()
+
+	// Only converted siafiles use TypeThreefish. They never contain subfiles
+	// since the conversion creates the metadata from the siafile.
+	if layout.CipherType != crypto.TypeThreefish {
+		return modules.Skylink{}, errors.AddContext(ErrSkyfileNotThreefish, fmt.Sprintf("skyfile uses cipher type %v", layout.CipherType))
+	}
+	if len(metadata.Subfiles) > 0 {
+		return modules.Skylink{}, errors.New("unable to migrate skyfile with subfiles")
+	}
+
+	// Upload the skyfile again with the original metadata.
+	sup.Filename = metadata.Filename
+	sup.Mode = metadata.Mode
+	sup.HTTPHeaders = metadata.HTTPHeaders
+	sup.CreatedAt = metadata.CreatedAt
+	skylink, err := r.managedUploadSkyfileWithNotify(sup, modules.NewSkyfileReader(streamer, sup), nil)
+	if err != nil {
+		return modules.Skylink{}, errors.AddContext(err, "unable to upload migrated skyfile")
+	}
+	return skylink, nil
+}
+
 // UploadSkyfile will upload the provided data with the provided metadata,
 // returning a skylink which can be used by any portal to recover the full
 // original file and metadata. The skylink will be unique to the combination of
 // both the file data and metadata.
-func (r *Renter) UploadSkyfile(sup modules.SkyfileUploadParameters, reader modules.SkyfileUploadReader) (skylink modules.Skylink, err error) {
+func (r *Renter) UploadSkyfile(sup modules.SkyfileUploadParameters, reader modules.SkyfileUploadReader) (modules.Skylink, error) {
+	return r.managedUploadSkyfileWithNotify(sup, reader, nil)
+}
+
+// UploadSkyfileAsync uploads the provided data with the provided metadata
+// like UploadSkyfile does but returns the skylink as soon as it is known. For
+// large files this is the case once all of the data has been read, which can
+// be well before the data is available on the network. The returned channel
+// receives the result of the remaining upload and is closed afterwards.
+func (r *Renter) UploadSkyfileAsync(sup modules.SkyfileUploadParameters, reader modules.SkyfileUploadReader) (modules.Skylink, <-chan error, error) {
+	if err := r.tg.Add(); err != nil {
+		return modules.Skylink{}, nil, err
+	}
+
+	// Upload the skyfile in a separate goroutine.
+	skylinkChan := make(chan modules.Skylink, 1)
+	doneChan := make(chan error, 1)
+	var skylink modules.Skylink
+	go func() {
+		defer r.tg.Done()
+		defer close(doneChan)
+		var err error
+		skylink, err = r.managedUploadSkyfileWithNotify(sup, reader, skylinkChan)
+		doneChan <- err
+	}()
+
+	// Wait for either the skylink or the upload to finish. Small files are
+	// uploaded before their skylink is returned.
+	select {
+	case sl := <-skylinkChan:
+		return sl, doneChan, nil
+	case err := <-doneChan:
+		if err != nil {
+			return modules.Skylink{}, nil, err
+		}
+		// The closed channel will return a nil error.
+		return skylink, doneChan, nil
+	}
+}
+
+// UploadSkyfileV2 uploads the provided data like UploadSkyfile does. If
+// sup.SkylinkV2 is set, it also registers a v2 skylink which points at the v1
+// skylink of the upload and returns both. Otherwise only the v1 skylink is
+// returned. For dry runs the v2 skylink is computed but not registered. If
+// sup.ContentHasher is set, the digest of the file data is returned as well.
+func (r *Renter) UploadSkyfileV2(sup modules.SkyfileUploadParameters, reader modules.SkyfileUploadReader) (modules.SkyfileUploadResult, error) {
+	// Validate the v2 parameters before uploading any data.
+	v2 := sup.SkylinkV2
+	if v2 != nil && !v2.PublicKey.Equals(types.Ed25519PublicKey(v2.SecretKey.PublicKey())) {
+		return modules.SkyfileUploadResult{}, ErrSkylinkV2KeyMismatch
+	}
+
+	skylink, err := r.managedUploadSkyfileWithNotify(sup, reader, nil)
+	if err != nil {
+		return modules.SkyfileUploadResult{}, err
+	}
+	result := modules.SkyfileUploadResult{Skylink: skylink}
+	if sup.ContentHasher != nil {
+		result.ContentHash = sup.ContentHasher.Sum(nil)
+	}
+	if v2 == nil {
+		return result, nil
+	}
+
+	// Register the v1 skylink under the v2 skylink's registry entry.
+	if !sup.DryRun {
+		srv := modules.NewRegistryValue(v2.DataKey, skylink.Bytes(), v2.Revision).Sign(v2.SecretKey)
+		err = r.UpdateRegistry(v2.PublicKey, srv, DefaultRegistryUpdateTimeout)
+		if err != nil {
+			return modules.SkyfileUploadResult{}, errors.AddContext(err, "unable to register v2 skylink")
+		}
+	}
+	result.SkylinkV2 = modules.NewSkylinkV2(v2.PublicKey, v2.DataKey)
+	return result, nil
+}
+
+// managedUploadSkyfileWithNotify uploads a skyfile and sends its skylink on
+// the skylinkChan as soon as it is known, if the channel is set.
+func (r *Renter) managedUploadSkyfileWithNotify(sup modules.SkyfileUploadParameters, reader modules.SkyfileUploadReader, skylinkChan chan<- modules.Skylink) (skylink modules.Skylink, err error) {
 	// Set reasonable default values for any sup fields that are blank.
 	skyfileEstablishDefaults(&sup)
+	if sup.TTL < 0 {
+		return modules.Skylink{}, errNegativeSkyfileTTL
+	}
 
 	// If a skykey name or ID was specified, generate a file-specific key for
 	// this upload.
@@ -951,24 +2277,69 @@ func (r *Renter) UploadSkyfile(sup modules.SkyfileUploadParameters, reader modul
 		return modules.Skylink{}, errors.AddContext(err, "unable to upload skyfile")
 	}
 
+	// Make sure the skyfile is encrypted with a supported cipher type before
+	// building any base sector.
+	err = validateSkyfileCipherType(skyfileCipherType(sup))
+	if err != nil {
+		return modules.Skylink{}, errors.AddContext(err, "unable to upload skyfile")
+	}
+
+	// If the upload is a retry of an earlier successful upload, return the
+	// skylink of that upload instead of uploading the data again. Since the
+	// retry's content has to match the earlier upload, the ContentHasher
+	// computes the digest of the returned skylink's data as well. Otherwise
+	// the digest of the content is computed during the upload to compare
+	// future retries against it.
+	var idempotencyReader *skyfileIdempotencyReader
+	if sup.IdempotencyKey != "" && !sup.DryRun {
+		cached, exists, err := r.managedCachedIdempotentUpload(sup, reader)
+		if err != nil {
+			return modules.Skylink{}, errors.AddContext(err, "unable to return the skylink of an earlier upload")
+		}
+		if exists {
+			return cached, nil
+		}
+		idempotencyReader = newSkyfileIdempotencyReader(reader)
+		reader = idempotencyReader
+	}
+
 	// defer a function that cleans up the siafiles after a failed upload
-	// attempt or after a dry run
+	// attempt or after a dry run. The cleanup can be tested by failing the
+	// upload with the following disrupts:
+	//
+	//   - SkyfileUploadFailAfterFanout: after the fanout of a large file was
+	//     uploaded
+	//   - SkyfileUploadFailAfterSkylink: after the skylink was created but
+	//     before the base sector is uploaded
+	//   - SkyfileUploadFailAfterBaseSector: after the base sector was uploaded
+	//   - SkyfileUploadFail: after the whole skyfile was uploaded
+	//
+	// An upload that failed because its extended siapath is occupied didn't
+	// create any siafiles. The existing siafile is left alone since it doesn't
+	// belong to this upload.
 	defer func() {
+		if errors.Contains(err, ErrSkyfileExtendedPathExists) {
+			return
+		}
 		if err != nil || sup.DryRun {
 			if err := r.DeleteFile(sup.SiaPath); err != nil && !errors.Contains(err, filesystem.ErrNotExist) {
 				r.log.Printf("error deleting siafile after upload error: %v", err)
 			}
 
-			extendedPath := sup.SiaPath.String() + modules.ExtendedSuffix
-			extendedSiaPath, _ := modules.NewSiaPath(extendedPath)
+			extendedSiaPath, err := modules.ExtendedSiaPath(sup.SiaPath)
+			if err != nil {
+				r.log.Printf("error creating extended siapath after upload error: %v\n", err)
+				return
+			}
 			if err := r.DeleteFile(extendedSiaPath); err != nil && !errors.Contains(err, filesystem.ErrNotExist) {
 				r.log.Printf("error deleting extended siafile after upload error: %v\n", err)
 			}
 		}
 	}()
 
-	// Upload the skyfile
-	skylink, err = r.managedUploadSkyfile(sup, reader)
+	// Upload the skyfile, aborting the upload if the reader stalls.
+	reader = newSkyfileStallReader(reader, skyfileUploadReadTimeout, r.tg.StopChan())
+	skylink, err = r.managedUploadSkyfile(sup, reader, skylinkChan)
 	if err != nil {
 		return modules.Skylink{}, errors.AddContext(err, "unable to upload skyfile")
 	}
@@ -981,6 +2352,28 @@ func (r *Renter) UploadSkyfile(sup modules.SkyfileUploadParameters, reader modul
 		return modules.Skylink{}, ErrSkylinkBlocked
 	}
 
+	// Schedule the deletion of the siafiles if the upload has a TTL.
+	if sup.TTL > 0 && !sup.DryRun {
+		err = r.managedScheduleSkyfileExpiration(sup.SiaPath, skylink, sup.TTL)
+		if err != nil {
+			return modules.Skylink{}, errors.AddContext(err, "unable to schedule skyfile expiration")
+		}
+	}
+
+	// Remember the skylink in case the client retries the upload.
+	if idempotencyReader != nil {
+		contentDigest, err := idempotencyReader.digest()
+		if err != nil {
+			return modules.Skylink{}, errors.AddContext(err, "unable to compute the digest of the upload")
+		}
+		entry := skyfileIdempotencyEntry{
+			siaPath:       sup.SiaPath,
+			paramsDigest:  skyfileIdempotencyParamsDigest(sup),
+			contentDigest: contentDigest,
+			skylink:       skylink,
+		}
+		r.staticSkyfileIdempotencyCache.callSet(sup.IdempotencyKey, entry, r.managedSkyfileIdempotencyKeyExpiry())
+	}
 	return skylink, nil
 }
 
@@ -1006,3 +2399,21 @@ func (r *Renter) isFileNodeBlocked(fileNode *filesystem.FileNode) bool {
 	}
 	return false
 }
+
+// skylinkBaseSectorTimeout returns the timeout that should be applied to
+// fetching the base sector of a skylink given the overall timeout of the
+// operation. If no base sector timeout is provided it defaults to a fraction of
+// the overall timeout. The returned timeout never exceeds the overall timeout,
+// a timeout of 0 means there is no timeout.
+func skylinkBaseSectorTimeout(timeout, baseSectorTimeout time.Duration) time.Duration {
+	if timeout <= 0 {
+		return baseSectorTimeout
+	}
+	if baseSectorTimeout <= 0 {
+		return timeout / skylinkBaseSectorTimeoutDivisor
+	}
+	if baseSectorTimeout > timeout {
+		return timeout
+	}
+	return baseSectorTimeout
+}
@@ -0,0 +1,2389 @@
+package renter
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gitlab.com/NebulousLabs/Sia/build"
+	"gitlab.com/NebulousLabs/Sia/crypto"
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/modules/renter/filesystem"
+	"gitlab.com/NebulousLabs/Sia/siatest/dependencies"
+	"gitlab.com/NebulousLabs/Sia/skykey"
+	"gitlab.com/NebulousLabs/Sia/types"
+	"gitlab.com/NebulousLabs/errors"
+	"gitlab.com/NebulousLabs/fastrand"
+)
+
+// TestDefaultBaseChunkRedundancy verifies the default base chunk redundancy
+// for the current build.
+func TestDefaultBaseChunkRedundancy(t *testing.T) {
+	t.Parallel()
+
+	expected := map[string]uint8{
+		"dev":      2,
+		"standard": 10,
+		"testing":  2,
+	}[build.Release]
+	if rc := DefaultBaseChunkRedundancy(); rc != expected {
+		t.Fatalf("expected default redundancy %v for release %v but got %v", expected, build.Release, rc)
+	}
+	if DefaultBaseChunkRedundancy() != SkyfileDefaultBaseChunkRedundancy {
+		t.Fatal("accessor doesn't match variable")
+	}
+}
+
+// dependencyOverlapSkyfileUploads is a dependency that blocks the start of the
+// base sector upload of a skyfile until the fanout upload has started. It keeps
+// track of whether the two uploads were running at the same time.
+type dependencyOverlapSkyfileUploads struct {
+	modules.ProductionDependencies
+
+	atomicOverlapped    uint64
+	staticFanoutStarted chan struct{}
+}
+
+// Disrupt checks for the skyfile upload disrupts and responds accordingly.
+func (d *dependencyOverlapSkyfileUploads) Disrupt(s string) bool {
+	switch s {
+	case "SkyfileFanoutUploadStarted":
+		close(d.staticFanoutStarted)
+	case "SkyfileBaseSectorUploadStarted":
+		select {
+		case <-d.staticFanoutStarted:
+			atomic.StoreUint64(&d.atomicOverlapped, 1)
+		case <-time.After(10 * time.Second):
+		}
+	}
+	return false
+}
+
+// TestUploadBaseSectorAndFanout verifies that the base sector and the fanout of
+// a skyfile are uploaded concurrently and that the errors of both uploads are
+// returned and the siafiles cleaned up if the uploads fail.
+func TestUploadBaseSectorAndFanout(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	// Create a renter without any hosts, this will cause both uploads to fail
+	// after the siafiles were created.
+	deps := &dependencyOverlapSkyfileUploads{
+		staticFanoutStarted: make(chan struct{}),
+	}
+	rt, err := newRenterTesterWithDependency(t.Name(), deps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := rt.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	r := rt.renter
+
+	// Prepare the upload params.
+	siaPath, err := modules.SkynetFolder.Join(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sup := modules.SkyfileUploadParameters{SiaPath: siaPath}
+	extendedPath, err := modules.NewSiaPath(siaPath.String() + modules.ExtendedSuffix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fup, err := r.managedFileUploadParams(extendedPath, 1, 1, false, crypto.TypePlain, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	baseSector := fastrand.Bytes(int(modules.SectorSize))
+	skylink, err := modules.NewSkylinkV1(crypto.MerkleRoot(baseSector), 0, modules.SectorSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fanout := bytes.NewReader(fastrand.Bytes(int(modules.SectorSize)))
+
+	// Upload the skyfile.
+	start := time.Now()
+	_, err = r.managedUploadBaseSectorAndFanout(context.Background(), sup, baseSector, skylink, fup, fanout)
+	if err == nil {
+		t.Fatal("expected upload to fail without hosts")
+	}
+
+	// Both uploads should have been running at the same time. If they were
+	// serial, the base sector upload would have been blocked for the full
+	// timeout in the dependency.
+	if atomic.LoadUint64(&deps.atomicOverlapped) != 1 {
+		t.Fatalf("base sector and fanout uploads did not overlap, took %v", time.Since(start))
+	}
+
+	// The error should contain the errors of both uploads.
+	if !strings.Contains(err.Error(), "failed to upload base sector") {
+		t.Fatal("error is missing base sector upload error", err)
+	}
+	if !strings.Contains(err.Error(), "unable to upload large skyfile") {
+		t.Fatal("error is missing fanout upload error", err)
+	}
+
+	// Neither of the siafiles should exist anymore.
+	for _, sp := range []modules.SiaPath{siaPath, extendedPath} {
+		_, err = r.staticFileSystem.OpenSiaFile(sp)
+		if !errors.Contains(err, filesystem.ErrNotExist) {
+			t.Fatalf("expected siafile %v to be deleted, got %v", sp, err)
+		}
+	}
+}
+
+// cancelingReader is a reader that returns its data and then cancels the
+// context once it is asked for more. It simulates a caller canceling a pin
+// while the fanout is still being fetched.
+type cancelingReader struct {
+	data   *bytes.Reader
+	cancel context.CancelFunc
+	ctx    context.Context
+}
+
+// Read implements the io.Reader interface.
+func (cr *cancelingReader) Read(b []byte) (int, error) {
+	if cr.data.Len() > 0 {
+		return cr.data.Read(b)
+	}
+	cr.cancel()
+	<-cr.ctx.Done()
+	return 0, cr.ctx.Err()
+}
+
+// TestUploadBaseSectorAndFanoutCanceled verifies that canceling the context
+// while the fanout of a skyfile is uploaded aborts the upload and deletes the
+// partially uploaded fanout, and the base sector unless it should be kept.
+func TestUploadBaseSectorAndFanoutCanceled(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	wt, err := newWorkerTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := wt.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	r := wt.rt.renter
+
+	for _, keepBaseSector := range []bool{false, true} {
+		// Prepare the upload params.
+		siaPath, err := modules.SkynetFolder.Join(fmt.Sprintf("%v-%v", t.Name(), keepBaseSector))
+		if err != nil {
+			t.Fatal(err)
+		}
+		sup := modules.SkyfileUploadParameters{
+			SiaPath:                   siaPath,
+			BaseChunkRedundancy:       2,
+			PinKeepBaseSectorOnCancel: keepBaseSector,
+		}
+		extendedPath, err := modules.ExtendedSiaPath(siaPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fup, err := r.managedFileUploadParams(extendedPath, 1, 1, false, crypto.TypePlain, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		baseSector := fastrand.Bytes(int(modules.SectorSize))
+		skylink, err := modules.NewSkylinkV1(crypto.MerkleRoot(baseSector), 0, modules.SectorSize)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// The fanout reader serves the first chunk and cancels the upload
+		// when the second one is fetched.
+		ctx, cancel := context.WithCancel(context.Background())
+		fanout := &cancelingReader{
+			data:   bytes.NewReader(fastrand.Bytes(int(modules.SectorSize))),
+			cancel: cancel,
+			ctx:    ctx,
+		}
+		_, err = r.managedUploadBaseSectorAndFanout(ctx, sup, baseSector, skylink, fup, fanout)
+		if !errors.Contains(err, context.Canceled) {
+			t.Fatalf("expected error '%v', got '%v'", context.Canceled, err)
+		}
+
+		// The fanout should be deleted.
+		_, err = r.staticFileSystem.OpenSiaFile(extendedPath)
+		if !errors.Contains(err, filesystem.ErrNotExist) {
+			t.Fatalf("expected fanout siafile to be deleted, got %v", err)
+		}
+
+		// The base sector should only exist if it was meant to be kept.
+		sf, err := r.staticFileSystem.OpenSiaFile(siaPath)
+		if keepBaseSector && err != nil {
+			t.Fatal("expected base sector siafile to be kept", err)
+		}
+		if !keepBaseSector && !errors.Contains(err, filesystem.ErrNotExist) {
+			t.Fatalf("expected base sector siafile to be deleted, got %v", err)
+		}
+		if sf != nil {
+			if err := sf.Close(); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
+
+// TestUploadSkyfileMetadataTooBig verifies that an upload with metadata that
+// doesn't fit in the base sector fails before any data is uploaded.
+func TestUploadSkyfileMetadataTooBig(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	// Create a renter without any hosts. If the upload were to fall back to a
+	// large file upload, it would fail due to a lack of workers.
+	rt, err := newRenterTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := rt.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	// Use a filename that's greater than a sector to force the metadata to be
+	// larger than a sector.
+	siaPath, err := modules.SkynetFolder.Join(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sup := modules.SkyfileUploadParameters{
+		SiaPath:  siaPath,
+		Filename: hex.EncodeToString(fastrand.Bytes(int(modules.SectorSize))),
+		Mode:     modules.DefaultFilePerm,
+	}
+	reader := modules.NewSkyfileReader(bytes.NewReader(fastrand.Bytes(100)), sup)
+	_, err = rt.renter.managedUploadSkyfile(sup, reader, nil)
+	if !errors.Contains(err, ErrMetadataTooBig) {
+		t.Fatalf("expected error '%v', got '%v'", ErrMetadataTooBig, err)
+	}
+}
+
+// TestFileUploadParamsPartialChunks verifies that managedFileUploadParams
+// refuses to enable partial chunks for skyfile uploads.
+func TestFileUploadParamsPartialChunks(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	rt, err := newRenterTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := rt.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	r := rt.renter
+
+	skyfilePath, err := modules.SkynetFolder.Join("skyfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	extendedPath, err := modules.NewSiaPath("skyfile" + modules.ExtendedSuffix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	regularPath, err := modules.NewSiaPath("regular")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Create a skyfile outside of the Skynet folder, as if it was uploaded
+	// with Root, and a skyfile of which only the extended siafile remains.
+	skylink, err := modules.NewSkylinkV1(crypto.Hash{1}, 0, modules.SectorSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rootPath, err := modules.NewSiaPath("root-skyfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rootExtendedOnlyPath, err := modules.NewSiaPath("root-skyfile-extended")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rootExtendedPath, err := modules.ExtendedSiaPath(rootExtendedOnlyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, sp := range []modules.SiaPath{rootPath, rootExtendedPath} {
+		rsc, err := modules.NewRSSubCode(1, 1, crypto.SegmentSize)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fileNode, err := r.createRenterTestFileWithParams(sp, rsc, crypto.TypePlain)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = errors.Compose(fileNode.AddSkylink(skylink), fileNode.Close())
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Partial chunks can always be disabled.
+	for _, sp := range []modules.SiaPath{skyfilePath, extendedPath, regularPath, rootPath, rootExtendedOnlyPath} {
+		fup, err := r.managedFileUploadParams(sp, 1, 1, false, crypto.TypePlain, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !fup.DisablePartialChunk {
+			t.Fatal("partial chunks should be disabled")
+		}
+	}
+
+	// Partial chunks can't be enabled for skyfiles.
+	for _, sp := range []modules.SiaPath{skyfilePath, extendedPath, rootPath, rootExtendedOnlyPath} {
+		_, err := r.managedFileUploadParams(sp, 1, 1, false, crypto.TypePlain, false)
+		if !errors.Contains(err, errPartialChunksForSkyfile) {
+			t.Fatalf("expected %v for %v but got %v", errPartialChunksForSkyfile, sp, err)
+		}
+	}
+
+	// Partial chunks can be enabled for other files.
+	fup, err := r.managedFileUploadParams(regularPath, 1, 1, false, crypto.TypePlain, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fup.DisablePartialChunk {
+		t.Fatal("partial chunks should be enabled")
+	}
+}
+
+// TestSkylinkBaseSectorTimeout is a unit test for skylinkBaseSectorTimeout.
+func TestSkylinkBaseSectorTimeout(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		timeout           time.Duration
+		baseSectorTimeout time.Duration
+		result            time.Duration
+	}{
+		{0, 0, 0},                               // no timeouts
+		{0, time.Second, time.Second},           // only base sector timeout
+		{time.Minute, 0, time.Minute / 2},       // default
+		{time.Minute, time.Second, time.Second}, // custom
+		{time.Second, time.Minute, time.Second}, // capped
+	}
+	for i, test := range tests {
+		result := skylinkBaseSectorTimeout(test.timeout, test.baseSectorTimeout)
+		if result != test.result {
+			t.Errorf("%v: expected %v but got %v", i, test.result, result)
+		}
+	}
+}
+
+// TestValidateErasureParams is a unit test for validateErasureParams.
+func TestValidateErasureParams(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		dataPieces   int
+		parityPieces int
+		valid        bool
+	}{
+		{1, 0, true},
+		{10, 20, true},
+		{1, maxErasureCodingShards - 1, true},
+		{0, 10, false},  // zero data pieces
+		{-1, 10, false}, // negative data pieces
+		{10, -1, false}, // negative parity pieces
+		{255, 255, false},
+		{maxErasureCodingShards, 1, false},
+	}
+	for i, test := range tests {
+		err := validateErasureParams(test.dataPieces, test.parityPieces)
+		if test.valid && err != nil {
+			t.Errorf("%v: unexpected error %v", i, err)
+		}
+		if !test.valid && !errors.Contains(err, errInvalidErasureParams) {
+			t.Errorf("%v: expected %v but got %v", i, errInvalidErasureParams, err)
+		}
+	}
+}
+
+// TestSkyfileFanoutErasureParams verifies that the fanout erasure coding
+// parameters of a skyfile upload default to the renter defaults and can be
+// overridden.
+func TestSkyfileFanoutErasureParams(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		data, parity       uint8
+		expData, expParity int
+		valid              bool
+	}{
+		{0, 0, modules.RenterDefaultDataPieces, modules.RenterDefaultParityPieces, true},
+		{2, 5, 2, 5, true},
+		{1, 1, 1, 1, true},
+		{2, 0, 0, 0, false},
+		{0, 2, 0, 0, false},
+		{200, 100, 0, 0, false},
+	}
+	for _, test := range tests {
+		sup := modules.SkyfileUploadParameters{
+			FanoutDataPieces:   test.data,
+			FanoutParityPieces: test.parity,
+		}
+		dataPieces, parityPieces, err := skyfileFanoutErasureParams(sup)
+		if test.valid && err != nil {
+			t.Fatal(test, err)
+		}
+		if !test.valid && !errors.Contains(err, errInvalidErasureParams) {
+			t.Fatal("expected invalid params error", test, err)
+		}
+		if dataPieces != test.expData || parityPieces != test.expParity {
+			t.Fatal("wrong params", test, dataPieces, parityPieces)
+		}
+	}
+}
+
+// TestRestoreSkyfileInvalidErasureParams verifies that restoring a skyfile
+// with a layout that contains invalid erasure coding parameters fails before
+// any data is uploaded.
+func TestRestoreSkyfileInvalidErasureParams(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	rt, err := newRenterTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := rt.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	// backupWithLayout creates a backup of a large skyfile using the given
+	// fanout erasure coding parameters.
+	backupWithLayout := func(dataPieces, parityPieces uint8) *bytes.Buffer {
+		sm := modules.SkyfileMetadata{
+			Filename: t.Name(),
+			Length:   modules.SectorSize * 2,
+			Mode:     modules.DefaultFilePerm,
+		}
+		metadataBytes, err := modules.SkyfileMetadataBytes(sm)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fanout := fastrand.Bytes(crypto.HashSize)
+		sl := modules.SkyfileLayout{
+			Version:            modules.SkyfileVersion,
+			Filesize:           sm.Length,
+			MetadataSize:       uint64(len(metadataBytes)),
+			FanoutSize:         uint64(len(fanout)),
+			FanoutDataPieces:   dataPieces,
+			FanoutParityPieces: parityPieces,
+			CipherType:         crypto.TypePlain,
+		}
+		baseSector := append(sl.Encode(), fanout...)
+		baseSector = append(baseSector, metadataBytes...)
+		skylink, err := modules.NewSkylinkV1(crypto.MerkleRoot(baseSector), 0, uint64(len(baseSector)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		data := bytes.NewReader(fastrand.Bytes(int(sm.Length)))
+		err = modules.BackupSkylink(skylink.String(), baseSector, data, &buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &buf
+	}
+
+	// Zero data pieces.
+	_, err = rt.renter.RestoreSkyfile(backupWithLayout(0, 10))
+	if !errors.Contains(err, errInvalidErasureParams) {
+		t.Fatalf("expected %v but got %v", errInvalidErasureParams, err)
+	}
+
+	// Too many pieces in total.
+	_, err = rt.renter.RestoreSkyfile(backupWithLayout(200, 100))
+	if !errors.Contains(err, errInvalidErasureParams) {
+		t.Fatalf("expected %v but got %v", errInvalidErasureParams, err)
+	}
+}
+
+// TestRestoreSkyfileInvalidDefaultPath verifies that restoring a skyfile with
+// metadata that contains an invalid default path fails.
+func TestRestoreSkyfileInvalidDefaultPath(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	rt, err := newRenterTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := rt.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	// backupWithMetadata creates a backup of a small skyfile with the given
+	// metadata.
+	backupWithMetadata := func(sm modules.SkyfileMetadata) *bytes.Buffer {
+		metadataBytes, err := modules.SkyfileMetadataBytes(sm)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sl := modules.SkyfileLayout{
+			Version:      modules.SkyfileVersion,
+			Filesize:     sm.Length,
+			MetadataSize: uint64(len(metadataBytes)),
+			CipherType:   crypto.TypePlain,
+		}
+		baseSector, fetchSize := modules.BuildBaseSector(sl.Encode(), nil, metadataBytes, fastrand.Bytes(int(sm.Length)))
+		skylink, err := modules.NewSkylinkV1(crypto.MerkleRoot(baseSector), 0, fetchSize)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		err = modules.BackupSkylink(skylink.String(), baseSector, nil, &buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &buf
+	}
+
+	// Default path on a skyfile without subfiles.
+	sm := modules.SkyfileMetadata{
+		Filename:    t.Name(),
+		Length:      10,
+		Mode:        modules.DefaultFilePerm,
+		DefaultPath: "/index.html",
+	}
+	_, err = rt.renter.RestoreSkyfile(backupWithMetadata(sm))
+	if !errors.Contains(err, modules.ErrInvalidDefaultPath) {
+		t.Fatalf("expected %v but got %v", modules.ErrInvalidDefaultPath, err)
+	}
+
+	// Default path and disabled default path.
+	sm.Subfiles = modules.SkyfileSubfiles{
+		"index.html": modules.SkyfileSubfileMetadata{
+			Filename: "index.html",
+			Len:      sm.Length,
+		},
+	}
+	sm.DisableDefaultPath = true
+	_, err = rt.renter.RestoreSkyfile(backupWithMetadata(sm))
+	if !errors.Contains(err, modules.ErrInvalidDefaultPath) {
+		t.Fatalf("expected %v but got %v", modules.ErrInvalidDefaultPath, err)
+	}
+}
+
+// TestRestoreSkyfileSubfileGap verifies that restoring a skyfile whose
+// subfiles don't cover its data back to back fails.
+func TestRestoreSkyfileSubfileGap(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	rt, err := newRenterTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := rt.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	// restore is a helper that creates a backup of a skyfile with the given
+	// subfiles and tries to restore it.
+	restore := func(subfiles modules.SkyfileSubfiles) error {
+		sm := modules.SkyfileMetadata{
+			Filename: t.Name(),
+			Length:   10,
+			Mode:     modules.DefaultFilePerm,
+			Subfiles: subfiles,
+		}
+		metadataBytes, err := modules.SkyfileMetadataBytes(sm)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sl := modules.SkyfileLayout{
+			Version:      modules.SkyfileVersion,
+			Filesize:     sm.Length,
+			MetadataSize: uint64(len(metadataBytes)),
+			CipherType:   crypto.TypePlain,
+		}
+		baseSector, fetchSize := modules.BuildBaseSector(sl.Encode(), nil, metadataBytes, fastrand.Bytes(int(sm.Length)))
+		skylink, err := modules.NewSkylinkV1(crypto.MerkleRoot(baseSector), 0, fetchSize)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		err = modules.BackupSkylink(skylink.String(), baseSector, nil, &buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = rt.renter.RestoreSkyfile(&buf)
+		return err
+	}
+
+	// Subfiles with a gap after the first one and an overlap between the
+	// other two still lie within the file and their lengths add up to the
+	// filesize. The error should identify the gap.
+	err = restore(modules.SkyfileSubfiles{
+		"a": modules.SkyfileSubfileMetadata{Filename: "a", Offset: 0, Len: 4},
+		"b": modules.SkyfileSubfileMetadata{Filename: "b", Offset: 5, Len: 3},
+		"c": modules.SkyfileSubfileMetadata{Filename: "c", Offset: 7, Len: 3},
+	})
+	if !errors.Contains(err, modules.ErrSkyfileSubfilesNotContiguous) {
+		t.Fatalf("expected %v but got %v", modules.ErrSkyfileSubfilesNotContiguous, err)
+	}
+	if !strings.Contains(err.Error(), "gap between offset 4 and subfile 'b' at offset 5") {
+		t.Fatal("error doesn't identify the gap", err)
+	}
+
+	// Subfiles that end before the end of the file leave a trailing gap.
+	err = restore(modules.SkyfileSubfiles{
+		"a": modules.SkyfileSubfileMetadata{Filename: "a", Offset: 0, Len: 4},
+		"b": modules.SkyfileSubfileMetadata{Filename: "b", Offset: 4, Len: 3},
+	})
+	if !errors.Contains(err, modules.ErrSkyfileSubfilesNotContiguous) {
+		t.Fatalf("expected %v but got %v", modules.ErrSkyfileSubfilesNotContiguous, err)
+	}
+	if !strings.Contains(err.Error(), "subfiles end at offset 7 but the filesize is 10") {
+		t.Fatal("error doesn't identify the trailing gap", err)
+	}
+}
+
+// TestSkyfileExtendedPathExists verifies that uploading and restoring a large
+// skyfile fails with ErrSkyfileExtendedPathExists if its extended siapath is
+// occupied and the upload isn't forced.
+func TestSkyfileExtendedPathExists(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	rt, err := newRenterTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := rt.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	r := rt.renter
+
+	// occupy creates a siafile at the given siapath.
+	occupy := func(siaPath modules.SiaPath) {
+		_, rsc := testingFileParams()
+		fileNode, err := r.createRenterTestFileWithParams(siaPath, rsc, crypto.TypePlain)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := fileNode.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Occupy the extended siapath of an upload.
+	siaPath, err := modules.SkynetFolder.Join(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	extendedPath, err := modules.ExtendedSiaPath(siaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	occupy(extendedPath)
+
+	// Uploading a large skyfile without force should fail.
+	sup := modules.SkyfileUploadParameters{
+		SiaPath:  siaPath,
+		Filename: "file",
+		Mode:     modules.DefaultFilePerm,
+	}
+	data := fastrand.Bytes(int(modules.SectorSize) * 2)
+	_, err = r.UploadSkyfile(sup, modules.NewSkyfileReader(bytes.NewReader(data), sup))
+	if !errors.Contains(err, ErrSkyfileExtendedPathExists) {
+		t.Fatalf("expected %v but got %v", ErrSkyfileExtendedPathExists, err)
+	}
+	if !strings.Contains(err.Error(), extendedPath.String()) {
+		t.Fatal("error doesn't name the extended siapath", err)
+	}
+
+	// The failed upload shouldn't have deleted the occupying siafile.
+	exists, err := r.staticFileSystem.FileExists(extendedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !exists {
+		t.Fatal("occupied extended siafile was deleted by the failed upload")
+	}
+
+	// With force the upload should get past the check. It still fails since
+	// the renter doesn't have any hosts.
+	sup.Force = true
+	_, err = r.UploadSkyfile(sup, modules.NewSkyfileReader(bytes.NewReader(data), sup))
+	if err == nil || errors.Contains(err, ErrSkyfileExtendedPathExists) {
+		t.Fatal("expected forced upload to fail for a different reason", err)
+	}
+
+	// Restoring a large skyfile with an occupied extended siapath should fail
+	// as well.
+	sm := modules.SkyfileMetadata{
+		Filename: "file",
+		Length:   modules.SectorSize * 2,
+		Mode:     modules.DefaultFilePerm,
+	}
+	metadataBytes, err := modules.SkyfileMetadataBytes(sm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fanout := fastrand.Bytes(crypto.HashSize * 2)
+	sl := modules.SkyfileLayout{
+		Version:            modules.SkyfileVersion,
+		Filesize:           sm.Length,
+		MetadataSize:       uint64(len(metadataBytes)),
+		FanoutSize:         uint64(len(fanout)),
+		FanoutDataPieces:   1,
+		FanoutParityPieces: 1,
+		CipherType:         crypto.TypePlain,
+	}
+	baseSector, fetchSize := modules.BuildBaseSector(sl.Encode(), fanout, metadataBytes, nil)
+	skylink, err := modules.NewSkylinkV1(crypto.MerkleRoot(baseSector), 0, fetchSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	err = modules.BackupSkylink(skylink.String(), baseSector, bytes.NewReader(data), &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, restoreExtendedPath, err := modules.SkylinkSiaPath(skylink)
+	if err != nil {
+		t.Fatal(err)
+	}
+	occupy(restoreExtendedPath)
+	_, err = r.RestoreSkyfile(&buf)
+	if !errors.Contains(err, ErrSkyfileExtendedPathExists) {
+		t.Fatalf("expected %v but got %v", ErrSkyfileExtendedPathExists, err)
+	}
+	exists, err = r.staticFileSystem.FileExists(restoreExtendedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !exists {
+		t.Fatal("occupied extended siafile was deleted by the failed restore")
+	}
+}
+
+// TestUploadSkyfileAsync verifies that UploadSkyfileAsync returns the skylink
+// of a large file before the upload completes and that the result of the
+// upload is reported on the returned channel.
+func TestUploadSkyfileAsync(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	t.Run("Success", func(t *testing.T) { testUploadSkyfileAsync(t, modules.ProdDependencies, false) })
+	t.Run("Failure", func(t *testing.T) {
+		testUploadSkyfileAsync(t, &dependencies.DependencyFailUploadStreamFromReader{}, true)
+	})
+}
+
+// testUploadSkyfileAsync uploads a large skyfile using UploadSkyfileAsync and
+// checks the returned skylink and upload result.
+func testUploadSkyfileAsync(t *testing.T, deps modules.Dependencies, fail bool) {
+	wt, err := newWorkerTesterCustomDependency(t.Name(), deps, modules.ProdDependencies)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := wt.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	r := wt.rt.renter
+
+	// Create the data of a large file.
+	data := fastrand.Bytes(int(modules.SectorSize)*3 + fastrand.Intn(100) + 1)
+	newSup := func(name string, dryRun bool) modules.SkyfileUploadParameters {
+		siaPath, err := modules.SkynetFolder.Join(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return modules.SkyfileUploadParameters{
+			SiaPath:  siaPath,
+			DryRun:   dryRun,
+			Filename: "file",
+			Mode:     modules.DefaultFilePerm,
+		}
+	}
+
+	// Determine the expected skylink using a dry run.
+	sup := newSup("dryrun", true)
+	expected, err := r.UploadSkyfile(sup, modules.NewSkyfileReader(bytes.NewReader(data), sup))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Upload the file.
+	sup = newSup("async", false)
+	skylink, done, err := r.UploadSkyfileAsync(sup, modules.NewSkyfileReader(bytes.NewReader(data), sup))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if skylink != expected {
+		t.Fatalf("expected skylink %v but got %v", expected, skylink)
+	}
+
+	// Wait for the upload to finish.
+	select {
+	case err = <-done:
+	case <-time.After(time.Minute):
+		t.Fatal("upload didn't finish in time")
+	}
+	if fail && err == nil {
+		t.Fatal("expected the background upload to fail")
+	}
+	if !fail && err != nil {
+		t.Fatal(err)
+	}
+
+	// The channel should be closed.
+	if _, ok := <-done; ok {
+		t.Fatal("channel should be closed")
+	}
+
+	// On failure the siafiles are cleaned up.
+	_, err = r.staticFileSystem.OpenSiaFile(sup.SiaPath)
+	if fail && !errors.Contains(err, filesystem.ErrNotExist) {
+		t.Fatal("expected siafile to be deleted", err)
+	}
+	if !fail && err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestDownloadByRoots verifies that DownloadByRoots returns a result for every
+// root, with the data of the available roots and an error for the unavailable
+// and blocked ones.
+func TestDownloadByRoots(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	wt, err := newWorkerTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := wt.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	r := wt.rt.renter
+
+	// Upload two small skyfiles to get two available roots.
+	var available []crypto.Hash
+	for i := 0; i < 2; i++ {
+		siaPath, err := modules.SkynetFolder.Join(fmt.Sprintf("file%v", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		sup := modules.SkyfileUploadParameters{
+			SiaPath:  siaPath,
+			Filename: "file",
+			Mode:     modules.DefaultFilePerm,
+		}
+		data := fastrand.Bytes(100)
+		skylink, err := r.UploadSkyfile(sup, modules.NewSkyfileReader(bytes.NewReader(data), sup))
+		if err != nil {
+			t.Fatal(err)
+		}
+		available = append(available, skylink.MerkleRoot())
+	}
+
+	// Block the second root.
+	blocked := available[1]
+	err = r.UpdateSkynetBlocklist([]crypto.Hash{crypto.HashObject(blocked)}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Fetch a mix of available, unavailable and blocked roots.
+	var unavailable crypto.Hash
+	fastrand.Read(unavailable[:])
+	roots := []crypto.Hash{available[0], unavailable, blocked, available[0]}
+	results, err := r.DownloadByRoots(roots, 0, modules.SectorSize, time.Minute, types.ZeroCurrency)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != len(roots) {
+		t.Fatalf("expected %v results but got %v", len(roots), len(results))
+	}
+	for i, res := range results {
+		if res.Root != roots[i] {
+			t.Fatalf("result %v has the wrong root", i)
+		}
+	}
+	for _, i := range []int{0, 3} {
+		if results[i].Err != nil {
+			t.Fatal(results[i].Err)
+		}
+		if uint64(len(results[i].Data)) != modules.SectorSize {
+			t.Fatalf("expected %v bytes but got %v", modules.SectorSize, len(results[i].Data))
+		}
+		if crypto.MerkleRoot(results[i].Data) != available[0] {
+			t.Fatal("downloaded data doesn't match the root")
+		}
+	}
+	if results[1].Err == nil || results[1].Data != nil {
+		t.Fatal("expected the download of the unavailable root to fail")
+	}
+	if !errors.Contains(results[2].Err, ErrSkylinkBlocked) || results[2].Data != nil {
+		t.Fatal("expected the download of the blocked root to fail", results[2].Err)
+	}
+}
+
+// TestDownloadByRootWithStats verifies that DownloadByRootWithStats reports
+// the hosts that were queried for a successful download.
+func TestDownloadByRootWithStats(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	wt, err := newWorkerTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := wt.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	r := wt.rt.renter
+
+	// Upload a small skyfile.
+	siaPath, err := modules.SkynetFolder.Join(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sup := modules.SkyfileUploadParameters{
+		SiaPath:  siaPath,
+		Filename: "file",
+		Mode:     modules.DefaultFilePerm,
+	}
+	data := fastrand.Bytes(100)
+	skylink, err := r.UploadSkyfile(sup, modules.NewSkyfileReader(bytes.NewReader(data), sup))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Download the base sector and check the stats.
+	baseSector, stats, err := r.DownloadByRootWithStats(skylink.MerkleRoot(), 0, modules.SectorSize, time.Minute, types.ZeroCurrency)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if crypto.MerkleRoot(baseSector) != skylink.MerkleRoot() {
+		t.Fatal("downloaded data doesn't match the root")
+	}
+	if len(stats.Hosts) == 0 {
+		t.Fatal("expected at least one host in the stats")
+	}
+	if stats.Duration <= 0 {
+		t.Fatal("expected duration to be set", stats.Duration)
+	}
+	var totalCost types.Currency
+	var completed bool
+	for _, host := range stats.Hosts {
+		if !host.HostKey.Equals(wt.staticHostPubKey) {
+			t.Fatal("unexpected host", host.HostKey)
+		}
+		if host.Completed && host.Err == nil {
+			completed = true
+		}
+		if host.Cost.IsZero() {
+			t.Fatal("expected cost to be set")
+		}
+		totalCost = totalCost.Add(host.Cost)
+	}
+	if !completed {
+		t.Fatal("expected a host to have completed the download", stats.Hosts)
+	}
+	if !totalCost.Equals(stats.TotalCost) {
+		t.Fatalf("expected total cost %v but got %v", totalCost, stats.TotalCost)
+	}
+
+	// Blocked roots should be rejected.
+	err = r.UpdateSkynetBlocklist([]crypto.Hash{crypto.HashObject(skylink.MerkleRoot())}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = r.DownloadByRootWithStats(skylink.MerkleRoot(), 0, modules.SectorSize, time.Minute, types.ZeroCurrency)
+	if !errors.Contains(err, ErrSkylinkBlocked) {
+		t.Fatal("expected blocked error", err)
+	}
+}
+
+// TestUploadSkyfileV2 tests that UploadSkyfileV2 only returns a v2 skylink if
+// it was requested and that the parameters are validated.
+func TestUploadSkyfileV2(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	rt, err := newRenterTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := rt.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	r := rt.renter
+
+	siaPath, err := modules.SkynetFolder.Join(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sup := modules.SkyfileUploadParameters{
+		SiaPath:  siaPath,
+		DryRun:   true,
+		Filename: "file",
+		Mode:     modules.DefaultFilePerm,
+	}
+	data := fastrand.Bytes(100)
+	expected, err := r.UploadSkyfile(sup, modules.NewSkyfileReader(bytes.NewReader(data), sup))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Without v2 parameters only the v1 skylink is returned.
+	result, err := r.UploadSkyfileV2(sup, modules.NewSkyfileReader(bytes.NewReader(data), sup))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Skylink != expected {
+		t.Fatal("wrong v1 skylink", result.Skylink, expected)
+	}
+	if result.SkylinkV2 != (modules.Skylink{}) {
+		t.Fatal("v2 skylink shouldn't be set", result.SkylinkV2)
+	}
+
+	// With v2 parameters both skylinks are returned.
+	sk, pk := crypto.GenerateKeyPair()
+	v2 := &modules.SkylinkV2Parameters{
+		PublicKey: types.Ed25519PublicKey(pk),
+		SecretKey: sk,
+		Revision:  1,
+	}
+	fastrand.Read(v2.DataKey[:])
+	sup.SkylinkV2 = v2
+	result, err = r.UploadSkyfileV2(sup, modules.NewSkyfileReader(bytes.NewReader(data), sup))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Skylink != expected {
+		t.Fatal("wrong v1 skylink", result.Skylink, expected)
+	}
+	if result.SkylinkV2 != modules.NewSkylinkV2(v2.PublicKey, v2.DataKey) {
+		t.Fatal("wrong v2 skylink", result.SkylinkV2)
+	}
+
+	// A public key that doesn't match the secret key is rejected.
+	_, pk2 := crypto.GenerateKeyPair()
+	v2.PublicKey = types.Ed25519PublicKey(pk2)
+	_, err = r.UploadSkyfileV2(sup, modules.NewSkyfileReader(bytes.NewReader(data), sup))
+	if !errors.Contains(err, ErrSkylinkV2KeyMismatch) {
+		t.Fatal("expected key mismatch error", err)
+	}
+}
+
+// TestUploadSkyfileV2ContentHash tests that UploadSkyfileV2 returns the
+// digest of the uploaded data if a content hasher is provided.
+func TestUploadSkyfileV2ContentHash(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	rt, err := newRenterTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := rt.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	r := rt.renter
+
+	// Upload both a small and a large file.
+	for _, size := range []uint64{100, 2*modules.SectorSize + 100} {
+		siaPath, err := modules.SkynetFolder.Join(fmt.Sprintf("%v-%v", t.Name(), size))
+		if err != nil {
+			t.Fatal(err)
+		}
+		sup := modules.SkyfileUploadParameters{
+			SiaPath:  siaPath,
+			DryRun:   true,
+			Filename: "file",
+			Mode:     modules.DefaultFilePerm,
+		}
+		data := fastrand.Bytes(int(size))
+		expected, err := r.UploadSkyfile(sup, modules.NewSkyfileReader(bytes.NewReader(data), sup))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Without a hasher no digest is returned.
+		result, err := r.UploadSkyfileV2(sup, modules.NewSkyfileReader(bytes.NewReader(data), sup))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.ContentHash != nil {
+			t.Fatal("content hash shouldn't be set", result.ContentHash)
+		}
+
+		// With a hasher the digest of the data is returned without
+		// changing the skylink.
+		sup.ContentHasher = sha256.New()
+		result, err = r.UploadSkyfileV2(sup, modules.NewSkyfileReader(bytes.NewReader(data), sup))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Skylink != expected {
+			t.Fatal("wrong skylink", result.Skylink, expected)
+		}
+		digest := sha256.Sum256(data)
+		if !bytes.Equal(result.ContentHash, digest[:]) {
+			t.Fatal("wrong content hash", size)
+		}
+	}
+}
+
+// TestComputeSkylink verifies that modules.ComputeSkylink returns the same
+// skylink as a dry run upload of the same skyfile.
+func TestComputeSkylink(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	rt, err := newRenterTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := rt.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	siaPath, err := modules.SkynetFolder.Join(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sup := modules.SkyfileUploadParameters{
+		SiaPath:  siaPath,
+		DryRun:   true,
+		Filename: "file",
+		Mode:     modules.DefaultFilePerm,
+	}
+	data := fastrand.Bytes(int(fastrand.Intn(1000) + 1))
+	reader := modules.NewSkyfileReader(bytes.NewReader(data), sup)
+	expected, err := rt.renter.UploadSkyfile(sup, reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	md, err := reader.SkyfileMetadata(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	skylink, err := modules.ComputeSkylink(md, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if skylink != expected {
+		t.Fatal("skylink doesn't match dry run", skylink, expected)
+	}
+}
+
+// dependencyFailTransientUploadStreams is a dependency that makes the first
+// staticFailures upload streams fail with a transient error.
+type dependencyFailTransientUploadStreams struct {
+	modules.ProductionDependencies
+
+	atomicCalls    uint64
+	staticFailures uint64
+}
+
+// Disrupt fails the upload stream until staticFailures is reached.
+func (d *dependencyFailTransientUploadStreams) Disrupt(s string) bool {
+	if s != "failUploadStreamFromReaderTransient" {
+		return false
+	}
+	return atomic.AddUint64(&d.atomicCalls, 1) <= d.staticFailures
+}
+
+// TestUploadBaseSectorRetry verifies that the upload of a base sector is
+// retried after transient errors.
+func TestUploadBaseSectorRetry(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	// Transient errors are retried, other errors aren't.
+	if !isTransientUploadStreamError(errors.AddContext(errStreamChunkUnavailable, "context")) {
+		t.Fatal("unavailable chunk should be transient")
+	}
+	if !isTransientUploadStreamError(errors.AddContext(errNotEnoughUploadWorkers, "context")) {
+		t.Fatal("missing workers should be transient")
+	}
+	if isTransientUploadStreamError(filesystem.ErrExists) {
+		t.Fatal("existing siafile shouldn't be transient")
+	}
+
+	t.Run("Success", func(t *testing.T) { testUploadBaseSectorRetry(t, baseSectorUploadMaxAttempts-1) })
+	t.Run("Failure", func(t *testing.T) { testUploadBaseSectorRetry(t, baseSectorUploadMaxAttempts) })
+}
+
+// testUploadBaseSectorRetry uploads a small skyfile while the first failures
+// attempts to upload its base sector fail.
+func testUploadBaseSectorRetry(t *testing.T, failures uint64) {
+	deps := &dependencyFailTransientUploadStreams{staticFailures: failures}
+	wt, err := newWorkerTesterCustomDependency(t.Name(), deps, modules.ProdDependencies)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := wt.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	r := wt.rt.renter
+
+	siaPath, err := modules.SkynetFolder.Join(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sup := modules.SkyfileUploadParameters{
+		SiaPath:             siaPath,
+		BaseChunkRedundancy: 2,
+		Filename:            "file",
+		Mode:                modules.DefaultFilePerm,
+	}
+	data := fastrand.Bytes(100)
+	_, err = r.UploadSkyfile(sup, modules.NewSkyfileReader(bytes.NewReader(data), sup))
+	fail := failures >= baseSectorUploadMaxAttempts
+	if fail && !errors.Contains(err, errStreamChunkUnavailable) {
+		t.Fatal("expected upload to fail", err)
+	}
+	if !fail && err != nil {
+		t.Fatal(err)
+	}
+
+	// The upload should have been attempted until it succeeded or the
+	// attempts ran out.
+	if calls := atomic.LoadUint64(&deps.atomicCalls); calls != baseSectorUploadMaxAttempts {
+		t.Fatalf("expected %v attempts but got %v", baseSectorUploadMaxAttempts, calls)
+	}
+
+	// The siafile should only exist if the upload succeeded.
+	_, err = r.staticFileSystem.OpenSiaFile(siaPath)
+	if fail && !errors.Contains(err, filesystem.ErrNotExist) {
+		t.Fatal("expected siafile to be deleted", err)
+	}
+	if !fail && err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestSkylinkFanout verifies that SkylinkFanout returns the piece roots of the
+// siafile the fanout of a skyfile was created from.
+func TestSkylinkFanout(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	wt, err := newWorkerTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := wt.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	r := wt.rt.renter
+
+	// Create a siafile with random piece roots for a couple of chunks.
+	siaPath, err := modules.SkynetFolder.Join(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsc, err := modules.NewRSSubCode(2, 3, crypto.SegmentSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fileNode, err := r.createRenterTestFileWithParams(siaPath, rsc, crypto.TypePlain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := fileNode.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	numChunks := uint64(3)
+	err = fileNode.GrowNumChunks(numChunks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := make([][]crypto.Hash, numChunks)
+	for chunkIndex := range expected {
+		expected[chunkIndex] = make([]crypto.Hash, rsc.NumPieces())
+		for pieceIndex := range expected[chunkIndex] {
+			root := &expected[chunkIndex][pieceIndex]
+			fastrand.Read(root[:])
+			err = fileNode.AddPiece(types.SiaPublicKey{}, uint64(chunkIndex), uint64(pieceIndex), *root)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	// Build a base sector with the fanout of the siafile and upload it.
+	fanoutBytes, err := skyfileEncodeFanoutFromFileNode(fileNode, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	metadataBytes, err := modules.SkyfileMetadataBytes(modules.SkyfileMetadata{Filename: "file"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sl := modules.SkyfileLayout{
+		Version:            modules.SkyfileVersion,
+		Filesize:           numChunks * fileNode.ChunkSize(),
+		MetadataSize:       uint64(len(metadataBytes)),
+		FanoutSize:         uint64(len(fanoutBytes)),
+		FanoutDataPieces:   uint8(rsc.MinPieces()),
+		FanoutParityPieces: uint8(rsc.NumPieces() - rsc.MinPieces()),
+		CipherType:         crypto.TypePlain,
+	}
+	baseSector, fetchSize := modules.BuildBaseSector(sl.Encode(), fanoutBytes, metadataBytes, nil)
+	skylink, err := modules.NewSkylinkV1(crypto.MerkleRoot(baseSector), 0, fetchSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	baseSiaPath, err := modules.SkynetFolder.Join(t.Name() + "-base")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sup := modules.SkyfileUploadParameters{
+		SiaPath:             baseSiaPath,
+		BaseChunkRedundancy: 2,
+	}
+	err = r.managedUploadBaseSector(sup, baseSector, skylink)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The fanout should match the siafile.
+	fanout, err := r.SkylinkFanout(skylink, time.Minute, types.ZeroCurrency)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fanout.DataPieces != sl.FanoutDataPieces || fanout.ParityPieces != sl.FanoutParityPieces || fanout.CipherType != sl.CipherType {
+		t.Fatal("wrong erasure coding parameters", fanout)
+	}
+	if len(fanout.ChunkRoots) != len(expected) {
+		t.Fatalf("expected %v chunks but got %v", len(expected), len(fanout.ChunkRoots))
+	}
+	for chunkIndex := range expected {
+		if len(fanout.ChunkRoots[chunkIndex]) != len(expected[chunkIndex]) {
+			t.Fatalf("wrong number of roots for chunk %v", chunkIndex)
+		}
+		for pieceIndex := range expected[chunkIndex] {
+			if fanout.ChunkRoots[chunkIndex][pieceIndex] != expected[chunkIndex][pieceIndex] {
+				t.Fatalf("root of piece %v of chunk %v doesn't match", pieceIndex, chunkIndex)
+			}
+		}
+	}
+
+	// Blocked skylinks should be rejected.
+	err = r.UpdateSkynetBlocklist([]crypto.Hash{crypto.HashObject(skylink.MerkleRoot())}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = r.SkylinkFanout(skylink, time.Minute, types.ZeroCurrency)
+	if !errors.Contains(err, ErrSkylinkBlocked) {
+		t.Fatal("expected blocked error", err)
+	}
+}
+
+// slowSkylinkWriter is a writer that sleeps on every write and records the
+// number of data sections that are buffered by the stream it is written from.
+type slowSkylinkWriter struct {
+	buf         bytes.Buffer
+	maxSections int
+	delay       time.Duration
+
+	staticID  modules.DataSourceID
+	staticSBS *streamBufferSet
+}
+
+// Write implements io.Writer.
+func (w *slowSkylinkWriter) Write(b []byte) (int, error) {
+	w.staticSBS.mu.Lock()
+	sb, exists := w.staticSBS.streams[w.staticID]
+	w.staticSBS.mu.Unlock()
+	if exists {
+		sb.mu.Lock()
+		if len(sb.dataSections) > w.maxSections {
+			w.maxSections = len(sb.dataSections)
+		}
+		sb.mu.Unlock()
+	}
+	time.Sleep(w.delay)
+	return w.buf.Write(b)
+}
+
+// TestSkykeyForSkylink verifies that SkykeyForSkylink returns the skykey an
+// encrypted skyfile was uploaded with.
+func TestSkykeyForSkylink(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	wt, err := newWorkerTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := wt.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	r := wt.rt.renter
+
+	// upload is a helper to upload a small skyfile with the given skykey.
+	upload := func(name string, sk skykey.Skykey) modules.Skylink {
+		siaPath, err := modules.SkynetFolder.Join(t.Name() + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sup := modules.SkyfileUploadParameters{
+			SiaPath:             siaPath,
+			BaseChunkRedundancy: 2,
+			Filename:            name,
+		}
+		if sk.Name != "" {
+			fsKey, err := sk.GenerateFileSpecificSubkey()
+			if err != nil {
+				t.Fatal(err)
+			}
+			sup.SkykeyName = sk.Name
+			sup.FileSpecificSkykey = fsKey
+		}
+		reader := modules.NewSkyfileReader(bytes.NewReader(fastrand.Bytes(100)), sup)
+		skylink, err := r.UploadSkyfile(sup, reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return skylink
+	}
+
+	// A plain skyfile is not encrypted.
+	plainLink := upload("plain", skykey.Skykey{})
+	_, err = r.SkykeyForSkylink(plainLink, time.Minute, types.ZeroCurrency)
+	if !errors.Contains(err, ErrSkylinkNotEncrypted) {
+		t.Fatalf("expected %v but got %v", ErrSkylinkNotEncrypted, err)
+	}
+
+	// An encrypted skyfile returns the skykey it was uploaded with.
+	sk, err := r.CreateSkykey(t.Name(), skykey.TypePrivateID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encryptedLink := upload("encrypted", sk)
+	foundKey, err := r.SkykeyForSkylink(encryptedLink, time.Minute, types.ZeroCurrency)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if foundKey.ID() != sk.ID() || foundKey.Name != sk.Name {
+		t.Fatalf("expected skykey %v (%v) but got %v (%v)", sk.Name, sk.ID(), foundKey.Name, foundKey.ID())
+	}
+
+	// Without the skykey no matching skykey is found.
+	if err := r.DeleteSkykeyByName(sk.Name); err != nil {
+		t.Fatal(err)
+	}
+	_, err = r.SkykeyForSkylink(encryptedLink, time.Minute, types.ZeroCurrency)
+	if !errors.Contains(err, ErrNoMatchingSkykey) {
+		t.Fatalf("expected %v but got %v", ErrNoMatchingSkykey, err)
+	}
+}
+
+// TestDownloadSkylinkTo verifies that DownloadSkylinkTo streams a skyfile into
+// a writer without buffering more than the stream's lookahead.
+func TestDownloadSkylinkTo(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	wt, err := newWorkerTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := wt.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	r := wt.rt.renter
+
+	// Upload a small skyfile that spans multiple data sections.
+	data := fastrand.Bytes(int(4 * skylinkDataSourceRequestSize))
+	metadata := modules.SkyfileMetadata{Filename: "file", Length: uint64(len(data))}
+	metadataBytes, err := modules.SkyfileMetadataBytes(metadata)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sl := modules.SkyfileLayout{
+		Version:      modules.SkyfileVersion,
+		Filesize:     uint64(len(data)),
+		MetadataSize: uint64(len(metadataBytes)),
+		CipherType:   crypto.TypePlain,
+	}
+	baseSector, fetchSize := modules.BuildBaseSector(sl.Encode(), nil, metadataBytes, data)
+	skylink, err := modules.NewSkylinkV1(crypto.MerkleRoot(baseSector), 0, fetchSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	siaPath, err := modules.SkynetFolder.Join(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sup := modules.SkyfileUploadParameters{
+		SiaPath:             siaPath,
+		BaseChunkRedundancy: 2,
+	}
+	err = r.managedUploadBaseSector(sup, baseSector, skylink)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Download the skyfile into a slow writer.
+	w := &slowSkylinkWriter{
+		delay:     10 * time.Millisecond,
+		staticID:  skylink.DataSourceID(),
+		staticSBS: r.staticStreamBufferSet,
+	}
+	md, n, err := r.DownloadSkylinkTo(skylink, w, time.Minute, types.ZeroCurrency)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if md.Filename != metadata.Filename {
+		t.Fatal("wrong metadata", md)
+	}
+	if n != uint64(len(data)) {
+		t.Fatalf("expected %v bytes to be written but got %v", len(data), n)
+	}
+	if !bytes.Equal(w.buf.Bytes(), data) {
+		t.Fatal("data mismatch")
+	}
+
+	// The stream should never have buffered more data sections than its LRU
+	// allows for.
+	maxSections := bytesBufferedPerStream / skylinkDataSourceRequestSize
+	if maxSections < minimumDataSections {
+		maxSections = minimumDataSections
+	}
+	if w.maxSections == 0 || uint64(w.maxSections) > maxSections {
+		t.Fatalf("expected between 1 and %v buffered data sections but got %v", maxSections, w.maxSections)
+	}
+
+	// Blocked skylinks should be rejected.
+	err = r.UpdateSkynetBlocklist([]crypto.Hash{crypto.HashObject(skylink.MerkleRoot())}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = r.DownloadSkylinkTo(skylink, w, time.Minute, types.ZeroCurrency)
+	if !errors.Contains(err, ErrSkylinkBlocked) {
+		t.Fatal("expected blocked error", err)
+	}
+}
+
+// TestDownloadSkylinkFetchSizeMismatch verifies that downloading the base
+// sector of a skylink whose fetch size doesn't match its layout fails.
+func TestDownloadSkylinkFetchSizeMismatch(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	wt, err := newWorkerTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := wt.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	r := wt.rt.renter
+
+	// Create a base sector whose layout claims a file that is larger than
+	// the fetch size of the skylink.
+	metadataBytes, err := modules.SkyfileMetadataBytes(modules.SkyfileMetadata{Filename: "file"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sl := modules.SkyfileLayout{
+		Version:      modules.SkyfileVersion,
+		Filesize:     2 * modules.SectorSize,
+		MetadataSize: uint64(len(metadataBytes)),
+		CipherType:   crypto.TypePlain,
+	}
+	data := fastrand.Bytes(100)
+	baseSector, fetchSize := modules.BuildBaseSector(sl.Encode(), nil, metadataBytes, data)
+	skylink, err := modules.NewSkylinkV1(crypto.MerkleRoot(baseSector), 0, fetchSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	siaPath, err := modules.SkynetFolder.Join(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sup := modules.SkyfileUploadParameters{
+		SiaPath:             siaPath,
+		BaseChunkRedundancy: 2,
+	}
+	err = r.managedUploadBaseSector(sup, baseSector, skylink)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The base sector can't be downloaded.
+	_, err = r.DownloadSkylinkBaseSector(skylink, time.Minute, 0, types.ZeroCurrency)
+	if !errors.Contains(err, modules.ErrSkylinkFetchSizeMismatch) {
+		t.Fatalf("expected error '%v', got '%v'", modules.ErrSkylinkFetchSizeMismatch, err)
+	}
+	// Reading the skyfile only logs the mismatch. It still fails since the
+	// filesize doesn't fit in the base sector.
+	_, _, _, err = r.DownloadSkylink(skylink, time.Minute, types.ZeroCurrency)
+	if err == nil || errors.Contains(err, modules.ErrSkylinkFetchSizeMismatch) {
+		t.Fatalf("expected download to fail without '%v', got '%v'", modules.ErrSkylinkFetchSizeMismatch, err)
+	}
+
+	// A skylink with the right fetch size can be downloaded.
+	sl.Filesize = uint64(len(data))
+	baseSector, fetchSize = modules.BuildBaseSector(sl.Encode(), nil, metadataBytes, data)
+	skylink, err = modules.NewSkylinkV1(crypto.MerkleRoot(baseSector), 0, fetchSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sup.Force = true
+	err = r.managedUploadBaseSector(sup, baseSector, skylink)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = r.DownloadSkylinkBaseSector(skylink, time.Minute, 0, types.ZeroCurrency)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestDownloadSkylinkWithBaseSector verifies that the raw base sector returned
+// alongside the stream of a skylink matches the base sector returned by
+// DownloadSkylinkBaseSector.
+func TestDownloadSkylinkWithBaseSector(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	wt, err := newWorkerTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := wt.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	r := wt.rt.renter
+
+	// Upload a small skyfile.
+	data := fastrand.Bytes(100)
+	metadata := modules.SkyfileMetadata{Filename: "file", Length: uint64(len(data))}
+	metadataBytes, err := modules.SkyfileMetadataBytes(metadata)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, baseSector, fetchSize, err := modules.BuildSmallSkyfileBaseSector(metadataBytes, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	skylink, err := modules.NewSkylinkV1(crypto.MerkleRoot(baseSector), 0, fetchSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	siaPath, err := modules.SkynetFolder.Join(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sup := modules.SkyfileUploadParameters{
+		SiaPath:             siaPath,
+		BaseChunkRedundancy: 2,
+	}
+	err = r.managedUploadBaseSector(sup, baseSector, skylink)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Fetch the base sector separately.
+	bss, err := r.DownloadSkylinkBaseSector(skylink, time.Minute, 0, types.ZeroCurrency)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := ioutil.ReadAll(bss)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Download the skylink twice, the second download is served from the
+	// stream buffer set.
+	for i := 0; i < 2; i++ {
+		_, md, streamer, rawBaseSector, err := r.DownloadSkylinkWithBaseSector(skylink, time.Minute, types.ZeroCurrency)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(rawBaseSector, expected) {
+			t.Fatal("raw base sector doesn't match the downloaded base sector")
+		}
+		if md.Filename != metadata.Filename {
+			t.Fatal("wrong metadata", md)
+		}
+		downloaded, err := ioutil.ReadAll(streamer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(downloaded, data) {
+			t.Fatal("data mismatch")
+		}
+
+		// Modifying the returned base sector shouldn't affect later
+		// downloads.
+		rawBaseSector[0]++
+		if err := streamer.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// TestRepairSkyfileBaseSector verifies that a deleted base sector can be
+// rebuilt from the metadata and the fanout siafile of a skyfile and that the
+// repaired skyfile has the original skylink.
+func TestRepairSkyfileBaseSector(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	wt, err := newWorkerTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := wt.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	r := wt.rt.renter
+
+	// Create a siafile with random piece roots to act as the fanout.
+	fanoutSiaPath, err := modules.SkynetFolder.Join(t.Name() + "-fanout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsc, err := modules.NewRSSubCode(2, 3, crypto.SegmentSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fileNode, err := r.createRenterTestFileWithParams(fanoutSiaPath, rsc, crypto.TypePlain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	numChunks := uint64(2)
+	err = fileNode.GrowNumChunks(numChunks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for chunkIndex := uint64(0); chunkIndex < numChunks; chunkIndex++ {
+		for pieceIndex := uint64(0); pieceIndex < uint64(rsc.NumPieces()); pieceIndex++ {
+			var root crypto.Hash
+			fastrand.Read(root[:])
+			err = fileNode.AddPiece(types.SiaPublicKey{}, chunkIndex, pieceIndex, root)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	// Build and upload the base sector.
+	siaPath, err := modules.SkynetFolder.Join(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sup := modules.SkyfileUploadParameters{
+		SiaPath:             siaPath,
+		BaseChunkRedundancy: 2,
+	}
+	metadata := modules.SkyfileMetadata{
+		Filename: t.Name(),
+		Mode:     modules.DefaultFilePerm,
+		Length:   fileNode.Size(),
+	}
+	baseSector, skylink, err := r.managedBuildSkyfileBaseSector(sup, metadata, fileNode, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fileNode.Close(); err != nil {
+		t.Fatal(err)
+	}
+	err = r.managedUploadBaseSector(sup, baseSector, skylink)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Delete the base sector from the renter and the host. The base sector
+	// can't be downloaded anymore afterwards.
+	err = r.DeleteFile(siaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = wt.host.DeleteSector(skylink.MerkleRoot())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wt.host.HasSector(skylink.MerkleRoot()) {
+		t.Fatal("host still has the base sector")
+	}
+	offset, fetchSize, err := skylink.OffsetAndFetchSize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = r.DownloadByRoot(skylink.MerkleRoot(), offset, fetchSize, time.Second, types.ZeroCurrency)
+	if err == nil {
+		t.Fatal("base sector shouldn't be available")
+	}
+
+	// Repairing with different metadata should fail without uploading
+	// anything.
+	wrongMetadata := metadata
+	wrongMetadata.Filename = "wrong"
+	err = r.RepairSkyfileBaseSector(sup, skylink, wrongMetadata, fanoutSiaPath)
+	if !errors.Contains(err, errSkylinkMismatch) {
+		t.Fatalf("expected %v but got %v", errSkylinkMismatch, err)
+	}
+	if _, err := r.File(siaPath); !errors.Contains(err, filesystem.ErrNotExist) {
+		t.Fatal("base sector siafile shouldn't exist", err)
+	}
+
+	// Repair the base sector.
+	err = r.RepairSkyfileBaseSector(sup, skylink, metadata, fanoutSiaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The repaired base sector should be tracked under the original skylink
+	// and have the original merkle root.
+	fi, err := r.File(siaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fi.Skylinks) != 1 || fi.Skylinks[0] != skylink.String() {
+		t.Fatal("unexpected skylinks", fi.Skylinks)
+	}
+	fi, err = r.File(fanoutSiaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fi.Skylinks) != 1 || fi.Skylinks[0] != skylink.String() {
+		t.Fatal("unexpected fanout skylinks", fi.Skylinks)
+	}
+	if !wt.host.HasSector(skylink.MerkleRoot()) {
+		t.Fatal("host doesn't have the repaired base sector")
+	}
+	data, err := r.DownloadByRoot(skylink.MerkleRoot(), offset, fetchSize, time.Minute, types.ZeroCurrency)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if crypto.MerkleRoot(data) != skylink.MerkleRoot() {
+		t.Fatal("repaired base sector has the wrong merkle root")
+	}
+}
+
+// TestCreateSkylinkFromSiafilePrecomputedFanout tests creating a skylink from
+// a siafile with a precomputed fanout.
+func TestCreateSkylinkFromSiafilePrecomputedFanout(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	wt, err := newWorkerTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := wt.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	r := wt.rt.renter
+
+	// Create a siafile with random piece roots.
+	siaPath, err := modules.SkynetFolder.Join(t.Name() + "-siafile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsc, err := modules.NewRSSubCode(2, 3, crypto.SegmentSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fileNode, err := r.createRenterTestFileWithParams(siaPath, rsc, crypto.TypePlain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	numChunks := uint64(2)
+	err = fileNode.GrowNumChunks(numChunks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for chunkIndex := uint64(0); chunkIndex < numChunks; chunkIndex++ {
+		for pieceIndex := uint64(0); pieceIndex < uint64(rsc.NumPieces()); pieceIndex++ {
+			var root crypto.Hash
+			fastrand.Read(root[:])
+			err = fileNode.AddPiece(types.SiaPublicKey{}, chunkIndex, pieceIndex, root)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	fanout, err := skyfileEncodeFanout(fileNode, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fileNode.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Determine the expected skylink without a precomputed fanout.
+	skyfilePath := func(name string) modules.SiaPath {
+		sp, err := modules.SkynetFolder.Join(t.Name() + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sp
+	}
+	sup := modules.SkyfileUploadParameters{
+		SiaPath:             skyfilePath("-dryrun"),
+		BaseChunkRedundancy: 2,
+		DryRun:              true,
+	}
+	expected, err := r.CreateSkylinkFromSiafile(sup, siaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A fanout with a wrong root should be rejected.
+	badFanout := append([]byte{}, fanout...)
+	badFanout[fastrand.Intn(len(badFanout))]++
+	sup.SiaPath = skyfilePath("-bad")
+	sup.DryRun = false
+	sup.Fanout = badFanout
+	_, err = r.CreateSkylinkFromSiafile(sup, siaPath)
+	if !errors.Contains(err, errFanoutMismatch) {
+		t.Fatalf("expected %v but got %v", errFanoutMismatch, err)
+	}
+	if _, err := r.File(sup.SiaPath); !errors.Contains(err, filesystem.ErrNotExist) {
+		t.Fatal("skyfile shouldn't exist", err)
+	}
+
+	// A fanout with a missing chunk should be rejected as well.
+	sup.Fanout = fanout[:len(fanout)/2]
+	_, err = r.CreateSkylinkFromSiafile(sup, siaPath)
+	if !errors.Contains(err, errFanoutMismatch) {
+		t.Fatalf("expected %v but got %v", errFanoutMismatch, err)
+	}
+
+	// The correct fanout should result in the expected skylink.
+	sup.SiaPath = skyfilePath("")
+	sup.Fanout = fanout
+	skylink, err := r.CreateSkylinkFromSiafile(sup, siaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if skylink != expected {
+		t.Fatalf("expected skylink %v but got %v", expected, skylink)
+	}
+	fi, err := r.File(siaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fi.Skylinks) != 1 || fi.Skylinks[0] != skylink.String() {
+		t.Fatal("unexpected skylinks", fi.Skylinks)
+	}
+}
+
+// TestRestoreSkyfileMemory verifies that restoring a large skyfile streams the
+// data instead of holding the whole file in memory.
+//
+// NOTE: the test doesn't run in parallel to keep other tests from skewing the
+// memory measurements.
+func TestRestoreSkyfileMemory(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+
+	// The data of the file is discarded instead of uploaded to make it
+	// possible to restore a file that is large enough to measure.
+	wt, err := newWorkerTesterCustomDependency(t.Name(), &dependencies.DependencyDiscardUploadStream{}, modules.ProdDependencies)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := wt.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	r := wt.rt.renter
+
+	// Build the base sector of a skyfile with as many chunks as its fanout
+	// can describe within a single sector in testing builds. The fanout needs
+	// to contain a root for every chunk of the file to pass the layout
+	// validation but since restoring a skyfile doesn't verify the fanout
+	// against the data, the roots are random.
+	numChunks := uint64(120)
+	size := numChunks * modules.SectorSize
+	sm := modules.SkyfileMetadata{
+		Filename: "file",
+		Length:   size,
+		Mode:     modules.DefaultFilePerm,
+	}
+	metadataBytes, err := modules.SkyfileMetadataBytes(sm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fanout := fastrand.Bytes(int(numChunks) * crypto.HashSize)
+	sl := modules.SkyfileLayout{
+		Version:            modules.SkyfileVersion,
+		Filesize:           size,
+		MetadataSize:       uint64(len(metadataBytes)),
+		FanoutSize:         uint64(len(fanout)),
+		FanoutDataPieces:   1,
+		FanoutParityPieces: 1,
+		CipherType:         crypto.TypePlain,
+	}
+	baseSector, fetchSize := modules.BuildBaseSector(sl.Encode(), fanout, metadataBytes, nil)
+	skylink, err := modules.NewSkylinkV1(crypto.MerkleRoot(baseSector), 0, fetchSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Stream the backup through a pipe to avoid holding it in memory.
+	pr, pw := io.Pipe()
+	backupErr := make(chan error, 1)
+	go func() {
+		data := io.LimitReader(fastrand.Reader, int64(size))
+		err := modules.BackupSkylink(skylink.String(), baseSector, data, pw)
+		backupErr <- err
+		pw.CloseWithError(err)
+	}()
+
+	// Keep track of the peak heap usage during the restore.
+	runtime.GC()
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	baseline := ms.HeapAlloc
+	peak := baseline
+	done := make(chan struct{})
+	measured := make(chan struct{})
+	go func() {
+		defer close(measured)
+		ticker := time.NewTicker(time.Millisecond)
+		defer ticker.Stop()
+		for {
+			var ms runtime.MemStats
+			runtime.ReadMemStats(&ms)
+			if ms.HeapAlloc > peak {
+				peak = ms.HeapAlloc
+			}
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	// Restore the skyfile.
+	restored, err := r.RestoreSkyfile(pr)
+	close(done)
+	<-measured
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored != skylink {
+		t.Fatalf("expected skylink %v but got %v", skylink, restored)
+	}
+	if err := <-backupErr; err != nil {
+		t.Fatal(err)
+	}
+
+	// The heap shouldn't have grown by anything close to the size of the file.
+	// The file is small enough for the fixed overhead of the restore to be
+	// noticeable, which is why up to half of its size is tolerated.
+	if peak-baseline > size/2 {
+		t.Fatalf("restore used %v bytes of memory for a file of %v bytes", peak-baseline, size)
+	}
+}
+
+// TestSkyfileMaxSubfilesSetting verifies that the maximum number of subfiles
+// of uploaded skyfiles can be configured through the renter settings.
+func TestSkyfileMaxSubfilesSetting(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	rt, err := newRenterTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := rt.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	r := rt.renter
+
+	// The default should be used initially. The settings report 0 to make
+	// sure that posting them back doesn't pin the current default.
+	settings, err := r.Settings()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if settings.SkyfileMaxSubfiles != 0 {
+		t.Fatal("unexpected max subfiles", settings.SkyfileMaxSubfiles)
+	}
+	if maxSubfiles := r.managedSkyfileMaxSubfiles(); maxSubfiles != modules.DefaultSkyfileMaxSubfiles {
+		t.Fatal("unexpected max subfiles", maxSubfiles)
+	}
+
+	// Negative values are invalid.
+	settings.SkyfileMaxSubfiles = -1
+	if err := r.SetSettings(settings); err == nil {
+		t.Fatal("negative max subfiles was accepted")
+	}
+
+	// Lower the maximum. Metadata with more subfiles is rejected.
+	settings.SkyfileMaxSubfiles = 1
+	if err := r.SetSettings(settings); err != nil {
+		t.Fatal(err)
+	}
+	md := modules.SkyfileMetadata{
+		Filename: t.Name(),
+		Length:   2,
+		Subfiles: modules.SkyfileSubfiles{
+			"a": {Filename: "a", Offset: 0, Len: 1},
+			"b": {Filename: "b", Offset: 1, Len: 1},
+		},
+	}
+	_, _, err = r.managedBuildSkyfileBaseSector(modules.SkyfileUploadParameters{}, md, nil, nil, false)
+	if !errors.Contains(err, modules.ErrTooManySubfiles) {
+		t.Fatal("expected ErrTooManySubfiles", err)
+	}
+
+	// The maximum should be persisted.
+	r, err = rt.reloadRenter(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if maxSubfiles := r.managedSkyfileMaxSubfiles(); maxSubfiles != 1 {
+		t.Fatal("unexpected max subfiles", maxSubfiles)
+	}
+
+	// 0 resets the maximum to the default.
+	settings.SkyfileMaxSubfiles = 0
+	if err := r.SetSettings(settings); err != nil {
+		t.Fatal(err)
+	}
+	if maxSubfiles := r.managedSkyfileMaxSubfiles(); maxSubfiles != modules.DefaultSkyfileMaxSubfiles {
+		t.Fatal("unexpected max subfiles", maxSubfiles)
+	}
+	settings, err = r.Settings()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if settings.SkyfileMaxSubfiles != 0 {
+		t.Fatal("unexpected max subfiles", settings.SkyfileMaxSubfiles)
+	}
+}
+
+// TestSkyfileMetadataAllowedFields verifies that the renter's allowed metadata
+// fields are enforced when uploading, downloading and restoring skyfiles.
+func TestSkyfileMetadataAllowedFields(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	wt, err := newWorkerTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := wt.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	r := wt.rt.renter
+
+	// setAllowedFields is a helper to update the allowed fields.
+	setAllowedFields := func(fields ...string) {
+		settings, err := r.Settings()
+		if err != nil {
+			t.Fatal(err)
+		}
+		settings.SkyfileMetadataAllowedFields = fields
+		if err := r.SetSettings(settings); err != nil {
+			t.Fatal(err)
+		}
+	}
+	siaPath, err := modules.SkynetFolder.Join(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sup := modules.SkyfileUploadParameters{
+		SiaPath:             siaPath,
+		BaseChunkRedundancy: 2,
+		Filename:            "file",
+		Mode:                modules.DefaultFilePerm,
+	}
+	data := fastrand.Bytes(100)
+
+	// Empty fields are rejected.
+	settings, err := r.Settings()
+	if err != nil {
+		t.Fatal(err)
+	}
+	settings.SkyfileMetadataAllowedFields = []string{""}
+	if err := r.SetSettings(settings); err == nil {
+		t.Fatal("empty field was accepted")
+	}
+
+	// Uploading a skyfile with fields that aren't allowed fails.
+	setAllowedFields("filename")
+	_, err = r.UploadSkyfile(sup, modules.NewSkyfileReader(bytes.NewReader(data), sup))
+	if !errors.Contains(err, modules.ErrUnknownSkyfileMetadataField) {
+		t.Fatalf("expected %v but got %v", modules.ErrUnknownSkyfileMetadataField, err)
+	}
+
+	// Once its fields are allowed, the upload succeeds.
+	setAllowedFields("filename", "length", "mode")
+	skylink, err := r.UploadSkyfile(sup, modules.NewSkyfileReader(bytes.NewReader(data), sup))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, streamer, err := r.DownloadSkylink(skylink, time.Minute, types.ZeroCurrency)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := streamer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Back up the skyfile to restore it later.
+	bss, err := r.DownloadSkylinkBaseSector(skylink, time.Minute, 0, types.ZeroCurrency)
+	if err != nil {
+		t.Fatal(err)
+	}
+	baseSector, err := ioutil.ReadAll(bss)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bss.Close(); err != nil {
+		t.Fatal(err)
+	}
+	var backup bytes.Buffer
+	err = modules.BackupSkylink(skylink.String(), baseSector, nil, &backup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.DeleteFile(siaPath); err != nil {
+		t.Fatal(err)
+	}
+
+	// Restricting the fields again prevents downloading and restoring the
+	// skyfile.
+	setAllowedFields("filename")
+	_, _, _, err = r.DownloadSkylink(skylink, time.Minute, types.ZeroCurrency)
+	if !errors.Contains(err, modules.ErrUnknownSkyfileMetadataField) {
+		t.Fatalf("expected %v but got %v", modules.ErrUnknownSkyfileMetadataField, err)
+	}
+	_, err = r.RestoreSkyfile(bytes.NewReader(backup.Bytes()))
+	if !errors.Contains(err, modules.ErrUnknownSkyfileMetadataField) {
+		t.Fatalf("expected %v but got %v", modules.ErrUnknownSkyfileMetadataField, err)
+	}
+
+	// Without allowed fields any field is allowed again.
+	setAllowedFields()
+	_, err = r.RestoreSkyfile(bytes.NewReader(backup.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,104 @@
+package renter
+
+import (
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/types"
+
+	"gitlab.com/NebulousLabs/errors"
+)
+
+var (
+	// errNoPriceTables is returned when the cost of a skyfile can't be
+	// estimated because there are no valid cached price tables.
+	errNoPriceTables = errors.New("no valid price tables to base the estimate on")
+)
+
+// EstimateSkyfileCost estimates the cost of uploading a skyfile of the given
+// size with the given parameters and storing it for the current allowance
+// period. The subfiles of a multipart upload are part of the metadata and
+// should be provided for those. The estimate is based on the cached price
+// tables of the workers and doesn't contact any hosts.
+func (r *Renter) EstimateSkyfileCost(sup modules.SkyfileUploadParameters, subfiles modules.SkyfileSubfiles, fileSize uint64) (modules.SkyfileCostEstimate, error) {
+	if err := r.tg.Add(); err != nil {
+		return modules.SkyfileCostEstimate{}, err
+	}
+	defer r.tg.Done()
+
+	// Collect the valid price tables of the workers.
+	var pts []modules.RPCPriceTable
+	for _, w := range r.staticWorkerPool.callWorkers() {
+		if !w.staticSupportsRHP3() {
+			continue
+		}
+		wpt := w.staticPriceTable()
+		if !wpt.staticValid() {
+			continue
+		}
+		pts = append(pts, wpt.staticPriceTable)
+	}
+	period := r.hostContractor.Allowance().Period
+	return skyfileCostEstimate(sup, subfiles, fileSize, pts, period)
+}
+
+// skyfileCostEstimate estimates the cost of uploading a skyfile of the given
+// size with the given parameters and storing it for the given period. The
+// price of a sector is the average over the given price tables.
+func skyfileCostEstimate(sup modules.SkyfileUploadParameters, subfiles modules.SkyfileSubfiles, fileSize uint64, pts []modules.RPCPriceTable, period types.BlockHeight) (modules.SkyfileCostEstimate, error) {
+	if len(pts) == 0 {
+		return modules.SkyfileCostEstimate{}, errNoPriceTables
+	}
+	skyfileEstablishDefaults(&sup)
+
+	// The base sector is uploaded using 1-of-N erasure coding, which means
+	// that every piece is a full sector.
+	estimate := modules.SkyfileCostEstimate{
+		BaseSectors: uint64(sup.BaseChunkRedundancy),
+		NumHosts:    uint64(len(pts)),
+		Period:      period,
+	}
+
+	// If the file doesn't fit in the base sector together with its metadata,
+	// it is uploaded as a fanout. Partial chunks are disabled for skyfiles,
+	// so the last chunk is padded to a full chunk.
+	metadataBytes, err := modules.SkyfileMetadataBytes(modules.SkyfileMetadata{
+		Filename:           sup.Filename,
+		Length:             fileSize,
+		Mode:               sup.Mode,
+		DefaultPath:        sup.DefaultPath,
+		DisableDefaultPath: sup.DisableDefaultPath,
+		HTTPHeaders:        sup.HTTPHeaders,
+		CreatedAt:          sup.CreatedAt,
+		Subfiles:           subfiles,
+	})
+	if err != nil {
+		return modules.SkyfileCostEstimate{}, errors.AddContext(err, "unable to estimate metadata size")
+	}
+	if fileSize+modules.SkyfileLayoutSize+uint64(len(metadataBytes)) > modules.SectorSize {
+		dataPieces, parityPieces, err := skyfileFanoutErasureParams(sup)
+		if err != nil {
+			return modules.SkyfileCostEstimate{}, err
+		}
+		chunkSize := modules.SectorSize * uint64(dataPieces)
+		estimate.FanoutChunks = fileSize / chunkSize
+		if fileSize%chunkSize != 0 {
+			estimate.FanoutChunks++
+		}
+		estimate.FanoutSectors = estimate.FanoutChunks * uint64(dataPieces+parityPieces)
+	}
+
+	// Sum up the cost of a sector for every price table and average it.
+	var storageCost, bandwidthCost, writeCost types.Currency
+	for _, pt := range pts {
+		appendCost, storeCost := modules.MDMAppendCost(&pt, period)
+		storageCost = storageCost.Add(storeCost)
+		writeCost = writeCost.Add(appendCost.Sub(storeCost))
+		bandwidthCost = bandwidthCost.Add(modules.MDMBandwidthCost(pt, modules.SectorSize, 0))
+	}
+	numSectors := estimate.BaseSectors + estimate.FanoutSectors
+	numPts := uint64(len(pts))
+	estimate.StorageCost = storageCost.Mul64(numSectors).Div64(numPts)
+	estimate.UploadBandwidthCost = bandwidthCost.Mul64(numSectors).Div64(numPts)
+	estimate.WriteCost = writeCost.Mul64(numSectors).Div64(numPts)
+	estimate.TotalCost = estimate.StorageCost.Add(estimate.UploadBandwidthCost).Add(estimate.WriteCost)
+	return estimate, nil
+}
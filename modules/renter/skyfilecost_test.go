@@ -0,0 +1,182 @@
+package renter
+
+import (
+	"testing"
+
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/types"
+	"gitlab.com/NebulousLabs/errors"
+)
+
+// TestSkyfileCostEstimate is a unit test for skyfileCostEstimate.
+func TestSkyfileCostEstimate(t *testing.T) {
+	t.Parallel()
+
+	// Create two price tables. On average a sector costs 20+2*SectorSize to
+	// write, 3*SectorSize per block to store and 4*SectorSize to upload.
+	pts := []modules.RPCPriceTable{
+		{
+			WriteBaseCost:       types.NewCurrency64(10),
+			WriteLengthCost:     types.NewCurrency64(1),
+			WriteStoreCost:      types.NewCurrency64(2),
+			UploadBandwidthCost: types.NewCurrency64(3),
+		},
+		{
+			WriteBaseCost:       types.NewCurrency64(30),
+			WriteLengthCost:     types.NewCurrency64(3),
+			WriteStoreCost:      types.NewCurrency64(4),
+			UploadBandwidthCost: types.NewCurrency64(5),
+		},
+	}
+	period := types.BlockHeight(100)
+	sup := modules.SkyfileUploadParameters{
+		Filename:            "file",
+		BaseChunkRedundancy: 3,
+		FanoutDataPieces:    2,
+		FanoutParityPieces:  4,
+	}
+
+	// checkEstimate is a helper that verifies the cost of an estimate for the
+	// given number of sectors.
+	checkEstimate := func(estimate modules.SkyfileCostEstimate, numSectors uint64) {
+		t.Helper()
+		writeCost := types.NewCurrency64(20 + 2*modules.SectorSize).Mul64(numSectors)
+		storageCost := types.NewCurrency64(3 * modules.SectorSize).Mul64(uint64(period)).Mul64(numSectors)
+		bandwidthCost := types.NewCurrency64(4 * modules.SectorSize).Mul64(numSectors)
+		if !estimate.WriteCost.Equals(writeCost) {
+			t.Errorf("expected write cost %v but got %v", writeCost, estimate.WriteCost)
+		}
+		if !estimate.StorageCost.Equals(storageCost) {
+			t.Errorf("expected storage cost %v but got %v", storageCost, estimate.StorageCost)
+		}
+		if !estimate.UploadBandwidthCost.Equals(bandwidthCost) {
+			t.Errorf("expected bandwidth cost %v but got %v", bandwidthCost, estimate.UploadBandwidthCost)
+		}
+		if !estimate.TotalCost.Equals(writeCost.Add(storageCost).Add(bandwidthCost)) {
+			t.Errorf("wrong total cost %v", estimate.TotalCost)
+		}
+		if estimate.NumHosts != uint64(len(pts)) || estimate.Period != period {
+			t.Errorf("wrong number of hosts or period %v %v", estimate.NumHosts, estimate.Period)
+		}
+	}
+
+	// A small file only consists of the base sector.
+	estimate, err := skyfileCostEstimate(sup, nil, 100, pts, period)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if estimate.BaseSectors != 3 || estimate.FanoutChunks != 0 || estimate.FanoutSectors != 0 {
+		t.Fatal("wrong number of sectors", estimate)
+	}
+	checkEstimate(estimate, 3)
+
+	// A file that spans 2 full chunks and a single byte of a third one
+	// requires 3 chunks of 6 pieces each.
+	fileSize := 2*2*modules.SectorSize + 1
+	estimate, err = skyfileCostEstimate(sup, nil, fileSize, pts, period)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if estimate.BaseSectors != 3 || estimate.FanoutChunks != 3 || estimate.FanoutSectors != 18 {
+		t.Fatal("wrong number of sectors", estimate)
+	}
+	checkEstimate(estimate, 21)
+
+	// Without price tables there is no estimate.
+	_, err = skyfileCostEstimate(sup, nil, fileSize, nil, period)
+	if !errors.Contains(err, errNoPriceTables) {
+		t.Fatal("expected errNoPriceTables", err)
+	}
+
+	// Invalid erasure coding parameters are rejected.
+	sup.FanoutParityPieces = 0
+	_, err = skyfileCostEstimate(sup, nil, fileSize, pts, period)
+	if !errors.Contains(err, errInvalidErasureParams) {
+		t.Fatal("expected errInvalidErasureParams", err)
+	}
+}
+
+// TestSkyfileCostEstimateMultipart verifies that the subfiles of a multipart
+// upload are taken into account when deciding whether a skyfile fits in its
+// base sector.
+func TestSkyfileCostEstimateMultipart(t *testing.T) {
+	t.Parallel()
+
+	pts := []modules.RPCPriceTable{{}}
+	sup := modules.SkyfileUploadParameters{
+		Filename:            "dir",
+		BaseChunkRedundancy: 3,
+		FanoutDataPieces:    1,
+		FanoutParityPieces:  2,
+	}
+
+	// Pick a file size that only just fits in the base sector together with
+	// the metadata of a single file.
+	metadataBytes, err := modules.SkyfileMetadataBytes(modules.SkyfileMetadata{
+		Filename: sup.Filename,
+		Length:   modules.SectorSize,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fileSize := modules.SectorSize - modules.SkyfileLayoutSize - uint64(len(metadataBytes))
+	estimate, err := skyfileCostEstimate(sup, nil, fileSize, pts, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if estimate.FanoutChunks != 0 {
+		t.Fatal("expected the file to fit in the base sector", estimate)
+	}
+
+	// Split the same file into the subfiles of a multipart upload. The
+	// subfile metadata no longer fits in the base sector, so a fanout is
+	// required.
+	subfiles := modules.SkyfileSubfiles{
+		"a.html": {Filename: "a.html", ContentType: "text/html", Offset: 0, Len: fileSize / 2},
+		"b.html": {Filename: "b.html", ContentType: "text/html", Offset: fileSize / 2, Len: fileSize - fileSize/2},
+	}
+	estimate, err = skyfileCostEstimate(sup, subfiles, fileSize, pts, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if estimate.FanoutChunks != 1 || estimate.FanoutSectors != 3 {
+		t.Fatal("expected the subfiles to require a fanout", estimate)
+	}
+}
+
+// TestEstimateSkyfileCost verifies that EstimateSkyfileCost uses the price
+// tables of the workers.
+func TestEstimateSkyfileCost(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	wt, err := newWorkerTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := wt.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	r := wt.rt.renter
+
+	sup := modules.SkyfileUploadParameters{Filename: "file"}
+	estimate, err := r.EstimateSkyfileCost(sup, nil, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pt := wt.staticPriceTable().staticPriceTable
+	expected, err := skyfileCostEstimate(sup, nil, 100, []modules.RPCPriceTable{pt}, r.hostContractor.Allowance().Period)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !estimate.TotalCost.Equals(expected.TotalCost) {
+		t.Fatal("estimate doesn't match price table of worker", estimate, expected)
+	}
+	if estimate.NumHosts != 1 || estimate.TotalCost.IsZero() {
+		t.Fatal("unexpected estimate", estimate)
+	}
+}
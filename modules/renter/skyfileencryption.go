@@ -14,7 +14,23 @@ import (
 	"github.com/aead/chacha20/chacha"
 )
 
-var errNoSkykeyMatchesSkyfileEncryptionID = errors.New("Unable to find matching skykey for public ID encryption")
+var (
+	errNoSkykeyMatchesSkyfileEncryptionID = errors.New("Unable to find matching skykey for public ID encryption")
+
+	// errUnsupportedCipherType is returned if a skyfile uses a cipher type
+	// that is not supported by the skyfile format.
+	errUnsupportedCipherType = errors.New("cipher type is not supported for skyfiles")
+
+	// skyfileSupportedCipherTypes is the set of cipher types skyfiles can be
+	// encrypted with. Regular uploads are either plaintext or use the cipher
+	// type of a skykey. TypeThreefish is supported for siafiles that were
+	// converted to skyfiles, see RestoreSkyfile.
+	skyfileSupportedCipherTypes = map[crypto.CipherType]struct{}{
+		crypto.TypePlain:     {},
+		crypto.TypeThreefish: {},
+		crypto.TypeXChaCha20: {},
+	}
+)
 
 // deriveFanoutKey returns the crypto.CipherKey that should be used for
 // decrypting the fanout stream from the skyfile stored using this layout.
@@ -40,6 +56,33 @@ func (r *Renter) checkSkyfileEncryptionIDMatch(encryptionIdentifier []byte, nonc
 	return skykey.Skykey{}, errNoSkykeyMatchesSkyfileEncryptionID
 }
 
+// skykeyForLayout returns the master skykey that was used to encrypt the base
+// sector with the given layout, alongside the nonce that is used for deriving
+// the file-specific skykey. Only the visible-by-default fields of the layout
+// are used, which means the layout doesn't need to be decrypted first.
+func (r *Renter) skykeyForLayout(sl modules.SkyfileLayout) (skykey.Skykey, []byte, error) {
+	// Get the nonce to be used for getting private-id skykeys, and for deriving the
+	// file-specific skykey.
+	nonce := make([]byte, chacha.XNonceSize)
+	copy(nonce[:], sl.KeyData[skykey.SkykeyIDLen:skykey.SkykeyIDLen+chacha.XNonceSize])
+
+	// Grab the key ID from the layout.
+	var keyID skykey.SkykeyID
+	copy(keyID[:], sl.KeyData[:skykey.SkykeyIDLen])
+
+	// Try to get the skykey associated with that ID.
+	masterSkykey, err := r.staticSkykeyManager.KeyByID(keyID)
+	// If the ID is unknown, use the key ID as an encryption identifier and try
+	// finding the associated skykey.
+	if errors.Contains(err, skykey.ErrNoSkykeysWithThatID) {
+		masterSkykey, err = r.checkSkyfileEncryptionIDMatch(keyID[:], nonce)
+	}
+	if err != nil {
+		return skykey.Skykey{}, nil, errors.AddContext(err, "Unable to find associated skykey")
+	}
+	return masterSkykey, nonce, nil
+}
+
 // decryptBaseSector attempts to decrypt the baseSector. If it has the necessary
 // Skykey, it will decrypt the baseSector in-place. It returns the file-specific
 // skykey to be used for decrypting the rest of the associated skyfile.
@@ -58,24 +101,10 @@ func (r *Renter) decryptBaseSector(baseSector []byte) (skykey.Skykey, error) {
 		build.Critical("Expected layout to be marked as encrypted!")
 	}
 
-	// Get the nonce to be used for getting private-id skykeys, and for deriving the
-	// file-specific skykey.
-	nonce := make([]byte, chacha.XNonceSize)
-	copy(nonce[:], sl.KeyData[skykey.SkykeyIDLen:skykey.SkykeyIDLen+chacha.XNonceSize])
-
-	// Grab the key ID from the layout.
-	var keyID skykey.SkykeyID
-	copy(keyID[:], sl.KeyData[:skykey.SkykeyIDLen])
-
-	// Try to get the skykey associated with that ID.
-	masterSkykey, err := r.staticSkykeyManager.KeyByID(keyID)
-	// If the ID is unknown, use the key ID as an encryption identifier and try
-	// finding the associated skykey.
-	if errors.Contains(err, skykey.ErrNoSkykeysWithThatID) {
-		masterSkykey, err = r.checkSkyfileEncryptionIDMatch(keyID[:], nonce)
-	}
+	// Find the master skykey and the nonce used to encrypt the base sector.
+	masterSkykey, nonce, err := r.skykeyForLayout(sl)
 	if err != nil {
-		return skykey.Skykey{}, errors.AddContext(err, "Unable to find associated skykey")
+		return skykey.Skykey{}, err
 	}
 
 	// Derive the file-specific key.
@@ -182,6 +211,24 @@ func encryptionEnabled(sup *modules.SkyfileUploadParameters) bool {
 	return sup.SkykeyName != "" || sup.SkykeyID != skykey.SkykeyID{}
 }
 
+// skyfileCipherType returns the cipher type a skyfile uploaded with the given
+// SkyfileUploadParameters is encrypted with.
+func skyfileCipherType(sup modules.SkyfileUploadParameters) crypto.CipherType {
+	if encryptionEnabled(&sup) {
+		return sup.FileSpecificSkykey.CipherType()
+	}
+	return crypto.TypePlain
+}
+
+// validateSkyfileCipherType returns an error if the given cipher type is not
+// supported for skyfiles.
+func validateSkyfileCipherType(ct crypto.CipherType) error {
+	if _, supported := skyfileSupportedCipherTypes[ct]; !supported {
+		return errors.AddContext(errUnsupportedCipherType, ct.String())
+	}
+	return nil
+}
+
 // generateCipherKey generates a Cipher Key for the FileUploadParams from the
 // SkyfileUploadParameters
 func generateCipherKey(fup *modules.FileUploadParams, sup modules.SkyfileUploadParameters) error {
@@ -395,4 +395,101 @@ func TestBaseSectorKeyID(t *testing.T) {
 		t.Log(expectedEncID, keyID2)
 		t.Fatal("Expected to find the skyfile encryption ID")
 	}
+
+	// Both layouts should resolve to the skykeys that were used to encrypt
+	// them without having to decrypt the base sectors.
+	sk, _, err := r.skykeyForLayout(encLayout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sk.ID() != publicIDKey.ID() {
+		t.Fatal("wrong skykey found for public id layout")
+	}
+	sk, _, err = r.skykeyForLayout(encLayout2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sk.ID() != privateID {
+		t.Fatal("wrong skykey found for private id layout")
+	}
+
+	// Once the skykey is deleted, it should no longer be found.
+	err = r.DeleteSkykeyByName(privateIDKeyName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = r.skykeyForLayout(encLayout2)
+	if !errors.Contains(err, errNoSkykeyMatchesSkyfileEncryptionID) {
+		t.Fatal("expected skykey lookup to fail after deleting the key", err)
+	}
+}
+
+// TestSkyfileCipherType probes the validation of the cipher types of skyfiles.
+func TestSkyfileCipherType(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	// Check the set of supported cipher types.
+	tests := []struct {
+		ct        crypto.CipherType
+		supported bool
+	}{
+		{crypto.TypePlain, true},
+		{crypto.TypeThreefish, true},
+		{crypto.TypeXChaCha20, true},
+		{crypto.TypeTwofish, false},
+		{crypto.TypeInvalid, false},
+		{crypto.CipherType{1, 2, 3}, false},
+	}
+	for _, test := range tests {
+		err := validateSkyfileCipherType(test.ct)
+		if test.supported && err != nil {
+			t.Fatalf("%v should be supported: %v", test.ct, err)
+		}
+		if !test.supported && !errors.Contains(err, errUnsupportedCipherType) {
+			t.Fatalf("expected %v for %v but got %v", errUnsupportedCipherType, test.ct, err)
+		}
+	}
+
+	// The effective cipher type of an upload is either plaintext or the one of
+	// the skykey.
+	var sup modules.SkyfileUploadParameters
+	if ct := skyfileCipherType(sup); ct != crypto.TypePlain {
+		t.Fatal("unexpected cipher type", ct)
+	}
+	sup.SkykeyName = "key"
+	sup.FileSpecificSkykey = skykey.Skykey{Name: "key", Type: skykey.TypePrivateID}
+	if ct := skyfileCipherType(sup); ct != crypto.TypeXChaCha20 {
+		t.Fatal("unexpected cipher type", ct)
+	}
+
+	// Creating a skylink from a siafile with an unsupported cipher type should
+	// fail.
+	rt, err := newRenterTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := rt.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	siaPath, rsc := testingFileParams()
+	fileNode, err := rt.renter.createRenterTestFileWithParams(siaPath, rsc, crypto.TypeTwofish)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fileNode.Close(); err != nil {
+		t.Fatal(err)
+	}
+	skyfilePath, err := modules.SkynetFolder.Join(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = rt.renter.CreateSkylinkFromSiafile(modules.SkyfileUploadParameters{SiaPath: skyfilePath}, siaPath)
+	if !errors.Contains(err, errUnsupportedCipherType) {
+		t.Fatalf("expected %v but got %v", errUnsupportedCipherType, err)
+	}
 }
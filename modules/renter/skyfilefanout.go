@@ -20,6 +20,21 @@ import (
 	"gitlab.com/NebulousLabs/errors"
 )
 
+var (
+	// errFanoutMismatch is returned if an encoded fanout doesn't match the
+	// piece roots of the file it was created from.
+	errFanoutMismatch = errors.New("fanout doesn't match the roots of the file")
+
+	// skyfileVerifyFanoutEnabled determines whether encoded fanouts are
+	// verified against the piece roots of the file before a skylink is
+	// created.
+	skyfileVerifyFanoutEnabled = build.DEBUG || build.Select(build.Var{
+		Dev:      true,
+		Standard: false,
+		Testing:  true,
+	}).(bool)
+)
+
 // skyfileEncodeFanout will create the serialized fanout for a fileNode. The
 // encoded fanout is just the list of hashes that can be used to retrieve a file
 // concatenated together, where piece 0 of chunk 0 is first, piece 1 of chunk
@@ -46,7 +61,112 @@ func skyfileEncodeFanout(fileNode *filesystem.FileNode, reader io.Reader) ([]byt
 	// If we need all the pieces, then we need to generate the encoded fanout
 	// from the reader since we cannot assume that all the parity pieces have
 	// been uploaded.
-	return skyfileEncodeFanoutFromReader(fileNode, reader)
+	return skyfileEncodeFanoutFromReader(fileNode, reader, false)
+}
+
+// skyfileEncodeFanoutBeforeUpload will create the serialized fanout for a
+// fileNode whose pieces might not have been uploaded yet. Unlike
+// skyfileEncodeFanout it always derives the piece roots from the reader, which
+// means that the reader needs to contain all of the file's data. The result is
+// identical to the fanout skyfileEncodeFanout produces once the upload is
+// complete.
+func skyfileEncodeFanoutBeforeUpload(fileNode *filesystem.FileNode, reader io.Reader) ([]byte, error) {
+	cipherType := fileNode.MasterKey().Type()
+	dataPieces := fileNode.ErasureCode().MinPieces()
+	onlyOnePieceNeeded := dataPieces == 1 && cipherType == crypto.TypePlain
+	return skyfileEncodeFanoutFromReader(fileNode, reader, onlyOnePieceNeeded)
+}
+
+// skyfileVerifyFanout re-derives the piece roots of every chunk from the
+// fileNode and compares them against the roots in the encoded fanout. Pieces
+// that the fileNode doesn't know a root for are skipped. An error is returned
+// if the fanout has an unexpected size or if any of the roots don't match.
+func skyfileVerifyFanout(fileNode *filesystem.FileNode, fanout []byte) error {
+	// Determine the number of roots per chunk in the fanout.
+	cipherType := fileNode.MasterKey().Type()
+	dataPieces := fileNode.ErasureCode().MinPieces()
+	onlyOnePieceNeeded := dataPieces == 1 && cipherType == crypto.TypePlain
+	rootsPerChunk := uint64(fileNode.ErasureCode().NumPieces())
+	if onlyOnePieceNeeded {
+		rootsPerChunk = 1
+	}
+	expectedSize := fileNode.NumChunks() * rootsPerChunk * crypto.HashSize
+	if uint64(len(fanout)) != expectedSize {
+		return errors.AddContext(errFanoutMismatch, fmt.Sprintf("expected fanout of size %v but got %v", expectedSize, len(fanout)))
+	}
+
+	// Compare the roots one chunk at a time.
+	var emptyHash crypto.Hash
+	for chunkIndex := uint64(0); chunkIndex < fileNode.NumChunks(); chunkIndex++ {
+		allPieces, err := fileNode.Pieces(chunkIndex)
+		if err != nil {
+			return errors.AddContext(err, "unable to get sector roots from file")
+		}
+		for pieceIndex, pieceSet := range allPieces {
+			// In the special case of 1-of-N files every piece of a chunk is
+			// encoded as the chunk's single root.
+			fanoutIndex := chunkIndex*rootsPerChunk + uint64(pieceIndex)
+			if onlyOnePieceNeeded {
+				fanoutIndex = chunkIndex
+			}
+			var fanoutRoot crypto.Hash
+			copy(fanoutRoot[:], fanout[fanoutIndex*crypto.HashSize:])
+			for _, piece := range pieceSet {
+				if piece.MerkleRoot == emptyHash || piece.MerkleRoot == fanoutRoot {
+					continue
+				}
+				return errors.AddContext(errFanoutMismatch, fmt.Sprintf("root of piece %v of chunk %v is %v but fanout contains %v", pieceIndex, chunkIndex, piece.MerkleRoot, fanoutRoot))
+			}
+		}
+	}
+	return nil
+}
+
+// skyfileValidatePrecomputedFanout checks whether a precomputed fanout can be
+// used for the fileNode instead of encoding a new one. On top of the checks of
+// skyfileVerifyFanout, it requires every chunk of the fanout to contain enough
+// roots that are confirmed by the fileNode's pieces to recover the chunk.
+// Otherwise a wrong fanout could result in a skylink that can't be downloaded.
+func skyfileValidatePrecomputedFanout(fileNode *filesystem.FileNode, fanout []byte) error {
+	err := skyfileVerifyFanout(fileNode, fanout)
+	if err != nil {
+		return err
+	}
+
+	// Count the confirmed roots of every chunk.
+	cipherType := fileNode.MasterKey().Type()
+	dataPieces := fileNode.ErasureCode().MinPieces()
+	onlyOnePieceNeeded := dataPieces == 1 && cipherType == crypto.TypePlain
+	rootsPerChunk := uint64(fileNode.ErasureCode().NumPieces())
+	if onlyOnePieceNeeded {
+		rootsPerChunk = 1
+	}
+	var emptyHash crypto.Hash
+	for chunkIndex := uint64(0); chunkIndex < fileNode.NumChunks(); chunkIndex++ {
+		allPieces, err := fileNode.Pieces(chunkIndex)
+		if err != nil {
+			return errors.AddContext(err, "unable to get sector roots from file")
+		}
+		confirmed := 0
+		for pieceIndex, pieceSet := range allPieces {
+			fanoutIndex := chunkIndex*rootsPerChunk + uint64(pieceIndex)
+			if onlyOnePieceNeeded {
+				fanoutIndex = chunkIndex
+			}
+			var fanoutRoot crypto.Hash
+			copy(fanoutRoot[:], fanout[fanoutIndex*crypto.HashSize:])
+			for _, piece := range pieceSet {
+				if piece.MerkleRoot != emptyHash && piece.MerkleRoot == fanoutRoot {
+					confirmed++
+					break
+				}
+			}
+		}
+		if confirmed < dataPieces {
+			return errors.AddContext(errFanoutMismatch, fmt.Sprintf("only %v of the %v roots required to recover chunk %v are confirmed by the file", confirmed, dataPieces, chunkIndex))
+		}
+	}
+	return nil
 }
 
 // skyfileEncodeFanoutFromFileNode will create the serialized fanout for
@@ -120,8 +240,9 @@ func skyfileEncodeFanoutFromFileNode(fileNode *filesystem.FileNode, onePiece boo
 // a fileNode. The encoded fanout is just the list of hashes that can be used to
 // retrieve a file concatenated together, where piece 0 of chunk 0 is first,
 // piece 1 of chunk 0 is second, etc. The full set of erasure coded pieces are
-// included.
-func skyfileEncodeFanoutFromReader(fileNode *filesystem.FileNode, reader io.Reader) ([]byte, error) {
+// included, unless onePiece is set, in which case only the first piece of each
+// chunk is included.
+func skyfileEncodeFanoutFromReader(fileNode *filesystem.FileNode, reader io.Reader, onePiece bool) ([]byte, error) {
 	// Safety check
 	if reader == nil {
 		err := errors.New("skyfileEncodeFanoutFromReader called with nil reader")
@@ -150,6 +271,9 @@ func skyfileEncodeFanoutFromReader(fileNode *filesystem.FileNode, reader io.Read
 			// mean that an emptyHash is a valid MerkleRoot and a host should be
 			// able to return the corresponding data.
 			fanout = append(fanout, root[:]...)
+			if onePiece {
+				break
+			}
 		}
 	}
 	return fanout, nil
@@ -1,12 +1,19 @@
 package renter
 
 import (
+	"bytes"
+	"encoding/json"
 	"io"
+	"reflect"
 	"strings"
 	"testing"
 
 	"gitlab.com/NebulousLabs/Sia/crypto"
+	"gitlab.com/NebulousLabs/Sia/modules"
 	"gitlab.com/NebulousLabs/Sia/modules/renter/filesystem"
+	"gitlab.com/NebulousLabs/Sia/types"
+	"gitlab.com/NebulousLabs/errors"
+	"gitlab.com/NebulousLabs/fastrand"
 )
 
 // TestSkyfileFanout probes the fanout encoding.
@@ -29,6 +36,9 @@ func TestSkyfileFanout(t *testing.T) {
 
 	t.Run("Panics", func(t *testing.T) { testSkyfileEncodeFanout_Panic(t, rt) })
 	t.Run("Reader", func(t *testing.T) { testSkyfileEncodeFanout_Reader(t, rt) })
+	t.Run("Verify", func(t *testing.T) { testSkyfileVerifyFanout(t, rt) })
+	t.Run("ValidatePrecomputed", func(t *testing.T) { testSkyfileValidatePrecomputedFanout(t, rt) })
+	t.Run("Decode", func(t *testing.T) { testSkyfileDecodeFanout(t, rt) })
 }
 
 // testSkyfileEncodeFanout_Panic probes the panic conditions for generating the
@@ -105,3 +115,186 @@ func testSkyfileEncodeFanout_Reader(t *testing.T, rt *renterTester) {
 		t.Fatal(err)
 	}
 }
+
+// testSkyfileVerifyFanout probes verifying an encoded fanout against the piece
+// roots of a file.
+func testSkyfileVerifyFanout(t *testing.T, rt *renterTester) {
+	// Create a file with N-of-M erasure coding and a non PlainText cipher type
+	siaPath, rsc := testingFileParamsCustom(2, 3)
+	file, err := rt.renter.createRenterTestFileWithParams(siaPath, rsc, crypto.TypeDefaultRenter)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Encode the fanout from some random data and add the resulting roots to
+	// the file as if the data had been uploaded.
+	data := fastrand.Bytes(int(file.ChunkSize()))
+	fanout, err := skyfileEncodeFanout(file, bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for pieceIndex := 0; pieceIndex < rsc.NumPieces(); pieceIndex++ {
+		var root crypto.Hash
+		copy(root[:], fanout[pieceIndex*crypto.HashSize:])
+		err = file.AddPiece(types.SiaPublicKey{}, 0, uint64(pieceIndex), root)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The fanout should pass verification.
+	err = skyfileVerifyFanout(file, fanout)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A fanout encoded from a corrupted reader should fail verification.
+	corrupted := append([]byte{}, data...)
+	corrupted[fastrand.Intn(len(corrupted))]++
+	badFanout, err := skyfileEncodeFanout(file, bytes.NewReader(corrupted))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = skyfileVerifyFanout(file, badFanout)
+	if !errors.Contains(err, errFanoutMismatch) {
+		t.Fatalf("expected %v but got %v", errFanoutMismatch, err)
+	}
+
+	// A truncated fanout should fail verification as well.
+	err = skyfileVerifyFanout(file, fanout[:len(fanout)-crypto.HashSize])
+	if !errors.Contains(err, errFanoutMismatch) {
+		t.Fatalf("expected %v but got %v", errFanoutMismatch, err)
+	}
+}
+
+// testSkyfileValidatePrecomputedFanout probes validating a precomputed fanout
+// against every chunk of a file.
+func testSkyfileValidatePrecomputedFanout(t *testing.T, rt *renterTester) {
+	// Create a file with multiple chunks and add random roots to all of its
+	// pieces.
+	siaPath, rsc := testingFileParamsCustom(2, 3)
+	file, err := rt.renter.createRenterTestFileWithParams(siaPath, rsc, crypto.TypeDefaultRenter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	numChunks := uint64(16)
+	err = file.GrowNumChunks(numChunks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for chunkIndex := uint64(0); chunkIndex < numChunks; chunkIndex++ {
+		for pieceIndex := uint64(0); pieceIndex < uint64(rsc.NumPieces()); pieceIndex++ {
+			var root crypto.Hash
+			fastrand.Read(root[:])
+			err = file.AddPiece(types.SiaPublicKey{}, chunkIndex, pieceIndex, root)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	fanout, err := skyfileEncodeFanout(file, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The fanout should be valid.
+	err = skyfileValidatePrecomputedFanout(file, fanout)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A wrong root in any of the chunks is caught.
+	rootsPerChunk := len(fanout) / int(numChunks)
+	for chunkIndex := 0; chunkIndex < int(numChunks); chunkIndex++ {
+		badFanout := append([]byte{}, fanout...)
+		badFanout[chunkIndex*rootsPerChunk+fastrand.Intn(rootsPerChunk)]++
+		err = skyfileValidatePrecomputedFanout(file, badFanout)
+		if !errors.Contains(err, errFanoutMismatch) {
+			t.Fatalf("expected %v for chunk %v but got %v", errFanoutMismatch, chunkIndex, err)
+		}
+	}
+
+	// A fanout of the wrong size is rejected.
+	err = skyfileValidatePrecomputedFanout(file, fanout[:len(fanout)-crypto.HashSize])
+	if !errors.Contains(err, errFanoutMismatch) {
+		t.Fatalf("expected %v but got %v", errFanoutMismatch, err)
+	}
+}
+
+// testSkyfileDecodeFanout probes decoding an encoded fanout into its
+// structured representation.
+func testSkyfileDecodeFanout(t *testing.T, rt *renterTester) {
+	// checkRoundTrip is a helper that adds random roots to the pieces of the
+	// file, encodes the fanout and verifies that decoding it results in the
+	// roots of the file.
+	checkRoundTrip := func(dataPieces, parityPieces int, ct crypto.CipherType) {
+		t.Helper()
+		siaPath, rsc := testingFileParamsCustom(dataPieces, parityPieces)
+		file, err := rt.renter.createRenterTestFileWithParams(siaPath, rsc, ct)
+		if err != nil {
+			t.Fatal(err)
+		}
+		onePiece := dataPieces == 1 && ct == crypto.TypePlain
+		expected := make([][]crypto.Hash, file.NumChunks())
+		for chunkIndex := uint64(0); chunkIndex < file.NumChunks(); chunkIndex++ {
+			// The pieces of an unencrypted 1-of-N chunk are identical.
+			var root crypto.Hash
+			fastrand.Read(root[:])
+			for pieceIndex := 0; pieceIndex < rsc.NumPieces(); pieceIndex++ {
+				if !onePiece {
+					fastrand.Read(root[:])
+				}
+				err = file.AddPiece(types.SiaPublicKey{}, chunkIndex, uint64(pieceIndex), root)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !onePiece || pieceIndex == 0 {
+					expected[chunkIndex] = append(expected[chunkIndex], root)
+				}
+			}
+		}
+		fanoutBytes, err := skyfileEncodeFanoutFromFileNode(file, onePiece)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Decode the fanout.
+		sl := modules.SkyfileLayout{
+			FanoutDataPieces:   uint8(dataPieces),
+			FanoutParityPieces: uint8(parityPieces),
+			CipherType:         ct,
+		}
+		fanout, err := modules.DecodeSkyfileFanout(fanoutBytes, sl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fanout.DataPieces != sl.FanoutDataPieces || fanout.ParityPieces != sl.FanoutParityPieces || fanout.CipherType != ct {
+			t.Fatal("wrong fanout parameters", fanout)
+		}
+		if !reflect.DeepEqual(fanout.ChunkRoots, expected) {
+			t.Fatal("decoded roots don't match the roots of the file")
+		}
+
+		// The fanout should survive a JSON round trip.
+		b, err := json.Marshal(fanout)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var decoded modules.SkyfileFanout
+		err = json.Unmarshal(b, &decoded)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(decoded, fanout) {
+			t.Fatal("fanout doesn't match after JSON round trip")
+		}
+
+		// A truncated fanout can't be decoded.
+		_, err = modules.DecodeSkyfileFanout(fanoutBytes[:len(fanoutBytes)-1], sl)
+		if err == nil {
+			t.Fatal("expected truncated fanout to fail decoding")
+		}
+	}
+	checkRoundTrip(2, 3, crypto.TypeDefaultRenter)
+	checkRoundTrip(1, 3, crypto.TypePlain)
+}
@@ -0,0 +1,86 @@
+package renter
+
+// skyfilehosts.go selects the hosts of a base sector by consistent hashing.
+// Since the pieces of a base sector all share the same Merkle root, the root
+// can be used to rank the hosts. Every host is scored by hashing the root
+// together with the host's public key and the hosts with the highest scores
+// are preferred. As a result the same root always maps to the same set of
+// hosts, and if one of them becomes unavailable only that host is replaced by
+// the next one in the ranking.
+
+import (
+	"bytes"
+	"sort"
+
+	"gitlab.com/NebulousLabs/Sia/crypto"
+	"gitlab.com/NebulousLabs/Sia/types"
+)
+
+// rankBaseSectorHosts sorts the hosts by their consistent hashing score for
+// the given base sector root, starting with the most preferred host.
+func rankBaseSectorHosts(root crypto.Hash, hosts []types.SiaPublicKey) []types.SiaPublicKey {
+	type scoredHost struct {
+		score crypto.Hash
+		host  types.SiaPublicKey
+	}
+	scored := make([]scoredHost, 0, len(hosts))
+	for _, host := range hosts {
+		scored = append(scored, scoredHost{
+			score: crypto.HashAll(root, host),
+			host:  host,
+		})
+	}
+	sort.Slice(scored, func(i, j int) bool {
+		return bytes.Compare(scored[i].score[:], scored[j].score[:]) > 0
+	})
+	ranked := make([]types.SiaPublicKey, 0, len(scored))
+	for _, sh := range scored {
+		ranked = append(ranked, sh.host)
+	}
+	return ranked
+}
+
+// managedBaseSectorHosts returns the n preferred hosts for the base sector
+// with the given root. Only hosts with a worker that is currently able to
+// upload are considered, which means that unavailable hosts are skipped in
+// favor of the next hosts in the ranking.
+func (r *Renter) managedBaseSectorHosts(root crypto.Hash, n int) []types.SiaPublicKey {
+	var hosts []types.SiaPublicKey
+	for _, w := range r.staticWorkerPool.callWorkers() {
+		if !w.staticCache().staticContractUtility.GoodForUpload {
+			continue
+		}
+		w.mu.Lock()
+		onCooldown, _ := w.onUploadCooldown()
+		uploadTerminated := w.uploadTerminated
+		w.mu.Unlock()
+		if onCooldown || uploadTerminated {
+			continue
+		}
+		hosts = append(hosts, w.staticHostPubKey)
+	}
+	ranked := rankBaseSectorHosts(root, hosts)
+	if len(ranked) > n {
+		ranked = ranked[:n]
+	}
+	return ranked
+}
+
+// preferredUploadHosts restricts the hosts of an upload to the preferred
+// hosts. If fewer than numPieces of the preferred hosts are available, all
+// hosts are returned to not prevent the upload from reaching full redundancy.
+func preferredUploadHosts(hosts map[string]struct{}, preferred []types.SiaPublicKey, numPieces int) map[string]struct{} {
+	if len(preferred) == 0 {
+		return hosts
+	}
+	preferredHosts := make(map[string]struct{}, len(preferred))
+	for _, pk := range preferred {
+		if _, exists := hosts[pk.String()]; exists {
+			preferredHosts[pk.String()] = struct{}{}
+		}
+	}
+	if len(preferredHosts) < numPieces {
+		return hosts
+	}
+	return preferredHosts
+}
@@ -0,0 +1,199 @@
+package renter
+
+import (
+	"bytes"
+	"testing"
+
+	"gitlab.com/NebulousLabs/Sia/crypto"
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/types"
+	"gitlab.com/NebulousLabs/fastrand"
+)
+
+// TestRankBaseSectorHosts verifies that the hosts of a base sector are
+// selected deterministically for a fixed root.
+func TestRankBaseSectorHosts(t *testing.T) {
+	t.Parallel()
+
+	// Create some hosts.
+	var hosts []types.SiaPublicKey
+	for i := 0; i < 10; i++ {
+		hosts = append(hosts, types.SiaPublicKey{
+			Algorithm: types.SignatureEd25519,
+			Key:       fastrand.Bytes(crypto.PublicKeySize),
+		})
+	}
+	root := crypto.HashBytes([]byte("root"))
+
+	// The ranking should be the same for the same root, independent of the
+	// order of the hosts.
+	ranked := rankBaseSectorHosts(root, hosts)
+	if len(ranked) != len(hosts) {
+		t.Fatal("wrong number of hosts", len(ranked))
+	}
+	shuffled := append([]types.SiaPublicKey{}, hosts...)
+	fastrand.Shuffle(len(shuffled), func(i, j int) {
+		shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+	})
+	for i, host := range rankBaseSectorHosts(root, shuffled) {
+		if !host.Equals(ranked[i]) {
+			t.Fatalf("ranking differs at index %v", i)
+		}
+	}
+
+	// A different root should result in a different ranking.
+	otherRoot := crypto.HashBytes([]byte("other root"))
+	otherRanked := rankBaseSectorHosts(otherRoot, hosts)
+	same := true
+	for i := range otherRanked {
+		same = same && otherRanked[i].Equals(ranked[i])
+	}
+	if same {
+		t.Fatal("expected different ranking for different root")
+	}
+
+	// Removing the most preferred host should only shift the ranking.
+	var remaining []types.SiaPublicKey
+	for _, host := range hosts {
+		if !host.Equals(ranked[0]) {
+			remaining = append(remaining, host)
+		}
+	}
+	for i, host := range rankBaseSectorHosts(root, remaining) {
+		if !host.Equals(ranked[i+1]) {
+			t.Fatalf("ranking differs at index %v after removing a host", i)
+		}
+	}
+}
+
+// TestPreferredUploadHosts is a unit test for preferredUploadHosts.
+func TestPreferredUploadHosts(t *testing.T) {
+	t.Parallel()
+
+	var pks []types.SiaPublicKey
+	hosts := make(map[string]struct{})
+	for i := 0; i < 5; i++ {
+		pk := types.SiaPublicKey{
+			Algorithm: types.SignatureEd25519,
+			Key:       fastrand.Bytes(crypto.PublicKeySize),
+		}
+		pks = append(pks, pk)
+		hosts[pk.String()] = struct{}{}
+	}
+	unknown := types.SiaPublicKey{
+		Algorithm: types.SignatureEd25519,
+		Key:       fastrand.Bytes(crypto.PublicKeySize),
+	}
+
+	// Without preferred hosts all hosts are used.
+	if len(preferredUploadHosts(hosts, nil, 2)) != len(hosts) {
+		t.Fatal("expected all hosts")
+	}
+
+	// With enough preferred hosts only those are used.
+	preferred := preferredUploadHosts(hosts, []types.SiaPublicKey{pks[0], pks[3]}, 2)
+	if len(preferred) != 2 {
+		t.Fatal("expected 2 hosts", len(preferred))
+	}
+	_, exists0 := preferred[pks[0].String()]
+	_, exists3 := preferred[pks[3].String()]
+	if !exists0 || !exists3 {
+		t.Fatal("wrong hosts selected")
+	}
+
+	// If a preferred host is unknown, the upload falls back to all hosts.
+	preferred = preferredUploadHosts(hosts, []types.SiaPublicKey{pks[0], unknown}, 2)
+	if len(preferred) != len(hosts) {
+		t.Fatal("expected fallback to all hosts", len(preferred))
+	}
+}
+
+// TestUploadBaseSectorConsistentHosts verifies that a base sector uploaded
+// with ConsistentBaseSectorHosts is uploaded to the preferred hosts.
+func TestUploadBaseSectorConsistentHosts(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	wt, err := newWorkerTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := wt.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	r := wt.rt.renter
+
+	// Create a base sector.
+	siaPath, err := modules.SkynetFolder.Join(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sup := modules.SkyfileUploadParameters{
+		SiaPath:                   siaPath,
+		Filename:                  "file",
+		Mode:                      modules.DefaultFilePerm,
+		BaseChunkRedundancy:       2,
+		ConsistentBaseSectorHosts: true,
+	}
+	data := fastrand.Bytes(100)
+	metadataBytes, err := modules.SkyfileMetadataBytes(modules.SkyfileMetadata{
+		Filename: sup.Filename,
+		Length:   uint64(len(data)),
+		Mode:     sup.Mode,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sl := modules.SkyfileLayout{
+		Version:      modules.SkyfileVersion,
+		Filesize:     uint64(len(data)),
+		MetadataSize: uint64(len(metadataBytes)),
+		CipherType:   crypto.TypePlain,
+	}
+	baseSector, fetchSize := modules.BuildBaseSector(sl.Encode(), nil, metadataBytes, data)
+	root := crypto.MerkleRoot(baseSector)
+	skylink, err := modules.NewSkylinkV1(root, 0, fetchSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The selection is deterministic and only contains the single host of
+	// the tester.
+	hosts := r.managedBaseSectorHosts(root, 2)
+	if len(hosts) != 1 || !hosts[0].Equals(wt.staticHostPubKey) {
+		t.Fatal("unexpected hosts", hosts)
+	}
+
+	// Since there are fewer preferred hosts than pieces, the upload falls
+	// back to all hosts and succeeds.
+	err = r.managedUploadBaseSector(sup, baseSector, skylink)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fileNode, err := r.staticFileSystem.OpenSiaFile(siaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := fileNode.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	pieces, err := fileNode.Pieces(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var uploaded bool
+	for _, pieceSet := range pieces {
+		for _, piece := range pieceSet {
+			uploaded = uploaded || bytes.Equal(piece.HostPubKey.Key, wt.staticHostPubKey.Key)
+		}
+	}
+	if !uploaded {
+		t.Fatal("base sector wasn't uploaded to the preferred host")
+	}
+}
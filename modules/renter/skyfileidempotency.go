@@ -0,0 +1,277 @@
+package renter
+
+// skyfileidempotency.go keeps track of the idempotency keys of skyfile
+// uploads. A client that doesn't know whether an upload succeeded, e.g.
+// because of a network error, can retry the upload with the same key and
+// receive the skylink of the earlier upload instead of paying the hosts to
+// upload the same data again. A retry needs to use the same siapath, upload
+// parameters and data as the original upload.
+
+import (
+	"context"
+	"encoding/json"
+	"hash"
+	"io"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"gitlab.com/NebulousLabs/errors"
+
+	"gitlab.com/NebulousLabs/Sia/build"
+	"gitlab.com/NebulousLabs/Sia/crypto"
+	"gitlab.com/NebulousLabs/Sia/modules"
+)
+
+var (
+	// ErrSkyfileIdempotencyKeyMismatch is returned when an upload reuses the
+	// idempotency key of an earlier upload with a different siapath, different
+	// upload parameters or different data.
+	ErrSkyfileIdempotencyKeyMismatch = errors.New("idempotency key was used by an upload with a different siapath, parameters or data")
+
+	// defaultSkyfileIdempotencyKeyExpiry is the default amount of time the
+	// renter remembers the skylink of an upload that was made with an
+	// idempotency key. It is used if the renter's settings don't specify one.
+	defaultSkyfileIdempotencyKeyExpiry = build.Select(build.Var{
+		Dev:      time.Hour,
+		Standard: 24 * time.Hour,
+		Testing:  time.Minute,
+	}).(time.Duration)
+
+	// maxSkyfileIdempotencyEntries is the maximum number of uploads the
+	// renter remembers the skylinks of. Once the cache is full, the oldest
+	// entries are evicted before they expire.
+	maxSkyfileIdempotencyEntries = build.Select(build.Var{
+		Dev:      1000,
+		Standard: 10000,
+		Testing:  10,
+	}).(int)
+)
+
+type (
+	// skyfileIdempotencyCache maps the idempotency keys of recent skyfile
+	// uploads to the resulting skylinks.
+	skyfileIdempotencyCache struct {
+		// entries holds the cached uploads by key while queue holds the keys
+		// in the order they were added. Since the expiry can change between
+		// uploads, the queue is only roughly sorted by expiry which is why the
+		// expiry of an entry is checked again when it is retrieved.
+		entries map[string]skyfileIdempotencyEntry
+		queue   []skyfileIdempotencyQueueItem
+
+		mu sync.Mutex
+	}
+
+	// skyfileIdempotencyEntry is the result of an upload that was made with
+	// an idempotency key. It contains the siapath of the upload as well as
+	// digests of its parameters and content to make sure that a retry is
+	// actually the same upload.
+	skyfileIdempotencyEntry struct {
+		expiry        time.Time
+		siaPath       modules.SiaPath
+		paramsDigest  crypto.Hash
+		contentDigest crypto.Hash
+		skylink       modules.Skylink
+	}
+
+	// skyfileIdempotencyReader wraps the reader of an upload with an
+	// idempotency key to compute the digest of its content. Data that is
+	// handed back to the reader using AddReadBuffer is only hashed once.
+	skyfileIdempotencyReader struct {
+		modules.SkyfileUploadReader
+
+		hasher  hash.Hash
+		numSkip int
+	}
+
+	// skyfileIdempotencyQueueItem is an element of the expiry queue of the
+	// cache.
+	skyfileIdempotencyQueueItem struct {
+		expiry time.Time
+		key    string
+	}
+)
+
+// newSkyfileIdempotencyCache returns a new, empty cache.
+func newSkyfileIdempotencyCache() *skyfileIdempotencyCache {
+	return &skyfileIdempotencyCache{
+		entries: make(map[string]skyfileIdempotencyEntry),
+	}
+}
+
+// callGet returns the cached upload for the given key, if it exists and
+// hasn't expired yet.
+func (c *skyfileIdempotencyCache) callGet(key string) (skyfileIdempotencyEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pruneExpired()
+	entry, exists := c.entries[key]
+	if !exists || !entry.expiry.After(time.Now()) {
+		return skyfileIdempotencyEntry{}, false
+	}
+	return entry, true
+}
+
+// callRemove removes the cached upload for the given key.
+func (c *skyfileIdempotencyCache) callRemove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, key)
+}
+
+// callSet caches the result of an upload for the given key until the given
+// duration has passed.
+func (c *skyfileIdempotencyCache) callSet(key string, entry skyfileIdempotencyEntry, duration time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pruneExpired()
+	if _, exists := c.entries[key]; !exists {
+		c.evictOldest()
+	}
+	expiry := time.Now().Add(duration)
+	entry.expiry = expiry
+	c.entries[key] = entry
+	c.queue = append(c.queue, skyfileIdempotencyQueueItem{
+		expiry: expiry,
+		key:    key,
+	})
+}
+
+// pruneExpired removes all expired entries from the cache.
+func (c *skyfileIdempotencyCache) pruneExpired() {
+	now := time.Now()
+	for len(c.queue) > 0 && !c.queue[0].expiry.After(now) {
+		item := c.queue[0]
+		c.queue = c.queue[1:]
+		// The key might have been set again after this item was queued, in
+		// which case the entry has a later expiry and needs to be kept.
+		entry, exists := c.entries[item.key]
+		if exists && !entry.expiry.After(now) {
+			delete(c.entries, item.key)
+		}
+	}
+}
+
+// evictOldest removes the oldest entries from the cache until there is room
+// for another one.
+func (c *skyfileIdempotencyCache) evictOldest() {
+	for len(c.entries) >= maxSkyfileIdempotencyEntries && len(c.queue) > 0 {
+		item := c.queue[0]
+		c.queue = c.queue[1:]
+		// Only the most recent item of a key belongs to its entry.
+		entry, exists := c.entries[item.key]
+		if exists && entry.expiry.Equal(item.expiry) {
+			delete(c.entries, item.key)
+		}
+	}
+}
+
+// newSkyfileIdempotencyReader wraps the given reader in a
+// skyfileIdempotencyReader.
+func newSkyfileIdempotencyReader(reader modules.SkyfileUploadReader) *skyfileIdempotencyReader {
+	return &skyfileIdempotencyReader{
+		SkyfileUploadReader: reader,
+		hasher:              crypto.NewHash(),
+	}
+}
+
+// AddReadBuffer implements the modules.SkyfileUploadReader interface.
+func (ir *skyfileIdempotencyReader) AddReadBuffer(data []byte) {
+	ir.numSkip += len(data)
+	ir.SkyfileUploadReader.AddReadBuffer(data)
+}
+
+// Read implements the io.Reader interface.
+func (ir *skyfileIdempotencyReader) Read(p []byte) (int, error) {
+	n, err := ir.SkyfileUploadReader.Read(p)
+	read := p[:n]
+	if ir.numSkip > 0 {
+		skip := ir.numSkip
+		if skip > n {
+			skip = n
+		}
+		read = read[skip:]
+		ir.numSkip -= skip
+	}
+	_, _ = ir.hasher.Write(read)
+	return n, err
+}
+
+// digest returns the digest of the content of the upload which covers the data
+// as well as the metadata of the upload. It needs to be called once the reader
+// was read until EOF.
+func (ir *skyfileIdempotencyReader) digest() (crypto.Hash, error) {
+	metadata, err := ir.SkyfileMetadata(context.Background())
+	if err != nil {
+		return crypto.Hash{}, errors.AddContext(err, "unable to get skyfile metadata")
+	}
+	metadataBytes, err := json.Marshal(metadata)
+	if err != nil {
+		return crypto.Hash{}, errors.AddContext(err, "unable to marshal skyfile metadata")
+	}
+	var dataDigest crypto.Hash
+	copy(dataDigest[:], ir.hasher.Sum(nil))
+	return crypto.HashAll(dataDigest, metadataBytes), nil
+}
+
+// skyfileIdempotencyParamsDigest returns the digest of the upload parameters
+// that influence the resulting skyfile and therefore need to match between an
+// upload and its retries. The parameters of the metadata are covered by the
+// content digest instead.
+func skyfileIdempotencyParamsDigest(sup modules.SkyfileUploadParameters) crypto.Hash {
+	return crypto.HashAll(sup.Root, sup.BaseChunkRedundancy, sup.FanoutDataPieces, sup.FanoutParityPieces, sup.SkykeyName, sup.SkykeyID, sup.TTL)
+}
+
+// managedCachedIdempotentUpload returns the skylink of an earlier upload with
+// the same idempotency key, as long as its siafile still exists. If the
+// skylink was blocked since it was uploaded, ErrSkylinkBlocked is returned. If
+// the upload doesn't match the earlier one, ErrSkyfileIdempotencyKeyMismatch
+// is returned. Verifying the content requires reading the whole reader.
+func (r *Renter) managedCachedIdempotentUpload(sup modules.SkyfileUploadParameters, reader modules.SkyfileUploadReader) (modules.Skylink, bool, error) {
+	entry, exists := r.staticSkyfileIdempotencyCache.callGet(sup.IdempotencyKey)
+	if !exists {
+		return modules.Skylink{}, false, nil
+	}
+	if r.staticSkynetBlocklist.IsBlocked(entry.skylink) {
+		r.staticSkyfileIdempotencyCache.callRemove(sup.IdempotencyKey)
+		return modules.Skylink{}, false, ErrSkylinkBlocked
+	}
+	// If the siafile was deleted in the meantime, the data needs to be
+	// uploaded again.
+	fileExists, err := r.staticFileSystem.FileExists(entry.siaPath)
+	if err != nil || !fileExists {
+		r.staticSkyfileIdempotencyCache.callRemove(sup.IdempotencyKey)
+		return modules.Skylink{}, false, nil
+	}
+	// Make sure the retry is the same upload.
+	if !entry.siaPath.Equals(sup.SiaPath) {
+		return modules.Skylink{}, false, errors.AddContext(ErrSkyfileIdempotencyKeyMismatch, "siapath doesn't match")
+	}
+	if entry.paramsDigest != skyfileIdempotencyParamsDigest(sup) {
+		return modules.Skylink{}, false, errors.AddContext(ErrSkyfileIdempotencyKeyMismatch, "upload parameters don't match")
+	}
+	ir := newSkyfileIdempotencyReader(reader)
+	_, err = io.Copy(ioutil.Discard, ir)
+	if err != nil {
+		return modules.Skylink{}, false, errors.AddContext(err, "unable to read skyfile data")
+	}
+	contentDigest, err := ir.digest()
+	if err != nil {
+		return modules.Skylink{}, false, err
+	}
+	if entry.contentDigest != contentDigest {
+		return modules.Skylink{}, false, errors.AddContext(ErrSkyfileIdempotencyKeyMismatch, "content doesn't match")
+	}
+	return entry.skylink, true, nil
+}
+
+// managedSkyfileIdempotencyKeyExpiry returns the amount of time the renter
+// remembers the skylink of an upload that was made with an idempotency key.
+func (r *Renter) managedSkyfileIdempotencyKeyExpiry() time.Duration {
+	id := r.mu.RLock()
+	defer r.mu.RUnlock(id)
+	if r.persist.SkyfileIdempotencyKeyExpiry <= 0 {
+		return defaultSkyfileIdempotencyKeyExpiry
+	}
+	return r.persist.SkyfileIdempotencyKeyExpiry
+}
@@ -0,0 +1,334 @@
+package renter
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"gitlab.com/NebulousLabs/Sia/crypto"
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/errors"
+	"gitlab.com/NebulousLabs/fastrand"
+)
+
+// TestSkyfileIdempotencyCache tests the basic functionality of the
+// skyfileIdempotencyCache.
+func TestSkyfileIdempotencyCache(t *testing.T) {
+	t.Parallel()
+
+	expiry := 100 * time.Millisecond
+	c := newSkyfileIdempotencyCache()
+
+	// Unknown keys shouldn't be found.
+	_, exists := c.callGet("key")
+	if exists {
+		t.Fatal("unknown key was found")
+	}
+
+	// Set a key and get it back.
+	var mr crypto.Hash
+	fastrand.Read(mr[:])
+	skylink, err := modules.NewSkylinkV1(mr, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	siaPath := modules.RandomSiaPath()
+	set := skyfileIdempotencyEntry{siaPath: siaPath, skylink: skylink}
+	c.callSet("key", set, expiry)
+	entry, exists := c.callGet("key")
+	if !exists {
+		t.Fatal("key wasn't found")
+	}
+	if entry.skylink != skylink || !entry.siaPath.Equals(siaPath) {
+		t.Fatal("wrong entry", entry)
+	}
+
+	// Removing the key should remove the entry.
+	c.callRemove("key")
+	if _, exists = c.callGet("key"); exists {
+		t.Fatal("removed key was found")
+	}
+
+	// Entries should expire.
+	c.callSet("key", set, expiry)
+	time.Sleep(expiry)
+	if _, exists = c.callGet("key"); exists {
+		t.Fatal("expired key was found")
+	}
+	if len(c.entries) != 0 || len(c.queue) != 0 {
+		t.Fatal("expired entry wasn't pruned", len(c.entries), len(c.queue))
+	}
+
+	// Setting a key again should extend its expiry.
+	c.callSet("key", set, expiry)
+	time.Sleep(expiry / 2)
+	c.callSet("key", set, expiry)
+	time.Sleep(expiry / 2)
+	if _, exists = c.callGet("key"); !exists {
+		t.Fatal("key expired too early")
+	}
+
+	// An entry with a shorter expiry should expire even if it is queued
+	// behind an entry with a longer one.
+	c.callSet("key", set, time.Hour)
+	c.callSet("key2", set, expiry)
+	time.Sleep(expiry)
+	if _, exists = c.callGet("key2"); exists {
+		t.Fatal("expired key was found")
+	}
+	if _, exists = c.callGet("key"); !exists {
+		t.Fatal("key expired too early")
+	}
+
+	// Once the cache is full, the oldest entries are evicted.
+	c = newSkyfileIdempotencyCache()
+	for i := 0; i <= maxSkyfileIdempotencyEntries; i++ {
+		c.callSet(fmt.Sprint(i), set, time.Hour)
+	}
+	if len(c.entries) != maxSkyfileIdempotencyEntries {
+		t.Fatal("unexpected number of entries", len(c.entries))
+	}
+	if _, exists = c.callGet("0"); exists {
+		t.Fatal("oldest key wasn't evicted")
+	}
+	if _, exists = c.callGet(fmt.Sprint(maxSkyfileIdempotencyEntries)); !exists {
+		t.Fatal("newest key wasn't found")
+	}
+}
+
+// TestSkyfileIdempotencyReader makes sure that the digest of the
+// skyfileIdempotencyReader doesn't depend on data being handed back to the
+// reader.
+func TestSkyfileIdempotencyReader(t *testing.T) {
+	t.Parallel()
+
+	sup := modules.SkyfileUploadParameters{
+		Filename: "file",
+		Mode:     modules.DefaultFilePerm,
+	}
+	data := fastrand.Bytes(1000)
+
+	// digest reads the data using a skyfileIdempotencyReader, handing the
+	// first readBack bytes back to the reader, and returns its digest.
+	digest := func(sup modules.SkyfileUploadParameters, data []byte, readBack int) crypto.Hash {
+		ir := newSkyfileIdempotencyReader(modules.NewSkyfileReader(bytes.NewReader(data), sup))
+		buf := make([]byte, readBack)
+		if _, err := io.ReadFull(ir, buf); err != nil {
+			t.Fatal(err)
+		}
+		ir.AddReadBuffer(buf)
+		if _, err := io.Copy(ioutil.Discard, ir); err != nil {
+			t.Fatal(err)
+		}
+		d, err := ir.digest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+	expected := digest(sup, data, 0)
+	if d := digest(sup, data, 100); d != expected {
+		t.Fatal("digest changed by handing data back to the reader")
+	}
+
+	// Different data or metadata should result in a different digest.
+	if d := digest(sup, fastrand.Bytes(len(data)), 0); d == expected {
+		t.Fatal("digest of different data matches")
+	}
+	otherSup := sup
+	otherSup.Filename = "other"
+	if d := digest(otherSup, data, 0); d == expected {
+		t.Fatal("digest of different metadata matches")
+	}
+}
+
+// TestUploadSkyfileIdempotencyKey makes sure that retrying an upload with the
+// same idempotency key returns the skylink of the original upload as long as
+// the retry matches the original upload.
+func TestUploadSkyfileIdempotencyKey(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	wt, err := newWorkerTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := wt.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	r := wt.rt.renter
+
+	siaPath, err := modules.SkynetFolder.Join(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sup := modules.SkyfileUploadParameters{
+		SiaPath:             siaPath,
+		BaseChunkRedundancy: 2,
+		Filename:            "file",
+		Mode:                modules.DefaultFilePerm,
+		IdempotencyKey:      "key",
+	}
+	data := fastrand.Bytes(100)
+	skylink, err := r.UploadSkyfile(sup, modules.NewSkyfileReader(bytes.NewReader(data), sup))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Retry the upload. Since the key is the same, the original skylink
+	// should be returned.
+	retrySkylink, err := r.UploadSkyfile(sup, modules.NewSkyfileReader(bytes.NewReader(data), sup))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if retrySkylink != skylink {
+		t.Fatal("retry returned a different skylink", retrySkylink, skylink)
+	}
+
+	// The content hash of a retry is the digest of the returned skylink's
+	// data.
+	hashSup := sup
+	hashSup.ContentHasher = sha256.New()
+	result, err := r.UploadSkyfileV2(hashSup, modules.NewSkyfileReader(bytes.NewReader(data), hashSup))
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := sha256.Sum256(data)
+	if result.Skylink != skylink || !bytes.Equal(result.ContentHash, digest[:]) {
+		t.Fatal("wrong result of retry", result.Skylink, skylink)
+	}
+
+	// Retries that don't match the original upload should fail.
+	otherSiaPath, err := modules.SkynetFolder.Join(t.Name() + "-other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	retryData := fastrand.Bytes(100)
+	mismatches := []struct {
+		name   string
+		modify func(sup *modules.SkyfileUploadParameters)
+		data   []byte
+	}{
+		{"SiaPath", func(sup *modules.SkyfileUploadParameters) { sup.SiaPath = otherSiaPath }, data},
+		{"Params", func(sup *modules.SkyfileUploadParameters) { sup.BaseChunkRedundancy = 3 }, data},
+		{"Metadata", func(sup *modules.SkyfileUploadParameters) { sup.Filename = "other" }, data},
+		{"Data", func(sup *modules.SkyfileUploadParameters) {}, retryData},
+	}
+	for _, test := range mismatches {
+		retrySup := sup
+		test.modify(&retrySup)
+		_, err = r.UploadSkyfile(retrySup, modules.NewSkyfileReader(bytes.NewReader(test.data), retrySup))
+		if !errors.Contains(err, ErrSkyfileIdempotencyKeyMismatch) {
+			t.Fatalf("%v: expected %v but got %v", test.name, ErrSkyfileIdempotencyKeyMismatch, err)
+		}
+	}
+	// The original siafile should still exist.
+	if _, err := r.File(siaPath); err != nil {
+		t.Fatal(err)
+	}
+
+	// Once the siafile is deleted, the data should be uploaded again.
+	err = r.DeleteFile(siaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	retrySkylink, err = r.UploadSkyfile(sup, modules.NewSkyfileReader(bytes.NewReader(retryData), sup))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if retrySkylink == skylink {
+		t.Fatal("upload after deleting the siafile returned the cached skylink")
+	}
+
+	// Once the skylink is blocked, retrying the upload should fail instead of
+	// returning the cached skylink.
+	err = r.UpdateSkynetBlocklist([]crypto.Hash{crypto.HashObject(retrySkylink.MerkleRoot())}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = r.UploadSkyfile(sup, modules.NewSkyfileReader(bytes.NewReader(retryData), sup))
+	if !errors.Contains(err, ErrSkylinkBlocked) {
+		t.Fatalf("expected %v but got %v", ErrSkylinkBlocked, err)
+	}
+}
+
+// TestSkyfileIdempotencyKeyExpirySetting makes sure that the expiry of
+// idempotency keys is configured by the renter's settings.
+func TestSkyfileIdempotencyKeyExpirySetting(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	rt, err := newRenterTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := rt.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	r := rt.renter
+
+	// The default should be used initially. The settings report 0 to make
+	// sure that posting them back doesn't pin the current default.
+	settings, err := r.Settings()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if settings.SkyfileIdempotencyKeyExpiry != 0 {
+		t.Fatal("unexpected expiry", settings.SkyfileIdempotencyKeyExpiry)
+	}
+	if expiry := r.managedSkyfileIdempotencyKeyExpiry(); expiry != defaultSkyfileIdempotencyKeyExpiry {
+		t.Fatal("unexpected expiry", expiry)
+	}
+
+	// Negative values are invalid.
+	settings.SkyfileIdempotencyKeyExpiry = -time.Second
+	if err := r.SetSettings(settings); err == nil {
+		t.Fatal("negative expiry was accepted")
+	}
+
+	// Update the expiry.
+	settings.SkyfileIdempotencyKeyExpiry = time.Second
+	if err := r.SetSettings(settings); err != nil {
+		t.Fatal(err)
+	}
+	if expiry := r.managedSkyfileIdempotencyKeyExpiry(); expiry != time.Second {
+		t.Fatal("unexpected expiry", expiry)
+	}
+
+	// The expiry should be persisted.
+	r, err = rt.reloadRenter(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expiry := r.managedSkyfileIdempotencyKeyExpiry(); expiry != time.Second {
+		t.Fatal("unexpected expiry", expiry)
+	}
+
+	// 0 resets the expiry to the default.
+	settings.SkyfileIdempotencyKeyExpiry = 0
+	if err := r.SetSettings(settings); err != nil {
+		t.Fatal(err)
+	}
+	if expiry := r.managedSkyfileIdempotencyKeyExpiry(); expiry != defaultSkyfileIdempotencyKeyExpiry {
+		t.Fatal("unexpected expiry", expiry)
+	}
+	settings, err = r.Settings()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if settings.SkyfileIdempotencyKeyExpiry != 0 {
+		t.Fatal("unexpected expiry", settings.SkyfileIdempotencyKeyExpiry)
+	}
+}
@@ -0,0 +1,183 @@
+package renter
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/modules/renter/filesystem"
+	"gitlab.com/NebulousLabs/errors"
+)
+
+// errPinnedSkylinksLimitReached is used to stop walking the filesystem once
+// enough pinned skylinks were collected.
+var errPinnedSkylinksLimitReached = errors.New("limit of pinned skylinks reached")
+
+// PinnedSkylinks returns the skylinks pinned by the siafiles of the renter
+// together with the siapath of the siafile pinning them. All siafiles are
+// walked rather than only the ones in the Skynet folder since skyfiles can be
+// uploaded to any siapath using Root, a siafile is recognized as a skyfile by
+// the skylinks in its metadata. The siafiles are walked in lexical order,
+// which allows for paginating through the skylinks using the offset and limit.
+// A limit of 0 returns all of the remaining skylinks.
+//
+// Skylinks are only reported for the base siafile of a skyfile since the
+// extended siafile contains the same skylinks. A skylink that is pinned by
+// multiple skyfiles is reported once for each of them.
+func (r *Renter) PinnedSkylinks(offset, limit uint64) ([]modules.PinnedSkylink, error) {
+	if err := r.tg.Add(); err != nil {
+		return nil, err
+	}
+	defer r.tg.Done()
+
+	var pinned []modules.PinnedSkylink
+	var index uint64
+	root := r.staticFileSystem.Root()
+	err := r.staticFileSystem.Walk(modules.RootSiaPath(), func(path string, info os.FileInfo, statErr error) error {
+		// The siafile might have been deleted since the walk started.
+		if os.IsNotExist(statErr) {
+			return nil
+		}
+		if statErr != nil {
+			return statErr
+		}
+		// Nothing to do for folders and non-siafiles.
+		if info.IsDir() || filepath.Ext(path) != modules.SiaFileExtension {
+			return nil
+		}
+		var siaPath modules.SiaPath
+		err := siaPath.LoadSysPath(root, path)
+		if err != nil {
+			return err
+		}
+		if strings.HasSuffix(siaPath.String(), modules.ExtendedSuffix) {
+			return nil
+		}
+
+		// Collect the skylinks of the siafile.
+		skylinks, err := r.managedSiafileSkylinks(siaPath)
+		if err != nil {
+			return err
+		}
+		for _, skylink := range skylinks {
+			index++
+			if index <= offset {
+				continue
+			}
+			pinned = append(pinned, modules.PinnedSkylink{
+				Skylink: skylink,
+				SiaPath: siaPath,
+			})
+			if limit > 0 && uint64(len(pinned)) == limit {
+				return errPinnedSkylinksLimitReached
+			}
+		}
+		return nil
+	})
+	if err != nil && !errors.Contains(err, errPinnedSkylinksLimitReached) {
+		return nil, errors.AddContext(err, "unable to walk the filesystem")
+	}
+	return pinned, nil
+}
+
+// managedSiafileSkylinks returns the deduplicated skylinks of the siafile at
+// the given siapath. Skylinks that fail to load are skipped.
+func (r *Renter) managedSiafileSkylinks(siaPath modules.SiaPath) ([]modules.Skylink, error) {
+	fileNode, err := r.staticFileSystem.OpenSiaFile(siaPath)
+	if errors.Contains(err, filesystem.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.AddContext(err, "unable to open siafile")
+	}
+	skylinkstrs := fileNode.Metadata().Skylinks
+	if err := fileNode.Close(); err != nil {
+		return nil, errors.AddContext(err, "unable to close siafile")
+	}
+
+	var skylinks []modules.Skylink
+	seen := make(map[modules.Skylink]struct{})
+	for _, skylinkstr := range skylinkstrs {
+		var skylink modules.Skylink
+		err := skylink.LoadString(skylinkstr)
+		if err != nil {
+			// If there is an error just continue as we shouldn't fail to list
+			// the remaining skylinks due to bad old skylinks
+			//
+			// Log the error for debugging purposes
+			r.log.Printf("WARN: skylink for siafile %v could not be loaded from string; potentially corrupt skylink: %v", siaPath, skylinkstr)
+			continue
+		}
+		if _, exists := seen[skylink]; exists {
+			continue
+		}
+		seen[skylink] = struct{}{}
+		skylinks = append(skylinks, skylink)
+	}
+	return skylinks, nil
+}
+
+// managedSkylinkPinned returns whether the skylink is already pinned by the
+// siafile at the given siapath or by the siafile at the canonical siapath of the
+// skylink, as well as the siapath of the pinning siafile. If the skyfile has a
+// fanout, the corresponding extended siafile needs to pin the skylink as well.
+func (r *Renter) managedSkylinkPinned(skylink modules.Skylink, siaPath modules.SiaPath, hasFanout bool) (modules.SiaPath, bool, error) {
+	canonicalPath, _, err := modules.SkylinkSiaPath(skylink)
+	if err != nil {
+		return modules.SiaPath{}, false, err
+	}
+	for _, basePath := range []modules.SiaPath{siaPath, canonicalPath} {
+		if basePath.IsEmpty() {
+			continue
+		}
+		pinned, err := r.managedSiafilePinsSkylink(basePath, skylink)
+		if err != nil {
+			return modules.SiaPath{}, false, err
+		}
+		if !pinned {
+			continue
+		}
+		if !hasFanout {
+			return basePath, true, nil
+		}
+		extendedPath, err := modules.ExtendedSiaPath(basePath)
+		if err != nil {
+			return modules.SiaPath{}, false, err
+		}
+		pinned, err = r.managedSiafilePinsSkylink(extendedPath, skylink)
+		if err != nil {
+			return modules.SiaPath{}, false, err
+		}
+		if pinned {
+			return basePath, true, nil
+		}
+	}
+	return modules.SiaPath{}, false, nil
+}
+
+// skylinkPinnedError returns the error for pinning a skylink at the requested
+// siapath while it is already pinned at pinnedPath. Only pinning it at the
+// same siapath is a no-op, otherwise the requested siafile wouldn't exist.
+func skylinkPinnedError(requestedPath, pinnedPath modules.SiaPath) error {
+	if requestedPath.Equals(pinnedPath) {
+		return ErrAlreadyPinned
+	}
+	return errors.AddContext(ErrSkylinkPinnedElsewhere, fmt.Sprintf("skylink is pinned at '%v'", pinnedPath))
+}
+
+// managedSiafilePinsSkylink returns whether the siafile at the given siapath
+// exists and contains the skylink.
+func (r *Renter) managedSiafilePinsSkylink(siaPath modules.SiaPath, skylink modules.Skylink) (bool, error) {
+	skylinks, err := r.managedSiafileSkylinks(siaPath)
+	if err != nil {
+		return false, err
+	}
+	for _, sl := range skylinks {
+		if sl == skylink {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,321 @@
+package renter
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"gitlab.com/NebulousLabs/Sia/crypto"
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/types"
+	"gitlab.com/NebulousLabs/errors"
+	"gitlab.com/NebulousLabs/fastrand"
+)
+
+// TestPinnedSkylinks verifies that PinnedSkylinks lists the skylinks of all
+// siafiles, including the ones outside of the Skynet folder, and supports
+// pagination.
+func TestPinnedSkylinks(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	rt, err := newRenterTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := rt.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	r := rt.renter
+
+	// Helper to create a siafile with the given skylinks.
+	randomSkylink := func() modules.Skylink {
+		var mr crypto.Hash
+		fastrand.Read(mr[:])
+		skylink, err := modules.NewSkylinkV1(mr, 0, 4096)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return skylink
+	}
+	createFile := func(siaPath modules.SiaPath, skylinks ...modules.Skylink) {
+		_, rsc := testingFileParams()
+		fileNode, err := r.createRenterTestFileWithParams(siaPath, rsc, crypto.TypePlain)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, skylink := range skylinks {
+			if err := fileNode.AddSkylink(skylink); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := fileNode.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Create a large skyfile with a base and an extended siafile, a skyfile
+	// that was pinned twice, a skyfile that was uploaded outside of the Skynet
+	// folder using Root and a regular siafile.
+	sl1, sl2, sl3, sl4 := randomSkylink(), randomSkylink(), randomSkylink(), randomSkylink()
+	largePath, err := modules.SkynetFolder.Join("a/large")
+	if err != nil {
+		t.Fatal(err)
+	}
+	largeExtendedPath, err := modules.ExtendedSiaPath(largePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	createFile(largePath, sl1)
+	createFile(largeExtendedPath, sl1)
+	pinnedPath, err := modules.SkynetFolder.Join("b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	createFile(pinnedPath, sl2, sl3, sl2)
+	rootPath, err := modules.NewSiaPath("z/root")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rootExtendedPath, err := modules.ExtendedSiaPath(rootPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	createFile(rootPath, sl4)
+	createFile(rootExtendedPath, sl4)
+	createFile(modules.RandomSiaPath())
+
+	// All of the pinned skylinks should be listed in lexical order of their
+	// siapaths without duplicates.
+	expected := []modules.PinnedSkylink{
+		{Skylink: sl1, SiaPath: largePath},
+		{Skylink: sl2, SiaPath: pinnedPath},
+		{Skylink: sl3, SiaPath: pinnedPath},
+		{Skylink: sl4, SiaPath: rootPath},
+	}
+	pinned, err := r.PinnedSkylinks(0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pinned) != len(expected) {
+		t.Fatalf("expected %v pinned skylinks but got %v", len(expected), len(pinned))
+	}
+	for i := range expected {
+		if pinned[i].Skylink != expected[i].Skylink || !pinned[i].SiaPath.Equals(expected[i].SiaPath) {
+			t.Fatalf("pinned skylink %v doesn't match: %v != %v", i, pinned[i], expected[i])
+		}
+	}
+
+	// Paginate through the skylinks.
+	for offset := uint64(0); offset < uint64(len(expected))+1; offset++ {
+		pinned, err := r.PinnedSkylinks(offset, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		end := offset + 2
+		if end > uint64(len(expected)) {
+			end = uint64(len(expected))
+		}
+		page := expected[offset:end]
+		if len(pinned) != len(page) {
+			t.Fatalf("expected %v pinned skylinks at offset %v but got %v", len(page), offset, len(pinned))
+		}
+		for i := range page {
+			if pinned[i].Skylink != page[i].Skylink || !pinned[i].SiaPath.Equals(page[i].SiaPath) {
+				t.Fatalf("pinned skylink %v at offset %v doesn't match", i, offset)
+			}
+		}
+	}
+}
+
+// TestSkylinkPinned verifies that managedSkylinkPinned detects skylinks pinned
+// at a given siapath or at the canonical siapath of the skylink.
+func TestSkylinkPinned(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	rt, err := newRenterTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := rt.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	r := rt.renter
+
+	// Helper to create a siafile with the given skylink.
+	createFile := func(siaPath modules.SiaPath, skylink modules.Skylink) {
+		_, rsc := testingFileParams()
+		fileNode, err := r.createRenterTestFileWithParams(siaPath, rsc, crypto.TypePlain)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := fileNode.AddSkylink(skylink); err != nil {
+			t.Fatal(err)
+		}
+		if err := fileNode.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var mr crypto.Hash
+	fastrand.Read(mr[:])
+	skylink, err := modules.NewSkylinkV1(mr, 0, 4096)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pinPath, err := modules.SkynetFolder.Join("pin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	canonicalPath, canonicalExtendedPath, err := modules.SkylinkSiaPath(skylink)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// isPinned is a helper that checks whether the skylink is pinned.
+	var pinnedPath modules.SiaPath
+	isPinned := func(siaPath modules.SiaPath, hasFanout bool) bool {
+		var pinned bool
+		pinnedPath, pinned, err = r.managedSkylinkPinned(skylink, siaPath, hasFanout)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return pinned
+	}
+
+	// Without siafiles, the skylink isn't pinned.
+	if isPinned(pinPath, false) || isPinned(modules.SiaPath{}, false) {
+		t.Fatal("skylink shouldn't be pinned")
+	}
+
+	// A base siafile pins a skylink without a fanout.
+	createFile(pinPath, skylink)
+	if !isPinned(pinPath, false) {
+		t.Fatal("skylink should be pinned")
+	}
+	if !pinnedPath.Equals(pinPath) {
+		t.Fatal("wrong pinned siapath", pinnedPath)
+	}
+	if isPinned(modules.SiaPath{}, false) {
+		t.Fatal("skylink shouldn't be pinned at the canonical siapath")
+	}
+
+	// A skylink with a fanout also requires the extended siafile.
+	createFile(canonicalPath, skylink)
+	if isPinned(pinPath, true) {
+		t.Fatal("skylink shouldn't be pinned without extended siafile")
+	}
+	createFile(canonicalExtendedPath, skylink)
+	if !isPinned(pinPath, true) || !isPinned(modules.SiaPath{}, true) {
+		t.Fatal("skylink should be pinned at the canonical siapath")
+	}
+	if !pinnedPath.Equals(canonicalPath) {
+		t.Fatal("wrong pinned siapath", pinnedPath)
+	}
+}
+
+// TestPinSkylinkAlreadyPinned verifies that pinning a skylink that is already
+// pinned is a no-op unless Force is set.
+func TestPinSkylinkAlreadyPinned(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	wt, err := newWorkerTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := wt.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	r := wt.rt.renter
+
+	// Upload a small skyfile.
+	metadataBytes, err := modules.SkyfileMetadataBytes(modules.SkyfileMetadata{Filename: "file"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := fastrand.Bytes(100)
+	sl := modules.SkyfileLayout{
+		Version:      modules.SkyfileVersion,
+		Filesize:     uint64(len(data)),
+		MetadataSize: uint64(len(metadataBytes)),
+		CipherType:   crypto.TypePlain,
+	}
+	baseSector, fetchSize := modules.BuildBaseSector(sl.Encode(), nil, metadataBytes, data)
+	skylink, err := modules.NewSkylinkV1(crypto.MerkleRoot(baseSector), 0, fetchSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	uploadPath, err := modules.SkynetFolder.Join(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sup := modules.SkyfileUploadParameters{
+		SiaPath:             uploadPath,
+		BaseChunkRedundancy: 2,
+	}
+	err = r.managedUploadBaseSector(sup, baseSector, skylink)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Pin the skylink at its canonical siapath.
+	canonicalPath, _, err := modules.SkylinkSiaPath(skylink)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lup := modules.SkyfileUploadParameters{
+		SiaPath:             canonicalPath,
+		BaseChunkRedundancy: 2,
+	}
+	err = r.PinSkylink(context.Background(), skylink, lup, time.Minute, 0, types.ZeroCurrency)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Pinning it again at the same siapath should be a no-op.
+	err = r.PinSkylink(context.Background(), skylink, lup, time.Minute, 0, types.ZeroCurrency)
+	if !errors.Contains(err, ErrAlreadyPinned) {
+		t.Fatal("expected ErrAlreadyPinned", err)
+	}
+
+	// Pinning it at another siapath should report where it is pinned.
+	otherPath, err := modules.SkynetFolder.Join(t.Name() + "-other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lup.SiaPath = otherPath
+	err = r.PinSkylink(context.Background(), skylink, lup, time.Minute, 0, types.ZeroCurrency)
+	if !errors.Contains(err, ErrSkylinkPinnedElsewhere) || errors.Contains(err, ErrAlreadyPinned) {
+		t.Fatal("expected ErrSkylinkPinnedElsewhere", err)
+	}
+	if !strings.Contains(err.Error(), canonicalPath.String()) {
+		t.Fatal("error doesn't name the pinned siapath", err)
+	}
+	if _, err := r.File(otherPath); err == nil {
+		t.Fatal("siafile shouldn't have been created")
+	}
+
+	// With Force set, the skylink is pinned again.
+	lup.Force = true
+	err = r.PinSkylink(context.Background(), skylink, lup, time.Minute, 0, types.ZeroCurrency)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.File(otherPath); err != nil {
+		t.Fatal("siafile should have been created", err)
+	}
+}
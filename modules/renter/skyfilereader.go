@@ -0,0 +1,95 @@
+package renter
+
+import (
+	"time"
+
+	"gitlab.com/NebulousLabs/Sia/build"
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/errors"
+	"gitlab.com/NebulousLabs/threadgroup"
+)
+
+var (
+	// ErrSkyfileUploadStalled is the error returned when the reader of a
+	// skyfile upload didn't produce any data within the read timeout.
+	ErrSkyfileUploadStalled = errors.New("skyfile upload stalled")
+
+	// skyfileUploadReadTimeout is the amount of time a single read from the
+	// reader of a skyfile upload can take before the upload is aborted.
+	skyfileUploadReadTimeout = build.Select(build.Var{
+		Dev:      time.Minute,
+		Standard: 5 * time.Minute,
+		Testing:  5 * time.Second,
+	}).(time.Duration)
+)
+
+type (
+	// skyfileStallReader wraps the reader of a skyfile upload and aborts any
+	// read that doesn't return within the timeout. This prevents a client that
+	// stops sending data from tying up the upload indefinitely.
+	//
+	// NOTE: reading from this object is not threadsafe, just like reading from
+	// the readers it wraps.
+	skyfileStallReader struct {
+		modules.SkyfileUploadReader
+
+		// buf is the buffer the underlying reader reads into. It is reused
+		// between reads unless a read is abandoned, after which the reader
+		// always returns err.
+		buf []byte
+		err error
+
+		staticStopChan <-chan struct{}
+		staticTimeout  time.Duration
+	}
+
+	// skyfileStallReadResult is the result of a single read from the
+	// underlying reader of a skyfileStallReader.
+	skyfileStallReadResult struct {
+		n   int
+		err error
+	}
+)
+
+// newSkyfileStallReader wraps the given reader in a skyfileStallReader.
+func newSkyfileStallReader(reader modules.SkyfileUploadReader, timeout time.Duration, stopChan <-chan struct{}) *skyfileStallReader {
+	return &skyfileStallReader{
+		SkyfileUploadReader: reader,
+
+		staticStopChan: stopChan,
+		staticTimeout:  timeout,
+	}
+}
+
+// Read implements the io.Reader interface. The underlying reader is read from
+// a separate goroutine so that the read can be abandoned if it stalls.
+func (sr *skyfileStallReader) Read(b []byte) (int, error) {
+	if sr.err != nil {
+		return 0, sr.err
+	}
+	if cap(sr.buf) < len(b) {
+		sr.buf = make([]byte, len(b))
+	}
+	buf := sr.buf[:len(b)]
+
+	resultChan := make(chan skyfileStallReadResult, 1)
+	go func() {
+		n, err := sr.SkyfileUploadReader.Read(buf)
+		resultChan <- skyfileStallReadResult{n: n, err: err}
+	}()
+
+	timer := time.NewTimer(sr.staticTimeout)
+	defer timer.Stop()
+	select {
+	case res := <-resultChan:
+		return copy(b, buf[:res.n]), res.err
+	case <-timer.C:
+		sr.err = errors.AddContext(ErrSkyfileUploadStalled, "no data received within "+sr.staticTimeout.String())
+	case <-sr.staticStopChan:
+		sr.err = errors.AddContext(threadgroup.ErrStopped, "renter shutdown before skyfile upload finished")
+	}
+	// The read was abandoned, the buffer might still be written to by the
+	// underlying reader so it can't be reused.
+	sr.buf = nil
+	return 0, sr.err
+}
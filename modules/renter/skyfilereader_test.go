@@ -0,0 +1,206 @@
+package renter
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/errors"
+	"gitlab.com/NebulousLabs/fastrand"
+)
+
+// blockingReader is a reader that blocks until it is closed.
+type blockingReader struct {
+	closeChan chan struct{}
+}
+
+// newBlockingReader returns a new blockingReader.
+func newBlockingReader() *blockingReader {
+	return &blockingReader{closeChan: make(chan struct{})}
+}
+
+// Close unblocks all reads of the reader.
+func (br *blockingReader) Close() error {
+	close(br.closeChan)
+	return nil
+}
+
+// Read implements io.Reader by blocking until the reader is closed.
+func (br *blockingReader) Read(_ []byte) (int, error) {
+	<-br.closeChan
+	return 0, io.EOF
+}
+
+// TestSkyfileStallReader tests the skyfileStallReader.
+func TestSkyfileStallReader(t *testing.T) {
+	t.Parallel()
+
+	sup := modules.SkyfileUploadParameters{Filename: "file"}
+
+	// A reader that doesn't stall should be read as usual.
+	data := fastrand.Bytes(int(fastrand.Intn(1<<20) + 1))
+	sr := newSkyfileStallReader(modules.NewSkyfileReader(bytes.NewReader(data), sup), time.Second, nil)
+	readData, err := ioutil.ReadAll(sr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, readData) {
+		t.Fatal("data doesn't match")
+	}
+
+	// A reader that stalls should time out.
+	br := newBlockingReader()
+	defer func() {
+		if err := br.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	timeout := 100 * time.Millisecond
+	sr = newSkyfileStallReader(modules.NewSkyfileReader(br, sup), timeout, nil)
+	start := time.Now()
+	_, err = sr.Read(make([]byte, 10))
+	if !errors.Contains(err, ErrSkyfileUploadStalled) {
+		t.Fatal("expected stalled error", err)
+	}
+	if time.Since(start) < timeout {
+		t.Fatal("read returned before the timeout")
+	}
+	// Further reads should fail right away.
+	_, err = sr.Read(make([]byte, 10))
+	if !errors.Contains(err, ErrSkyfileUploadStalled) {
+		t.Fatal("expected stalled error", err)
+	}
+
+	// A stalled read should also be aborted when the stop channel is closed.
+	stopChan := make(chan struct{})
+	sr = newSkyfileStallReader(modules.NewSkyfileReader(br, sup), time.Hour, stopChan)
+	close(stopChan)
+	_, err = sr.Read(make([]byte, 10))
+	if err == nil || errors.Contains(err, ErrSkyfileUploadStalled) {
+		t.Fatal("expected shutdown error", err)
+	}
+}
+
+// TestUploadSkyfileStalledReader makes sure that an upload from a reader that
+// blocks forever is aborted after the read timeout.
+func TestUploadSkyfileStalledReader(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	rt, err := newRenterTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := rt.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	br := newBlockingReader()
+	defer func() {
+		if err := br.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	siaPath, err := modules.SkynetFolder.Join(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sup := modules.SkyfileUploadParameters{
+		SiaPath:  siaPath,
+		Filename: "file",
+		Mode:     modules.DefaultFilePerm,
+	}
+
+	start := time.Now()
+	_, err = rt.renter.UploadSkyfile(sup, modules.NewSkyfileReader(br, sup))
+	if !errors.Contains(err, ErrSkyfileUploadStalled) {
+		t.Fatal("expected stalled error", err)
+	}
+	if time.Since(start) < skyfileUploadReadTimeout {
+		t.Fatal("upload returned before the timeout")
+	}
+
+	// No siafile should be left behind.
+	_, err = rt.renter.File(siaPath)
+	if err == nil {
+		t.Fatal("siafile of stalled upload wasn't cleaned up")
+	}
+}
+
+// truncatedReader is a reader that returns its data followed by an
+// io.ErrUnexpectedEOF, like a network reader that got cut off.
+type truncatedReader struct {
+	r io.Reader
+}
+
+// Read implements io.Reader.
+func (tr *truncatedReader) Read(p []byte) (int, error) {
+	n, err := tr.r.Read(p)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+// TestUploadSkyfileTruncatedReader makes sure that a small skyfile isn't
+// stored if its reader returns an io.ErrUnexpectedEOF.
+func TestUploadSkyfileTruncatedReader(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	rt, err := newRenterTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := rt.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	siaPath, err := modules.SkynetFolder.Join(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sup := modules.SkyfileUploadParameters{
+		SiaPath:  siaPath,
+		DryRun:   true,
+		Filename: "file",
+		Mode:     modules.DefaultFilePerm,
+	}
+	data := fastrand.Bytes(100)
+
+	// The upload should fail by default.
+	reader := modules.NewSkyfileReader(&truncatedReader{bytes.NewReader(data)}, sup)
+	_, err = rt.renter.UploadSkyfile(sup, reader)
+	if !errors.Contains(err, modules.ErrSkyfileUploadTruncated) {
+		t.Fatal("expected truncated error", err)
+	}
+
+	// If the caller allows an unexpected EOF the truncated data is uploaded
+	// like a regular small file.
+	sup.AllowUnexpectedEOF = true
+	reader = modules.NewSkyfileReader(&truncatedReader{bytes.NewReader(data)}, sup)
+	skylink, err := rt.renter.UploadSkyfile(sup, reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sup.AllowUnexpectedEOF = false
+	expected, err := rt.renter.UploadSkyfile(sup, modules.NewSkyfileReader(bytes.NewReader(data), sup))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if skylink != expected {
+		t.Fatal("skylinks don't match", skylink, expected)
+	}
+}
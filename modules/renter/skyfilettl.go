@@ -0,0 +1,148 @@
+package renter
+
+// skyfilettl.go deletes the siafiles of skyfiles that were uploaded with a
+// TTL once the TTL has passed. The expirations are persisted together with the
+// renter's settings to make sure the siafiles are deleted even if the renter
+// is restarted in the meantime.
+
+import (
+	"time"
+
+	"gitlab.com/NebulousLabs/Sia/build"
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/modules/renter/filesystem"
+	"gitlab.com/NebulousLabs/errors"
+)
+
+var (
+	// skyfileExpirationCheckInterval is the interval at which the renter
+	// checks for expired skyfiles.
+	skyfileExpirationCheckInterval = build.Select(build.Var{
+		Dev:      time.Minute,
+		Standard: 10 * time.Minute,
+		Testing:  time.Second,
+	}).(time.Duration)
+)
+
+// skyfileExpiration is a skyfile that is deleted once it expires. The skylink
+// makes sure that only the siafiles of the skyfile are deleted, even if its
+// siapath was reused in the meantime.
+type skyfileExpiration struct {
+	SiaPath modules.SiaPath `json:"siapath"`
+	Skylink string          `json:"skylink"`
+	Expiry  time.Time       `json:"expiry"`
+}
+
+// managedScheduleSkyfileExpiration schedules the deletion of the base and
+// extended siafiles of the skyfile with the given skylink at the given siapath
+// after the ttl. The expiration is persisted before the method returns, if
+// that fails the expiration is not scheduled.
+func (r *Renter) managedScheduleSkyfileExpiration(siaPath modules.SiaPath, skylink modules.Skylink, ttl time.Duration) error {
+	id := r.mu.Lock()
+	defer r.mu.Unlock(id)
+	r.persist.SkyfileExpirations = append(r.persist.SkyfileExpirations, skyfileExpiration{
+		SiaPath: siaPath,
+		Skylink: skylink.String(),
+		Expiry:  time.Now().Add(ttl),
+	})
+	err := r.saveSync()
+	if err != nil {
+		r.persist.SkyfileExpirations = r.persist.SkyfileExpirations[:len(r.persist.SkyfileExpirations)-1]
+		return errors.AddContext(err, "unable to persist skyfile expiration")
+	}
+	return nil
+}
+
+// managedSiafileHasSkylink returns whether the siafile at the given siapath
+// carries the given skylink.
+func (r *Renter) managedSiafileHasSkylink(siaPath modules.SiaPath, skylink string) (_ bool, err error) {
+	fileNode, err := r.staticFileSystem.OpenSiaFile(siaPath)
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		err = errors.Compose(err, fileNode.Close())
+	}()
+	for _, sl := range fileNode.Metadata().Skylinks {
+		if sl == skylink {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// managedPruneExpiredSkyfiles deletes the siafiles of all expired skyfiles.
+func (r *Renter) managedPruneExpiredSkyfiles() error {
+	// Remove the expired skyfiles from the persistence.
+	now := time.Now()
+	var expired []skyfileExpiration
+	id := r.mu.Lock()
+	remaining := r.persist.SkyfileExpirations[:0]
+	for _, se := range r.persist.SkyfileExpirations {
+		if se.Expiry.After(now) {
+			remaining = append(remaining, se)
+			continue
+		}
+		expired = append(expired, se)
+	}
+	r.persist.SkyfileExpirations = remaining
+	var err error
+	if len(expired) > 0 {
+		err = r.saveSync()
+	}
+	r.mu.Unlock(id)
+	if err != nil {
+		return errors.AddContext(err, "unable to persist skyfile expirations")
+	}
+
+	// Delete the siafiles. They might have been deleted by the user already
+	// or replaced by siafiles that don't belong to the skyfile, which is why
+	// only siafiles that still carry the skylink are deleted.
+	for _, se := range expired {
+		extendedPath, err := modules.ExtendedSiaPath(se.SiaPath)
+		if err != nil {
+			r.log.Printf("unable to create extended siapath of expired skyfile %v: %v", se.SiaPath, err)
+			continue
+		}
+		for _, sp := range []modules.SiaPath{se.SiaPath, extendedPath} {
+			hasSkylink, err := r.managedSiafileHasSkylink(sp, se.Skylink)
+			if errors.Contains(err, filesystem.ErrNotExist) {
+				continue
+			}
+			if err != nil {
+				r.log.Printf("unable to open siafile %v of expired skyfile: %v", sp, err)
+				continue
+			}
+			if !hasSkylink {
+				continue
+			}
+			err = r.DeleteFile(sp)
+			if err != nil && !errors.Contains(err, filesystem.ErrNotExist) {
+				r.log.Printf("unable to delete siafile %v of expired skyfile: %v", sp, err)
+			}
+		}
+	}
+	return nil
+}
+
+// threadedPruneExpiredSkyfiles periodically deletes the siafiles of expired
+// skyfiles.
+func (r *Renter) threadedPruneExpiredSkyfiles() {
+	err := r.tg.Add()
+	if err != nil {
+		return
+	}
+	defer r.tg.Done()
+
+	for {
+		err := r.managedPruneExpiredSkyfiles()
+		if err != nil {
+			r.log.Println("unable to prune expired skyfiles:", err)
+		}
+		select {
+		case <-r.tg.StopChan():
+			return
+		case <-time.After(skyfileExpirationCheckInterval):
+		}
+	}
+}
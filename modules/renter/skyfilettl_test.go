@@ -0,0 +1,214 @@
+package renter
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gitlab.com/NebulousLabs/Sia/build"
+	"gitlab.com/NebulousLabs/Sia/crypto"
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/persist"
+	"gitlab.com/NebulousLabs/errors"
+	"gitlab.com/NebulousLabs/fastrand"
+)
+
+// TestSkyfileTTL verifies that the siafiles of a skyfile uploaded with a TTL
+// are deleted once the TTL has passed.
+func TestSkyfileTTL(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	wt, err := newWorkerTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := wt.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	r := wt.rt.renter
+
+	// upload is a helper that uploads a small skyfile with the given TTL.
+	upload := func(name string, ttl time.Duration) (modules.SiaPath, error) {
+		siaPath, err := modules.SkynetFolder.Join(t.Name() + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sup := modules.SkyfileUploadParameters{
+			SiaPath:  siaPath,
+			Filename: "file",
+			Mode:     modules.DefaultFilePerm,
+			TTL:      ttl,
+		}
+		data := fastrand.Bytes(100)
+		_, err = r.UploadSkyfile(sup, modules.NewSkyfileReader(bytes.NewReader(data), sup))
+		return siaPath, err
+	}
+	fileExists := func(siaPath modules.SiaPath) bool {
+		exists, err := r.staticFileSystem.FileExists(siaPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return exists
+	}
+
+	// A negative TTL is rejected.
+	_, err = upload("negative", -time.Second)
+	if !errors.Contains(err, errNegativeSkyfileTTL) {
+		t.Fatal("expected negative TTL to be rejected", err)
+	}
+
+	// Upload one skyfile with and one without a TTL.
+	ttlPath, err := upload("ttl", 2*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	permanentPath, err := upload("permanent", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !fileExists(ttlPath) || !fileExists(permanentPath) {
+		t.Fatal("siafiles should exist after the upload")
+	}
+
+	// The skyfile with the TTL should be deleted once it expires.
+	err = build.Retry(100, 100*time.Millisecond, func() error {
+		if fileExists(ttlPath) {
+			return errors.New("siafile wasn't deleted yet")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !fileExists(permanentPath) {
+		t.Fatal("siafile without TTL shouldn't be deleted")
+	}
+	id := r.mu.RLock()
+	numExpirations := len(r.persist.SkyfileExpirations)
+	r.mu.RUnlock(id)
+	if numExpirations != 0 {
+		t.Fatal("expected expiration to be removed", numExpirations)
+	}
+
+	// The extended siafile of a skyfile should be deleted as well.
+	basePath, err := modules.SkynetFolder.Join(t.Name() + "large")
+	if err != nil {
+		t.Fatal(err)
+	}
+	extendedPath, err := modules.ExtendedSiaPath(basePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mr crypto.Hash
+	fastrand.Read(mr[:])
+	skylink, err := modules.NewSkylinkV1(mr, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, siaPath := range []modules.SiaPath{basePath, extendedPath} {
+		_, rsc := testingFileParams()
+		fileNode, err := r.createRenterTestFileWithParams(siaPath, rsc, crypto.TypePlain)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := fileNode.AddSkylink(skylink); err != nil {
+			t.Fatal(err)
+		}
+		if err := fileNode.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = r.managedScheduleSkyfileExpiration(basePath, skylink, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = r.managedPruneExpiredSkyfiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !fileExists(basePath) || !fileExists(extendedPath) {
+		t.Fatal("siafiles shouldn't be deleted before they expire")
+	}
+	id = r.mu.Lock()
+	r.persist.SkyfileExpirations[0].Expiry = time.Now()
+	r.mu.Unlock(id)
+	err = r.managedPruneExpiredSkyfiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fileExists(basePath) || fileExists(extendedPath) {
+		t.Fatal("siafiles should be deleted after they expire")
+	}
+
+	// If the siapath of an expired skyfile was reused by another skyfile, the
+	// other skyfile shouldn't be deleted.
+	reusedPath, err := upload("reused", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = r.DeleteFile(reusedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = upload("reused", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id = r.mu.Lock()
+	r.persist.SkyfileExpirations[0].Expiry = time.Now()
+	r.mu.Unlock(id)
+	err = r.managedPruneExpiredSkyfiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !fileExists(reusedPath) {
+		t.Fatal("skyfile at reused siapath shouldn't be deleted")
+	}
+}
+
+// TestSkyfileExpirationPersisted verifies that a skyfile expiration is
+// persisted as soon as it is scheduled.
+func TestSkyfileExpirationPersisted(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	rt, err := newRenterTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := rt.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	r := rt.renter
+
+	// persistedExpirations loads the expirations from disk.
+	persistedExpirations := func() int {
+		var data persistence
+		err := persist.LoadJSON(settingsMetadata, &data, filepath.Join(r.persistDir, PersistFilename))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(data.SkyfileExpirations)
+	}
+
+	// Every scheduled expiration should be on disk right away.
+	for i := 1; i <= 3; i++ {
+		err = r.managedScheduleSkyfileExpiration(modules.RandomSiaPath(), modules.Skylink{}, time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := persistedExpirations(); n != i {
+			t.Fatalf("expected %v persisted expirations but got %v", i, n)
+		}
+	}
+}
@@ -2,6 +2,9 @@ package renter
 
 import (
 	"context"
+	"fmt"
+	"sort"
+	"sync"
 	"time"
 
 	"gitlab.com/NebulousLabs/Sia/build"
@@ -11,6 +14,7 @@ import (
 	"gitlab.com/NebulousLabs/Sia/types"
 
 	"gitlab.com/NebulousLabs/errors"
+	"gitlab.com/NebulousLabs/fastrand"
 )
 
 var (
@@ -23,6 +27,13 @@ var (
 	}).(uint64)
 )
 
+var (
+	// ErrSkyfileRangeUnrecoverable is returned when a range of a skyfile can't
+	// be downloaded because not enough pieces of the fanout chunk containing
+	// it are available.
+	ErrSkyfileRangeUnrecoverable = errors.New("skyfile range is unrecoverable")
+)
+
 type (
 	// skylinkDataSource implements streamBufferDataSource on a Skylink.
 	// Notably, it creates a pcws for every single chunk in the Skylink and
@@ -33,6 +44,11 @@ type (
 		staticLayout   modules.SkyfileLayout
 		staticMetadata modules.SkyfileMetadata
 
+		// staticMetadataBytes is the raw metadata of the base sector. It is
+		// kept to validate the metadata against the renter's allowed metadata
+		// fields whenever the cached data source is reused.
+		staticMetadataBytes []byte
+
 		// The first chunk contains all of the raw data for the skylink, and the
 		// chunk fetchers contains one pcws for every chunk in the fanout. The
 		// worker sets are spun up in advance so that the HasSector queries have
@@ -40,13 +56,42 @@ type (
 		staticFirstChunk    []byte
 		staticChunkFetchers []chunkFetcher
 
+		// staticZeroFillUnrecoverable indicates whether ranges of the fanout
+		// that can't be recovered are zero-filled instead of failing the read.
+		// The ranges that were zero-filled are recorded in
+		// unrecoverableRanges.
+		staticZeroFillUnrecoverable bool
+		unrecoverableRanges         []modules.SkyfileByteRange
+
 		// Utilities
 		staticCtx        context.Context
 		staticCancelFunc context.CancelFunc
 		staticRenter     *Renter
+		mu               sync.Mutex
+	}
+
+	// fanoutChunkDownload is a helper type that pairs the download of a fanout
+	// chunk with the range of the skyfile it covers.
+	fanoutChunkDownload struct {
+		staticRange        modules.SkyfileByteRange
+		staticResponseChan chan *downloadResponse
 	}
 )
 
+// zeroFillDataSourceID returns the ID of the data source for a skylink that
+// zero-fills unrecoverable ranges. It differs from the skylink's regular data
+// source ID to prevent streams that fail on unrecoverable ranges from sharing a
+// stream buffer with streams that don't.
+func zeroFillDataSourceID(link modules.Skylink) modules.DataSourceID {
+	return modules.DataSourceID(crypto.HashAll(link.DataSourceID(), "zerofill"))
+}
+
+// unrecoverableRangeErr returns an error that describes the given
+// unrecoverable range of a skyfile.
+func unrecoverableRangeErr(br modules.SkyfileByteRange) error {
+	return errors.AddContext(ErrSkyfileRangeUnrecoverable, fmt.Sprintf("bytes [%v, %v) in fanout chunk %v", br.Offset, br.Offset+br.Length, br.ChunkIndex))
+}
+
 // DataSize implements streamBufferDataSource
 func (sds *skylinkDataSource) DataSize() uint64 {
 	return sds.staticLayout.Filesize
@@ -72,6 +117,53 @@ func (sds *skylinkDataSource) RequestSize() uint64 {
 	return skylinkDataSourceRequestSize
 }
 
+// UnrecoverableRanges returns the ranges of the skyfile that were zero-filled
+// because they couldn't be recovered, sorted by their offset.
+func (sds *skylinkDataSource) UnrecoverableRanges() []modules.SkyfileByteRange {
+	sds.mu.Lock()
+	ranges := append([]modules.SkyfileByteRange{}, sds.unrecoverableRanges...)
+	sds.mu.Unlock()
+	sort.Slice(ranges, func(i, j int) bool {
+		return ranges[i].Offset < ranges[j].Offset
+	})
+	return ranges
+}
+
+// managedAddUnrecoverableRange records a range of the skyfile that was
+// zero-filled. Ranges that were already recorded are ignored.
+func (sds *skylinkDataSource) managedAddUnrecoverableRange(br modules.SkyfileByteRange) {
+	sds.mu.Lock()
+	defer sds.mu.Unlock()
+	for _, existing := range sds.unrecoverableRanges {
+		if existing == br {
+			return
+		}
+	}
+	sds.unrecoverableRanges = append(sds.unrecoverableRanges, br)
+}
+
+// managedCheckRedundancy verifies that enough pieces of the first fanout chunk
+// are reachable to recover it. If sampleChunk is set, a random other chunk of
+// the fanout is checked as well. Small skyfiles without a fanout always pass
+// since their data is part of the base sector.
+func (sds *skylinkDataSource) managedCheckRedundancy(ctx context.Context, sampleChunk bool) error {
+	numChunks := len(sds.staticChunkFetchers)
+	if numChunks == 0 {
+		return nil
+	}
+	chunkIndices := []int{0}
+	if sampleChunk && numChunks > 1 {
+		chunkIndices = append(chunkIndices, 1+fastrand.Intn(numChunks-1))
+	}
+	for _, chunkIndex := range chunkIndices {
+		err := sds.staticChunkFetchers[chunkIndex].CheckReachable(ctx)
+		if err != nil {
+			return errors.AddContext(err, fmt.Sprintf("fanout chunk %v", chunkIndex))
+		}
+	}
+	return nil
+}
+
 // SilentClose implements streamBufferDataSource
 func (sds *skylinkDataSource) SilentClose() {
 	// Cancelling the context for the data source should be sufficient. As all
@@ -81,6 +173,17 @@ func (sds *skylinkDataSource) SilentClose() {
 }
 
 // ReadStream implements streamBufferDataSource
+//
+// NOTE: the requested range doesn't need to be aligned with the segments of an
+// encrypted fanout. Every chunk download fetches the enclosing segment aligned
+// range from the hosts, decrypts it using the segment index of the piece
+// offset and trims the result to the requested bytes. Encrypted small files
+// are decrypted in full together with the base sector.
+//
+// If a fanout chunk can't be recovered, the read fails with an error that
+// contains the exact range of the skyfile that is unavailable. If the data
+// source was created to zero-fill unrecoverable ranges, the range is filled
+// with zeros and recorded instead.
 func (sds *skylinkDataSource) ReadStream(ctx context.Context, off, fetchSize uint64, pricePerMS types.Currency) chan *readResponse {
 	// Prepare the response channel
 	responseChan := make(chan *readResponse, 1)
@@ -114,7 +217,7 @@ func (sds *skylinkDataSource) ReadStream(ctx context.Context, off, fetchSize uin
 	if fetchSize%chunkSize != 0 {
 		numChunks += 1
 	}
-	downloadChans := make([]chan *downloadResponse, 0, numChunks)
+	downloads := make([]fanoutChunkDownload, 0, numChunks)
 
 	// Otherwise we are dealing with a large skyfile and have to aggregate the
 	// download responses for every chunk in the fanout. We keep reading from
@@ -133,15 +236,27 @@ func (sds *skylinkDataSource) ReadStream(ctx context.Context, off, fetchSize uin
 			downloadSize = remainingBytes
 		}
 
-		// Schedule the download.
+		// Schedule the download. If the download can't be launched because
+		// the chunk's pieces aren't available, the failure is treated like a
+		// failed download of the chunk.
 		respChan, err := sds.staticChunkFetchers[chunkIndex].Download(ctx, pricePerMS, offsetInChunk, downloadSize)
-		if err != nil {
+		if errors.Contains(err, ErrRootNotFound) {
+			respChan = make(chan *downloadResponse, 1)
+			respChan <- &downloadResponse{err: err}
+		} else if err != nil {
 			responseChan <- &readResponse{
 				staticErr: errors.AddContext(err, "unable to start download"),
 			}
 			return responseChan
 		}
-		downloadChans = append(downloadChans, respChan)
+		downloads = append(downloads, fanoutChunkDownload{
+			staticRange: modules.SkyfileByteRange{
+				Offset:     off,
+				Length:     downloadSize,
+				ChunkIndex: chunkIndex,
+			},
+			staticResponseChan: respChan,
+		})
 
 		off += downloadSize
 		n += downloadSize
@@ -151,21 +266,28 @@ func (sds *skylinkDataSource) ReadStream(ctx context.Context, off, fetchSize uin
 	// and sends it as a single response over the response channel.
 	err := sds.staticRenter.tg.Launch(func() {
 		data := make([]byte, fetchSize)
-		offset := 0
+		var offset uint64
 		failed := false
 
-		for _, respChan := range downloadChans {
-			resp := <-respChan
-			if resp.err == nil {
-				n := copy(data[offset:], resp.data)
-				offset += n
-				continue
-			}
-			if !failed {
+		for _, download := range downloads {
+			resp := <-download.staticResponseChan
+			br := download.staticRange
+			switch {
+			case resp.err == nil:
+				copy(data[offset:offset+br.Length], resp.data)
+			case sds.staticZeroFillUnrecoverable && ctx.Err() == nil && isUnrecoverableChunkErr(resp.err):
+				// Leave the range zeroed and remember it.
+				sds.managedAddUnrecoverableRange(br)
+			case !failed:
 				failed = true
-				responseChan <- &readResponse{staticErr: resp.err}
+				err := resp.err
+				if ctx.Err() == nil {
+					err = errors.Compose(unrecoverableRangeErr(br), err)
+				}
+				responseChan <- &readResponse{staticErr: err}
 				close(responseChan)
 			}
+			offset += br.Length
 		}
 
 		if !failed {
@@ -179,8 +301,32 @@ func (sds *skylinkDataSource) ReadStream(ctx context.Context, off, fetchSize uin
 	return responseChan
 }
 
+// isUnrecoverableChunkErr returns true if the error indicates that a fanout
+// chunk can't be recovered because not enough of its pieces are available.
+// Timeouts and other failures might be transient and are not considered
+// unrecoverable.
+func isUnrecoverableChunkErr(err error) bool {
+	if errors.Contains(err, ErrProjectTimedOut) {
+		return false
+	}
+	return errors.Contains(err, errNotEnoughPieces) || errors.Contains(err, ErrRootNotFound)
+}
+
 // managedDownloadByRoot will fetch data using the merkle root of that data.
 func (r *Renter) managedDownloadByRoot(ctx context.Context, root crypto.Hash, offset, length uint64, pricePerMS types.Currency) ([]byte, error) {
+	data, _, err := r.managedDownloadByRootWithStats(ctx, root, offset, length, pricePerMS)
+	return data, err
+}
+
+// managedDownloadByRootWithStats will fetch data using the merkle root of that
+// data and return information about the workers that were launched to fetch
+// it.
+func (r *Renter) managedDownloadByRootWithStats(ctx context.Context, root crypto.Hash, offset, length uint64, pricePerMS types.Currency) (_ []byte, stats modules.DownloadByRootStats, err error) {
+	start := time.Now()
+	defer func() {
+		stats.Duration = time.Since(start)
+	}()
+
 	// Create a context that dies when the function ends, this will cancel all
 	// of the worker jobs that get created by this function.
 	ctx, cancel := context.WithCancel(ctx)
@@ -195,11 +341,11 @@ func (r *Renter) managedDownloadByRoot(ctx context.Context, root crypto.Hash, of
 	ptec := modules.NewPassthroughErasureCoder()
 	tpsk, err := crypto.NewSiaKey(crypto.TypePlain, nil)
 	if err != nil {
-		return nil, errors.AddContext(err, "unable to create plain skykey")
+		return nil, stats, errors.AddContext(err, "unable to create plain skykey")
 	}
 	pcws, err := r.newPCWSByRoots(ctx, []crypto.Hash{root}, ptec, tpsk, 0)
 	if err != nil {
-		return nil, errors.AddContext(err, "unable to create the worker set for this skylink")
+		return nil, stats, errors.AddContext(err, "unable to create the worker set for this skylink")
 	}
 
 	// Download the base sector. The base sector contains the metadata, without
@@ -209,23 +355,30 @@ func (r *Renter) managedDownloadByRoot(ctx context.Context, root crypto.Hash, of
 	// on the download request, this will fire if it takes too long.
 	respChan, err := pcws.managedDownload(ctx, pricePerMS, offset, length)
 	if err != nil {
-		return nil, errors.AddContext(err, "unable to start download")
+		return nil, stats, errors.AddContext(err, "unable to start download")
 	}
 	resp := <-respChan
+	for _, lw := range resp.launchedWorkers {
+		hostStats := lw.stats()
+		stats.Hosts = append(stats.Hosts, hostStats)
+		stats.TotalCost = stats.TotalCost.Add(hostStats.Cost)
+	}
 	if resp.err != nil {
-		return nil, errors.AddContext(resp.err, "base sector download did not succeed")
+		return nil, stats, errors.AddContext(resp.err, "base sector download did not succeed")
 	}
 	baseSector := resp.data
 	if len(baseSector) < modules.SkyfileLayoutSize {
-		return nil, errors.New("download did not fetch enough data, layout cannot be decoded")
+		return nil, stats, errors.New("download did not fetch enough data, layout cannot be decoded")
 	}
 
-	return baseSector, nil
+	return baseSector, stats, nil
 }
 
 // skylinkDataSource will create a streamBufferDataSource for the data contained
 // inside of a Skylink. The function will not return until the base sector and
-// all skyfile metadata has been retrieved.
+// all skyfile metadata has been retrieved. If zeroFillUnrecoverable is set,
+// ranges of the fanout that can't be recovered are zero-filled instead of
+// failing the read.
 //
 // NOTE: Skylink data sources are cached and outlive the user's request because
 // multiple different callers may want to use the same data source. We do have
@@ -233,7 +386,17 @@ func (r *Renter) managedDownloadByRoot(ctx context.Context, root crypto.Hash, of
 // timeout. This can be optimized to always create the data source when it was
 // requested, but we should only do so after gathering some real world feedback
 // that indicates we would benefit from this.
-func (r *Renter) skylinkDataSource(link modules.Skylink, timeout time.Duration, pricePerMS types.Currency) (streamBufferDataSource, error) {
+func (r *Renter) skylinkDataSource(link modules.Skylink, timeout time.Duration, pricePerMS types.Currency, zeroFillUnrecoverable bool) (*skylinkDataSource, error) {
+	baseSector, err := r.managedFetchSkylinkBaseSector(link, timeout, pricePerMS)
+	if err != nil {
+		return nil, err
+	}
+	return r.newSkylinkDataSource(link, baseSector, zeroFillUnrecoverable)
+}
+
+// managedFetchSkylinkBaseSector downloads the base sector of a skylink. The
+// timeout only applies to downloading the base sector.
+func (r *Renter) managedFetchSkylinkBaseSector(link modules.Skylink, timeout time.Duration, pricePerMS types.Currency) ([]byte, error) {
 	// Create the context using the given timeout, this timeout should only be
 	// applicable to downloading the base sector because the data source might
 	// outlive the request.
@@ -260,6 +423,17 @@ func (r *Renter) skylinkDataSource(link modules.Skylink, timeout time.Duration,
 	if err != nil {
 		return nil, errors.AddContext(err, "unable to download base sector")
 	}
+	return baseSector, nil
+}
+
+// newSkylinkDataSource creates a streamBufferDataSource for the skylink from
+// its downloaded base sector. An encrypted base sector is decrypted in place.
+func (r *Renter) newSkylinkDataSource(link modules.Skylink, baseSector []byte, zeroFillUnrecoverable bool) (*skylinkDataSource, error) {
+	// Make sure the layout version is supported before doing any more work.
+	err := modules.ValidateSkyfileVersion(baseSector)
+	if err != nil {
+		return nil, errors.AddContext(err, "unable to parse base sector")
+	}
 
 	// Check if the base sector is encrypted, and attempt to decrypt it.
 	// This will fail if we don't have the decryption key.
@@ -276,6 +450,22 @@ func (r *Renter) skylinkDataSource(link modules.Skylink, timeout time.Duration,
 	if err != nil {
 		return nil, errors.AddContext(err, "error parsing skyfile metadata")
 	}
+	metadataBytes := append([]byte(nil), skyfileMetadataBytes(baseSector, layout)...)
+	err = r.managedValidateSkyfileMetadataBytes(metadataBytes)
+	if err != nil {
+		return nil, err
+	}
+	// Inconsistent layouts and skylinks with a mismatching fetch size are
+	// rejected when they are uploaded, pinned or restored but can still be
+	// read.
+	err = modules.ValidateSkyfileLayout(layout, fanoutBytes, metadata)
+	if err != nil {
+		r.log.Printf("WARN: layout of skylink %v is inconsistent: %v", link, err)
+	}
+	err = modules.ValidateSkylinkFetchSize(link, layout)
+	if err != nil {
+		r.log.Printf("WARN: fetch size of skylink %v doesn't match its layout: %v", link, err)
+	}
 
 	// Create the context for the data source - a child of the renter
 	// threadgroup but otherwise independent.
@@ -314,14 +504,22 @@ func (r *Renter) skylinkDataSource(link modules.Skylink, timeout time.Duration,
 		}
 	}
 
+	id := link.DataSourceID()
+	if zeroFillUnrecoverable {
+		id = zeroFillDataSourceID(link)
+	}
 	sds := &skylinkDataSource{
-		staticID:       link.DataSourceID(),
+		staticID:       id,
 		staticLayout:   layout,
 		staticMetadata: metadata,
 
+		staticMetadataBytes: metadataBytes,
+
 		staticFirstChunk:    firstChunk,
 		staticChunkFetchers: fanoutChunkFetchers,
 
+		staticZeroFillUnrecoverable: zeroFillUnrecoverable,
+
 		staticCtx:        dsCtx,
 		staticCancelFunc: cancelFunc,
 		staticRenter:     r,
@@ -3,15 +3,20 @@ package renter
 import (
 	"bytes"
 	"context"
+	"fmt"
+	"io/ioutil"
 	"reflect"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"gitlab.com/NebulousLabs/Sia/crypto"
 	"gitlab.com/NebulousLabs/Sia/modules"
 	"gitlab.com/NebulousLabs/Sia/types"
+	"gitlab.com/NebulousLabs/errors"
 	"gitlab.com/NebulousLabs/fastrand"
+	"gitlab.com/NebulousLabs/threadgroup"
 )
 
 // mockProjectChunkWorkerSet is a mock object implementing the chunkFetcher
@@ -31,6 +36,65 @@ func (m *mockProjectChunkWorkerSet) Download(ctx context.Context, pricePerMS typ
 	return m.staticDownloadResponseChan, m.staticErr
 }
 
+// CheckReachable implements the chunkFetcher interface.
+func (m *mockProjectChunkWorkerSet) CheckReachable(ctx context.Context) error {
+	return nil
+}
+
+// countingChunkFetcher is a mock object implementing the chunkFetcher interface
+// which keeps track of how many downloads were started.
+type countingChunkFetcher struct {
+	staticData []byte
+	downloads  uint64
+}
+
+// Download implements the chunkFetcher interface.
+func (c *countingChunkFetcher) Download(ctx context.Context, pricePerMS types.Currency, offset, length uint64) (chan *downloadResponse, error) {
+	atomic.AddUint64(&c.downloads, 1)
+	responseChan := make(chan *downloadResponse, 1)
+	responseChan <- &downloadResponse{
+		data: c.staticData[offset : offset+length],
+	}
+	return responseChan, nil
+}
+
+// CheckReachable implements the chunkFetcher interface.
+func (c *countingChunkFetcher) CheckReachable(ctx context.Context) error {
+	return nil
+}
+
+// unavailableChunkFetcher is a mock object implementing the chunkFetcher
+// interface for a chunk that doesn't have enough pieces available.
+type unavailableChunkFetcher struct{}
+
+// Download implements the chunkFetcher interface.
+func (unavailableChunkFetcher) Download(ctx context.Context, pricePerMS types.Currency, offset, length uint64) (chan *downloadResponse, error) {
+	return nil, errors.Compose(errNotEnoughPieces, ErrRootNotFound)
+}
+
+// CheckReachable implements the chunkFetcher interface.
+func (unavailableChunkFetcher) CheckReachable(ctx context.Context) error {
+	return ErrInsufficientRedundancy
+}
+
+// failingChunkFetcher is a mock object implementing the chunkFetcher interface
+// for a chunk whose download fails with the given error.
+type failingChunkFetcher struct {
+	staticErr error
+}
+
+// Download implements the chunkFetcher interface.
+func (f failingChunkFetcher) Download(ctx context.Context, pricePerMS types.Currency, offset, length uint64) (chan *downloadResponse, error) {
+	responseChan := make(chan *downloadResponse, 1)
+	responseChan <- &downloadResponse{err: f.staticErr}
+	return responseChan, nil
+}
+
+// CheckReachable implements the chunkFetcher interface.
+func (failingChunkFetcher) CheckReachable(ctx context.Context) error {
+	return nil
+}
+
 // newChunkFetcher returns a chunk fetcher.
 func newChunkFetcher(data []byte, err error) chunkFetcher {
 	responseChan := make(chan *downloadResponse, 1)
@@ -50,6 +114,71 @@ func TestSkylinkDataSource(t *testing.T) {
 	t.Run("large", testSkylinkDataSourceLargeFile)
 }
 
+// TestSkylinkDataSourceStreamFromOffset verifies that a stream created at an
+// offset into a multi-chunk skyfile returns the data from that offset onwards
+// without fetching any of the chunks before it.
+func TestSkylinkDataSourceStreamFromOffset(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	// Create a data source with 3 fanout chunks.
+	chunkSize := modules.SectorSize
+	allData := fastrand.Bytes(int(3 * chunkSize))
+	fetchers := make([]*countingChunkFetcher, 3)
+	chunkFetchers := make([]chunkFetcher, 3)
+	for i := range fetchers {
+		fetchers[i] = &countingChunkFetcher{staticData: allData[uint64(i)*chunkSize : uint64(i+1)*chunkSize]}
+		chunkFetchers[i] = fetchers[i]
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	sds := &skylinkDataSource{
+		staticID: modules.DataSourceID(crypto.Hash{1, 2, 3}),
+		staticLayout: modules.SkyfileLayout{
+			Version:            modules.SkyfileVersion,
+			Filesize:           uint64(len(allData)),
+			FanoutSize:         75e3,
+			FanoutDataPieces:   1,
+			FanoutParityPieces: 10,
+			CipherType:         crypto.TypePlain,
+		},
+		staticFirstChunk:    make([]byte, 0),
+		staticChunkFetchers: chunkFetchers,
+
+		staticCancelFunc: cancel,
+		staticCtx:        ctx,
+		staticRenter:     new(Renter),
+	}
+
+	// Resume the download from within the second chunk.
+	var tg threadgroup.ThreadGroup
+	defer func() {
+		if err := tg.Stop(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	sbs := newStreamBufferSet(&tg)
+	offset := chunkSize + chunkSize/2 + 3
+	stream := sbs.callNewStream(sds, offset, 0, types.ZeroCurrency, 0)
+	defer stream.Close()
+	data, err := ioutil.ReadAll(stream)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, allData[offset:]) {
+		t.Fatal("resumed download returned the wrong data")
+	}
+
+	// The first chunk shouldn't have been fetched.
+	if n := atomic.LoadUint64(&fetchers[0].downloads); n != 0 {
+		t.Fatalf("expected no downloads from the first chunk but got %v", n)
+	}
+	if atomic.LoadUint64(&fetchers[1].downloads) == 0 || atomic.LoadUint64(&fetchers[2].downloads) == 0 {
+		t.Fatal("expected downloads from the remaining chunks")
+	}
+}
+
 // testSkylinkDataSourceSmallFile verifies we can read from a datasource for a
 // small skyfile.
 func testSkylinkDataSourceSmallFile(t *testing.T) {
@@ -225,3 +354,241 @@ func testSkylinkDataSourceLargeFile(t *testing.T) {
 		t.Fatal("unexpected")
 	}
 }
+
+// TestSkylinkDataSourceUnrecoverableChunk verifies that a stream of a skyfile
+// that is missing a fanout chunk reports the unrecoverable ranges and that the
+// data source zero-fills them when asked to.
+func TestSkylinkDataSourceUnrecoverableChunk(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	// Create the data of a skyfile with 3 fanout chunks. The second chunk is
+	// unavailable.
+	chunkSize := modules.SectorSize
+	allData := fastrand.Bytes(int(3 * chunkSize))
+	newDataSourceWithFetcher := func(zeroFill bool, fetcher chunkFetcher) *skylinkDataSource {
+		ctx, cancel := context.WithCancel(context.Background())
+		return &skylinkDataSource{
+			staticID: modules.DataSourceID(crypto.HashObject(fastrand.Bytes(16))),
+			staticLayout: modules.SkyfileLayout{
+				Version:            modules.SkyfileVersion,
+				Filesize:           uint64(len(allData)),
+				FanoutSize:         75e3,
+				FanoutDataPieces:   1,
+				FanoutParityPieces: 10,
+				CipherType:         crypto.TypePlain,
+			},
+			staticFirstChunk: make([]byte, 0),
+			staticChunkFetchers: []chunkFetcher{
+				&countingChunkFetcher{staticData: allData[:chunkSize]},
+				fetcher,
+				&countingChunkFetcher{staticData: allData[2*chunkSize:]},
+			},
+			staticZeroFillUnrecoverable: zeroFill,
+
+			staticCancelFunc: cancel,
+			staticCtx:        ctx,
+			staticRenter:     new(Renter),
+		}
+	}
+	newDataSource := func(zeroFill bool) *skylinkDataSource {
+		return newDataSourceWithFetcher(zeroFill, unavailableChunkFetcher{})
+	}
+
+	var tg threadgroup.ThreadGroup
+	defer func() {
+		if err := tg.Stop(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	sbs := newStreamBufferSet(&tg)
+
+	// By default the stream fails at the first unrecoverable range, and the
+	// error contains the exact range.
+	stream := sbs.callNewStream(newDataSource(false), 0, 0, types.ZeroCurrency, 0)
+	data, err := ioutil.ReadAll(stream)
+	if !errors.Contains(err, ErrSkyfileRangeUnrecoverable) {
+		t.Fatal("expected ErrSkyfileRangeUnrecoverable", err)
+	}
+	expectedRange := fmt.Sprintf("bytes [%v, %v) in fanout chunk 1", chunkSize, chunkSize+skylinkDataSourceRequestSize)
+	if !strings.Contains(err.Error(), expectedRange) {
+		t.Fatalf("expected error to contain '%v' but got '%v'", expectedRange, err)
+	}
+	if !bytes.Equal(data, allData[:chunkSize]) {
+		t.Fatal("data before the unrecoverable chunk doesn't match")
+	}
+	if err := stream.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// In zero-fill mode the whole file can be read and the unrecoverable
+	// chunk is filled with zeros.
+	sds := newDataSource(true)
+	stream = sbs.callNewStream(sds, 0, 0, types.ZeroCurrency, 0)
+	defer stream.Close()
+	data, err = ioutil.ReadAll(stream)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := append([]byte{}, allData...)
+	copy(expected[chunkSize:2*chunkSize], make([]byte, chunkSize))
+	if !bytes.Equal(data, expected) {
+		t.Fatal("zero-filled data doesn't match")
+	}
+
+	// The recorded ranges should cover exactly the missing chunk.
+	offset := chunkSize
+	for _, br := range sds.UnrecoverableRanges() {
+		if br.Offset != offset || br.ChunkIndex != 1 {
+			t.Fatal("unexpected range", br)
+		}
+		offset += br.Length
+	}
+	if offset != 2*chunkSize {
+		t.Fatal("ranges don't cover the missing chunk", sds.UnrecoverableRanges())
+	}
+
+	// A download that fails because it didn't find enough pieces is also
+	// zero-filled.
+	sds = newDataSourceWithFetcher(true, failingChunkFetcher{staticErr: errNotEnoughPieces})
+	stream = sbs.callNewStream(sds, 0, 0, types.ZeroCurrency, 0)
+	defer stream.Close()
+	data, err = ioutil.ReadAll(stream)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, expected) {
+		t.Fatal("zero-filled data doesn't match")
+	}
+
+	// Timeouts and other failures might be transient and are never
+	// zero-filled, even in zero-fill mode.
+	errWorker := errors.New("worker failure")
+	tests := []struct {
+		fetchErr    error
+		expectedErr error
+	}{
+		{errors.Compose(ErrProjectTimedOut, ErrRootNotFound), ErrProjectTimedOut},
+		{errWorker, errWorker},
+	}
+	for _, test := range tests {
+		sds = newDataSourceWithFetcher(true, failingChunkFetcher{staticErr: test.fetchErr})
+		stream = sbs.callNewStream(sds, 0, 0, types.ZeroCurrency, 0)
+		defer stream.Close()
+		_, err = ioutil.ReadAll(stream)
+		if !errors.Contains(err, test.expectedErr) {
+			t.Fatalf("expected error '%v' but got '%v'", test.expectedErr, err)
+		}
+		if len(sds.UnrecoverableRanges()) != 0 {
+			t.Fatal("failed range shouldn't be reported as unrecoverable", sds.UnrecoverableRanges())
+		}
+	}
+}
+
+// TestSkylinkDataSourceCheckRedundancy verifies that the preflight check of the
+// skylink data source fails if one of the checked fanout chunks doesn't have
+// enough reachable pieces.
+func TestSkylinkDataSourceCheckRedundancy(t *testing.T) {
+	t.Parallel()
+
+	data := fastrand.Bytes(int(modules.SectorSize))
+	newDataSource := func(fetchers ...chunkFetcher) *skylinkDataSource {
+		ctx, cancel := context.WithCancel(context.Background())
+		return &skylinkDataSource{
+			staticChunkFetchers: fetchers,
+			staticCancelFunc:    cancel,
+			staticCtx:           ctx,
+		}
+	}
+
+	// A small file without fanout always passes.
+	sds := newDataSource()
+	defer sds.SilentClose()
+	if err := sds.managedCheckRedundancy(context.Background(), true); err != nil {
+		t.Fatal(err)
+	}
+
+	// An unreachable first chunk fails the check.
+	sds = newDataSource(unavailableChunkFetcher{}, newChunkFetcher(data, nil))
+	defer sds.SilentClose()
+	err := sds.managedCheckRedundancy(context.Background(), false)
+	if !errors.Contains(err, ErrInsufficientRedundancy) {
+		t.Fatal("expected ErrInsufficientRedundancy", err)
+	}
+	if !strings.Contains(err.Error(), "fanout chunk 0") {
+		t.Fatal("expected error to contain the chunk index", err)
+	}
+
+	// An unreachable second chunk is only detected when sampling.
+	sds = newDataSource(newChunkFetcher(data, nil), unavailableChunkFetcher{})
+	defer sds.SilentClose()
+	if err := sds.managedCheckRedundancy(context.Background(), false); err != nil {
+		t.Fatal(err)
+	}
+	err = sds.managedCheckRedundancy(context.Background(), true)
+	if !errors.Contains(err, ErrInsufficientRedundancy) {
+		t.Fatal("expected ErrInsufficientRedundancy", err)
+	}
+	if !strings.Contains(err.Error(), "fanout chunk 1") {
+		t.Fatal("expected error to contain the chunk index", err)
+	}
+}
+
+// TestDownloadSkylinkCachedPreflight verifies that the preflight check is also
+// run for skylinks whose data source is already cached in the stream buffer
+// set.
+func TestDownloadSkylinkCachedPreflight(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	rt, err := newRenterTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := rt.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	r := rt.renter
+
+	// Add a data source with an unreachable fanout chunk to the stream buffer
+	// set.
+	link, err := modules.NewSkylinkV1(crypto.Hash{1}, 0, modules.SectorSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	sds := &skylinkDataSource{
+		staticID: link.DataSourceID(),
+		staticLayout: modules.SkyfileLayout{
+			Filesize:         modules.SectorSize,
+			FanoutDataPieces: 1,
+		},
+		staticChunkFetchers: []chunkFetcher{unavailableChunkFetcher{}},
+		staticCtx:           ctx,
+		staticCancelFunc:    cancel,
+		staticRenter:        r,
+	}
+	stream := r.staticStreamBufferSet.callNewStream(sds, 0, 0, types.ZeroCurrency, 0)
+	defer stream.Close()
+
+	// Downloading without a preflight check serves the cached stream.
+	_, _, streamer, err := r.managedDownloadSkylink(link, 0, 0, 0, types.ZeroCurrency, false, skylinkPreflightNone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := streamer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Downloading with a preflight check fails.
+	_, _, _, err = r.managedDownloadSkylink(link, 0, 0, 0, types.ZeroCurrency, false, skylinkPreflightFirstChunk)
+	if !errors.Contains(err, ErrInsufficientRedundancy) {
+		t.Fatal("expected ErrInsufficientRedundancy", err)
+	}
+}
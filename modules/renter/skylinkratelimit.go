@@ -0,0 +1,141 @@
+package renter
+
+import (
+	"io"
+	"time"
+
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/types"
+	"gitlab.com/NebulousLabs/errors"
+	"gitlab.com/NebulousLabs/ratelimit"
+)
+
+const (
+	// skylinkDownloadRateLimitPacketSize is the size of the packets that reads
+	// from a rate limited skylink stream are split into. This keeps a single
+	// large read from exceeding the rate limit by a lot before it is
+	// throttled.
+	skylinkDownloadRateLimitPacketSize = 1 << 14 // 16 KiB
+)
+
+var (
+	// errNegativeSkylinkDownloadRateLimit is returned when a negative rate
+	// limit is provided for skylink downloads.
+	errNegativeSkylinkDownloadRateLimit = errors.New("skylink download rate limit can't be negative")
+
+	// errWriteToSkylinkStream is returned when something tries to write to
+	// the stream of a skylink download.
+	errWriteToSkylinkStream = errors.New("can't write to the stream of a skylink download")
+)
+
+type (
+	// rateLimitedStreamer is a streamer whose reads are throttled by a rate
+	// limit. Since a stream only fetches a limited amount of data ahead of
+	// the reader, throttling the reads of the stream also throttles the
+	// reads from its underlying data source.
+	rateLimitedStreamer struct {
+		modules.Streamer
+		staticReader io.Reader
+	}
+
+	// streamerReadWriter turns a streamer into the io.ReadWriter expected by
+	// the ratelimit package. Writing to it always fails.
+	streamerReadWriter struct {
+		modules.Streamer
+	}
+)
+
+// Read implements the io.Reader interface by reading from the streamer with
+// the maximum speed allowed by the rate limits.
+func (s *rateLimitedStreamer) Read(b []byte) (int, error) {
+	return s.staticReader.Read(b)
+}
+
+// Write implements the io.Writer interface.
+func (rw streamerReadWriter) Write([]byte) (int, error) {
+	return 0, errWriteToSkylinkStream
+}
+
+// DownloadSkylinkWithRateLimit will take a link and turn it into the metadata
+// and data of a download like DownloadSkylinkWithReadAhead. Reads from the
+// returned streamer are limited to readBPS bytes per second, in addition to the
+// aggregate rate limit for skylink downloads. A readBPS of 0 means that only
+// the aggregate rate limit applies.
+func (r *Renter) DownloadSkylinkWithRateLimit(link modules.Skylink, readAhead uint64, readBPS int64, timeout time.Duration, pricePerMS types.Currency) (modules.SkyfileLayout, modules.SkyfileMetadata, modules.Streamer, error) {
+	if readBPS < 0 {
+		return modules.SkyfileLayout{}, modules.SkyfileMetadata{}, nil, errNegativeSkylinkDownloadRateLimit
+	}
+	layout, metadata, streamer, err := r.callDownloadSkylink(link, 0, readAhead, timeout, pricePerMS, skylinkPreflightNone)
+	if err != nil {
+		return modules.SkyfileLayout{}, modules.SkyfileMetadata{}, nil, err
+	}
+	if readBPS > 0 {
+		rl := ratelimit.NewRateLimit(readBPS, 0, skylinkDownloadRateLimitPacketSize)
+		streamer = newRateLimitedStreamer(streamer, rl, r.tg.StopChan())
+	}
+	return layout, metadata, streamer, nil
+}
+
+// SetSkylinkDownloadRateLimit sets the aggregate rate limit in bytes per
+// second that is shared by the streams of all skylink downloads and persists
+// it. A readBPS of 0 removes the limit. The limit only applies to streams that
+// are created while it is set.
+func (r *Renter) SetSkylinkDownloadRateLimit(readBPS int64) error {
+	if err := r.tg.Add(); err != nil {
+		return err
+	}
+	defer r.tg.Done()
+	if readBPS < 0 {
+		return errNegativeSkylinkDownloadRateLimit
+	}
+	r.setSkylinkDownloadRateLimit(readBPS)
+	id := r.mu.Lock()
+	defer r.mu.Unlock(id)
+	r.persist.MaxSkylinkDownloadSpeed = readBPS
+	return r.saveSync()
+}
+
+// setSkylinkDownloadRateLimit applies the aggregate rate limit of skylink
+// downloads without persisting it.
+func (r *Renter) setSkylinkDownloadRateLimit(readBPS int64) {
+	r.staticSkylinkDownloadRateLimit.SetLimits(readBPS, 0, skylinkDownloadRateLimitPacketSize)
+}
+
+// SkylinkDownloadRateLimit returns the aggregate rate limit in bytes per
+// second of skylink downloads.
+func (r *Renter) SkylinkDownloadRateLimit() int64 {
+	readBPS, _, _ := r.staticSkylinkDownloadRateLimit.Limits()
+	return readBPS
+}
+
+// managedApplySkylinkDownloadRateLimit applies the aggregate rate limit of
+// skylink downloads to the given streamer if a limit is set.
+func (r *Renter) managedApplySkylinkDownloadRateLimit(streamer modules.Streamer) modules.Streamer {
+	if r.SkylinkDownloadRateLimit() == 0 {
+		return streamer
+	}
+	return newRateLimitedStreamer(streamer, r.staticSkylinkDownloadRateLimit, r.tg.StopChan())
+}
+
+// newRateLimitedStreamer wraps the streamer in a rateLimitedStreamer that
+// throttles its reads according to rl.
+func newRateLimitedStreamer(streamer modules.Streamer, rl *ratelimit.RateLimit, cancel <-chan struct{}) *rateLimitedStreamer {
+	return &rateLimitedStreamer{
+		Streamer:     streamer,
+		staticReader: ratelimit.NewRLReadWriter(streamerReadWriter{streamer}, rl, cancel),
+	}
+}
+
+// skylinkStream returns the stream underneath any rate limits of the given
+// streamer if there is one.
+func skylinkStream(streamer modules.Streamer) (*stream, bool) {
+	for {
+		rls, ok := streamer.(*rateLimitedStreamer)
+		if !ok {
+			break
+		}
+		streamer = rls.Streamer
+	}
+	s, ok := streamer.(*stream)
+	return s, ok
+}
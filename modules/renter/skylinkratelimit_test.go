@@ -0,0 +1,176 @@
+package renter
+
+import (
+	"bytes"
+	"io/ioutil"
+	"sync"
+	"testing"
+	"time"
+
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/types"
+	"gitlab.com/NebulousLabs/errors"
+	"gitlab.com/NebulousLabs/fastrand"
+	"gitlab.com/NebulousLabs/ratelimit"
+)
+
+// testStreamer is a modules.Streamer for testing that reads from memory.
+type testStreamer struct {
+	*bytes.Reader
+}
+
+// Close implements the io.Closer interface.
+func (ts testStreamer) Close() error { return nil }
+
+// newTestStreamer creates a testStreamer for the given data.
+func newTestStreamer(data []byte) modules.Streamer {
+	return testStreamer{bytes.NewReader(data)}
+}
+
+// readThrottled reads all data from the streamer, checks that it matches the
+// expected data and returns how long reading it took.
+func readThrottled(t *testing.T, streamer modules.Streamer, data []byte) time.Duration {
+	start := time.Now()
+	readData, err := ioutil.ReadAll(streamer)
+	if err != nil {
+		t.Error(err)
+	}
+	if !bytes.Equal(readData, data) {
+		t.Error("unexpected data")
+	}
+	return time.Since(start)
+}
+
+// checkThrottledDuration checks that reading size bytes at readBPS bytes per
+// second took approximately the expected amount of time. The first packet is
+// read without waiting.
+func checkThrottledDuration(t *testing.T, elapsed time.Duration, size, readBPS int64) {
+	minDuration := time.Duration(size-skylinkDownloadRateLimitPacketSize) * time.Second / time.Duration(readBPS)
+	maxDuration := 2 * time.Duration(size) * time.Second / time.Duration(readBPS)
+	if elapsed < minDuration || elapsed > maxDuration {
+		t.Fatalf("reading %v bytes at %v bytes/s took %v, expected between %v and %v", size, readBPS, elapsed, minDuration, maxDuration)
+	}
+}
+
+// TestRateLimitedStreamer tests that reading from a rate limited streamer
+// takes approximately the expected time.
+func TestRateLimitedStreamer(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	size := int64(4 * skylinkDownloadRateLimitPacketSize)
+	readBPS := size
+	data := fastrand.Bytes(int(size))
+
+	rl := ratelimit.NewRateLimit(readBPS, 0, skylinkDownloadRateLimitPacketSize)
+	streamer := newRateLimitedStreamer(newTestStreamer(data), rl, nil)
+	elapsed := readThrottled(t, streamer, data)
+	checkThrottledDuration(t, elapsed, size, readBPS)
+
+	// Seeking should still work and the stream shouldn't be writable.
+	_, err := streamer.Seek(0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = streamerReadWriter{streamer.Streamer}.Write(data)
+	if !errors.Contains(err, errWriteToSkylinkStream) {
+		t.Fatal("expected write to fail", err)
+	}
+}
+
+// TestSkylinkDownloadRateLimit tests that the aggregate rate limit of skylink
+// downloads is shared by all streams it is applied to.
+func TestSkylinkDownloadRateLimit(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	rt, err := newRenterTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := rt.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	r := rt.renter
+
+	// Without a limit the streamer isn't wrapped.
+	data := fastrand.Bytes(int(2 * skylinkDownloadRateLimitPacketSize))
+	streamer := newTestStreamer(data)
+	if r.managedApplySkylinkDownloadRateLimit(streamer) != streamer {
+		t.Fatal("streamer shouldn't be rate limited")
+	}
+
+	// Negative limits are rejected.
+	err = r.SetSkylinkDownloadRateLimit(-1)
+	if !errors.Contains(err, errNegativeSkylinkDownloadRateLimit) {
+		t.Fatal("expected negative limit to be rejected", err)
+	}
+	_, _, _, err = r.DownloadSkylinkWithRateLimit(modules.Skylink{}, 0, -1, 0, types.ZeroCurrency)
+	if !errors.Contains(err, errNegativeSkylinkDownloadRateLimit) {
+		t.Fatal("expected negative limit to be rejected", err)
+	}
+
+	// Set a limit and read from two streams in parallel. Together they
+	// should be limited to the aggregate limit.
+	readBPS := int64(2 * len(data))
+	err = r.SetSkylinkDownloadRateLimit(readBPS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.SkylinkDownloadRateLimit() != readBPS {
+		t.Fatal("wrong limit", r.SkylinkDownloadRateLimit())
+	}
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			readThrottled(t, r.managedApplySkylinkDownloadRateLimit(newTestStreamer(data)), data)
+		}()
+	}
+	wg.Wait()
+	checkThrottledDuration(t, time.Since(start), 2*int64(len(data)), readBPS)
+
+	// The underlying stream can still be found.
+	s := &stream{}
+	found, ok := skylinkStream(r.managedApplySkylinkDownloadRateLimit(s))
+	if !ok || found != s {
+		t.Fatal("stream not found")
+	}
+
+	// The limit is reported by the settings and persisted.
+	settings, err := r.Settings()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if settings.MaxSkylinkDownloadSpeed != readBPS {
+		t.Fatal("wrong limit in settings", settings.MaxSkylinkDownloadSpeed)
+	}
+	r, err = rt.reloadRenter(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.SkylinkDownloadRateLimit() != readBPS {
+		t.Fatal("limit wasn't persisted", r.SkylinkDownloadRateLimit())
+	}
+
+	// The limit can be changed through the settings.
+	settings.MaxSkylinkDownloadSpeed = -1
+	if err := r.SetSettings(settings); !errors.Contains(err, errNegativeSkylinkDownloadRateLimit) {
+		t.Fatal("expected negative limit to be rejected", err)
+	}
+	settings.MaxSkylinkDownloadSpeed = 0
+	if err := r.SetSettings(settings); err != nil {
+		t.Fatal(err)
+	}
+	if r.SkylinkDownloadRateLimit() != 0 {
+		t.Fatal("limit wasn't removed", r.SkylinkDownloadRateLimit())
+	}
+}
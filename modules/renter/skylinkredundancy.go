@@ -0,0 +1,153 @@
+package renter
+
+import (
+	"context"
+	"time"
+
+	"gitlab.com/NebulousLabs/Sia/crypto"
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/types"
+
+	"gitlab.com/NebulousLabs/errors"
+)
+
+// SkylinkRedundancy queries the hosts for the base sector of the given skylink
+// and for up to numChunks evenly spaced chunks of its fanout and returns how
+// many hosts hold each of the sectors. Hosts that don't answer before the
+// timeout are not counted. If numChunks is not 0, the base sector is fetched to
+// learn the fanout, but no other data of the skyfile is downloaded.
+func (r *Renter) SkylinkRedundancy(link modules.Skylink, numChunks uint64, timeout time.Duration, pricePerMS types.Currency) (modules.SkylinkRedundancy, error) {
+	if err := r.tg.Add(); err != nil {
+		return modules.SkylinkRedundancy{}, err
+	}
+	defer r.tg.Done()
+
+	// Check if link is blocked
+	if r.staticSkynetBlocklist.IsBlocked(link) {
+		return modules.SkylinkRedundancy{}, ErrSkylinkBlocked
+	}
+
+	// Create the context
+	ctx := r.tg.StopCtx()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(r.tg.StopCtx(), timeout)
+		defer cancel()
+	}
+
+	// Count the hosts of the base sector. If no host holds it, there is no
+	// way to learn the fanout.
+	var sr modules.SkylinkRedundancy
+	counts, numHosts := r.managedSectorHostCounts(ctx, []crypto.Hash{link.MerkleRoot()})
+	sr.NumHosts = numHosts
+	sr.BaseSectorHosts = counts[0]
+	if numChunks == 0 || sr.BaseSectorHosts == 0 {
+		return sr, nil
+	}
+
+	// Fetch the fanout and collect the roots of the sampled chunks.
+	fanout, err := r.managedSkylinkFanout(ctx, link, pricePerMS)
+	if err != nil {
+		return modules.SkylinkRedundancy{}, errors.AddContext(err, "unable to fetch fanout")
+	}
+	sr.DataPieces = fanout.DataPieces
+	sr.ParityPieces = fanout.ParityPieces
+	sr.NumChunks = uint64(len(fanout.ChunkRoots))
+	indices := skylinkRedundancySampleIndices(sr.NumChunks, numChunks)
+	var roots []crypto.Hash
+	for _, index := range indices {
+		roots = append(roots, fanout.ChunkRoots[index]...)
+	}
+	if len(roots) == 0 {
+		return sr, nil
+	}
+
+	// Count the hosts of the sampled chunks. The smaller number of answers
+	// of both rounds is reported.
+	counts, numHosts = r.managedSectorHostCounts(ctx, roots)
+	if numHosts < sr.NumHosts {
+		sr.NumHosts = numHosts
+	}
+	for _, index := range indices {
+		numPieces := len(fanout.ChunkRoots[index])
+		sr.Chunks = append(sr.Chunks, modules.SkylinkChunkRedundancy{
+			Index:      index,
+			PieceHosts: counts[:numPieces],
+		})
+		counts = counts[numPieces:]
+	}
+	return sr, nil
+}
+
+// managedSectorHostCounts launches a HasSector job for the given roots on every
+// worker and returns for every root the number of hosts that hold it together
+// with the number of hosts that answered. Workers that don't respond before the
+// context is closed are ignored.
+func (r *Renter) managedSectorHostCounts(ctx context.Context, roots []crypto.Hash) (counts []uint64, numHosts uint64) {
+	counts = make([]uint64, len(roots))
+
+	// Launch the jobs. The response channel is buffered to fit a response
+	// from every worker to avoid blocking them.
+	workers := r.staticWorkerPool.callWorkers()
+	responseChan := make(chan *jobHasSectorResponse, len(workers))
+	workersLaunched := 0
+	for _, w := range workers {
+		if !w.staticSupportsRHP3() {
+			continue
+		}
+		cache := w.staticCache()
+		pt := w.staticPriceTable().staticPriceTable
+		err := checkPCWSGouging(pt, cache.staticRenterAllowance, len(workers), len(roots))
+		if err != nil {
+			r.log.Debugf("price gouging for redundancy check detected in worker %v, err %v", w.staticHostPubKeyStr, err)
+			continue
+		}
+		jhs := w.newJobHasSector(ctx, responseChan, roots...)
+		_, err = w.staticJobHasSectorQueue.callAddWithEstimate(jhs)
+		if err != nil {
+			r.log.Debugf("unable to add has sector job to %v, err %v", w.staticHostPubKeyStr, err)
+			continue
+		}
+		workersLaunched++
+	}
+
+	// Collect the responses.
+	for workersResponded := 0; workersResponded < workersLaunched; workersResponded++ {
+		var resp *jobHasSectorResponse
+		select {
+		case resp = <-responseChan:
+		case <-ctx.Done():
+			return
+		}
+		if resp.staticErr != nil || len(resp.staticAvailables) != len(roots) {
+			continue
+		}
+		numHosts++
+		for i, available := range resp.staticAvailables {
+			if available {
+				counts[i]++
+			}
+		}
+	}
+	return
+}
+
+// skylinkRedundancySampleIndices returns the indices of up to sampleSize evenly
+// spaced chunks out of numChunks chunks. If more than one chunk is sampled, the
+// first and last chunk are always part of the sample.
+func skylinkRedundancySampleIndices(numChunks, sampleSize uint64) []uint64 {
+	if sampleSize > numChunks {
+		sampleSize = numChunks
+	}
+	if sampleSize == 0 {
+		return nil
+	}
+	indices := make([]uint64, sampleSize)
+	if sampleSize == 1 {
+		return indices
+	}
+	for i := range indices {
+		indices[i] = uint64(i) * (numChunks - 1) / (sampleSize - 1)
+	}
+	return indices
+}
@@ -0,0 +1,181 @@
+package renter
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"gitlab.com/NebulousLabs/Sia/crypto"
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/types"
+	"gitlab.com/NebulousLabs/errors"
+	"gitlab.com/NebulousLabs/fastrand"
+)
+
+// TestSkylinkRedundancy verifies that SkylinkRedundancy reports the hosts that
+// hold the base sector and the sampled fanout chunks of a skylink.
+func TestSkylinkRedundancy(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	wt, err := newWorkerTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := wt.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	r := wt.rt.renter
+
+	// uploadSector is a helper that uploads a sector with the given data to
+	// the host of the tester.
+	uploadSector := func(name string, data []byte) {
+		root := crypto.MerkleRoot(data)
+		link, err := modules.NewSkylinkV1(root, 0, uint64(len(data)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		siaPath, err := modules.SkynetFolder.Join(t.Name() + "-" + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sup := modules.SkyfileUploadParameters{
+			SiaPath:             siaPath,
+			BaseChunkRedundancy: 2,
+		}
+		err = r.managedUploadBaseSector(sup, data, link)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Create a 1-of-3 fanout with 3 chunks. The first and last chunk are
+	// uploaded to the host, the middle one is not.
+	chunks := make([][]byte, 3)
+	var fanoutBytes []byte
+	for i := range chunks {
+		chunks[i] = fastrand.Bytes(int(modules.SectorSize))
+		root := crypto.MerkleRoot(chunks[i])
+		fanoutBytes = append(fanoutBytes, root[:]...)
+	}
+	uploadSector("chunk0", chunks[0])
+	uploadSector("chunk2", chunks[2])
+
+	// Build a base sector with the fanout and upload it.
+	metadataBytes, err := modules.SkyfileMetadataBytes(modules.SkyfileMetadata{Filename: "file"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sl := modules.SkyfileLayout{
+		Version:            modules.SkyfileVersion,
+		Filesize:           uint64(len(chunks)) * modules.SectorSize,
+		MetadataSize:       uint64(len(metadataBytes)),
+		FanoutSize:         uint64(len(fanoutBytes)),
+		FanoutDataPieces:   1,
+		FanoutParityPieces: 2,
+		CipherType:         crypto.TypePlain,
+	}
+	baseSector, fetchSize := modules.BuildBaseSector(sl.Encode(), fanoutBytes, metadataBytes, nil)
+	skylink, err := modules.NewSkylinkV1(crypto.MerkleRoot(baseSector), 0, fetchSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	uploadSector("base", baseSector)
+
+	// Without sampling, only the base sector is checked.
+	sr, err := r.SkylinkRedundancy(skylink, 0, time.Minute, types.ZeroCurrency)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sr.NumHosts != 1 || sr.BaseSectorHosts != 1 || sr.NumChunks != 0 || len(sr.Chunks) != 0 {
+		t.Fatal("unexpected redundancy", sr)
+	}
+	if !sr.Recoverable() {
+		t.Fatal("skylink should be recoverable")
+	}
+
+	// Sampling all chunks should reveal the missing one.
+	sr, err = r.SkylinkRedundancy(skylink, 10, time.Minute, types.ZeroCurrency)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []modules.SkylinkChunkRedundancy{
+		{Index: 0, PieceHosts: []uint64{1}},
+		{Index: 1, PieceHosts: []uint64{0}},
+		{Index: 2, PieceHosts: []uint64{1}},
+	}
+	if sr.NumHosts != 1 || sr.BaseSectorHosts != 1 || sr.NumChunks != 3 || sr.DataPieces != 1 || sr.ParityPieces != 2 {
+		t.Fatal("unexpected redundancy", sr)
+	}
+	if !reflect.DeepEqual(sr.Chunks, expected) {
+		t.Fatal("unexpected chunks", sr.Chunks)
+	}
+	if sr.Recoverable() {
+		t.Fatal("skylink shouldn't be recoverable")
+	}
+
+	// Sampling 2 chunks only checks the first and last one.
+	sr, err = r.SkylinkRedundancy(skylink, 2, time.Minute, types.ZeroCurrency)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(sr.Chunks, []modules.SkylinkChunkRedundancy{expected[0], expected[2]}) {
+		t.Fatal("unexpected chunks", sr.Chunks)
+	}
+	if !sr.Recoverable() {
+		t.Fatal("skylink should be recoverable")
+	}
+
+	// A skylink that no host holds has no redundancy.
+	unknown, err := modules.NewSkylinkV1(crypto.Hash{1, 2, 3}, 0, fetchSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sr, err = r.SkylinkRedundancy(unknown, 10, time.Minute, types.ZeroCurrency)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sr.NumHosts != 1 || sr.BaseSectorHosts != 0 || len(sr.Chunks) != 0 || sr.Recoverable() {
+		t.Fatal("unexpected redundancy", sr)
+	}
+
+	// Blocked skylinks should be rejected.
+	err = r.UpdateSkynetBlocklist([]crypto.Hash{crypto.HashObject(skylink.MerkleRoot())}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = r.SkylinkRedundancy(skylink, 10, time.Minute, types.ZeroCurrency)
+	if !errors.Contains(err, ErrSkylinkBlocked) {
+		t.Fatal("expected blocked error", err)
+	}
+}
+
+// TestSkylinkRedundancySampleIndices is a unit test for
+// skylinkRedundancySampleIndices.
+func TestSkylinkRedundancySampleIndices(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		numChunks  uint64
+		sampleSize uint64
+		indices    []uint64
+	}{
+		{0, 5, nil},
+		{5, 0, nil},
+		{5, 1, []uint64{0}},
+		{5, 2, []uint64{0, 4}},
+		{5, 3, []uint64{0, 2, 4}},
+		{3, 5, []uint64{0, 1, 2}},
+		{10, 4, []uint64{0, 3, 6, 9}},
+	}
+	for _, test := range tests {
+		indices := skylinkRedundancySampleIndices(test.numChunks, test.sampleSize)
+		if !reflect.DeepEqual(indices, test.indices) {
+			t.Errorf("%v chunks, sample %v: expected %v but got %v", test.numChunks, test.sampleSize, test.indices, indices)
+		}
+	}
+}
@@ -103,6 +103,29 @@ func (sb *SkynetBlocklist) IsHashBlocked(hash crypto.Hash) bool {
 	return ok
 }
 
+// AreBlocked indicates for every skylink whether it is currently blocked. The
+// results are returned in the same order as the skylinks. Unlike calling
+// IsBlocked for every skylink, the lock is only acquired once.
+func (sb *SkynetBlocklist) AreBlocked(skylinks []modules.Skylink) []bool {
+	hashes := make([]crypto.Hash, 0, len(skylinks))
+	for _, skylink := range skylinks {
+		hashes = append(hashes, crypto.HashObject(skylink.MerkleRoot()))
+	}
+	return sb.AreHashesBlocked(hashes)
+}
+
+// AreHashesBlocked indicates for every hash whether it is currently blocked.
+// The results are returned in the same order as the hashes.
+func (sb *SkynetBlocklist) AreHashesBlocked(hashes []crypto.Hash) []bool {
+	blocked := make([]bool, len(hashes))
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	for i, hash := range hashes {
+		_, blocked[i] = sb.hashes[hash]
+	}
+	return blocked
+}
+
 // UpdateBlocklist updates the list of skylinks that are blocked.
 func (sb *SkynetBlocklist) UpdateBlocklist(additions, removals []crypto.Hash) error {
 	sb.mu.Lock()
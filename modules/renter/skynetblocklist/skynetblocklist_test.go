@@ -150,6 +150,65 @@ func TestPersist(t *testing.T) {
 	}
 }
 
+// TestAreBlocked verifies that the batch queries of the blocklist match the
+// results of the single item queries.
+func TestAreBlocked(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	sb, err := New(testDir(t.Name()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Create a mixed set of skylinks and block every other one.
+	var skylinks []modules.Skylink
+	var hashes, blocked []crypto.Hash
+	for i := 0; i < 10; i++ {
+		var root crypto.Hash
+		fastrand.Read(root[:])
+		skylink, err := modules.NewSkylinkV1(root, 0, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hash := crypto.HashObject(skylink.MerkleRoot())
+		skylinks = append(skylinks, skylink)
+		hashes = append(hashes, hash)
+		if i%2 == 0 {
+			blocked = append(blocked, hash)
+		}
+	}
+	err = sb.UpdateBlocklist(blocked, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The batch results should match the single item results.
+	areBlocked := sb.AreBlocked(skylinks)
+	areHashesBlocked := sb.AreHashesBlocked(hashes)
+	if len(areBlocked) != len(skylinks) || len(areHashesBlocked) != len(hashes) {
+		t.Fatal("wrong number of results", len(areBlocked), len(areHashesBlocked))
+	}
+	for i, skylink := range skylinks {
+		if areBlocked[i] != sb.IsBlocked(skylink) {
+			t.Fatalf("result %v doesn't match IsBlocked", i)
+		}
+		if areHashesBlocked[i] != sb.IsHashBlocked(hashes[i]) {
+			t.Fatalf("result %v doesn't match IsHashBlocked", i)
+		}
+		if areBlocked[i] != (i%2 == 0) {
+			t.Fatalf("skylink %v has the wrong blocked status", i)
+		}
+	}
+
+	// An empty query should return an empty result.
+	if len(sb.AreBlocked(nil)) != 0 {
+		t.Fatal("expected empty result")
+	}
+}
+
 // TestPersistCorruption tests the persistence of the Skynet blocklist when corruption occurs.
 func TestPersistCorruption(t *testing.T) {
 	if testing.Short() {
@@ -129,6 +129,71 @@ func (sp *SkynetPortals) UpdatePortals(additions []modules.SkynetPortal, removal
 	return errors.AddContext(err, fmt.Sprintf("unable to update skynet portal list persistence at '%v'", sp.staticAop.FilePath()))
 }
 
+// UpdatePortalsPartial updates the list of known Skynet portals like
+// UpdatePortals. Instead of rejecting the whole batch if one of the changes is
+// invalid, every addition and removal is validated independently. The valid
+// changes are applied and the returned results report the error of every
+// invalid change in the order of the given additions and removals.
+func (sp *SkynetPortals) UpdatePortalsPartial(additions []modules.SkynetPortal, removals []modules.NetAddress) (modules.SkynetPortalsUpdateResult, error) {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+
+	// Check for nil input
+	if len(additions)+len(removals) == 0 {
+		return modules.SkynetPortalsUpdateResult{}, errors.AddContext(errors.New("no portals being added or removed"), ErrSkynetPortalsValidation.Error())
+	}
+
+	var result modules.SkynetPortalsUpdateResult
+	var validAdditions []modules.SkynetPortal
+	additionsMap := make(map[modules.NetAddress]struct{})
+	for _, portal := range additions {
+		// Convert portal addresses to lowercase for case-insensitivity.
+		portal.Address = modules.NetAddress(strings.ToLower(string(portal.Address)))
+		res := modules.SkynetPortalUpdateResult{Address: portal.Address}
+		if err := portal.Address.IsStdValid(); err != nil {
+			res.Error = "invalid network address: " + err.Error()
+		} else {
+			validAdditions = append(validAdditions, portal)
+			additionsMap[portal.Address] = struct{}{}
+		}
+		result.Additions = append(result.Additions, res)
+	}
+	var validRemovals []modules.NetAddress
+	removalsMap := make(map[modules.NetAddress]struct{})
+	for _, address := range removals {
+		address = modules.NetAddress(strings.ToLower(string(address)))
+		res := modules.SkynetPortalUpdateResult{Address: address}
+		_, exists := sp.portals[address]
+		_, added := additionsMap[address]
+		_, removed := removalsMap[address]
+		if err := address.IsStdValid(); err != nil {
+			res.Error = "invalid network address: " + err.Error()
+		} else if removed {
+			res.Error = "address " + string(address) + " is already being removed"
+		} else if !exists && !added {
+			res.Error = "address " + string(address) + " not already present in list of portals or being added"
+		} else {
+			validRemovals = append(validRemovals, address)
+			removalsMap[address] = struct{}{}
+		}
+		result.Removals = append(result.Removals, res)
+	}
+
+	// Nothing to persist if all of the changes were invalid.
+	if len(validAdditions)+len(validRemovals) == 0 {
+		return result, nil
+	}
+	buf, err := sp.marshalObjects(validAdditions, validRemovals)
+	if err != nil {
+		return modules.SkynetPortalsUpdateResult{}, errors.AddContext(err, fmt.Sprintf("unable to update skynet portal list persistence at '%v'", sp.staticAop.FilePath()))
+	}
+	_, err = sp.staticAop.Write(buf.Bytes())
+	if err != nil {
+		return modules.SkynetPortalsUpdateResult{}, errors.AddContext(err, fmt.Sprintf("unable to update skynet portal list persistence at '%v'", sp.staticAop.FilePath()))
+	}
+	return result, nil
+}
+
 // marshalObjects marshals the given objects into a byte buffer.
 //
 // NOTE: this method does not check for duplicate additions or removals
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 
 	"gitlab.com/NebulousLabs/Sia/build"
@@ -399,3 +401,111 @@ func TestMarshalSia(t *testing.T) {
 		t.Fatal("address not found in portals list")
 	}
 }
+
+// TestUpdatePortalsPartial verifies that UpdatePortalsPartial applies the
+// valid changes of a batch and reports the invalid ones.
+func TestUpdatePortalsPartial(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	testdir := testDir(t.Name())
+	pl, err := New(testdir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	filename := filepath.Join(testdir, persistFile)
+
+	// An empty update should fail.
+	_, err = pl.UpdatePortalsPartial(nil, nil)
+	if err == nil {
+		t.Fatal("expected empty update to fail")
+	}
+
+	// Add a mix of valid and invalid portals and remove a mix of present and
+	// missing portals.
+	existing := modules.SkynetPortal{Address: "siasky.net:443", Public: true}
+	err = pl.UpdatePortals([]modules.SkynetPortal{existing}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	longAddress := modules.NetAddress(strings.Repeat("a", modules.MaxEncodedNetAddressLength) + ".com:443")
+	add := []modules.SkynetPortal{
+		{Address: "LOCALHOST:9980", Public: true},
+		{Address: "siasky.net", Public: true},
+		{Address: longAddress, Public: true},
+		{Address: "example.com:9980", Public: false},
+	}
+	remove := []modules.NetAddress{
+		existing.Address,
+		"missing.net:443",
+		existing.Address,
+		"invalid",
+	}
+	result, err := pl.UpdatePortalsPartial(add, remove)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Check the results.
+	if len(result.Additions) != len(add) || len(result.Removals) != len(remove) {
+		t.Fatal("wrong number of results", result)
+	}
+	expectedAddErrs := []string{"", "missing port", "invalid hostname length", ""}
+	for i, res := range result.Additions {
+		if res.Address != modules.NetAddress(strings.ToLower(string(add[i].Address))) {
+			t.Fatalf("addition %v has the wrong address %v", i, res.Address)
+		}
+		if (expectedAddErrs[i] == "") != (res.Error == "") || !strings.Contains(res.Error, expectedAddErrs[i]) {
+			t.Fatalf("addition %v: expected error '%v' but got '%v'", i, expectedAddErrs[i], res.Error)
+		}
+	}
+	expectedRemoveErrs := []string{"", "not already present", "already being removed", "invalid network address"}
+	for i, res := range result.Removals {
+		if (expectedRemoveErrs[i] == "") != (res.Error == "") || !strings.Contains(res.Error, expectedRemoveErrs[i]) {
+			t.Fatalf("removal %v: expected error '%v' but got '%v'", i, expectedRemoveErrs[i], res.Error)
+		}
+	}
+
+	// Only the valid changes should have been applied and persisted.
+	expected := map[modules.NetAddress]bool{
+		"localhost:9980":   true,
+		"example.com:9980": false,
+	}
+	if !reflect.DeepEqual(pl.portals, expected) {
+		t.Fatal("unexpected portals", pl.portals)
+	}
+	if err := checkNumPersistedPortals(filename, 4); err != nil {
+		t.Fatal(err)
+	}
+
+	// A batch of only invalid changes shouldn't persist anything.
+	result, err = pl.UpdatePortalsPartial([]modules.SkynetPortal{{Address: "invalid"}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Additions) != 1 || result.Additions[0].Error == "" {
+		t.Fatal("expected invalid addition to be reported", result)
+	}
+	if err := checkNumPersistedPortals(filename, 4); err != nil {
+		t.Fatal(err)
+	}
+
+	// The applied changes should survive a restart.
+	err = pl.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pl, err = New(testdir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(pl.portals, expected) {
+		t.Fatal("unexpected portals after reload", pl.portals)
+	}
+	err = pl.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
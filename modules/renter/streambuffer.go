@@ -87,6 +87,15 @@ var (
 		Standard: uint64(1 << 21), // 2 MiB
 		Testing:  uint64(1 << 6),  // 64 bytes
 	}).(uint64)
+
+	// maximumLookahead is the maximum amount of data a stream can be
+	// configured to fetch ahead of the current seek position. It bounds the
+	// memory a single stream can use for prefetching data.
+	maximumLookahead = build.Select(build.Var{
+		Dev:      uint64(1 << 26), // 64 MiB
+		Standard: uint64(1 << 26), // 64 MiB
+		Testing:  uint64(1 << 12), // 4 KiB
+	}).(uint64)
 )
 
 // streamBufferDataSource is an interface that the stream buffer uses to fetch
@@ -175,6 +184,7 @@ type stream struct {
 	staticStreamBuffer *streamBuffer
 	staticCtx          context.Context
 	staticCancel       context.CancelFunc
+	staticLookahead    uint64
 }
 
 // streamBuffer is a buffer for a single dataSource.
@@ -223,6 +233,9 @@ func newStreamBufferSet(tg *threadgroup.ThreadGroup) *streamBufferSet {
 // stream can fetch data in advance of calls to 'Read' and attempt to provide a
 // smooth streaming experience.
 //
+// The 'lookahead' is the amount of data the stream fetches ahead of the
+// current seek position, see streamLookahead.
+//
 // The 'sourceID' is a unique identifier for the dataSource which allows
 // multiple streams fetching data from the same source to combine their cache.
 // This shared cache only comes into play if the streams are simultaneously
@@ -232,7 +245,7 @@ func newStreamBufferSet(tg *threadgroup.ThreadGroup) *streamBufferSet {
 // Each stream has a separate LRU for determining what data to buffer. Because
 // the LRU is distinct to the stream, the shared cache feature will not result
 // in one stream evicting data from another stream's LRU.
-func (sbs *streamBufferSet) callNewStream(dataSource streamBufferDataSource, initialOffset uint64, timeout time.Duration, pricePerMS types.Currency) *stream {
+func (sbs *streamBufferSet) callNewStream(dataSource streamBufferDataSource, initialOffset uint64, timeout time.Duration, pricePerMS types.Currency, lookahead uint64) *stream {
 	// Grab the streamBuffer for the provided sourceID. If no streamBuffer for
 	// the sourceID exists, create a new one.
 	sourceID := dataSource.ID()
@@ -257,14 +270,14 @@ func (sbs *streamBufferSet) callNewStream(dataSource streamBufferDataSource, ini
 	}
 	streamBuf.externRefCount++
 	sbs.mu.Unlock()
-	return streamBuf.managedPrepareNewStream(initialOffset, timeout)
+	return streamBuf.managedPrepareNewStream(initialOffset, timeout, lookahead)
 }
 
 // callNewStreamFromID will check the stream buffer set to see if a stream
 // buffer exists for the given data source id. If so, a new stream will be
 // created using the data source, and the bool will be set to 'true'. Otherwise,
 // the stream returned will be nil and the bool will be set to 'false'.
-func (sbs *streamBufferSet) callNewStreamFromID(id modules.DataSourceID, initialOffset uint64, timeout time.Duration) (*stream, bool) {
+func (sbs *streamBufferSet) callNewStreamFromID(id modules.DataSourceID, initialOffset uint64, timeout time.Duration, lookahead uint64) (*stream, bool) {
 	sbs.mu.Lock()
 	streamBuf, exists := sbs.streams[id]
 	if !exists {
@@ -273,7 +286,7 @@ func (sbs *streamBufferSet) callNewStreamFromID(id modules.DataSourceID, initial
 	}
 	streamBuf.externRefCount++
 	sbs.mu.Unlock()
-	return streamBuf.managedPrepareNewStream(initialOffset, timeout), true
+	return streamBuf.managedPrepareNewStream(initialOffset, timeout, lookahead), true
 }
 
 // managedData will block until the data for a data section is available, and
@@ -453,14 +466,29 @@ func (s *stream) prepareOffset() {
 	}
 
 	// Keep adding more pieces to the buffer until we have buffered at least
-	// minimumLookahead total data or have reached the end of the stream.
+	// the stream's lookahead total data or have reached the end of the stream.
 	nextIndex++
-	for i := dataSectionSize * 2; i < minimumLookahead && nextIndex*dataSectionSize < dataSize; i += dataSectionSize {
+	for i := dataSectionSize * 2; i < s.staticLookahead && nextIndex*dataSectionSize < dataSize; i += dataSectionSize {
 		s.lru.callUpdate(nextIndex)
 		nextIndex++
 	}
 }
 
+// streamLookahead returns the lookahead a stream should use given the
+// requested lookahead. A lookahead of 0 results in the minimumLookahead and
+// the lookahead is capped at the maximumLookahead. Independent of the
+// lookahead, a stream always buffers the data section following the current
+// one.
+func streamLookahead(lookahead uint64) uint64 {
+	if lookahead == 0 {
+		return minimumLookahead
+	}
+	if lookahead > maximumLookahead {
+		return maximumLookahead
+	}
+	return lookahead
+}
+
 // callFetchDataSection will increment the refcount of a dataSection in the
 // stream buffer. If the dataSection is not currently available in the stream
 // buffer, the data section will be fetched from the dataSource.
@@ -500,9 +528,17 @@ func (sb *streamBuffer) callRemoveDataSection(index uint64) {
 // managedPrepareNewStream creates a new stream from an existing stream buffer.
 // The ref count for the buffer needs to be incremented under the
 // streamBufferSet lock, before this method is called.
-func (sb *streamBuffer) managedPrepareNewStream(initialOffset uint64, timeout time.Duration) *stream {
-	// Determine how many data sections the stream should cache.
+func (sb *streamBuffer) managedPrepareNewStream(initialOffset uint64, timeout time.Duration, lookahead uint64) *stream {
+	lookahead = streamLookahead(lookahead)
+
+	// Determine how many data sections the stream should cache. The cache
+	// needs to be able to hold the current data section as well as all the
+	// data sections of the lookahead, otherwise prefetched data would be
+	// evicted before it is read.
 	dataSectionsToCache := bytesBufferedPerStream / sb.staticDataSectionSize
+	if lookaheadSections := lookahead/sb.staticDataSectionSize + 1; dataSectionsToCache < lookaheadSections {
+		dataSectionsToCache = lookaheadSections
+	}
 	if dataSectionsToCache < minimumDataSections {
 		dataSectionsToCache = minimumDataSections
 	}
@@ -521,6 +557,7 @@ func (sb *streamBuffer) managedPrepareNewStream(initialOffset uint64, timeout ti
 
 		staticCtx:          ctx,
 		staticCancel:       cancel,
+		staticLookahead:    lookahead,
 		staticStreamBuffer: sb,
 	}
 	stream.prepareOffset()
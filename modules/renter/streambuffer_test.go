@@ -120,7 +120,7 @@ func TestStreamSmoke(t *testing.T) {
 	dataSectionSize := uint64(16)
 	dataSource := newMockDataSource(data, dataSectionSize)
 	sbs := newStreamBufferSet(&tg)
-	stream := sbs.callNewStream(dataSource, 0, 0, types.ZeroCurrency)
+	stream := sbs.callNewStream(dataSource, 0, 0, types.ZeroCurrency, 0)
 
 	// Check that there is one reference in the stream buffer.
 	sbs.mu.Lock()
@@ -130,7 +130,7 @@ func TestStreamSmoke(t *testing.T) {
 		t.Fatal("bad")
 	}
 	// Create a new stream from an id, check that the ref count goes up.
-	streamFromID, exists := sbs.callNewStreamFromID(dataSource.ID(), 0, 0)
+	streamFromID, exists := sbs.callNewStreamFromID(dataSource.ID(), 0, 0, 0)
 	if !exists {
 		t.Fatal("bad")
 	}
@@ -143,7 +143,7 @@ func TestStreamSmoke(t *testing.T) {
 	// Create a second, different data source with the same id and try to use
 	// that.
 	dataSource2 := newMockDataSource(data, dataSectionSize)
-	repeatStream := sbs.callNewStream(dataSource2, 0, 0, types.ZeroCurrency)
+	repeatStream := sbs.callNewStream(dataSource2, 0, 0, types.ZeroCurrency, 0)
 	sbs.mu.Lock()
 	refs = stream.staticStreamBuffer.externRefCount
 	sbs.mu.Unlock()
@@ -314,7 +314,7 @@ func TestStreamSmoke(t *testing.T) {
 	// the same ID, they are actually separate objects which need to be closed
 	// individually.
 	dataSource3 := newMockDataSource(data, dataSectionSize)
-	stream2 := sbs.callNewStream(dataSource3, 0, 0, types.ZeroCurrency)
+	stream2 := sbs.callNewStream(dataSource3, 0, 0, types.ZeroCurrency, 0)
 	bytesRead, err = io.ReadFull(stream2, buf)
 	if err != nil {
 		t.Fatal(err)
@@ -442,7 +442,7 @@ func TestStreamSmoke(t *testing.T) {
 
 	// Check that if the tg is stopped, the stream closes immediately.
 	dataSource4 := newMockDataSource(data, dataSectionSize)
-	stream3 := sbs.callNewStream(dataSource4, 0, 0, types.ZeroCurrency)
+	stream3 := sbs.callNewStream(dataSource4, 0, 0, types.ZeroCurrency, 0)
 	bytesRead, err = io.ReadFull(stream3, buf)
 	if err != nil {
 		t.Fatal(err)
@@ -486,3 +486,115 @@ func TestStreamSmoke(t *testing.T) {
 		t.Fatal("bad")
 	}
 }
+
+// latencyDataSource is a mockDataSource which simulates network latency by
+// delaying every read response.
+type latencyDataSource struct {
+	*mockDataSource
+	staticLatency time.Duration
+}
+
+// ReadStream implements streamBufferDataSource.
+func (lds *latencyDataSource) ReadStream(ctx context.Context, offset, fetchSize uint64, pricePerMS types.Currency) chan *readResponse {
+	respChan := lds.mockDataSource.ReadStream(ctx, offset, fetchSize, pricePerMS)
+	delayedChan := make(chan *readResponse, 1)
+	go func() {
+		resp := <-respChan
+		time.Sleep(lds.staticLatency)
+		delayedChan <- resp
+	}()
+	return delayedChan
+}
+
+// TestStreamLookahead verifies that a stream fetches as much data ahead of its
+// read position as its lookahead specifies.
+func TestStreamLookahead(t *testing.T) {
+	t.Parallel()
+
+	// Check the lookahead defaults and limits.
+	if streamLookahead(0) != minimumLookahead {
+		t.Fatal("wrong default lookahead", streamLookahead(0))
+	}
+	if streamLookahead(1) != 1 {
+		t.Fatal("lookahead below the default should be allowed", streamLookahead(1))
+	}
+	if streamLookahead(maximumLookahead+1) != maximumLookahead {
+		t.Fatal("lookahead should be capped", streamLookahead(maximumLookahead+1))
+	}
+
+	var tg threadgroup.ThreadGroup
+	sbs := newStreamBufferSet(&tg)
+	dataSectionSize := uint64(16)
+	numSections := maximumLookahead/dataSectionSize + 10
+
+	tests := []struct {
+		lookahead        uint64
+		expectedSections uint64
+	}{
+		{0, minimumLookahead / dataSectionSize},
+		{1, minimumDataSections},
+		{8 * dataSectionSize, 8},
+		{maximumLookahead * 2, maximumLookahead / dataSectionSize},
+	}
+	for _, test := range tests {
+		data := fastrand.Bytes(int(numSections * dataSectionSize))
+		dataSource := newMockDataSource(data, dataSectionSize)
+		stream := sbs.callNewStream(dataSource, 0, 0, types.ZeroCurrency, test.lookahead)
+
+		// The stream should have fetched the expected number of sections
+		// without reading and the lru should be able to hold all of them.
+		sb := stream.staticStreamBuffer
+		sb.mu.Lock()
+		sections := uint64(len(sb.dataSections))
+		sb.mu.Unlock()
+		if sections != test.expectedSections {
+			t.Fatalf("lookahead %v: expected %v sections but got %v", test.lookahead, test.expectedSections, sections)
+		}
+
+		// Reading should return the right data.
+		readData, err := ioutil.ReadAll(stream)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(readData, data) {
+			t.Fatal("data mismatch")
+		}
+		if err := stream.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkStreamLookahead benchmarks the throughput of sequential reads from
+// a stream with the default lookahead and with a larger read-ahead.
+func BenchmarkStreamLookahead(b *testing.B) {
+	dataSectionSize := uint64(1 << 8)
+	dataSize := 64 * dataSectionSize
+
+	bench := func(b *testing.B, lookahead uint64) {
+		var tg threadgroup.ThreadGroup
+		sbs := newStreamBufferSet(&tg)
+		b.SetBytes(int64(dataSize))
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			// Use new data every iteration to avoid hitting the cache.
+			b.StopTimer()
+			dataSource := &latencyDataSource{
+				mockDataSource: newMockDataSource(fastrand.Bytes(int(dataSize)), dataSectionSize),
+				staticLatency:  time.Millisecond,
+			}
+			b.StartTimer()
+
+			stream := sbs.callNewStream(dataSource, 0, 0, types.ZeroCurrency, lookahead)
+			_, err := io.Copy(ioutil.Discard, stream)
+			if err != nil {
+				b.Fatal(err)
+			}
+			if err := stream.Close(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+	b.Run("Default", func(b *testing.B) { bench(b, 0) })
+	b.Run("ReadAhead", func(b *testing.B) { bench(b, maximumLookahead) })
+}
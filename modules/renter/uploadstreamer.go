@@ -1,8 +1,10 @@
 package renter
 
 import (
+	"context"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"sync"
 
 	"gitlab.com/NebulousLabs/errors"
@@ -14,6 +16,16 @@ import (
 	"gitlab.com/NebulousLabs/Sia/types"
 )
 
+var (
+	// errNotEnoughUploadWorkers is returned by the upload streamer if there are
+	// fewer workers than the erasure code requires.
+	errNotEnoughUploadWorkers = errors.New("not enough workers for upload")
+
+	// errStreamChunkUnavailable is returned by the upload streamer if a chunk
+	// of the stream failed to become available on the network.
+	errStreamChunkUnavailable = errors.New("upload streamer failed to get all data available")
+)
+
 // Upload Streaming Overview:
 // Most of the logic that enables upload streaming can be found within
 // UploadStreamFromReader and the StreamShard. As seen at the beginning of the
@@ -201,6 +213,21 @@ func (r *Renter) managedInitUploadStream(up modules.FileUploadParams) (*filesyst
 // the streamer may continue uploading in the background after returning while
 // it is boosting redundancy.
 func (r *Renter) callUploadStreamFromReader(up modules.FileUploadParams, reader io.Reader) (fileNode *filesystem.FileNode, err error) {
+	return r.callUploadStreamFromReaderWithCallback(context.Background(), up, reader, nil)
+}
+
+// callUploadStreamFromReaderWithContext behaves like callUploadStreamFromReader
+// but aborts the upload once the context is canceled.
+func (r *Renter) callUploadStreamFromReaderWithContext(ctx context.Context, up modules.FileUploadParams, reader io.Reader) (fileNode *filesystem.FileNode, err error) {
+	return r.callUploadStreamFromReaderWithCallback(ctx, up, reader, nil)
+}
+
+// callUploadStreamFromReaderWithCallback behaves like
+// callUploadStreamFromReader but calls readDone, if set, once all of the data
+// has been read from the reader and before waiting for the data to become
+// available on the network. If readDone returns an error or the context is
+// canceled, the upload is aborted.
+func (r *Renter) callUploadStreamFromReaderWithCallback(ctx context.Context, up modules.FileUploadParams, reader io.Reader, readDone func(*filesystem.FileNode) error) (fileNode *filesystem.FileNode, err error) {
 	// Check the upload params first.
 	fileNode, err = r.managedInitUploadStream(up)
 	if err != nil {
@@ -218,6 +245,12 @@ func (r *Renter) callUploadStreamFromReader(up modules.FileUploadParams, reader
 		}
 	}()
 
+	// Simulate an upload by consuming the data without uploading it.
+	if r.deps.Disrupt("DiscardUploadStream") {
+		_, err = io.Copy(ioutil.Discard, reader)
+		return fileNode, err
+	}
+
 	// Build a map of host public keys.
 	pks := make(map[string]types.SiaPublicKey)
 	for _, pk := range fileNode.HostPublicKeys() {
@@ -226,6 +259,7 @@ func (r *Renter) callUploadStreamFromReader(up modules.FileUploadParams, reader
 
 	// Get the most recent workers.
 	hosts := r.managedRefreshHostsAndWorkers()
+	hosts = preferredUploadHosts(hosts, up.PreferredHosts, fileNode.ErasureCode().NumPieces())
 
 	// Check if we currently have enough workers for the specified redundancy.
 	minWorkers := fileNode.ErasureCode().MinPieces()
@@ -233,7 +267,7 @@ func (r *Renter) callUploadStreamFromReader(up modules.FileUploadParams, reader
 	availableWorkers := len(r.staticWorkerPool.workers)
 	r.staticWorkerPool.mu.RUnlock()
 	if availableWorkers < minWorkers {
-		return nil, fmt.Errorf("Need at least %v workers for upload but got only %v", minWorkers, availableWorkers)
+		return nil, errors.AddContext(errNotEnoughUploadWorkers, fmt.Sprintf("Need at least %v workers for upload but got only %v", minWorkers, availableWorkers))
 	}
 
 	// Read the chunks we want to upload one by one from the input stream using
@@ -242,6 +276,10 @@ func (r *Renter) callUploadStreamFromReader(up modules.FileUploadParams, reader
 	var peek []byte
 	var chunks []*unfinishedUploadChunk
 	for chunkIndex := uint64(0); ; chunkIndex++ {
+		// Stop reading from the stream if the upload was canceled.
+		if err := ctx.Err(); err != nil {
+			return nil, errors.AddContext(err, "upload canceled")
+		}
 		// Disrupt the upload by closing the reader and simulating losing
 		// connectivity during the upload.
 		if r.deps.Disrupt("DisruptUploadStream") {
@@ -256,9 +294,21 @@ func (r *Renter) callUploadStreamFromReader(up modules.FileUploadParams, reader
 			return nil, err
 		}
 
+		// If the number of concurrent chunks is limited, wait for an earlier
+		// chunk to become available before starting the next one.
+		if maxChunks := up.MaxConcurrentChunks; maxChunks > 0 && uint64(len(chunks)) >= maxChunks {
+			select {
+			case <-r.tg.StopChan():
+				return nil, errors.New("interrupted by shutdown")
+			case <-ctx.Done():
+				return nil, errors.AddContext(ctx.Err(), "upload canceled")
+			case <-chunks[uint64(len(chunks))-maxChunks].staticAvailableChan:
+			}
+		}
+
 		// Start the chunk upload.
 		offline, goodForRenew, _ := r.managedContractUtilityMaps()
-		uuc, err := r.managedBuildUnfinishedChunk(fileNode, chunkIndex, hosts, pks, memoryPriorityHigh, offline, goodForRenew, r.userUploadMemoryManager)
+		uuc, err := r.managedBuildUnfinishedChunk(fileNode, chunkIndex, hosts, pks, !up.LowPriority, offline, goodForRenew, r.userUploadMemoryManager)
 		if err != nil {
 			return nil, errors.AddContext(err, "unable to fetch chunk for stream")
 		}
@@ -297,6 +347,8 @@ func (r *Renter) callUploadStreamFromReader(up modules.FileUploadParams, reader
 		select {
 		case <-r.tg.StopChan():
 			return nil, errors.New("interrupted by shutdown")
+		case <-ctx.Done():
+			return nil, errors.AddContext(ctx.Err(), "upload canceled")
 		case <-ss.signalChan:
 		}
 
@@ -318,18 +370,28 @@ func (r *Renter) callUploadStreamFromReader(up modules.FileUploadParams, reader
 		}
 	}
 
+	// Notify the caller that all of the data has been read.
+	if readDone != nil {
+		err = readDone(fileNode)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	// Wait for all chunks to become available.
 	for _, chunk := range chunks {
 		select {
 		case <-r.tg.StopChan():
 			err = errors.New("upload timed out, renter has shutdown")
+		case <-ctx.Done():
+			return nil, errors.AddContext(ctx.Err(), "upload canceled")
 		case <-chunk.staticAvailableChan:
 			chunk.mu.Lock()
 			err = chunk.err
 			chunk.mu.Unlock()
 		}
 		if err != nil {
-			return nil, errors.AddContext(err, "upload streamer failed to get all data available")
+			return nil, errors.Compose(errStreamChunkUnavailable, err)
 		}
 	}
 
@@ -338,5 +400,8 @@ func (r *Renter) callUploadStreamFromReader(up modules.FileUploadParams, reader
 	if r.deps.Disrupt("failUploadStreamFromReader") {
 		return nil, errors.New("disrupted by failUploadStreamFromReader")
 	}
+	if r.deps.Disrupt("failUploadStreamFromReaderTransient") {
+		return nil, errors.AddContext(errStreamChunkUnavailable, "disrupted by failUploadStreamFromReaderTransient")
+	}
 	return fileNode, nil
 }
@@ -0,0 +1,139 @@
+package renter
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"gitlab.com/NebulousLabs/Sia/build"
+	"gitlab.com/NebulousLabs/Sia/crypto"
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/siatest/dependencies"
+	"gitlab.com/NebulousLabs/errors"
+	"gitlab.com/NebulousLabs/fastrand"
+)
+
+// TestUploadStreamMaxConcurrentChunks verifies that a streaming upload with
+// MaxConcurrentChunks set only starts a new chunk once an earlier one has
+// become available and that LowPriority is applied to the chunks.
+func TestUploadStreamMaxConcurrentChunks(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	// Create a worker tester. The dependency prevents the chunks from being
+	// passed to the worker which allows the test to control when a chunk
+	// becomes available.
+	wt, err := newWorkerTesterCustomDependency(t.Name(), &dependencies.DependencySkipPrepareNextChunk{}, modules.ProdDependencies)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := wt.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	r := wt.rt.renter
+
+	// Upload 4 chunks with at most 2 of them uploading at the same time.
+	rsc, err := modules.NewRSCode(1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const numChunks = 4
+	const maxChunks = 2
+	up := modules.FileUploadParams{
+		SiaPath:             modules.RandomSiaPath(),
+		ErasureCode:         rsc,
+		CipherType:          crypto.TypePlain,
+		MaxConcurrentChunks: maxChunks,
+		LowPriority:         true,
+	}
+	data := fastrand.Bytes(numChunks * int(modules.SectorSize))
+	uploadErr := make(chan error, 1)
+	go func() {
+		_, err := r.callUploadStreamFromReader(up, bytes.NewReader(data))
+		uploadErr <- err
+	}()
+
+	// streamChunks returns the stream chunks in the repair map by index.
+	streamChunks := func() map[uint64]*unfinishedUploadChunk {
+		r.uploadHeap.mu.Lock()
+		defer r.uploadHeap.mu.Unlock()
+		chunks := make(map[uint64]*unfinishedUploadChunk)
+		for id, uuc := range r.uploadHeap.repairingChunks {
+			if uuc.sourceReader != nil {
+				chunks[id.index] = uuc
+			}
+		}
+		return chunks
+	}
+
+	// startChunk waits for the chunk with the given index to be started and
+	// reads its data from the stream like a worker would.
+	startChunk := func(index uint64) *unfinishedUploadChunk {
+		var uuc *unfinishedUploadChunk
+		err := build.Retry(100, 100*time.Millisecond, func() error {
+			var exists bool
+			uuc, exists = streamChunks()[index]
+			if !exists {
+				return fmt.Errorf("chunk %v not started yet", index)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if uuc.staticPriority {
+			t.Fatal("chunk should have low priority")
+		}
+		_, err = io.ReadFull(uuc.sourceReader, make([]byte, modules.SectorSize))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := uuc.sourceReader.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return uuc
+	}
+
+	// makeAvailable marks the chunk as available.
+	makeAvailable := func(uuc *unfinishedUploadChunk) {
+		uuc.mu.Lock()
+		close(uuc.staticAvailableChan)
+		uuc.mu.Unlock()
+	}
+
+	// The first 2 chunks are started right away.
+	var chunks []*unfinishedUploadChunk
+	for i := uint64(0); i < maxChunks; i++ {
+		chunks = append(chunks, startChunk(i))
+	}
+
+	// Every following chunk is only started once the chunk maxChunks before
+	// it is available.
+	for i := uint64(maxChunks); i < numChunks; i++ {
+		time.Sleep(time.Second)
+		if _, exists := streamChunks()[i]; exists {
+			t.Fatalf("chunk %v was started before chunk %v became available", i, i-maxChunks)
+		}
+		makeAvailable(chunks[i-maxChunks])
+		chunks = append(chunks, startChunk(i))
+	}
+
+	// Make the remaining chunks available to finish the upload.
+	for _, uuc := range chunks[numChunks-maxChunks:] {
+		makeAvailable(uuc)
+	}
+	select {
+	case err := <-uploadErr:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Minute):
+		t.Fatal(errors.New("upload didn't finish"))
+	}
+}
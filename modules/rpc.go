@@ -174,9 +174,15 @@ var (
 	// RPCExecuteProgram specifier
 	RPCExecuteProgram = types.NewSpecifier("ExecuteProgram")
 
+	// RPCEstimateProgram specifier
+	RPCEstimateProgram = types.NewSpecifier("EstimateProgram")
+
 	// RPCFundAccount specifier
 	RPCFundAccount = types.NewSpecifier("FundAccount")
 
+	// RPCHasSector specifier
+	RPCHasSector = types.NewSpecifier("HasSector")
+
 	// RPCLatestRevision specifier
 	RPCLatestRevision = types.NewSpecifier("LatestRevision")
 
@@ -253,6 +259,45 @@ type (
 		Signature []byte
 	}
 
+	// RPCEstimateProgramRequest is the request sent by the renter to estimate
+	// the cost of executing a program on the host's MDM.
+	RPCEstimateProgramRequest struct {
+		// FileContractID is the id of the filecontract the program would
+		// modify. It is only required if the program requires a snapshot of
+		// the contract.
+		FileContractID types.FileContractID
+		// Instructions to be estimated.
+		Program Program
+		// ProgramData is the data of the program.
+		ProgramData ProgramData
+	}
+
+	// RPCEstimateProgramResponse contains the host's estimate for executing
+	// a program.
+	RPCEstimateProgramResponse struct {
+		AdditionalCollateral types.Currency
+		ExecutionCost        types.Currency
+		FailureRefund        types.Currency
+		Memory               uint64
+		Time                 uint64
+	}
+
+	// RPCHasSectorRequest contains the root of the sector the host is asked
+	// about.
+	RPCHasSectorRequest struct {
+		Root crypto.Hash
+	}
+
+	// RPCHasSectorResponse indicates whether the host stores the requested
+	// sector and for how long it has been storing it. The storage age is only
+	// known for sectors the host started storing after it began tracking
+	// their heights.
+	RPCHasSectorResponse struct {
+		HasSector       bool
+		StorageAge      types.BlockHeight
+		StorageAgeKnown bool
+	}
+
 	// RPCLatestRevisionRequest contains the id of the contract for which to
 	// retrieve the latest revision.
 	RPCLatestRevisionRequest struct {
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"hash"
 	"io"
 	"io/ioutil"
 	"mime"
@@ -28,6 +29,17 @@ var (
 	// ErrSkyfileMetadataUnavailable is returned when the context passed to
 	// SkyfileMetadata is cancelled before the metadata became available
 	ErrSkyfileMetadataUnavailable = errors.New("metadata unavailable")
+
+	// ErrSkyfileUploadTruncated is returned when the reader of a skyfile
+	// upload returns an io.ErrUnexpectedEOF, which usually means that the
+	// data was cut short, e.g. because the client's connection dropped.
+	ErrSkyfileUploadTruncated = errors.New("skyfile upload data ended unexpectedly")
+)
+
+const (
+	// contentTypeSniffLen is the number of leading bytes of a file that are
+	// used to sniff its content type.
+	contentTypeSniffLen = 512
 )
 
 type (
@@ -55,8 +67,17 @@ type (
 		currOff  uint64
 		currPart *multipart.Part
 
+		// currLeadingBytes contains the first bytes of the current part,
+		// which are used to verify its declared content type.
+		currLeadingBytes []byte
+
 		metadata      SkyfileMetadata
 		metadataAvail chan struct{}
+
+		staticAllowUnexpectedEOF bool
+		staticContentHasher      hash.Hash
+		staticMaxSubfiles        int
+		staticVerifyContentTypes bool
 	}
 
 	// skyfileReader is a helper struct that implements the SkyfileUploadReader
@@ -74,6 +95,9 @@ type (
 
 		metadata      SkyfileMetadata
 		metadataAvail chan struct{}
+
+		staticAllowUnexpectedEOF bool
+		staticContentHasher      hash.Hash
 	}
 )
 
@@ -90,10 +114,15 @@ func NewSkyfileReader(reader io.Reader, sup SkyfileUploadParameters) SkyfileUplo
 		reader:       tr,
 		fanoutReader: &buf,
 		metadata: SkyfileMetadata{
-			Filename: sup.Filename,
-			Mode:     sup.Mode,
+			Filename:    sup.Filename,
+			Mode:        sup.Mode,
+			HTTPHeaders: sup.HTTPHeaders,
+			CreatedAt:   sup.CreatedAt,
 		},
 		metadataAvail: make(chan struct{}),
+
+		staticAllowUnexpectedEOF: sup.AllowUnexpectedEOF,
+		staticContentHasher:      sup.ContentHasher,
 	}
 }
 
@@ -147,8 +176,15 @@ func (sr *skyfileReader) Read(p []byte) (n int, err error) {
 
 	var nn int
 	nn, err = sr.reader.Read(p[n:])
+	if sr.staticContentHasher != nil {
+		sr.staticContentHasher.Write(p[n : n+nn])
+	}
 	n += nn
 	sr.currLen += uint64(nn)
+	if errors.Contains(err, io.ErrUnexpectedEOF) && sr.staticAllowUnexpectedEOF {
+		err = io.EOF
+	}
+	err = checkUnexpectedEOF(err)
 
 	if errors.Contains(err, io.EOF) {
 		close(sr.metadataAvail)
@@ -167,6 +203,12 @@ func NewMultipartReader(reader io.Reader, subFiles SkyfileSubfiles) (*multipart.
 		return nil, errors.AddContext(err, "unable to read data from reader")
 	}
 
+	// Make sure the subfiles can be sliced from the data.
+	err = ValidateSkyfileSubfileOffsets(subFiles, uint64(len(data)))
+	if err != nil {
+		return nil, errors.AddContext(err, "invalid subfiles")
+	}
+
 	// Sort the subFiles by offset
 	subFilesArray := make([]SkyfileSubfileMetadata, 0, len(subFiles))
 	for _, sfm := range subFiles {
@@ -247,6 +289,8 @@ func newFanoutReader(reader *multipart.Reader, sup SkyfileUploadParameters) *sky
 	if reader == nil {
 		return nil
 	}
+	// The content is only hashed by the reader the upload reads from.
+	sup.ContentHasher = nil
 	return newSkyfileMultipartReader(reader, nil, sup)
 }
 
@@ -259,6 +303,10 @@ func newFanoutReader(reader *multipart.Reader, sup SkyfileUploadParameters) *sky
 // a TeeReader of the underlying io.Reader that was used to create the
 // multipart.Reader.
 func newSkyfileMultipartReader(reader *multipart.Reader, fanoutReader *multipart.Reader, sup SkyfileUploadParameters) *skyfileMultipartReader {
+	maxSubfiles := sup.MaxSubfiles
+	if maxSubfiles == 0 {
+		maxSubfiles = DefaultSkyfileMaxSubfiles
+	}
 	return &skyfileMultipartReader{
 		reader:       reader,
 		fanoutReader: newFanoutReader(fanoutReader, sup),
@@ -267,9 +315,16 @@ func newSkyfileMultipartReader(reader *multipart.Reader, fanoutReader *multipart
 			Mode:               sup.Mode,
 			DefaultPath:        sup.DefaultPath,
 			DisableDefaultPath: sup.DisableDefaultPath,
+			HTTPHeaders:        sup.HTTPHeaders,
+			CreatedAt:          sup.CreatedAt,
 			Subfiles:           make(SkyfileSubfiles),
 		},
 		metadataAvail: make(chan struct{}),
+
+		staticAllowUnexpectedEOF: sup.AllowUnexpectedEOF,
+		staticContentHasher:      sup.ContentHasher,
+		staticMaxSubfiles:        maxSubfiles,
+		staticVerifyContentTypes: sup.VerifyContentTypes,
 	}
 }
 
@@ -348,6 +403,7 @@ func (sr *skyfileMultipartReader) Read(p []byte) (n int, err error) {
 			}
 			sr.currOff += sr.currLen
 			sr.currLen = 0
+			sr.currLeadingBytes = sr.currLeadingBytes[:0]
 
 			// verify the multipart file is submitted under the expected name
 			if !isLegalFormName(sr.currPart.FormName()) {
@@ -359,11 +415,37 @@ func (sr *skyfileMultipartReader) Read(p []byte) (n int, err error) {
 		// read data from the part
 		var nn int
 		nn, err = sr.currPart.Read(p[n:])
+		if sr.staticContentHasher != nil {
+			sr.staticContentHasher.Write(p[n : n+nn])
+		}
 		n += nn
 
 		// update the length
 		sr.currLen += uint64(nn)
 
+		// remember the leading bytes of the part to verify its content type
+		if sr.staticVerifyContentTypes && len(sr.currLeadingBytes) < contentTypeSniffLen {
+			leading := p[n-nn : n]
+			if missing := contentTypeSniffLen - len(sr.currLeadingBytes); len(leading) > missing {
+				leading = leading[:missing]
+			}
+			sr.currLeadingBytes = append(sr.currLeadingBytes, leading...)
+		}
+
+		// if an unexpected EOF is allowed, the current part is considered to
+		// be the last one and we are done after creating its metadata
+		if errors.Contains(err, io.ErrUnexpectedEOF) && sr.staticAllowUnexpectedEOF {
+			err = sr.createSubfileFromCurrPart()
+			if err != nil {
+				break
+			}
+			sr.currPart = nil
+			close(sr.metadataAvail)
+			err = io.EOF
+			break
+		}
+		err = checkUnexpectedEOF(err)
+
 		// ignore the EOF to continue reading from the next part if necessary,
 		if err == io.EOF {
 			err = nil
@@ -381,6 +463,17 @@ func (sr *skyfileMultipartReader) Read(p []byte) (n int, err error) {
 	return
 }
 
+// checkUnexpectedEOF replaces an io.ErrUnexpectedEOF returned by the reader
+// underlying a skyfile upload with ErrSkyfileUploadTruncated. Otherwise the
+// error would be mistaken for the regular end of the data by callers that use
+// io.ReadFull.
+func checkUnexpectedEOF(err error) error {
+	if errors.Contains(err, io.ErrUnexpectedEOF) {
+		return errors.AddContext(ErrSkyfileUploadTruncated, "reader returned an unexpected EOF")
+	}
+	return err
+}
+
 // createSubfileFromCurrPart adds a subfile for the current part.
 func (sr *skyfileMultipartReader) createSubfileFromCurrPart() error {
 	// sanity check the reader has a current part set
@@ -401,10 +494,24 @@ func (sr *skyfileMultipartReader) createSubfileFromCurrPart() error {
 		return ErrEmptyFilename
 	}
 
+	// verify the declared content type if necessary
+	contentType := sr.currPart.Header.Get("Content-Type")
+	if sr.staticVerifyContentTypes {
+		err = ValidateSubfileContentType(contentType, sr.currLeadingBytes)
+		if err != nil {
+			return errors.AddContext(err, fmt.Sprintf("invalid content type for subfile '%v'", filename))
+		}
+	}
+
+	// fail early if the upload contains too many subfiles
+	if _, exists := sr.metadata.Subfiles[filename]; !exists && len(sr.metadata.Subfiles) >= sr.staticMaxSubfiles {
+		return errors.AddContext(ErrTooManySubfiles, fmt.Sprintf("the maximum is %v", sr.staticMaxSubfiles))
+	}
+
 	sr.metadata.Subfiles[filename] = SkyfileSubfileMetadata{
 		FileMode:    mode,
 		Filename:    filename,
-		ContentType: sr.currPart.Header.Get("Content-Type"),
+		ContentType: contentType,
 		Offset:      sr.currOff,
 		Len:         sr.currLen,
 	}
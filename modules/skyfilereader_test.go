@@ -3,6 +3,7 @@ package modules
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -20,6 +21,8 @@ func TestSkyfileReader(t *testing.T) {
 	t.Run("Basic", testSkyfileReaderBasic)
 	t.Run("ReadBuffer", testSkyfileReaderReadBuffer)
 	t.Run("MetadataTimeout", testSkyfileReaderMetadataTimeout)
+	t.Run("UnexpectedEOF", testSkyfileReaderUnexpectedEOF)
+	t.Run("ContentHash", testSkyfileReaderContentHash)
 }
 
 // testSkyfileReaderBasic verifies the basic use case of the SkyfileReader
@@ -205,6 +208,101 @@ func testSkyfileReaderMetadataTimeout(t *testing.T) {
 	}
 }
 
+// truncatedReader is a reader that returns its data followed by an
+// io.ErrUnexpectedEOF, like a network reader that got cut off.
+type truncatedReader struct {
+	r io.Reader
+}
+
+// Read implements io.Reader.
+func (tr *truncatedReader) Read(p []byte) (int, error) {
+	n, err := tr.r.Read(p)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+// testSkyfileReaderUnexpectedEOF verifies that an io.ErrUnexpectedEOF returned
+// by the underlying reader fails the read unless the upload parameters allow
+// it.
+func testSkyfileReaderUnexpectedEOF(t *testing.T) {
+	t.Parallel()
+
+	data := fastrand.Bytes(fastrand.Intn(1000) + 10)
+	sup := SkyfileUploadParameters{
+		Filename: t.Name(),
+		Mode:     DefaultFilePerm,
+	}
+
+	// By default the truncated data results in an error, even though
+	// io.ReadFull would return an io.ErrUnexpectedEOF for a short read.
+	sfReader := NewSkyfileReader(&truncatedReader{bytes.NewReader(data)}, sup)
+	_, err := io.ReadFull(sfReader, make([]byte, len(data)*2))
+	if !errors.Contains(err, ErrSkyfileUploadTruncated) {
+		t.Fatal("expected truncated error", err)
+	}
+	if errors.Contains(err, io.ErrUnexpectedEOF) || errors.Contains(err, io.EOF) {
+		t.Fatal("error shouldn't be mistaken for EOF", err)
+	}
+
+	// If allowed, the unexpected EOF is treated as the end of the data.
+	sup.AllowUnexpectedEOF = true
+	sfReader = NewSkyfileReader(&truncatedReader{bytes.NewReader(data)}, sup)
+	readData, err := ioutil.ReadAll(sfReader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(readData, data) {
+		t.Fatal("unexpected data")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	metadata, err := sfReader.SkyfileMetadata(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metadata.Length != uint64(len(data)) {
+		t.Fatal("unexpected length", metadata.Length)
+	}
+}
+
+// testSkyfileReaderContentHash verifies that the SkyfileReader hashes the
+// data read from the underlying reader exactly once, even if part of it is
+// read again from the read buffer.
+func testSkyfileReaderContentHash(t *testing.T) {
+	t.Parallel()
+
+	data := fastrand.Bytes(fastrand.Intn(1000) + 10)
+	sup := SkyfileUploadParameters{
+		Filename:      t.Name(),
+		Mode:          DefaultFilePerm,
+		ContentHasher: sha256.New(),
+	}
+	sfReader := NewSkyfileReader(bytes.NewReader(data), sup)
+
+	// read some data and add it back to the read buffer
+	prefix := make([]byte, fastrand.Intn(len(data)))
+	_, err := io.ReadFull(sfReader, prefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sfReader.AddReadBuffer(prefix)
+
+	// read all data
+	readData, err := ioutil.ReadAll(sfReader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(readData, data) {
+		t.Fatal("unexpected data")
+	}
+	expected := sha256.Sum256(data)
+	if !bytes.Equal(sup.ContentHasher.Sum(nil), expected[:]) {
+		t.Fatal("unexpected content hash")
+	}
+}
+
 // TestSkyfileMultipartReader verifies the functionality of the
 // SkyfileMultipartReader.
 func TestSkyfileMultipartReader(t *testing.T) {
@@ -214,6 +312,10 @@ func TestSkyfileMultipartReader(t *testing.T) {
 	t.Run("RandomReadSize", testSkyfileMultipartReaderRandomReadSize)
 	t.Run("ReadBuffer", testSkyfileMultipartReaderReadBuffer)
 	t.Run("MetadataTimeout", testSkyfileMultipartReaderMetadataTimeout)
+	t.Run("UnexpectedEOF", testSkyfileMultipartReaderUnexpectedEOF)
+	t.Run("VerifyContentTypes", testSkyfileMultipartReaderVerifyContentTypes)
+	t.Run("MaxSubfiles", testSkyfileMultipartReaderMaxSubfiles)
+	t.Run("ContentHash", testSkyfileMultipartReaderContentHash)
 }
 
 // testSkyfileMultipartReaderBasic verifies the basic use case of a skyfile
@@ -631,3 +733,240 @@ func testSkyfileMultipartReaderMetadataTimeout(t *testing.T) {
 		t.Fatal("unexpected metadata", metadata)
 	}
 }
+
+// testSkyfileMultipartReaderUnexpectedEOF verifies that a truncated multipart
+// body fails the read unless the upload parameters allow it.
+func testSkyfileMultipartReaderUnexpectedEOF(t *testing.T) {
+	t.Parallel()
+
+	// create a multipart body that is cut off in the middle of its only part
+	buffer := new(bytes.Buffer)
+	writer := multipart.NewWriter(buffer)
+	data := fastrand.Bytes(100)
+	off := uint64(0)
+	_, err := AddMultipartFile(writer, data, "files[]", "part1", 0600, &off)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := buffer.Bytes()[:buffer.Len()-50]
+
+	newReader := func(sup SkyfileUploadParameters) SkyfileUploadReader {
+		var buf bytes.Buffer
+		tr := io.TeeReader(bytes.NewReader(body), &buf)
+		multipartReader := multipart.NewReader(tr, writer.Boundary())
+		multipartFanout := multipart.NewReader(&buf, writer.Boundary())
+		return NewSkyfileMultipartReader(multipartReader, multipartFanout, sup)
+	}
+	sup := SkyfileUploadParameters{
+		Filename: t.Name(),
+		Mode:     DefaultFilePerm,
+	}
+
+	// By default the truncated body results in an error.
+	_, err = ioutil.ReadAll(newReader(sup))
+	if !errors.Contains(err, ErrSkyfileUploadTruncated) {
+		t.Fatal("expected truncated error", err)
+	}
+
+	// If allowed, the truncated part is treated as the last part.
+	sup.AllowUnexpectedEOF = true
+	sfReader := newReader(sup)
+	readData, err := ioutil.ReadAll(sfReader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(readData, data[:len(readData)]) {
+		t.Fatal("unexpected data")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	metadata, err := sfReader.SkyfileMetadata(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(metadata.Subfiles) != 1 || metadata.Subfiles["part1"].Len != uint64(len(readData)) {
+		t.Fatal("unexpected subfiles", metadata.Subfiles)
+	}
+}
+
+// testSkyfileMultipartReaderVerifyContentTypes verifies that the multipart
+// reader rejects subfiles whose declared content type contradicts their data
+// if VerifyContentTypes is set.
+func testSkyfileMultipartReaderVerifyContentTypes(t *testing.T) {
+	t.Parallel()
+
+	png := append([]byte("\x89PNG\x0D\x0A\x1A\x0A"), fastrand.Bytes(1000)...)
+
+	// newReader is a helper that creates a reader for a multipart body with a
+	// single png subfile declared with the given content type.
+	newReader := func(contentType string, sup SkyfileUploadParameters) SkyfileUploadReader {
+		buffer := new(bytes.Buffer)
+		writer := multipart.NewWriter(buffer)
+		part, err := writer.CreatePart(createFormFileHeaders("files[]", "image.png", "600", contentType))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = part.Write(png)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = writer.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		tr := io.TeeReader(bytes.NewReader(buffer.Bytes()), &buf)
+		multipartReader := multipart.NewReader(tr, writer.Boundary())
+		multipartFanout := multipart.NewReader(&buf, writer.Boundary())
+		return NewSkyfileMultipartReader(multipartReader, multipartFanout, sup)
+	}
+	sup := SkyfileUploadParameters{
+		Filename: t.Name(),
+		Mode:     DefaultFilePerm,
+	}
+
+	// Without verification the mismatching content type is accepted.
+	_, err := ioutil.ReadAll(newReader("text/plain", sup))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// With verification the matching content type is accepted and left
+	// untouched.
+	sup.VerifyContentTypes = true
+	sfReader := newReader("image/png", sup)
+	readData, err := ioutil.ReadAll(sfReader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(readData, png) {
+		t.Fatal("unexpected data")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	metadata, err := sfReader.SkyfileMetadata(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metadata.Subfiles["image.png"].ContentType != "image/png" {
+		t.Fatal("unexpected content type", metadata.Subfiles["image.png"].ContentType)
+	}
+
+	// The mismatching content type is rejected.
+	_, err = ioutil.ReadAll(newReader("text/plain", sup))
+	if !errors.Contains(err, ErrSkyfileContentTypeMismatch) {
+		t.Fatal("expected content type mismatch", err)
+	}
+}
+
+// testSkyfileMultipartReaderMaxSubfiles verifies the skyfile multipart reader
+// fails as soon as the upload contains more than the maximum number of
+// subfiles.
+func testSkyfileMultipartReaderMaxSubfiles(t *testing.T) {
+	t.Parallel()
+
+	// newReader creates a skyfile reader for an upload with the given number
+	// of subfiles and the given maximum.
+	newReader := func(numSubfiles, maxSubfiles int) SkyfileUploadReader {
+		buffer := new(bytes.Buffer)
+		writer := multipart.NewWriter(buffer)
+		off := uint64(0)
+		for i := 0; i < numSubfiles; i++ {
+			_, err := AddMultipartFile(writer, []byte{byte(i)}, "files[]", fmt.Sprintf("file%v", i), 0600, &off)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		err := writer.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		sup := SkyfileUploadParameters{
+			Filename:    t.Name(),
+			Mode:        DefaultFilePerm,
+			MaxSubfiles: maxSubfiles,
+		}
+		multipartReader := multipart.NewReader(bytes.NewReader(buffer.Bytes()), writer.Boundary())
+		return NewSkyfileMultipartReader(multipartReader, nil, sup)
+	}
+
+	// at the default limit the upload succeeds
+	sfReader := newReader(DefaultSkyfileMaxSubfiles, 0)
+	_, err := ioutil.ReadAll(sfReader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sm, err := sfReader.SkyfileMetadata(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sm.Subfiles) != DefaultSkyfileMaxSubfiles {
+		t.Fatalf("expected %v subfiles but got %v", DefaultSkyfileMaxSubfiles, len(sm.Subfiles))
+	}
+
+	// just over the default limit the upload fails
+	_, err = ioutil.ReadAll(newReader(DefaultSkyfileMaxSubfiles+1, 0))
+	if !errors.Contains(err, ErrTooManySubfiles) {
+		t.Fatalf("expected ErrTooManySubfiles but got '%v'", err)
+	}
+
+	// a custom limit is applied instead of the default
+	_, err = ioutil.ReadAll(newReader(DefaultSkyfileMaxSubfiles+1, DefaultSkyfileMaxSubfiles+1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = ioutil.ReadAll(newReader(3, 2))
+	if !errors.Contains(err, ErrTooManySubfiles) {
+		t.Fatalf("expected ErrTooManySubfiles but got '%v'", err)
+	}
+}
+
+// testSkyfileMultipartReaderContentHash verifies that the skyfile multipart
+// reader hashes the concatenated data of its subfiles.
+func testSkyfileMultipartReaderContentHash(t *testing.T) {
+	t.Parallel()
+
+	// create a multipart request with two files
+	buffer := new(bytes.Buffer)
+	writer := multipart.NewWriter(buffer)
+	data1 := fastrand.Bytes(fastrand.Intn(1000) + 10)
+	data2 := fastrand.Bytes(fastrand.Intn(1000) + 10)
+	off := uint64(0)
+	_, err1 := AddMultipartFile(writer, data1, "files[]", "part1", 0600, &off)
+	_, err2 := AddMultipartFile(writer, data2, "files[]", "part2", 0600, &off)
+	if err := errors.Compose(err1, err2, writer.Close()); err != nil {
+		t.Fatal(err)
+	}
+
+	// turn it into a skyfile reader
+	sup := SkyfileUploadParameters{
+		Filename:      t.Name(),
+		Mode:          DefaultFilePerm,
+		ContentHasher: sha256.New(),
+	}
+	var buf bytes.Buffer
+	tr := io.TeeReader(bytes.NewReader(buffer.Bytes()), &buf)
+	multipartReader := multipart.NewReader(tr, writer.Boundary())
+	multipartFanout := multipart.NewReader(&buf, writer.Boundary())
+	sfReader := NewSkyfileMultipartReader(multipartReader, multipartFanout, sup)
+
+	// read all data as well as the fanout data
+	data := append(data1, data2...)
+	readData, err := ioutil.ReadAll(sfReader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(readData, data) {
+		t.Fatal("unexpected data")
+	}
+	_, err = ioutil.ReadAll(sfReader.FanoutReader())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the fanout data shouldn't have been hashed
+	expected := sha256.Sum256(data)
+	if !bytes.Equal(sup.ContentHasher.Sum(nil), expected[:]) {
+		t.Fatal("unexpected content hash")
+	}
+}
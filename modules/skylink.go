@@ -8,11 +8,13 @@ import (
 	"encoding/base32"
 	"encoding/base64"
 	"encoding/binary"
+	"fmt"
 	"math/bits"
 	"strings"
 
 	"gitlab.com/NebulousLabs/Sia/build"
 	"gitlab.com/NebulousLabs/Sia/crypto"
+	"gitlab.com/NebulousLabs/Sia/types"
 
 	"gitlab.com/NebulousLabs/errors"
 )
@@ -41,6 +43,10 @@ var (
 	// ErrSkylinkIncorrectSize is returned when a string could not be decoded
 	// into a Skylink due to it having an incorrect size.
 	ErrSkylinkIncorrectSize = errors.New("skylink has incorrect size")
+
+	// ErrSkylinkOutOfBounds is returned when a v1 Skylink is created with an
+	// offset and fetch size that exceed the size of a sector.
+	ErrSkylinkOutOfBounds = errors.New("offset plus fetch size cannot exceed the size of one sector - 4 MiB")
 )
 
 type (
@@ -73,11 +79,30 @@ func NewSkylinkV1(merkleRoot crypto.Hash, offset, length uint64) (Skylink, error
 	return sl, nil
 }
 
+// NewSkylinkV2 returns a v2 Skylink object for the registry entry with the
+// given public key and tweak. Instead of the merkle root of a sector, a v2
+// skylink contains the ID of the registry entry which points to the content.
+//
+// NOTE: v2 skylinks can't be resolved yet and are therefore not accepted by
+// LoadString and LoadBytes.
+func NewSkylinkV2(spk types.SiaPublicKey, tweak crypto.Hash) Skylink {
+	return Skylink{
+		bitfield:   1,
+		merkleRoot: crypto.HashAll(spk, tweak),
+	}
+}
+
 // isSkylinkV1 returns a boolean indicating if the Skylink is a V1 skylink
 func isSkylinkV1(bitfield uint16) bool {
 	return bitfield&3 == 0
 }
 
+// isSkylinkV2 returns a boolean indicating if the Skylink is a V2 skylink. A
+// v2 skylink has the version bits set to '01' and no other bits set.
+func isSkylinkV2(bitfield uint16) bool {
+	return bitfield == 1
+}
+
 // validateAndParseV1Bitfield is a helper method which validates that a bitfield
 // is valid and also parses the offset and fetch size from the bitfield. These
 // two actions are performed at once because performing full validation requires
@@ -164,6 +189,11 @@ func (sl Skylink) IsSkylinkV1() bool {
 	return isSkylinkV1(sl.bitfield)
 }
 
+// IsSkylinkV2 returns a boolean indicating if the Skylink is a V2 skylink
+func (sl Skylink) IsSkylinkV2() bool {
+	return isSkylinkV2(sl.bitfield)
+}
+
 // LoadString converts from a string and loads the result into sl.
 func (sl *Skylink) LoadString(s string) error {
 	// Trim any parameters that may exist after a question mark. Eventually, it
@@ -347,8 +377,9 @@ func (sl *Skylink) LoadBytes(data []byte) error {
 // the skylink. Offset must be aligned correctly. setOffsetAndLen implies that
 // the version is 1, so the version will also be set to 1.
 func (sl *Skylink) setOffsetAndFetchSize(offset, fetchSize uint64) error {
-	if offset+fetchSize > SkylinkMaxFetchSize {
-		return errors.New("offset plus fetch size cannot exceed the size of one sector - 4 MiB")
+	// Check the values separately to prevent the sum from overflowing.
+	if fetchSize > SkylinkMaxFetchSize || offset > SkylinkMaxFetchSize-fetchSize {
+		return errors.AddContext(ErrSkylinkOutOfBounds, fmt.Sprintf("offset %v, fetch size %v", offset, fetchSize))
 	}
 
 	// Given the fetch size, determine the appropriate offset alignment.
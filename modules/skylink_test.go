@@ -2,9 +2,11 @@ package modules
 
 import (
 	"encoding/base32"
+	"math"
 	"testing"
 
 	"gitlab.com/NebulousLabs/Sia/crypto"
+	"gitlab.com/NebulousLabs/Sia/types"
 	"gitlab.com/NebulousLabs/errors"
 
 	"gitlab.com/NebulousLabs/fastrand"
@@ -287,6 +289,75 @@ func TestSkylink(t *testing.T) {
 	}
 }
 
+// TestNewSkylinkV1OutOfBounds verifies that NewSkylinkV1 rejects an offset and
+// fetch size that exceed a sector.
+func TestNewSkylinkV1OutOfBounds(t *testing.T) {
+	mr := crypto.HashObject("fdsa")
+	tests := []struct {
+		offset    uint64
+		fetchSize uint64
+		valid     bool
+	}{
+		{0, SkylinkMaxFetchSize, true},
+		{0, SkylinkMaxFetchSize + 1, false},
+		{1 << 19, SkylinkMaxFetchSize - 1<<19, true},
+		{1 << 19, SkylinkMaxFetchSize, false},
+		{math.MaxUint64, 4096, false},
+		{4096, math.MaxUint64, false},
+	}
+	for _, test := range tests {
+		_, err := NewSkylinkV1(mr, test.offset, test.fetchSize)
+		if test.valid && err != nil {
+			t.Errorf("offset %v, fetch size %v: unexpected error %v", test.offset, test.fetchSize, err)
+		}
+		if !test.valid && !errors.Contains(err, ErrSkylinkOutOfBounds) {
+			t.Errorf("offset %v, fetch size %v: expected %v but got %v", test.offset, test.fetchSize, ErrSkylinkOutOfBounds, err)
+		}
+	}
+}
+
+// TestSkylinkV2 tests the creation of v2 skylinks.
+func TestSkylinkV2(t *testing.T) {
+	_, pk := crypto.GenerateKeyPair()
+	spk := types.Ed25519PublicKey(pk)
+	var tweak crypto.Hash
+	fastrand.Read(tweak[:])
+
+	sl := NewSkylinkV2(spk, tweak)
+	if sl.Version() != 2 {
+		t.Fatal("bad version:", sl.Version())
+	}
+	if !sl.IsSkylinkV2() || sl.IsSkylinkV1() {
+		t.Fatal("skylink should be v2")
+	}
+	if sl.MerkleRoot() != crypto.HashAll(spk, tweak) {
+		t.Fatal("v2 skylink should contain the registry entry id")
+	}
+
+	// The skylink should be deterministic and unique per key and tweak.
+	if NewSkylinkV2(spk, tweak) != sl {
+		t.Fatal("v2 skylink isn't deterministic")
+	}
+	var tweak2 crypto.Hash
+	fastrand.Read(tweak2[:])
+	if NewSkylinkV2(spk, tweak2) == sl {
+		t.Fatal("v2 skylinks with different tweaks should differ")
+	}
+	_, pk2 := crypto.GenerateKeyPair()
+	if NewSkylinkV2(types.Ed25519PublicKey(pk2), tweak) == sl {
+		t.Fatal("v2 skylinks with different keys should differ")
+	}
+
+	// v1 skylinks aren't v2 skylinks.
+	sl, err := NewSkylinkV1(crypto.HashObject("fdsa"), 0, 4096)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sl.IsSkylinkV2() {
+		t.Fatal("v1 skylink shouldn't be v2")
+	}
+}
+
 // TestSkylinkAutoExamples performs a brute force test over lots of values for
 // the skylink bitfield to ensure correctness.
 func TestSkylinkAutoExamples(t *testing.T) {
@@ -3,6 +3,7 @@ package modules
 import (
 	"encoding/binary"
 	"errors"
+	"hash"
 	"io"
 	"math"
 	"os"
@@ -41,6 +42,39 @@ var (
 	// ExtendedSuffix is the suffix that is added to a skyfile siapath if it is
 	// a large file upload
 	ExtendedSuffix = "-extended"
+
+	// SupportedSkyfileVersions lists all of the skyfile layout versions that
+	// this node is able to parse.
+	SupportedSkyfileVersions = []uint8{SkyfileVersion}
+
+	// SkyfileHTTPHeaderAllowlist lists the HTTP headers that can be set as
+	// hints in the metadata of a skyfile. Header names are expected in their
+	// canonical form.
+	SkyfileHTTPHeaderAllowlist = map[string]struct{}{
+		"Cache-Control":       {},
+		"Content-Disposition": {},
+		"Content-Language":    {},
+	}
+
+	// DefaultSkyfileMaxSubfiles is the default maximum number of subfiles a
+	// skyfile can contain. It protects against uploads that declare an
+	// excessive number of subfiles. Renters can configure the limit through
+	// their settings.
+	DefaultSkyfileMaxSubfiles = build.Select(build.Var{
+		Dev:      10000,
+		Standard: 10000,
+		Testing:  1000,
+	}).(int)
+)
+
+var (
+	// ErrUnsupportedSkyfileVersion is returned when a base sector contains a
+	// layout with a version that this node does not understand.
+	ErrUnsupportedSkyfileVersion = errors.New("unsupported skyfile version")
+
+	// ErrInvalidHTTPHeaderHint is returned when the metadata of a skyfile
+	// contains an HTTP header hint that is not allowed or malformed.
+	ErrInvalidHTTPHeaderHint = errors.New("invalid http header hint")
 )
 
 var (
@@ -88,6 +122,19 @@ type (
 		// the user.
 		BaseChunkRedundancy uint8
 
+		// ConsistentBaseSectorHosts determines whether the hosts of the base
+		// sector are selected by consistent hashing of the base sector's
+		// Merkle root. This causes the same base sector to always be uploaded
+		// to the same hosts as long as they are available.
+		ConsistentBaseSectorHosts bool
+
+		// FanoutDataPieces and FanoutParityPieces override the erasure coding
+		// parameters of the fanout of large skyfiles. They need to be set
+		// together, if neither is set the renter defaults are used. The
+		// parameters are recorded in the layout of the skyfile.
+		FanoutDataPieces   uint8
+		FanoutParityPieces uint8
+
 		// Filename indicates the filename of the skyfile.
 		Filename string
 
@@ -105,9 +152,35 @@ type (
 		// content will be automatically served for the skyfile.
 		DisableDefaultPath bool
 
+		// CreatedAt optionally records the original upload time of the
+		// skyfile as a unix timestamp. It becomes part of the metadata and
+		// therefore changes the skylink. It can't lie in the future.
+		CreatedAt int64
+
+		// HTTPHeaders contains optional HTTP header hints, such as
+		// Cache-Control, that portals can use when serving the skyfile. Only
+		// the headers in SkyfileHTTPHeaderAllowlist are accepted.
+		HTTPHeaders map[string]string
+
+		// VerifyContentTypes determines whether the content types declared
+		// for the subfiles of a multipart upload are verified against the
+		// content types sniffed from their data. If a declared content type
+		// clearly contradicts the data, the upload fails.
+		VerifyContentTypes bool
+
+		// MaxSubfiles is the maximum number of subfiles of a multipart
+		// upload. If it is 0, DefaultSkyfileMaxSubfiles is used.
+		MaxSubfiles int
+
 		// Reader supplies the file data for the skyfile.
 		Reader io.Reader
 
+		// Fanout optionally supplies a precomputed fanout when creating a
+		// skylink from a siafile that was already uploaded, e.g. from a prior
+		// conversion. Every chunk of it is validated against the piece roots
+		// of the siafile and it is used instead of encoding the fanout again.
+		Fanout []byte
+
 		// SkykeyName is the name of the Skykey that should be used to encrypt
 		// the Skyfile.
 		SkykeyName string
@@ -119,6 +192,175 @@ type (
 		// a Skykey will be derived from the Master Skykey found under that
 		// name/ID to be used for this specific upload.
 		FileSpecificSkykey skykey.Skykey
+
+		// PinEncryptedWithoutKey is only used when pinning a skylink. If set,
+		// an encrypted skyfile for which the node doesn't hold the skykey is
+		// still pinned by re-uploading its base sector verbatim instead of
+		// failing the pin.
+		PinEncryptedWithoutKey bool
+
+		// PinMaxConcurrentChunks is only used when pinning a skylink. It
+		// limits the number of fanout chunks that are uploaded concurrently
+		// for the pin so that a single large pin can't monopolize the
+		// workers. If it is 0 there is no limit.
+		PinMaxConcurrentChunks uint64
+
+		// PinLowPriority is only used when pinning a skylink. If set, the
+		// fanout is uploaded with low priority, which allows pins that don't
+		// set it to preempt the pin.
+		PinLowPriority bool
+
+		// PinKeepBaseSectorOnCancel is only used when pinning a skylink. If
+		// set, the already uploaded base sector is kept when the pin is
+		// canceled while uploading the fanout. Otherwise it is deleted
+		// together with the partially uploaded fanout.
+		PinKeepBaseSectorOnCancel bool
+
+		// AllowUnexpectedEOF determines how an io.ErrUnexpectedEOF returned by
+		// the upload's reader is handled. By default the upload fails with
+		// ErrSkyfileUploadTruncated since the data was likely cut short. If
+		// set, the error is treated as the regular end of the data instead.
+		AllowUnexpectedEOF bool
+
+		// IdempotencyKey optionally identifies the upload. If an upload with
+		// the same key succeeded recently and its siafile still exists, the
+		// skylink of that upload is returned instead of uploading the data
+		// again. This allows clients to safely retry uploads.
+		IdempotencyKey string
+
+		// TTL optionally limits how long the node keeps the siafiles of the
+		// upload. If set, the base and extended siafiles are deleted once the
+		// TTL has passed. The data might still be available from the hosts
+		// until their contracts expire, but it won't be repaired anymore.
+		TTL time.Duration
+
+		// SkylinkV2 optionally contains the parameters for registering a v2
+		// skylink that points to the v1 skylink of the upload. It is only
+		// used by UploadSkyfileV2.
+		SkylinkV2 *SkylinkV2Parameters
+
+		// ContentHasher optionally computes a digest of the file data of the
+		// upload, e.g. a SHA-256 hash, while the data is read by the
+		// upload's reader. For multipart uploads it hashes the concatenated
+		// data of the subfiles. The digest is returned by UploadSkyfileV2.
+		// The hasher needs to be set before the reader is created.
+		ContentHasher hash.Hash
+	}
+
+	// SkylinkV2Parameters are the parameters for registering a v2 skylink
+	// alongside the upload of a skyfile. The registry entry of the v2 skylink
+	// is identified by the PublicKey and DataKey and contains the v1 skylink
+	// of the upload.
+	SkylinkV2Parameters struct {
+		// PublicKey is the key the registry entry is registered under. It
+		// needs to match the SecretKey.
+		PublicKey types.SiaPublicKey
+
+		// SecretKey is used to sign the registry entry.
+		SecretKey crypto.SecretKey
+
+		// DataKey is the tweak of the registry entry. It allows for
+		// registering multiple v2 skylinks under the same PublicKey.
+		DataKey crypto.Hash
+
+		// Revision is the revision number of the registry entry. It needs to
+		// be higher than the revision of any earlier entry with the same
+		// PublicKey and DataKey.
+		Revision uint64
+	}
+
+	// SkyfileUploadResult contains the skylinks of an upload. Skylink is the
+	// v1 skylink that points to the content of the upload. SkylinkV2 is the
+	// v2 skylink that resolves to Skylink and is only set if it was
+	// requested.
+	SkyfileUploadResult struct {
+		Skylink   Skylink
+		SkylinkV2 Skylink
+
+		// ContentHash is the digest of the file data computed by the
+		// ContentHasher of the upload parameters. It is only set if a
+		// ContentHasher was provided.
+		ContentHash []byte
+	}
+
+	// PinnedSkylink is a skylink that is pinned by the node together with the
+	// siapath of the siafile that pins it.
+	PinnedSkylink struct {
+		Skylink Skylink
+		SiaPath SiaPath
+	}
+
+	// SkyfileFanout is the decoded fanout of a skyfile together with the
+	// erasure coding parameters used to create it. It allows external tools
+	// to fetch and recover the chunks of a skyfile from the hosts.
+	//
+	// NOTE: if the fanout uses 1-of-N erasure coding without encryption, all
+	// pieces of a chunk are identical and only a single root is stored for
+	// every chunk.
+	SkyfileFanout struct {
+		DataPieces   uint8             `json:"datapieces"`
+		ParityPieces uint8             `json:"paritypieces"`
+		CipherType   crypto.CipherType `json:"ciphertype"`
+		ChunkRoots   [][]crypto.Hash   `json:"chunkroots"`
+	}
+
+	// SkylinkRedundancy summarizes how many hosts currently report holding
+	// the sectors of a skylink. It is gathered through HasSector queries and
+	// doesn't require downloading the data of the skyfile.
+	SkylinkRedundancy struct {
+		// NumHosts is the number of hosts that answered the queries before
+		// the timeout. If the fanout was sampled, it's the smaller number of
+		// answers of the base sector and fanout queries.
+		NumHosts uint64
+
+		// BaseSectorHosts is the number of hosts that hold the base sector.
+		BaseSectorHosts uint64
+
+		// DataPieces and ParityPieces are the erasure coding parameters of
+		// the fanout. NumChunks is the total number of chunks in the
+		// fanout, Chunks contains the sampled ones.
+		DataPieces   uint8
+		ParityPieces uint8
+		NumChunks    uint64
+		Chunks       []SkylinkChunkRedundancy
+	}
+
+	// SkylinkChunkRedundancy contains the number of hosts holding every piece
+	// of a fanout chunk.
+	SkylinkChunkRedundancy struct {
+		Index      uint64
+		PieceHosts []uint64
+	}
+
+	// SkyfileByteRange is a range of bytes within a skyfile together with the
+	// index of the fanout chunk that contains it.
+	SkyfileByteRange struct {
+		Offset     uint64
+		Length     uint64
+		ChunkIndex uint64
+	}
+
+	// SkyfileCostEstimate is the estimated cost of uploading a skyfile and
+	// storing it for one allowance period. It is based on the price tables of
+	// the hosts the renter has workers for.
+	SkyfileCostEstimate struct {
+		// BaseSectors is the number of sectors uploaded for the base sector
+		// and FanoutSectors the number of sectors uploaded for the
+		// FanoutChunks chunks of the fanout.
+		BaseSectors   uint64
+		FanoutChunks  uint64
+		FanoutSectors uint64
+
+		// NumHosts is the number of price tables the estimate is based on
+		// and Period the number of blocks the data is stored for.
+		NumHosts uint64
+		Period   types.BlockHeight
+
+		// The breakdown of the estimated cost.
+		StorageCost         types.Currency
+		UploadBandwidthCost types.Currency
+		WriteCost           types.Currency
+		TotalCost           types.Currency
 	}
 
 	// SkyfileMultipartUploadParameters defines the parameters specific to
@@ -145,16 +387,35 @@ type (
 
 		// ContentType indicates the media of the data supplied by the reader.
 		ContentType string
+
+		// VerifyContentTypes determines whether the declared content types
+		// of the subfiles are verified against their data.
+		VerifyContentTypes bool
 	}
 
 	// SkyfilePinParameters defines the parameters specific to pinning a
 	// skylink. See SkyfileUploadParameters for a detailed description of the
 	// fields.
 	SkyfilePinParameters struct {
-		SiaPath             SiaPath `json:"siapath"`
-		Force               bool    `json:"force"`
-		Root                bool    `json:"root"`
-		BaseChunkRedundancy uint8   `json:"basechunkredundancy"`
+		SiaPath                SiaPath `json:"siapath"`
+		Force                  bool    `json:"force"`
+		Root                   bool    `json:"root"`
+		BaseChunkRedundancy    uint8   `json:"basechunkredundancy"`
+		PinEncryptedWithoutKey bool    `json:"pinencryptedwithoutkey"`
+		MaxConcurrentChunks    uint64  `json:"maxconcurrentchunks"`
+		LowPriority            bool    `json:"lowpriority"`
+
+		// BaseSectorOnly indicates that only the base sector is pinned and
+		// not the fanout.
+		BaseSectorOnly bool `json:"basesectoronly"`
+
+		// KeepBaseSectorOnCancel indicates that the base sector is kept if
+		// the pin is canceled while uploading the fanout.
+		KeepBaseSectorOnCancel bool `json:"keepbasesectoroncancel"`
+
+		// BaseSectorTimeout is the timeout in seconds for fetching the base
+		// sector. If 0 the node uses a fraction of the overall timeout.
+		BaseSectorTimeout int `json:"basesectortimeout"`
 	}
 
 	// SkyfileMetadata is all of the metadata that gets placed into the first
@@ -163,12 +424,14 @@ type (
 	// into the leading bytes of the skyfile, meaning that this struct can be
 	// extended without breaking compatibility.
 	SkyfileMetadata struct {
-		Filename           string          `json:"filename,omitempty"`
-		Length             uint64          `json:"length,omitempty"`
-		Mode               os.FileMode     `json:"mode,omitempty"`
-		Subfiles           SkyfileSubfiles `json:"subfiles,omitempty"`
-		DefaultPath        string          `json:"defaultpath,omitempty"`
-		DisableDefaultPath bool            `json:"disabledefaultpath,omitempty"`
+		Filename           string            `json:"filename,omitempty"`
+		Length             uint64            `json:"length,omitempty"`
+		Mode               os.FileMode       `json:"mode,omitempty"`
+		Subfiles           SkyfileSubfiles   `json:"subfiles,omitempty"`
+		DefaultPath        string            `json:"defaultpath,omitempty"`
+		DisableDefaultPath bool              `json:"disabledefaultpath,omitempty"`
+		HTTPHeaders        map[string]string `json:"httpheaders,omitempty"`
+		CreatedAt          int64             `json:"createdat,omitempty"`
 	}
 
 	// SkynetPortal contains information identifying a Skynet portal.
@@ -177,6 +440,20 @@ type (
 		Public  bool       `json:"public"`  // indicates whether the portal can be accessed publicly or not
 
 	}
+
+	// SkynetPortalUpdateResult is the result of a single addition or removal
+	// of a Skynet portal. The error is empty if the change was applied.
+	SkynetPortalUpdateResult struct {
+		Address NetAddress `json:"address"`
+		Error   string     `json:"error,omitempty"`
+	}
+
+	// SkynetPortalsUpdateResult contains the results of a partial update of
+	// the Skynet portals list in the order of the requested changes.
+	SkynetPortalsUpdateResult struct {
+		Additions []SkynetPortalUpdateResult `json:"additions"`
+		Removals  []SkynetPortalUpdateResult `json:"removals"`
+	}
 )
 
 // ForPath returns a subset of the SkyfileMetadata that contains all of the
@@ -238,6 +515,23 @@ func (sm SkyfileMetadata) ContentType() string {
 	return ""
 }
 
+// WithDefaultContentType returns a copy of the metadata in which every subfile
+// without a content type has the given content type.
+func (sm SkyfileMetadata) WithDefaultContentType(contentType string) SkyfileMetadata {
+	if contentType == "" || len(sm.Subfiles) == 0 {
+		return sm
+	}
+	subfiles := make(SkyfileSubfiles, len(sm.Subfiles))
+	for name, sf := range sm.Subfiles {
+		if sf.ContentType == "" {
+			sf.ContentType = contentType
+		}
+		subfiles[name] = sf
+	}
+	sm.Subfiles = subfiles
+	return sm
+}
+
 // IsDirectory returns true if the SkyfileMetadata represents a directory.
 func (sm SkyfileMetadata) IsDirectory() bool {
 	if len(sm.Subfiles) > 1 {
@@ -279,6 +573,33 @@ func (sm SkyfileMetadata) offset() uint64 {
 	return min
 }
 
+// Recoverable returns whether the base sector is held by at least one host and
+// enough pieces of every sampled chunk are held by at least one host to
+// recover the chunk.
+func (sr SkylinkRedundancy) Recoverable() bool {
+	if sr.BaseSectorHosts == 0 {
+		return false
+	}
+	for _, chunk := range sr.Chunks {
+		if chunk.AvailablePieces() < uint64(sr.DataPieces) {
+			return false
+		}
+	}
+	return true
+}
+
+// AvailablePieces returns the number of pieces of the chunk that are held by at
+// least one host.
+func (scr SkylinkChunkRedundancy) AvailablePieces() uint64 {
+	var available uint64
+	for _, hosts := range scr.PieceHosts {
+		if hosts > 0 {
+			available++
+		}
+	}
+	return available
+}
+
 // SkyfileLayout explains the layout information that is used for storing data
 // inside of the skyfile. The SkyfileLayout always appears as the first bytes
 // of the leading chunk.
@@ -362,6 +683,22 @@ func (sl *SkyfileLayout) DecodeFanoutIntoChunks(fanoutBytes []byte) ([][]crypto.
 	return chunks, nil
 }
 
+// DecodeSkyfileFanout decodes the fanout bytes of a skyfile into the piece
+// roots of every chunk, using the erasure coding parameters of the given
+// layout.
+func DecodeSkyfileFanout(fanoutBytes []byte, sl SkyfileLayout) (SkyfileFanout, error) {
+	chunkRoots, err := sl.DecodeFanoutIntoChunks(fanoutBytes)
+	if err != nil {
+		return SkyfileFanout{}, err
+	}
+	return SkyfileFanout{
+		DataPieces:   sl.FanoutDataPieces,
+		ParityPieces: sl.FanoutParityPieces,
+		CipherType:   sl.CipherType,
+		ChunkRoots:   chunkRoots,
+	}, nil
+}
+
 // Encode will return a []byte that has compactly encoded all of the layout
 // data.
 func (sl *SkyfileLayout) Encode() []byte {
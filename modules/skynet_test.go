@@ -2,6 +2,7 @@ package modules
 
 import (
 	"bytes"
+	"reflect"
 	"strings"
 	"testing"
 
@@ -305,3 +306,55 @@ func TestSkyfileMetadata_IsDirectory(t *testing.T) {
 		}
 	}
 }
+
+// TestSkyfileMetadata_WithDefaultContentType verifies that the default content
+// type is only applied to subfiles without a content type and that the
+// original metadata isn't modified.
+func TestSkyfileMetadata_WithDefaultContentType(t *testing.T) {
+	t.Parallel()
+
+	defaultCT := "application/octet-stream"
+	sm := SkyfileMetadata{
+		Filename: "dir",
+		Subfiles: SkyfileSubfiles{
+			"a.txt": SkyfileSubfileMetadata{Filename: "a.txt", ContentType: "text/plain", Len: 10},
+			"b":     SkyfileSubfileMetadata{Filename: "b", Offset: 10, Len: 10},
+		},
+	}
+	withDefault := sm.WithDefaultContentType(defaultCT)
+	if ct := withDefault.Subfiles["a.txt"].ContentType; ct != "text/plain" {
+		t.Fatalf("declared content type was overwritten: %v", ct)
+	}
+	if ct := withDefault.Subfiles["b"].ContentType; ct != defaultCT {
+		t.Fatalf("expected default content type %v, got %v", defaultCT, ct)
+	}
+	if ct := sm.Subfiles["b"].ContentType; ct != "" {
+		t.Fatalf("original metadata was modified: %v", ct)
+	}
+
+	// An empty default doesn't change anything.
+	withDefault = sm.WithDefaultContentType("")
+	if ct := withDefault.Subfiles["b"].ContentType; ct != "" {
+		t.Fatalf("expected no content type, got %v", ct)
+	}
+
+	// The directory itself still doesn't report a content type.
+	withDefault = sm.WithDefaultContentType(defaultCT)
+	if ct := withDefault.ContentType(); ct != "" {
+		t.Fatalf("expected no content type for the directory, got %v", ct)
+	}
+
+	// A subpath of the directory reports the default content type of its
+	// subfile.
+	subMeta, _, _, _ := withDefault.ForPath("b")
+	if ct := subMeta.ContentType(); ct != defaultCT {
+		t.Fatalf("expected default content type %v, got %v", defaultCT, ct)
+	}
+
+	// Metadata without subfiles is returned as is.
+	sm = SkyfileMetadata{Filename: "file"}
+	withDefault = sm.WithDefaultContentType(defaultCT)
+	if !reflect.DeepEqual(withDefault, sm) {
+		t.Fatal("metadata without subfiles shouldn't be changed", withDefault)
+	}
+}
@@ -11,7 +11,9 @@ import (
 	"net/textproto"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/aead/chacha20/chacha"
 	"gitlab.com/NebulousLabs/Sia/build"
@@ -24,6 +26,35 @@ var (
 	// ErrInvalidDefaultPath is returned when the specified default path is not
 	// valid, e.g. the file it points to does not exist.
 	ErrInvalidDefaultPath = errors.New("invalid default path provided")
+
+	// ErrSkyfileTooLargeForBaseSector is returned when the layout, metadata
+	// and data of a skyfile don't fit within a single base sector.
+	ErrSkyfileTooLargeForBaseSector = errors.New("skyfile doesn't fit within a single base sector")
+
+	// ErrSkyfileContentTypeMismatch is returned when the declared content type
+	// of a subfile contradicts the content type sniffed from its data.
+	ErrSkyfileContentTypeMismatch = errors.New("declared content type doesn't match the content")
+
+	// ErrSkyfileLayoutInconsistent is returned when the filesize declared in
+	// the layout of a skyfile contradicts its fanout or metadata.
+	ErrSkyfileLayoutInconsistent = errors.New("skyfile layout is inconsistent with its fanout or metadata")
+
+	// ErrUnknownSkyfileMetadataField is returned when strictly validating
+	// skyfile metadata which contains a field that isn't allowed.
+	ErrUnknownSkyfileMetadataField = errors.New("skyfile metadata contains unknown field")
+
+	// ErrTooManySubfiles is returned when a skyfile contains more subfiles
+	// than allowed.
+	ErrTooManySubfiles = errors.New("skyfile contains too many subfiles")
+
+	// ErrSkylinkFetchSizeMismatch is returned when the fetch size declared by
+	// a skylink doesn't match the size of the base sector described by the
+	// layout it points at.
+	ErrSkylinkFetchSizeMismatch = errors.New("skylink fetch size doesn't match the skyfile layout")
+
+	// ErrSkyfileSubfilesNotContiguous is returned when the subfiles of a
+	// skyfile don't cover its data back to back without gaps or overlaps.
+	ErrSkyfileSubfilesNotContiguous = errors.New("skyfile subfiles are not contiguous")
 )
 
 // AddMultipartFile is a helper function to add a file to multipart form-data.
@@ -83,6 +114,44 @@ func BuildBaseSector(layoutBytes, fanoutBytes, metadataBytes, fileBytes []byte)
 	return baseSector, uint64(offset)
 }
 
+// BuildSmallSkyfileBaseSector builds the unencrypted base sector of a skyfile
+// whose data fits within the base sector alongside its layout and metadata.
+// It returns the layout, the base sector and the fetch size of the skyfile.
+func BuildSmallSkyfileBaseSector(metadataBytes, fileBytes []byte) (SkyfileLayout, []byte, uint64, error) {
+	if uint64(SkyfileLayoutSize+len(metadataBytes)+len(fileBytes)) > SectorSize {
+		return SkyfileLayout{}, nil, 0, ErrSkyfileTooLargeForBaseSector
+	}
+	sl := SkyfileLayout{
+		Version:      SkyfileVersion,
+		Filesize:     uint64(len(fileBytes)),
+		MetadataSize: uint64(len(metadataBytes)),
+		// No fanout is set yet.
+		CipherType: crypto.TypePlain,
+	}
+	baseSector, fetchSize := BuildBaseSector(sl.Encode(), nil, metadataBytes, fileBytes) // 'nil' because there is no fanout
+	return sl, baseSector, fetchSize, nil
+}
+
+// ComputeSkylink returns the skylink of an unencrypted skyfile with the given
+// metadata and data without uploading anything. It is the skylink a dry run
+// upload of the same skyfile would return. Only skyfiles that fit within a
+// single base sector are supported.
+func ComputeSkylink(metadata SkyfileMetadata, fileBytes []byte) (Skylink, error) {
+	err := ValidateSkyfileMetadata(metadata, 0)
+	if err != nil {
+		return Skylink{}, errors.AddContext(err, "invalid skyfile metadata")
+	}
+	metadataBytes, err := SkyfileMetadataBytes(metadata)
+	if err != nil {
+		return Skylink{}, err
+	}
+	_, baseSector, fetchSize, err := BuildSmallSkyfileBaseSector(metadataBytes, fileBytes)
+	if err != nil {
+		return Skylink{}, err
+	}
+	return NewSkylinkV1(crypto.MerkleRoot(baseSector), 0, fetchSize)
+}
+
 // DecodeFanout will take the fanout bytes from a baseSector and decode them.
 func DecodeFanout(sl SkyfileLayout, fanoutBytes []byte) (piecesPerChunk, chunkRootsSize, numChunks uint64, err error) {
 	// Special case: if the data of the file is using 1-of-N erasure coding,
@@ -210,6 +279,13 @@ func EnsureSuffix(str, suffix string) string {
 	return str + suffix
 }
 
+// ExtendedSiaPath returns the siapath of the siafile that holds the fanout data
+// of the large skyfile uploaded to the given base siapath. By convention this
+// is the base siapath with ExtendedSuffix appended.
+func ExtendedSiaPath(siaPath SiaPath) (SiaPath, error) {
+	return NewSiaPath(siaPath.String() + ExtendedSuffix)
+}
+
 // IsEncryptedBaseSector returns true if and only if the the baseSector is
 // encrypted.
 func IsEncryptedBaseSector(baseSector []byte) bool {
@@ -240,8 +316,9 @@ func ParseSkyfileMetadata(baseSector []byte) (sl SkyfileLayout, fanoutBytes []by
 	offset += SkyfileLayoutSize
 
 	// Check the version.
-	if sl.Version != 1 {
-		return SkyfileLayout{}, nil, SkyfileMetadata{}, nil, fmt.Errorf("unsupported skyfile version %v", sl.Version)
+	err = validateSkyfileLayoutVersion(sl.Version)
+	if err != nil {
+		return SkyfileLayout{}, nil, SkyfileMetadata{}, nil, err
 	}
 
 	// Currently there is no support for skyfiles with fanout + metadata that
@@ -268,6 +345,10 @@ func ParseSkyfileMetadata(baseSector []byte) (sl SkyfileLayout, fanoutBytes []by
 
 	// In version 1, the base sector payload is nil unless there is no fanout.
 	if sl.FanoutSize == 0 {
+		if sl.Filesize > uint64(len(baseSector))-offset {
+			err = errors.AddContext(ErrSkyfileLayoutInconsistent, fmt.Sprintf("filesize %v exceeds the %v bytes left in the base sector", sl.Filesize, uint64(len(baseSector))-offset))
+			return SkyfileLayout{}, nil, SkyfileMetadata{}, nil, err
+		}
 		baseSectorPayload = baseSector[offset : offset+sl.Filesize]
 	}
 
@@ -285,14 +366,149 @@ func SkyfileMetadataBytes(sm SkyfileMetadata) ([]byte, error) {
 	return metadataBytes, nil
 }
 
-// ValidateSkyfileMetadata validates the given SkyfileMetadata
-func ValidateSkyfileMetadata(metadata SkyfileMetadata) error {
+// SkylinkSiaPath returns the canonical siapaths of the siafiles backing the
+// given skylink when the siapath isn't chosen by the user, e.g. when restoring
+// a skyfile from a backup. The base siapath is the skylink's string
+// representation within the SkynetFolder and the extended siapath is derived
+// from it using ExtendedSiaPath.
+func SkylinkSiaPath(skylink Skylink) (base, extended SiaPath, err error) {
+	base, err = SkynetFolder.Join(skylink.String())
+	if err != nil {
+		return SiaPath{}, SiaPath{}, errors.AddContext(err, "unable to create base siapath")
+	}
+	extended, err = ExtendedSiaPath(base)
+	if err != nil {
+		return SiaPath{}, SiaPath{}, errors.AddContext(err, "unable to create extended siapath")
+	}
+	return base, extended, nil
+}
+
+// ValidateSkylinkFetchSize cross-checks the fetch size declared by a skylink
+// against the layout of the base sector it points at. The layout, fanout and
+// metadata, as well as the file data of a skyfile without fanout, make up the
+// base sector and the skylink of the skyfile is created for exactly that size.
+// A skylink with a different fetch size is malformed.
+func ValidateSkylinkFetchSize(link Skylink, sl SkyfileLayout) error {
+	_, fetchSize, err := link.OffsetAndFetchSize()
+	if err != nil {
+		return errors.AddContext(err, "unable to parse skylink")
+	}
+
+	// Compute the size of the base sector. The sizes are checked separately
+	// to prevent the sum from overflowing.
+	if sl.FanoutSize > SectorSize || sl.MetadataSize > SectorSize || (sl.FanoutSize == 0 && sl.Filesize > SectorSize) {
+		return errors.AddContext(ErrSkylinkFetchSizeMismatch, fmt.Sprintf("layout with fanout size %v, metadata size %v and filesize %v exceeds the fetch size %v", sl.FanoutSize, sl.MetadataSize, sl.Filesize, fetchSize))
+	}
+	baseSectorSize := SkyfileLayoutSize + sl.FanoutSize + sl.MetadataSize
+	if sl.FanoutSize == 0 {
+		baseSectorSize += sl.Filesize
+	}
+	expected, err := NewSkylinkV1(link.MerkleRoot(), 0, baseSectorSize)
+	if err != nil {
+		return errors.Compose(ErrSkylinkFetchSizeMismatch, err)
+	}
+	_, expectedFetchSize, err := expected.OffsetAndFetchSize()
+	if err != nil {
+		return errors.Compose(ErrSkylinkFetchSizeMismatch, err)
+	}
+	if fetchSize != expectedFetchSize {
+		return errors.AddContext(ErrSkylinkFetchSizeMismatch, fmt.Sprintf("skylink declares a fetch size of %v but the layout describes a base sector of %v bytes which requires a fetch size of %v", fetchSize, baseSectorSize, expectedFetchSize))
+	}
+	return nil
+}
+
+// ValidateSkyfileLayout cross-checks the filesize declared in the layout of a
+// skyfile against its fanout and metadata. The subfiles of a multipart skyfile
+// need to cover the file back to back, as checked by
+// ValidateSkyfileSubfileOffsets. If the skyfile has a fanout, the number of
+// chunks in the fanout needs to match the number of chunks required to store
+// the filesize.
+func ValidateSkyfileLayout(sl SkyfileLayout, fanoutBytes []byte, sm SkyfileMetadata) error {
+	// Check the subfiles.
+	err := ValidateSkyfileSubfileOffsets(sm.Subfiles, sl.Filesize)
+	if err != nil {
+		return errors.Compose(ErrSkyfileLayoutInconsistent, err)
+	}
+
+	// Check the fanout.
+	if len(fanoutBytes) == 0 {
+		return nil
+	}
+	if sl.FanoutDataPieces == 0 {
+		return errors.AddContext(ErrSkyfileLayoutInconsistent, "fanout without data pieces")
+	}
+	_, _, numChunks, err := DecodeFanout(sl, fanoutBytes)
+	if err != nil {
+		return errors.Compose(ErrSkyfileLayoutInconsistent, err)
+	}
+	chunkSize := uint64(sl.FanoutDataPieces) * SectorSize
+	expectedChunks := sl.Filesize / chunkSize
+	if sl.Filesize%chunkSize != 0 || expectedChunks == 0 {
+		expectedChunks++
+	}
+	if numChunks != expectedChunks {
+		return errors.AddContext(ErrSkyfileLayoutInconsistent, fmt.Sprintf("fanout contains %v chunks but a filesize of %v requires %v chunks of %v bytes", numChunks, sl.Filesize, expectedChunks, chunkSize))
+	}
+	return nil
+}
+
+// ValidateSkyfileSubfileOffsets checks that the subfiles, ordered by their
+// offsets, cover the first filesize bytes of a skyfile back to back without
+// any gaps or overlaps. Empty subfiles share their offset with the following
+// subfile which is why they are ordered first on equal offsets. The returned
+// error identifies the first subfile that doesn't start where the previous one
+// ended.
+func ValidateSkyfileSubfileOffsets(subfiles SkyfileSubfiles, filesize uint64) error {
+	sorted := make([]SkyfileSubfileMetadata, 0, len(subfiles))
+	for _, sf := range subfiles {
+		sorted = append(sorted, sf)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Offset != sorted[j].Offset {
+			return sorted[i].Offset < sorted[j].Offset
+		}
+		if sorted[i].Len != sorted[j].Len {
+			return sorted[i].Len < sorted[j].Len
+		}
+		return sorted[i].Filename < sorted[j].Filename
+	})
+
+	var end uint64
+	for _, sf := range sorted {
+		switch {
+		case sf.Offset > end:
+			return errors.AddContext(ErrSkyfileSubfilesNotContiguous, fmt.Sprintf("gap between offset %v and subfile '%v' at offset %v", end, sf.Filename, sf.Offset))
+		case sf.Offset < end:
+			return errors.AddContext(ErrSkyfileSubfilesNotContiguous, fmt.Sprintf("subfile '%v' at offset %v overlaps the previous subfile ending at offset %v", sf.Filename, sf.Offset, end))
+		case sf.Len > filesize-end:
+			return errors.AddContext(ErrSkyfileSubfilesNotContiguous, fmt.Sprintf("subfile '%v' at offset %v with length %v exceeds the filesize %v", sf.Filename, sf.Offset, sf.Len, filesize))
+		}
+		end += sf.Len
+	}
+	if len(sorted) > 0 && end != filesize {
+		return errors.AddContext(ErrSkyfileSubfilesNotContiguous, fmt.Sprintf("subfiles end at offset %v but the filesize is %v", end, filesize))
+	}
+	return nil
+}
+
+// ValidateSkyfileMetadata validates the given SkyfileMetadata. The metadata may
+// contain at most maxSubfiles subfiles. If maxSubfiles is 0,
+// DefaultSkyfileMaxSubfiles is used.
+func ValidateSkyfileMetadata(metadata SkyfileMetadata, maxSubfiles int) error {
 	// check filename
 	err := ValidatePathString(metadata.Filename, false)
 	if err != nil {
 		return errors.AddContext(err, fmt.Sprintf("invalid filename provided '%v'", metadata.Filename))
 	}
 
+	// check the number of subfiles
+	if maxSubfiles == 0 {
+		maxSubfiles = DefaultSkyfileMaxSubfiles
+	}
+	if len(metadata.Subfiles) > maxSubfiles {
+		return errors.AddContext(ErrTooManySubfiles, fmt.Sprintf("skyfile contains %v subfiles, the maximum is %v", len(metadata.Subfiles), maxSubfiles))
+	}
+
 	// check filename of every subfile
 	if metadata.Subfiles != nil {
 		for filename, md := range metadata.Subfiles {
@@ -314,17 +530,156 @@ func ValidateSkyfileMetadata(metadata SkyfileMetadata) error {
 		return errors.New("'Length' property not set on metadata")
 	}
 
-	// validate default path (only if default path was not explicitly disabled)
-	if !metadata.DisableDefaultPath {
-		metadata.DefaultPath, err = validateDefaultPath(metadata.DefaultPath, metadata.Subfiles)
+	// check creation time
+	if metadata.CreatedAt < 0 {
+		return errors.New("'CreatedAt' property can't be negative")
+	}
+	if metadata.CreatedAt > time.Now().Unix() {
+		return errors.New("'CreatedAt' property can't lie in the future")
+	}
+
+	// check http header hints
+	err = validateHTTPHeaderHints(metadata.HTTPHeaders)
+	if err != nil {
+		return errors.Compose(ErrInvalidHTTPHeaderHint, err)
+	}
+
+	// validate default path
+	return ValidateSkyfileDefaultPath(metadata)
+}
+
+// ValidateSkyfileDefaultPath validates the default path settings of the given
+// metadata. A default path can't be set if it is disabled, it can only be set
+// on skyfiles with subfiles and it needs to point to one of those subfiles.
+func ValidateSkyfileDefaultPath(metadata SkyfileMetadata) error {
+	if metadata.DefaultPath == "" {
+		return nil
+	}
+	if metadata.DisableDefaultPath {
+		return errors.AddContext(ErrInvalidDefaultPath, "DefaultPath and DisableDefaultPath are mutually exclusive and cannot be set together")
+	}
+	if len(metadata.Subfiles) == 0 {
+		return errors.AddContext(ErrInvalidDefaultPath, "DefaultPath is not allowed on skyfiles without subfiles")
+	}
+	_, err := validateDefaultPath(metadata.DefaultPath, metadata.Subfiles)
+	if err != nil {
+		return errors.Compose(ErrInvalidDefaultPath, err)
+	}
+	return nil
+}
+
+// ValidateSkyfileMetadataBytes decodes and validates the given skyfile metadata
+// JSON. If allowedFields is nil, fields that are unknown to SkyfileMetadata are
+// ignored, just like they are when decoding the metadata of a downloaded
+// skyfile. Otherwise the metadata is validated strictly and may only contain
+// the top level fields in allowedFields. This allows portals to reject
+// metadata that doesn't follow their schema. The metadata may contain at most
+// maxSubfiles subfiles, see ValidateSkyfileMetadata.
+func ValidateSkyfileMetadataBytes(metadataBytes []byte, allowedFields []string, maxSubfiles int) (SkyfileMetadata, error) {
+	// check for fields that aren't allowed
+	if allowedFields != nil {
+		var fields map[string]json.RawMessage
+		err := json.Unmarshal(metadataBytes, &fields)
 		if err != nil {
-			return errors.Compose(ErrInvalidDefaultPath, err)
+			return SkyfileMetadata{}, errors.AddContext(err, "unable to unmarshal the skyfile metadata")
+		}
+		allowed := make(map[string]struct{}, len(allowedFields))
+		for _, field := range allowedFields {
+			allowed[field] = struct{}{}
+		}
+		var unknown []string
+		for field := range fields {
+			if _, ok := allowed[field]; !ok {
+				unknown = append(unknown, field)
+			}
+		}
+		if len(unknown) > 0 {
+			sort.Strings(unknown)
+			return SkyfileMetadata{}, errors.AddContext(ErrUnknownSkyfileMetadataField, fmt.Sprintf("fields %v are not allowed, allowed fields are %v", unknown, allowedFields))
 		}
 	}
 
+	var metadata SkyfileMetadata
+	err := json.Unmarshal(metadataBytes, &metadata)
+	if err != nil {
+		return SkyfileMetadata{}, errors.AddContext(err, "unable to unmarshal the skyfile metadata")
+	}
+	err = ValidateSkyfileMetadata(metadata, maxSubfiles)
+	if err != nil {
+		return SkyfileMetadata{}, err
+	}
+	return metadata, nil
+}
+
+// ValidateSkyfileVersion checks that the layout at the start of the given base
+// sector has a version that is supported by this node. The version is one of
+// the visible-by-default fields of the layout, which means this check can be
+// performed before the base sector is decrypted.
+func ValidateSkyfileVersion(baseSector []byte) error {
+	if len(baseSector) < SkyfileLayoutSize {
+		return errors.New("base sector is too small to contain a skyfile layout")
+	}
+	var sl SkyfileLayout
+	sl.Decode(baseSector)
+	return validateSkyfileLayoutVersion(sl.Version)
+}
+
+// ValidateSubfileContentType sniffs the content type of a subfile from its
+// leading bytes and returns ErrSkyfileContentTypeMismatch if the declared
+// content type clearly contradicts it. The declared content type is part of
+// the metadata and therefore the skylink, so it is only validated and never
+// corrected.
+func ValidateSubfileContentType(declared string, leadingBytes []byte) error {
+	if declared == "" || len(leadingBytes) == 0 {
+		return nil
+	}
+	sniffed := http.DetectContentType(leadingBytes)
+	if contentTypesConflict(declared, sniffed) {
+		return errors.AddContext(ErrSkyfileContentTypeMismatch, fmt.Sprintf("declared '%v' but content looks like '%v'", declared, sniffed))
+	}
 	return nil
 }
 
+// contentTypesConflict returns whether the declared content type of a file
+// clearly contradicts the content type sniffed from its data. Only the
+// top-level media types are compared since the sniffed type is often less
+// specific than the declared one, e.g. a docx file is sniffed as a zip file.
+func contentTypesConflict(declared, sniffed string) bool {
+	declaredType, _, err := mime.ParseMediaType(declared)
+	if err != nil {
+		return false
+	}
+	sniffedType, _, err := mime.ParseMediaType(sniffed)
+	if err != nil {
+		return false
+	}
+	// A generic declared type or unknown sniffed type can't conflict.
+	if declaredType == "application/octet-stream" || sniffedType == "application/octet-stream" || declaredType == sniffedType {
+		return false
+	}
+	declaredTop := strings.Split(declaredType, "/")[0]
+	sniffedTop := strings.Split(sniffedType, "/")[0]
+
+	// Text can be declared as any textual type but not as binary media.
+	if sniffedTop == "text" {
+		return !isTextualContentType(declaredType) && declaredTop != "application"
+	}
+	// Binary data can't be declared as text.
+	if isTextualContentType(declaredType) {
+		return true
+	}
+	// Audio and video share container formats.
+	isMedia := func(top string) bool { return top == "audio" || top == "video" }
+	if isMedia(declaredTop) && (isMedia(sniffedTop) || sniffedType == "application/ogg") {
+		return false
+	}
+	// Fonts are commonly declared using legacy application types.
+	if (declaredTop == "application" && sniffedTop == "font") || (declaredTop == "font" && sniffedTop == "application") {
+		return false
+	}
+	return declaredTop != sniffedTop
+}
+
 // createFormFileHeaders builds a header from the given params. These headers
 // are used when creating the parts in a multi-part form upload.
 func createFormFileHeaders(fieldname, filename, filemode, contentType string) textproto.MIMEHeader {
@@ -348,7 +703,7 @@ func fileContentType(filename string, file io.Reader) (string, error) {
 		return contentType, nil
 	}
 	// Only the first 512 bytes are used to sniff the content type.
-	buffer := make([]byte, 512)
+	buffer := make([]byte, contentTypeSniffLen)
 	_, err := file.Read(buffer)
 	if err != nil {
 		return "", err
@@ -358,6 +713,44 @@ func fileContentType(filename string, file io.Reader) (string, error) {
 	return http.DetectContentType(buffer), nil
 }
 
+// isTextualContentType returns whether the given media type describes text.
+func isTextualContentType(mediaType string) bool {
+	switch mediaType {
+	case "application/json", "application/javascript", "application/ecmascript", "application/x-javascript", "application/xml":
+		return true
+	}
+	return strings.HasPrefix(mediaType, "text/") || strings.HasSuffix(mediaType, "+xml") || strings.HasSuffix(mediaType, "+json")
+}
+
+// validateHTTPHeaderHints ensures every header hint is on the allowlist, is
+// given in its canonical form and has a value that can safely be written into
+// a response header.
+func validateHTTPHeaderHints(headers map[string]string) error {
+	for key, value := range headers {
+		if _, allowed := SkyfileHTTPHeaderAllowlist[key]; !allowed {
+			return fmt.Errorf("header '%v' is not allowed", key)
+		}
+		if value == "" {
+			return fmt.Errorf("header '%v' has an empty value", key)
+		}
+		if strings.ContainsAny(value, "\r\n") {
+			return fmt.Errorf("header '%v' contains a line break", key)
+		}
+	}
+	return nil
+}
+
+// validateSkyfileLayoutVersion returns ErrUnsupportedSkyfileVersion if the
+// given layout version is not one of the SupportedSkyfileVersions.
+func validateSkyfileLayoutVersion(version uint8) error {
+	for _, v := range SupportedSkyfileVersions {
+		if version == v {
+			return nil
+		}
+	}
+	return errors.AddContext(ErrUnsupportedSkyfileVersion, fmt.Sprintf("found version %v but this node only supports versions %v", version, SupportedSkyfileVersions))
+}
+
 // validateDefaultPath ensures the given default path makes sense in relation to
 // the subfiles being uploaded. It returns a potentially altered default path.
 func validateDefaultPath(defaultPath string, subfiles SkyfileSubfiles) (string, error) {
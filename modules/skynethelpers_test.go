@@ -1,10 +1,17 @@
 package modules
 
 import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
 	"math"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
 
+	"gitlab.com/NebulousLabs/Sia/crypto"
 	"gitlab.com/NebulousLabs/errors"
 	"gitlab.com/NebulousLabs/fastrand"
 )
@@ -15,8 +22,19 @@ import (
 func TestSkynetHelpers(t *testing.T) {
 	t.Run("ValidateDefaultPath", testValidateDefaultPath)
 	t.Run("ValidateSkyfileMetadata", testValidateSkyfileMetadata)
+	t.Run("ValidateSkyfileMetadataBytes", testValidateSkyfileMetadataBytes)
+	t.Run("ValidateSkyfileMetadataMaxSubfiles", testValidateSkyfileMetadataMaxSubfiles)
 	t.Run("EnsurePrefix", testEnsurePrefix)
 	t.Run("EnsureSuffix", testEnsureSuffix)
+	t.Run("ValidateSkyfileVersion", testValidateSkyfileVersion)
+	t.Run("HTTPHeaderHintsRoundTrip", testHTTPHeaderHintsRoundTrip)
+	t.Run("CreatedAtRoundTrip", testCreatedAtRoundTrip)
+	t.Run("SkylinkSiaPath", testSkylinkSiaPath)
+	t.Run("ComputeSkylink", testComputeSkylink)
+	t.Run("ValidateSubfileContentType", testValidateSubfileContentType)
+	t.Run("ValidateSkyfileLayout", testValidateSkyfileLayout)
+	t.Run("ValidateSkylinkFetchSize", testValidateSkylinkFetchSize)
+	t.Run("ValidateSkyfileSubfileOffsets", testValidateSkyfileSubfileOffsets)
 }
 
 // testValidateDefaultPath ensures the functionality of 'validateDefaultPath'
@@ -134,7 +152,7 @@ func testValidateSkyfileMetadata(t *testing.T) {
 			},
 		},
 	}
-	err := ValidateSkyfileMetadata(metadata)
+	err := ValidateSkyfileMetadata(metadata, 0)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -142,7 +160,7 @@ func testValidateSkyfileMetadata(t *testing.T) {
 	// verify invalid filename
 	invalid := metadata
 	invalid.Filename = "../../" + metadata.Filename
-	err = ValidateSkyfileMetadata(invalid)
+	err = ValidateSkyfileMetadata(invalid, 0)
 	if err == nil || !strings.Contains(err.Error(), "invalid filename provided") {
 		t.Fatal("unexpected outcome")
 	}
@@ -154,7 +172,7 @@ func testValidateSkyfileMetadata(t *testing.T) {
 			Filename: "keyshouldmatchfilename",
 		},
 	}
-	err = ValidateSkyfileMetadata(invalid)
+	err = ValidateSkyfileMetadata(invalid, 0)
 	if err == nil || !strings.Contains(err.Error(), "subfile name did not match") {
 		t.Fatal("unexpected outcome")
 	}
@@ -166,7 +184,7 @@ func testValidateSkyfileMetadata(t *testing.T) {
 			Filename: "foo/../bar",
 		},
 	}
-	err = ValidateSkyfileMetadata(invalid)
+	err = ValidateSkyfileMetadata(invalid, 0)
 	if err == nil || !strings.Contains(err.Error(), "invalid filename provided for subfile") {
 		t.Fatal("unexpected outcome")
 	}
@@ -174,18 +192,300 @@ func testValidateSkyfileMetadata(t *testing.T) {
 	// verify invalid default path
 	invalid = metadata
 	invalid.DefaultPath = "foo/../bar"
-	err = ValidateSkyfileMetadata(invalid)
+	err = ValidateSkyfileMetadata(invalid, 0)
 	if !errors.Contains(err, ErrInvalidDefaultPath) {
 		t.Fatal("unexpected outcome")
 	}
 
+	// verify default path and disable default path can't be set together
 	invalid.DisableDefaultPath = true
-	err = ValidateSkyfileMetadata(invalid)
+	err = ValidateSkyfileMetadata(invalid, 0)
+	if !errors.Contains(err, ErrInvalidDefaultPath) || !strings.Contains(err.Error(), "mutually exclusive") {
+		t.Fatal("unexpected outcome", err)
+	}
+
+	// verify disable default path without a default path
+	valid := metadata
+	valid.DisableDefaultPath = true
+	err = ValidateSkyfileMetadata(valid, 0)
 	if err != nil {
-		t.Fatal("unexpected outcome")
+		t.Fatal(err)
+	}
+
+	// verify default path pointing to a subfile
+	valid = metadata
+	valid.Subfiles = SkyfileSubfiles{
+		"index.html": SkyfileSubfileMetadata{
+			Filename:    "index.html",
+			ContentType: "text/html",
+		},
+		"validkey": metadata.Subfiles["validkey"],
+	}
+	valid.DefaultPath = "index.html"
+	err = ValidateSkyfileMetadata(valid, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// verify default path pointing to a subfile that doesn't exist
+	invalid = valid
+	invalid.DefaultPath = "missing.html"
+	err = ValidateSkyfileMetadata(invalid, 0)
+	if !errors.Contains(err, ErrInvalidDefaultPath) || !strings.Contains(err.Error(), "no such path") {
+		t.Fatal("unexpected outcome", err)
+	}
+
+	// verify default path on a skyfile without subfiles
+	invalid = metadata
+	invalid.Subfiles = nil
+	invalid.DefaultPath = "index.html"
+	err = ValidateSkyfileMetadata(invalid, 0)
+	if !errors.Contains(err, ErrInvalidDefaultPath) || !strings.Contains(err.Error(), "without subfiles") {
+		t.Fatal("unexpected outcome", err)
+	}
+
+	// verify creation time in the past
+	valid = metadata
+	valid.CreatedAt = time.Now().Unix()
+	err = ValidateSkyfileMetadata(valid, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// verify creation time in the future
+	invalid = metadata
+	invalid.CreatedAt = time.Now().Add(time.Hour).Unix()
+	err = ValidateSkyfileMetadata(invalid, 0)
+	if err == nil || !strings.Contains(err.Error(), "'CreatedAt' property can't lie in the future") {
+		t.Fatal("unexpected outcome", err)
+	}
+
+	// verify allowed http header hints
+	valid = metadata
+	valid.HTTPHeaders = map[string]string{
+		"Cache-Control":    "public, max-age=3600",
+		"Content-Language": "en",
+	}
+	err = ValidateSkyfileMetadata(valid, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// verify header that is not on the allowlist
+	invalid = metadata
+	invalid.HTTPHeaders = map[string]string{"Set-Cookie": "foo=bar"}
+	err = ValidateSkyfileMetadata(invalid, 0)
+	if !errors.Contains(err, ErrInvalidHTTPHeaderHint) {
+		t.Fatal("unexpected outcome", err)
+	}
+
+	// verify non-canonical header name
+	invalid.HTTPHeaders = map[string]string{"cache-control": "no-cache"}
+	err = ValidateSkyfileMetadata(invalid, 0)
+	if !errors.Contains(err, ErrInvalidHTTPHeaderHint) {
+		t.Fatal("unexpected outcome", err)
+	}
+
+	// verify header value with a line break
+	invalid.HTTPHeaders = map[string]string{"Cache-Control": "no-cache\r\nSet-Cookie: foo=bar"}
+	err = ValidateSkyfileMetadata(invalid, 0)
+	if !errors.Contains(err, ErrInvalidHTTPHeaderHint) {
+		t.Fatal("unexpected outcome", err)
+	}
+}
+
+// testValidateSkyfileMetadataMaxSubfiles verifies that ValidateSkyfileMetadata
+// rejects metadata with more than the given maximum number of subfiles.
+func testValidateSkyfileMetadataMaxSubfiles(t *testing.T) {
+	t.Parallel()
+
+	// at the default limit the metadata is valid
+	metadata := SkyfileMetadata{
+		Filename: t.Name(),
+		Length:   uint64(DefaultSkyfileMaxSubfiles),
+		Subfiles: make(SkyfileSubfiles),
+	}
+	for i := 0; i < DefaultSkyfileMaxSubfiles; i++ {
+		filename := fmt.Sprintf("file%v", i)
+		metadata.Subfiles[filename] = SkyfileSubfileMetadata{
+			Filename: filename,
+			Offset:   uint64(i),
+			Len:      1,
+		}
+	}
+	err := ValidateSkyfileMetadata(metadata, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// just over the default limit it is rejected
+	metadata.Subfiles["toomany"] = SkyfileSubfileMetadata{
+		Filename: "toomany",
+		Offset:   uint64(DefaultSkyfileMaxSubfiles),
+		Len:      1,
+	}
+	metadata.Length++
+	err = ValidateSkyfileMetadata(metadata, 0)
+	if !errors.Contains(err, ErrTooManySubfiles) {
+		t.Fatalf("expected ErrTooManySubfiles but got '%v'", err)
+	}
+
+	// a higher limit accepts the metadata
+	numSubfiles := len(metadata.Subfiles)
+	err = ValidateSkyfileMetadata(metadata, numSubfiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a lower limit rejects it
+	err = ValidateSkyfileMetadata(metadata, numSubfiles-1)
+	if !errors.Contains(err, ErrTooManySubfiles) {
+		t.Fatalf("expected ErrTooManySubfiles but got '%v'", err)
+	}
+}
+
+// testValidateSkyfileMetadataBytes verifies the strict and non-strict
+// validation of skyfile metadata JSON.
+func testValidateSkyfileMetadataBytes(t *testing.T) {
+	t.Parallel()
+
+	known := []byte(`{"filename":"file","length":10,"mode":420}`)
+	unknown := []byte(`{"filename":"file","length":10,"mode":420,"foo":"bar","baz":1}`)
+
+	// Without an allowlist unknown fields are ignored.
+	md, err := ValidateSkyfileMetadataBytes(unknown, nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if md.Filename != "file" || md.Length != 10 || md.Mode != 420 {
+		t.Fatal("unexpected metadata", md)
+	}
+
+	// With an allowlist the unknown fields are rejected.
+	allowed := []string{"filename", "length", "mode"}
+	_, err = ValidateSkyfileMetadataBytes(unknown, allowed, 0)
+	if !errors.Contains(err, ErrUnknownSkyfileMetadataField) {
+		t.Fatal("expected unknown field error", err)
+	}
+	if !strings.Contains(err.Error(), "[baz foo]") {
+		t.Fatal("error should list the unknown fields", err)
+	}
+	md, err = ValidateSkyfileMetadataBytes(known, allowed, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if md.Filename != "file" || md.Length != 10 || md.Mode != 420 {
+		t.Fatal("unexpected metadata", md)
+	}
+
+	// Allowed fields that are known to SkyfileMetadata still need to be
+	// valid.
+	_, err = ValidateSkyfileMetadataBytes([]byte(`{"filename":"file"}`), allowed, 0)
+	if err == nil {
+		t.Fatal("expected metadata without length to be invalid")
+	}
+
+	// Invalid JSON is rejected in both modes.
+	_, err = ValidateSkyfileMetadataBytes([]byte(`{`), nil, 0)
+	if err == nil {
+		t.Fatal("expected invalid JSON to be rejected")
+	}
+	_, err = ValidateSkyfileMetadataBytes([]byte(`{`), allowed, 0)
+	if err == nil {
+		t.Fatal("expected invalid JSON to be rejected")
+	}
+}
+
+// testHTTPHeaderHintsRoundTrip verifies the http header hints set in the
+// upload parameters survive being encoded into and parsed from a base sector.
+func testHTTPHeaderHintsRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	headers := map[string]string{
+		"Cache-Control":       "public, max-age=86400",
+		"Content-Disposition": `attachment; filename="foo.txt"`,
+	}
+	sup := SkyfileUploadParameters{
+		Filename:    t.Name(),
+		Mode:        DefaultFilePerm,
+		HTTPHeaders: headers,
+	}
+	sm := roundTripSkyfileMetadata(t, sup)
+	if !reflect.DeepEqual(sm.HTTPHeaders, headers) {
+		t.Fatal("unexpected http headers", sm.HTTPHeaders)
+	}
+}
+
+// testCreatedAtRoundTrip verifies the creation time set in the upload
+// parameters survives being encoded into and parsed from a base sector.
+func testCreatedAtRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	createdAt := time.Now().Add(-time.Hour).Unix()
+	sup := SkyfileUploadParameters{
+		Filename:  t.Name(),
+		Mode:      DefaultFilePerm,
+		CreatedAt: createdAt,
+	}
+	sm := roundTripSkyfileMetadata(t, sup)
+	if sm.CreatedAt != createdAt {
+		t.Fatalf("expected %v but got %v", createdAt, sm.CreatedAt)
+	}
+
+	// Without a creation time the field is omitted from the metadata.
+	sup.CreatedAt = 0
+	sm = roundTripSkyfileMetadata(t, sup)
+	if sm.CreatedAt != 0 {
+		t.Fatal("unexpected creation time", sm.CreatedAt)
+	}
+	metadataBytes, err := SkyfileMetadataBytes(sm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(metadataBytes, []byte("createdat")) {
+		t.Fatal("creation time should be omitted", string(metadataBytes))
 	}
 }
 
+// roundTripSkyfileMetadata uploads some random data with the given upload
+// parameters through a SkyfileReader, encodes the resulting metadata into a
+// base sector and returns the metadata parsed from that base sector.
+func roundTripSkyfileMetadata(t *testing.T, sup SkyfileUploadParameters) SkyfileMetadata {
+	data := fastrand.Bytes(fastrand.Intn(100) + 1)
+	sfReader := NewSkyfileReader(bytes.NewReader(data), sup)
+	_, err := ioutil.ReadAll(sfReader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	metadata, err := sfReader.SkyfileMetadata(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ValidateSkyfileMetadata(metadata, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// build a base sector containing the metadata
+	metadataBytes, err := SkyfileMetadataBytes(metadata)
+	if err != nil {
+		t.Fatal(err)
+	}
+	layout := newTestSkyfileLayout()
+	layout.Filesize = uint64(len(data))
+	layout.MetadataSize = uint64(len(metadataBytes))
+	layout.FanoutSize = 0
+	baseSector := append(layout.Encode(), metadataBytes...)
+	baseSector = append(baseSector, data...)
+
+	// parse the base sector
+	_, _, sm, _, err := ParseSkyfileMetadata(baseSector)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sm
+}
+
 // testEnsurePrefix ensures EnsurePrefix is properly adding prefixes.
 func testEnsurePrefix(t *testing.T) {
 	t.Parallel()
@@ -232,6 +532,403 @@ func testEnsureSuffix(t *testing.T) {
 	}
 }
 
+// testSkylinkSiaPath ensures SkylinkSiaPath deterministically maps a skylink
+// to its base and extended siapaths.
+func testSkylinkSiaPath(t *testing.T) {
+	t.Parallel()
+
+	var mr crypto.Hash
+	fastrand.Read(mr[:])
+	skylink, err := NewSkylinkV1(mr, 0, 4096)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	base, extended, err := SkylinkSiaPath(skylink)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedBase, err := SkynetFolder.Join(skylink.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !base.Equals(expectedBase) {
+		t.Fatalf("unexpected base siapath, %v != %v", base, expectedBase)
+	}
+	if extended.String() != expectedBase.String()+ExtendedSuffix {
+		t.Fatalf("unexpected extended siapath %v", extended)
+	}
+
+	// The extended siapath should match the one derived from the base.
+	extended2, err := ExtendedSiaPath(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !extended.Equals(extended2) {
+		t.Fatalf("extended siapaths don't match, %v != %v", extended, extended2)
+	}
+
+	// The mapping should be deterministic.
+	base2, extended3, err := SkylinkSiaPath(skylink)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !base.Equals(base2) || !extended.Equals(extended3) {
+		t.Fatal("SkylinkSiaPath is not deterministic")
+	}
+}
+
+// testComputeSkylink tests ComputeSkylink.
+func testComputeSkylink(t *testing.T) {
+	t.Parallel()
+
+	data := fastrand.Bytes(100)
+	md := SkyfileMetadata{
+		Filename: "file",
+		Length:   uint64(len(data)),
+		Mode:     DefaultFilePerm,
+	}
+	skylink, err := ComputeSkylink(md, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The skylink should point to a base sector which contains the metadata
+	// and the data.
+	mdBytes, err := SkyfileMetadataBytes(md)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sl, baseSector, fetchSize, err := BuildSmallSkyfileBaseSector(mdBytes, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sl.Filesize != uint64(len(data)) || sl.MetadataSize != uint64(len(mdBytes)) {
+		t.Fatal("unexpected layout", sl)
+	}
+	if skylink.MerkleRoot() != crypto.MerkleRoot(baseSector) {
+		t.Fatal("skylink doesn't point to the base sector")
+	}
+	_, skylinkFetchSize, err := skylink.OffsetAndFetchSize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if skylinkFetchSize < fetchSize {
+		t.Fatal("fetch size too small", skylinkFetchSize, fetchSize)
+	}
+	_, _, parsedMD, payload, err := ParseSkyfileMetadata(baseSector)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(payload, data) || parsedMD.Filename != md.Filename {
+		t.Fatal("base sector doesn't contain the skyfile")
+	}
+
+	// The skylink should be deterministic and depend on the metadata.
+	skylink2, err := ComputeSkylink(md, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if skylink2 != skylink {
+		t.Fatal("ComputeSkylink is not deterministic")
+	}
+	md2 := md
+	md2.Filename = "file2"
+	skylink2, err = ComputeSkylink(md2, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if skylink2 == skylink {
+		t.Fatal("skylinks with different metadata should differ")
+	}
+
+	// Invalid metadata should be rejected.
+	md2.Filename = ""
+	_, err = ComputeSkylink(md2, data)
+	if err == nil {
+		t.Fatal("expected invalid metadata to be rejected")
+	}
+
+	// Data that doesn't fit within the base sector should be rejected.
+	data = fastrand.Bytes(int(SectorSize))
+	md.Length = uint64(len(data))
+	_, err = ComputeSkylink(md, data)
+	if !errors.Contains(err, ErrSkyfileTooLargeForBaseSector) {
+		t.Fatal("expected too large error", err)
+	}
+}
+
+// testValidateSkyfileVersion ensures ValidateSkyfileVersion only accepts base
+// sectors with a supported layout version.
+func testValidateSkyfileVersion(t *testing.T) {
+	t.Parallel()
+
+	// A base sector that is too small should fail.
+	err := ValidateSkyfileVersion(make([]byte, SkyfileLayoutSize-1))
+	if err == nil {
+		t.Fatal("expected error for base sector that is too small")
+	}
+
+	// The current version should be accepted.
+	layout := newTestSkyfileLayout()
+	err = ValidateSkyfileVersion(layout.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// An unknown version should be rejected with the typed error, both by
+	// ValidateSkyfileVersion and by ParseSkyfileMetadata.
+	layout.Version = SkyfileVersion + 1
+	baseSector := make([]byte, SectorSize)
+	copy(baseSector, layout.Encode())
+	err = ValidateSkyfileVersion(baseSector)
+	if !errors.Contains(err, ErrUnsupportedSkyfileVersion) {
+		t.Fatalf("expected error '%v', got '%v'", ErrUnsupportedSkyfileVersion, err)
+	}
+	_, _, _, _, err = ParseSkyfileMetadata(baseSector)
+	if !errors.Contains(err, ErrUnsupportedSkyfileVersion) {
+		t.Fatalf("expected error '%v', got '%v'", ErrUnsupportedSkyfileVersion, err)
+	}
+}
+
+// testValidateSubfileContentType verifies that ValidateSubfileContentType only
+// rejects declared content types that clearly contradict the data.
+func testValidateSubfileContentType(t *testing.T) {
+	t.Parallel()
+
+	png := append([]byte("\x89PNG\x0D\x0A\x1A\x0A"), fastrand.Bytes(100)...)
+	pdf := []byte("%PDF-1.4 some pdf")
+	webm := []byte("\x1A\x45\xDF\xA3\x01\x00\x00\x00\x00\x00\x00\x1F\x42\x86\x81\x01\x42\xF7\x81\x01\x42\xF2\x81\x04\x42\xF3\x81\x08\x42\x82\x84webm")
+	text := []byte("hello world")
+	svg := []byte(`<?xml version="1.0"?><svg xmlns="http://www.w3.org/2000/svg"></svg>`)
+
+	tests := []struct {
+		declared string
+		data     []byte
+		valid    bool
+	}{
+		// Matching declared types.
+		{"image/png", png, true},
+		{"application/pdf", pdf, true},
+		{"text/plain; charset=utf-8", text, true},
+		// Generic or empty declared types can't be contradicted.
+		{"", png, true},
+		{"application/octet-stream", png, true},
+		// Text can be declared as any textual type.
+		{"application/json", text, true},
+		{"text/css", text, true},
+		{"image/svg+xml", svg, true},
+		// Audio and video share containers.
+		{"audio/webm", webm, true},
+		// Unknown content can't be contradicted.
+		{"image/png", []byte{0, 1, 2, 3}, true},
+		// Mismatches.
+		{"text/plain", png, false},
+		{"application/json", png, false},
+		{"image/png", text, false},
+		{"video/mp4", text, false},
+		{"image/png", pdf, false},
+	}
+	for _, test := range tests {
+		err := ValidateSubfileContentType(test.declared, test.data)
+		if test.valid && err != nil {
+			t.Errorf("declared %v: unexpected error %v", test.declared, err)
+		}
+		if !test.valid && !errors.Contains(err, ErrSkyfileContentTypeMismatch) {
+			t.Errorf("declared %v: expected %v but got %v", test.declared, ErrSkyfileContentTypeMismatch, err)
+		}
+	}
+}
+
+// testValidateSkyfileLayout verifies that ValidateSkyfileLayout accepts
+// consistent layouts and rejects layouts whose filesize contradicts the
+// subfiles or the fanout.
+func testValidateSkyfileLayout(t *testing.T) {
+	t.Parallel()
+
+	// A multipart skyfile without a fanout whose subfiles add up to the
+	// filesize is valid.
+	sl := SkyfileLayout{
+		Version:    SkyfileVersion,
+		Filesize:   300,
+		CipherType: crypto.TypePlain,
+	}
+	sm := SkyfileMetadata{
+		Filename: "dir",
+		Subfiles: SkyfileSubfiles{
+			"a": SkyfileSubfileMetadata{Filename: "a", Offset: 0, Len: 100},
+			"b": SkyfileSubfileMetadata{Filename: "b", Offset: 100, Len: 200},
+		},
+	}
+	err := ValidateSkyfileLayout(sl, nil, sm)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Subfile lengths that don't add up to the filesize are invalid.
+	sl.Filesize = 301
+	err = ValidateSkyfileLayout(sl, nil, sm)
+	if !errors.Contains(err, ErrSkyfileLayoutInconsistent) {
+		t.Fatalf("expected error '%v', got '%v'", ErrSkyfileLayoutInconsistent, err)
+	}
+
+	// A subfile that exceeds the filesize is invalid.
+	sl.Filesize = 300
+	sm.Subfiles["b"] = SkyfileSubfileMetadata{Filename: "b", Offset: 101, Len: 200}
+	err = ValidateSkyfileLayout(sl, nil, sm)
+	if !errors.Contains(err, ErrSkyfileLayoutInconsistent) {
+		t.Fatalf("expected error '%v', got '%v'", ErrSkyfileLayoutInconsistent, err)
+	}
+
+	// A subfile that overflows the filesize is invalid.
+	sm.Subfiles["b"] = SkyfileSubfileMetadata{Filename: "b", Offset: math.MaxUint64, Len: 200}
+	err = ValidateSkyfileLayout(sl, nil, sm)
+	if !errors.Contains(err, ErrSkyfileLayoutInconsistent) {
+		t.Fatalf("expected error '%v', got '%v'", ErrSkyfileLayoutInconsistent, err)
+	}
+
+	// A fanout with 1-of-N plain erasure coding stores a single root per
+	// chunk. A filesize of 2.5 chunks requires 3 of them.
+	sl = newTestSkyfileLayout()
+	sl.Filesize = 2*SectorSize + SectorSize/2
+	fanout := make([]byte, 3*crypto.HashSize)
+	err = ValidateSkyfileLayout(sl, fanout, SkyfileMetadata{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Too few and too many chunks are invalid.
+	for _, numChunks := range []int{2, 4} {
+		fanout = make([]byte, numChunks*crypto.HashSize)
+		err = ValidateSkyfileLayout(sl, fanout, SkyfileMetadata{})
+		if !errors.Contains(err, ErrSkyfileLayoutInconsistent) {
+			t.Fatalf("%v chunks: expected error '%v', got '%v'", numChunks, ErrSkyfileLayoutInconsistent, err)
+		}
+	}
+
+	// With more data pieces, every piece of a chunk is enumerated and each
+	// chunk holds more data.
+	sl.FanoutDataPieces = 2
+	sl.FanoutParityPieces = 3
+	sl.Filesize = 4 * SectorSize
+	fanout = make([]byte, 2*5*crypto.HashSize)
+	err = ValidateSkyfileLayout(sl, fanout, SkyfileMetadata{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sl.Filesize++
+	err = ValidateSkyfileLayout(sl, fanout, SkyfileMetadata{})
+	if !errors.Contains(err, ErrSkyfileLayoutInconsistent) {
+		t.Fatalf("expected error '%v', got '%v'", ErrSkyfileLayoutInconsistent, err)
+	}
+
+	// A fanout without data pieces is invalid.
+	sl.FanoutDataPieces = 0
+	err = ValidateSkyfileLayout(sl, fanout, SkyfileMetadata{})
+	if !errors.Contains(err, ErrSkyfileLayoutInconsistent) {
+		t.Fatalf("expected error '%v', got '%v'", ErrSkyfileLayoutInconsistent, err)
+	}
+
+	// A small skyfile that claims to be larger than its base sector can't be
+	// parsed.
+	smBytes := []byte(`{"filename":"file"}`)
+	sl = SkyfileLayout{
+		Version:      SkyfileVersion,
+		Filesize:     SectorSize,
+		MetadataSize: uint64(len(smBytes)),
+		CipherType:   crypto.TypePlain,
+	}
+	baseSector := make([]byte, SectorSize)
+	copy(baseSector, sl.Encode())
+	copy(baseSector[SkyfileLayoutSize:], smBytes)
+	_, _, _, _, err = ParseSkyfileMetadata(baseSector)
+	if !errors.Contains(err, ErrSkyfileLayoutInconsistent) {
+		t.Fatalf("expected error '%v', got '%v'", ErrSkyfileLayoutInconsistent, err)
+	}
+}
+
+// testValidateSkylinkFetchSize verifies that ValidateSkylinkFetchSize only
+// accepts skylinks whose fetch size matches the base sector described by the
+// layout.
+func testValidateSkylinkFetchSize(t *testing.T) {
+	t.Parallel()
+
+	// The skylink of a small skyfile is valid.
+	data := fastrand.Bytes(100)
+	smBytes := []byte(`{"filename":"file"}`)
+	sl, baseSector, fetchSize, err := BuildSmallSkyfileBaseSector(smBytes, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := crypto.MerkleRoot(baseSector)
+	skylink, err := NewSkylinkV1(root, 0, fetchSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ValidateSkylinkFetchSize(skylink, sl)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// So is a skylink with a fetch size that rounds to the same value or
+	// points at an offset.
+	for _, offset := range []uint64{0, 4096} {
+		skylink, err = NewSkylinkV1(root, offset, 4096)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ValidateSkylinkFetchSize(skylink, sl)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A skylink whose fetch size is larger or smaller than the base sector
+	// is invalid.
+	sl.Filesize = 8000
+	err = ValidateSkylinkFetchSize(skylink, sl)
+	if !errors.Contains(err, ErrSkylinkFetchSizeMismatch) {
+		t.Fatalf("expected error '%v', got '%v'", ErrSkylinkFetchSizeMismatch, err)
+	}
+	sl.Filesize = 100
+	skylink, err = NewSkylinkV1(root, 0, SkylinkMaxFetchSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ValidateSkylinkFetchSize(skylink, sl)
+	if !errors.Contains(err, ErrSkylinkFetchSizeMismatch) {
+		t.Fatalf("expected error '%v', got '%v'", ErrSkylinkFetchSizeMismatch, err)
+	}
+
+	// The filesize of a skyfile with a fanout doesn't count towards the
+	// base sector.
+	sl = newTestSkyfileLayout()
+	sl.Filesize = 10 * SectorSize
+	sl.FanoutSize = 10 * crypto.HashSize
+	sl.MetadataSize = uint64(len(smBytes))
+	skylink, err = NewSkylinkV1(root, 0, SkyfileLayoutSize+sl.FanoutSize+sl.MetadataSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ValidateSkylinkFetchSize(skylink, sl)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Sizes that exceed a sector are invalid and don't overflow.
+	sl.FanoutSize = math.MaxUint64 - SkyfileLayoutSize
+	err = ValidateSkylinkFetchSize(skylink, sl)
+	if !errors.Contains(err, ErrSkylinkFetchSizeMismatch) {
+		t.Fatalf("expected error '%v', got '%v'", ErrSkylinkFetchSizeMismatch, err)
+	}
+	sl.FanoutSize = 0
+	sl.Filesize = SectorSize
+	err = ValidateSkylinkFetchSize(skylink, sl)
+	if !errors.Contains(err, ErrSkylinkFetchSizeMismatch) {
+		t.Fatalf("expected error '%v', got '%v'", ErrSkylinkFetchSizeMismatch, err)
+	}
+}
+
 // TestParseSkyfileMetadata checks that the skyfile metadata parser correctly
 // catches malformed skyfile layout data.
 //
@@ -273,3 +970,45 @@ func TestParseSkyfileMetadata(t *testing.T) {
 		}
 	}
 }
+
+// testValidateSkyfileSubfileOffsets tests ValidateSkyfileSubfileOffsets.
+func testValidateSkyfileSubfileOffsets(t *testing.T) {
+	t.Parallel()
+
+	subfile := func(name string, offset, length uint64) SkyfileSubfileMetadata {
+		return SkyfileSubfileMetadata{Filename: name, Offset: offset, Len: length}
+	}
+	subfiles := func(sfs ...SkyfileSubfileMetadata) SkyfileSubfiles {
+		m := make(SkyfileSubfiles)
+		for _, sf := range sfs {
+			m[sf.Filename] = sf
+		}
+		return m
+	}
+
+	tests := []struct {
+		name     string
+		subfiles SkyfileSubfiles
+		filesize uint64
+		err      string
+	}{
+		{"NoSubfiles", nil, 10, ""},
+		{"Contiguous", subfiles(subfile("b", 4, 6), subfile("a", 0, 4)), 10, ""},
+		{"EmptySubfile", subfiles(subfile("a", 0, 4), subfile("b", 4, 0), subfile("c", 4, 6)), 10, ""},
+		{"EmptySubfileSortedAfter", subfiles(subfile("zempty.txt", 0, 0), subfile("a.txt", 0, 10)), 10, ""},
+		{"GapAtStart", subfiles(subfile("a", 1, 9)), 10, "gap between offset 0 and subfile 'a' at offset 1"},
+		{"Gap", subfiles(subfile("a", 0, 4), subfile("b", 5, 5)), 10, "gap between offset 4 and subfile 'b' at offset 5"},
+		{"Overlap", subfiles(subfile("a", 0, 5), subfile("b", 4, 6)), 10, "subfile 'b' at offset 4 overlaps the previous subfile ending at offset 5"},
+		{"TooLarge", subfiles(subfile("a", 0, 4), subfile("b", 4, 7)), 10, "subfile 'b' at offset 4 with length 7 exceeds the filesize 10"},
+		{"TooSmall", subfiles(subfile("a", 0, 4), subfile("b", 4, 5)), 10, "subfiles end at offset 9 but the filesize is 10"},
+	}
+	for _, test := range tests {
+		err := ValidateSkyfileSubfileOffsets(test.subfiles, test.filesize)
+		if test.err == "" && err != nil {
+			t.Fatal(test.name, err)
+		}
+		if test.err != "" && (!errors.Contains(err, ErrSkyfileSubfilesNotContiguous) || !strings.Contains(err.Error(), test.err)) {
+			t.Fatalf("%v: expected error containing '%v' but got %v", test.name, test.err, err)
+		}
+	}
+}
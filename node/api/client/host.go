@@ -61,6 +61,32 @@ const (
 	// HostParamMaxEphemeralAccountRisk is the maximum ephemeral account risk in
 	// hastings
 	HostParamMaxEphemeralAccountRisk = HostParam("maxephemeralaccountrisk")
+	// HostParamMaxEphemeralAccountSpending is the maximum amount in hastings
+	// that can be withdrawn from an ephemeral account within one spending
+	// window.
+	HostParamMaxEphemeralAccountSpending = HostParam("maxephemeralaccountspending")
+	// HostParamEphemeralAccountSpendingWindow is the duration of the window
+	// after which the spending of an ephemeral account is reset.
+	HostParamEphemeralAccountSpendingWindow = HostParam("ephemeralaccountspendingwindow")
+	// HostParamProgramDataTimeout is the maximum amount of time in seconds an
+	// MDM program waits for the next packet of its program data.
+	HostParamProgramDataTimeout = HostParam("programdatatimeout")
+	// HostParamMaxGainedSectorsMemory is the maximum amount of data in bytes
+	// an MDM program keeps in memory for the sectors it appends.
+	HostParamMaxGainedSectorsMemory = HostParam("maxgainedsectorsmemory")
+	// HostParamVerifySectorReads indicates whether MDM programs verify the
+	// merkle root of the sectors they read from disk.
+	HostParamVerifySectorReads = HostParam("verifysectorreads")
+	// HostParamMaxQueuedContractPayments is the maximum number of payments
+	// that can be waiting on the lock of a single storage obligation.
+	HostParamMaxQueuedContractPayments = HostParam("maxqueuedcontractpayments")
+	// HostParamPayByContractExpiryThreshold is the minimum number of blocks
+	// that need to remain before the proof window of a contract starts for
+	// the host to accept payments from it.
+	HostParamPayByContractExpiryThreshold = HostParam("paybycontractexpirythreshold")
+	// HostParamMaxPayByContractCollateral is the maximum amount of collateral
+	// in hastings a single payment by contract is allowed to move.
+	HostParamMaxPayByContractCollateral = HostParam("maxpaybycontractcollateral")
 	// HostParamRegistrySize is the preallocated size of the host's registry on
 	// disk.
 	HostParamRegistrySize = HostParam("registrysize")
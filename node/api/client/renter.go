@@ -533,6 +533,55 @@ func (c *Client) RenterSetCheckIPViolationPost(enabled bool) (err error) {
 	return
 }
 
+// RenterSetDefaultSkyfileContentTypePost uses the /renter endpoint to set the
+// content type reported for downloaded subfiles without one. An empty content
+// type resets the default.
+func (c *Client) RenterSetDefaultSkyfileContentTypePost(contentType string) (err error) {
+	values := url.Values{}
+	values.Set("defaultskyfilecontenttype", contentType)
+	err = c.post("/renter", values.Encode(), nil)
+	return
+}
+
+// RenterSetSkyfileIdempotencyKeyExpiryPost uses the /renter endpoint to set
+// the amount of time the skylinks of uploads with an idempotency key are
+// remembered. The expiry is rounded down to seconds and 0 resets the default.
+func (c *Client) RenterSetSkyfileIdempotencyKeyExpiryPost(expiry time.Duration) (err error) {
+	values := url.Values{}
+	values.Set("skyfileidempotencykeyexpiry", fmt.Sprint(uint64(expiry.Seconds())))
+	err = c.post("/renter", values.Encode(), nil)
+	return
+}
+
+// RenterSetSkyfileMaxSubfilesPost uses the /renter endpoint to set the
+// maximum number of subfiles of uploaded skyfiles. 0 resets the default.
+func (c *Client) RenterSetSkyfileMaxSubfilesPost(maxSubfiles int) (err error) {
+	values := url.Values{}
+	values.Set("skyfilemaxsubfiles", fmt.Sprint(maxSubfiles))
+	err = c.post("/renter", values.Encode(), nil)
+	return
+}
+
+// RenterSetSkyfileMetadataAllowedFieldsPost uses the /renter endpoint to set
+// the top level fields the metadata of skyfiles may contain. No fields allow
+// any field.
+func (c *Client) RenterSetSkyfileMetadataAllowedFieldsPost(fields []string) (err error) {
+	values := url.Values{}
+	values.Set("skyfilemetadataallowedfields", strings.Join(fields, ","))
+	err = c.post("/renter", values.Encode(), nil)
+	return
+}
+
+// RenterSetMaxSkylinkDownloadSpeedPost uses the /renter endpoint to set the
+// aggregate rate limit in bytes per second of all skylink downloads. 0 removes
+// the limit.
+func (c *Client) RenterSetMaxSkylinkDownloadSpeedPost(readBPS int64) (err error) {
+	values := url.Values{}
+	values.Set("maxskylinkdownloadspeed", fmt.Sprint(readBPS))
+	err = c.post("/renter", values.Encode(), nil)
+	return
+}
+
 // RenterStreamGet uses the /renter/stream endpoint to download data as a
 // stream.
 func (c *Client) RenterStreamGet(siaPath modules.SiaPath, disableLocalFetch, root bool) (resp []byte, err error) {
@@ -69,6 +69,36 @@ func (uc *UnsafeClient) SkynetSkyfilePostRawResponse(params modules.SkyfileUploa
 	rootStr := fmt.Sprintf("%t", params.Root)
 	values.Set("root", rootStr)
 
+	// Encode the creation time.
+	if params.CreatedAt != 0 {
+		values.Set("createdat", strconv.FormatInt(params.CreatedAt, 10))
+	}
+
+	// Encode the http header hints.
+	if len(params.HTTPHeaders) > 0 {
+		httpHeaders, err := json.Marshal(params.HTTPHeaders)
+		if err != nil {
+			return nil, nil, errors.AddContext(err, "unable to marshal http headers")
+		}
+		values.Set("httpheaders", string(httpHeaders))
+	}
+
+	// Encode the idempotency key.
+	if params.IdempotencyKey != "" {
+		values.Set("idempotencykey", params.IdempotencyKey)
+	}
+
+	// Encode the TTL.
+	if params.TTL > 0 {
+		values.Set("ttl", fmt.Sprint(uint64(params.TTL.Seconds())))
+	}
+
+	// Encode the fanout erasure coding overrides.
+	if params.FanoutDataPieces != 0 || params.FanoutParityPieces != 0 {
+		values.Set("fanoutdatapieces", fmt.Sprint(params.FanoutDataPieces))
+		values.Set("fanoutparitypieces", fmt.Sprint(params.FanoutParityPieces))
+	}
+
 	// Encode SkykeyName or SkykeyID.
 	if params.SkykeyName != "" {
 		values.Set("skykeyname", params.SkykeyName)
@@ -119,6 +149,36 @@ func (c *Client) SkynetSkylinkGetWithTimeout(skylink string, timeout int) ([]byt
 	return c.skynetSkylinkGetWithParameters(skylink, params)
 }
 
+// SkynetSkylinkGetWithReadAhead uses the /skynet/skylink endpoint to download
+// a skylink file, specifying the amount of data to fetch ahead of the current
+// read position.
+func (c *Client) SkynetSkylinkGetWithReadAhead(skylink string, readAhead uint64) ([]byte, modules.SkyfileMetadata, error) {
+	params := map[string]string{
+		"readahead": fmt.Sprint(readAhead),
+	}
+	return c.skynetSkylinkGetWithParameters(skylink, params)
+}
+
+// SkynetSkylinkGetWithPreflight uses the /skynet/skylink endpoint to download
+// a skylink file after verifying that enough pieces of the first fanout chunk,
+// and a sampled other chunk if sampleChunk is set, are reachable.
+func (c *Client) SkynetSkylinkGetWithPreflight(skylink string, sampleChunk bool) ([]byte, modules.SkyfileMetadata, error) {
+	params := map[string]string{
+		"preflight":        "true",
+		"preflight-sample": fmt.Sprintf("%t", sampleChunk),
+	}
+	return c.skynetSkylinkGetWithParameters(skylink, params)
+}
+
+// SkynetSkylinkGetWithRateLimit uses the /skynet/skylink endpoint to download
+// a skylink file with at most maxDownloadSpeed bytes per second.
+func (c *Client) SkynetSkylinkGetWithRateLimit(skylink string, maxDownloadSpeed int64) ([]byte, modules.SkyfileMetadata, error) {
+	params := map[string]string{
+		"maxdownloadspeed": fmt.Sprint(maxDownloadSpeed),
+	}
+	return c.skynetSkylinkGetWithParameters(skylink, params)
+}
+
 // SkynetSkylinkGetWithLayout uses the /skynet/skylink endpoint to download
 // a skylink file, specifying the given value for the 'include-layout'
 // parameter.
@@ -402,6 +462,27 @@ func (c *Client) SkynetSkylinkRestorePost(backup io.Reader) (string, error) {
 	return srp.Skylink, nil
 }
 
+// SkynetSkylinkMigratePost uses the /skynet/migrate endpoint to migrate the
+// converted TypeThreefish skyfile at the given skylink to the cipher type of
+// regular skyfile uploads. The migrated skyfile is uploaded to the given
+// siapath and its skylink is returned.
+func (c *Client) SkynetSkylinkMigratePost(skylink string, siaPath modules.SiaPath, root bool) (string, error) {
+	values := url.Values{}
+	values.Set("siapath", siaPath.String())
+	values.Set("root", fmt.Sprintf("%t", root))
+	query := fmt.Sprintf("/skynet/migrate/%s?%s", skylink, values.Encode())
+	_, resp, err := c.postRawResponse(query, nil)
+	if err != nil {
+		return "", errors.AddContext(err, "post call to "+query+" failed")
+	}
+	var smp api.SkynetMigratePOST
+	err = json.Unmarshal(resp, &smp)
+	if err != nil {
+		return "", errors.AddContext(err, "unable to unmarshal response")
+	}
+	return smp.Skylink, nil
+}
+
 // SkynetSkylinkReaderGet uses the /skynet/skylink endpoint to fetch a reader of
 // the file data.
 func (c *Client) SkynetSkylinkReaderGet(skylink string) (io.ReadCloser, error) {
@@ -464,6 +545,20 @@ func (c *Client) SkynetSkylinkPinPostWithTimeout(skylink string, params modules.
 	values.Set("root", rootStr)
 	values.Set("siapath", params.SiaPath.String())
 	values.Set("timeout", fmt.Sprintf("%d", timeout))
+	values.Set("pinencryptedwithoutkey", fmt.Sprintf("%t", params.PinEncryptedWithoutKey))
+	values.Set("lowpriority", fmt.Sprintf("%t", params.LowPriority))
+	if params.MaxConcurrentChunks > 0 {
+		values.Set("maxconcurrentchunks", fmt.Sprintf("%d", params.MaxConcurrentChunks))
+	}
+	if params.BaseSectorTimeout > 0 {
+		values.Set("basesectortimeout", fmt.Sprintf("%d", params.BaseSectorTimeout))
+	}
+	if params.BaseSectorOnly {
+		values.Set("basesectoronly", fmt.Sprintf("%t", params.BaseSectorOnly))
+	}
+	if params.KeepBaseSectorOnCancel {
+		values.Set("keepbasesectoroncancel", fmt.Sprintf("%t", params.KeepBaseSectorOnCancel))
+	}
 
 	query := fmt.Sprintf("/skynet/pin/%s?%s", skylink, values.Encode())
 	_, _, err := c.postRawResponse(query, nil)
@@ -490,6 +585,36 @@ func (c *Client) SkynetSkyfilePost(params modules.SkyfileUploadParameters) (stri
 	rootStr := fmt.Sprintf("%t", params.Root)
 	values.Set("root", rootStr)
 
+	// Encode the creation time.
+	if params.CreatedAt != 0 {
+		values.Set("createdat", strconv.FormatInt(params.CreatedAt, 10))
+	}
+
+	// Encode the http header hints.
+	if len(params.HTTPHeaders) > 0 {
+		httpHeaders, err := json.Marshal(params.HTTPHeaders)
+		if err != nil {
+			return "", api.SkynetSkyfileHandlerPOST{}, errors.AddContext(err, "unable to marshal http headers")
+		}
+		values.Set("httpheaders", string(httpHeaders))
+	}
+
+	// Encode the idempotency key.
+	if params.IdempotencyKey != "" {
+		values.Set("idempotencykey", params.IdempotencyKey)
+	}
+
+	// Encode the TTL.
+	if params.TTL > 0 {
+		values.Set("ttl", fmt.Sprint(uint64(params.TTL.Seconds())))
+	}
+
+	// Encode the fanout erasure coding overrides.
+	if params.FanoutDataPieces != 0 || params.FanoutParityPieces != 0 {
+		values.Set("fanoutdatapieces", fmt.Sprint(params.FanoutDataPieces))
+		values.Set("fanoutparitypieces", fmt.Sprint(params.FanoutParityPieces))
+	}
+
 	// Encode SkykeyName or SkykeyID.
 	if params.SkykeyName != "" {
 		values.Set("skykeyname", params.SkykeyName)
@@ -579,6 +704,9 @@ func (c *Client) SkynetSkyfileMultiPartEncryptedPost(params modules.SkyfileMulti
 	if skykeyID != (skykey.SkykeyID{}) {
 		values.Set("skykeyid", skykeyID.ToString())
 	}
+	if params.VerifyContentTypes {
+		values.Set("verifycontenttypes", "true")
+	}
 
 	// Make the call to upload the file.
 	query := fmt.Sprintf("/skynet/skyfile/%s?%s", params.SiaPath.String(), values.Encode())
@@ -641,6 +769,16 @@ func (c *Client) SkynetBlocklistGet() (blocklist api.SkynetBlocklistGET, err err
 	return
 }
 
+// SkynetPinnedGet requests the /skynet/pinned Get endpoint, returning up to
+// limit pinned skylinks starting at the given offset.
+func (c *Client) SkynetPinnedGet(offset, limit uint64) (spg api.SkynetPinnedGET, err error) {
+	values := url.Values{}
+	values.Set("offset", fmt.Sprint(offset))
+	values.Set("limit", fmt.Sprint(limit))
+	err = c.get("/skynet/pinned?"+values.Encode(), &spg)
+	return
+}
+
 // SkynetBlocklistHashPost requests the /skynet/blocklist Post endpoint
 func (c *Client) SkynetBlocklistHashPost(additions, removals []string, isHash bool) (err error) {
 	sbp := api.SkynetBlocklistPOST{
@@ -682,6 +820,22 @@ func (c *Client) SkynetPortalsPost(additions []modules.SkynetPortal, removals []
 	return
 }
 
+// SkynetPortalsPartialPost requests the /skynet/portals Post endpoint with
+// partial updates enabled.
+func (c *Client) SkynetPortalsPartialPost(additions []modules.SkynetPortal, removals []modules.NetAddress) (result modules.SkynetPortalsUpdateResult, err error) {
+	spp := api.SkynetPortalsPOST{
+		Add:     additions,
+		Remove:  removals,
+		Partial: true,
+	}
+	data, err := json.Marshal(spp)
+	if err != nil {
+		return modules.SkynetPortalsUpdateResult{}, err
+	}
+	err = c.post("/skynet/portals", string(data), &result)
+	return
+}
+
 // SkynetStatsGet requests the /skynet/stats Get endpoint
 func (c *Client) SkynetStatsGet() (stats api.SkynetStatsGET, err error) {
 	err = c.get("/skynet/stats", &stats)
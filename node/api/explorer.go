@@ -59,6 +59,16 @@ type (
 		Block ExplorerBlock `json:"block"`
 	}
 
+	// ExplorerFoundationSubsidyGET is the object returned by a GET request to
+	// /explorer/foundationsubsidy. It describes the Foundation subsidy
+	// schedule as seen from the requested height.
+	ExplorerFoundationSubsidyGET struct {
+		Height            types.BlockHeight `json:"height"`
+		NextSubsidyHeight types.BlockHeight `json:"nextsubsidyheight"`
+		NextSubsidy       types.Currency    `json:"nextsubsidy"`
+		TotalSubsidy      types.Currency    `json:"totalsubsidy"`
+	}
+
 	// ExplorerHashGET is the object returned as a response to a GET request to
 	// /explorer/hash. The HashType will indicate whether the hash corresponds
 	// to a block id, a transaction id, a siacoin output id, a file contract
@@ -218,6 +228,26 @@ func (api *API) explorerBlocksHandler(w http.ResponseWriter, _ *http.Request, ps
 	})
 }
 
+// explorerFoundationSubsidyHandler handles API calls to
+// /explorer/foundationsubsidy/:height.
+func (api *API) explorerFoundationSubsidyHandler(w http.ResponseWriter, _ *http.Request, ps httprouter.Params) {
+	// Parse the height that's being requested.
+	var height types.BlockHeight
+	_, err := fmt.Sscan(ps.ByName("height"), &height)
+	if err != nil {
+		WriteError(w, Error{err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	nextHeight, nextSubsidy := types.NextFoundationSubsidy(height)
+	WriteJSON(w, ExplorerFoundationSubsidyGET{
+		Height:            height,
+		NextSubsidyHeight: nextHeight,
+		NextSubsidy:       nextSubsidy,
+		TotalSubsidy:      types.FoundationSubsidyTotal(height),
+	})
+}
+
 // buildTransactionSet returns the blocks and transactions that are associated
 // with a set of transaction ids.
 func (api *API) buildTransactionSet(txids []types.TransactionID) (txns []ExplorerTransaction, blocks []ExplorerBlock) {
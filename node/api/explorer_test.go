@@ -1,6 +1,7 @@
 package api
 
 import (
+	"fmt"
 	"testing"
 
 	"gitlab.com/NebulousLabs/Sia/types"
@@ -81,3 +82,51 @@ func TestIntegrationExplorerHashGet(t *testing.T) {
 		t.Error("wrong block type returned")
 	}
 }
+
+// TestIntegrationExplorerFoundationSubsidyGET probes the GET call to
+// /explorer/foundationsubsidy/:height.
+func TestIntegrationExplorerFoundationSubsidyGET(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	st, err := createExplorerServerTester(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.server.panicClose()
+
+	// Before the hardfork the next subsidy is the initial subsidy.
+	var efsg ExplorerFoundationSubsidyGET
+	err = st.getAPI("/explorer/foundationsubsidy/0", &efsg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if efsg.NextSubsidyHeight != types.FoundationHardforkHeight {
+		t.Error("wrong next subsidy height", efsg.NextSubsidyHeight)
+	}
+	if !efsg.NextSubsidy.Equals(types.InitialFoundationSubsidy) {
+		t.Error("wrong next subsidy", efsg.NextSubsidy)
+	}
+	if !efsg.TotalSubsidy.IsZero() {
+		t.Error("expected no subsidy before the hardfork", efsg.TotalSubsidy)
+	}
+
+	// At the hardfork the initial subsidy was paid.
+	height := types.FoundationHardforkHeight
+	err = st.getAPI(fmt.Sprintf("/explorer/foundationsubsidy/%v", height), &efsg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if efsg.NextSubsidyHeight != height+types.FoundationSubsidyFrequency {
+		t.Error("wrong next subsidy height", efsg.NextSubsidyHeight)
+	}
+	if !efsg.TotalSubsidy.Equals(types.InitialFoundationSubsidy) {
+		t.Error("wrong total subsidy", efsg.TotalSubsidy)
+	}
+
+	// An invalid height is rejected.
+	err = st.getAPI("/explorer/foundationsubsidy/abc", &efsg)
+	if err == nil {
+		t.Error("expected invalid height to be rejected")
+	}
+}
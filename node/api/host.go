@@ -285,6 +285,70 @@ func (api *API) parseHostSettings(req *http.Request) (modules.HostInternalSettin
 		}
 		settings.MaxEphemeralAccountRisk = x
 	}
+	if req.FormValue("maxephemeralaccountspending") != "" {
+		var x types.Currency
+		_, err := fmt.Sscan(req.FormValue("maxephemeralaccountspending"), &x)
+		if err != nil {
+			return modules.HostInternalSettings{}, err
+		}
+		settings.MaxEphemeralAccountSpending = x
+	}
+	if req.FormValue("ephemeralaccountspendingwindow") != "" {
+		var x uint64
+		_, err := fmt.Sscan(req.FormValue("ephemeralaccountspendingwindow"), &x)
+		if err != nil {
+			return modules.HostInternalSettings{}, err
+		}
+		settings.EphemeralAccountSpendingWindow = time.Duration(x) * time.Second
+	}
+	if req.FormValue("programdatatimeout") != "" {
+		var x uint64
+		_, err := fmt.Sscan(req.FormValue("programdatatimeout"), &x)
+		if err != nil {
+			return modules.HostInternalSettings{}, err
+		}
+		settings.ProgramDataTimeout = time.Duration(x) * time.Second
+	}
+	if req.FormValue("maxgainedsectorsmemory") != "" {
+		var x uint64
+		_, err := fmt.Sscan(req.FormValue("maxgainedsectorsmemory"), &x)
+		if err != nil {
+			return modules.HostInternalSettings{}, err
+		}
+		settings.MaxGainedSectorsMemory = x
+	}
+	if req.FormValue("verifysectorreads") != "" {
+		var x bool
+		_, err := fmt.Sscan(req.FormValue("verifysectorreads"), &x)
+		if err != nil {
+			return modules.HostInternalSettings{}, err
+		}
+		settings.VerifySectorReads = x
+	}
+	if req.FormValue("maxqueuedcontractpayments") != "" {
+		var x uint64
+		_, err := fmt.Sscan(req.FormValue("maxqueuedcontractpayments"), &x)
+		if err != nil {
+			return modules.HostInternalSettings{}, err
+		}
+		settings.MaxQueuedContractPayments = x
+	}
+	if req.FormValue("paybycontractexpirythreshold") != "" {
+		var x types.BlockHeight
+		_, err := fmt.Sscan(req.FormValue("paybycontractexpirythreshold"), &x)
+		if err != nil {
+			return modules.HostInternalSettings{}, err
+		}
+		settings.PayByContractExpiryThreshold = x
+	}
+	if req.FormValue("maxpaybycontractcollateral") != "" {
+		var x types.Currency
+		_, err := fmt.Sscan(req.FormValue("maxpaybycontractcollateral"), &x)
+		if err != nil {
+			return modules.HostInternalSettings{}, err
+		}
+		settings.MaxPayByContractCollateral = x
+	}
 	if req.FormValue("registrysize") != "" {
 		var x uint64
 		_, err := fmt.Sscan(req.FormValue("registrysize"), &x)
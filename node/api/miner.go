@@ -1,12 +1,24 @@
 package api
 
 import (
+	"fmt"
 	"net/http"
 
 	"github.com/julienschmidt/httprouter"
 
 	"gitlab.com/NebulousLabs/Sia/types"
 	"gitlab.com/NebulousLabs/encoding"
+	"gitlab.com/NebulousLabs/errors"
+)
+
+var (
+	// minerBlockSizeLimit is the maximum size of a block submitted to the
+	// miner. It matches the consensus limit to allow for max-size blocks.
+	minerBlockSizeLimit = types.BlockSizeLimit
+
+	// minerHeaderSizeLimit is the maximum size of a header submitted to the
+	// miner. Headers have a fixed size.
+	minerHeaderSizeLimit = uint64(len(encoding.Marshal(types.BlockHeader{})))
 )
 
 type (
@@ -20,6 +32,18 @@ type (
 	}
 )
 
+// decodeMinerObject decodes an object submitted to the miner from the body of
+// the request. Bodies larger than maxSize are rejected before being read in
+// full and the decoder is limited to allocating a multiple of maxSize.
+func decodeMinerObject(w http.ResponseWriter, req *http.Request, obj interface{}, maxSize uint64) error {
+	body := http.MaxBytesReader(w, req.Body, int64(maxSize))
+	err := encoding.NewDecoder(body, 3*int(maxSize)).Decode(obj)
+	if err != nil {
+		return errors.AddContext(err, fmt.Sprintf("failed to decode object with a size limit of %v bytes", maxSize))
+	}
+	return nil
+}
+
 // minerHandler handles the API call that queries the miner's status.
 func (api *API) minerHandler(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
 	blocksMined, staleMined := api.miner.BlocksMined()
@@ -59,7 +83,7 @@ func (api *API) minerHeaderHandlerGET(w http.ResponseWriter, _ *http.Request, _
 // miner.
 func (api *API) minerHeaderHandlerPOST(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
 	var bh types.BlockHeader
-	err := encoding.NewDecoder(req.Body, encoding.DefaultAllocLimit).Decode(&bh)
+	err := decodeMinerObject(w, req, &bh, minerHeaderSizeLimit)
 	if err != nil {
 		WriteError(w, Error{err.Error()}, http.StatusBadRequest)
 		return
@@ -86,7 +110,7 @@ func (api *API) minerBlockHandlerGET(w http.ResponseWriter, _ *http.Request, _ h
 // miner.
 func (api *API) minerBlockHandlerPOST(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
 	var b types.Block
-	err := encoding.NewDecoder(req.Body, encoding.DefaultAllocLimit).Decode(&b)
+	err := decodeMinerObject(w, req, &b, minerBlockSizeLimit)
 	if err != nil {
 		WriteError(w, Error{err.Error()}, http.StatusBadRequest)
 		return
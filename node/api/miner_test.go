@@ -1,13 +1,18 @@
 package api
 
 import (
+	"bytes"
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 	"unsafe"
 
 	"gitlab.com/NebulousLabs/Sia/crypto"
 	"gitlab.com/NebulousLabs/Sia/types"
+	"gitlab.com/NebulousLabs/encoding"
 )
 
 // TestMinerGET checks the GET call to the /miner endpoint.
@@ -159,3 +164,48 @@ func TestMinerHeader(t *testing.T) {
 		t.Errorf("block height did not increase after trying to mine a block through the api, started at %v and ended at %v", startingHeight, st.cs.Height())
 	}
 }
+
+// TestDecodeMinerObject tests that blocks and headers submitted to the miner
+// are decoded as long as they don't exceed their size limit.
+func TestDecodeMinerObject(t *testing.T) {
+	t.Parallel()
+
+	// newRequest creates a request with the encoded object as its body.
+	newRequest := func(obj interface{}) *http.Request {
+		return httptest.NewRequest(http.MethodPost, "/miner/block", bytes.NewReader(encoding.Marshal(obj)))
+	}
+
+	// A header should be decodable.
+	bh := types.BlockHeader{Nonce: types.BlockNonce{1, 2, 3}}
+	var decodedHeader types.BlockHeader
+	err := decodeMinerObject(httptest.NewRecorder(), newRequest(bh), &decodedHeader, minerHeaderSizeLimit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decodedHeader != bh {
+		t.Fatal("decoded header doesn't match")
+	}
+
+	// A block of exactly the size limit should be decodable.
+	b := types.Block{Transactions: []types.Transaction{{ArbitraryData: [][]byte{nil}}}}
+	overhead := uint64(len(encoding.Marshal(b)))
+	b.Transactions[0].ArbitraryData[0] = make([]byte, minerBlockSizeLimit-overhead)
+	if size := uint64(len(encoding.Marshal(b))); size != minerBlockSizeLimit {
+		t.Fatalf("expected block of size %v but got %v", minerBlockSizeLimit, size)
+	}
+	var decodedBlock types.Block
+	err = decodeMinerObject(httptest.NewRecorder(), newRequest(b), &decodedBlock, minerBlockSizeLimit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decodedBlock.ID() != b.ID() {
+		t.Fatal("decoded block doesn't match")
+	}
+
+	// A larger block should be rejected.
+	b.Transactions[0].ArbitraryData[0] = append(b.Transactions[0].ArbitraryData[0], 0)
+	err = decodeMinerObject(httptest.NewRecorder(), newRequest(b), &decodedBlock, minerBlockSizeLimit)
+	if err == nil || !strings.Contains(err.Error(), "request body too large") {
+		t.Fatal("expected oversized block to be rejected", err)
+	}
+}
@@ -946,6 +946,16 @@ func (api *API) renterHandlerPOST(w http.ResponseWriter, req *http.Request, _ ht
 		settings.MaxUploadSpeed = uploadSpeed
 	}
 
+	// Scan the aggregate skylink download speed limit. (optional parameter)
+	if d := req.FormValue("maxskylinkdownloadspeed"); d != "" {
+		var downloadSpeed int64
+		if _, err := fmt.Sscan(d, &downloadSpeed); err != nil {
+			WriteError(w, Error{"unable to parse maxskylinkdownloadspeed: " + err.Error()}, http.StatusBadRequest)
+			return
+		}
+		settings.MaxSkylinkDownloadSpeed = downloadSpeed
+	}
+
 	// Scan the checkforipviolation flag.
 	if ipc := req.FormValue("checkforipviolation"); ipc != "" {
 		var ipviolationcheck bool
@@ -956,6 +966,40 @@ func (api *API) renterHandlerPOST(w http.ResponseWriter, req *http.Request, _ ht
 		settings.IPViolationCheck = ipviolationcheck
 	}
 
+	// Scan the skyfile idempotency key expiry. 0 resets it.
+	if e := req.FormValue("skyfileidempotencykeyexpiry"); e != "" {
+		var expiry uint64
+		if _, err := fmt.Sscan(e, &expiry); err != nil {
+			WriteError(w, Error{"unable to parse skyfileidempotencykeyexpiry: " + err.Error()}, http.StatusBadRequest)
+			return
+		}
+		settings.SkyfileIdempotencyKeyExpiry = time.Duration(expiry) * time.Second
+	}
+
+	// Scan the maximum number of subfiles of skyfiles. 0 resets it.
+	if m := req.FormValue("skyfilemaxsubfiles"); m != "" {
+		var maxSubfiles int
+		if _, err := fmt.Sscan(m, &maxSubfiles); err != nil {
+			WriteError(w, Error{"unable to parse skyfilemaxsubfiles: " + err.Error()}, http.StatusBadRequest)
+			return
+		}
+		settings.SkyfileMaxSubfiles = maxSubfiles
+	}
+
+	// Scan the allowed skyfile metadata fields. An empty value allows any
+	// field.
+	if _, ok := req.Form["skyfilemetadataallowedfields"]; ok {
+		settings.SkyfileMetadataAllowedFields = nil
+		if fields := req.FormValue("skyfilemetadataallowedfields"); fields != "" {
+			settings.SkyfileMetadataAllowedFields = strings.Split(fields, ",")
+		}
+	}
+
+	// Scan the default skyfile content type. An empty value resets it.
+	if _, ok := req.Form["defaultskyfilecontenttype"]; ok {
+		settings.DefaultSkyfileContentType = req.FormValue("defaultskyfilecontenttype")
+	}
+
 	// Set the settings in the renter.
 	err = api.renter.SetSettings(settings)
 	if err != nil {
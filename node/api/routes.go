@@ -58,6 +58,7 @@ func (api *API) buildHTTPRoutes() {
 	if api.explorer != nil {
 		router.GET("/explorer", api.explorerHandler)
 		router.GET("/explorer/blocks/:height", api.explorerBlocksHandler)
+		router.GET("/explorer/foundationsubsidy/:height", api.explorerFoundationSubsidyHandler)
 		router.GET("/explorer/hashes/:hash", api.explorerHashHandler)
 	}
 
@@ -159,6 +160,7 @@ func (api *API) buildHTTPRoutes() {
 		router.GET("/skynet/blocklist", api.skynetBlocklistHandlerGET)
 		router.POST("/skynet/blocklist", RequirePassword(api.skynetBlocklistHandlerPOST, requiredPassword))
 		router.POST("/skynet/pin/:skylink", RequirePassword(api.skynetSkylinkPinHandlerPOST, requiredPassword))
+		router.GET("/skynet/pinned", RequirePassword(api.skynetPinnedHandlerGET, requiredPassword))
 		router.GET("/skynet/portals", api.skynetPortalsHandlerGET)
 		router.POST("/skynet/portals", RequirePassword(api.skynetPortalsHandlerPOST, requiredPassword))
 		router.GET("/skynet/root", api.skynetRootHandlerGET)
@@ -167,6 +169,7 @@ func (api *API) buildHTTPRoutes() {
 		router.POST("/skynet/skyfile/*siapath", RequirePassword(api.skynetSkyfileHandlerPOST, requiredPassword))
 		router.POST("/skynet/registry", RequirePassword(api.registryHandlerPOST, requiredPassword))
 		router.GET("/skynet/registry", api.registryHandlerGET)
+		router.POST("/skynet/migrate/:skylink", RequirePassword(api.skynetMigrateHandlerPOST, requiredPassword))
 		router.POST("/skynet/restore", RequirePassword(api.skynetRestoreHandlerPOST, requiredPassword))
 		router.GET("/skynet/stats", api.skynetStatsHandlerGET)
 		router.GET("/skynet/skykey", RequirePassword(api.skykeyHandlerGET, requiredPassword))
@@ -54,6 +54,15 @@ const (
 	// could cause a go-routine leak by creating a bunch of requests with very
 	// high timeouts.
 	MaxSkynetRequestTimeout = 15 * 60 // in seconds
+
+	// DefaultSkynetPinnedLimit is the default number of pinned skylinks
+	// returned by the /skynet/pinned endpoint.
+	DefaultSkynetPinnedLimit = uint64(1000)
+
+	// MaxSkynetPinnedLimit is the maximum number of pinned skylinks that can
+	// be requested from the /skynet/pinned endpoint at once. This bounds the
+	// memory used by a single request.
+	MaxSkynetPinnedLimit = uint64(10000)
 )
 
 var (
@@ -94,6 +103,19 @@ type (
 		IsHash bool `json:"ishash"`
 	}
 
+	// SkynetPinnedGET contains the information queried for the /skynet/pinned
+	// GET endpoint.
+	SkynetPinnedGET struct {
+		Pinned []SkynetPinnedSkylink `json:"pinned"`
+	}
+
+	// SkynetPinnedSkylink is a skylink pinned by the node and the siapath of
+	// the skyfile pinning it.
+	SkynetPinnedSkylink struct {
+		Skylink string          `json:"skylink"`
+		SiaPath modules.SiaPath `json:"siapath"`
+	}
+
 	// SkynetPortalsGET contains the information queried for the /skynet/portals
 	// GET endpoint.
 	SkynetPortalsGET struct {
@@ -105,6 +127,16 @@ type (
 	SkynetPortalsPOST struct {
 		Add    []modules.SkynetPortal `json:"add"`
 		Remove []modules.NetAddress   `json:"remove"`
+
+		// Partial indicates that the valid changes should be applied even if
+		// some of the changes are invalid.
+		Partial bool `json:"partial"`
+	}
+
+	// SkynetMigratePOST is the response that the api returns after the
+	// /skynet/migrate/:skylink POST endpoint has been used.
+	SkynetMigratePOST struct {
+		Skylink string `json:"skylink"`
 	}
 
 	// SkynetRestorePOST is the response that the api returns after the
@@ -212,6 +244,13 @@ func (api *API) skynetBaseSectorHandlerGET(w http.ResponseWriter, req *http.Requ
 		timeout = time.Duration(timeoutInt) * time.Second
 	}
 
+	// Parse the base sector timeout.
+	baseSectorTimeout, err := parseBaseSectorTimeout(queryForm)
+	if err != nil {
+		WriteError(w, Error{err.Error()}, http.StatusBadRequest)
+		return
+	}
+
 	// Parse pricePerMS.
 	pricePerMS := DefaultSkynetPricePerMS
 	pricePerMSStr := queryForm.Get("priceperms")
@@ -229,7 +268,7 @@ func (api *API) skynetBaseSectorHandlerGET(w http.ResponseWriter, req *http.Requ
 	}
 
 	// Fetch the skyfile's streamer to serve the basesector of the file
-	streamer, err := api.renter.DownloadSkylinkBaseSector(skylink, timeout, pricePerMS)
+	streamer, err := api.renter.DownloadSkylinkBaseSector(skylink, timeout, baseSectorTimeout, pricePerMS)
 	if errors.Contains(err, renter.ErrSkylinkBlocked) {
 		WriteError(w, Error{err.Error()}, http.StatusUnavailableForLegalReasons)
 		return
@@ -238,6 +277,10 @@ func (api *API) skynetBaseSectorHandlerGET(w http.ResponseWriter, req *http.Requ
 		WriteError(w, Error{fmt.Sprintf("failed to fetch skylink: %v", err)}, http.StatusNotFound)
 		return
 	}
+	if errors.Contains(err, modules.ErrSkylinkFetchSizeMismatch) {
+		WriteError(w, Error{fmt.Sprintf("failed to fetch skylink: %v", err)}, http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		WriteError(w, Error{fmt.Sprintf("failed to fetch skylink: %v", err)}, http.StatusInternalServerError)
 		return
@@ -294,6 +337,49 @@ func (api *API) skynetBlocklistHandlerGET(w http.ResponseWriter, _ *http.Request
 	})
 }
 
+// skynetPinnedHandlerGET handles the API call to list the skylinks pinned by
+// the node.
+func (api *API) skynetPinnedHandlerGET(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	// Parse the pagination parameters.
+	offset, limit := uint64(0), DefaultSkynetPinnedLimit
+	if str := req.FormValue("offset"); str != "" {
+		var err error
+		offset, err = strconv.ParseUint(str, 10, 64)
+		if err != nil {
+			WriteError(w, Error{"unable to parse 'offset' parameter: " + err.Error()}, http.StatusBadRequest)
+			return
+		}
+	}
+	if str := req.FormValue("limit"); str != "" {
+		var err error
+		limit, err = strconv.ParseUint(str, 10, 64)
+		if err != nil {
+			WriteError(w, Error{"unable to parse 'limit' parameter: " + err.Error()}, http.StatusBadRequest)
+			return
+		}
+	}
+	if limit == 0 || limit > MaxSkynetPinnedLimit {
+		WriteError(w, Error{fmt.Sprintf("'limit' parameter must be between 1 and %v", MaxSkynetPinnedLimit)}, http.StatusBadRequest)
+		return
+	}
+
+	pinned, err := api.renter.PinnedSkylinks(offset, limit)
+	if err != nil {
+		WriteError(w, Error{"unable to get the pinned skylinks: " + err.Error()}, http.StatusInternalServerError)
+		return
+	}
+	spg := SkynetPinnedGET{
+		Pinned: make([]SkynetPinnedSkylink, 0, len(pinned)),
+	}
+	for _, ps := range pinned {
+		spg.Pinned = append(spg.Pinned, SkynetPinnedSkylink{
+			Skylink: ps.Skylink.String(),
+			SiaPath: ps.SiaPath,
+		})
+	}
+	WriteJSON(w, spg)
+}
+
 // skynetBlocklistHandlerPOST handles the API call to block certain skylinks.
 func (api *API) skynetBlocklistHandlerPOST(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
 	// Parse parameters
@@ -392,6 +478,22 @@ func (api *API) skynetPortalsHandlerPOST(w http.ResponseWriter, req *http.Reques
 		return
 	}
 
+	// If a partial update was requested, apply the valid changes and report
+	// the result of every change.
+	if params.Partial {
+		result, err := api.renter.UpdateSkynetPortalsPartial(params.Add, params.Remove)
+		if err != nil {
+			errStatus := http.StatusInternalServerError
+			if strings.Contains(err.Error(), skynetportals.ErrSkynetPortalsValidation.Error()) {
+				errStatus = http.StatusBadRequest
+			}
+			WriteError(w, Error{"unable to update the list of known skynet portals: " + err.Error()}, errStatus)
+			return
+		}
+		WriteJSON(w, result)
+		return
+	}
+
 	// Update the list of known skynet portals.
 	err = api.renter.UpdateSkynetPortals(params.Add, params.Remove)
 	if err != nil {
@@ -656,16 +758,78 @@ func (api *API) skynetSkylinkHandlerGET(w http.ResponseWriter, req *http.Request
 		}
 	}
 
+	// Parse the 'readahead' query string parameter.
+	var readAhead uint64
+	readAheadStr := queryForm.Get("readahead")
+	if readAheadStr != "" {
+		readAhead, err = strconv.ParseUint(readAheadStr, 10, 64)
+		if err != nil {
+			WriteError(w, Error{"unable to parse 'readahead' parameter: " + err.Error()}, http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Parse the 'preflight' and 'preflight-sample' query string parameters.
+	var preflight, preflightSample bool
+	preflightStr := queryForm.Get("preflight")
+	if preflightStr != "" {
+		preflight, err = strconv.ParseBool(preflightStr)
+		if err != nil {
+			WriteError(w, Error{"unable to parse 'preflight' parameter: " + err.Error()}, http.StatusBadRequest)
+			return
+		}
+	}
+	preflightSampleStr := queryForm.Get("preflight-sample")
+	if preflightSampleStr != "" {
+		preflightSample, err = strconv.ParseBool(preflightSampleStr)
+		if err != nil {
+			WriteError(w, Error{"unable to parse 'preflight-sample' parameter: " + err.Error()}, http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Parse the 'maxdownloadspeed' query string parameter.
+	var maxDownloadSpeed int64
+	maxDownloadSpeedStr := queryForm.Get("maxdownloadspeed")
+	if maxDownloadSpeedStr != "" {
+		maxDownloadSpeed, err = strconv.ParseInt(maxDownloadSpeedStr, 10, 64)
+		if err != nil {
+			WriteError(w, Error{"unable to parse 'maxdownloadspeed' parameter: " + err.Error()}, http.StatusBadRequest)
+			return
+		}
+		if maxDownloadSpeed < 0 {
+			WriteError(w, Error{"'maxdownloadspeed' parameter can't be negative"}, http.StatusBadRequest)
+			return
+		}
+		if preflight || preflightSample {
+			WriteError(w, Error{"'maxdownloadspeed' parameter can't be combined with 'preflight' or 'preflight-sample'"}, http.StatusBadRequest)
+			return
+		}
+	}
+
 	// Fetch the skyfile's metadata and a streamer to download the file
-	layout, metadata, streamer, err := api.renter.DownloadSkylink(skylink, timeout, pricePerMS)
+	var layout modules.SkyfileLayout
+	var metadata modules.SkyfileMetadata
+	var streamer modules.Streamer
+	if preflight || preflightSample {
+		layout, metadata, streamer, err = api.renter.DownloadSkylinkWithPreflight(skylink, readAhead, timeout, pricePerMS, preflightSample)
+	} else if maxDownloadSpeed > 0 {
+		layout, metadata, streamer, err = api.renter.DownloadSkylinkWithRateLimit(skylink, readAhead, maxDownloadSpeed, timeout, pricePerMS)
+	} else {
+		layout, metadata, streamer, err = api.renter.DownloadSkylinkWithReadAhead(skylink, readAhead, timeout, pricePerMS)
+	}
 	if errors.Contains(err, renter.ErrSkylinkBlocked) {
 		WriteError(w, Error{err.Error()}, http.StatusUnavailableForLegalReasons)
 		return
 	}
-	if errors.Contains(err, renter.ErrRootNotFound) {
+	if errors.Contains(err, renter.ErrRootNotFound) || errors.Contains(err, renter.ErrInsufficientRedundancy) {
 		WriteError(w, Error{fmt.Sprintf("failed to fetch skylink: %v", err)}, http.StatusNotFound)
 		return
 	}
+	if errors.Contains(err, modules.ErrSkylinkFetchSizeMismatch) {
+		WriteError(w, Error{fmt.Sprintf("failed to fetch skylink: %v", err)}, http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		WriteError(w, Error{fmt.Sprintf("failed to fetch skylink: %v", err)}, http.StatusInternalServerError)
 		return
@@ -771,6 +935,9 @@ func (api *API) skynetSkylinkHandlerGET(w http.ResponseWriter, req *http.Request
 
 		metadata = metadataForPath
 		isSubfile = file
+		if file {
+			responseContentType = metadataForPath.ContentType()
+		}
 	}
 
 	// If we are serving more than one file, and the format is not
@@ -879,9 +1046,13 @@ func (api *API) skynetSkylinkHandlerGET(w http.ResponseWriter, req *http.Request
 		return
 	}
 
-	// Only set the Content-Type header when the metadata defines one, if we
+	// Fall back to the renter's default content type for a file that doesn't
+	// declare one. Only set the Content-Type header when there is one, if we
 	// were to set the header to an empty string, it would prevent the http
 	// library from sniffing the file's content type.
+	if responseContentType == "" {
+		responseContentType = api.renter.DefaultSkyfileContentType()
+	}
 	if responseContentType != "" {
 		w.Header().Set("Content-Type", responseContentType)
 	}
@@ -938,6 +1109,13 @@ func (api *API) skynetSkylinkPinHandlerPOST(w http.ResponseWriter, req *http.Req
 		return
 	}
 
+	// Parse the base sector timeout.
+	baseSectorTimeout, err := parseBaseSectorTimeout(queryForm)
+	if err != nil {
+		WriteError(w, Error{err.Error()}, http.StatusBadRequest)
+		return
+	}
+
 	// Parse pricePerMS.
 	pricePerMS := DefaultSkynetPricePerMS
 	pricePerMSStr := queryForm.Get("priceperms")
@@ -993,17 +1171,92 @@ func (api *API) skynetSkylinkPinHandlerPOST(w http.ResponseWriter, req *http.Req
 		}
 	}
 
+	// Check whether encrypted skyfiles should be pinned without the skykey.
+	var pinEncryptedWithoutKey bool
+	if str := queryForm.Get("pinencryptedwithoutkey"); str != "" {
+		pinEncryptedWithoutKey, err = strconv.ParseBool(str)
+		if err != nil {
+			WriteError(w, Error{"unable to parse 'pinencryptedwithoutkey' parameter: " + err.Error()}, http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Check whether the number of concurrently uploaded fanout chunks is
+	// limited.
+	var maxConcurrentChunks uint64
+	if str := queryForm.Get("maxconcurrentchunks"); str != "" {
+		maxConcurrentChunks, err = strconv.ParseUint(str, 10, 64)
+		if err != nil {
+			WriteError(w, Error{"unable to parse 'maxconcurrentchunks' parameter: " + err.Error()}, http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Check whether the pin should be uploaded with low priority.
+	var lowPriority bool
+	if str := queryForm.Get("lowpriority"); str != "" {
+		lowPriority, err = strconv.ParseBool(str)
+		if err != nil {
+			WriteError(w, Error{"unable to parse 'lowpriority' parameter: " + err.Error()}, http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Check whether the base sector should be kept if the pin is canceled.
+	var keepBaseSectorOnCancel bool
+	if str := queryForm.Get("keepbasesectoroncancel"); str != "" {
+		keepBaseSectorOnCancel, err = strconv.ParseBool(str)
+		if err != nil {
+			WriteError(w, Error{"unable to parse 'keepbasesectoroncancel' parameter: " + err.Error()}, http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Check whether only the base sector should be pinned.
+	var baseSectorOnly bool
+	if str := queryForm.Get("basesectoronly"); str != "" {
+		baseSectorOnly, err = strconv.ParseBool(str)
+		if err != nil {
+			WriteError(w, Error{"unable to parse 'basesectoronly' parameter: " + err.Error()}, http.StatusBadRequest)
+			return
+		}
+	}
+
 	// Create the upload parameters. Notably, the fanout redundancy, the file
 	// metadata and the filename are not included. Changing those would change
 	// the skylink, which is not the goal.
 	lup := modules.SkyfileUploadParameters{
-		SiaPath:             siaPath,
-		Force:               force,
-		BaseChunkRedundancy: redundancy,
+		SiaPath:                siaPath,
+		Force:                  force,
+		BaseChunkRedundancy:    redundancy,
+		PinEncryptedWithoutKey: pinEncryptedWithoutKey,
+		PinMaxConcurrentChunks: maxConcurrentChunks,
+		PinLowPriority:         lowPriority,
+
+		PinKeepBaseSectorOnCancel: keepBaseSectorOnCancel,
 	}
 
-	err = api.renter.PinSkylink(skylink, lup, timeout, pricePerMS)
-	if errors.Contains(err, renter.ErrSkylinkBlocked) {
+	if baseSectorOnly {
+		// Only the base sector is fetched, so the base sector timeout
+		// doesn't apply.
+		err = api.renter.PinBaseSector(skylink, lup, timeout, pricePerMS)
+	} else {
+		// Use the request's context to abort the pin if the client goes
+		// away.
+		err = api.renter.PinSkylink(req.Context(), skylink, lup, timeout, baseSectorTimeout, pricePerMS)
+	}
+	if errors.Contains(err, renter.ErrAlreadyPinned) {
+		// Pinning a skylink that is already pinned at the requested siapath
+		// is a no-op.
+		WriteSuccess(w)
+		return
+	} else if errors.Contains(err, renter.ErrSkylinkPinnedElsewhere) {
+		WriteError(w, Error{fmt.Sprintf("Failed to pin file to Skynet: %v", err)}, http.StatusConflict)
+		return
+	} else if errors.Contains(err, renter.ErrSkylinkPartiallyPinned) {
+		WriteError(w, Error{err.Error()}, http.StatusUnprocessableEntity)
+		return
+	} else if errors.Contains(err, renter.ErrSkylinkBlocked) {
 		WriteError(w, Error{err.Error()}, http.StatusUnavailableForLegalReasons)
 		return
 	} else if errors.Contains(err, renter.ErrRootNotFound) {
@@ -1049,6 +1302,26 @@ func (api *API) skynetSkyfileHandlerPOST(w http.ResponseWriter, req *http.Reques
 		DefaultPath:        params.defaultPath,
 		DisableDefaultPath: params.disableDefaultPath,
 
+		// Set the http header hints and creation time
+		HTTPHeaders: params.httpHeaders,
+		CreatedAt:   params.createdAt,
+
+		// Set the idempotency key to deduplicate retried uploads
+		IdempotencyKey: params.idempotencyKey,
+
+		// Set the TTL after which the siafiles are deleted
+		TTL: params.ttl,
+
+		// Set whether the content types of the subfiles are verified
+		VerifyContentTypes: params.verifyContentTypes,
+
+		// Set the maximum number of subfiles
+		MaxSubfiles: api.renter.SkyfileMaxSubfiles(),
+
+		// Set the erasure coding overrides of the fanout
+		FanoutDataPieces:   params.fanoutDataPieces,
+		FanoutParityPieces: params.fanoutParityPieces,
+
 		// Set encryption key details
 		SkykeyName: params.skyKeyName,
 		SkykeyID:   params.skyKeyID,
@@ -1074,6 +1347,12 @@ func (api *API) skynetSkyfileHandlerPOST(w http.ResponseWriter, req *http.Reques
 		if errors.Contains(err, renter.ErrSkylinkBlocked) {
 			WriteError(w, Error{err.Error()}, http.StatusUnavailableForLegalReasons)
 			return
+		} else if errors.Contains(err, renter.ErrSkyfileIdempotencyKeyMismatch) {
+			WriteError(w, Error{fmt.Sprintf("failed to upload file to Skynet: %v", err)}, http.StatusConflict)
+			return
+		} else if errors.Contains(err, renter.ErrSkyfileUploadStalled) {
+			WriteError(w, Error{fmt.Sprintf("failed to upload file to Skynet: %v", err)}, http.StatusRequestTimeout)
+			return
 		} else if err != nil {
 			WriteError(w, Error{fmt.Sprintf("failed to upload file to Skynet: %v", err)}, http.StatusBadRequest)
 			return
@@ -1099,9 +1378,11 @@ func (api *API) skynetSkyfileHandlerPOST(w http.ResponseWriter, req *http.Reques
 		// match the performance bucket to the thing we are actually trying to
 		// measure.
 		file, err := api.renter.File(sup.SiaPath)
-		extendedPath := sup.SiaPath
-		extendedPath.Path = extendedPath.Path + ".extended"
-		file2, err2 := api.renter.File(extendedPath)
+		var file2 modules.FileInfo
+		extendedPath, err2 := modules.ExtendedSiaPath(sup.SiaPath)
+		if err2 == nil {
+			file2, err2 = api.renter.File(extendedPath)
+		}
 		var filesize uint64
 		if err == nil {
 			filesize = file.Filesize
@@ -1516,3 +1797,109 @@ func (api *API) skynetRestoreHandlerPOST(w http.ResponseWriter, req *http.Reques
 		Skylink: skylink.String(),
 	})
 }
+
+// skynetMigrateHandlerPOST handles the API call to migrate a skyfile that was
+// converted from a TypeThreefish siafile to the cipher type of regular skyfile
+// uploads.
+func (api *API) skynetMigrateHandlerPOST(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	// Parse the query params.
+	queryForm, err := url.ParseQuery(req.URL.RawQuery)
+	if err != nil {
+		WriteError(w, Error{"failed to parse query params"}, http.StatusBadRequest)
+		return
+	}
+
+	strLink := ps.ByName("skylink")
+	var skylink modules.Skylink
+	err = skylink.LoadString(strLink)
+	if err != nil {
+		WriteError(w, Error{fmt.Sprintf("error parsing skylink: %v", err)}, http.StatusBadRequest)
+		return
+	}
+
+	// Parse whether the siapath should be from root or from the skynet folder.
+	var root bool
+	rootStr := queryForm.Get("root")
+	if rootStr != "" {
+		root, err = strconv.ParseBool(rootStr)
+		if err != nil {
+			WriteError(w, Error{"unable to parse 'root' parameter: " + err.Error()}, http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Parse out the intended siapath.
+	var siaPath modules.SiaPath
+	siaPathStr := queryForm.Get("siapath")
+	if root {
+		siaPath, err = modules.NewSiaPath(siaPathStr)
+	} else {
+		siaPath, err = modules.SkynetFolder.Join(siaPathStr)
+	}
+	if err != nil {
+		WriteError(w, Error{"invalid siapath provided: " + err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	// Parse the timeout.
+	timeout, err := parseTimeout(queryForm)
+	if err != nil {
+		WriteError(w, Error{err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	// Parse pricePerMS.
+	pricePerMS := DefaultSkynetPricePerMS
+	pricePerMSStr := queryForm.Get("priceperms")
+	if pricePerMSStr != "" {
+		pricePerMSParsed, err := types.ParseCurrency(pricePerMSStr)
+		if err != nil {
+			WriteError(w, Error{"unable to parse 'pricePerMS' parameter: " + err.Error()}, http.StatusBadRequest)
+			return
+		}
+		_, err = fmt.Sscan(pricePerMSParsed, &pricePerMS)
+		if err != nil {
+			WriteError(w, Error{"unable to parse 'pricePerMS' parameter: " + err.Error()}, http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Check whether existing file should be overwritten
+	force := false
+	if strForce := queryForm.Get("force"); strForce != "" {
+		force, err = strconv.ParseBool(strForce)
+		if err != nil {
+			WriteError(w, Error{"unable to parse 'force' parameter: " + err.Error()}, http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Check whether the redundancy has been set.
+	redundancy := uint8(0)
+	if rStr := queryForm.Get("basechunkredundancy"); rStr != "" {
+		if _, err := fmt.Sscan(rStr, &redundancy); err != nil {
+			WriteError(w, Error{"unable to parse basechunkredundancy: " + err.Error()}, http.StatusBadRequest)
+			return
+		}
+	}
+
+	sup := modules.SkyfileUploadParameters{
+		SiaPath:             siaPath,
+		Force:               force,
+		Root:                root,
+		BaseChunkRedundancy: redundancy,
+	}
+	newSkylink, err := api.renter.MigrateThreefishSkyfile(skylink, sup, timeout, pricePerMS)
+	if errors.Contains(err, renter.ErrSkylinkBlocked) {
+		WriteError(w, Error{err.Error()}, http.StatusUnavailableForLegalReasons)
+		return
+	}
+	if err != nil {
+		WriteError(w, Error{"unable to migrate skyfile: " + err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	WriteJSON(w, SkynetMigratePOST{
+		Skylink: newSkylink.String(),
+	})
+}
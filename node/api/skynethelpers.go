@@ -3,8 +3,10 @@ package api
 import (
 	"archive/tar"
 	"archive/zip"
+	"encoding/json"
 	"fmt"
 	"io"
+	"math"
 	"mime"
 	"net/http"
 	"net/url"
@@ -27,17 +29,24 @@ type (
 	// string parameters on upload
 	skyfileUploadParams struct {
 		baseChunkRedundancy uint8
+		createdAt           int64
 		defaultPath         string
 		convertPath         string
 		disableDefaultPath  bool
 		dryRun              bool
+		fanoutDataPieces    uint8
+		fanoutParityPieces  uint8
 		filename            string
 		force               bool
+		httpHeaders         map[string]string
+		idempotencyKey      string
 		mode                os.FileMode
 		root                bool
 		siaPath             modules.SiaPath
 		skyKeyID            skykey.SkykeyID
 		skyKeyName          string
+		ttl                 time.Duration
+		verifyContentTypes  bool
 	}
 
 	// skyfileUploadHeaders is a helper struct that contains all of the request
@@ -109,6 +118,25 @@ func parseTimeout(queryForm url.Values) (time.Duration, error) {
 	return time.Duration(timeoutInt) * time.Second, nil
 }
 
+// parseBaseSectorTimeout tries to parse the base sector timeout from the query
+// string and validate it. If not present, it will return 0 which means the
+// renter derives it from the overall timeout.
+func parseBaseSectorTimeout(queryForm url.Values) (time.Duration, error) {
+	timeoutStr := queryForm.Get("basesectortimeout")
+	if timeoutStr == "" {
+		return 0, nil
+	}
+
+	timeoutInt, err := strconv.Atoi(timeoutStr)
+	if err != nil {
+		return 0, errors.AddContext(err, "unable to parse 'basesectortimeout'")
+	}
+	if timeoutInt > MaxSkynetRequestTimeout {
+		return 0, fmt.Errorf("'basesectortimeout' parameter too high, maximum allowed timeout is %ds", MaxSkynetRequestTimeout)
+	}
+	return time.Duration(timeoutInt) * time.Second, nil
+}
+
 // parseUploadHeadersAndRequestParameters is a helper function that parses all
 // of the query parameters and headers from an upload request
 func parseUploadHeadersAndRequestParameters(req *http.Request, ps httprouter.Params) (*skyfileUploadHeaders, *skyfileUploadParams, error) {
@@ -148,6 +176,15 @@ func parseUploadHeadersAndRequestParameters(req *http.Request, ps httprouter.Par
 	// parse 'convertpath' query parameter
 	convertPath := queryForm.Get("convertpath")
 
+	// parse 'createdat' query parameter
+	var createdAt int64
+	if createdAtStr := queryForm.Get("createdat"); createdAtStr != "" {
+		createdAt, err = strconv.ParseInt(createdAtStr, 10, 64)
+		if err != nil {
+			return nil, nil, errors.AddContext(err, "unable to parse 'createdat' parameter")
+		}
+	}
+
 	// parse 'defaultpath' query parameter
 	defaultPath := queryForm.Get("defaultpath")
 	if defaultPath != "" {
@@ -187,6 +224,32 @@ func parseUploadHeadersAndRequestParameters(req *http.Request, ps httprouter.Par
 		}
 	}
 
+	// parse 'httpheaders' query parameter
+	var httpHeaders map[string]string
+	httpHeadersStr := queryForm.Get("httpheaders")
+	if httpHeadersStr != "" {
+		err = json.Unmarshal([]byte(httpHeadersStr), &httpHeaders)
+		if err != nil {
+			return nil, nil, errors.AddContext(err, "unable to parse 'httpheaders' parameter")
+		}
+	}
+
+	// parse 'fanoutdatapieces' and 'fanoutparitypieces' query parameters
+	var fanoutDataPieces, fanoutParityPieces uint8
+	if dpStr := queryForm.Get("fanoutdatapieces"); dpStr != "" {
+		if _, err := fmt.Sscan(dpStr, &fanoutDataPieces); err != nil {
+			return nil, nil, errors.AddContext(err, "unable to parse 'fanoutdatapieces' parameter")
+		}
+	}
+	if ppStr := queryForm.Get("fanoutparitypieces"); ppStr != "" {
+		if _, err := fmt.Sscan(ppStr, &fanoutParityPieces); err != nil {
+			return nil, nil, errors.AddContext(err, "unable to parse 'fanoutparitypieces' parameter")
+		}
+	}
+
+	// parse 'idempotencykey' query parameter
+	idempotencyKey := queryForm.Get("idempotencykey")
+
 	// parse 'mode' query parameter
 	modeStr := queryForm.Get("mode")
 	var mode os.FileMode
@@ -232,6 +295,28 @@ func parseUploadHeadersAndRequestParameters(req *http.Request, ps httprouter.Par
 		}
 	}
 
+	// parse 'ttl' query parameter
+	var ttl time.Duration
+	if ttlStr := queryForm.Get("ttl"); ttlStr != "" {
+		ttlSeconds, err := strconv.ParseUint(ttlStr, 10, 64)
+		if err != nil {
+			return nil, nil, errors.AddContext(err, "unable to parse 'ttl' parameter")
+		}
+		if ttlSeconds > uint64(math.MaxInt64/int64(time.Second)) {
+			return nil, nil, errors.New("'ttl' parameter is too large")
+		}
+		ttl = time.Duration(ttlSeconds) * time.Second
+	}
+
+	// parse 'verifycontenttypes' query parameter
+	var verifyContentTypes bool
+	if verifyStr := queryForm.Get("verifycontenttypes"); verifyStr != "" {
+		verifyContentTypes, err = strconv.ParseBool(verifyStr)
+		if err != nil {
+			return nil, nil, errors.AddContext(err, "unable to parse 'verifycontenttypes' parameter")
+		}
+	}
+
 	// validate parameter combos
 
 	// verify force is not set if disable force header was set
@@ -254,11 +339,21 @@ func parseUploadHeadersAndRequestParameters(req *http.Request, ps httprouter.Par
 		return nil, nil, errors.New("DefaultPath and DisableDefaultPath can only be set on multipart uploads")
 	}
 
+	// verify content types are only verified on multipart uploads
+	if !isMultipartRequest(mediaType) && verifyContentTypes {
+		return nil, nil, errors.New("'verifycontenttypes' can only be set on multipart uploads")
+	}
+
 	// verify convertpath and filename are not combined
 	if convertPath != "" && filename != "" {
 		return nil, nil, errors.New("cannot set both a 'convertpath' and a 'filename'")
 	}
 
+	// verify convertpath and ttl are not combined
+	if convertPath != "" && ttl > 0 {
+		return nil, nil, errors.New("cannot set both a 'convertpath' and a 'ttl'")
+	}
+
 	// verify skykeyname and skykeyid are not combined
 	if skykeyName != "" && skykeyIDStr != "" {
 		return nil, nil, errors.New("cannot set both a 'skykeyname' and 'skykeyid'")
@@ -272,16 +367,23 @@ func parseUploadHeadersAndRequestParameters(req *http.Request, ps httprouter.Par
 	params := &skyfileUploadParams{
 		baseChunkRedundancy: baseChunkRedundancy,
 		convertPath:         convertPath,
+		createdAt:           createdAt,
 		defaultPath:         defaultPath,
 		disableDefaultPath:  disableDefaultPath,
 		dryRun:              dryRun,
+		fanoutDataPieces:    fanoutDataPieces,
+		fanoutParityPieces:  fanoutParityPieces,
 		filename:            filename,
 		force:               force,
+		httpHeaders:         httpHeaders,
+		idempotencyKey:      idempotencyKey,
 		mode:                mode,
 		root:                root,
 		siaPath:             siaPath,
 		skyKeyID:            skykeyID,
 		skyKeyName:          skykeyName,
+		ttl:                 ttl,
+		verifyContentTypes:  verifyContentTypes,
 	}
 	return headers, params, nil
 }
@@ -234,6 +234,25 @@ func NewDependencySkyfileUploadFail() *DependencyWithDisableAndEnable {
 	return newDependencywithDisableAndEnable("SkyfileUploadFail")
 }
 
+// NewDependencySkyfileUploadFailAfterFanout creates a new dependency that
+// simulates getting an error after the fanout of a large skyfile was uploaded.
+func NewDependencySkyfileUploadFailAfterFanout() *DependencyWithDisableAndEnable {
+	return newDependencywithDisableAndEnable("SkyfileUploadFailAfterFanout")
+}
+
+// NewDependencySkyfileUploadFailAfterSkylink creates a new dependency that
+// simulates getting an error after the skylink of a skyfile was created but
+// before its base sector was uploaded.
+func NewDependencySkyfileUploadFailAfterSkylink() *DependencyWithDisableAndEnable {
+	return newDependencywithDisableAndEnable("SkyfileUploadFailAfterSkylink")
+}
+
+// NewDependencySkyfileUploadFailAfterBaseSector creates a new dependency that
+// simulates getting an error after the base sector of a skyfile was uploaded.
+func NewDependencySkyfileUploadFailAfterBaseSector() *DependencyWithDisableAndEnable {
+	return newDependencywithDisableAndEnable("SkyfileUploadFailAfterBaseSector")
+}
+
 // NewDependencyCustomResolver creates a dependency from a given lookupIP
 // method which returns a custom resolver that uses the specified lookupIP
 // method to resolve hostnames.
@@ -75,6 +75,17 @@ func (d *DependencyFailUploadStreamFromReader) Disrupt(s string) bool {
 	return s == "failUploadStreamFromReader"
 }
 
+// DependencyDiscardUploadStream makes stream uploads consume the data from
+// the reader without uploading it.
+type DependencyDiscardUploadStream struct {
+	modules.ProductionDependencies
+}
+
+// Disrupt makes stream uploads discard the data.
+func (d *DependencyDiscardUploadStream) Disrupt(s string) bool {
+	return s == "DiscardUploadStream"
+}
+
 // DependencyDisableUploadGougingCheck ignores the upload gouging check
 type DependencyDisableUploadGougingCheck struct {
 	modules.ProductionDependencies
@@ -1,7 +1,6 @@
 package siatest
 
 import (
-	"bytes"
 	"unsafe"
 
 	"gitlab.com/NebulousLabs/Sia/crypto"
@@ -28,7 +27,7 @@ func solveHeader(target types.Target, bh types.BlockHeader) (types.BlockHeader,
 	var nonce uint64
 	for i := 0; i < 256; i++ {
 		id := crypto.HashBytes(header)
-		if bytes.Compare(target[:], id[:]) >= 0 {
+		if target.Satisfies(types.BlockID(id)) {
 			copy(bh.Nonce[:], header[32:40])
 			return bh, nil
 		}
@@ -43,6 +43,7 @@ func TestSkynetDownloads(t *testing.T) {
 		{Name: "DirectoryBasic", Test: testDownloadDirectoryBasic},
 		{Name: "DirectoryNested", Test: testDownloadDirectoryNested},
 		{Name: "ContentDisposition", Test: testDownloadContentDisposition},
+		{Name: "DefaultContentType", Test: testDownloadDefaultContentType},
 		{Name: "SkynetSkylinkHeader", Test: testSkynetSkylinkHeader},
 		{Name: "ETag", Test: testETag},
 	}
@@ -544,6 +545,68 @@ func testDownloadContentDisposition(t *testing.T, tg *siatest.TestGroup) {
 	}
 }
 
+// testDownloadDefaultContentType verifies that the renter's default skyfile
+// content type is reported for downloaded skyfiles that don't declare one.
+func testDownloadDefaultContentType(t *testing.T, tg *siatest.TestGroup) {
+	r := tg.Renters()[0]
+	defaultCT := "application/x-test"
+
+	// upload a single file without a content type
+	skylink, _, _, err := r.UploadNewSkyfileBlocking("DefaultContentType", 100, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// without a default the content type is sniffed from the data
+	_, header, err := r.SkynetSkylinkHead(skylink)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ct := header.Get("Content-Type"); ct == defaultCT {
+		t.Fatalf("unexpected content type '%v'", ct)
+	}
+
+	// set the default content type and reset it at the end of the test
+	err = r.RenterSetDefaultSkyfileContentTypePost(defaultCT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := r.RenterSetDefaultSkyfileContentTypePost(""); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	// the default content type is reported for the skyfile
+	_, header, err = r.SkynetSkylinkHead(skylink)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ct := header.Get("Content-Type"); ct != defaultCT {
+		t.Fatalf("expected content type '%v' but got '%v'", defaultCT, ct)
+	}
+
+	// upload a directory, multipart uploads declare the content types of
+	// their subfiles
+	files := []siatest.TestFile{
+		{Name: "a.txt", Data: fastrand.Bytes(10)},
+		{Name: "b", Data: fastrand.Bytes(10)},
+	}
+	skylink, _, _, err = r.UploadNewMultipartSkyfileBlocking("DefaultContentTypeDir", files, "", true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the declared content type of a subfile takes precedence
+	_, header, err = r.SkynetSkylinkHead(skylink + "/a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ct := header.Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Fatalf("expected content type 'text/plain' but got '%v'", ct)
+	}
+}
+
 // testETag verifies the functionality of the ETag response header
 func testETag(t *testing.T, tg *siatest.TestGroup) {
 	r := tg.Renters()[0]
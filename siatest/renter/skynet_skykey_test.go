@@ -4,9 +4,12 @@ import (
 	"bytes"
 	"fmt"
 	"net/url"
+	"strings"
 	"testing"
 
+	"gitlab.com/NebulousLabs/Sia/crypto"
 	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/modules/renter"
 	"gitlab.com/NebulousLabs/Sia/node/api"
 	"gitlab.com/NebulousLabs/Sia/node/api/client"
 	"gitlab.com/NebulousLabs/Sia/persist"
@@ -585,6 +588,40 @@ func testSkynetEncryption(t *testing.T, tg *siatest.TestGroup, skykeyType skykey
 	if pinnedFile.File.Skylinks[0] != skylink {
 		t.Fatal("skylink mismatch")
 	}
+
+	// Delete the skykey. Pinning the skyfile should now fail unless the
+	// renter is asked to pin the encrypted base sector as-is.
+	err = r.SkykeyDeleteByNamePost(encKeyName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pinSiaPath, err = modules.NewSiaPath("testSmallEncryptedPinPathNoKey" + skykeyType.ToString())
+	if err != nil {
+		t.Fatal(err)
+	}
+	pinLUP.SiaPath = pinSiaPath
+	err = r.SkynetSkylinkPinPost(skylink, pinLUP)
+	if err == nil {
+		t.Fatal("expected pinning without skykey to fail")
+	}
+	// The pin of the base sector succeeds but is reported as partial since
+	// the node can't tell whether the skyfile has a fanout.
+	pinLUP.PinEncryptedWithoutKey = true
+	err = r.SkynetSkylinkPinPost(skylink, pinLUP)
+	if err == nil || !strings.Contains(err.Error(), renter.ErrSkylinkPartiallyPinned.Error()) {
+		t.Fatalf("expected %v but got %v", renter.ErrSkylinkPartiallyPinned, err)
+	}
+	fullPinSiaPath, err = modules.SkynetFolder.Join(pinSiaPath.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	pinnedFile, err = r.RenterFileRootGet(fullPinSiaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pinnedFile.File.Skylinks) != 1 || pinnedFile.File.Skylinks[0] != skylink {
+		t.Fatal("skylink mismatch", pinnedFile.File.Skylinks)
+	}
 }
 
 // testSkynetEncryption tests the uploading and pinning of large skyfiles using
@@ -627,6 +664,25 @@ func testSkynetEncryptionLargeFile(t *testing.T, tg *siatest.TestGroup, skykeyTy
 		t.Error("bad filename")
 	}
 
+	// Download a few ranges that are not aligned with the encryption segments
+	// of the fanout, including one that spans multiple chunks.
+	ranges := []struct{ from, to uint64 }{
+		{1, 100},
+		{crypto.SegmentSize - 1, 3*crypto.SegmentSize + 7},
+		{modules.SectorSize - 13, modules.SectorSize + 17},
+		{2*modules.SectorSize + 33, 4*modules.SectorSize - 5},
+		{uint64(len(data)) - 21, uint64(len(data))},
+	}
+	for _, rng := range ranges {
+		fetchedRange, err := r.SkynetSkylinkRange(skylink, rng.from, rng.to)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(fetchedRange, data[rng.from:rng.to]) {
+			t.Fatalf("range [%v, %v) doesn't match", rng.from, rng.to)
+		}
+	}
+
 	// Pin the encrypted Skyfile.
 	pinSiaPath, err := modules.NewSiaPath("testEncryptedPinPath" + skykeyType.ToString())
 	if err != nil {
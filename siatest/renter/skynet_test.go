@@ -59,6 +59,7 @@ func TestSkynetSuite(t *testing.T) {
 	subTests := []siatest.SubTest{
 		{Name: "Basic", Test: testSkynetBasic},
 		{Name: "ConvertSiaFile", Test: testConvertSiaFile},
+		{Name: "MigrateThreefishSkyfile", Test: testMigrateThreefishSkyfile},
 		{Name: "LargeMetadata", Test: testSkynetLargeMetadata},
 		{Name: "MultipartUpload", Test: testSkynetMultipartUpload},
 		{Name: "InvalidFilename", Test: testSkynetInvalidFilename},
@@ -68,6 +69,7 @@ func TestSkynetSuite(t *testing.T) {
 		{Name: "BlocklistSkylink", Test: testSkynetBlocklistSkylink},
 		{Name: "BlocklistUpgrade", Test: testSkynetBlocklistUpgrade},
 		{Name: "Stats", Test: testSkynetStats},
+		{Name: "Pinned", Test: testSkynetPinned},
 		{Name: "Portals", Test: testSkynetPortals},
 		{Name: "HeadRequest", Test: testSkynetHeadRequest},
 		{Name: "NoMetadata", Test: testSkynetNoMetadata},
@@ -84,7 +86,9 @@ func TestSkynetSuite(t *testing.T) {
 		{Name: "DownloadBaseSector", Test: testSkynetDownloadBaseSectorNoEncryption},
 		{Name: "DownloadBaseSectorEncrypted", Test: testSkynetDownloadBaseSectorEncrypted},
 		{Name: "FanoutRegression", Test: testSkynetFanoutRegression},
+		{Name: "FanoutRedundancy", Test: testSkynetFanoutRedundancy},
 		{Name: "DownloadRangeEncrypted", Test: testSkynetDownloadRangeEncrypted},
+		{Name: "DownloadRateLimit", Test: testSkynetDownloadRateLimit},
 	}
 
 	// Run tests
@@ -670,6 +674,80 @@ func testConvertSiaFile(t *testing.T, tg *siatest.TestGroup) {
 	}
 }
 
+// testMigrateThreefishSkyfile tests migrating a skyfile that was converted
+// from a TypeThreefish siafile to a regular skyfile.
+func testMigrateThreefishSkyfile(t *testing.T, tg *siatest.TestGroup) {
+	r := tg.Renters()[0]
+
+	// Upload a siafile and convert it to a skyfile.
+	filesize := int(modules.SectorSize) + siatest.Fuzz()
+	localFile, remoteFile, err := r.UploadNewFileBlocking(filesize, 1, 2, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	localData, err := localFile.Data()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sup := modules.SkyfileUploadParameters{
+		SiaPath: modules.RandomSiaPath(),
+	}
+	sshp, err := r.SkynetConvertSiafileToSkyfilePost(sup, remoteFile.SiaPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldSkylink := sshp.Skylink
+
+	// The converted skyfile should use the Threefish cipher.
+	_, layout, err := r.SkynetSkylinkGetWithLayout(oldSkylink, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if layout.CipherType != crypto.TypeThreefish {
+		t.Fatal("expected converted skyfile to use TypeThreefish but got", layout.CipherType)
+	}
+
+	// Migrate the skyfile.
+	newSkylink, err := r.SkynetSkylinkMigratePost(oldSkylink, modules.RandomSiaPath(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if newSkylink == oldSkylink {
+		t.Fatal("expected migration to result in a new skylink")
+	}
+
+	// The migrated skyfile should no longer use the Threefish cipher.
+	_, layout, err = r.SkynetSkylinkGetWithLayout(newSkylink, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if layout.CipherType == crypto.TypeThreefish {
+		t.Fatal("expected migrated skyfile not to use TypeThreefish")
+	}
+
+	// Both skylinks should resolve to the same data and metadata.
+	oldData, oldMetadata, err := r.SkynetSkylinkGet(oldSkylink)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newData, newMetadata, err := r.SkynetSkylinkGet(newSkylink)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(oldData, localData) || !bytes.Equal(newData, localData) {
+		t.Fatal("skylink data doesn't match local data")
+	}
+	if oldMetadata.Filename != newMetadata.Filename || oldMetadata.Length != newMetadata.Length {
+		t.Fatal("metadata mismatch", oldMetadata, newMetadata)
+	}
+
+	// Migrating the migrated skyfile should fail.
+	_, err = r.SkynetSkylinkMigratePost(newSkylink, modules.RandomSiaPath(), false)
+	if err == nil || !strings.Contains(err.Error(), renter.ErrSkyfileNotThreefish.Error()) {
+		t.Fatalf("expected error %v but got %v", renter.ErrSkyfileNotThreefish, err)
+	}
+}
+
 // testSkynetMultipartUpload tests you can perform a multipart upload. It will
 // verify the upload without any subfiles, with small subfiles and with large
 // subfiles. Small files are files which are smaller than one sector, and thus
@@ -988,6 +1066,243 @@ func testSkynetStats(t *testing.T, tg *siatest.TestGroup) {
 	}
 }
 
+// testSkynetPinned tests the /skynet/pinned endpoint.
+func testSkynetPinned(t *testing.T, tg *siatest.TestGroup) {
+	r := tg.Renters()[0]
+
+	// Upload a skyfile.
+	skylink, sup, _, err := r.UploadNewSkyfileBlocking(t.Name(), 100, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	siaPath, err := sup.SiaPath.Rebase(modules.RootSiaPath(), modules.SkynetFolder)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The skylink should be listed as pinned by the skyfile.
+	var found bool
+	for offset := uint64(0); !found; offset += 10 {
+		spg, err := r.SkynetPinnedGet(offset, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(spg.Pinned) == 0 {
+			break
+		}
+		for _, pinned := range spg.Pinned {
+			if pinned.Skylink == skylink && pinned.SiaPath.Equals(siaPath) {
+				found = true
+			}
+		}
+	}
+	if !found {
+		t.Fatal("skylink wasn't listed as pinned")
+	}
+
+	// A limit of 0 is invalid.
+	_, err = r.SkynetPinnedGet(0, 0)
+	if err == nil {
+		t.Fatal("expected error for limit of 0")
+	}
+}
+
+// testSkynetDownloadRateLimit tests setting the aggregate rate limit of
+// skylink downloads and limiting the speed of a single download.
+func testSkynetDownloadRateLimit(t *testing.T, tg *siatest.TestGroup) {
+	r := tg.Renters()[0]
+
+	// Set the aggregate limit and check that it's reported by the settings.
+	readBPS := int64(1 << 20)
+	err := r.RenterSetMaxSkylinkDownloadSpeedPost(readBPS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rg, err := r.RenterGet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rg.Settings.MaxSkylinkDownloadSpeed != readBPS {
+		t.Fatalf("expected limit %v but got %v", readBPS, rg.Settings.MaxSkylinkDownloadSpeed)
+	}
+	defer func() {
+		if err := r.RenterSetMaxSkylinkDownloadSpeedPost(0); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	// Negative limits are rejected.
+	err = r.RenterSetMaxSkylinkDownloadSpeedPost(-1)
+	if err == nil {
+		t.Fatal("negative limit was accepted")
+	}
+
+	// Upload a skyfile and download it with a per-request limit. The first
+	// 16 KiB are read right away and the remaining 32 KiB at 16 KiB/s which
+	// means that the download should take at least a second.
+	size := uint64(3 << 14)
+	skylink, _, _, err := r.UploadNewSkyfileBlocking(t.Name(), size, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	data, _, err := r.SkynetSkylinkGetWithRateLimit(skylink, 1<<14)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uint64(len(data)) != size {
+		t.Fatalf("expected %v bytes but got %v", size, len(data))
+	}
+	if time.Since(start) < time.Second {
+		t.Fatal("download wasn't rate limited", time.Since(start))
+	}
+
+	// The per-request limit can't be negative.
+	_, _, err = r.SkynetSkylinkGetWithRateLimit(skylink, -1)
+	if err == nil {
+		t.Fatal("negative limit was accepted")
+	}
+}
+
+// TestSkynetPinBaseSector verifies that pinning only the base sector of a
+// skyfile keeps its metadata available once the hosts of the original upload
+// are gone while the fanout becomes unavailable.
+func TestSkynetPinBaseSector(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	// Create a testgroup.
+	groupParams := siatest.GroupParams{
+		Hosts:   3,
+		Renters: 1,
+		Miners:  1,
+	}
+	testDir := renterTestDir(t.Name())
+	tg, err := siatest.NewGroupFromTemplate(testDir, groupParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := tg.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	r := tg.Renters()[0]
+
+	// Upload a large skyfile.
+	size := 2*modules.SectorSize + uint64(siatest.Fuzz()+1)
+	skylink, sup, _, err := r.UploadNewSkyfileBlocking(t.Name(), size, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Add a host which doesn't store any sectors of the original upload.
+	originalHosts := tg.Hosts()
+	_, err = tg.AddNodeN(node.HostTemplate, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Pin only the base sector on all of the hosts.
+	pinSiaPath, err := modules.NewSiaPath("testPinBaseSector")
+	if err != nil {
+		t.Fatal(err)
+	}
+	numHosts := len(tg.Hosts())
+	err = r.SkynetSkylinkPinPost(skylink, modules.SkyfilePinParameters{
+		SiaPath:             pinSiaPath,
+		BaseChunkRedundancy: uint8(numHosts),
+		BaseSectorOnly:      true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The pinned file should only contain the base sector.
+	fullPinSiaPath, err := modules.SkynetFolder.Join(pinSiaPath.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	pinnedFile, err := r.RenterFileRootGet(fullPinSiaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pinnedFile.File.Skylinks) != 1 || pinnedFile.File.Skylinks[0] != skylink {
+		t.Fatal("skylink mismatch", pinnedFile.File.Skylinks)
+	}
+	if pinnedFile.File.Filesize != modules.SectorSize {
+		t.Fatalf("expected pinned file to have size %v but was %v", modules.SectorSize, pinnedFile.File.Filesize)
+	}
+	extPinSiaPath, err := modules.ExtendedSiaPath(fullPinSiaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = r.RenterFileRootGet(extPinSiaPath)
+	if err == nil || !strings.Contains(err.Error(), filesystem.ErrNotExist.Error()) {
+		t.Fatal("fanout shouldn't have been pinned", err)
+	}
+
+	// Wait for the pinned base sector to be uploaded to all of the hosts.
+	err = build.Retry(100, 100*time.Millisecond, func() error {
+		pinnedFile, err := r.RenterFileRootGet(fullPinSiaPath)
+		if err != nil {
+			return err
+		}
+		if pinnedFile.File.Redundancy < float64(numHosts) {
+			return fmt.Errorf("expected redundancy %v but was %v", numHosts, pinnedFile.File.Redundancy)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Delete the original skyfile and take the hosts of the original upload
+	// offline. The pinned base sector on the new host is now the only copy of
+	// the metadata and it should still be served.
+	siaPath, err := sup.SiaPath.Rebase(modules.RootSiaPath(), modules.SkynetFolder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	extSiaPath, err := modules.ExtendedSiaPath(siaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = errors.Compose(r.RenterFileDeleteRootPost(siaPath), r.RenterFileDeleteRootPost(extSiaPath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, h := range originalHosts {
+		if err := tg.StopNode(h); err != nil {
+			t.Fatal(err)
+		}
+	}
+	status, header, err := r.SkynetSkylinkHead(skylink)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status != http.StatusOK {
+		t.Fatalf("expected status %v but got %v", http.StatusOK, status)
+	}
+	var sm modules.SkyfileMetadata
+	err = json.Unmarshal([]byte(header.Get("Skynet-File-Metadata")), &sm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sm.Filename != t.Name() || sm.Length != size {
+		t.Fatal("unexpected metadata", sm)
+	}
+
+	// The fanout was only stored on the original hosts, so the content can't
+	// be downloaded anymore.
+	_, _, err = r.SkynetSkylinkGetWithTimeout(skylink, 5)
+	if err == nil {
+		t.Fatal("fanout shouldn't be available")
+	}
+}
+
 // TestSkynetInvalidFilename verifies that posting a Skyfile with invalid
 // filenames such as empty filenames, names containing ./ or ../ or names
 // starting with a forward-slash fails.
@@ -1904,6 +2219,67 @@ func testSkynetFanoutRegression(t *testing.T, tg *siatest.TestGroup) {
 	}
 }
 
+// testSkynetFanoutRedundancy verifies that a large skyfile can be uploaded with
+// non-default fanout erasure coding parameters and that they are recorded in
+// the layout.
+func testSkynetFanoutRedundancy(t *testing.T, tg *siatest.TestGroup) {
+	r := tg.Renters()[0]
+
+	// Upload a large skyfile with custom fanout parameters.
+	data := fastrand.Bytes(int(modules.SectorSize*2) + siatest.Fuzz())
+	siaPath, err := modules.NewSiaPath(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sup := modules.SkyfileUploadParameters{
+		SiaPath:             siaPath,
+		BaseChunkRedundancy: 2,
+		FanoutDataPieces:    2,
+		FanoutParityPieces:  1,
+		Filename:            "file",
+		Reader:              bytes.NewReader(data),
+	}
+	skylink, _, err := r.SkynetSkyfilePost(sup)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The layout should contain the custom parameters.
+	baseSectorReader, err := r.SkynetBaseSectorGet(skylink)
+	if err != nil {
+		t.Fatal(err)
+	}
+	baseSector, err := ioutil.ReadAll(baseSectorReader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	layout, _, _, _, err := modules.ParseSkyfileMetadata(baseSector)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if layout.FanoutDataPieces != sup.FanoutDataPieces || layout.FanoutParityPieces != sup.FanoutParityPieces {
+		t.Fatalf("expected fanout %v-of-%v but got %v-of-%v", sup.FanoutDataPieces, sup.FanoutDataPieces+sup.FanoutParityPieces, layout.FanoutDataPieces, layout.FanoutDataPieces+layout.FanoutParityPieces)
+	}
+
+	// The data should be downloadable.
+	fetchedData, _, err := r.SkynetSkylinkGet(skylink)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(fetchedData, data) {
+		t.Fatal("upload and download data does not match")
+	}
+
+	// Setting only one of the parameters should fail.
+	sup.SiaPath = modules.RandomSiaPath()
+	sup.FanoutParityPieces = 0
+	sup.Reader = bytes.NewReader(data)
+	_, _, err = r.SkynetSkyfilePost(sup)
+	if err == nil || !strings.Contains(err.Error(), "need to be set together") {
+		t.Fatal("expected upload with only fanout data pieces to fail", err)
+	}
+}
+
 // testSkynetSubDirDownload verifies downloading data from a skyfile using a
 // path to download single subfiles or subdirectories
 func testSkynetSubDirDownload(t *testing.T, tg *siatest.TestGroup) {
@@ -2671,6 +3047,22 @@ func testSkynetPortals(t *testing.T, tg *siatest.TestGroup) {
 	if len(spg.Portals) != 2 {
 		t.Fatalf("Incorrect number of portals, expected %v got %v", 2, len(spg.Portals))
 	}
+
+	// Test a partial update with a valid and an invalid addition.
+	result, err := r.SkynetPortalsPartialPost([]modules.SkynetPortal{portal2, portal3}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Additions) != 2 || result.Additions[0].Error != "" || !strings.Contains(result.Additions[1].Error, "missing port in address") {
+		t.Fatal("unexpected partial update result", result)
+	}
+	spg, err = r.SkynetPortalsGet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(spg.Portals) != 3 {
+		t.Fatalf("Incorrect number of portals, expected %v got %v", 3, len(spg.Portals))
+	}
 }
 
 // testSkynetHeadRequest verifies the functionality of sending a HEAD request to
@@ -3048,12 +3440,13 @@ func testSkynetRequestTimeout(t *testing.T, tg *siatest.TestGroup) {
 		t.Fatal("Expected error to specify the timeout")
 	}
 
-	// Verify timeout on pin request
+	// Verify timeout on pin request. The base sector is fetched with half of
+	// the overall timeout by default.
 	err = r.SkynetSkylinkPinPostWithTimeout(skylink, pinLUP, 2)
 	if errors.Contains(err, renter.ErrProjectTimedOut) {
 		t.Fatal("Expected pin request to time out")
 	}
-	if err == nil || !strings.Contains(err.Error(), "timed out after 2s") {
+	if err == nil || !strings.Contains(err.Error(), "timed out after 1s") {
 		t.Log(err)
 		t.Fatal("Expected error to specify the timeout")
 	}
@@ -4136,3 +4529,108 @@ func TestSkynetCleanupOnError(t *testing.T) {
 		t.Fatal("unexpected")
 	}
 }
+
+// TestSkynetCleanupOnErrorDisruptPoints verifies files are cleaned up if a
+// skyfile upload fails at any of the intermediate steps of the upload.
+func TestSkynetCleanupOnErrorDisruptPoints(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	t.Parallel()
+
+	// Create a testgroup.
+	groupParams := siatest.GroupParams{
+		Hosts:  3,
+		Miners: 1,
+	}
+	testDir := renterTestDir(t.Name())
+	tg, err := siatest.NewGroupFromTemplate(testDir, groupParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := tg.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	tests := []struct {
+		name      string
+		deps      *dependencies.DependencyWithDisableAndEnable
+		smallFile bool
+	}{
+		{"SkyfileUploadFailAfterFanout", dependencies.NewDependencySkyfileUploadFailAfterFanout(), false},
+		{"SkyfileUploadFailAfterSkylink", dependencies.NewDependencySkyfileUploadFailAfterSkylink(), true},
+		{"SkyfileUploadFailAfterBaseSector", dependencies.NewDependencySkyfileUploadFailAfterBaseSector(), true},
+	}
+	for _, test := range tests {
+		// Add a new renter with the dependency to interrupt skyfile uploads.
+		rt := node.RenterTemplate
+		rt.Allowance = siatest.DefaultAllowance
+		rt.Allowance.PaymentContractInitialFunding = siatest.DefaultPaymentContractInitialFunding
+		rt.RenterDeps = test.deps
+		nodes, err := tg.AddNodes(rt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := nodes[0]
+
+		// Create a helper function that returns true if the upload failed at
+		// the expected point.
+		uploadFailed := func(err error) bool {
+			return err != nil && strings.Contains(err.Error(), test.name)
+		}
+
+		// Create a helper function that returns true if the siapath does not
+		// exist.
+		skyfileDeleted := func(path modules.SiaPath) bool {
+			_, err := r.RenterFileRootGet(path)
+			return err != nil && strings.Contains(err.Error(), filesystem.ErrNotExist.Error())
+		}
+
+		// Upload a small file
+		if test.smallFile {
+			_, small, _, err := r.UploadNewSkyfileBlocking("smallfile", 100, false)
+			if !uploadFailed(err) {
+				t.Fatalf("%v: expected upload to fail but got %v", test.name, err)
+			}
+			smallPath, err := modules.SkynetFolder.Join(small.SiaPath.String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !skyfileDeleted(smallPath) {
+				t.Fatalf("%v: small skyfile wasn't deleted", test.name)
+			}
+		}
+
+		// Upload a large file
+		_, large, _, err := r.UploadNewSkyfileBlocking("largefile", modules.SectorSize*2, false)
+		if !uploadFailed(err) {
+			t.Fatalf("%v: expected upload to fail but got %v", test.name, err)
+		}
+		largePath, err := modules.SkynetFolder.Join(large.SiaPath.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !skyfileDeleted(largePath) {
+			t.Fatalf("%v: large skyfile wasn't deleted", test.name)
+		}
+		largePathExtended, err := modules.NewSiaPath(largePath.String() + modules.ExtendedSuffix)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !skyfileDeleted(largePathExtended) {
+			t.Fatalf("%v: extended siafile of large skyfile wasn't deleted", test.name)
+		}
+
+		// Disable the dependency and verify the upload succeeds.
+		test.deps.Disable()
+		_, _, _, err = r.UploadNewSkyfileBlocking("largefile", modules.SectorSize*2, true)
+		if err != nil {
+			t.Fatalf("%v: expected upload to succeed but got %v", test.name, err)
+		}
+		if skyfileDeleted(largePath) || skyfileDeleted(largePathExtended) {
+			t.Fatalf("%v: large skyfile was deleted after successful upload", test.name)
+		}
+	}
+}
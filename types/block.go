@@ -5,12 +5,17 @@ package types
 
 import (
 	"bytes"
-    "encoding/hex"
+	"encoding/hex"
+	"errors"
 
 	"gitlab.com/NebulousLabs/Sia/crypto"
 	"gitlab.com/NebulousLabs/encoding"
 )
 
+// errBlockLeafOutOfBounds is returned when a Merkle proof is requested for a
+// miner payout or transaction that doesn't exist.
+var errBlockLeafOutOfBounds = errors.New("block doesn't contain a leaf at the given index")
+
 const (
 	// BlockHeaderSize is the size, in bytes, of a block header.
 	// 32 (ParentID) + 8 (Nonce) + 8 (Timestamp) + 32 (MerkleRoot)
@@ -33,17 +38,24 @@ type (
 		Transactions []Transaction   `json:"transactions"`
 	}
 
-    BlockTemplate struct {
-		ParentID     BlockID         `json:"parentid"`
-		Nonce        BlockNonce      `json:"nonce"`
-		Timestamp    Timestamp       `json:"timestamp"`
-		MinerPayouts []SiacoinOutput `json:"minerpayouts"`
-		Transactions []TransactionID   `json:"transactions"`
-        Target Target `json:"target"`
-        TransactionsHex []string `json:"transactions_hex"`
-        Height BlockHeight `json:"height"`
-		MerkleRoot crypto.Hash `json:"merkleroot"`
-    }
+	BlockTemplate struct {
+		ParentID        BlockID         `json:"parentid"`
+		Nonce           BlockNonce      `json:"nonce"`
+		Timestamp       Timestamp       `json:"timestamp"`
+		MinerPayouts    []SiacoinOutput `json:"minerpayouts"`
+		Transactions    []TransactionID `json:"transactions"`
+		Target          Target          `json:"target"`
+		TransactionsHex []string        `json:"transactions_hex"`
+		Height          BlockHeight     `json:"height"`
+		MerkleRoot      crypto.Hash     `json:"merkleroot"`
+
+		// TransactionCount and TransactionsSize are the number of
+		// transactions in the template and their total encoded size in bytes.
+		// They allow miners to estimate the cost of fetching and validating
+		// the transactions before working on the template.
+		TransactionCount uint64 `json:"transactioncount"`
+		TransactionsSize uint64 `json:"transactionssize"`
+	}
 
 	// A BlockHeader contains the data that, when hashed, produces the Block's ID.
 	BlockHeader struct {
@@ -53,6 +65,16 @@ type (
 		MerkleRoot crypto.Hash `json:"merkleroot"`
 	}
 
+	// A BlockMerkleProof proves that a miner payout or a transaction is part
+	// of the Merkle root of a block. The leaves are indexed in the same order
+	// as in Block.MerkleRoot, the miner payouts first followed by the
+	// transactions. The proof doesn't contain the leaf itself.
+	BlockMerkleProof struct {
+		LeafIndex uint64        `json:"leafindex"`
+		NumLeaves uint64        `json:"numleaves"`
+		HashSet   []crypto.Hash `json:"hashset"`
+	}
+
 	// BlockHeight is the number of blocks that exist after the genesis block.
 	BlockHeight uint64
 	// A BlockID is the hash of a BlockHeader. A BlockID uniquely
@@ -68,7 +90,7 @@ type (
 // CalculateCoinbase calculates the coinbase for a given height. The coinbase
 // equation is:
 //
-//     coinbase := max(InitialCoinbase - height, MinimumCoinbase) * SiacoinPrecision
+//	coinbase := max(InitialCoinbase - height, MinimumCoinbase) * SiacoinPrecision
 func CalculateCoinbase(height BlockHeight) Currency {
 	base := InitialCoinbase - uint64(height)
 	if uint64(height) > InitialCoinbase || base < MinimumCoinbase {
@@ -89,31 +111,111 @@ func CalculateNumSiacoins(height BlockHeight) (total Currency) {
 		total = total.Add(avgDeflationSiacoins.Mul(NewCurrency64(uint64(deflationBlocks + 1))))
 		total = total.Add(CalculateCoinbase(height).Mul64(uint64(height - deflationBlocks)))
 	}
-	if height >= FoundationHardforkHeight {
-		total = total.Add(InitialFoundationSubsidy)
-		perSubsidy := FoundationSubsidyPerBlock.Mul64(uint64(FoundationSubsidyFrequency))
-		subsidies := (height - FoundationHardforkHeight) / FoundationSubsidyFrequency
-		total = total.Add(perSubsidy.Mul64(uint64(subsidies)))
-	}
+	total = total.Add(FoundationSubsidyTotal(height))
 	return
 }
 
-var numGenesisSiacoins = func() Currency {
-	// Sum all the values for the genesis siacoin outputs.
-	numGenesisSiacoins := NewCurrency64(0)
-	for _, transaction := range GenesisBlock.Transactions {
+// FoundationSubsidyTotal calculates the total number of siacoins that were
+// granted to the Foundation by the given height. That includes the initial
+// subsidy at the hardfork height and all regular subsidies after it.
+func FoundationSubsidyTotal(height BlockHeight) Currency {
+	if height < FoundationHardforkHeight {
+		return ZeroCurrency
+	}
+	perSubsidy := FoundationSubsidyPerBlock.Mul64(uint64(FoundationSubsidyFrequency))
+	subsidies := (height - FoundationHardforkHeight) / FoundationSubsidyFrequency
+	return InitialFoundationSubsidy.Add(perSubsidy.Mul64(uint64(subsidies)))
+}
+
+// FoundationSubsidy returns the value of the Foundation subsidy that is paid
+// out at the given height. If no subsidy is due at that height, ZeroCurrency
+// is returned.
+func FoundationSubsidy(height BlockHeight) Currency {
+	if height < FoundationHardforkHeight {
+		return ZeroCurrency
+	} else if height == FoundationHardforkHeight {
+		return InitialFoundationSubsidy
+	} else if (height-FoundationHardforkHeight)%FoundationSubsidyFrequency != 0 {
+		return ZeroCurrency
+	}
+	return FoundationSubsidyPerBlock.Mul64(uint64(FoundationSubsidyFrequency))
+}
+
+// NextFoundationSubsidy returns the height and value of the first Foundation
+// subsidy that is paid out after the given height.
+func NextFoundationSubsidy(height BlockHeight) (BlockHeight, Currency) {
+	if height < FoundationHardforkHeight {
+		return FoundationHardforkHeight, InitialFoundationSubsidy
+	}
+	next := height + FoundationSubsidyFrequency - (height-FoundationHardforkHeight)%FoundationSubsidyFrequency
+	return next, FoundationSubsidy(next)
+}
+
+// numGenesisSiacoins is the number of siacoins created by the genesis block.
+// It is set in init after the GenesisBlock was created.
+var numGenesisSiacoins Currency
+
+// GenesisSiacoinSupply returns the number of siacoins that were created by the
+// GenesisBlock of the current build.
+func GenesisSiacoinSupply() Currency {
+	return numGenesisSiacoins
+}
+
+// CalculateGenesisSiacoinSupply calculates the number of siacoins created by
+// the given genesis block by summing up the values of its siacoin outputs.
+func CalculateGenesisSiacoinSupply(genesis Block) Currency {
+	supply := NewCurrency64(0)
+	for _, transaction := range genesis.Transactions {
 		for _, siacoinOutput := range transaction.SiacoinOutputs {
-			numGenesisSiacoins = numGenesisSiacoins.Add(siacoinOutput.Value)
+			supply = supply.Add(siacoinOutput.Value)
 		}
 	}
-	return numGenesisSiacoins
-}()
+	return supply
+}
 
 // ID returns the ID of a Block, which is calculated by hashing the header.
 func (h BlockHeader) ID() BlockID {
 	return BlockID(crypto.HashObject(h))
 }
 
+// CachedBlockHeader wraps a BlockHeader and memoizes its ID, which avoids
+// rehashing the header in code that requests the ID of the same header
+// repeatedly. The header is unexported and can only be changed through
+// SetNonce, which resets the cached ID, so a stale ID is never returned.
+//
+// NOTE: a CachedBlockHeader is safe to copy, but not safe for concurrent use.
+type CachedBlockHeader struct {
+	header BlockHeader
+	id     BlockID
+	hasID  bool
+}
+
+// NewCachedBlockHeader returns a CachedBlockHeader for the given header.
+func NewCachedBlockHeader(h BlockHeader) CachedBlockHeader {
+	return CachedBlockHeader{header: h}
+}
+
+// Header returns a copy of the wrapped header.
+func (ch *CachedBlockHeader) Header() BlockHeader {
+	return ch.header
+}
+
+// ID returns the ID of the wrapped header. The header is only hashed the
+// first time the ID is requested after it was last changed.
+func (ch *CachedBlockHeader) ID() BlockID {
+	if !ch.hasID {
+		ch.id = ch.header.ID()
+		ch.hasID = true
+	}
+	return ch.id
+}
+
+// SetNonce changes the nonce of the wrapped header and resets the cached ID.
+func (ch *CachedBlockHeader) SetNonce(nonce BlockNonce) {
+	ch.header.Nonce = nonce
+	ch.hasID = false
+}
+
 // CalculateSubsidy takes a block and a height and determines the block
 // subsidy.
 func (b Block) CalculateSubsidy(height BlockHeight) Currency {
@@ -126,6 +228,20 @@ func (b Block) CalculateSubsidy(height BlockHeight) Currency {
 	return subsidy
 }
 
+// ValidMinerPayouts returns true if the miner payouts of the block are all
+// non-zero and sum up to the block's subsidy at the given height. This is a
+// cheap pre-check and no replacement for full consensus validation.
+func (b Block) ValidMinerPayouts(height BlockHeight) bool {
+	var payoutSum Currency
+	for _, payout := range b.MinerPayouts {
+		if payout.Value.IsZero() {
+			return false
+		}
+		payoutSum = payoutSum.Add(payout.Value)
+	}
+	return b.CalculateSubsidy(height).Equals(payoutSum)
+}
+
 // Header returns the header of a block.
 func (b Block) Header() BlockHeader {
 	return BlockHeader{
@@ -147,20 +263,106 @@ func (b Block) ID() BlockID {
 // tree are composed of the miner outputs (one leaf per payout), and the
 // transactions (one leaf per transaction).
 func (b Block) MerkleRoot() crypto.Hash {
+	tree := NewBlockMerkleTree(b.MinerPayouts)
+	for _, txn := range b.Transactions {
+		tree.PushTransaction(txn)
+	}
+	return tree.Root()
+}
+
+// BlockMerkleTree incrementally computes the Merkle root of a block. The
+// leaves are ordered the same way as in Block.MerkleRoot, the miner payouts
+// first followed by the transactions. This allows miners to add transactions
+// to a block one at a time without rebuilding the whole tree.
+type BlockMerkleTree struct {
+	buf  *bytes.Buffer
+	enc  *encoding.Encoder
+	tree *crypto.MerkleTree
+}
+
+// NewBlockMerkleTree creates a new BlockMerkleTree for a block with the given
+// miner payouts.
+func NewBlockMerkleTree(payouts []SiacoinOutput) *BlockMerkleTree {
+	buf := new(bytes.Buffer)
+	bmt := &BlockMerkleTree{
+		buf:  buf,
+		enc:  encoding.NewEncoder(buf),
+		tree: crypto.NewTree(),
+	}
+	for _, payout := range payouts {
+		payout.MarshalSia(bmt.enc)
+		bmt.tree.Push(bmt.buf.Bytes())
+		bmt.buf.Reset()
+	}
+	return bmt
+}
+
+// PushTransaction adds a transaction as the next leaf of the tree.
+func (bmt *BlockMerkleTree) PushTransaction(txn Transaction) {
+	txn.MarshalSia(bmt.enc)
+	bmt.tree.Push(bmt.buf.Bytes())
+	bmt.buf.Reset()
+}
+
+// Root returns the Merkle root of the block's leaves pushed so far.
+func (bmt *BlockMerkleTree) Root() crypto.Hash {
+	return bmt.tree.Root()
+}
+
+// MinerPayoutMerkleProof builds a proof that the miner payout at index i is
+// part of b.MerkleRoot().
+func (b Block) MinerPayoutMerkleProof(i uint64) (BlockMerkleProof, error) {
+	if i >= uint64(len(b.MinerPayouts)) {
+		return BlockMerkleProof{}, errBlockLeafOutOfBounds
+	}
+	return b.merkleProof(i), nil
+}
+
+// TransactionMerkleProof builds a proof that the transaction at index i is
+// part of b.MerkleRoot().
+func (b Block) TransactionMerkleProof(i uint64) (BlockMerkleProof, error) {
+	if i >= uint64(len(b.Transactions)) {
+		return BlockMerkleProof{}, errBlockLeafOutOfBounds
+	}
+	return b.merkleProof(uint64(len(b.MinerPayouts)) + i), nil
+}
+
+// merkleProof builds a proof for the leaf at the given index of the block's
+// Merkle tree.
+func (b Block) merkleProof(leafIndex uint64) BlockMerkleProof {
 	tree := crypto.NewTree()
-	var buf bytes.Buffer
-	e := encoding.NewEncoder(&buf)
+	tree.SetIndex(leafIndex)
 	for _, payout := range b.MinerPayouts {
-		payout.MarshalSia(e)
-		tree.Push(buf.Bytes())
-		buf.Reset()
+		tree.PushObject(payout)
 	}
 	for _, txn := range b.Transactions {
-		txn.MarshalSia(e)
-		tree.Push(buf.Bytes())
-		buf.Reset()
+		tree.PushObject(txn)
 	}
-	return tree.Root()
+	_, _, proof, _, numLeaves := tree.Prove()
+
+	// The first element of the proof is the hash of the leaf itself, which
+	// the verifier computes from the leaf.
+	hashSet := make([]crypto.Hash, len(proof)-1)
+	for i := range hashSet {
+		hashSet[i] = crypto.Hash(proof[i+1])
+	}
+	return BlockMerkleProof{
+		LeafIndex: leafIndex,
+		NumLeaves: numLeaves,
+		HashSet:   hashSet,
+	}
+}
+
+// VerifyMinerPayout checks whether the proof proves that the given miner
+// payout is part of the block with the given Merkle root.
+func (p BlockMerkleProof) VerifyMinerPayout(root crypto.Hash, payout SiacoinOutput) bool {
+	return crypto.VerifySegment(encoding.Marshal(payout), p.HashSet, p.NumLeaves, p.LeafIndex, root)
+}
+
+// VerifyTransaction checks whether the proof proves that the given
+// transaction is part of the block with the given Merkle root.
+func (p BlockMerkleProof) VerifyTransaction(root crypto.Hash, txn Transaction) bool {
+	return crypto.VerifySegment(encoding.Marshal(txn), p.HashSet, p.NumLeaves, p.LeafIndex, root)
 }
 
 // MinerPayoutID returns the ID of the miner payout at the given index, which
@@ -174,21 +376,25 @@ func (b Block) MinerPayoutID(i uint64) SiacoinOutputID {
 }
 
 func (b Block) BlockTemplate() BlockTemplate {
-    var txs []TransactionID
+	var txs []TransactionID
+	var txnsSize uint64
 
-    for _, txn := range b.Transactions {
-        txs = append(txs, txn.ID())
-    }
+	for _, txn := range b.Transactions {
+		txs = append(txs, txn.ID())
+		txnsSize += uint64(txn.MarshalSiaSize())
+	}
 
-    return BlockTemplate{
-        ParentID: b.ParentID,
-        Nonce: b.Nonce,
-        Timestamp: b.Timestamp,
-        MinerPayouts: b.MinerPayouts,
-        Transactions: txs,
-        TransactionsHex: b.TransactionsHex(),
-        MerkleRoot: b.MerkleRoot(),
-    }
+	return BlockTemplate{
+		ParentID:         b.ParentID,
+		Nonce:            b.Nonce,
+		Timestamp:        b.Timestamp,
+		MinerPayouts:     b.MinerPayouts,
+		Transactions:     txs,
+		TransactionsHex:  b.TransactionsHex(),
+		MerkleRoot:       b.MerkleRoot(),
+		TransactionCount: uint64(len(b.Transactions)),
+		TransactionsSize: txnsSize,
+	}
 }
 
 // FoundationSubsidyID returns the ID of the Foundation subsidy, which is
@@ -200,19 +406,19 @@ func (bid BlockID) FoundationSubsidyID() SiacoinOutputID {
 
 func (b Block) TransactionsHex() []string {
 
-    var txs []string
+	var txs []string
 
 	var buf bytes.Buffer
 	e := encoding.NewEncoder(&buf)
 	for _, payout := range b.MinerPayouts {
 		payout.MarshalSia(e)
-        txs = append(txs, hex.EncodeToString(buf.Bytes()))
+		txs = append(txs, hex.EncodeToString(buf.Bytes()))
 		buf.Reset()
 	}
 
 	for _, txn := range b.Transactions {
 		txn.MarshalSia(e)
-        txs = append(txs, hex.EncodeToString(buf.Bytes()))
+		txs = append(txs, hex.EncodeToString(buf.Bytes()))
 		buf.Reset()
 	}
 
@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"gitlab.com/NebulousLabs/encoding"
+	"gitlab.com/NebulousLabs/fastrand"
 )
 
 // BenchmarkEncodeEmptyBlock benchmarks encoding an empty block.
@@ -66,3 +67,71 @@ func BenchmarkDecodeHeavyBlock(b *testing.B) {
 		}
 	}
 }
+
+// BenchmarkBlockMerkleRootRecompute benchmarks assembling a block of
+// transactions by recomputing the Merkle root after every added transaction.
+func BenchmarkBlockMerkleRootRecompute(b *testing.B) {
+	txns := benchmarkBlockTransactions()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var block Block
+		for _, txn := range txns {
+			block.Transactions = append(block.Transactions, txn)
+			_ = block.MerkleRoot()
+		}
+	}
+}
+
+// BenchmarkBlockMerkleRootIncremental benchmarks assembling a block of
+// transactions by incrementally updating the Merkle root after every added
+// transaction.
+func BenchmarkBlockMerkleRootIncremental(b *testing.B) {
+	txns := benchmarkBlockTransactions()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tree := NewBlockMerkleTree(nil)
+		for _, txn := range txns {
+			tree.PushTransaction(txn)
+			_ = tree.Root()
+		}
+	}
+}
+
+// BenchmarkBlockHeaderID benchmarks computing the ID of the same block header
+// repeatedly.
+func BenchmarkBlockHeaderID(b *testing.B) {
+	var h BlockHeader
+	fastrand.Read(h.ParentID[:])
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = h.ID()
+	}
+}
+
+// BenchmarkCachedBlockHeaderID benchmarks computing the ID of the same block
+// header repeatedly using a CachedBlockHeader.
+func BenchmarkCachedBlockHeaderID(b *testing.B) {
+	var h BlockHeader
+	fastrand.Read(h.ParentID[:])
+	ch := NewCachedBlockHeader(h)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = ch.ID()
+	}
+}
+
+// benchmarkBlockTransactions returns a set of transactions for the block
+// assembly benchmarks.
+func benchmarkBlockTransactions() []Transaction {
+	txns := make([]Transaction, 500)
+	for i := range txns {
+		txns[i] = Transaction{
+			ArbitraryData: [][]byte{fastrand.Bytes(500)},
+		}
+	}
+	return txns
+}
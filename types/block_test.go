@@ -5,6 +5,7 @@ import (
 
 	"gitlab.com/NebulousLabs/Sia/crypto"
 	"gitlab.com/NebulousLabs/encoding"
+	"gitlab.com/NebulousLabs/fastrand"
 )
 
 // TestCalculateCoinbase probes the CalculateCoinbase function. The test code
@@ -61,6 +62,105 @@ func TestCalculateNumSiacoins(t *testing.T) {
 	}
 }
 
+// TestFoundationSubsidyTotal checks the total Foundation subsidy around the
+// hardfork height and across several subsidy intervals.
+func TestFoundationSubsidyTotal(t *testing.T) {
+	if FoundationHardforkHeight > 0 && !FoundationSubsidyTotal(FoundationHardforkHeight-1).IsZero() {
+		t.Fatal("expected no subsidy before the hardfork")
+	}
+	if !FoundationSubsidyTotal(FoundationHardforkHeight).Equals(InitialFoundationSubsidy) {
+		t.Fatal("expected initial subsidy at the hardfork")
+	}
+	perSubsidy := FoundationSubsidyPerBlock.Mul64(uint64(FoundationSubsidyFrequency))
+	for i := uint64(0); i < 5; i++ {
+		start := FoundationHardforkHeight + BlockHeight(i)*FoundationSubsidyFrequency
+		expected := InitialFoundationSubsidy.Add(perSubsidy.Mul64(i))
+		if total := FoundationSubsidyTotal(start); !total.Equals(expected) {
+			t.Fatalf("interval %v: expected %v but got %v", i, expected, total)
+		}
+		// The total shouldn't change until the next subsidy.
+		if total := FoundationSubsidyTotal(start + FoundationSubsidyFrequency - 1); !total.Equals(expected) {
+			t.Fatalf("interval %v: expected %v but got %v", i, expected, total)
+		}
+	}
+
+	// The Foundation subsidy should make up the difference between the
+	// circulating supply and the coinbase emission.
+	height := FoundationHardforkHeight + 3*FoundationSubsidyFrequency
+	if !CalculateNumSiacoins(height).Sub(CalculateNumSiacoins(height - 1)).Equals(CalculateCoinbase(height).Add(perSubsidy)) {
+		t.Fatal("foundation subsidy doesn't match circulation")
+	}
+}
+
+// TestFoundationSubsidySchedule checks the Foundation subsidies paid out at and
+// after given heights before and after the hardfork.
+func TestFoundationSubsidySchedule(t *testing.T) {
+	perSubsidy := FoundationSubsidyPerBlock.Mul64(uint64(FoundationSubsidyFrequency))
+
+	// Before the hardfork no subsidy is paid and the next one is the initial
+	// subsidy at the hardfork height.
+	for _, height := range []BlockHeight{0, FoundationHardforkHeight - 1} {
+		if !FoundationSubsidy(height).IsZero() {
+			t.Fatal("expected no subsidy before the hardfork", height)
+		}
+		next, value := NextFoundationSubsidy(height)
+		if next != FoundationHardforkHeight || !value.Equals(InitialFoundationSubsidy) {
+			t.Fatal("wrong next subsidy before the hardfork", height, next, value)
+		}
+	}
+
+	// At the hardfork the initial subsidy is paid.
+	if !FoundationSubsidy(FoundationHardforkHeight).Equals(InitialFoundationSubsidy) {
+		t.Fatal("expected initial subsidy at the hardfork")
+	}
+
+	// After the hardfork regular subsidies are paid at every interval.
+	for i := BlockHeight(0); i < 3; i++ {
+		start := FoundationHardforkHeight + i*FoundationSubsidyFrequency
+		for height := start; height < start+FoundationSubsidyFrequency; height++ {
+			next, value := NextFoundationSubsidy(height)
+			if next != start+FoundationSubsidyFrequency || !value.Equals(perSubsidy) {
+				t.Fatal("wrong next subsidy", height, next, value)
+			}
+			if height != start && !FoundationSubsidy(height).IsZero() {
+				t.Fatal("expected no subsidy between intervals", height)
+			}
+		}
+		if i > 0 && !FoundationSubsidy(start).Equals(perSubsidy) {
+			t.Fatal("expected regular subsidy", start)
+		}
+	}
+
+	// The sum of all subsidies should match the total.
+	total := ZeroCurrency
+	for height := BlockHeight(0); height <= FoundationHardforkHeight+5*FoundationSubsidyFrequency; height++ {
+		total = total.Add(FoundationSubsidy(height))
+		if !total.Equals(FoundationSubsidyTotal(height)) {
+			t.Fatal("subsidies don't add up to the total", height)
+		}
+	}
+}
+
+// TestGenesisSiacoinSupply checks that the genesis siacoin supply computed at
+// init matches the supply recomputed from the genesis block.
+func TestGenesisSiacoinSupply(t *testing.T) {
+	if !GenesisSiacoinSupply().Equals(CalculateGenesisSiacoinSupply(GenesisBlock)) {
+		t.Fatal("genesis siacoin supply doesn't match recomputed supply")
+	}
+
+	// A block with siacoin outputs should sum up all outputs.
+	b := Block{
+		Transactions: []Transaction{
+			{SiacoinOutputs: []SiacoinOutput{{Value: NewCurrency64(1)}, {Value: NewCurrency64(2)}}},
+			{SiafundOutputs: []SiafundOutput{{Value: NewCurrency64(100)}}},
+			{SiacoinOutputs: []SiacoinOutput{{Value: NewCurrency64(3)}}},
+		},
+	}
+	if supply := CalculateGenesisSiacoinSupply(b); !supply.Equals64(6) {
+		t.Fatal("wrong supply", supply)
+	}
+}
+
 // TestBlockHeader checks that BlockHeader returns the correct value, and that
 // the hash is consistent with the old method for obtaining the hash.
 func TestBlockHeader(t *testing.T) {
@@ -156,6 +256,48 @@ func TestHeaderID(t *testing.T) {
 	}
 }
 
+// TestCachedBlockHeader probes the ID caching of the CachedBlockHeader type.
+func TestCachedBlockHeader(t *testing.T) {
+	var h BlockHeader
+	fastrand.Read(h.ParentID[:])
+	fastrand.Read(h.MerkleRoot[:])
+	ch := NewCachedBlockHeader(h)
+	if ch.Header() != h {
+		t.Fatal("header doesn't match")
+	}
+
+	// The cached ID should match the ID of the header, also when it's
+	// requested again.
+	for i := 0; i < 2; i++ {
+		if ch.ID() != h.ID() {
+			t.Fatal("cached ID doesn't match header ID")
+		}
+	}
+
+	// Changing the original header or the returned copy shouldn't affect
+	// the cached header.
+	id := ch.ID()
+	h.Nonce[0]++
+	header := ch.Header()
+	header.Nonce[0]++
+	if ch.ID() != id || ch.Header().Nonce[0] != 0 {
+		t.Fatal("cached header was changed through a copy")
+	}
+
+	// A copy of the cached header should be independent as well.
+	chCopy := ch
+	chCopy.SetNonce(BlockNonce{1})
+	if ch.ID() != id {
+		t.Fatal("cached header was changed through a copy")
+	}
+
+	// Setting the nonce should reset the cached ID.
+	ch.SetNonce(BlockNonce{1})
+	if ch.ID() == id || ch.ID() != ch.Header().ID() || ch.ID() != chCopy.ID() {
+		t.Fatal("cached ID wasn't reset after setting the nonce")
+	}
+}
+
 // TestBlockCalculateSubsidy probes the CalculateSubsidy function of the block
 // type.
 func TestBlockCalculateSubsidy(t *testing.T) {
@@ -212,6 +354,150 @@ func TestBlockCalculateSubsidy(t *testing.T) {
 	}
 }
 
+// TestBlockValidMinerPayouts probes the ValidMinerPayouts method of the block
+// type.
+func TestBlockValidMinerPayouts(t *testing.T) {
+	height := BlockHeight(10)
+	b := Block{
+		Transactions: []Transaction{
+			{MinerFees: []Currency{NewCurrency64(123)}},
+		},
+	}
+	subsidy := b.CalculateSubsidy(height)
+
+	// Correct payouts, split across multiple outputs.
+	b.MinerPayouts = []SiacoinOutput{
+		{Value: subsidy.Sub(NewCurrency64(100))},
+		{Value: NewCurrency64(100)},
+	}
+	if !b.ValidMinerPayouts(height) {
+		t.Fatal("correct payouts were rejected")
+	}
+
+	// Under-paying.
+	b.MinerPayouts = []SiacoinOutput{{Value: subsidy.Sub(NewCurrency64(1))}}
+	if b.ValidMinerPayouts(height) {
+		t.Fatal("under-paying payouts were accepted")
+	}
+
+	// Over-paying.
+	b.MinerPayouts = []SiacoinOutput{{Value: subsidy.Add(NewCurrency64(1))}}
+	if b.ValidMinerPayouts(height) {
+		t.Fatal("over-paying payouts were accepted")
+	}
+
+	// Zero-value payout.
+	b.MinerPayouts = []SiacoinOutput{{Value: subsidy}, {Value: ZeroCurrency}}
+	if b.ValidMinerPayouts(height) {
+		t.Fatal("zero-value payout was accepted")
+	}
+}
+
+// TestBlockMerkleTree checks that the incrementally computed Merkle root of a
+// block matches the root computed by Block.MerkleRoot after every transaction.
+func TestBlockMerkleTree(t *testing.T) {
+	b := Block{
+		MinerPayouts: []SiacoinOutput{
+			{Value: NewCurrency64(1)},
+			{Value: NewCurrency64(2)},
+		},
+	}
+	tree := NewBlockMerkleTree(b.MinerPayouts)
+	if tree.Root() != b.MerkleRoot() {
+		t.Fatal("roots don't match for block without transactions")
+	}
+	for i := 0; i < 20; i++ {
+		txn := Transaction{
+			ArbitraryData: [][]byte{fastrand.Bytes(fastrand.Intn(100))},
+			MinerFees:     []Currency{NewCurrency64(uint64(i))},
+		}
+		b.Transactions = append(b.Transactions, txn)
+		tree.PushTransaction(txn)
+		if tree.Root() != b.MerkleRoot() {
+			t.Fatalf("roots don't match after %v transactions", i+1)
+		}
+	}
+
+	// An empty block should match as well.
+	if NewBlockMerkleTree(nil).Root() != (Block{}).MerkleRoot() {
+		t.Fatal("roots don't match for empty block")
+	}
+}
+
+// TestBlockMerkleProof checks that proofs for the miner payouts and
+// transactions of a block verify against the block's Merkle root.
+func TestBlockMerkleProof(t *testing.T) {
+	b := Block{
+		MinerPayouts: []SiacoinOutput{
+			{Value: NewCurrency64(1)},
+			{Value: NewCurrency64(2)},
+		},
+	}
+	for i := 0; i < 7; i++ {
+		b.Transactions = append(b.Transactions, Transaction{
+			ArbitraryData: [][]byte{fastrand.Bytes(fastrand.Intn(100))},
+			MinerFees:     []Currency{NewCurrency64(uint64(i))},
+		})
+	}
+	root := b.MerkleRoot()
+
+	// Every payout and transaction should be provable.
+	for i, payout := range b.MinerPayouts {
+		proof, err := b.MinerPayoutMerkleProof(uint64(i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !proof.VerifyMinerPayout(root, payout) {
+			t.Fatalf("proof for payout %v failed to verify", i)
+		}
+	}
+	for i, txn := range b.Transactions {
+		proof, err := b.TransactionMerkleProof(uint64(i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if proof.LeafIndex != uint64(len(b.MinerPayouts)+i) || proof.NumLeaves != uint64(len(b.MinerPayouts)+len(b.Transactions)) {
+			t.Fatal("wrong proof leaf index or number of leaves", proof.LeafIndex, proof.NumLeaves)
+		}
+		if !proof.VerifyTransaction(root, txn) {
+			t.Fatalf("proof for transaction %v failed to verify", i)
+		}
+
+		// The proof shouldn't verify for a different transaction, a
+		// different index or a different root.
+		other := b.Transactions[(i+1)%len(b.Transactions)]
+		if proof.VerifyTransaction(root, other) {
+			t.Fatal("proof verified for wrong transaction")
+		}
+		badProof := proof
+		badProof.LeafIndex = (proof.LeafIndex + 1) % proof.NumLeaves
+		if badProof.VerifyTransaction(root, txn) {
+			t.Fatal("proof verified for wrong index")
+		}
+		if proof.VerifyTransaction(crypto.Hash{}, txn) {
+			t.Fatal("proof verified for wrong root")
+		}
+	}
+
+	// Out of bounds indices should be rejected.
+	if _, err := b.MinerPayoutMerkleProof(uint64(len(b.MinerPayouts))); err == nil {
+		t.Fatal("expected error for out of bounds payout")
+	}
+	if _, err := b.TransactionMerkleProof(uint64(len(b.Transactions))); err == nil {
+		t.Fatal("expected error for out of bounds transaction")
+	}
+
+	// A block with a single transaction has an empty proof.
+	single := Block{Transactions: b.Transactions[:1]}
+	proof, err := single.TransactionMerkleProof(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(proof.HashSet) != 0 || !proof.VerifyTransaction(single.MerkleRoot(), single.Transactions[0]) {
+		t.Fatal("proof for single transaction failed to verify")
+	}
+}
+
 // TestBlockMinerPayoutID probes the MinerPayout function of the block type.
 func TestBlockMinerPayoutID(t *testing.T) {
 	// Create a block with 2 miner payouts, and check that each payout has a
@@ -236,3 +522,35 @@ func TestBlockMinerPayoutID(t *testing.T) {
 		knownIDs[id] = struct{}{}
 	}
 }
+
+// TestBlockTemplateTransactionStats checks that the template of a block reports
+// the number of transactions and their total encoded size.
+func TestBlockTemplateTransactionStats(t *testing.T) {
+	// An empty block has no transactions.
+	bt := Block{}.BlockTemplate()
+	if bt.TransactionCount != 0 || bt.TransactionsSize != 0 {
+		t.Fatal("unexpected stats for empty block", bt.TransactionCount, bt.TransactionsSize)
+	}
+
+	// Add two transactions of different sizes.
+	b := Block{
+		Transactions: []Transaction{
+			{ArbitraryData: [][]byte{fastrand.Bytes(10)}},
+			{ArbitraryData: [][]byte{fastrand.Bytes(100)}},
+		},
+	}
+	var size uint64
+	for _, txn := range b.Transactions {
+		size += uint64(len(encoding.Marshal(txn)))
+	}
+	bt = b.BlockTemplate()
+	if bt.TransactionCount != 2 {
+		t.Fatal("wrong transaction count", bt.TransactionCount)
+	}
+	if bt.TransactionsSize != size {
+		t.Fatalf("wrong transactions size %v != %v", bt.TransactionsSize, size)
+	}
+	if uint64(len(bt.Transactions)) != bt.TransactionCount {
+		t.Fatal("transaction count doesn't match the transaction ids")
+	}
+}
@@ -672,6 +672,8 @@ func init() {
 	}
 	// Calculate the genesis ID.
 	GenesisID = GenesisBlock.ID()
+	// Calculate the number of siacoins created by the genesis block.
+	numGenesisSiacoins = CalculateGenesisSiacoinSupply(GenesisBlock)
 }
 
 // GenerateDeterministicMultisig is a helper function that generates a set of
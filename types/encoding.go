@@ -73,6 +73,28 @@ func (bid *BlockID) UnmarshalJSON(b []byte) error {
 	return (*crypto.Hash)(bid).UnmarshalJSON(b)
 }
 
+// MarshalJSON marshals a block nonce as a lowercase hex string.
+func (bn BlockNonce) MarshalJSON() ([]byte, error) {
+	return json.Marshal(hex.EncodeToString(bn[:]))
+}
+
+// UnmarshalJSON decodes the json hex string of the block nonce. For
+// compatibility, the nonce can also be provided as a json array of bytes.
+func (bn *BlockNonce) UnmarshalJSON(b []byte) error {
+	if len(b) > 0 && b[0] == '[' {
+		return json.Unmarshal(b, (*[8]byte)(bn))
+	}
+	var str string
+	if err := json.Unmarshal(b, &str); err != nil {
+		return errors.AddContext(err, "could not unmarshal block nonce")
+	}
+	if len(str) != len(bn)*2 {
+		return fmt.Errorf("could not unmarshal block nonce: expected %v hex characters but got %v", len(bn)*2, len(str))
+	}
+	_, err := hex.Decode(bn[:], []byte(str))
+	return errors.AddContext(err, "could not unmarshal block nonce")
+}
+
 // MarshalSia implements the encoding.SiaMarshaler interface.
 func (cf CoveredFields) MarshalSia(w io.Writer) error {
 	e := encoding.NewEncoder(w)
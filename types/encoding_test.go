@@ -149,6 +149,63 @@ func TestBadBlock(t *testing.T) {
 	}
 }
 
+// TestBlockNonceJSON probes the MarshalJSON and UnmarshalJSON methods of the
+// BlockNonce type.
+func TestBlockNonceJSON(t *testing.T) {
+	nonce := BlockNonce{4, 12, 219, 7, 0, 0, 0, 255}
+
+	// The nonce should be encoded as a lowercase hex string.
+	b, err := json.Marshal(nonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != `"040cdb07000000ff"` {
+		t.Fatal("unexpected json encoding", string(b))
+	}
+
+	// Round-trip through JSON, also as part of a block.
+	var decNonce BlockNonce
+	if err := json.Unmarshal(b, &decNonce); err != nil {
+		t.Fatal(err)
+	}
+	if decNonce != nonce {
+		t.Fatal("nonce changed after json round-trip", nonce, decNonce)
+	}
+	block := Block{Nonce: nonce}
+	b, err = json.Marshal(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decBlock Block
+	if err := json.Unmarshal(b, &decBlock); err != nil {
+		t.Fatal(err)
+	}
+	if decBlock.Nonce != nonce {
+		t.Fatal("nonce changed after json round-trip", nonce, decBlock.Nonce)
+	}
+
+	// The legacy array encoding should still be accepted.
+	decNonce = BlockNonce{}
+	if err := json.Unmarshal([]byte("[4,12,219,7,0,0,0,255]"), &decNonce); err != nil {
+		t.Fatal(err)
+	}
+	if decNonce != nonce {
+		t.Fatal("nonce changed after decoding legacy encoding", nonce, decNonce)
+	}
+
+	// Invalid nonces should be rejected.
+	for _, invalid := range []string{`"040cdb07"`, `"040cdb07000000ff00"`, `"zz0cdb07000000ff"`, `5`} {
+		if err := json.Unmarshal([]byte(invalid), &decNonce); err == nil {
+			t.Fatal("invalid nonce was decoded", invalid)
+		}
+	}
+
+	// The binary encoding should be unchanged.
+	if !bytes.Equal(encoding.Marshal(nonce), nonce[:]) {
+		t.Fatal("binary encoding of nonce changed", encoding.Marshal(nonce))
+	}
+}
+
 // TestCurrencyMarshalJSON probes the MarshalJSON and UnmarshalJSON functions
 // of the currency type.
 func TestCurrencyMarshalJSON(t *testing.T) {
@@ -4,6 +4,7 @@ package types
 // manipulating the target type.
 
 import (
+	"bytes"
 	"errors"
 	"math/big"
 
@@ -107,6 +108,13 @@ func RatToTarget(r *big.Rat) (t Target) {
 	return
 }
 
+// Satisfies returns true if the given ID meets the target. An ID meets the
+// target if, interpreted as a big-endian number, it is less than or equal to
+// the target.
+func (x Target) Satisfies(id BlockID) bool {
+	return bytes.Compare(x[:], id[:]) >= 0
+}
+
 // SubtractDifficulties returns the resulting target with the difficulty of 'x'
 // is subtracted from the target with difficulty 'y'. Note that the difficulty
 // is the inverse of the target. The difference is defined by:
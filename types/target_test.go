@@ -189,3 +189,51 @@ func TestTargetNegativeRatToTarget(t *testing.T) {
 	r := big.NewRat(3, -5)
 	_ = RatToTarget(r)
 }
+
+// TestTargetSatisfies probes the Satisfies function of the target type.
+func TestTargetSatisfies(t *testing.T) {
+	var target Target
+	target[0] = 0x01
+	target[crypto.HashSize-1] = 0x80
+
+	// An ID exactly at the target satisfies it.
+	at := BlockID(target)
+	if !target.Satisfies(at) {
+		t.Error("ID at the target should satisfy it")
+	}
+
+	// An ID just below the target satisfies it.
+	below := at
+	below[crypto.HashSize-1]--
+	if !target.Satisfies(below) {
+		t.Error("ID below the target should satisfy it")
+	}
+
+	// An ID just above the target doesn't satisfy it.
+	above := at
+	above[crypto.HashSize-1]++
+	if target.Satisfies(above) {
+		t.Error("ID above the target shouldn't satisfy it")
+	}
+
+	// The comparison is numeric, more significant bytes take precedence.
+	var leadingZeros BlockID
+	leadingZeros[1] = 0xff
+	if !target.Satisfies(leadingZeros) {
+		t.Error("ID with more leading zeros should satisfy the target")
+	}
+	var highByte BlockID
+	highByte[0] = 0x02
+	if target.Satisfies(highByte) {
+		t.Error("ID with a larger leading byte shouldn't satisfy the target")
+	}
+
+	// The maximum target is satisfied by every ID.
+	var maxID BlockID
+	for i := range maxID {
+		maxID[i] = 0xff
+	}
+	if !Target(maxID).Satisfies(maxID) {
+		t.Error("the maximum target should be satisfied by every ID")
+	}
+}
@@ -4,7 +4,20 @@ package types
 // interface for slices of timestamps.
 
 import (
+	"fmt"
 	"time"
+
+	"gitlab.com/NebulousLabs/errors"
+)
+
+var (
+	// ErrTimestampTooEarly is returned by ValidTimestamp if a timestamp is
+	// earlier than the minimum allowed timestamp.
+	ErrTimestampTooEarly = errors.New("timestamp is earlier than the minimum allowed timestamp")
+
+	// ErrTimestampTooFarInFuture is returned by ValidTimestamp if a timestamp
+	// is further in the future than ExtremeFutureThreshold allows.
+	ErrTimestampTooFarInFuture = errors.New("timestamp is too far in the future")
 )
 
 type (
@@ -19,6 +32,22 @@ func CurrentTimestamp() Timestamp {
 	return Timestamp(time.Now().Unix())
 }
 
+// ValidTimestamp checks whether a block with the given timestamp would not be
+// discarded by consensus. The timestamp must not be earlier than the minimum
+// timestamp, which is the median timestamp of the block's ancestors, and must
+// not exceed the current time by more than ExtremeFutureThreshold. Blocks
+// beyond FutureThreshold are still valid since consensus holds on to them until
+// they are no longer in the future.
+func ValidTimestamp(ts, minTimestamp, currentTime Timestamp) error {
+	if ts < minTimestamp {
+		return errors.AddContext(ErrTimestampTooEarly, fmt.Sprintf("%v < %v", ts, minTimestamp))
+	}
+	if ts > currentTime+ExtremeFutureThreshold {
+		return errors.AddContext(ErrTimestampTooFarInFuture, fmt.Sprintf("%v is more than %v seconds after %v", ts, ExtremeFutureThreshold, currentTime))
+	}
+	return nil
+}
+
 // Len is part of sort.Interface
 func (ts TimestampSlice) Len() int {
 	return len(ts)
@@ -3,6 +3,8 @@ package types
 import (
 	"sort"
 	"testing"
+
+	"gitlab.com/NebulousLabs/errors"
 )
 
 // TestTimestampSorting verifies that using sort.Sort accurately sorts
@@ -26,3 +28,25 @@ func TestTimestampSorting(t *testing.T) {
 		currentTime = timestamp
 	}
 }
+
+// TestValidTimestamp probes ValidTimestamp at the boundaries of the allowed
+// timestamps.
+func TestValidTimestamp(t *testing.T) {
+	now := CurrentTimestamp()
+	minTimestamp := now - 1000
+
+	// Timestamps within the window are valid.
+	for _, ts := range []Timestamp{minTimestamp, now, now + FutureThreshold, now + ExtremeFutureThreshold} {
+		if err := ValidTimestamp(ts, minTimestamp, now); err != nil {
+			t.Fatal("valid timestamp was rejected", ts, err)
+		}
+	}
+	// One second before the minimum timestamp is invalid.
+	if err := ValidTimestamp(minTimestamp-1, minTimestamp, now); !errors.Contains(err, ErrTimestampTooEarly) {
+		t.Fatal("expected ErrTimestampTooEarly but got", err)
+	}
+	// One second beyond the allowed drift is invalid.
+	if err := ValidTimestamp(now+ExtremeFutureThreshold+1, minTimestamp, now); !errors.Contains(err, ErrTimestampTooFarInFuture) {
+		t.Fatal("expected ErrTimestampTooFarInFuture but got", err)
+	}
+}